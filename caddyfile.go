@@ -24,11 +24,37 @@ import (
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
 
 	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/challenge"
+	"github.com/greenpau/caddy-auth-portal/pkg/compression"
 	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
 	"github.com/greenpau/caddy-auth-portal/pkg/core"
+	"github.com/greenpau/caddy-auth-portal/pkg/denial"
+	"github.com/greenpau/caddy-auth-portal/pkg/dpop"
+	"github.com/greenpau/caddy-auth-portal/pkg/email"
+	"github.com/greenpau/caddy-auth-portal/pkg/enumeration"
+	"github.com/greenpau/caddy-auth-portal/pkg/events"
+	"github.com/greenpau/caddy-auth-portal/pkg/exchange"
+	"github.com/greenpau/caddy-auth-portal/pkg/flags"
+	"github.com/greenpau/caddy-auth-portal/pkg/introspection"
+	"github.com/greenpau/caddy-auth-portal/pkg/logging"
+	"github.com/greenpau/caddy-auth-portal/pkg/maintenance"
+	"github.com/greenpau/caddy-auth-portal/pkg/mfa"
+	"github.com/greenpau/caddy-auth-portal/pkg/passthrough"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
+	"github.com/greenpau/caddy-auth-portal/pkg/ratelimit"
+	"github.com/greenpau/caddy-auth-portal/pkg/recovery"
 	"github.com/greenpau/caddy-auth-portal/pkg/registration"
+	"github.com/greenpau/caddy-auth-portal/pkg/robots"
+	"github.com/greenpau/caddy-auth-portal/pkg/routing"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"github.com/greenpau/caddy-auth-portal/pkg/signing"
+	"github.com/greenpau/caddy-auth-portal/pkg/tracing"
+	"github.com/greenpau/caddy-auth-portal/pkg/transformer"
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/unsupported"
 	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"github.com/greenpau/caddy-auth-portal/pkg/webhook"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
@@ -67,17 +93,263 @@ func init() {
 //	       logo_url <file_path|url_path>
 //	       logo_description <value>
 //         custom_css_path <path}url>
+//         custom_page_header_path <file_path>
+//         custom_page_footer_path <file_path>
+//         static_asset_max_age <seconds>
+//         login_hint_parameter <name>
+//         login_success <redirect|page>
+//         fallback_message "<text>"
+//         single_provider_redirect <yes|no>
+//         session_expiry_meta <yes|no>
+//         login_instructions <realm> "<text>" [help_url <url>]
+//         rollout <percent> [session|ip]
+//         variant <name> <file_path>
 //	     }
 //
 //       cookie_domain <name>
 //       cookie_path <name>
+//       cookie_lifetime <seconds> role <name>
+//       cookie_lifetime <seconds> claim <name> <value>
+//       cookie_expiry <max-age|expires|both|session>
+//       cookie_per_realm
+//       cookie_redirect_secret <secret>
+//       max_token_size <bytes> [fail|trim <claim1> ... <claimN>]
 //
 //       registration {
 //         disabled <on|off>
 //         title "User Registration"
 //         code "NY2020"
 //         dropbox <file/path/to/registration/dir/>
+//         realm <name> <file/path/to/registration/db> [<title>]
 //         require accept_terms
+//         require invitation
+//         invitation_lifetime <seconds>
+//         invitation_admin_role <role1> ... <roleN>
+//         wizard_step <account|profile|verification> [title <title>] [fields <name1> ... <nameN>]
+//         wizard_lifetime <seconds>
+//       }
+//
+//       maintenance {
+//         enabled <yes|no>
+//         message "The portal is undergoing maintenance"
+//         allow sessions
+//         bypass role admin
+//       }
+//
+//       introspection {
+//         client <id> <secret>
+//       }
+//
+//       token_exchange {
+//         client <id> <secret> audience <name> [<name>] [scope <name> [<name>]] [lifetime <seconds>]
+//       }
+//
+//       session_transfer {
+//         admin role <role1> ... <roleN>
+//         import <yes|no>
+//         max_import_size <bytes>
+//       }
+//
+//       session_stats {
+//         admin role <role1> ... <roleN>
+//       }
+//
+//       session_handle {
+//         header <name>
+//       }
+//
+//       event_stream {
+//         admin role <role1> ... <roleN>
+//         buffer_size <number>
+//       }
+//
+//       tracing {
+//         exporter <log|otlp> [endpoint]
+//         service_name <name>
+//         backend <name1> ... <nameN>
+//         timeout <milliseconds>
+//       }
+//
+//       redirect_loop_threshold <count>
+//
+//       session_idle_timeout <minutes>
+//
+//       session_max_age <minutes>
+//
+//       max_token_age <seconds>
+//
+//       session_cache_ttl <seconds>
+//
+//       slow_auth_threshold <milliseconds>
+//
+//       login_result_cache [<seconds>]
+//
+//       drain_timeout <seconds>
+//
+//       session_ip_change <ignore|reverify|invalidate>
+//
+//       trusted_proxy <address|cidr> [<address|cidr>]
+//
+//       parallel_auth <realm> [<realm>]
+//
+//       strip_header <name> [<name>]
+//
+//       required_claims <realm|*> <claim> [<claim>]
+//       deny_claim <realm|*> <claim> <eq|ne|gt|ge|lt|le|regex> <value> [message <text>]
+//       feature_flag <flag> <claim> <eq|ne|gt|ge|lt|le|regex> <value>
+//       feature_flags_output <claim|header> [<name>]
+//       realm_signing_key <realm> <key_id> <path/to/private.pem>
+//
+//       unauthorized_body `<go template of json body>`
+//
+//       unsupported_flow <register|recover|mfa|password_change> <redirect|message> <value>
+//
+//       profile_fields {
+//         field <name> <text|email|phone|number> [required] [label <text>] [claim <name>] [max_length <n>]
+//       }
+//
+//       username_policy {
+//         min_length <n>
+//         max_length <n>
+//         pattern <regex>
+//         enforce_at_login
+//       }
+//
+//       redirect_passthrough {
+//         claims <sub|email|name|roles|origin|realm|token> [...]
+//         mode <query|fragment>
+//         secret <secret>
+//         allow_host <host> [<host>]
+//       }
+//
+//       claim_template <claim> "<go template>"
+//
+//       primary_role {
+//         claim <name>
+//         precedence <role1> ... <roleN>
+//         default <role>
+//       }
+//
+//       scope_mapping {
+//         role <role> <scope1> ... <scopeN>
+//         realm <realm> <scope1> ... <scopeN>
+//       }
+//
+//       head_requests <mirror|reject>
+//       unauthenticated_requests <method|redirect>
+//       redirect_preservation <state|cookie>
+//       token_precedence <cookie|header|reject>
+//
+//       amr_claim [<name>]
+//
+//       recovery {
+//         dropbox <file_path>
+//         question <id> "<text>"
+//         required answers <count>
+//         max attempts <count>
+//         lockout <minutes>
+//         auto_reset after <minutes>
+//         require email
+//         email_link
+//         link lifetime <seconds>
+//       }
+//
+//       anti_enumeration {
+//         enabled <yes|no>
+//         min_response_time <milliseconds>
+//       }
+//
+//       compression {
+//         enabled <yes|no>
+//         min_size <bytes>
+//       }
+//
+//       dpop {
+//         enabled <yes|no>
+//         max_age <seconds>
+//       }
+//
+//       logging {
+//         format json
+//         environment <name>
+//         region <name>
+//         instance_name <yes|no>
+//         field <name> <value>
+//         redact <claim1> ... <claimN>|none
+//         sample <flow|*> <success_percent> [<failure_percent>]
+//       }
+//
+//       rate_limit {
+//         username <attempts> <seconds>
+//         headers <retry-after|ratelimit> [<retry-after|ratelimit>]|none
+//       }
+//
+//       realm_routing {
+//         rule <regex> <realm>
+//       }
+//
+//       realm_host_restriction {
+//         host <host|*.domain> <realm> [<realm>...]
+//         source <host|referer>
+//         deny unmapped
+//       }
+//
+//       robots {
+//         file <file_path>
+//         noindex <yes|no>
+//         tag "<value>"
+//       }
+//
+//       smtp {
+//         server <host:port>
+//         sender <address>
+//         credentials <username> <password>
+//       }
+//
+//       link_base_url <url>
+//
+//       email_change {
+//         lifetime <seconds>
+//       }
+//
+//       lockout_notification {
+//         subject <text>
+//         template <go template>
+//         support_contact <address|url>
+//       }
+//
+//       welcome_notification {
+//         store <path>
+//         subject <text>
+//         template <go template>
+//         support_contact <address|url>
+//       }
+//
+//       validation_webhook {
+//         url <url>
+//         timeout <milliseconds>
+//         fail <open|closed>
+//       }
+//
+//       password_breach_check {
+//         url <url>
+//         timeout <milliseconds>
+//         fail <open|closed>
+//       }
+//
+//       mfa {
+//         default method <totp>
+//         fallback method <totp>
+//         require role <role1> ... <roleN>
+//         require realm <realm1> ... <realmN>
+//         trust device <days>
+//         trust network <cidr1> ... <cidrN>
+//         trust proxy <cidr1> ... <cidrN>
+//         adaptive
+//         max_attempts <method> <number>
+//         realm <name> methods <method1> ... <methodN>
+//         realm <name> default method <method>
+//         realm <name> fallback method <method>
 //       }
 //
 //     }
@@ -111,6 +383,66 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 			case "cookie_path":
 				args := h.RemainingArgs()
 				portal.Cookies.Path = args[0]
+			case "cookie_expiry":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive is malformed: %v", rootDirective, args)
+				}
+				portal.Cookies.Expiry = args[0]
+			case "cookie_per_realm":
+				if args := h.RemainingArgs(); len(args) != 0 {
+					return nil, h.Errf("%s directive does not accept arguments: %v", rootDirective, args)
+				}
+				portal.Cookies.PerRealm = true
+			case "cookie_redirect_secret":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive is malformed: %v", rootDirective, args)
+				}
+				portal.Cookies.RedirectSecret = args[0]
+			case "cookie_lifetime":
+				args := h.RemainingArgs()
+				if len(args) < 3 {
+					return nil, h.Errf("%s directive is malformed: %v", rootDirective, args)
+				}
+				lifetime, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				rule := &cookies.LifetimeRule{Lifetime: lifetime}
+				switch {
+				case args[1] == "role" && len(args) == 3:
+					rule.Role = args[2]
+				case args[1] == "claim" && len(args) == 4:
+					rule.Claim = args[2]
+					rule.Value = args[3]
+				default:
+					return nil, h.Errf("%s directive is malformed: %v", rootDirective, args)
+				}
+				portal.Cookies.LifetimeRules = append(portal.Cookies.LifetimeRules, rule)
+			case "max_token_size":
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				size, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if size < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.Cookies.MaxTokenSize = size
+				switch {
+				case len(args) == 1:
+				case args[1] == "fail" && len(args) == 2:
+					portal.Cookies.TokenSizeAction = "fail"
+				case args[1] == "trim" && len(args) > 2:
+					portal.Cookies.TokenSizeAction = "trim"
+					portal.Cookies.TrimClaims = args[2:]
+				default:
+					return nil, h.Errf("%s directive is malformed: %v", rootDirective, args)
+				}
 			case "path":
 				args := h.RemainingArgs()
 				portal.AuthURLPath = args[0]
@@ -286,6 +618,36 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 								groupMaps = append(groupMaps, groupMap)
 							}
 							backendProps[backendArg] = groupMaps
+						case "min_password_age", "max_password_age", "password_expiry_warning", "state_lifetime":
+							if !h.NextArg() {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							passwordAge, err := strconv.Atoi(h.Val())
+							if err != nil {
+								return nil, h.Errf("auth backend %s subdirective %s value conversion failed: %s", backendName, backendArg, err)
+							}
+							backendProps[backendArg] = passwordAge
+						case "cache_ttl", "keys_ttl", "keys_grace_period":
+							if !h.NextArg() {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							cacheTTL, err := strconv.Atoi(h.Val())
+							if err != nil {
+								return nil, h.Errf("auth backend %s subdirective %s value conversion failed: %s", backendName, backendArg, err)
+							}
+							backendProps[backendArg] = cacheTTL
+						case "retry_attempts", "retry_backoff":
+							if !h.NextArg() {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							retryValue, err := strconv.Atoi(h.Val())
+							if err != nil {
+								return nil, h.Errf("auth backend %s subdirective %s value conversion failed: %s", backendName, backendArg, err)
+							}
+							if retryValue < 0 {
+								return nil, h.Errf("auth backend %s subdirective %s value must not be negative", backendName, backendArg)
+							}
+							backendProps[backendArg] = retryValue
 						case "provider":
 							if !h.NextArg() {
 								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
@@ -294,7 +656,7 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 						case "idp_metadata_location", "idp_sign_cert_location", "tenant_id",
 							"application_id", "application_name", "entity_id", "domain_name",
 							"client_id", "client_secret", "server_id", "base_auth_url", "metadata_url",
-							"identity_token_name":
+							"identity_token_name", "logout_url", "post_logout_redirect_url", "audience_validation":
 							if !h.NextArg() {
 								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
 							}
@@ -309,8 +671,108 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 							}
 							acsURLs = append(acsURLs, h.Val())
 							backendProps["acs_urls"] = acsURLs
+						case "authn_context":
+							if !h.NextArg() {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							var classRefs []string
+							if v, exists := backendProps["authn_context_class_refs"]; exists {
+								classRefs = v.([]string)
+							}
+							classRefs = append(classRefs, h.Val())
+							backendProps["authn_context_class_refs"] = classRefs
 						case "scopes":
 							backendProps["scopes"] = h.RemainingArgs()
+						case "require_verified_email":
+							backendProps["require_verified_email"] = true
+							switch args := h.RemainingArgs(); {
+							case len(args) == 0:
+							case len(args) == 1 && args[0] == "allow_missing":
+								backendProps["allow_missing_email_verified"] = true
+							default:
+								return nil, h.Errf("auth backend %s subdirective %s is malformed, expected [allow_missing]", backendName, backendArg)
+							}
+						case "enable":
+							if !h.NextArg() {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							switch h.Val() {
+							case "logout":
+								backendProps["enable_logout"] = true
+							default:
+								return nil, h.Errf("auth backend %s subdirective %s has unsupported value: %s", backendName, backendArg, h.Val())
+							}
+						case "alias":
+							aliases := h.RemainingArgs()
+							if len(aliases) == 0 {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							var realmAliases []string
+							if v, exists := backendProps["aliases"]; exists {
+								realmAliases = v.([]string)
+							}
+							backendProps["aliases"] = append(realmAliases, aliases...)
+						case "trusted_proxy":
+							proxies := h.RemainingArgs()
+							if len(proxies) == 0 {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							var trustedProxies []string
+							if v, exists := backendProps["trusted_proxies"]; exists {
+								trustedProxies = v.([]string)
+							}
+							backendProps["trusted_proxies"] = append(trustedProxies, proxies...)
+						case "header":
+							headerArgs := h.RemainingArgs()
+							if len(headerArgs) != 2 {
+								return nil, h.Errf("auth backend %s subdirective %s is malformed, expected <header> <claim>", backendName, backendArg)
+							}
+							headers := make(map[string]string)
+							if v, exists := backendProps["headers"]; exists {
+								headers = v.(map[string]string)
+							}
+							headers[headerArgs[0]] = headerArgs[1]
+							backendProps["headers"] = headers
+						case "allow_certificate", "deny_certificate":
+							ruleArgs := h.RemainingArgs()
+							rule := make(map[string]interface{})
+							switch len(ruleArgs) {
+							case 2:
+								rule["field"] = ruleArgs[0]
+								rule["value"] = ruleArgs[1]
+							case 3:
+								rule["field"] = ruleArgs[0]
+								rule["match"] = ruleArgs[1]
+								rule["value"] = ruleArgs[2]
+							default:
+								return nil, h.Errf("auth backend %s subdirective %s is malformed, expected <cn|issuer> [exact|regex] <value>", backendName, backendArg)
+							}
+							ruleKey := strings.Replace(backendArg, "certificate", "certificates", 1)
+							var rules []map[string]interface{}
+							if v, exists := backendProps[ruleKey]; exists {
+								rules = v.([]map[string]interface{})
+							}
+							backendProps[ruleKey] = append(rules, rule)
+						case "flatten_claims":
+							claimNames := h.RemainingArgs()
+							if len(claimNames) == 0 {
+								return nil, h.Errf("auth backend %s subdirective %s has no value", backendName, backendArg)
+							}
+							backendProps["flatten_claims"] = claimNames
+						case "claim_source":
+							sourceArgs := h.RemainingArgs()
+							if len(sourceArgs) < 2 {
+								return nil, h.Errf("auth backend %s subdirective %s is malformed, expected <claim> <source> [<source> ...]", backendName, backendArg)
+							}
+							claimSources := make(map[string][]string)
+							if v, exists := backendProps["claim_sources"]; exists {
+								claimSources = v.(map[string][]string)
+							}
+							if _, exists := claimSources[sourceArgs[0]]; exists {
+								return nil, h.Errf("auth backend %s subdirective %s has duplicate claim: %s", backendName, backendArg, sourceArgs[0])
+							}
+							claimSources[sourceArgs[0]] = sourceArgs[1:]
+							backendProps["claim_sources"] = claimSources
 						default:
 							return nil, h.Errf("unknown auth backend %s subdirective: %s", backendName, backendArg)
 						}
@@ -513,6 +975,18 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 								}
 								portal.UserInterface.PrivateLinks = append(portal.UserInterface.PrivateLinks, privateLink)
 							}
+						case "static_asset_max_age":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							maxAge, err := strconv.Atoi(h.Val())
+							if err != nil {
+								return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+							}
+							if maxAge < 1 {
+								return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+							}
+							portal.UserInterface.StaticAssetMaxAge = maxAge
 						case "custom_css", "custom_css_path":
 							if !h.NextArg() {
 								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
@@ -523,6 +997,100 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
 							}
 							portal.UserInterface.CustomJsPath = h.Val()
+						case "custom_page_header_path":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							portal.UserInterface.CustomPageHeaderPath = h.Val()
+						case "custom_page_footer_path":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							portal.UserInterface.CustomPageFooterPath = h.Val()
+						case "login_hint_parameter":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							portal.UserInterface.LoginHintParameter = h.Val()
+						case "rollout":
+							args := h.RemainingArgs()
+							if len(args) < 1 || len(args) > 2 {
+								return nil, h.Errf("%s %s subdirective is malformed, expected rollout <percent> [session|ip]", rootDirective, subDirective)
+							}
+							percent, err := strconv.Atoi(args[0])
+							if err != nil {
+								return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+							}
+							if portal.UserInterface.Rollout == nil {
+								portal.UserInterface.Rollout = &ui.TemplateRollout{}
+							}
+							portal.UserInterface.Rollout.Percent = percent
+							if len(args) == 2 {
+								portal.UserInterface.Rollout.Key = args[1]
+							}
+						case "variant":
+							args := h.RemainingArgs()
+							if len(args) != 2 {
+								return nil, h.Errf("%s %s subdirective must have a template name and a path", rootDirective, subDirective)
+							}
+							if portal.UserInterface.Rollout == nil {
+								portal.UserInterface.Rollout = &ui.TemplateRollout{}
+							}
+							if portal.UserInterface.Rollout.Templates == nil {
+								portal.UserInterface.Rollout.Templates = make(map[string]string)
+							}
+							portal.UserInterface.Rollout.Templates[args[0]] = args[1]
+						case "fallback_message":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							portal.UserInterface.FallbackMessage = h.Val()
+						case "login_success":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							switch h.Val() {
+							case "redirect", "page":
+								portal.UserInterface.LoginSuccess = h.Val()
+							default:
+								return nil, h.Errf("unsupported value %s in %s %s subdirective", h.Val(), rootDirective, subDirective)
+							}
+						case "login_instructions":
+							args := h.RemainingArgs()
+							if len(args) != 2 && len(args) != 4 {
+								return nil, h.Errf("%s %s subdirective is malformed, expected <realm> <text> [help_url <url>]", rootDirective, subDirective)
+							}
+							instructions := &ui.LoginInstructions{
+								Realm: args[0],
+								Text:  args[1],
+							}
+							if len(args) == 4 {
+								if args[2] != "help_url" {
+									return nil, h.Errf("unsupported value %s in %s %s subdirective", args[2], rootDirective, subDirective)
+								}
+								instructions.HelpURL = args[3]
+							}
+							portal.UserInterface.LoginInstructions = append(portal.UserInterface.LoginInstructions, instructions)
+						case "single_provider_redirect":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							switch h.Val() {
+							case "yes", "no":
+								portal.UserInterface.SingleProviderRedirect = h.Val()
+							default:
+								return nil, h.Errf("unsupported value %s in %s %s subdirective", h.Val(), rootDirective, subDirective)
+							}
+						case "session_expiry_meta":
+							if !h.NextArg() {
+								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+							}
+							switch h.Val() {
+							case "yes", "no":
+								portal.UserInterface.SessionExpiryMeta = h.Val()
+							default:
+								return nil, h.Errf("unsupported value %s in %s %s subdirective", h.Val(), rootDirective, subDirective)
+							}
 						case "custom_html_header_path":
 							if !h.NextArg() {
 								return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
@@ -570,6 +1138,74 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
 						}
 						portal.UserRegistration.Dropbox = h.Val()
+					case "realm":
+						args := h.RemainingArgs()
+						if len(args) < 2 || len(args) > 3 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected realm <name> <dropbox> [<title>]", rootDirective, subDirective)
+						}
+						realmRegistration := &registration.RealmRegistration{
+							Realm:   args[0],
+							Dropbox: args[1],
+						}
+						if len(args) == 3 {
+							realmRegistration.Title = args[2]
+						}
+						portal.UserRegistration.Realms = append(portal.UserRegistration.Realms, realmRegistration)
+					case "invitation_lifetime":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						lifetime, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if lifetime < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.UserRegistration.InvitationLifetime = lifetime
+					case "invitation_admin_role":
+						args := h.RemainingArgs()
+						if len(args) == 0 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.UserRegistration.InvitationAdminRoles = append(portal.UserRegistration.InvitationAdminRoles, args...)
+					case "wizard_step":
+						args := h.RemainingArgs()
+						if len(args) == 0 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						step := &registration.WizardStep{Type: args[0]}
+						for i := 1; i < len(args); i++ {
+							switch {
+							case args[i] == "title" && i+1 < len(args):
+								step.Title = args[i+1]
+								i++
+							case args[i] == "fields" && i+1 < len(args):
+								step.Fields = append(step.Fields, args[i+1:]...)
+								i = len(args)
+							default:
+								return nil, h.Errf("%s %s subdirective is malformed, expected wizard_step <type> [title <title>] [fields <name1> ... <nameN>]", rootDirective, subDirective)
+							}
+						}
+						if portal.UserRegistration.Wizard == nil {
+							portal.UserRegistration.Wizard = &registration.Wizard{}
+						}
+						portal.UserRegistration.Wizard.Steps = append(portal.UserRegistration.Wizard.Steps, step)
+					case "wizard_lifetime":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						lifetime, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if lifetime < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						if portal.UserRegistration.Wizard == nil {
+							portal.UserRegistration.Wizard = &registration.Wizard{}
+						}
+						portal.UserRegistration.Wizard.Lifetime = lifetime
 					case "require":
 						if !h.NextArg() {
 							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
@@ -580,6 +1216,8 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 							portal.UserRegistration.RequireAcceptTerms = true
 						case "domain_mx":
 							portal.UserRegistration.RequireDomainMailRecord = true
+						case "invitation":
+							portal.UserRegistration.RequireInvitation = true
 						default:
 							return nil, h.Errf("unsupported requirement %s in %s %s", requirement, rootDirective, subDirective)
 						}
@@ -587,11 +1225,1366 @@ func parseCaddyfileAuthPortal(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
 					}
 				}
+			case "maintenance":
+				if portal.Maintenance == nil {
+					portal.Maintenance = &maintenance.Maintenance{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "enabled":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if h.Val() == "yes" || h.Val() == "on" || h.Val() == "true" {
+							portal.Maintenance.Enabled = true
+						}
+					case "message":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.Maintenance.Message = h.Val()
+					case "allow":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						switch h.Val() {
+						case "sessions":
+							portal.Maintenance.AllowSessions = true
+						default:
+							return nil, h.Errf("unsupported value %s in %s %s", h.Val(), rootDirective, subDirective)
+						}
+					case "bypass":
+						bypassArgs := h.RemainingArgs()
+						if len(bypassArgs) < 2 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected role <name>", rootDirective, subDirective)
+						}
+						switch bypassArgs[0] {
+						case "role", "roles":
+						default:
+							return nil, h.Errf(
+								"%s %s subdirective is malformed: role/roles (expected) vs %s (received)",
+								rootDirective, subDirective, bypassArgs[0],
+							)
+						}
+						portal.Maintenance.BypassRoles = append(portal.Maintenance.BypassRoles, bypassArgs[1:]...)
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "recovery":
+				if portal.Recovery == nil {
+					portal.Recovery = &recovery.Recovery{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					switch subDirective {
+					case "dropbox":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.Recovery.Dropbox = subArgs[0]
+					case "question":
+						if len(subArgs) != 2 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected <id> <text>", rootDirective, subDirective)
+						}
+						portal.Recovery.Questions = append(portal.Recovery.Questions, &recovery.Question{
+							ID:   subArgs[0],
+							Text: subArgs[1],
+						})
+					case "email_link":
+						portal.Recovery.EmailLink = true
+					case "required", "max", "auto_reset", "lockout", "link":
+						if subDirective != "lockout" {
+							if len(subArgs) != 2 {
+								return nil, h.Errf("%s %s subdirective is malformed", rootDirective, subDirective)
+							}
+							subDirective = subDirective + " " + subArgs[0]
+							subArgs = subArgs[1:]
+						}
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						i, err := strconv.Atoi(subArgs[0])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if i < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						switch subDirective {
+						case "required answers":
+							portal.Recovery.RequiredAnswers = i
+						case "max attempts":
+							portal.Recovery.MaxAttempts = i
+						case "lockout":
+							portal.Recovery.LockoutTime = i
+						case "auto_reset after":
+							portal.Recovery.AutoResetAfter = i
+						case "link lifetime":
+							portal.Recovery.LinkLifetime = i
+						default:
+							return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+						}
+					case "require":
+						if len(subArgs) != 1 || subArgs[0] != "email" {
+							return nil, h.Errf("unsupported subdirective for %s: %s %v", rootDirective, subDirective, subArgs)
+						}
+						portal.Recovery.RequireEmail = true
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "anti_enumeration":
+				if portal.AntiEnumeration == nil {
+					portal.AntiEnumeration = &enumeration.AntiEnumeration{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "enabled":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if h.Val() == "yes" || h.Val() == "on" || h.Val() == "true" {
+							portal.AntiEnumeration.Enabled = true
+						}
+					case "min_response_time":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						i, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if i < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.AntiEnumeration.MinResponseTime = i
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "compression":
+				if portal.Compression == nil {
+					portal.Compression = &compression.Compression{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "enabled":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if h.Val() == "yes" || h.Val() == "on" || h.Val() == "true" {
+							portal.Compression.Enabled = true
+						}
+					case "min_size":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						i, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if i < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.Compression.MinSize = i
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "dpop":
+				if portal.DPoP == nil {
+					portal.DPoP = &dpop.Config{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "enabled":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if h.Val() == "yes" || h.Val() == "on" || h.Val() == "true" {
+							portal.DPoP.Enabled = true
+						}
+					case "max_age":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						i, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if i < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.DPoP.MaxAge = i
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "logging":
+				if portal.Logging == nil {
+					portal.Logging = &logging.Config{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "format", "environment", "region":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						switch subDirective {
+						case "format":
+							portal.Logging.Format = h.Val()
+						case "environment":
+							portal.Logging.Environment = h.Val()
+						case "region":
+							portal.Logging.Region = h.Val()
+						}
+					case "instance_name":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if h.Val() == "yes" || h.Val() == "on" || h.Val() == "true" {
+							portal.Logging.InstanceName = true
+						}
+					case "field":
+						args := h.RemainingArgs()
+						if len(args) != 2 {
+							return nil, h.Errf("%s %s subdirective must have a name and a value", rootDirective, subDirective)
+						}
+						if portal.Logging.Fields == nil {
+							portal.Logging.Fields = make(map[string]string)
+						}
+						portal.Logging.Fields[args[0]] = args[1]
+					case "redact":
+						args := h.RemainingArgs()
+						if len(args) == 0 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.Logging.Redact = append(portal.Logging.Redact, args...)
+					case "sample":
+						args := h.RemainingArgs()
+						if len(args) < 2 || len(args) > 3 {
+							return nil, h.Errf("%s %s subdirective must have a flow and one or two rates", rootDirective, subDirective)
+						}
+						rule := &logging.SamplingRule{Flow: args[0], Failure: 100}
+						rate, err := strconv.ParseFloat(args[1], 64)
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						rule.Success = rate
+						if len(args) == 3 {
+							rate, err := strconv.ParseFloat(args[2], 64)
+							if err != nil {
+								return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+							}
+							rule.Failure = rate
+						}
+						portal.Logging.Sampling = append(portal.Logging.Sampling, rule)
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "rate_limit":
+				if portal.RateLimit == nil {
+					portal.RateLimit = &ratelimit.RateLimit{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "username":
+						args := h.RemainingArgs()
+						if len(args) != 2 {
+							return nil, h.Errf("%s %s subdirective must have attempts and interval", rootDirective, subDirective)
+						}
+						attempts, err := strconv.Atoi(args[0])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						interval, err := strconv.Atoi(args[1])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						portal.RateLimit.Username = &ratelimit.Limit{
+							Attempts: attempts,
+							Interval: interval,
+						}
+					case "headers":
+						args := h.RemainingArgs()
+						if len(args) == 0 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.RateLimit.Headers = args
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "realm_routing":
+				if portal.RealmRouting == nil {
+					portal.RealmRouting = &routing.Router{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "rule":
+						args := h.RemainingArgs()
+						if len(args) != 2 {
+							return nil, h.Errf("%s %s subdirective must have a pattern and a realm", rootDirective, subDirective)
+						}
+						portal.RealmRouting.Rules = append(portal.RealmRouting.Rules, &routing.Rule{
+							Pattern: args[0],
+							Realm:   args[1],
+						})
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "realm_host_restriction":
+				if portal.RealmHostRestriction == nil {
+					portal.RealmHostRestriction = &routing.HostRestriction{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "host":
+						args := h.RemainingArgs()
+						if len(args) < 2 {
+							return nil, h.Errf("%s %s subdirective must have a host and at least one realm", rootDirective, subDirective)
+						}
+						portal.RealmHostRestriction.Rules = append(portal.RealmHostRestriction.Rules, &routing.HostRule{
+							Host:   args[0],
+							Realms: args[1:],
+						})
+					case "source":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.RealmHostRestriction.Source = h.Val()
+					case "deny":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if h.Val() != "unmapped" {
+							return nil, h.Errf("%s %s subdirective has unsupported value: %s", rootDirective, subDirective, h.Val())
+						}
+						portal.RealmHostRestriction.DenyUnmapped = true
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "robots":
+				if portal.Robots == nil {
+					portal.Robots = &robots.Robots{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "file":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.Robots.ContentPath = h.Val()
+					case "noindex":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if h.Val() == "no" || h.Val() == "off" || h.Val() == "false" {
+							portal.Robots.DisableTag = true
+						}
+					case "tag":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.Robots.Tag = h.Val()
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "link_base_url":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive must have a single url", rootDirective)
+				}
+				portal.LinkBaseURL = args[0]
+			case "smtp":
+				if portal.SMTP == nil {
+					portal.SMTP = &email.Config{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "server":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.SMTP.Server = h.Val()
+					case "sender":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.SMTP.Sender = h.Val()
+					case "credentials":
+						args := h.RemainingArgs()
+						if len(args) != 2 {
+							return nil, h.Errf("%s %s subdirective must have username and password", rootDirective, subDirective)
+						}
+						portal.SMTP.Username = args[0]
+						portal.SMTP.Password = args[1]
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "email_change":
+				if portal.EmailChange == nil {
+					portal.EmailChange = &email.Change{}
+				}
+				portal.EmailChange.Enabled = true
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "lifetime":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						lifetime, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if lifetime < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.EmailChange.Lifetime = lifetime
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "lockout_notification":
+				if portal.LockoutNotice == nil {
+					portal.LockoutNotice = &email.LockoutNotice{}
+				}
+				portal.LockoutNotice.Enabled = true
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					if !h.NextArg() {
+						return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+					}
+					switch subDirective {
+					case "subject":
+						portal.LockoutNotice.Subject = h.Val()
+					case "template":
+						portal.LockoutNotice.Template = h.Val()
+					case "support_contact":
+						portal.LockoutNotice.SupportContact = h.Val()
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "welcome_notification":
+				if portal.WelcomeNotice == nil {
+					portal.WelcomeNotice = &email.WelcomeNotice{}
+				}
+				portal.WelcomeNotice.Enabled = true
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					if !h.NextArg() {
+						return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+					}
+					switch subDirective {
+					case "store":
+						portal.WelcomeNotice.Store = h.Val()
+					case "subject":
+						portal.WelcomeNotice.Subject = h.Val()
+					case "template":
+						portal.WelcomeNotice.Template = h.Val()
+					case "support_contact":
+						portal.WelcomeNotice.SupportContact = h.Val()
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "password_breach_check":
+				if portal.PasswordBreachCheck == nil {
+					portal.PasswordBreachCheck = &validators.BreachCheck{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "url":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.PasswordBreachCheck.URL = h.Val()
+					case "timeout":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						i, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if i < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.PasswordBreachCheck.Timeout = i
+					case "fail":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						switch h.Val() {
+						case "open":
+							portal.PasswordBreachCheck.FailOpen = true
+						case "closed":
+							portal.PasswordBreachCheck.FailOpen = false
+						default:
+							return nil, h.Errf("%s %s subdirective has unsupported value: %s", rootDirective, subDirective, h.Val())
+						}
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "validation_webhook":
+				if portal.ValidationWebhook == nil {
+					portal.ValidationWebhook = &webhook.Webhook{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "url":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.ValidationWebhook.URL = h.Val()
+					case "timeout":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						i, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if i < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.ValidationWebhook.Timeout = i
+					case "fail":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						switch h.Val() {
+						case "open":
+							portal.ValidationWebhook.FailOpen = true
+						case "closed":
+							portal.ValidationWebhook.FailOpen = false
+						default:
+							return nil, h.Errf("%s %s subdirective has unsupported value: %s", rootDirective, subDirective, h.Val())
+						}
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "mfa":
+				if portal.MFA == nil {
+					portal.MFA = &mfa.Config{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					switch subDirective {
+					case "default", "fallback":
+						if len(subArgs) != 2 || subArgs[0] != "method" {
+							return nil, h.Errf("%s %s subdirective is malformed, expected %s method <name>", rootDirective, subDirective, subDirective)
+						}
+						if subDirective == "default" {
+							portal.MFA.DefaultMethod = subArgs[1]
+						} else {
+							portal.MFA.FallbackMethod = subArgs[1]
+						}
+					case "require":
+						if len(subArgs) < 2 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected require <role|realm> <name>", rootDirective, subDirective)
+						}
+						if portal.MFA.Requirement == nil {
+							portal.MFA.Requirement = &mfa.Requirement{}
+						}
+						switch subArgs[0] {
+						case "role":
+							portal.MFA.Requirement.Roles = append(portal.MFA.Requirement.Roles, subArgs[1:]...)
+						case "realm":
+							portal.MFA.Requirement.Realms = append(portal.MFA.Requirement.Realms, subArgs[1:]...)
+						default:
+							return nil, h.Errf("unsupported subdirective for %s: %s %s", rootDirective, subDirective, subArgs[0])
+						}
+					case "trust":
+						if len(subArgs) > 1 && (subArgs[0] == "network" || subArgs[0] == "proxy") {
+							if subArgs[0] == "network" {
+								portal.MFA.TrustedNetworks = append(portal.MFA.TrustedNetworks, subArgs[1:]...)
+							} else {
+								portal.MFA.TrustedProxies = append(portal.MFA.TrustedProxies, subArgs[1:]...)
+							}
+							break
+						}
+						if len(subArgs) != 2 || subArgs[0] != "device" {
+							return nil, h.Errf("%s %s subdirective is malformed, expected trust <device|network|proxy> <value>", rootDirective, subDirective)
+						}
+						days, err := strconv.Atoi(subArgs[1])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if days < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.MFA.TrustedDeviceLifetime = days
+					case "max_attempts":
+						if len(subArgs) != 2 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected max_attempts <method> <number>", rootDirective, subDirective)
+						}
+						limit, err := strconv.Atoi(subArgs[1])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if limit < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						if portal.MFA.MaxAttempts == nil {
+							portal.MFA.MaxAttempts = make(map[string]int)
+						}
+						portal.MFA.MaxAttempts[subArgs[0]] = limit
+					case "adaptive":
+						if len(subArgs) != 0 {
+							return nil, h.Errf("%s %s subdirective has unsupported arguments: %v", rootDirective, subDirective, subArgs)
+						}
+						portal.MFA.Adaptive = true
+					case "realm":
+						if len(subArgs) < 3 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected realm <name> <methods|default|fallback> ...", rootDirective, subDirective)
+						}
+						if portal.MFA.Realms == nil {
+							portal.MFA.Realms = make(map[string]*mfa.RealmConfig)
+						}
+						realmCfg, exists := portal.MFA.Realms[subArgs[0]]
+						if !exists {
+							realmCfg = &mfa.RealmConfig{}
+							portal.MFA.Realms[subArgs[0]] = realmCfg
+						}
+						switch subArgs[1] {
+						case "methods":
+							realmCfg.Methods = append(realmCfg.Methods, subArgs[2:]...)
+						case "default", "fallback":
+							if len(subArgs) != 4 || subArgs[2] != "method" {
+								return nil, h.Errf("%s %s subdirective is malformed, expected realm <name> %s method <name>", rootDirective, subDirective, subArgs[1])
+							}
+							if subArgs[1] == "default" {
+								realmCfg.DefaultMethod = subArgs[3]
+							} else {
+								realmCfg.FallbackMethod = subArgs[3]
+							}
+						default:
+							return nil, h.Errf("unsupported subdirective for %s: %s %s", rootDirective, subDirective, subArgs[1])
+						}
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "head_requests":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				switch args[0] {
+				case "mirror", "reject":
+					portal.HeadRequests = args[0]
+				default:
+					return nil, h.Errf("unsupported value %s in %s directive", args[0], rootDirective)
+				}
+			case "redirect_preservation":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				switch args[0] {
+				case "state", "cookie":
+					portal.RedirectPreservation = args[0]
+				default:
+					return nil, h.Errf("unsupported value %s in %s directive", args[0], rootDirective)
+				}
+			case "unauthenticated_requests":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				switch args[0] {
+				case "method", "redirect":
+					portal.UnauthenticatedRequests = args[0]
+				default:
+					return nil, h.Errf("unsupported value %s in %s directive", args[0], rootDirective)
+				}
+			case "token_precedence":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				switch args[0] {
+				case "cookie", "header", "reject":
+					portal.TokenPrecedence = args[0]
+				default:
+					return nil, h.Errf("unsupported value %s in %s directive", args[0], rootDirective)
+				}
+			case "amr_claim":
+				args := h.RemainingArgs()
+				switch len(args) {
+				case 0:
+					portal.AmrClaim = "amr"
+				case 1:
+					portal.AmrClaim = args[0]
+				default:
+					return nil, h.Errf("%s directive is malformed, expected amr_claim [<name>]", rootDirective)
+				}
+			case "claim_template":
+				args := h.RemainingArgs()
+				if len(args) != 2 {
+					return nil, h.Errf("%s directive is malformed, expected <claim> <template>", rootDirective)
+				}
+				if portal.ClaimsTransformer == nil {
+					portal.ClaimsTransformer = &transformer.Transformer{}
+				}
+				portal.ClaimsTransformer.Templates = append(portal.ClaimsTransformer.Templates, &transformer.ClaimTemplate{
+					Claim:    args[0],
+					Template: args[1],
+				})
+				if err := portal.ClaimsTransformer.Validate(); err != nil {
+					return nil, h.Errf("%s directive error: %s", rootDirective, err)
+				}
+			case "primary_role":
+				if portal.ClaimsTransformer == nil {
+					portal.ClaimsTransformer = &transformer.Transformer{}
+				}
+				if portal.ClaimsTransformer.PrimaryRole == nil {
+					portal.ClaimsTransformer.PrimaryRole = &transformer.PrimaryRole{}
+				}
+				primaryRole := portal.ClaimsTransformer.PrimaryRole
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "claim", "default":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						if subDirective == "claim" {
+							primaryRole.Claim = h.Val()
+						} else {
+							primaryRole.Default = h.Val()
+						}
+					case "precedence":
+						args := h.RemainingArgs()
+						if len(args) == 0 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						primaryRole.Precedence = append(primaryRole.Precedence, args...)
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+				if err := portal.ClaimsTransformer.Validate(); err != nil {
+					return nil, h.Errf("%s directive error: %s", rootDirective, err)
+				}
+			case "scope_mapping":
+				if portal.ClaimsTransformer == nil {
+					portal.ClaimsTransformer = &transformer.Transformer{}
+				}
+				if portal.ClaimsTransformer.Scopes == nil {
+					portal.ClaimsTransformer.Scopes = &transformer.ScopeMapping{}
+				}
+				scopeMapping := portal.ClaimsTransformer.Scopes
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					args := h.RemainingArgs()
+					if len(args) < 2 {
+						return nil, h.Errf("%s %s subdirective is malformed, expected <name> <scope1> ... <scopeN>", rootDirective, subDirective)
+					}
+					switch subDirective {
+					case "role":
+						if scopeMapping.Roles == nil {
+							scopeMapping.Roles = make(map[string][]string)
+						}
+						scopeMapping.Roles[args[0]] = append(scopeMapping.Roles[args[0]], args[1:]...)
+					case "realm":
+						if scopeMapping.Realms == nil {
+							scopeMapping.Realms = make(map[string][]string)
+						}
+						scopeMapping.Realms[args[0]] = append(scopeMapping.Realms[args[0]], args[1:]...)
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+				if err := portal.ClaimsTransformer.Validate(); err != nil {
+					return nil, h.Errf("%s directive error: %s", rootDirective, err)
+				}
+			case "redirect_loop_threshold":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				threshold, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if threshold < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.RedirectLoopThreshold = threshold
+			case "session_idle_timeout":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				timeout, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if timeout < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.SessionIdleTimeout = timeout
+			case "session_max_age":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				maxAge, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if maxAge < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.SessionMaxAge = maxAge
+			case "max_token_age":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				maxAge, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if maxAge < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.MaxTokenAge = maxAge
+			case "session_cache_ttl":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				ttl, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if ttl < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.SessionCacheTTL = ttl
+			case "slow_auth_threshold":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				threshold, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if threshold < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.SlowAuthThreshold = threshold
+			case "login_result_cache":
+				args := h.RemainingArgs()
+				switch len(args) {
+				case 0:
+					portal.LoginResultWindow = core.DefaultLoginResultWindow
+				case 1:
+					window, err := strconv.Atoi(args[0])
+					if err != nil {
+						return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+					}
+					if window < 1 {
+						return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+					}
+					portal.LoginResultWindow = window
+				default:
+					return nil, h.Errf("%s directive has too many values", rootDirective)
+				}
+			case "drain_timeout":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				timeout, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, h.Errf("%s directive value conversion failed: %s", rootDirective, err)
+				}
+				if timeout < 1 {
+					return nil, h.Errf("%s directive value must be greater than zero", rootDirective)
+				}
+				portal.DrainTimeout = timeout
+			case "session_ip_change":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				switch args[0] {
+				case "ignore", "reverify", "invalidate":
+					portal.SessionIPChange = args[0]
+				default:
+					return nil, h.Errf("unsupported value %s in %s directive", args[0], rootDirective)
+				}
+			case "trusted_proxy":
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				portal.TrustedProxies = append(portal.TrustedProxies, args...)
+			case "strip_header":
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				portal.StripHeaders = append(portal.StripHeaders, args...)
+			case "required_claims":
+				args := h.RemainingArgs()
+				if len(args) < 2 {
+					return nil, h.Errf("%s directive must have a realm and at least one claim", rootDirective)
+				}
+				if portal.RequiredClaims == nil {
+					portal.RequiredClaims = make(map[string][]string)
+				}
+				portal.RequiredClaims[args[0]] = append(portal.RequiredClaims[args[0]], args[1:]...)
+			case "deny_claim":
+				args := h.RemainingArgs()
+				if len(args) < 4 {
+					return nil, h.Errf("%s directive is malformed, expected <realm|*> <claim> <operator> <value>", rootDirective)
+				}
+				rule := &denial.Rule{
+					Realm:    args[0],
+					Claim:    args[1],
+					Operator: args[2],
+					Value:    args[3],
+				}
+				if len(args) > 4 {
+					if args[4] != "message" || len(args) < 6 {
+						return nil, h.Errf("%s directive is malformed, expected message <text>", rootDirective)
+					}
+					rule.Message = strings.Join(args[5:], " ")
+				}
+				portal.DenyClaims = append(portal.DenyClaims, rule)
+			case "feature_flag":
+				args := h.RemainingArgs()
+				if len(args) != 4 {
+					return nil, h.Errf("%s directive is malformed, expected <flag> <claim> <operator> <value>", rootDirective)
+				}
+				if portal.FeatureFlags == nil {
+					portal.FeatureFlags = &flags.Config{}
+				}
+				portal.FeatureFlags.Rules = append(portal.FeatureFlags.Rules, &flags.Rule{
+					Flag:     args[0],
+					Claim:    args[1],
+					Operator: args[2],
+					Value:    args[3],
+				})
+			case "realm_signing_key":
+				args := h.RemainingArgs()
+				if len(args) != 3 {
+					return nil, h.Errf("%s directive is malformed, expected <realm> <key_id> <key_file>", rootDirective)
+				}
+				portal.RealmSigningKeys = append(portal.RealmSigningKeys, &signing.RealmKey{
+					Realm:   args[0],
+					KeyID:   args[1],
+					KeyFile: args[2],
+				})
+			case "feature_flags_output":
+				args := h.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, h.Errf("%s directive is malformed, expected <claim|header> [<name>]", rootDirective)
+				}
+				if portal.FeatureFlags == nil {
+					portal.FeatureFlags = &flags.Config{}
+				}
+				portal.FeatureFlags.Output = args[0]
+				if len(args) == 2 {
+					portal.FeatureFlags.Name = args[1]
+				}
+			case "parallel_auth":
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				portal.ParallelRealms = append(portal.ParallelRealms, args...)
+			case "introspection":
+				if portal.Introspection == nil {
+					portal.Introspection = &introspection.Introspection{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "client":
+						clientArgs := h.RemainingArgs()
+						if len(clientArgs) != 2 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected <id> <secret>", rootDirective, subDirective)
+						}
+						portal.Introspection.Clients = append(portal.Introspection.Clients, &introspection.Client{
+							ID:     clientArgs[0],
+							Secret: clientArgs[1],
+						})
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "token_exchange":
+				if portal.TokenExchange == nil {
+					portal.TokenExchange = &exchange.Exchange{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					if subDirective != "client" {
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+					clientArgs := h.RemainingArgs()
+					if len(clientArgs) < 4 {
+						return nil, h.Errf("%s %s subdirective is malformed, expected <id> <secret> audience <name>", rootDirective, subDirective)
+					}
+					client := &exchange.Client{
+						ID:     clientArgs[0],
+						Secret: clientArgs[1],
+					}
+					var key string
+					for _, arg := range clientArgs[2:] {
+						switch arg {
+						case "audience", "scope", "lifetime":
+							key = arg
+							continue
+						}
+						switch key {
+						case "audience":
+							client.Audiences = append(client.Audiences, arg)
+						case "scope":
+							client.Scopes = append(client.Scopes, arg)
+						case "lifetime":
+							lifetime, err := strconv.Atoi(arg)
+							if err != nil {
+								return nil, h.Errf("%s %s subdirective lifetime value conversion failed: %s", rootDirective, subDirective, err)
+							}
+							if lifetime < 1 {
+								return nil, h.Errf("%s %s subdirective lifetime value must be greater than zero", rootDirective, subDirective)
+							}
+							client.Lifetime = lifetime
+						default:
+							return nil, h.Errf("unsupported value %s in %s %s subdirective", arg, rootDirective, subDirective)
+						}
+					}
+					portal.TokenExchange.Clients = append(portal.TokenExchange.Clients, client)
+				}
+			case "unauthorized_body":
+				args := h.RemainingArgs()
+				if len(args) != 1 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				portal.UnauthorizedBody = &challenge.Body{Template: args[0]}
+			case "unsupported_flow":
+				args := h.RemainingArgs()
+				if len(args) == 0 {
+					return nil, h.Errf("%s directive has no value", rootDirective)
+				}
+				if len(args) != 3 {
+					return nil, h.Errf("%s directive is malformed, expected <flow> <redirect|message> <value>", rootDirective)
+				}
+				if portal.UnsupportedFlows == nil {
+					portal.UnsupportedFlows = &unsupported.Responses{}
+				}
+				var entry *unsupported.Response
+				for _, e := range portal.UnsupportedFlows.Entries {
+					if e.Flow == args[0] {
+						entry = e
+						break
+					}
+				}
+				if entry == nil {
+					entry = &unsupported.Response{Flow: args[0]}
+					portal.UnsupportedFlows.Entries = append(portal.UnsupportedFlows.Entries, entry)
+				}
+				switch args[1] {
+				case "redirect":
+					entry.RedirectURL = args[2]
+				case "message":
+					entry.Message = args[2]
+				default:
+					return nil, h.Errf("unsupported value %s in %s directive", args[1], rootDirective)
+				}
+			case "profile_fields":
+				if portal.ProfileSchema == nil {
+					portal.ProfileSchema = &profile.Schema{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					if subDirective != "field" {
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+					if len(subArgs) < 2 {
+						return nil, h.Errf("%s %s subdirective is malformed, expected field <name> <type>", rootDirective, subDirective)
+					}
+					field := &profile.Field{
+						Name: subArgs[0],
+						Type: subArgs[1],
+					}
+					for i := 2; i < len(subArgs); i++ {
+						switch subArgs[i] {
+						case "required":
+							field.Required = true
+						case "label", "claim", "max_length":
+							if i+1 >= len(subArgs) {
+								return nil, h.Errf("%s %s subdirective %s has no value", rootDirective, subDirective, subArgs[i])
+							}
+							switch subArgs[i] {
+							case "label":
+								field.Label = subArgs[i+1]
+							case "claim":
+								field.Claim = subArgs[i+1]
+							case "max_length":
+								n, err := strconv.Atoi(subArgs[i+1])
+								if err != nil {
+									return nil, h.Errf("%s %s subdirective max_length value conversion failed: %s", rootDirective, subDirective, err)
+								}
+								field.MaxLength = n
+							}
+							i++
+						default:
+							return nil, h.Errf("unsupported value %s in %s %s subdirective", subArgs[i], rootDirective, subDirective)
+						}
+					}
+					portal.ProfileSchema.Fields = append(portal.ProfileSchema.Fields, field)
+				}
+			case "username_policy":
+				if portal.UsernamePolicy == nil {
+					portal.UsernamePolicy = &validators.UsernamePolicy{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					switch subDirective {
+					case "min_length", "max_length":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						n, err := strconv.Atoi(subArgs[0])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if n < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						if subDirective == "min_length" {
+							portal.UsernamePolicy.MinLength = n
+						} else {
+							portal.UsernamePolicy.MaxLength = n
+						}
+					case "pattern":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.UsernamePolicy.Pattern = subArgs[0]
+					case "enforce_at_login":
+						portal.UsernamePolicy.EnforceAtLogin = true
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "redirect_passthrough":
+				if portal.RedirectPassthrough == nil {
+					portal.RedirectPassthrough = &passthrough.Config{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					if len(subArgs) == 0 {
+						return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+					}
+					switch subDirective {
+					case "claims":
+						portal.RedirectPassthrough.Claims = append(portal.RedirectPassthrough.Claims, subArgs...)
+					case "mode":
+						portal.RedirectPassthrough.Mode = subArgs[0]
+					case "secret":
+						portal.RedirectPassthrough.Secret = subArgs[0]
+					case "allow_host":
+						portal.RedirectPassthrough.AllowedHosts = append(portal.RedirectPassthrough.AllowedHosts, subArgs...)
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "event_stream":
+				if portal.EventStream == nil {
+					portal.EventStream = &events.Stream{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					switch subDirective {
+					case "admin":
+						if len(subArgs) < 2 || subArgs[0] != "role" {
+							return nil, h.Errf("%s %s subdirective is malformed, expected admin role <name>", rootDirective, subDirective)
+						}
+						portal.EventStream.AdminRoles = append(portal.EventStream.AdminRoles, subArgs[1:]...)
+					case "buffer_size":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						size, err := strconv.Atoi(subArgs[0])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if size < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.EventStream.BufferSize = size
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "tracing":
+				if portal.Tracing == nil {
+					portal.Tracing = &tracing.Tracing{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					switch subDirective {
+					case "exporter":
+						if len(subArgs) < 1 || len(subArgs) > 2 {
+							return nil, h.Errf("%s %s subdirective is malformed, expected exporter <log|otlp> [endpoint]", rootDirective, subDirective)
+						}
+						switch subArgs[0] {
+						case "log", "otlp":
+							portal.Tracing.Exporter = subArgs[0]
+						default:
+							return nil, h.Errf("%s %s subdirective has unsupported value: %s", rootDirective, subDirective, subArgs[0])
+						}
+						if len(subArgs) == 2 {
+							portal.Tracing.Endpoint = subArgs[1]
+						}
+					case "service_name":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.Tracing.ServiceName = subArgs[0]
+					case "backend":
+						if len(subArgs) == 0 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.Tracing.Backends = append(portal.Tracing.Backends, subArgs...)
+					case "timeout":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						i, err := strconv.Atoi(subArgs[0])
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if i < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.Tracing.Timeout = i
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "session_handle":
+				if portal.SessionHandles == nil {
+					portal.SessionHandles = &sessions.Handles{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					switch subDirective {
+					case "header":
+						if !h.NextArg() {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						portal.SessionHandles.Header = h.Val()
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "session_stats":
+				if portal.SessionStats == nil {
+					portal.SessionStats = &sessions.Stats{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					switch subDirective {
+					case "admin":
+						if len(subArgs) < 2 || subArgs[0] != "role" {
+							return nil, h.Errf("%s %s subdirective is malformed, expected admin role <name>", rootDirective, subDirective)
+						}
+						portal.SessionStats.AdminRoles = append(portal.SessionStats.AdminRoles, subArgs[1:]...)
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
+			case "session_transfer":
+				if portal.SessionTransfer == nil {
+					portal.SessionTransfer = &sessions.Transfer{}
+				}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					subDirective := h.Val()
+					subArgs := h.RemainingArgs()
+					switch subDirective {
+					case "admin":
+						if len(subArgs) < 2 || subArgs[0] != "role" {
+							return nil, h.Errf("%s %s subdirective is malformed, expected admin role <name>", rootDirective, subDirective)
+						}
+						portal.SessionTransfer.AdminRoles = append(portal.SessionTransfer.AdminRoles, subArgs[1:]...)
+					case "import":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						switch subArgs[0] {
+						case "yes":
+							portal.SessionTransfer.Import = true
+						case "no":
+							portal.SessionTransfer.Import = false
+						default:
+							return nil, h.Errf("unsupported value %s in %s %s subdirective", subArgs[0], rootDirective, subDirective)
+						}
+					case "max_import_size":
+						if len(subArgs) != 1 {
+							return nil, h.Errf("%s %s subdirective has no value", rootDirective, subDirective)
+						}
+						size, err := strconv.ParseInt(subArgs[0], 10, 64)
+						if err != nil {
+							return nil, h.Errf("%s %s subdirective value conversion failed: %s", rootDirective, subDirective, err)
+						}
+						if size < 1 {
+							return nil, h.Errf("%s %s subdirective value must be greater than zero", rootDirective, subDirective)
+						}
+						portal.SessionTransfer.MaxImportSize = size
+					default:
+						return nil, h.Errf("unsupported subdirective for %s: %s", rootDirective, subDirective)
+					}
+				}
 			case "enable":
 				args := strings.Join(h.RemainingArgs(), " ")
 				switch args {
 				case "source ip tracking":
 					portal.EnableSourceIPTracking = true
+				case "login coalescing":
+					portal.CoalesceLogins = true
+				case "post only credentials":
+					portal.PostOnlyCredentials = true
 				default:
 					return nil, h.Errf("unsupported directive for %s: %s", rootDirective, args)
 				}
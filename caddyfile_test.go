@@ -16,6 +16,9 @@ package portal
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/caddytest"
 	_ "github.com/greenpau/caddy-auth-jwt"
 	"io/ioutil"
@@ -164,3 +167,77 @@ func TestShortLocalCaddyfile(t *testing.T) {
 	t.Logf("%v", resp)
 	time.Sleep(1 * time.Second)
 }
+
+func TestCaddyfileFlattenClaims(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		directive string
+		shouldErr bool
+		errPhrase string
+		result    string
+	}{
+		{
+			directive: "flatten_claims address ext",
+			result:    `"flatten_claims":["address","ext"]`,
+		},
+		{
+			directive: "flatten_claims",
+			shouldErr: true,
+			errPhrase: "auth backend google_oauth2_backend subdirective flatten_claims has no value",
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, directive: %s", i, test.directive)
+		input := `auth_portal {
+		  backends {
+		    google_oauth2_backend {
+		      method oauth2
+		      realm google
+		      provider google
+		      client_id foo
+		      client_secret bar
+		      ` + test.directive + `
+		    }
+		  }
+		}`
+		h := httpcaddyfile.Helper{
+			Dispenser: caddyfile.NewTestDispenser(input),
+		}
+		cfg, err := parseCaddyfileAuthPortal(h)
+		if test.shouldErr {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but got none", testDescr)
+				testFailed++
+				continue
+			}
+			if !strings.Contains(err.Error(), test.errPhrase) {
+				t.Logf("FAIL: %s, error mismatch: %s (expected) vs. %s (received)", testDescr, test.errPhrase, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s", testDescr)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		cfgJSON, err := json.Marshal(cfg[0].Value)
+		if err != nil {
+			t.Logf("FAIL: %s, failed marshaling config: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if !strings.Contains(string(cfgJSON), test.result) {
+			t.Logf("FAIL: %s, %s not found in %s", testDescr, test.result, cfgJSON)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
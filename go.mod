@@ -3,14 +3,17 @@ module github.com/greenpau/caddy-auth-portal
 go 1.14
 
 require (
+	github.com/beevik/etree v1.1.0
 	github.com/caddyserver/caddy/v2 v2.2.0
 	github.com/crewjam/saml v0.4.5
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-ldap/ldap v3.0.3+incompatible
 	github.com/greenpau/caddy-auth-jwt v1.2.4
 	github.com/greenpau/go-identity v1.0.19
+	github.com/prometheus/client_golang v1.7.1
 	github.com/satori/go.uuid v1.2.0
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	go.uber.org/zap v1.15.0
+	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de
 	gopkg.in/asn1-ber.v1 v1.0.0-20181015200546-f715ec2f112d // indirect
 )
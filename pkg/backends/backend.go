@@ -20,6 +20,7 @@ import (
 
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
 	"github.com/greenpau/caddy-auth-portal/pkg/backends/boltdb"
+	"github.com/greenpau/caddy-auth-portal/pkg/backends/gateway"
 	"github.com/greenpau/caddy-auth-portal/pkg/backends/ldap"
 	"github.com/greenpau/caddy-auth-portal/pkg/backends/local"
 	"github.com/greenpau/caddy-auth-portal/pkg/backends/oauth2"
@@ -34,6 +35,7 @@ import (
 type Backend struct {
 	authMethod string
 	driver     BackendDriver
+	aliases    []string
 }
 
 // BackendDriver is an interface to an authentication provider.
@@ -61,6 +63,26 @@ func (b *Backend) GetName() string {
 	return b.driver.GetName()
 }
 
+// GetAliases returns the alternate names of the realm associated with an
+// authentication provider.
+func (b *Backend) GetAliases() []string {
+	return b.aliases
+}
+
+// MatchRealm returns true when the realm is either the realm associated
+// with an authentication provider or one of its aliases.
+func (b *Backend) MatchRealm(realm string) bool {
+	if b.driver.GetRealm() == realm {
+		return true
+	}
+	for _, alias := range b.aliases {
+		if alias == realm {
+			return true
+		}
+	}
+	return false
+}
+
 // GetMethod returns the authentication method associated with an authentication provider.
 func (b *Backend) GetMethod() string {
 	return b.driver.GetMethod()
@@ -118,6 +140,43 @@ func (b *Backend) GetMfaTokens(opts map[string]interface{}) ([]*identity.MfaToke
 	return b.driver.GetMfaTokens(opts)
 }
 
+// GetProfile returns the profile fields of a user. It returns an error
+// when the provider does not store them.
+func (b *Backend) GetProfile(opts map[string]interface{}) (map[string]string, error) {
+	driver, ok := b.driver.(interface {
+		GetProfile(map[string]interface{}) (map[string]string, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("profile is not supported")
+	}
+	return driver.GetProfile(opts)
+}
+
+// GetEmailAddress returns the email address of a user. It returns an
+// error when the provider does not store them.
+func (b *Backend) GetEmailAddress(opts map[string]interface{}) (string, error) {
+	driver, ok := b.driver.(interface {
+		GetEmailAddress(map[string]interface{}) (string, error)
+	})
+	if !ok {
+		return "", fmt.Errorf("email address lookup is not supported")
+	}
+	return driver.GetEmailAddress(opts)
+}
+
+// GetLogoutURL returns the URL ending the user session with an
+// authentication provider. The URL is empty when the provider does not
+// support logout.
+func (b *Backend) GetLogoutURL(opts map[string]interface{}) (string, error) {
+	driver, ok := b.driver.(interface {
+		GetLogoutURL(map[string]interface{}) (string, error)
+	})
+	if !ok {
+		return "", nil
+	}
+	return driver.GetLogoutURL(opts)
+}
+
 // Authenticate performs authentication with an authentication provider.
 func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interface{}, error) {
 	return b.driver.Authenticate(opts)
@@ -130,7 +189,19 @@ func (b *Backend) Validate() error {
 
 // MarshalJSON packs configuration info JSON byte array
 func (b Backend) MarshalJSON() ([]byte, error) {
-	return json.Marshal(b.driver)
+	if len(b.aliases) == 0 {
+		return json.Marshal(b.driver)
+	}
+	data, err := json.Marshal(b.driver)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	m["aliases"] = b.aliases
+	return json.Marshal(m)
 }
 
 // UnmarshalJSON unpacks configuration into appropriate structures.
@@ -155,6 +226,20 @@ func (b *Backend) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("failed to unpack configuration data, method key is missing: %s", data)
 	}
 
+	if v, exists := confData["aliases"]; exists {
+		entries, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("failed to unpack configuration data, aliases key is not a list: %s", data)
+		}
+		for _, entry := range entries {
+			alias, ok := entry.(string)
+			if !ok || alias == "" {
+				return fmt.Errorf("failed to unpack configuration data, alias is not a string: %s", data)
+			}
+			b.aliases = append(b.aliases, alias)
+		}
+	}
+
 	switch b.authMethod {
 	case "boltdb":
 		b.authMethod = "boltdb"
@@ -202,6 +287,14 @@ func (b *Backend) UnmarshalJSON(data []byte) error {
 			return err
 		}
 		b.driver = driver
+
+	case "gateway":
+		b.authMethod = "gateway"
+		driver, err := newGatewayDriver(data)
+		if err != nil {
+			return err
+		}
+		b.driver = driver
 	default:
 		return fmt.Errorf("unsupported authentication method configuration: %s", data)
 	}
@@ -299,3 +392,14 @@ func newOauth2Driver(data []byte) (*oauth2.Backend, error) {
 	}
 	return driver, nil
 }
+
+func newGatewayDriver(data []byte) (*gateway.Backend, error) {
+	driver := gateway.NewDatabaseBackend()
+	if err := json.Unmarshal(data, driver); err != nil {
+		return nil, fmt.Errorf("invalid gateway configuration, error: %s, config: %s", err, data)
+	}
+	if err := driver.ValidateConfig(); err != nil {
+		return nil, fmt.Errorf("invalid gateway configuration, error: %s, config: %s", err, data)
+	}
+	return driver, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestMatchRealm(t *testing.T) {
+	testFailed := 0
+	data := []byte(`{"name":"x509_backend","method":"x509","realm":"corp","aliases":["corp.contoso.com","contoso"]}`)
+	b := &Backend{}
+	if err := b.UnmarshalJSON(data); err != nil {
+		t.Fatalf("failed unpacking backend: %s", err)
+	}
+	// The aliases survive the round trip of the configuration.
+	packed, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("failed packing backend: %s", err)
+	}
+	b = &Backend{}
+	if err := b.UnmarshalJSON(packed); err != nil {
+		t.Fatalf("failed unpacking packed backend: %s", err)
+	}
+
+	tests := []struct {
+		realm   string
+		matched bool
+	}{
+		{realm: "corp", matched: true},
+		{realm: "corp.contoso.com", matched: true},
+		{realm: "contoso", matched: true},
+		{realm: "local", matched: false},
+		{realm: "", matched: false},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, realm: %s", i, test.realm)
+		if matched := b.MatchRealm(test.realm); matched != test.matched {
+			t.Logf("FAIL: %s, expected: %t, received: %t", testDescr, test.matched, matched)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/go-identity"
+
+	"go.uber.org/zap"
+)
+
+// Backend represents authentication provider trusting the identity
+// asserted by an upstream gateway via request headers.
+type Backend struct {
+	Name   string `json:"name,omitempty"`
+	Method string `json:"method,omitempty"`
+	Realm  string `json:"realm,omitempty"`
+	// The IP addresses or CIDR ranges of the gateways allowed to
+	// assert the identity of users.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+	// The mapping of request headers to token claims, e.g.
+	// X-Remote-User to sub. The roles claim is a comma-separated list.
+	// The claims other than sub, email, name, and roles are added
+	// to the token as custom claims.
+	Headers       map[string]string            `json:"headers,omitempty"`
+	TokenProvider *jwtconfig.CommonTokenConfig `json:"-"`
+	networks      []*net.IPNet
+	logger        *zap.Logger
+}
+
+// NewDatabaseBackend return an instance of authentication provider
+// with gateway backend.
+func NewDatabaseBackend() *Backend {
+	b := &Backend{
+		Method:        "gateway",
+		TokenProvider: jwtconfig.NewCommonTokenConfig(),
+	}
+	return b
+}
+
+// ConfigureAuthenticator configures backend.
+func (b *Backend) ConfigureAuthenticator() error {
+	b.networks = nil
+	for _, proxy := range b.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			b.logger.Error("failed configuring trusted proxies for gateway authentication",
+				zap.String("error", err.Error()))
+			return err
+		}
+		b.networks = append(b.networks, network)
+	}
+	return nil
+}
+
+// ValidateConfig checks whether Backend has mandatory configuration.
+func (b *Backend) ValidateConfig() error {
+	if b.Realm == "" {
+		return fmt.Errorf("no realm found")
+	}
+	if len(b.TrustedProxies) == 0 {
+		return fmt.Errorf("no trusted proxies found")
+	}
+	subjectFound := false
+	for _, claim := range b.Headers {
+		if claim == "sub" {
+			subjectFound = true
+		}
+	}
+	if !subjectFound {
+		return fmt.Errorf("no header mapped to sub claim")
+	}
+	return nil
+}
+
+// isTrustedProxy returns true when the request came directly from one
+// of the trusted proxies. The forwarding headers are ignored, because
+// the clients control them.
+func (b *Backend) isTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range b.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate performs authentication.
+func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interface{}, error) {
+	resp := make(map[string]interface{})
+	resp["code"] = 400
+	r, ok := opts["request"].(*http.Request)
+	if !ok {
+		return resp, fmt.Errorf("no request found")
+	}
+	if !b.isTrustedProxy(r) {
+		resp["code"] = 403
+		return resp, fmt.Errorf("untrusted source address: %s", r.RemoteAddr)
+	}
+
+	claims := &jwtclaims.UserClaims{}
+	customClaims := make(map[string]interface{})
+	for header, claim := range b.Headers {
+		v := strings.TrimSpace(r.Header.Get(header))
+		if v == "" {
+			continue
+		}
+		switch claim {
+		case "sub":
+			claims.Subject = v
+		case "email":
+			claims.Email = v
+		case "name":
+			claims.Name = v
+		case "roles":
+			for _, role := range strings.Split(v, ",") {
+				role = strings.TrimSpace(role)
+				if role == "" {
+					continue
+				}
+				claims.Roles = append(claims.Roles, role)
+			}
+		default:
+			customClaims[claim] = v
+		}
+	}
+	if claims.Subject == "" {
+		resp["code"] = 401
+		return resp, fmt.Errorf("identity header not found")
+	}
+	claims.Origin = b.TokenProvider.TokenOrigin
+	claims.ExpiresAt = time.Now().Add(time.Duration(b.TokenProvider.TokenLifetime) * time.Second).Unix()
+	resp["code"] = 200
+	resp["claims"] = claims
+	if len(customClaims) > 0 {
+		resp["custom_claims"] = customClaims
+	}
+	b.logger.Debug(
+		"gateway asserted user identity",
+		zap.String("realm", b.Realm),
+		zap.String("source_address", r.RemoteAddr),
+		zap.String("user", claims.Subject),
+	)
+	return resp, nil
+}
+
+// Validate checks whether Backend is functional.
+func (b *Backend) Validate() error {
+	if err := b.ValidateConfig(); err != nil {
+		return err
+	}
+	if b.logger == nil {
+		return fmt.Errorf("gateway backend logger is nil")
+	}
+	b.logger.Info("successfully validated gateway backend")
+	return nil
+}
+
+// GetRealm return authentication realm.
+func (b *Backend) GetRealm() string {
+	return b.Realm
+}
+
+// GetName return the name associated with this backend.
+func (b *Backend) GetName() string {
+	return b.Name
+}
+
+// ConfigureTokenProvider configures TokenProvider.
+func (b *Backend) ConfigureTokenProvider(upstream *jwtconfig.CommonTokenConfig) error {
+	if upstream == nil {
+		return fmt.Errorf("upstream token provider is nil")
+	}
+	if b.TokenProvider == nil {
+		b.TokenProvider = jwtconfig.NewCommonTokenConfig()
+	}
+	if b.TokenProvider.TokenSecret == "" {
+		b.TokenProvider.TokenSecret = upstream.TokenSecret
+	}
+	if b.TokenProvider.TokenOrigin == "" {
+		b.TokenProvider.TokenOrigin = upstream.TokenOrigin
+	}
+	b.TokenProvider.TokenLifetime = upstream.TokenLifetime
+	b.TokenProvider.TokenName = upstream.TokenName
+	return nil
+}
+
+// ConfigureLogger configures backend with the same logger as its user.
+func (b *Backend) ConfigureLogger(logger *zap.Logger) error {
+	if logger == nil {
+		return fmt.Errorf("upstream logger is nil")
+	}
+	b.logger = logger
+	return nil
+}
+
+// GetMethod returns the authentication method associated with this backend.
+func (b *Backend) GetMethod() string {
+	return b.Method
+}
+
+// Do performs the requested operation.
+func (b *Backend) Do(opts map[string]interface{}) error {
+	op := opts["name"].(string)
+	switch op {
+	case "password_change":
+		return fmt.Errorf("Password change operation is not available")
+	}
+	return fmt.Errorf("Unsupported backend operation")
+}
+
+// GetPublicKeys return a list of public keys associated with a user.
+func (b *Backend) GetPublicKeys(opts map[string]interface{}) ([]*identity.PublicKey, error) {
+	return nil, fmt.Errorf("Unsupported backend operation")
+}
+
+// GetMfaTokens return a list of MFA tokens associated with a user.
+func (b *Backend) GetMfaTokens(opts map[string]interface{}) ([]*identity.MfaToken, error) {
+	return nil, fmt.Errorf("Unsupported backend operation")
+}
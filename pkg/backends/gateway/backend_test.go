@@ -0,0 +1,131 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestAuthenticate(t *testing.T) {
+	testFailed := 0
+	b := NewDatabaseBackend()
+	b.Realm = "gateway"
+	b.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.10"}
+	b.Headers = map[string]string{
+		"X-Remote-User":       "sub",
+		"X-Remote-Email":      "email",
+		"X-Remote-Groups":     "roles",
+		"X-Remote-Department": "department",
+	}
+	b.logger = utils.NewLogger()
+	if err := b.ConfigureAuthenticator(); err != nil {
+		t.Fatalf("failed configuring backend: %s", err)
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatalf("failed validating backend: %s", err)
+	}
+
+	tests := []struct {
+		remoteAddr   string
+		headers      map[string]string
+		code         int
+		roles        []string
+		customClaims map[string]interface{}
+	}{
+		{
+			remoteAddr: "10.1.2.3:4567",
+			headers: map[string]string{
+				"X-Remote-User":   "jsmith",
+				"X-Remote-Email":  "jsmith@contoso.com",
+				"X-Remote-Groups": "admin, viewer",
+			},
+			code:  200,
+			roles: []string{"admin", "viewer"},
+		},
+		{
+			remoteAddr: "192.168.1.10:4567",
+			headers: map[string]string{
+				"X-Remote-User":       "jsmith",
+				"X-Remote-Department": "IT",
+			},
+			code: 200,
+			customClaims: map[string]interface{}{
+				"department": "IT",
+			},
+		},
+		{
+			remoteAddr: "192.168.1.11:4567",
+			headers: map[string]string{
+				"X-Remote-User":   "jsmith",
+				"X-Remote-Groups": "admin",
+			},
+			code: 403,
+		},
+		{
+			remoteAddr: "10.1.2.3:4567",
+			headers: map[string]string{
+				"X-Remote-Email": "jsmith@contoso.com",
+			},
+			code: 401,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, remote address: %s, headers: %v", i, test.remoteAddr, test.headers)
+		r := httptest.NewRequest("GET", "/auth/gateway/gateway", nil)
+		r.RemoteAddr = test.remoteAddr
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		resp, err := b.Authenticate(map[string]interface{}{"request": r})
+		if resp["code"].(int) != test.code {
+			t.Logf("FAIL: %s, code mismatch: %d (expected) vs. %v (received), error: %v", testDescr, test.code, resp["code"], err)
+			testFailed++
+			continue
+		}
+		if test.code != 200 {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but got success", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		claims := resp["claims"].(*jwtclaims.UserClaims)
+		if claims.Subject != "jsmith" || !reflect.DeepEqual(claims.Roles, test.roles) {
+			t.Logf("FAIL: %s, claims mismatch: %v", testDescr, claims)
+			testFailed++
+			continue
+		}
+		customClaims, _ := resp["custom_claims"].(map[string]interface{})
+		if len(customClaims) != len(test.customClaims) || (len(customClaims) > 0 && !reflect.DeepEqual(customClaims, test.customClaims)) {
+			t.Logf("FAIL: %s, custom claims mismatch: %v (expected) vs. %v (received)", testDescr, test.customClaims, customClaims)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/go-ldap/ldap"
 	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/claimsource"
 	"github.com/greenpau/go-identity"
 
 	"go.uber.org/zap"
@@ -79,6 +80,8 @@ type Backend struct {
 	SearchFilter       string                       `json:"search_filter,omitempty"`
 	Groups             []UserGroup                  `json:"groups,omitempty"`
 	TrustedAuthorities []string                     `json:"trusted_authorities,omitempty"`
+	CacheTTL           int                          `json:"cache_ttl,omitempty"`
+	ClaimSources       claimsource.Priority         `json:"claim_sources,omitempty"`
 	TokenProvider      *jwtconfig.CommonTokenConfig `json:"-"`
 	Authenticator      *Authenticator               `json:"-"`
 	logger             *zap.Logger
@@ -107,6 +110,8 @@ type Authenticator struct {
 	userAttributes UserAttributes
 	rootCAs        *x509.CertPool
 	groups         []*UserGroup
+	cache          *userCache
+	claimSources   claimsource.Priority
 	logger         *zap.Logger
 }
 
@@ -300,6 +305,21 @@ func (sa *Authenticator) ConfigureUserGroups(groups []UserGroup) error {
 	return nil
 }
 
+// ConfigureCache configures the number of seconds the results of the
+// directory searches for users are cached. Zero disables the cache.
+func (sa *Authenticator) ConfigureCache(ttl int) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	if ttl < 0 {
+		return fmt.Errorf("cache ttl must not be negative: %d", ttl)
+	}
+	sa.cache = nil
+	if ttl > 0 {
+		sa.cache = newUserCache(time.Duration(ttl) * time.Second)
+	}
+	return nil
+}
+
 // AuthenticateUser checks the database for the presence of a username/email
 // and password and returns user claims.
 func (sa *Authenticator) AuthenticateUser(userInput, passwordInput string) (*jwtclaims.UserClaims, int, error) {
@@ -372,6 +392,26 @@ func (sa *Authenticator) AuthenticateUser(userInput, passwordInput string) (*jwt
 		ldapConnection.Start()
 		defer ldapConnection.Close()
 
+		// The cached search results skip the search, but the password
+		// is always checked by the server.
+		if userDN, claims := sa.cache.get(userInput); claims != nil {
+			if err := ldapConnection.Bind(userDN, passwordInput); err != nil {
+				sa.logger.Error(
+					"LDAP auth binding failed",
+					zap.String("server", server.Address),
+					zap.String("username", userDN),
+					zap.String("error", err.Error()),
+				)
+				return nil, 401, fmt.Errorf("authentication failed, %s", err)
+			}
+			sa.logger.Debug(
+				"LDAP user match from cache",
+				zap.String("server", server.Address),
+				zap.String("username", claims.Subject),
+			)
+			return claims, 200, nil
+		}
+
 		if err := ldapConnection.Bind(sa.username, sa.password); err != nil {
 			sa.logger.Error(
 				"LDAP connection binding failed",
@@ -398,13 +438,7 @@ func (sa *Authenticator) AuthenticateUser(userInput, passwordInput string) (*jwt
 			server.Timeout,
 			false,
 			searchFilter,
-			[]string{
-				sa.userAttributes.Name,
-				sa.userAttributes.Surname,
-				sa.userAttributes.Username,
-				sa.userAttributes.MemberOf,
-				sa.userAttributes.Email,
-			},
+			sa.searchAttributes(),
 			nil, // Controls
 		)
 
@@ -478,10 +512,8 @@ func (sa *Authenticator) AuthenticateUser(userInput, passwordInput string) (*jwt
 					}
 				}
 			}
-			if attr.Name == sa.userAttributes.Email {
-				userMail = attr.Values[0]
-			}
 		}
+		userMail = sa.resolveEmail(user.Attributes)
 
 		if userFirstName != "" {
 			userFullName = userFirstName
@@ -536,6 +568,7 @@ func (sa *Authenticator) AuthenticateUser(userInput, passwordInput string) (*jwt
 		}
 		//claims.Origin = sa.searchBaseDN
 		claims.Origin = server.Address
+		sa.cache.add(userInput, user.DN, claims)
 
 		return claims, 200, nil
 	}
@@ -612,6 +645,18 @@ func (b *Backend) ConfigureAuthenticator() error {
 		return err
 	}
 
+	if err := b.Authenticator.ConfigureCache(b.CacheTTL); err != nil {
+		b.logger.Error("failed configuring user cache",
+			zap.String("error", err.Error()))
+		return err
+	}
+
+	if err := b.Authenticator.ConfigureClaimSources(b.ClaimSources); err != nil {
+		b.logger.Error("failed configuring claim sources",
+			zap.String("error", err.Error()))
+		return err
+	}
+
 	return nil
 }
 
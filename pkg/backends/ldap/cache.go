@@ -0,0 +1,84 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"strings"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// cachedUser is the result of the directory search for a user. It
+// allows skipping the search, but not the password check.
+type cachedUser struct {
+	dn       string
+	claims   jwtclaims.UserClaims
+	cachedAt time.Time
+}
+
+// userCache holds the results of the directory searches for a limited
+// time. It is not safe for concurrent use.
+type userCache struct {
+	ttl     time.Duration
+	entries map[string]*cachedUser
+}
+
+func newUserCache(ttl time.Duration) *userCache {
+	return &userCache{
+		ttl:     ttl,
+		entries: make(map[string]*cachedUser),
+	}
+}
+
+// get returns the cached user matching the username, if the entry has
+// not expired.
+func (c *userCache) get(username string) (string, *jwtclaims.UserClaims) {
+	if c == nil {
+		return "", nil
+	}
+	username = strings.ToLower(username)
+	entry, exists := c.entries[username]
+	if !exists {
+		return "", nil
+	}
+	if time.Since(entry.cachedAt) > c.ttl {
+		delete(c.entries, username)
+		return "", nil
+	}
+	claims := entry.claims
+	claims.Roles = append([]string{}, entry.claims.Roles...)
+	return entry.dn, &claims
+}
+
+// add caches the user matching the username. It also removes expired
+// entries.
+func (c *userCache) add(username, dn string, claims *jwtclaims.UserClaims) {
+	if c == nil {
+		return
+	}
+	for k, entry := range c.entries {
+		if time.Since(entry.cachedAt) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	entry := &cachedUser{
+		dn:       dn,
+		claims:   *claims,
+		cachedAt: time.Now(),
+	}
+	entry.claims.Roles = append([]string{}, claims.Roles...)
+	c.entries[strings.ToLower(username)] = entry
+}
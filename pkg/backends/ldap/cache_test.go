@@ -0,0 +1,86 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestUserCache(t *testing.T) {
+	testFailed := 0
+	claims := &jwtclaims.UserClaims{
+		Subject: "jsmith",
+		Email:   "jsmith@contoso.com",
+		Roles:   []string{"viewer"},
+	}
+	cache := newUserCache(time.Minute)
+	cache.add("JSmith", "CN=Smith\\, John,OU=Users,DC=CONTOSO,DC=COM", claims)
+	cache.add("expired", "CN=Expired,OU=Users,DC=CONTOSO,DC=COM", claims)
+	cache.entries["expired"].cachedAt = time.Now().Add(-2 * time.Minute)
+
+	tests := []struct {
+		cache    *userCache
+		username string
+		dn       string
+	}{
+		{cache: cache, username: "jsmith", dn: "CN=Smith\\, John,OU=Users,DC=CONTOSO,DC=COM"},
+		{cache: cache, username: "expired"},
+		{cache: cache, username: "unknown"},
+		{cache: nil, username: "jsmith"},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, username: %s", i, test.username)
+		dn, cachedClaims := test.cache.get(test.username)
+		if dn != test.dn {
+			t.Logf("FAIL: %s, dn mismatch: %q (expected) vs. %q (received)", testDescr, test.dn, dn)
+			testFailed++
+			continue
+		}
+		if test.dn == "" {
+			if cachedClaims != nil {
+				t.Logf("FAIL: %s, unexpected claims: %v", testDescr, cachedClaims)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s", testDescr)
+			continue
+		}
+		if cachedClaims.Email != claims.Email {
+			t.Logf("FAIL: %s, email mismatch: %s", testDescr, cachedClaims.Email)
+			testFailed++
+			continue
+		}
+		// The claims returned by the cache must not share state with
+		// the cached entry.
+		cachedClaims.Roles[0] = "admin"
+		if _, c := test.cache.get(test.username); c.Roles[0] != "viewer" {
+			t.Logf("FAIL: %s, cached roles were modified: %v", testDescr, c.Roles)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if _, exists := cache.entries["expired"]; exists {
+		t.Logf("FAIL: expired entry was not removed")
+		testFailed++
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"github.com/go-ldap/ldap"
+	"github.com/greenpau/caddy-auth-portal/pkg/claimsource"
+)
+
+// supportedClaimSources holds the claims resolvable by their sources.
+// The sources are the names of the LDAP attributes.
+var supportedClaimSources = map[string][]string{
+	"email": nil,
+}
+
+// ConfigureClaimSources configures the ordered LDAP attributes the
+// claims are taken from. By default, the email claim is taken from
+// the email attribute, i.e. mail.
+func (sa *Authenticator) ConfigureClaimSources(p claimsource.Priority) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	if err := p.Validate(supportedClaimSources); err != nil {
+		return err
+	}
+	sa.claimSources = p
+	return nil
+}
+
+// searchAttributes returns the LDAP attributes requested in the user
+// search.
+func (sa *Authenticator) searchAttributes() []string {
+	attrs := []string{
+		sa.userAttributes.Name,
+		sa.userAttributes.Surname,
+		sa.userAttributes.Username,
+		sa.userAttributes.MemberOf,
+		sa.userAttributes.Email,
+	}
+	for _, attrName := range sa.claimSources["email"] {
+		if attrName == sa.userAttributes.Email {
+			continue
+		}
+		attrs = append(attrs, attrName)
+	}
+	return attrs
+}
+
+// resolveEmail returns the email address of the user from the highest
+// priority attribute.
+func (sa *Authenticator) resolveEmail(attrs []*ldap.EntryAttribute) string {
+	values := make(map[string]string)
+	for _, attr := range attrs {
+		if len(attr.Values) < 1 {
+			continue
+		}
+		values[attr.Name] = attr.Values[0]
+	}
+	email, _ := sa.claimSources.Resolve("email", []string{sa.userAttributes.Email}, values)
+	return email
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"fmt"
+	"github.com/go-ldap/ldap"
+	"github.com/greenpau/caddy-auth-portal/pkg/claimsource"
+	"testing"
+)
+
+func TestResolveEmail(t *testing.T) {
+	testFailed := 0
+	attrs := []*ldap.EntryAttribute{
+		{Name: "sAMAccountName", Values: []string{"jsmith"}},
+		{Name: "mail", Values: []string{"jsmith@contoso.com"}},
+		{Name: "userPrincipalName", Values: []string{"john.smith@contoso.com"}},
+		{Name: "proxyAddresses", Values: []string{}},
+	}
+	tests := []struct {
+		name       string
+		sources    claimsource.Priority
+		email      string
+		shouldFail bool
+	}{
+		{name: "default priority uses email attribute", email: "jsmith@contoso.com"},
+		{
+			name:    "user principal name wins over mail",
+			sources: claimsource.Priority{"email": {"userPrincipalName", "mail"}},
+			email:   "john.smith@contoso.com",
+		},
+		{
+			name:    "empty attribute falls back to mail",
+			sources: claimsource.Priority{"email": {"proxyAddresses", "mail"}},
+			email:   "jsmith@contoso.com",
+		},
+		{
+			name:       "unsupported claim",
+			sources:    claimsource.Priority{"name": {"displayName"}},
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.name)
+		sa := NewAuthenticator()
+		sa.userAttributes = UserAttributes{Email: "mail"}
+		if err := sa.ConfigureClaimSources(test.sources); err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+			} else {
+				t.Logf("PASS: %s, error: %s", testDescr, err)
+			}
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if email := sa.resolveEmail(attrs); email != test.email {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, test.email, email)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
 
 	"github.com/greenpau/go-identity"
 	"github.com/satori/go.uuid"
@@ -30,6 +31,10 @@ import (
 
 var globalAuthenticator *Authenticator
 
+// chosenPasswordPurpose marks the passwords the users chose themselves,
+// as opposed to the passwords provisioned for them.
+const chosenPasswordPurpose = "chosen"
+
 func init() {
 	globalAuthenticator = NewAuthenticator()
 	return
@@ -37,10 +42,20 @@ func init() {
 
 // Backend represents authentication provider with local backend.
 type Backend struct {
-	Name          string                       `json:"name,omitempty"`
-	Method        string                       `json:"method,omitempty"`
-	Realm         string                       `json:"realm,omitempty"`
-	Path          string                       `json:"path,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Method string `json:"method,omitempty"`
+	Realm  string `json:"realm,omitempty"`
+	Path   string `json:"path,omitempty"`
+
+	// The minimum number of hours between password changes.
+	MinPasswordAge int `json:"min_password_age,omitempty"`
+	// The maximum number of days a password remains valid. A user with
+	// an expired password must change it before completing the login.
+	MaxPasswordAge int `json:"max_password_age,omitempty"`
+	// The number of days before the password expiry when the user is
+	// warned about it.
+	PasswordExpiryWarning int `json:"password_expiry_warning,omitempty"`
+
 	TokenProvider *jwtconfig.CommonTokenConfig `json:"-"`
 	Authenticator *Authenticator               `json:"-"`
 	logger        *zap.Logger
@@ -59,10 +74,11 @@ func NewDatabaseBackend() *Backend {
 
 // Authenticator represents database connector.
 type Authenticator struct {
-	db     *identity.Database
-	mux    sync.Mutex
-	path   string
-	logger *zap.Logger
+	db       *identity.Database
+	profiles *profile.Store
+	mux      sync.Mutex
+	path     string
+	logger   *zap.Logger
 }
 
 // NewAuthenticator returns an instance of Authenticator.
@@ -140,6 +156,11 @@ func (sa *Authenticator) Configure() error {
 	if err := sa.db.LoadFromFile(sa.path); err != nil {
 		return fmt.Errorf("failed loading local database at %s: %s", sa.path, err)
 	}
+	profiles, err := profile.OpenStore(sa.path + profile.StoreSuffix)
+	if err != nil {
+		return err
+	}
+	sa.profiles = profiles
 	return nil
 }
 
@@ -205,7 +226,134 @@ func (sa *Authenticator) ChangePassword(opts map[string]interface{}) error {
 	sa.mux.Lock()
 	defer sa.mux.Unlock()
 	opts["file_path"] = sa.path
-	return sa.db.ChangeUserPassword(opts)
+	if err := sa.db.ChangeUserPassword(opts); err != nil {
+		return err
+	}
+	user, err := sa.db.GetUserByUsername(opts["username"].(string))
+	if err != nil {
+		return err
+	}
+	return sa.markChosenPassword(user)
+}
+
+// markChosenPassword marks the current password of a user as chosen
+// by the user.
+func (sa *Authenticator) markChosenPassword(user *identity.User) error {
+	user.Passwords[0].Purpose = chosenPasswordPurpose
+	if err := sa.db.SaveToFile(sa.path); err != nil {
+		return fmt.Errorf("failed to commit new password, %s", err)
+	}
+	return nil
+}
+
+// GetPasswordChangeTime returns the time when the current password
+// of a user was set, and whether the user chose the password via the
+// password change or the account recovery. The passwords provisioned
+// otherwise, e.g. by an administrator, are not chosen by the user.
+func (sa *Authenticator) GetPasswordChangeTime(username string) (time.Time, bool, error) {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	user, err := sa.db.GetUserByUsername(username)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(user.Passwords) == 0 {
+		return time.Time{}, false, fmt.Errorf("user has no password")
+	}
+	return user.Passwords[0].CreatedAt, user.Passwords[0].Purpose == chosenPasswordPurpose, nil
+}
+
+// ResetPassword sets new password for a user without verifying
+// the current password of the user. It is used by account recovery.
+// The username input is either a username or an email address.
+func (sa *Authenticator) ResetPassword(opts map[string]interface{}) error {
+	for _, k := range []string{"username", "new_password"} {
+		if _, exists := opts[k]; !exists {
+			return fmt.Errorf("Password reset required %s input field", k)
+		}
+	}
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	userInput := opts["username"].(string)
+	var user *identity.User
+	var err error
+	if strings.Contains(userInput, "@") {
+		user, err = sa.db.GetUserByEmailAddress(userInput)
+	} else {
+		user, err = sa.db.GetUserByUsername(userInput)
+	}
+	if err != nil {
+		return err
+	}
+	if err := user.AddPassword(opts["new_password"].(string)); err != nil {
+		return fmt.Errorf("failed setting new password, %s", err)
+	}
+	return sa.markChosenPassword(user)
+}
+
+// CheckEmailAddress returns an error when the new email address of a
+// user is associated with another user.
+func (sa *Authenticator) CheckEmailAddress(opts map[string]interface{}) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	_, _, err := sa.getEmailAddressChange(opts)
+	return err
+}
+
+// ChangeEmailAddress replaces the current email address of a user with
+// the new one.
+func (sa *Authenticator) ChangeEmailAddress(opts map[string]interface{}) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	user, i, err := sa.getEmailAddressChange(opts)
+	if err != nil {
+		return err
+	}
+	newEmail, err := identity.NewEmailAddress(opts["new_email"].(string))
+	if err != nil {
+		return err
+	}
+	newEmail.Confirmed = true
+	oldEmail := user.EmailAddresses[i]
+	user.EmailAddresses[i] = newEmail
+	delete(sa.db.RefEmailAddress, strings.ToLower(oldEmail.Address))
+	sa.db.RefEmailAddress[strings.ToLower(newEmail.Address)] = user
+	if err := sa.db.SaveToFile(sa.path); err != nil {
+		user.EmailAddresses[i] = oldEmail
+		delete(sa.db.RefEmailAddress, strings.ToLower(newEmail.Address))
+		sa.db.RefEmailAddress[strings.ToLower(oldEmail.Address)] = user
+		return fmt.Errorf("failed to commit new email address, %s", err)
+	}
+	return nil
+}
+
+// getEmailAddressChange returns the user and the index of the current
+// email address being changed.
+func (sa *Authenticator) getEmailAddressChange(opts map[string]interface{}) (*identity.User, int, error) {
+	for _, k := range []string{"username", "email", "new_email"} {
+		if _, exists := opts[k]; !exists {
+			return nil, 0, fmt.Errorf("Email address change required %s input field", k)
+		}
+	}
+	user, err := sa.db.GetUserByUsername(opts["username"].(string))
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := identity.NewEmailAddress(opts["new_email"].(string)); err != nil {
+		return nil, 0, err
+	}
+	if other, err := sa.db.GetUserByEmailAddress(opts["new_email"].(string)); err == nil {
+		if other.ID == user.ID {
+			return nil, 0, fmt.Errorf("email address is already associated with the user")
+		}
+		return nil, 0, fmt.Errorf("email address already associated with another user")
+	}
+	for i, email := range user.EmailAddresses {
+		if strings.EqualFold(email.Address, opts["email"].(string)) {
+			return user, i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("current email address not found")
 }
 
 // AddPublicKey adds public key, e.g. GPG or SSH, for a user.
@@ -256,6 +404,60 @@ func (sa *Authenticator) GetMfaTokens(opts map[string]interface{}) ([]*identity.
 	return sa.db.GetMfaTokens(opts)
 }
 
+// GetProfile returns the profile fields of a user.
+func (sa *Authenticator) GetProfile(opts map[string]interface{}) (map[string]string, error) {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	user, err := sa.db.GetUserByUsername(opts["username"].(string))
+	if err != nil {
+		return nil, err
+	}
+	if sa.profiles == nil {
+		return nil, fmt.Errorf("profile store is unavailable")
+	}
+	return sa.profiles.Get(user.ID), nil
+}
+
+// GetEmailAddress returns the primary email address of a user. The
+// username input is either a username or an email address.
+func (sa *Authenticator) GetEmailAddress(opts map[string]interface{}) (string, error) {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	userInput := opts["username"].(string)
+	var user *identity.User
+	var err error
+	if strings.Contains(userInput, "@") {
+		user, err = sa.db.GetUserByEmailAddress(userInput)
+	} else {
+		user, err = sa.db.GetUserByUsername(userInput)
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.GetMailClaim() == "" {
+		return "", fmt.Errorf("user has no email address")
+	}
+	return user.GetMailClaim(), nil
+}
+
+// UpdateProfile replaces the profile fields of a user.
+func (sa *Authenticator) UpdateProfile(opts map[string]interface{}) error {
+	sa.mux.Lock()
+	defer sa.mux.Unlock()
+	values, ok := opts["profile"].(map[string]string)
+	if !ok {
+		return fmt.Errorf("Profile update required profile input field")
+	}
+	user, err := sa.db.GetUserByUsername(opts["username"].(string))
+	if err != nil {
+		return err
+	}
+	if sa.profiles == nil {
+		return fmt.Errorf("profile store is unavailable")
+	}
+	return sa.profiles.Set(user.ID, values)
+}
+
 // ConfigureAuthenticator configures backend.
 func (b *Backend) ConfigureAuthenticator() error {
 	if b.Authenticator == nil {
@@ -322,11 +524,39 @@ func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interfac
 		claims.Origin = b.TokenProvider.TokenOrigin
 		claims.ExpiresAt = time.Now().Add(time.Duration(b.TokenProvider.TokenLifetime) * time.Second).Unix()
 		resp["claims"] = claims
+		if b.MaxPasswordAge > 0 {
+			b.checkPasswordExpiry(claims.Subject, resp)
+		}
 		return resp, nil
 	}
 	return resp, err
 }
 
+// checkPasswordExpiry adds "password_expired" to the authentication
+// response when the password of the user is older than the maximum
+// password age, and "password_expires_at" when the password expires
+// within the warning period.
+func (b *Backend) checkPasswordExpiry(username string, resp map[string]interface{}) {
+	changedAt, _, err := b.Authenticator.GetPasswordChangeTime(username)
+	if err != nil {
+		b.logger.Warn(
+			"failed checking password expiry",
+			zap.String("user", username),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	expiresAt := changedAt.Add(time.Duration(b.MaxPasswordAge) * 24 * time.Hour)
+	now := time.Now()
+	if now.After(expiresAt) {
+		resp["password_expired"] = true
+		return
+	}
+	if b.PasswordExpiryWarning > 0 && now.After(expiresAt.Add(-time.Duration(b.PasswordExpiryWarning)*24*time.Hour)) {
+		resp["password_expires_at"] = expiresAt
+	}
+}
+
 // Validate checks whether Backend is functional.
 func (b *Backend) Validate() error {
 	if err := b.ValidateConfig(); err != nil {
@@ -396,10 +626,13 @@ func (b *Backend) Do(opts map[string]interface{}) error {
 	op := opts["name"].(string)
 	switch op {
 	case "password_change":
+	case "password_reset":
 	case "add_ssh_key":
 	case "add_gpg_key":
 	case "delete_public_key":
 	case "add_mfa_token", "delete_mfa_token":
+	case "update_profile":
+	case "check_email_address", "change_email_address":
 		b.logger.Debug(
 			"detected supported backend operation",
 			zap.String("op", op),
@@ -419,7 +652,12 @@ func (b *Backend) Do(opts map[string]interface{}) error {
 
 	switch op {
 	case "password_change":
+		if err := b.checkMinPasswordAge(opts, time.Now()); err != nil {
+			return err
+		}
 		return b.Authenticator.ChangePassword(opts)
+	case "password_reset":
+		return b.Authenticator.ResetPassword(opts)
 	case "add_ssh_key":
 		opts["key_usage"] = "ssh"
 		return b.Authenticator.AddPublicKey(opts)
@@ -432,6 +670,36 @@ func (b *Backend) Do(opts map[string]interface{}) error {
 		return b.Authenticator.AddMfaToken(opts)
 	case "delete_mfa_token":
 		return b.Authenticator.DeleteMfaToken(opts)
+	case "check_email_address":
+		return b.Authenticator.CheckEmailAddress(opts)
+	case "change_email_address":
+		return b.Authenticator.ChangeEmailAddress(opts)
+	case "update_profile":
+		return b.Authenticator.UpdateProfile(opts)
+	}
+	return nil
+}
+
+// checkMinPasswordAge returns an error when the user changed the current
+// password less than the minimum password age ago. It adds the time of
+// the next allowed change to the operation as "next_password_change_at".
+// The provisioned passwords are exempt, so that the users are able to
+// replace them right away.
+func (b *Backend) checkMinPasswordAge(opts map[string]interface{}, now time.Time) error {
+	if b.MinPasswordAge < 1 {
+		return nil
+	}
+	changedAt, chosen, err := b.Authenticator.GetPasswordChangeTime(opts["username"].(string))
+	if err != nil {
+		return err
+	}
+	if !chosen {
+		return nil
+	}
+	nextChangeAt := changedAt.Add(time.Duration(b.MinPasswordAge) * time.Hour)
+	if now.Before(nextChangeAt) {
+		opts["next_password_change_at"] = nextChangeAt
+		return fmt.Errorf("password was changed recently")
 	}
 	return nil
 }
@@ -456,6 +724,22 @@ func (b *Backend) GetPublicKeys(opts map[string]interface{}) ([]*identity.Public
 	return keys, nil
 }
 
+// GetProfile returns the profile fields of a user.
+func (b *Backend) GetProfile(opts map[string]interface{}) (map[string]string, error) {
+	if b.Authenticator == nil {
+		return nil, fmt.Errorf("Internal Server Error, Authentication backend is unavailable")
+	}
+	return b.Authenticator.GetProfile(opts)
+}
+
+// GetEmailAddress returns the primary email address of a user.
+func (b *Backend) GetEmailAddress(opts map[string]interface{}) (string, error) {
+	if b.Authenticator == nil {
+		return "", fmt.Errorf("Internal Server Error, Authentication backend is unavailable")
+	}
+	return b.Authenticator.GetEmailAddress(opts)
+}
+
 // GetMfaTokens return a list of MFA tokens associated with a user.
 func (b *Backend) GetMfaTokens(opts map[string]interface{}) ([]*identity.MfaToken, error) {
 	if b.Authenticator == nil {
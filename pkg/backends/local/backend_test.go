@@ -0,0 +1,129 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func newTestBackend(t *testing.T) (*Backend, func()) {
+	dir, err := ioutil.TempDir("", "local-backend")
+	if err != nil {
+		t.Fatalf("failed creating temporary directory: %s", err)
+	}
+	authenticator := NewAuthenticator()
+	authenticator.logger = utils.NewLogger()
+	authenticator.SetPath(filepath.Join(dir, "users.json"))
+	if err := authenticator.db.SaveToFile(authenticator.path); err != nil {
+		t.Fatalf("failed creating database: %s", err)
+	}
+	if err := authenticator.Configure(); err != nil {
+		t.Fatalf("failed configuring authenticator: %s", err)
+	}
+	if err := authenticator.CreateUser("jsmith", "Pa55w0rd!", "jsmith@contoso.com", nil); err != nil {
+		t.Fatalf("failed creating user: %s", err)
+	}
+	b := NewDatabaseBackend()
+	b.Authenticator = authenticator
+	b.logger = utils.NewLogger()
+	return b, func() { os.RemoveAll(dir) }
+}
+
+func TestCheckMinPasswordAge(t *testing.T) {
+	testFailed := 0
+	b, cleanup := newTestBackend(t)
+	defer cleanup()
+	user, err := b.Authenticator.db.GetUserByUsername("jsmith")
+	if err != nil {
+		t.Fatalf("failed getting user: %s", err)
+	}
+	now := time.Now()
+	tests := []struct {
+		minAge     int
+		chosen     bool
+		changedAgo time.Duration
+		shouldErr  bool
+	}{
+		{minAge: 0, chosen: true, changedAgo: time.Hour},
+		{minAge: 24, chosen: false, changedAgo: time.Hour},
+		{minAge: 24, chosen: true, changedAgo: time.Hour, shouldErr: true},
+		{minAge: 24, chosen: true, changedAgo: 24*time.Hour - time.Second, shouldErr: true},
+		{minAge: 24, chosen: true, changedAgo: 24 * time.Hour},
+		{minAge: 24, chosen: true, changedAgo: 25 * time.Hour},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, min age: %d, chosen: %t, changed ago: %s", i, test.minAge, test.chosen, test.changedAgo)
+		b.MinPasswordAge = test.minAge
+		user.Passwords[0].CreatedAt = now.Add(-test.changedAgo)
+		user.Passwords[0].Purpose = "generic"
+		if test.chosen {
+			user.Passwords[0].Purpose = chosenPasswordPurpose
+		}
+		opts := map[string]interface{}{"username": "jsmith"}
+		err := b.checkMinPasswordAge(opts, now)
+		if (err != nil) != test.shouldErr {
+			t.Logf("FAIL: %s, expected error: %t, received: %v", testDescr, test.shouldErr, err)
+			testFailed++
+			continue
+		}
+		nextChangeAt, found := opts["next_password_change_at"].(time.Time)
+		if found != test.shouldErr {
+			t.Logf("FAIL: %s, next password change time found: %t", testDescr, found)
+			testFailed++
+			continue
+		}
+		if found && !nextChangeAt.Equal(user.Passwords[0].CreatedAt.Add(24*time.Hour)) {
+			t.Logf("FAIL: %s, unexpected next password change time: %s", testDescr, nextChangeAt)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestPasswordChangeMinPasswordAge(t *testing.T) {
+	b, cleanup := newTestBackend(t)
+	defer cleanup()
+	b.MinPasswordAge = 24
+	change := func(currentPassword, newPassword string) error {
+		return b.Do(map[string]interface{}{
+			"name":             "password_change",
+			"username":         "jsmith",
+			"email":            "jsmith@contoso.com",
+			"current_password": currentPassword,
+			"new_password":     newPassword,
+		})
+	}
+	// The provisioned password is replaced right away.
+	if err := change("Pa55w0rd!", "N3wPa55w0rd!"); err != nil {
+		t.Fatalf("unexpected error changing provisioned password: %s", err)
+	}
+	if _, chosen, err := b.Authenticator.GetPasswordChangeTime("jsmith"); err != nil || !chosen {
+		t.Fatalf("changed password is not marked as chosen, error: %v", err)
+	}
+	if err := change("N3wPa55w0rd!", "An0therPa55w0rd!"); err == nil || err.Error() != "password was changed recently" {
+		t.Fatalf("unexpected result changing chosen password: %v", err)
+	}
+}
@@ -15,12 +15,13 @@
 package oauth2
 
 import (
-	"crypto/rsa"
+	"context"
 	//"encoding/base64"
 	"encoding/json"
 	"fmt"
 	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/claimsource"
 	"github.com/greenpau/caddy-auth-portal/pkg/errors"
 	"github.com/greenpau/caddy-auth-portal/pkg/utils"
 	"github.com/greenpau/go-identity"
@@ -55,20 +56,69 @@ type Backend struct {
 
 	UserRoleMapList []map[string]interface{} `json:"user_roles,omitempty"`
 
+	// The names of the nested claims, e.g. address, to flatten into
+	// dot-notation claims, e.g. address.locality.
+	FlattenClaims []string `json:"flatten_claims,omitempty"`
+
+	// The ordered sources of the claims available from both the identity
+	// token and the provider's userinfo endpoint, e.g. email. By default,
+	// the claims are taken from the identity token only.
+	ClaimSources claimsource.Priority `json:"claim_sources,omitempty"`
+
 	// The URL to OAuth 2.0 Custom Authorization Server.
 	BaseAuthURL string `json:"base_auth_url,omitempty"`
 	// The URL to OAuth 2.0 metadata related to your Custom Authorization Server.
 	MetadataURL string `json:"metadata_url,omitempty"`
 
+	// Enables RP-initiated logout, i.e. the portal logout also ends
+	// the session with the provider.
+	EnableLogout bool `json:"enable_logout,omitempty"`
+	// The URL of the provider's end session endpoint. If empty, the
+	// end_session_endpoint from the provider's metadata is used.
+	LogoutURL string `json:"logout_url,omitempty"`
+	// The URL the provider redirects users to after the logout. If
+	// empty, users return to the portal.
+	PostLogoutRedirectURL string `json:"post_logout_redirect_url,omitempty"`
+
+	// The number of times the backend retries the token and the user
+	// profile requests failed with transient errors, i.e. timeouts and
+	// 5xx responses. Zero disables the retries.
+	RetryAttempts int `json:"retry_attempts,omitempty"`
+	// The number of milliseconds the backend waits before the first
+	// retry. The backoff doubles after each retry.
+	RetryBackoff int `json:"retry_backoff,omitempty"`
+
+	// The number of seconds the authorization state and its nonce
+	// remain valid, 300 by default.
+	StateLifetime int `json:"state_lifetime,omitempty"`
+
+	// The validation of the audience of the identity token, i.e. strict
+	// (the default), aud, or off. The aud mode requires the client ID
+	// in the aud claim. The strict mode also requires the azp claim to
+	// match the client ID when the token has multiple audiences or the
+	// azp claim.
+	AudienceValidation string `json:"audience_validation,omitempty"`
+
+	// When enabled, the email_verified claim of the identity token must
+	// be true. The tokens without the claim are rejected, unless the
+	// missing claim is allowed.
+	RequireVerifiedEmail      bool `json:"require_verified_email,omitempty"`
+	AllowMissingEmailVerified bool `json:"allow_missing_email_verified,omitempty"`
+
+	// The number of seconds the JWKS keys of the provider remain fresh,
+	// 3600 by default. The keys are refreshed in background.
+	KeysTTL int `json:"keys_ttl,omitempty"`
+	// The number of seconds the stale JWKS keys remain in use when the
+	// provider is unavailable, 86400 by default.
+	KeysGracePeriod int `json:"keys_grace_period,omitempty"`
+
 	// Stores data from .well-known/openid-configuration
 	metadata               map[string]interface{}
-	keys                   map[string]*JwksKey
-	publicKeys             map[string]*rsa.PublicKey
+	keys                   *keyCache
 	authorizationURL       string
 	tokenURL               string
 	keysURL                string
-	lastKeyFetch           time.Time
-	keyFetchAttempts       int
+	userInfoURL            string
 	disableKeyVerification bool
 	disablePassGrantType   bool
 	disableResponseType    bool
@@ -91,13 +141,12 @@ func NewDatabaseBackend() *Backend {
 		Method:        "oauth2",
 		TokenProvider: jwtconfig.NewCommonTokenConfig(),
 		state:         newStateManager(),
-		keys:          make(map[string]*JwksKey),
-		publicKeys:    make(map[string]*rsa.PublicKey),
 		requiredTokenFields: map[string]interface{}{
 			"access_token": true,
 			"id_token":     true,
 		},
 	}
+	b.keys = newKeyCache(b.fetchKeys)
 	go manageStateManager(b.state)
 	return b
 }
@@ -107,6 +156,19 @@ func (b *Backend) ConfigureAuthenticator() error {
 	if b.Realm == "" {
 		return errors.ErrBackendRealmNotFound.WithArgs(b.Provider)
 	}
+	if b.StateLifetime > 0 {
+		b.state.setLifetime(time.Duration(b.StateLifetime) * time.Second)
+	}
+	if b.KeysTTL < 0 || b.KeysGracePeriod < 0 {
+		return fmt.Errorf("%s: keys_ttl and keys_grace_period must not be negative", b.Provider)
+	}
+	if b.KeysTTL == 0 {
+		b.KeysTTL = defaultKeysTTL
+	}
+	if b.KeysGracePeriod == 0 {
+		b.KeysGracePeriod = defaultKeysGracePeriod
+	}
+	b.keys.setLifetime(time.Duration(b.KeysTTL)*time.Second, time.Duration(b.KeysGracePeriod)*time.Second)
 	if b.ClientID == "" {
 		return errors.ErrBackendClientIDNotFound.WithArgs(b.Provider)
 	}
@@ -126,6 +188,24 @@ func (b *Backend) ConfigureAuthenticator() error {
 		return errors.ErrBackendInvalidIdentityTokenName.WithArgs(b.IdentityTokenName, b.Provider)
 	}
 
+	switch b.AudienceValidation {
+	case "":
+		b.AudienceValidation = "strict"
+	case "strict", "aud", "off":
+	default:
+		return fmt.Errorf("%s: audience_validation %q is unsupported", b.Provider, b.AudienceValidation)
+	}
+
+	if b.AllowMissingEmailVerified && !b.RequireVerifiedEmail {
+		return fmt.Errorf("%s: allow_missing_email_verified requires require_verified_email", b.Provider)
+	}
+	if b.RequireVerifiedEmail {
+		switch b.Provider {
+		case "github", "facebook":
+			return fmt.Errorf("%s: require_verified_email is unsupported", b.Provider)
+		}
+	}
+
 	switch b.Provider {
 	case "okta":
 		if b.ServerID == "" {
@@ -200,10 +280,21 @@ func (b *Backend) ConfigureAuthenticator() error {
 		}
 	}
 
+	if b.EnableLogout && b.LogoutURL == "" {
+		return errors.ErrBackendOauthLogoutURLNotFound.WithArgs(b.Provider)
+	}
+
+	if err := b.configureClaimSources(); err != nil {
+		return err
+	}
+
 	if !b.disableKeyVerification {
-		if err := b.fetchKeysURL(); err != nil {
+		if err := b.keys.refresh(); err != nil {
 			return errors.ErrBackendOauthKeyFetchFailed.WithArgs(err)
 		}
+		if b.keys.startRefresh() {
+			go b.manageKeys()
+		}
 	}
 
 	b.logger.Info(
@@ -213,7 +304,7 @@ func (b *Backend) ConfigureAuthenticator() error {
 		zap.String("server_id", b.ServerID),
 		zap.String("domain_name", b.DomainName),
 		zap.Any("metadata", b.metadata),
-		zap.Any("jwks_keys", b.keys),
+		zap.Strings("jwks_key_ids", b.keys.getKeyIDs()),
 	)
 
 	return nil
@@ -270,14 +361,17 @@ func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interfac
 			} else {
 				return resp, errors.ErrBackendOauthAuthorizationStateNotFound
 			}
+			// The state and its nonce are single-use, regardless of the
+			// outcome of the callback.
+			defer b.state.del(reqParamsState)
 			reqRedirectURI := utils.GetCurrentBaseURL(r) + reqPath + "/authorization-code-callback"
 			var accessToken map[string]interface{}
 			var err error
 			switch b.Provider {
 			case "facebook":
-				accessToken, err = b.fetchFacebookAccessToken(reqRedirectURI, reqParamsState, reqParamsCode)
+				accessToken, err = b.fetchFacebookAccessToken(r.Context(), reqRedirectURI, reqParamsState, reqParamsCode)
 			default:
-				accessToken, err = b.fetchAccessToken(reqRedirectURI, reqParamsState, reqParamsCode)
+				accessToken, err = b.fetchAccessToken(r.Context(), reqRedirectURI, reqParamsState, reqParamsCode)
 			}
 			if err != nil {
 				return resp, errors.ErrBackendOauthFetchAccessTokenFailed.WithArgs(err)
@@ -289,22 +383,41 @@ func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interfac
 			)
 
 			var claims *jwtclaims.UserClaims
+			var customClaims map[string]interface{}
 			switch b.Provider {
 			case "github", "facebook":
-				claims, err = b.fetchClaims(accessToken)
+				claims, err = b.fetchClaims(r.Context(), accessToken)
 				if err != nil {
 					return resp, errors.ErrBackendOauthFetchClaimsFailed.WithArgs(err)
 				}
 			default:
-				claims, err = b.validateAccessToken(reqParamsState, accessToken)
+				claims, customClaims, err = b.validateAccessToken(reqParamsState, accessToken)
+				if err == errEmailNotVerified {
+					resp["code"] = 403
+					resp["message"] = "Your email address is not verified by the identity provider. Please verify it and sign in again."
+				}
 				if err != nil {
 					return resp, errors.ErrBackendOauthValidateAccessTokenFailed.WithArgs(err)
 				}
+				if err := b.resolveClaimSources(r.Context(), claims, accessToken); err != nil {
+					return resp, errors.ErrBackendOauthFetchClaimsFailed.WithArgs(err)
+				}
 			}
 
 			// Add additional roles, if necessary
 			b.supplementClaims(claims)
 			resp["claims"] = claims
+			if v := b.state.getRedirect(reqParamsState); v != "" {
+				resp["login_redirect_url"] = v
+			}
+			if customClaims != nil {
+				resp["custom_claims"] = customClaims
+			}
+			if v, exists := accessToken["id_token"]; exists && b.EnableLogout {
+				if idToken, ok := v.(string); ok {
+					resp["id_token"] = idToken
+				}
+			}
 			b.logger.Debug(
 				"received OAuth 2.0 authorization server access token",
 				zap.String("request_id", reqID),
@@ -335,6 +448,9 @@ func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interfac
 	params.Set("client_id", b.ClientID)
 	resp["redirect_url"] = b.authorizationURL + "?" + params.Encode()
 	b.state.add(state, nonce)
+	if v, ok := opts["login_redirect_url"].(string); ok && v != "" {
+		b.state.addRedirect(state, v)
+	}
 	b.logger.Debug(
 		"redirecting to OAuth 2.0 endpoint",
 		zap.String("request_id", reqID),
@@ -420,70 +536,73 @@ func (b *Backend) fetchMetadataURL() error {
 	b.authorizationURL = b.metadata["authorization_endpoint"].(string)
 	b.tokenURL = b.metadata["token_endpoint"].(string)
 	b.keysURL = b.metadata["jwks_uri"].(string)
+	if v, exists := b.metadata["end_session_endpoint"]; exists && b.LogoutURL == "" {
+		if endSessionURL, ok := v.(string); ok {
+			b.LogoutURL = endSessionURL
+		}
+	}
 	return nil
 }
 
-func (b *Backend) countFetchKeysAttempt() {
-	b.lastKeyFetch = time.Now().UTC()
-	b.keyFetchAttempts++
-	return
-}
-
-func (b *Backend) fetchKeysURL() error {
-	if b.keyFetchAttempts > 3 {
-		timeDiff := time.Now().UTC().Sub(b.lastKeyFetch).Minutes()
-		if timeDiff < 5 {
-			return errors.ErrBackendOauthJwksKeysTooManyAttempts
-		}
-		b.lastKeyFetch = time.Now().UTC()
-		b.keyFetchAttempts = 0
-	}
-	b.countFetchKeysAttempt()
+// fetchKeys returns the JWKS keys of the provider.
+func (b *Backend) fetchKeys() ([]*JwksKey, error) {
 	resp, err := http.Get(b.keysURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	respBody, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	data := make(map[string]interface{})
 
 	if err := json.Unmarshal(respBody, &data); err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, exists := data["keys"]; !exists {
-		return errors.ErrBackendOauthJwksResponseKeysNotFound
+		return nil, errors.ErrBackendOauthJwksResponseKeysNotFound
 	}
 
 	jwksJSON, err := json.Marshal(data["keys"])
 	if err != nil {
-		return errors.ErrBackendOauthJwksKeysParseFailed.WithArgs(err)
+		return nil, errors.ErrBackendOauthJwksKeysParseFailed.WithArgs(err)
 	}
 
 	keys := []*JwksKey{}
 	if err := json.Unmarshal(jwksJSON, &keys); err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(keys) < 1 {
-		return errors.ErrBackendOauthJwksKeysNotFound
+		return nil, errors.ErrBackendOauthJwksKeysNotFound
 	}
 
 	for _, k := range keys {
 		if err := k.Validate(); err != nil {
-			return errors.ErrBackendOauthJwksInvalidKey.WithArgs(err)
+			return nil, errors.ErrBackendOauthJwksInvalidKey.WithArgs(err)
 		}
-		b.keys[k.KeyID] = k
-		b.publicKeys[k.KeyID] = k.publicKey
 	}
 
-	return nil
+	return keys, nil
 }
 
-func (b *Backend) fetchAccessToken(redirectURI, state, code string) (map[string]interface{}, error) {
+// manageKeys refreshes the JWKS keys before they become stale.
+func (b *Backend) manageKeys() {
+	for {
+		time.Sleep(b.keys.nextRefresh())
+		if err := b.keys.refresh(); err != nil {
+			b.logger.Warn(
+				"failed refreshing jwks keys",
+				zap.String("provider", b.Provider),
+				zap.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+func (b *Backend) fetchAccessToken(ctx context.Context, redirectURI, state, code string) (map[string]interface{}, error) {
 	params := url.Values{}
 	params.Set("client_id", b.ClientID)
 	params.Set("client_secret", b.ClientSecret)
@@ -503,7 +622,7 @@ func (b *Backend) fetchAccessToken(redirectURI, state, code string) (map[string]
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", b.tokenURL, strings.NewReader(params.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", b.tokenURL, strings.NewReader(params.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -516,7 +635,7 @@ func (b *Backend) fetchAccessToken(redirectURI, state, code string) (map[string]
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Content-Length", strconv.Itoa(len(params.Encode())))
 
-	resp, err := cli.Do(req)
+	resp, err := b.doRequest(cli, req)
 	if err != nil {
 		return nil, err
 	}
@@ -640,7 +759,7 @@ func newBrowser() (*http.Client, error) {
 	}, nil
 }
 
-func (b *Backend) fetchFacebookAccessToken(redirectURI, state, code string) (map[string]interface{}, error) {
+func (b *Backend) fetchFacebookAccessToken(ctx context.Context, redirectURI, state, code string) (map[string]interface{}, error) {
 	params := url.Values{}
 	params.Set("client_id", b.ClientID)
 	params.Set("client_secret", b.ClientSecret)
@@ -656,7 +775,7 @@ func (b *Backend) fetchFacebookAccessToken(redirectURI, state, code string) (map
 		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", b.tokenURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", b.tokenURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -668,7 +787,7 @@ func (b *Backend) fetchFacebookAccessToken(redirectURI, state, code string) (map
 		req.Header.Set("Accept", "application/json")
 	}
 
-	resp, err := cli.Do(req)
+	resp, err := b.doRequest(cli, req)
 	if err != nil {
 		return nil, err
 	}
@@ -707,6 +826,32 @@ func (b *Backend) fetchFacebookAccessToken(redirectURI, state, code string) (map
 	return data, nil
 }
 
+// GetLogoutURL returns the URL of the provider's end session endpoint
+// with the id_token_hint and post_logout_redirect_uri parameters. The URL
+// is empty when the logout is disabled.
+func (b *Backend) GetLogoutURL(opts map[string]interface{}) (string, error) {
+	if !b.EnableLogout {
+		return "", nil
+	}
+	params := url.Values{}
+	if v, exists := opts["id_token"]; exists {
+		params.Set("id_token_hint", v.(string))
+	}
+	if b.PostLogoutRedirectURL != "" {
+		params.Set("post_logout_redirect_uri", b.PostLogoutRedirectURL)
+	} else if v, exists := opts["post_logout_redirect_uri"]; exists {
+		params.Set("post_logout_redirect_uri", v.(string))
+	}
+	params.Set("client_id", b.ClientID)
+	logoutURL := b.LogoutURL
+	if strings.Contains(logoutURL, "?") {
+		logoutURL += "&" + params.Encode()
+	} else {
+		logoutURL += "?" + params.Encode()
+	}
+	return logoutURL, nil
+}
+
 // Do performs the requested operation.
 func (b *Backend) Do(opts map[string]interface{}) error {
 	op := opts["name"].(string)
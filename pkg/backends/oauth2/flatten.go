@@ -0,0 +1,62 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"go.uber.org/zap"
+)
+
+// flattenClaims returns the claims configured via FlattenClaims with
+// their nested objects flattened into dot-notation keys, e.g. the
+// "locality" field of the "address" claim becomes "address.locality".
+// The configured claims that are not objects are skipped.
+func (b *Backend) flattenClaims(tokenClaims map[string]interface{}) map[string]interface{} {
+	if len(b.FlattenClaims) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{})
+	for _, claimName := range b.FlattenClaims {
+		v, exists := tokenClaims[claimName]
+		if !exists {
+			continue
+		}
+		nestedClaims, ok := v.(map[string]interface{})
+		if !ok {
+			b.logger.Warn(
+				"skipped flattening of non-object claim",
+				zap.String("claim_name", claimName),
+			)
+			continue
+		}
+		for k, nv := range nestedClaims {
+			flattenClaim(m, claimName+"."+k, nv)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+func flattenClaim(m map[string]interface{}, prefix string, v interface{}) {
+	switch v.(type) {
+	case map[string]interface{}:
+		for k, nv := range v.(map[string]interface{}) {
+			flattenClaim(m, prefix+"."+k, nv)
+		}
+	default:
+		m[prefix] = v
+	}
+}
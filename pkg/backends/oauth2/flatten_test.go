@@ -0,0 +1,95 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"fmt"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"reflect"
+	"testing"
+)
+
+func TestFlattenClaims(t *testing.T) {
+	testFailed := 0
+	tokenClaims := map[string]interface{}{
+		"email": "jsmith@contoso.com",
+		"address": map[string]interface{}{
+			"locality": "New York",
+			"country":  "US",
+		},
+		"ext": map[string]interface{}{
+			"org": map[string]interface{}{
+				"id": "1234",
+			},
+		},
+	}
+	tests := []struct {
+		flatten []string
+		result  map[string]interface{}
+	}{
+		{
+			flatten: nil,
+			result:  nil,
+		},
+		{
+			flatten: []string{"phone_number"},
+			result:  nil,
+		},
+		{
+			flatten: []string{"email"},
+			result:  nil,
+		},
+		{
+			flatten: []string{"email", "address"},
+			result: map[string]interface{}{
+				"address.locality": "New York",
+				"address.country":  "US",
+			},
+		},
+		{
+			flatten: []string{"address"},
+			result: map[string]interface{}{
+				"address.locality": "New York",
+				"address.country":  "US",
+			},
+		},
+		{
+			flatten: []string{"address", "ext"},
+			result: map[string]interface{}{
+				"address.locality": "New York",
+				"address.country":  "US",
+				"ext.org.id":       "1234",
+			},
+		},
+	}
+	for i, test := range tests {
+		b := &Backend{
+			FlattenClaims: test.flatten,
+			logger:        utils.NewLogger(),
+		}
+		testDescr := fmt.Sprintf("Test %d, flatten: %v", i, test.flatten)
+		m := b.flattenClaims(tokenClaims)
+		if !reflect.DeepEqual(m, test.result) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.result, m)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/errors"
+)
+
+const (
+	// defaultKeysTTL is the number of seconds the fetched JWKS keys
+	// remain fresh.
+	defaultKeysTTL = 3600
+	// defaultKeysGracePeriod is the number of seconds the stale JWKS
+	// keys remain in use when the provider is unavailable.
+	defaultKeysGracePeriod = 86400
+	// minKeysRefreshInterval is the minimum time between the fetches
+	// triggered by the lookups, e.g. of the tokens signed with unknown
+	// keys.
+	minKeysRefreshInterval = 10 * time.Second
+	// keysRetryInterval is the time the background refresh waits after
+	// a failed fetch.
+	keysRetryInterval = time.Minute
+)
+
+// keyFetch is an in-flight fetch of the JWKS keys. The concurrent
+// lookups wait for it rather than fetching the keys again.
+type keyFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// keyCache holds the JWKS keys of the provider. The keys are fresh for
+// the TTL, and are refreshed in background. When the provider is
+// unavailable, the stale keys are used for the grace period.
+type keyCache struct {
+	mux        sync.RWMutex
+	keys       map[string]*JwksKey
+	fetchedAt  time.Time
+	lastFetch  time.Time
+	ttl        time.Duration
+	grace      time.Duration
+	fetch      func() ([]*JwksKey, error)
+	inflight   *keyFetch
+	refreshing bool
+}
+
+func newKeyCache(fetch func() ([]*JwksKey, error)) *keyCache {
+	return &keyCache{
+		keys:  make(map[string]*JwksKey),
+		ttl:   time.Duration(defaultKeysTTL) * time.Second,
+		grace: time.Duration(defaultKeysGracePeriod) * time.Second,
+		fetch: fetch,
+	}
+}
+
+func (c *keyCache) setLifetime(ttl, grace time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.ttl = ttl
+	c.grace = grace
+}
+
+// get returns the public key having the key id. It fetches the keys
+// when the key is unknown, e.g. after the provider rotated its keys,
+// or when the keys are past the grace period.
+func (c *keyCache) get(keyID string) (*rsa.PublicKey, error) {
+	c.mux.RLock()
+	k, found := c.keys[keyID]
+	usable := time.Since(c.fetchedAt) <= c.ttl+c.grace
+	throttled := time.Since(c.lastFetch) < minKeysRefreshInterval
+	c.mux.RUnlock()
+	if found && usable {
+		return k.publicKey, nil
+	}
+	if throttled {
+		return nil, errors.ErrBackendOauthJwksKeysTooManyAttempts
+	}
+	if err := c.refresh(); err != nil {
+		return nil, errors.ErrBackendOauthKeyFetchFailed.WithArgs(err)
+	}
+	c.mux.RLock()
+	k, found = c.keys[keyID]
+	c.mux.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("the supplied kid not found in jwks public keys: %s", keyID)
+	}
+	return k.publicKey, nil
+}
+
+// refresh fetches the keys and replaces the cached ones. The concurrent
+// callers share a single fetch. On failure, the cached keys remain.
+func (c *keyCache) refresh() error {
+	c.mux.Lock()
+	if f := c.inflight; f != nil {
+		c.mux.Unlock()
+		<-f.done
+		return f.err
+	}
+	f := &keyFetch{done: make(chan struct{})}
+	c.inflight = f
+	c.mux.Unlock()
+
+	keys, err := c.fetch()
+
+	c.mux.Lock()
+	now := time.Now()
+	c.lastFetch = now
+	if err == nil {
+		c.keys = make(map[string]*JwksKey)
+		for _, k := range keys {
+			c.keys[k.KeyID] = k
+		}
+		c.fetchedAt = now
+	}
+	c.inflight = nil
+	c.mux.Unlock()
+
+	f.err = err
+	close(f.done)
+	return err
+}
+
+// nextRefresh returns the time until the keys become stale, or the
+// retry interval when they are stale already.
+func (c *keyCache) nextRefresh() time.Duration {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	wait := c.ttl - time.Since(c.fetchedAt)
+	if wait <= 0 {
+		return keysRetryInterval
+	}
+	return wait
+}
+
+// startRefresh returns false when the background refresh has started
+// already.
+func (c *keyCache) startRefresh() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.refreshing {
+		return false
+	}
+	c.refreshing = true
+	return true
+}
+
+func (c *keyCache) getKeyIDs() []string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	var keyIDs []string
+	for keyID := range c.keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs
+}
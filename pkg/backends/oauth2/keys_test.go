@@ -0,0 +1,134 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyCache(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		name      string
+		keyIDs    []string
+		fetchErr  bool
+		fetchedAt time.Duration
+		lastFetch time.Duration
+		keyID     string
+		fetches   int32
+		found     bool
+	}{
+		{
+			name:      "fresh key",
+			keyIDs:    []string{"1"},
+			fetchedAt: time.Minute,
+			lastFetch: time.Minute,
+			keyID:     "1",
+			found:     true,
+		},
+		{
+			name:      "unknown key after rotation",
+			keyIDs:    []string{"1", "2"},
+			fetchedAt: time.Minute,
+			lastFetch: time.Minute,
+			keyID:     "2",
+			fetches:   1,
+			found:     true,
+		},
+		{
+			name:      "unknown key fetch throttled",
+			keyIDs:    []string{"1", "2"},
+			fetchedAt: time.Second,
+			lastFetch: time.Second,
+			keyID:     "2",
+		},
+		{
+			name:      "stale key within grace period",
+			keyIDs:    []string{"1"},
+			fetchErr:  true,
+			fetchedAt: 2 * time.Hour,
+			lastFetch: time.Minute,
+			keyID:     "1",
+			found:     true,
+		},
+		{
+			name:      "stale key past grace period",
+			keyIDs:    []string{"1"},
+			fetchErr:  true,
+			fetchedAt: 48 * time.Hour,
+			lastFetch: time.Minute,
+			keyID:     "1",
+			fetches:   1,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.name)
+		var fetches int32
+		c := newKeyCache(func() ([]*JwksKey, error) {
+			atomic.AddInt32(&fetches, 1)
+			time.Sleep(10 * time.Millisecond)
+			if test.fetchErr {
+				return nil, fmt.Errorf("provider unavailable")
+			}
+			var keys []*JwksKey
+			for _, keyID := range test.keyIDs {
+				keys = append(keys, &JwksKey{KeyID: keyID})
+			}
+			return keys, nil
+		})
+		c.keys["1"] = &JwksKey{KeyID: "1"}
+		c.fetchedAt = time.Now().Add(-test.fetchedAt)
+		c.lastFetch = time.Now().Add(-test.lastFetch)
+
+		// The concurrent lookups share a single fetch.
+		var wg sync.WaitGroup
+		errs := make([]error, 5)
+		for j := range errs {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				_, errs[j] = c.get(test.keyID)
+			}(j)
+		}
+		wg.Wait()
+
+		if fetches != test.fetches {
+			t.Logf("FAIL: %s, fetches: %d (expected) vs. %d (received)", testDescr, test.fetches, fetches)
+			testFailed++
+			continue
+		}
+		failed := false
+		for _, err := range errs {
+			if (err == nil) != test.found {
+				t.Logf("FAIL: %s, found: %t (expected), error: %v", testDescr, test.found, err)
+				failed = true
+				break
+			}
+		}
+		if failed {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetLogoutURL(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		backend  *Backend
+		opts     map[string]interface{}
+		expected string
+	}{
+		{
+			backend: &Backend{
+				ClientID:  "foo",
+				LogoutURL: "https://idp.contoso.com/logout",
+			},
+			expected: "",
+		},
+		{
+			backend: &Backend{
+				ClientID:     "foo",
+				EnableLogout: true,
+				LogoutURL:    "https://idp.contoso.com/logout",
+			},
+			opts: map[string]interface{}{
+				"id_token":                 "bar",
+				"post_logout_redirect_uri": "https://auth.contoso.com/auth",
+			},
+			expected: "https://idp.contoso.com/logout?client_id=foo&id_token_hint=bar&post_logout_redirect_uri=https%3A%2F%2Fauth.contoso.com%2Fauth",
+		},
+		{
+			backend: &Backend{
+				ClientID:              "foo",
+				EnableLogout:          true,
+				LogoutURL:             "https://idp.contoso.com/logout?tenant=1",
+				PostLogoutRedirectURL: "https://www.contoso.com/",
+			},
+			opts: map[string]interface{}{
+				"post_logout_redirect_uri": "https://auth.contoso.com/auth",
+			},
+			expected: "https://idp.contoso.com/logout?tenant=1&client_id=foo&post_logout_redirect_uri=https%3A%2F%2Fwww.contoso.com%2F",
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, opts: %v", i, test.opts)
+		logoutURL, err := test.backend.GetLogoutURL(test.opts)
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if logoutURL != test.expected {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, test.expected, logoutURL)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultRetryBackoff is the default number of milliseconds the backend
+// waits before the first retry.
+const defaultRetryBackoff = 500
+
+// isRetryable returns true when the request to the provider failed with
+// a transient error, i.e. a timeout or a server-side error. The client
+// errors, e.g. an invalid authorization code, are not retried.
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		netErr, ok := err.(net.Error)
+		return ok && netErr.Timeout()
+	}
+	return resp.StatusCode >= 500
+}
+
+// doRequest sends the request to the provider. When retries are enabled,
+// it retries the requests failed with transient errors, doubling the
+// backoff after each attempt. The retries stop when the context of the
+// request is canceled, e.g. the user closed the browser.
+func (b *Backend) doRequest(cli *http.Client, req *http.Request) (*http.Response, error) {
+	backoff := time.Duration(b.RetryBackoff) * time.Millisecond
+	if backoff == 0 {
+		backoff = defaultRetryBackoff * time.Millisecond
+	}
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+		resp, err := cli.Do(attemptReq)
+		if attempt >= b.RetryAttempts || !isRetryable(resp, err) {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		b.logger.Warn(
+			"retrying failed OAuth 2.0 provider request",
+			zap.String("url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+		)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"fmt"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDoRequest(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		name          string
+		statusCodes   []int
+		retryAttempts int
+		status        int
+		requests      int
+	}{
+		{
+			name:        "retries disabled",
+			statusCodes: []int{503, 200},
+			status:      503,
+			requests:    1,
+		},
+		{
+			name:          "retry after server error",
+			statusCodes:   []int{503, 502, 200},
+			retryAttempts: 3,
+			status:        200,
+			requests:      3,
+		},
+		{
+			name:          "retries exhausted",
+			statusCodes:   []int{503, 503, 503},
+			retryAttempts: 2,
+			status:        503,
+			requests:      3,
+		},
+		{
+			name:          "client error is not retried",
+			statusCodes:   []int{400, 200},
+			retryAttempts: 3,
+			status:        400,
+			requests:      1,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.name)
+		var requests int
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			bodies = append(bodies, r.Form.Get("code"))
+			w.WriteHeader(test.statusCodes[requests])
+			requests++
+		}))
+		b := &Backend{
+			RetryAttempts: test.retryAttempts,
+			RetryBackoff:  1,
+			logger:        utils.NewLogger(),
+		}
+		req, err := http.NewRequest("POST", server.URL, strings.NewReader("code=foo"))
+		if err != nil {
+			t.Fatalf("failed creating request: %s", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := b.doRequest(server.Client(), req)
+		server.Close()
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status || requests != test.requests {
+			t.Logf("FAIL: %s, expected: %d status after %d requests, received: %d status after %d requests",
+				testDescr, test.status, test.requests, resp.StatusCode, requests)
+			testFailed++
+			continue
+		}
+		for _, body := range bodies {
+			if body != "foo" {
+				t.Logf("FAIL: %s, request body was not resent: %v", testDescr, bodies)
+				testFailed++
+				break
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
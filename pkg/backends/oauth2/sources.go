@@ -0,0 +1,153 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	claimSourceIDToken  = "id_token"
+	claimSourceUserInfo = "userinfo"
+)
+
+// defaultClaimSourceOrder is the order of the claim sources when the
+// priority of a claim is not configured.
+var defaultClaimSourceOrder = []string{claimSourceIDToken, claimSourceUserInfo}
+
+// supportedClaimSources holds the claims resolvable by their sources.
+var supportedClaimSources = map[string][]string{
+	"email": {claimSourceIDToken, claimSourceUserInfo},
+	"name":  {claimSourceIDToken, claimSourceUserInfo},
+}
+
+func (b *Backend) configureClaimSources() error {
+	if len(b.ClaimSources) == 0 {
+		return nil
+	}
+	if b.disableKeyVerification {
+		return fmt.Errorf("%s: claim sources are supported by OpenID Connect providers only", b.Provider)
+	}
+	if err := b.ClaimSources.Validate(supportedClaimSources); err != nil {
+		return fmt.Errorf("%s: %s", b.Provider, err)
+	}
+	if !b.ClaimSources.Has(claimSourceUserInfo) {
+		return nil
+	}
+	if v, ok := b.metadata["userinfo_endpoint"].(string); ok {
+		b.userInfoURL = v
+	}
+	if b.userInfoURL == "" {
+		return fmt.Errorf("%s: userinfo claim source requires userinfo_endpoint in provider metadata", b.Provider)
+	}
+	return nil
+}
+
+// resolveClaimSources fetches the user profile from the userinfo
+// endpoint and resolves the claims present in both the identity token
+// and the profile according to the configured priority.
+func (b *Backend) resolveClaimSources(ctx context.Context, claims *jwtclaims.UserClaims, tokenData map[string]interface{}) error {
+	if !b.ClaimSources.Has(claimSourceUserInfo) {
+		return nil
+	}
+	userInfo, err := b.fetchUserInfo(ctx, tokenData)
+	if err != nil {
+		return err
+	}
+	// The userinfo response is about the user authenticated by the
+	// identity token only when the subjects match.
+	if sub, ok := userInfo["sub"].(string); !ok || sub != claims.Subject {
+		return fmt.Errorf("userinfo sub claim does not match identity token subject")
+	}
+	b.applyClaimSources(claims, userInfo)
+	if claims.Email == "" {
+		return fmt.Errorf("email claim not found")
+	}
+	if claims.Subject == "" {
+		claims.Subject = claims.Email
+	}
+	return nil
+}
+
+// applyClaimSources sets the claims to the values from the highest
+// priority sources.
+func (b *Backend) applyClaimSources(claims *jwtclaims.UserClaims, userInfo map[string]interface{}) {
+	for _, claimName := range []string{"email", "name"} {
+		values := make(map[string]string)
+		switch claimName {
+		case "email":
+			values[claimSourceIDToken] = claims.Email
+		case "name":
+			values[claimSourceIDToken] = claims.Name
+		}
+		if v, ok := userInfo[claimName].(string); ok {
+			values[claimSourceUserInfo] = v
+		}
+		value, source := b.ClaimSources.Resolve(claimName, defaultClaimSourceOrder, values)
+		if values[claimSourceIDToken] != "" && values[claimSourceUserInfo] != "" && values[claimSourceIDToken] != values[claimSourceUserInfo] {
+			b.logger.Debug(
+				"resolved conflicting claim sources",
+				zap.String("claim_name", claimName),
+				zap.String("source", source),
+			)
+		}
+		switch claimName {
+		case "email":
+			claims.Email = value
+		case "name":
+			claims.Name = value
+		}
+	}
+}
+
+func (b *Backend) fetchUserInfo(ctx context.Context, tokenData map[string]interface{}) (map[string]interface{}, error) {
+	tokenString, ok := tokenData["access_token"].(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no access_token field")
+	}
+	cli, err := newBrowser()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", b.userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	resp, err := b.doRequest(cli, req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint returned status code %d", resp.StatusCode)
+	}
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
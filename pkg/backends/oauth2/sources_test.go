@@ -0,0 +1,127 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/claimsource"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClaimSources(t *testing.T) {
+	testFailed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"sub":"00u1","email":"john.smith@contoso.com","name":""}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		sources    claimsource.Priority
+		subject    string
+		email      string
+		fullName   string
+		shouldFail bool
+	}{
+		{
+			name:     "default priority keeps identity token claims",
+			subject:  "00u1",
+			email:    "jsmith@contoso.com",
+			fullName: "John Smith",
+		},
+		{
+			name:     "userinfo email wins over identity token email",
+			sources:  claimsource.Priority{"email": {"userinfo", "id_token"}},
+			subject:  "00u1",
+			email:    "john.smith@contoso.com",
+			fullName: "John Smith",
+		},
+		{
+			name:     "identity token email wins over userinfo email",
+			sources:  claimsource.Priority{"email": {"id_token", "userinfo"}},
+			subject:  "00u1",
+			email:    "jsmith@contoso.com",
+			fullName: "John Smith",
+		},
+		{
+			name:     "empty userinfo name falls back to identity token",
+			sources:  claimsource.Priority{"name": {"userinfo", "id_token"}},
+			subject:  "00u1",
+			email:    "jsmith@contoso.com",
+			fullName: "John Smith",
+		},
+		{
+			name:     "userinfo only name is cleared when absent",
+			sources:  claimsource.Priority{"name": {"userinfo"}},
+			subject:  "00u1",
+			email:    "jsmith@contoso.com",
+			fullName: "",
+		},
+		{
+			name:       "userinfo of another subject is rejected",
+			sources:    claimsource.Priority{"email": {"userinfo", "id_token"}},
+			subject:    "00u2",
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.name)
+		b := &Backend{
+			ClaimSources: test.sources,
+			userInfoURL:  server.URL,
+			logger:       utils.NewLogger(),
+		}
+		claims := &jwtclaims.UserClaims{
+			Subject: test.subject,
+			Email:   "jsmith@contoso.com",
+			Name:    "John Smith",
+		}
+		err := b.resolveClaimSources(context.Background(), claims, map[string]interface{}{"access_token": "foo"})
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+			} else {
+				t.Logf("PASS: %s, error: %s", testDescr, err)
+			}
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if claims.Email != test.email || claims.Name != test.fullName {
+			t.Logf("FAIL: %s, expected: %s/%s, received: %s/%s", testDescr, test.email, test.fullName, claims.Email, claims.Name)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -15,28 +15,43 @@
 package oauth2
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// defaultStateLifetime is the number of seconds the authorization
+// state and its nonce remain valid.
+const defaultStateLifetime = 300
+
 type stateManager struct {
-	mux    sync.Mutex
-	nonces map[string]string
-	states map[string]time.Time
-	codes  map[string]string
-	status map[string]interface{}
+	mux       sync.Mutex
+	nonces    map[string]string
+	states    map[string]time.Time
+	codes     map[string]string
+	status    map[string]interface{}
+	redirects map[string]string
+	lifetime  time.Duration
 }
 
 func newStateManager() *stateManager {
 	return &stateManager{
-		nonces: make(map[string]string),
-		states: make(map[string]time.Time),
-		codes:  make(map[string]string),
-		status: make(map[string]interface{}),
+		nonces:    make(map[string]string),
+		states:    make(map[string]time.Time),
+		codes:     make(map[string]string),
+		status:    make(map[string]interface{}),
+		redirects: make(map[string]string),
+		lifetime:  time.Duration(defaultStateLifetime) * time.Second,
 	}
 }
 
+func (sm *stateManager) setLifetime(lifetime time.Duration) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.lifetime = lifetime
+}
+
 func (sm *stateManager) add(state, nonce string) {
 	sm.mux.Lock()
 	defer sm.mux.Unlock()
@@ -51,13 +66,15 @@ func (sm *stateManager) del(state string) {
 	delete(sm.states, state)
 	delete(sm.codes, state)
 	delete(sm.status, state)
+	delete(sm.redirects, state)
 }
 
+// exists returns true when the state was issued and has not expired.
 func (sm *stateManager) exists(state string) bool {
 	sm.mux.Lock()
 	defer sm.mux.Unlock()
-	if _, exists := sm.states[state]; exists {
-		return true
+	if ts, exists := sm.states[state]; exists {
+		return time.Since(ts) <= sm.lifetime
 	}
 	return false
 }
@@ -69,12 +86,29 @@ func (sm *stateManager) validateNonce(state, nonce string) error {
 	if !exists {
 		return fmt.Errorf("no nonce found for %s", state)
 	}
-	if v != nonce {
+	if ts := sm.states[state]; time.Since(ts) > sm.lifetime {
+		return fmt.Errorf("nonce for %s expired", state)
+	}
+	if subtle.ConstantTimeCompare([]byte(v), []byte(nonce)) != 1 {
 		return fmt.Errorf("nonce mismatch %s (expected) vs. %s (received)", v, nonce)
 	}
 	return nil
 }
 
+// addRedirect stores the URL the user is redirected to after the login,
+// so that it survives the round trip to the provider.
+func (sm *stateManager) addRedirect(state, redirectURL string) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.redirects[state] = redirectURL
+}
+
+func (sm *stateManager) getRedirect(state string) string {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	return sm.redirects[state]
+}
+
 func (sm *stateManager) addCode(state, code string) {
 	sm.mux.Lock()
 	defer sm.mux.Unlock()
@@ -92,11 +126,11 @@ func manageStateManager(sm *stateManager) {
 		for state, ts := range sm.states {
 			deleteState := false
 			if _, exists := sm.status[state]; !exists {
-				if ts.Sub(now).Minutes() > 5 {
+				if now.Sub(ts) > sm.lifetime {
 					deleteState = true
 				}
 			} else {
-				if ts.Sub(now).Hours() > 12 {
+				if now.Sub(ts).Hours() > 12 {
 					deleteState = true
 				}
 			}
@@ -105,6 +139,7 @@ func manageStateManager(sm *stateManager) {
 				delete(sm.states, state)
 				delete(sm.codes, state)
 				delete(sm.status, state)
+				delete(sm.redirects, state)
 			}
 		}
 		sm.mux.Unlock()
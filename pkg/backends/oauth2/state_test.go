@@ -0,0 +1,85 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidateNonce(t *testing.T) {
+	testFailed := 0
+	sm := newStateManager()
+	sm.add("valid", "abc")
+	sm.add("expired", "abc")
+	sm.states["expired"] = time.Now().Add(-10 * time.Minute)
+	sm.add("consumed", "abc")
+	sm.del("consumed")
+
+	tests := []struct {
+		state      string
+		nonce      string
+		shouldFail bool
+	}{
+		{state: "valid", nonce: "abc"},
+		{state: "valid", nonce: "abd", shouldFail: true},
+		{state: "valid", nonce: "", shouldFail: true},
+		{state: "expired", nonce: "abc", shouldFail: true},
+		{state: "consumed", nonce: "abc", shouldFail: true},
+		{state: "unknown", nonce: "abc", shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, state: %s, nonce: %s", i, test.state, test.nonce)
+		err := sm.validateNonce(test.state, test.nonce)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if sm.exists("expired") {
+		t.Logf("FAIL: expired state exists")
+		testFailed++
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestStateRedirect(t *testing.T) {
+	sm := newStateManager()
+	sm.add("abc", "nonce")
+	sm.addRedirect("abc", "https://app.contoso.com/dashboard")
+	if v := sm.getRedirect("abc"); v != "https://app.contoso.com/dashboard" {
+		t.Fatalf("unexpected redirect url: %s", v)
+	}
+	if v := sm.getRedirect("unknown"); v != "" {
+		t.Fatalf("unexpected redirect url for unknown state: %s", v)
+	}
+	sm.del("abc")
+	if v := sm.getRedirect("abc"); v != "" {
+		t.Fatalf("unexpected redirect url after the state removal: %s", v)
+	}
+}
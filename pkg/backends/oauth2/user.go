@@ -15,6 +15,7 @@
 package oauth2
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -30,7 +31,7 @@ import (
 	"time"
 )
 
-func (b *Backend) fetchClaims(tokenData map[string]interface{}) (*jwtclaims.UserClaims, error) {
+func (b *Backend) fetchClaims(ctx context.Context, tokenData map[string]interface{}) (*jwtclaims.UserClaims, error) {
 	var userURL string
 	var req *http.Request
 	var err error
@@ -51,7 +52,7 @@ func (b *Backend) fetchClaims(tokenData map[string]interface{}) (*jwtclaims.User
 	switch b.Provider {
 	case "github":
 		userURL = "https://api.github.com/user"
-		req, err = http.NewRequest("GET", userURL, nil)
+		req, err = http.NewRequestWithContext(ctx, "GET", userURL, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -65,7 +66,7 @@ func (b *Backend) fetchClaims(tokenData map[string]interface{}) (*jwtclaims.User
 		params.Set("fields", "id,first_name,last_name,name,email")
 		params.Set("access_token", tokenString)
 		params.Set("appsecret_proof", appSecretProof)
-		req, err = http.NewRequest("GET", userURL, nil)
+		req, err = http.NewRequestWithContext(ctx, "GET", userURL, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -81,7 +82,7 @@ func (b *Backend) fetchClaims(tokenData map[string]interface{}) (*jwtclaims.User
 		req.Header.Add("Authorization", "token "+tokenString)
 	}
 
-	resp, err := cli.Do(req)
+	resp, err := b.doRequest(cli, req)
 	if err != nil {
 		return nil, err
 	}
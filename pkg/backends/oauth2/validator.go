@@ -18,17 +18,20 @@ import (
 	"fmt"
 	jwtlib "github.com/dgrijalva/jwt-go"
 	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
-	"github.com/greenpau/caddy-auth-portal/pkg/errors"
 	"strings"
 	"time"
 )
 
-func (b *Backend) validateAccessToken(state string, data map[string]interface{}) (*jwtclaims.UserClaims, error) {
+// errEmailNotVerified is returned when the provider has not verified the
+// email address of the user.
+var errEmailNotVerified = fmt.Errorf("email_verified claim is not true")
+
+func (b *Backend) validateAccessToken(state string, data map[string]interface{}) (*jwtclaims.UserClaims, map[string]interface{}, error) {
 	var tokenString string
 	if v, exists := data[b.IdentityTokenName]; exists {
 		tokenString = v.(string)
 	} else {
-		return nil, fmt.Errorf("token response has no %s field", b.IdentityTokenName)
+		return nil, nil, fmt.Errorf("token response has no %s field", b.IdentityTokenName)
 	}
 
 	token, err := jwtlib.Parse(tokenString, func(token *jwtlib.Token) (interface{}, error) {
@@ -39,39 +42,37 @@ func (b *Backend) validateAccessToken(state string, data map[string]interface{})
 		if !found {
 			return nil, fmt.Errorf("kid not found in %s", b.IdentityTokenName)
 		}
-		key, exists := b.publicKeys[keyID]
-		if !exists {
-			if !b.disableKeyVerification {
-				if err := b.fetchKeysURL(); err != nil {
-					return nil, errors.ErrBackendOauthKeyFetchFailed.WithArgs(err)
-				}
-			}
-			key, exists = b.publicKeys[keyID]
-			if !exists {
-				return nil, fmt.Errorf("the supplied kid not found in jwks public keys: %s", keyID)
-			}
+		if b.disableKeyVerification {
+			return nil, fmt.Errorf("the supplied kid not found in jwks public keys: %s", keyID)
 		}
-		return key, nil
+		return b.keys.get(keyID)
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse %s: %s", b.IdentityTokenName, err)
+		return nil, nil, fmt.Errorf("failed to parse %s: %s", b.IdentityTokenName, err)
 	}
 
 	if _, ok := token.Claims.(jwtlib.Claims); !ok && !token.Valid {
-		return nil, fmt.Errorf("invalid token: %s", tokenString)
+		return nil, nil, fmt.Errorf("invalid token: %s", tokenString)
 	}
 
 	tokenClaims := token.Claims.(jwtlib.MapClaims)
 	if tokenClaims == nil {
-		return nil, fmt.Errorf("token claims are nil")
+		return nil, nil, fmt.Errorf("token claims are nil")
 	}
 
-	if _, exists := tokenClaims["nonce"]; !exists {
-		return nil, fmt.Errorf("nonce claim not found")
+	nonce, ok := tokenClaims["nonce"].(string)
+	if !ok || nonce == "" {
+		return nil, nil, fmt.Errorf("nonce claim not found")
 	}
-	if err := b.state.validateNonce(state, tokenClaims["nonce"].(string)); err != nil {
-		return nil, fmt.Errorf("nonce claim validation failed: %s", err)
+	if err := b.state.validateNonce(state, nonce); err != nil {
+		return nil, nil, fmt.Errorf("nonce claim validation failed: %s", err)
+	}
+	if err := b.validateAudience(tokenClaims); err != nil {
+		return nil, nil, err
+	}
+	if err := b.validateEmailVerified(tokenClaims); err != nil {
+		return nil, nil, err
 	}
 
 	// Create new claims
@@ -108,7 +109,7 @@ func (b *Backend) validateAccessToken(state string, data map[string]interface{})
 					case string:
 						claims.Roles = append(claims.Roles, role.(string))
 					default:
-						return nil, fmt.Errorf("invalid %s entry type %v", claimName, tokenClaims[claimName])
+						return nil, nil, fmt.Errorf("invalid %s entry type %v", claimName, tokenClaims[claimName])
 					}
 				}
 			case string:
@@ -117,13 +118,13 @@ func (b *Backend) validateAccessToken(state string, data map[string]interface{})
 					claims.Roles = append(claims.Roles, role)
 				}
 			default:
-				return nil, fmt.Errorf("invalid %s type %v", claimName, tokenClaims[claimName])
+				return nil, nil, fmt.Errorf("invalid %s type %v", claimName, tokenClaims[claimName])
 			}
 		}
 	}
 
-	if claims.Email == "" {
-		return nil, fmt.Errorf("email claim not found")
+	if claims.Email == "" && !b.ClaimSources.Has(claimSourceUserInfo) {
+		return nil, nil, fmt.Errorf("email claim not found")
 	}
 	if claims.Subject == "" {
 		claims.Subject = claims.Email
@@ -132,5 +133,77 @@ func (b *Backend) validateAccessToken(state string, data map[string]interface{})
 		claims.Roles = []string{"anonymous", "guest", "everyone"}
 	}
 
-	return claims, nil
+	return claims, b.flattenClaims(tokenClaims), nil
+}
+
+// validateAudience checks that the identity token was issued for the
+// client, so that a token issued for another client of the provider is
+// rejected. The access tokens used as identity tokens are issued for
+// APIs and have other audiences, so they are not checked.
+func (b *Backend) validateAudience(tokenClaims jwtlib.MapClaims) error {
+	if b.IdentityTokenName != "id_token" || b.AudienceValidation == "off" {
+		return nil
+	}
+	var audiences []string
+	switch v := tokenClaims["aud"].(type) {
+	case string:
+		audiences = append(audiences, v)
+	case []interface{}:
+		for _, entry := range v {
+			if s, ok := entry.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	found := false
+	for _, aud := range audiences {
+		if aud == b.ClientID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("aud claim does not contain client id")
+	}
+	if b.AudienceValidation != "strict" {
+		return nil
+	}
+	v, exists := tokenClaims["azp"]
+	if !exists {
+		if len(audiences) > 1 {
+			return fmt.Errorf("azp claim not found in token having multiple audiences")
+		}
+		return nil
+	}
+	if azp, ok := v.(string); !ok || azp != b.ClientID {
+		return fmt.Errorf("azp claim does not match client id")
+	}
+	return nil
+}
+
+// validateEmailVerified checks that the provider verified the email
+// address of the user, when required. Some providers, e.g. AWS Cognito,
+// send the email_verified claim as a string.
+func (b *Backend) validateEmailVerified(tokenClaims jwtlib.MapClaims) error {
+	if !b.RequireVerifiedEmail {
+		return nil
+	}
+	v, exists := tokenClaims["email_verified"]
+	if !exists {
+		if b.AllowMissingEmailVerified {
+			return nil
+		}
+		return errEmailNotVerified
+	}
+	switch verified := v.(type) {
+	case bool:
+		if verified {
+			return nil
+		}
+	case string:
+		if verified == "true" {
+			return nil
+		}
+	}
+	return errEmailNotVerified
 }
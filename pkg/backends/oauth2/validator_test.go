@@ -0,0 +1,139 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"fmt"
+	"testing"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+)
+
+func TestValidateAudience(t *testing.T) {
+	testFailed := 0
+	clientID := "portal"
+	tests := []struct {
+		mode       string
+		tokenName  string
+		claims     jwtlib.MapClaims
+		shouldFail bool
+	}{
+		// single audience
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": "portal"}},
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": []interface{}{"portal"}}},
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": "other"}, shouldFail: true},
+		{mode: "strict", claims: jwtlib.MapClaims{}, shouldFail: true},
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": "portal", "azp": "portal"}},
+		// multiple audiences
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": []interface{}{"portal", "api"}, "azp": "portal"}},
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": []interface{}{"portal", "api"}}, shouldFail: true},
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": []interface{}{"other", "api"}, "azp": "portal"}, shouldFail: true},
+		{mode: "aud", claims: jwtlib.MapClaims{"aud": []interface{}{"portal", "api"}}},
+		// azp mismatch
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": "portal", "azp": "other"}, shouldFail: true},
+		{mode: "strict", claims: jwtlib.MapClaims{"aud": []interface{}{"portal", "other"}, "azp": "other"}, shouldFail: true},
+		{mode: "aud", claims: jwtlib.MapClaims{"aud": "portal", "azp": "other"}},
+		{mode: "aud", claims: jwtlib.MapClaims{"aud": "other"}, shouldFail: true},
+		// disabled validation
+		{mode: "off", claims: jwtlib.MapClaims{"aud": "other", "azp": "other"}},
+		{mode: "strict", tokenName: "access_token", claims: jwtlib.MapClaims{"aud": "api://default"}},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, mode: %s, claims: %v", i, test.mode, test.claims)
+		b := &Backend{
+			ClientID:           clientID,
+			IdentityTokenName:  "id_token",
+			AudienceValidation: test.mode,
+		}
+		if test.tokenName != "" {
+			b.IdentityTokenName = test.tokenName
+		}
+		err := b.validateAudience(test.claims)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestValidateEmailVerified(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		require      bool
+		allowMissing bool
+		claims       jwtlib.MapClaims
+		shouldFail   bool
+	}{
+		// verified
+		{require: true, claims: jwtlib.MapClaims{"email_verified": true}},
+		{require: true, claims: jwtlib.MapClaims{"email_verified": "true"}},
+		// unverified
+		{require: true, claims: jwtlib.MapClaims{"email_verified": false}, shouldFail: true},
+		{require: true, claims: jwtlib.MapClaims{"email_verified": "false"}, shouldFail: true},
+		{require: true, allowMissing: true, claims: jwtlib.MapClaims{"email_verified": false}, shouldFail: true},
+		// absent
+		{require: true, claims: jwtlib.MapClaims{}, shouldFail: true},
+		{require: true, allowMissing: true, claims: jwtlib.MapClaims{}},
+		// disabled
+		{claims: jwtlib.MapClaims{"email_verified": false}},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, require: %t, allow missing: %t, claims: %v", i, test.require, test.allowMissing, test.claims)
+		b := &Backend{
+			RequireVerifiedEmail:      test.require,
+			AllowMissingEmailVerified: test.allowMissing,
+		}
+		err := b.validateEmailVerified(test.claims)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			if err != errEmailNotVerified {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
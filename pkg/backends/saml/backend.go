@@ -65,8 +65,17 @@ type Backend struct {
 	// by name, i.e. app. Each of the URLs is a separate endpoint.
 	AssertionConsumerServiceURLs []string `json:"acs_urls,omitempty"`
 
+	// AuthnContextClassRefs is the list of the authentication context
+	// classes the portal requests from the IdP, e.g. the classes requiring
+	// a smartcard or multi-factor authentication. When set, the portal
+	// initiates the login with an AuthnRequest, and rejects the assertions
+	// issued with any other class.
+	AuthnContextClassRefs []string `json:"authn_context_class_refs,omitempty"`
+
 	TokenProvider *jwtconfig.CommonTokenConfig `json:"-"`
 	logger        *zap.Logger
+	requests      *requestStore
+	relayStates   *relayStateStore
 }
 
 // NewDatabaseBackend return an instance of authentication provider
@@ -155,6 +164,11 @@ func (b *Backend) ConfigureAuthenticator() error {
 		azureOptions.IDPMetadata = idpMetadata
 	}
 
+	if len(b.AuthnContextClassRefs) > 0 {
+		b.requests = newRequestStore()
+	}
+	b.relayStates = newRelayStateStore()
+
 	b.ServiceProviders = make(map[string]*samllib.ServiceProvider)
 	for _, acsURL := range b.AssertionConsumerServiceURLs {
 		sp := samlsp.DefaultServiceProvider(azureOptions)
@@ -217,7 +231,21 @@ func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interfac
 	resp["code"] = 400
 	if r.Method != "POST" {
 		resp["code"] = 200
-		resp["redirect_url"] = b.LoginURL
+		redirectURL := b.LoginURL
+		if len(b.AuthnContextClassRefs) > 0 {
+			var err error
+			redirectURL, err = b.makeAuthenticationRequest(b.getServiceProvider(r))
+			if err != nil {
+				resp["code"] = 500
+				return resp, fmt.Errorf("Failed to create AuthnRequest: %s", err)
+			}
+		}
+		redirectURL, err := b.addRelayState(redirectURL, opts)
+		if err != nil {
+			resp["code"] = 500
+			return resp, fmt.Errorf("Failed to add RelayState: %s", err)
+		}
+		resp["redirect_url"] = redirectURL
 		return resp, nil
 	}
 
@@ -271,10 +299,23 @@ func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interfac
 		return resp, fmt.Errorf("Unsupported ACS URL %s", acsURL)
 	}
 
-	samlAssertions, err := sp.ParseXMLResponse(samlResponseBytes, []string{""})
+	possibleRequestIDs := []string{""}
+	if b.requests != nil {
+		possibleRequestIDs = append(possibleRequestIDs, b.requests.getIDs()...)
+	}
+	samlAssertions, err := sp.ParseXMLResponse(samlResponseBytes, possibleRequestIDs)
 	if err != nil {
 		return resp, fmt.Errorf("Failed to ParseXMLResponse: %s", err)
 	}
+	if b.requests != nil {
+		b.requests.delete(getInResponseTo(samlAssertions))
+	}
+
+	authnContextClassRef := getAuthnContextClassRef(samlAssertions)
+	if err := b.validateAuthnContext(authnContextClassRef); err != nil {
+		resp["code"] = 403
+		return resp, err
+	}
 
 	claims := &jwtclaims.UserClaims{}
 
@@ -347,6 +388,14 @@ func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interfac
 
 	claims.IssuedAt = time.Now().Unix()
 	resp["claims"] = claims
+	if v := b.relayStates.pop(r.FormValue("RelayState")); v != "" {
+		resp["login_redirect_url"] = v
+	}
+	if authnContextClassRef != "" {
+		resp["custom_claims"] = map[string]interface{}{
+			"acr": authnContextClassRef,
+		}
+	}
 	return resp, nil
 }
 
@@ -0,0 +1,174 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	samllib "github.com/crewjam/saml"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+// authnRequestLifetime is the period the portal accepts the responses
+// to the authentication requests it issued.
+const authnRequestLifetime = 10 * time.Minute
+
+// requestStore holds the identifiers of the pending authentication
+// requests.
+type requestStore struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func newRequestStore() *requestStore {
+	return &requestStore{entries: make(map[string]time.Time)}
+}
+
+func (s *requestStore) add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, v := range s.entries {
+		if now.After(v) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[id] = now.Add(authnRequestLifetime)
+}
+
+// getIDs returns the identifiers of the pending requests.
+func (s *requestStore) getIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var ids []string
+	for k, v := range s.entries {
+		if now.After(v) {
+			continue
+		}
+		ids = append(ids, k)
+	}
+	return ids
+}
+
+func (s *requestStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+}
+
+// getServiceProvider returns the service provider for the ACS URL the
+// request arrived at. It falls back to the first configured ACS URL.
+func (b *Backend) getServiceProvider(r *http.Request) *samllib.ServiceProvider {
+	if sp, exists := b.ServiceProviders[utils.GetCurrentURL(r)]; exists {
+		return sp
+	}
+	return b.ServiceProviders[b.AssertionConsumerServiceURLs[0]]
+}
+
+// makeAuthenticationRequest returns the URL redirecting users to the
+// IdP with an AuthnRequest requesting the configured authentication
+// context classes.
+func (b *Backend) makeAuthenticationRequest(sp *samllib.ServiceProvider) (string, error) {
+	idpURL := sp.GetSSOBindingLocation(samllib.HTTPRedirectBinding)
+	if idpURL == "" {
+		return "", fmt.Errorf("IdP metadata has no HTTP-Redirect SSO binding")
+	}
+	req, err := sp.MakeAuthenticationRequest(idpURL)
+	if err != nil {
+		return "", err
+	}
+
+	el := req.Element()
+	ctx := el.CreateElement("samlp:RequestedAuthnContext")
+	ctx.CreateAttr("Comparison", "exact")
+	for _, classRef := range b.AuthnContextClassRefs {
+		ctx.CreateElement("saml:AuthnContextClassRef").SetText(classRef)
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+
+	buf := &bytes.Buffer{}
+	w1 := base64.NewEncoder(base64.StdEncoding, buf)
+	w2, err := flate.NewWriter(w1, 9)
+	if err != nil {
+		return "", err
+	}
+	if _, err := doc.WriteTo(w2); err != nil {
+		return "", err
+	}
+	w2.Close()
+	w1.Close()
+
+	u, err := url.Parse(idpURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", buf.String())
+	u.RawQuery = q.Encode()
+	b.requests.add(req.ID)
+	return u.String(), nil
+}
+
+// getAuthnContextClassRef returns the authentication context class
+// the IdP used to authenticate the subject of the assertion.
+func getAuthnContextClassRef(assertion *samllib.Assertion) string {
+	for _, stmt := range assertion.AuthnStatements {
+		if stmt.AuthnContext.AuthnContextClassRef != nil {
+			return stmt.AuthnContext.AuthnContextClassRef.Value
+		}
+	}
+	return ""
+}
+
+// getInResponseTo returns the identifier of the request the assertion
+// responds to, if any.
+func getInResponseTo(assertion *samllib.Assertion) string {
+	if assertion.Subject == nil {
+		return ""
+	}
+	for _, sc := range assertion.Subject.SubjectConfirmations {
+		if sc.SubjectConfirmationData != nil && sc.SubjectConfirmationData.InResponseTo != "" {
+			return sc.SubjectConfirmationData.InResponseTo
+		}
+	}
+	return ""
+}
+
+// validateAuthnContext checks that the IdP authenticated the subject of
+// the assertion with one of the required context classes.
+func (b *Backend) validateAuthnContext(classRef string) error {
+	if len(b.AuthnContextClassRefs) == 0 {
+		return nil
+	}
+	for _, required := range b.AuthnContextClassRefs {
+		if classRef == required {
+			return nil
+		}
+	}
+	if classRef == "" {
+		return fmt.Errorf("assertion has no authentication context")
+	}
+	return fmt.Errorf("insufficient authentication context: %s", classRef)
+}
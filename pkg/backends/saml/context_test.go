@@ -0,0 +1,120 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+
+	samllib "github.com/crewjam/saml"
+)
+
+func TestMakeAuthenticationRequest(t *testing.T) {
+	testFailed := 0
+	acsURL, _ := url.Parse("https://localhost/auth/saml/azure")
+	sp := &samllib.ServiceProvider{
+		AcsURL: *acsURL,
+		IDPMetadata: &samllib.EntityDescriptor{
+			IDPSSODescriptors: []samllib.IDPSSODescriptor{
+				{
+					SingleSignOnServices: []samllib.Endpoint{
+						{
+							Binding:  samllib.HTTPRedirectBinding,
+							Location: "https://idp.example.com/sso",
+						},
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		classRefs []string
+	}{
+		{classRefs: []string{"urn:oasis:names:tc:SAML:2.0:ac:classes:Smartcard"}},
+		{classRefs: []string{"urn:oasis:names:tc:SAML:2.0:ac:classes:Smartcard", "http://schemas.microsoft.com/claims/multipleauthn"}},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, class refs: %v", i, test.classRefs)
+		b := &Backend{
+			AuthnContextClassRefs: test.classRefs,
+			requests:              newRequestStore(),
+		}
+		redirectURL, err := b.makeAuthenticationRequest(sp)
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		u, _ := url.Parse(redirectURL)
+		if u.Host != "idp.example.com" {
+			t.Logf("FAIL: %s, unexpected redirect url: %s", testDescr, redirectURL)
+			testFailed++
+			continue
+		}
+		compressed, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+		if err != nil {
+			t.Logf("FAIL: %s, malformed request: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		req, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		if err != nil {
+			t.Logf("FAIL: %s, malformed request: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		mismatch := !strings.Contains(string(req), `<samlp:RequestedAuthnContext Comparison="exact">`)
+		for _, classRef := range test.classRefs {
+			if !strings.Contains(string(req), "<saml:AuthnContextClassRef>"+classRef+"</saml:AuthnContextClassRef>") {
+				mismatch = true
+			}
+		}
+		if mismatch {
+			t.Logf("FAIL: %s, unexpected request: %s", testDescr, req)
+			testFailed++
+			continue
+		}
+		if len(b.requests.getIDs()) != 1 {
+			t.Logf("FAIL: %s, request id was not recorded", testDescr)
+			testFailed++
+			continue
+		}
+		for _, classRef := range test.classRefs {
+			if err := b.validateAuthnContext(classRef); err != nil {
+				t.Logf("FAIL: %s, unexpected validation error: %s", testDescr, err)
+				mismatch = true
+			}
+		}
+		if err := b.validateAuthnContext("urn:oasis:names:tc:SAML:2.0:ac:classes:Password"); err == nil {
+			t.Logf("FAIL: %s, expected validation error, but received none", testDescr)
+			mismatch = true
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
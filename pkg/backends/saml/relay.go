@@ -0,0 +1,97 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+// relayStateStore holds the URLs the users are redirected to after the
+// login, keyed by the RelayState sent to the IdP. The IdP returns the
+// RelayState with the response, so that the URL survives the round trip
+// even when the browser does not send the redirect cookie with the
+// cross-site POST of the response.
+type relayStateStore struct {
+	mu      sync.Mutex
+	entries map[string]*relayState
+}
+
+type relayState struct {
+	redirectURL string
+	expiresAt   time.Time
+}
+
+func newRelayStateStore() *relayStateStore {
+	return &relayStateStore{entries: make(map[string]*relayState)}
+}
+
+// add stores the redirect URL and returns the RelayState.
+func (s *relayStateStore) add(redirectURL string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, v := range s.entries {
+		if now.After(v.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	id := utils.GetRandomString(32)
+	s.entries[id] = &relayState{
+		redirectURL: redirectURL,
+		expiresAt:   now.Add(authnRequestLifetime),
+	}
+	return id
+}
+
+// pop returns the redirect URL of the RelayState and removes it. The
+// unknown and expired RelayState values, e.g. the ones of IdP-initiated
+// logins, return an empty string.
+func (s *relayStateStore) pop(id string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, exists := s.entries[id]
+	if !exists {
+		return ""
+	}
+	delete(s.entries, id)
+	if time.Now().After(entry.expiresAt) {
+		return ""
+	}
+	return entry.redirectURL
+}
+
+// addRelayState adds the RelayState holding the redirect URL of the user
+// to the URL redirecting the user to the IdP.
+func (b *Backend) addRelayState(redirectURL string, opts map[string]interface{}) (string, error) {
+	v, ok := opts["login_redirect_url"].(string)
+	if !ok || v == "" || b.relayStates == nil {
+		return redirectURL, nil
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("RelayState", b.relayStates.add(v))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
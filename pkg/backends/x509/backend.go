@@ -16,9 +16,13 @@ package x509
 
 import (
 	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/claimsource"
 	"github.com/greenpau/go-identity"
 
 	"go.uber.org/zap"
@@ -35,9 +39,19 @@ func init() {
 
 // Backend represents authentication provider with X.509 backend.
 type Backend struct {
-	Name          string                       `json:"name,omitempty"`
-	Method        string                       `json:"method,omitempty"`
-	Realm         string                       `json:"realm,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Method string `json:"method,omitempty"`
+	Realm  string `json:"realm,omitempty"`
+	// The rules restricting the client certificates accepted beyond the
+	// validation of their chains. When allow rules are present, the
+	// certificate must match at least one of them. The certificate
+	// matching any of the deny rules is rejected.
+	AllowCertificates []*CertificateRule `json:"allow_certificates,omitempty"`
+	DenyCertificates  []*CertificateRule `json:"deny_certificates,omitempty"`
+	// The ordered sources of the email claim, i.e. the san (subject
+	// alternative name) and subject (emailAddress attribute) of the
+	// certificate. By default, the san takes precedence.
+	ClaimSources  claimsource.Priority         `json:"claim_sources,omitempty"`
 	TokenProvider *jwtconfig.CommonTokenConfig `json:"-"`
 	Authenticator *Authenticator               `json:"-"`
 	logger        *zap.Logger
@@ -102,14 +116,56 @@ func (b *Backend) ConfigureAuthenticator() error {
 
 // ValidateConfig checks whether Backend has mandatory configuration.
 func (b *Backend) ValidateConfig() error {
+	for _, rule := range append(b.AllowCertificates, b.DenyCertificates...) {
+		if err := rule.configure(); err != nil {
+			return err
+		}
+	}
+	if err := b.ClaimSources.Validate(supportedClaimSources); err != nil {
+		return err
+	}
 	return nil
 }
 
-// Authenticate performs authentication.
+// Authenticate performs authentication. The user presents the client
+// certificate verified by the TLS server. The certificate must also pass
+// the allow and deny rules of the backend.
 func (b *Backend) Authenticate(opts map[string]interface{}) (map[string]interface{}, error) {
 	resp := make(map[string]interface{})
 	resp["code"] = 400
-	return resp, fmt.Errorf("unsupported backend %s", b.Name)
+	r, ok := opts["request"].(*http.Request)
+	if !ok {
+		return resp, fmt.Errorf("no request found")
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		resp["code"] = 401
+		return resp, fmt.Errorf("no verified client certificate found")
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if err := b.checkCertificate(cert); err != nil {
+		resp["code"] = 403
+		return resp, err
+	}
+	if cert.Subject.CommonName == "" {
+		resp["code"] = 401
+		return resp, fmt.Errorf("client certificate has no common name")
+	}
+	claims := &jwtclaims.UserClaims{
+		Subject: cert.Subject.CommonName,
+		Name:    cert.Subject.CommonName,
+	}
+	claims.Email = b.resolveEmail(cert)
+	claims.Origin = b.TokenProvider.TokenOrigin
+	claims.ExpiresAt = time.Now().Add(time.Duration(b.TokenProvider.TokenLifetime) * time.Second).Unix()
+	resp["code"] = 200
+	resp["claims"] = claims
+	b.logger.Debug(
+		"client certificate authenticated user",
+		zap.String("realm", b.Realm),
+		zap.String("user", claims.Subject),
+		zap.String("issuer", cert.Issuer.CommonName),
+	)
+	return resp, nil
 }
 
 // Validate checks whether Backend is functional.
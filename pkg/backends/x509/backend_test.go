@@ -0,0 +1,155 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package x509
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/claimsource"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestAuthenticate(t *testing.T) {
+	testFailed := 0
+	b := NewDatabaseBackend()
+	b.Realm = "contoso"
+	b.AllowCertificates = []*CertificateRule{
+		{Field: "cn", Match: "regex", Value: `^[a-z]+\.contoso\.com$`},
+		{Field: "cn", Value: "build-agent-01"},
+	}
+	b.DenyCertificates = []*CertificateRule{
+		{Field: "issuer", Value: "Contoso Legacy CA"},
+	}
+	b.logger = utils.NewLogger()
+	if err := b.ConfigureAuthenticator(); err != nil {
+		t.Fatalf("failed configuring backend: %s", err)
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatalf("failed validating backend: %s", err)
+	}
+
+	tests := []struct {
+		cn     string
+		issuer string
+		email  string
+		noTLS  bool
+		code   int
+	}{
+		{cn: "jsmith.contoso.com", issuer: "Contoso CA", email: "jsmith@contoso.com", code: 200},
+		{cn: "build-agent-01", issuer: "Contoso CA", code: 200},
+		{cn: "build-agent-02", issuer: "Contoso CA", code: 403},
+		{cn: "jsmith.contoso.com.evil.com", issuer: "Contoso CA", code: 403},
+		{cn: "jsmith.contoso.com", issuer: "Contoso Legacy CA", code: 403},
+		{noTLS: true, code: 401},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, cn: %s, issuer: %s", i, test.cn, test.issuer)
+		r := httptest.NewRequest("GET", "/auth/x509/contoso", nil)
+		if test.noTLS {
+			r.TLS = nil
+		} else {
+			cert := &x509.Certificate{
+				Subject: pkix.Name{CommonName: test.cn},
+				Issuer:  pkix.Name{CommonName: test.issuer},
+			}
+			if test.email != "" {
+				cert.EmailAddresses = []string{test.email}
+			}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		resp, err := b.Authenticate(map[string]interface{}{"request": r})
+		if resp["code"] != test.code {
+			t.Logf("FAIL: %s, code: %d (expected) vs. %v (received), error: %v", testDescr, test.code, resp["code"], err)
+			testFailed++
+			continue
+		}
+		if test.code != 200 {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected error: %s", testDescr, err)
+			continue
+		}
+		claims := resp["claims"].(*jwtclaims.UserClaims)
+		if claims.Subject != test.cn || claims.Email != test.email {
+			t.Logf("FAIL: %s, unexpected claims: %v", testDescr, claims)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestResolveEmail(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		name    string
+		sources claimsource.Priority
+		san     string
+		subject string
+		email   string
+	}{
+		{name: "default priority prefers san", san: "jsmith@contoso.com", subject: "john.smith@contoso.com", email: "jsmith@contoso.com"},
+		{name: "default priority falls back to subject", subject: "john.smith@contoso.com", email: "john.smith@contoso.com"},
+		{
+			name:    "subject wins over san",
+			sources: claimsource.Priority{"email": {"subject", "san"}},
+			san:     "jsmith@contoso.com",
+			subject: "john.smith@contoso.com",
+			email:   "john.smith@contoso.com",
+		},
+		{
+			name:    "san only ignores subject",
+			sources: claimsource.Priority{"email": {"san"}},
+			subject: "john.smith@contoso.com",
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.name)
+		b := &Backend{ClaimSources: test.sources}
+		if err := b.ValidateConfig(); err != nil {
+			t.Fatalf("FAIL: %s, unexpected error: %s", testDescr, err)
+		}
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "jsmith"}}
+		if test.san != "" {
+			cert.EmailAddresses = []string{test.san}
+		}
+		if test.subject != "" {
+			cert.Subject.Names = []pkix.AttributeTypeAndValue{{Type: oidEmailAddress, Value: test.subject}}
+		}
+		if email := b.resolveEmail(cert); email != test.email {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, test.email, email)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
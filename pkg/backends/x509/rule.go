@@ -0,0 +1,90 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package x509
+
+import (
+	"crypto/x509"
+	"fmt"
+	"regexp"
+)
+
+// CertificateRule matches a field of a client certificate.
+type CertificateRule struct {
+	// The field of the certificate, i.e. cn (the common name of the
+	// subject) or issuer (the common name of the issuer).
+	Field string `json:"field,omitempty"`
+	// The type of the match, i.e. exact (default) or regex.
+	Match string `json:"match,omitempty"`
+	// The value or the regular expression matching the field.
+	Value string `json:"value,omitempty"`
+	regex *regexp.Regexp
+}
+
+func (rule *CertificateRule) configure() error {
+	switch rule.Field {
+	case "cn", "issuer":
+	default:
+		return fmt.Errorf("unsupported certificate rule field: %s", rule.Field)
+	}
+	if rule.Value == "" {
+		return fmt.Errorf("certificate rule for %s field has no value", rule.Field)
+	}
+	switch rule.Match {
+	case "", "exact":
+		rule.Match = "exact"
+	case "regex":
+		regex, err := regexp.Compile(rule.Value)
+		if err != nil {
+			return fmt.Errorf("certificate rule for %s field has invalid regex: %s", rule.Field, err)
+		}
+		rule.regex = regex
+	default:
+		return fmt.Errorf("unsupported certificate rule match: %s", rule.Match)
+	}
+	return nil
+}
+
+func (rule *CertificateRule) matches(cert *x509.Certificate) bool {
+	var v string
+	switch rule.Field {
+	case "cn":
+		v = cert.Subject.CommonName
+	case "issuer":
+		v = cert.Issuer.CommonName
+	}
+	if rule.regex != nil {
+		return rule.regex.MatchString(v)
+	}
+	return v == rule.Value
+}
+
+// checkCertificate returns an error when the certificate does not pass
+// the allow and deny rules of the backend.
+func (b *Backend) checkCertificate(cert *x509.Certificate) error {
+	for _, rule := range b.DenyCertificates {
+		if rule.matches(cert) {
+			return fmt.Errorf("client certificate %s is denied by %s rule", cert.Subject.CommonName, rule.Field)
+		}
+	}
+	if len(b.AllowCertificates) == 0 {
+		return nil
+	}
+	for _, rule := range b.AllowCertificates {
+		if rule.matches(cert) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client certificate %s is not allowed", cert.Subject.CommonName)
+}
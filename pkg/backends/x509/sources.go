@@ -0,0 +1,57 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package x509
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+const (
+	claimSourceSAN     = "san"
+	claimSourceSubject = "subject"
+)
+
+// defaultClaimSourceOrder is the order of the claim sources when the
+// priority of a claim is not configured.
+var defaultClaimSourceOrder = []string{claimSourceSAN, claimSourceSubject}
+
+// supportedClaimSources holds the claims resolvable by their sources.
+var supportedClaimSources = map[string][]string{
+	"email": {claimSourceSAN, claimSourceSubject},
+}
+
+// oidEmailAddress is the emailAddress attribute of the subject name.
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+// resolveEmail returns the email address of the certificate from the
+// highest priority source.
+func (b *Backend) resolveEmail(cert *x509.Certificate) string {
+	values := make(map[string]string)
+	if len(cert.EmailAddresses) > 0 {
+		values[claimSourceSAN] = cert.EmailAddresses[0]
+	}
+	for _, attr := range cert.Subject.Names {
+		if !attr.Type.Equal(oidEmailAddress) {
+			continue
+		}
+		if v, ok := attr.Value.(string); ok {
+			values[claimSourceSubject] = v
+			break
+		}
+	}
+	email, _ := b.ClaimSources.Resolve("email", defaultClaimSourceOrder, values)
+	return email
+}
@@ -16,71 +16,137 @@ package cache
 
 import (
 	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
-	//"log"
 	"sync"
 	"time"
 )
 
+// DefaultSessionTTL is the default lifetime of the cache entries having
+// no expiry of their own.
+const DefaultSessionTTL = 15 * time.Minute
+
+// maxEvictionInterval is the longest interval between the evictions.
+const maxEvictionInterval = 5 * time.Minute
+
 // SessionCache contains cached tokens
 type SessionCache struct {
-	mu      sync.RWMutex
-	Entries map[string]interface{}
+	mu        sync.RWMutex
+	Entries   map[string]interface{}
+	activity  map[string]time.Time
+	updated   map[string]time.Time
+	evictions int
+	ttl       time.Duration
+	stop      chan struct{}
 }
 
 // NewSessionCache returns SessionCache instance.
 func NewSessionCache() *SessionCache {
 	c := &SessionCache{
-		Entries: map[string]interface{}{},
+		Entries:  map[string]interface{}{},
+		activity: map[string]time.Time{},
+		updated:  map[string]time.Time{},
 	}
-	go manageSessionCache(c)
+	c.SetTTL(DefaultSessionTTL)
 	return c
 }
 
-func manageSessionCache(cache *SessionCache) {
-	intervals := time.NewTicker(time.Minute * time.Duration(5))
-	for range intervals.C {
-		//log.Printf("managing cache")
-		if cache == nil {
-			//log.Printf("cache is nil")
+// SetTTL sets the lifetime of the cache entries having no expiry of their
+// own and restarts the eviction of the expired entries. The entries
+// expire when they were neither added nor touched during the lifetime.
+// The eviction runs for the lifetime of the process, and each call
+// replaces the eviction routine started by the previous one.
+func (c *SessionCache) SetTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	interval := ttl
+	if interval > maxEvictionInterval {
+		interval = maxEvictionInterval
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+	}
+	c.ttl = ttl
+	c.stop = make(chan struct{})
+	go manageSessionCache(c, interval, c.stop)
+}
+
+// GetTTL returns the lifetime of the cache entries having no expiry of
+// their own.
+func (c *SessionCache) GetTTL() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ttl
+}
+
+func manageSessionCache(cache *SessionCache, interval time.Duration, stop <-chan struct{}) {
+	intervals := time.NewTicker(interval)
+	defer intervals.Stop()
+	for {
+		select {
+		case <-stop:
 			return
+		case now := <-intervals.C:
+			cache.evict(now)
 		}
-		cache.mu.RLock()
-		if cache.Entries == nil {
-			//log.Printf("cache entries is nil")
-			cache.mu.RUnlock()
-			continue
-		}
-		cache.mu.RUnlock()
-		cache.mu.Lock()
-		//log.Printf("cache entries count: %d", len(cache.Entries))
-		for entryID, data := range cache.Entries {
-			//log.Printf("entering cache entry: %s", entryID)
-			switch data.(type) {
-			case map[string]interface{}:
-				//log.Printf("cached entry is map[string]interface")
-				dataset := data.(map[string]interface{})
-				//log.Printf("cached entry data: %v", dataset)
-				if v, exists := dataset["claims"]; exists {
-					claims := v.(*jwtclaims.UserClaims)
-					//log.Printf("entering cache claims: %v", claims)
-					if err := claims.Valid(); err != nil {
-						delete(cache.Entries, entryID)
-					}
+	}
+}
+
+// evict removes the entries expired at the provided time. The entries
+// carrying the claims expire with the claims, and the entries carrying
+// the expiry time expire at that time. The other entries expire when
+// they were not updated for longer than the lifetime of the cache.
+func (c *SessionCache) evict(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for entryID, data := range c.Entries {
+		var ownExpiry bool
+		if dataset, ok := data.(map[string]interface{}); ok {
+			if claims, ok := dataset["claims"].(*jwtclaims.UserClaims); ok {
+				if err := claims.Valid(); err != nil {
+					c.remove(entryID)
+					continue
+				}
+				ownExpiry = claims.ExpiresAt > 0
+			}
+			if v, ok := dataset["expires_at"].(time.Time); ok {
+				if now.After(v) {
+					c.remove(entryID)
+					continue
 				}
-			default:
-				continue
+				ownExpiry = true
 			}
 		}
-		cache.mu.Unlock()
+		if ownExpiry || c.ttl <= 0 {
+			continue
+		}
+		lastUpdate := c.updated[entryID]
+		if ts, exists := c.activity[entryID]; exists && ts.After(lastUpdate) {
+			lastUpdate = ts
+		}
+		if now.Sub(lastUpdate) > c.ttl {
+			c.remove(entryID)
+		}
 	}
-	return
 }
 
-// Add adds data to the cache.
+// remove deletes the expired entry. The caller must hold the lock.
+func (c *SessionCache) remove(entryID string) {
+	delete(c.Entries, entryID)
+	delete(c.activity, entryID)
+	delete(c.updated, entryID)
+	c.evictions++
+}
+
 func (c *SessionCache) Add(entryID string, data interface{}) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.Entries[entryID] = data
+	if c.updated == nil {
+		c.updated = map[string]time.Time{}
+	}
+	c.updated[entryID] = time.Now()
 	return nil
 }
 
@@ -89,10 +155,13 @@ func (c *SessionCache) Delete(entryID string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	delete(c.Entries, entryID)
+	delete(c.activity, entryID)
+	delete(c.updated, entryID)
 	return nil
 }
 
-// Get returns cached data entry.
+// Get returns cached data entry. The entry is shared by the callers and
+// must not be modified; Set and Increment replace the entry instead.
 func (c *SessionCache) Get(entryID string) map[string]interface{} {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -106,3 +175,96 @@ func (c *SessionCache) Get(entryID string) map[string]interface{} {
 	}
 	return nil
 }
+
+// Pop removes cached data entry and returns it. Only one of the
+// concurrent callers receives the entry.
+func (c *SessionCache) Pop(entryID string) map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.Entries[entryID].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	delete(c.Entries, entryID)
+	delete(c.activity, entryID)
+	delete(c.updated, entryID)
+	return data
+}
+
+// Increment increments the counter stored under the key of the cached
+// data entry and returns the new value. It returns zero when the entry
+// does not exist. Like Set, it replaces the entry with a copy.
+func (c *SessionCache) Increment(entryID, key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.Entries[entryID].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	counter, _ := data[key].(int)
+	counter++
+	data = copyEntry(data)
+	data[key] = counter
+	c.Entries[entryID] = data
+	return counter
+}
+
+// Set stores the value under the key of the cached data entry. It does
+// nothing when the entry does not exist. The entry is replaced with
+// a copy, so that the callers holding the entry returned by Get do not
+// observe concurrent writes.
+func (c *SessionCache) Set(entryID, key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := c.Entries[entryID].(map[string]interface{}); ok {
+		data = copyEntry(data)
+		data[key] = value
+		c.Entries[entryID] = data
+	}
+}
+
+// copyEntry returns the shallow copy of the cached data entry.
+func copyEntry(data map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		m[k] = v
+	}
+	return m
+}
+
+// Revoke replaces the session with a record of its revocation, e.g. upon
+// logout, so that its tokens are no longer accepted. The record expires
+// together with the tokens of the session.
+func (c *SessionCache) Revoke(entryID string, expiresAt time.Time) {
+	c.Add(entryID, map[string]interface{}{
+		"invalidated": true,
+		"expires_at":  expiresAt,
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.activity, entryID)
+}
+
+// IsRevoked returns true when the session was logged out or invalidated.
+func (c *SessionCache) IsRevoked(entryID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data, ok := c.Entries[entryID].(map[string]interface{})
+	return ok && data["invalidated"] == true
+}
+
+// Touch records the activity of a session.
+func (c *SessionCache) Touch(entryID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.activity[entryID] = time.Now()
+}
+
+// GetLastActivity returns the time of the last recorded activity of
+// a session.
+func (c *SessionCache) GetLastActivity(entryID string) (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ts, exists := c.activity[entryID]
+	return ts, exists
+}
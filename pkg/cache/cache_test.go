@@ -0,0 +1,196 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestSessionCacheEviction(t *testing.T) {
+	testFailed := 0
+	now := time.Now()
+	tests := []struct {
+		data       interface{}
+		updated    time.Time
+		activity   time.Time
+		shouldKeep bool
+	}{
+		{
+			data:       map[string]interface{}{"claims": &jwtclaims.UserClaims{Subject: "jsmith", ExpiresAt: now.Add(time.Hour).Unix()}},
+			updated:    now.Add(-2 * time.Hour),
+			shouldKeep: true,
+		},
+		{
+			data:    map[string]interface{}{"claims": &jwtclaims.UserClaims{Subject: "jsmith", ExpiresAt: now.Add(-time.Minute).Unix()}},
+			updated: now,
+		},
+		{
+			data:       map[string]interface{}{"expires_at": now.Add(time.Hour)},
+			updated:    now.Add(-2 * time.Hour),
+			shouldKeep: true,
+		},
+		{
+			data:    map[string]interface{}{"expires_at": now.Add(-time.Second)},
+			updated: now,
+		},
+		{
+			data:       map[string]interface{}{"step": "credentials"},
+			updated:    now.Add(-10 * time.Minute),
+			shouldKeep: true,
+		},
+		{
+			data:    map[string]interface{}{"step": "credentials"},
+			updated: now.Add(-20 * time.Minute),
+		},
+		{
+			data:       map[string]interface{}{"step": "credentials"},
+			updated:    now.Add(-20 * time.Minute),
+			activity:   now.Add(-time.Minute),
+			shouldKeep: true,
+		},
+		{
+			data:    "value",
+			updated: now.Add(-20 * time.Minute),
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, data: %v", i, test.data)
+		c := &SessionCache{
+			Entries:  map[string]interface{}{"entry": test.data},
+			activity: map[string]time.Time{},
+			updated:  map[string]time.Time{"entry": test.updated},
+			ttl:      DefaultSessionTTL,
+		}
+		if !test.activity.IsZero() {
+			c.activity["entry"] = test.activity
+		}
+		c.evict(now)
+		_, kept := c.Entries["entry"]
+		if kept != test.shouldKeep {
+			t.Logf("FAIL: %s, expected kept: %t, got: %t", testDescr, test.shouldKeep, kept)
+			testFailed++
+			continue
+		}
+		if !kept && (c.evictions != 1 || len(c.updated) != 0) {
+			t.Logf("FAIL: %s, entry was not fully removed", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestSessionCacheSetTTL(t *testing.T) {
+	c := NewSessionCache()
+	stop := c.stop
+	c.SetTTL(time.Hour)
+	if c.GetTTL() != time.Hour {
+		t.Fatalf("unexpected ttl: %s", c.GetTTL())
+	}
+	select {
+	case <-stop:
+	default:
+		t.Fatalf("previous eviction was not stopped")
+	}
+	c.SetTTL(0)
+	if c.GetTTL() != DefaultSessionTTL {
+		t.Fatalf("unexpected ttl: %s", c.GetTTL())
+	}
+}
+
+func TestSessionCacheConcurrentSet(t *testing.T) {
+	c := &SessionCache{
+		Entries:  map[string]interface{}{},
+		activity: map[string]time.Time{},
+	}
+	c.Add("s1", map[string]interface{}{"src_ip": "10.0.0.1"})
+	held := c.Get("s1")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			c.Set("s1", "src_ip", fmt.Sprintf("10.0.0.%d", i%255))
+			c.Set("s1", "reverify_required", i%2 == 0)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		session := c.Get("s1")
+		_ = session["src_ip"]
+		_ = session["reverify_required"]
+	}
+	<-done
+	if held["src_ip"] != "10.0.0.1" {
+		t.Fatalf("held entry was modified: %v", held)
+	}
+	if v := c.Get("s1")["src_ip"]; v != "10.0.0.234" {
+		t.Fatalf("unexpected value: %v", v)
+	}
+}
+
+func TestSessionCacheConcurrentIncrement(t *testing.T) {
+	c := &SessionCache{
+		Entries:  map[string]interface{}{},
+		activity: map[string]time.Time{},
+	}
+	c.Add("mfa", map[string]interface{}{"mfa_required": true})
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 250; j++ {
+				c.Increment("mfa", "mfa_attempts_totp")
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		session := c.Get("mfa")
+		_, _ = session["mfa_attempts_totp"].(int)
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	if v := c.Get("mfa")["mfa_attempts_totp"]; v != 1000 {
+		t.Fatalf("unexpected counter: %v", v)
+	}
+}
+
+func TestSessionCacheRevoke(t *testing.T) {
+	c := &SessionCache{
+		Entries:  map[string]interface{}{},
+		activity: map[string]time.Time{},
+	}
+	c.Add("s1", map[string]interface{}{"src_ip": "10.0.0.1"})
+	c.Touch("s1")
+	if c.IsRevoked("s1") {
+		t.Fatalf("active session reported as revoked")
+	}
+	c.Revoke("s1", time.Now().Add(time.Hour))
+	if !c.IsRevoked("s1") {
+		t.Fatalf("revoked session reported as active")
+	}
+	if _, exists := c.GetLastActivity("s1"); exists {
+		t.Fatalf("revoked session has activity")
+	}
+	if c.IsRevoked("s2") {
+		t.Fatalf("unknown session reported as revoked")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// SessionRecord is the exported form of an authenticated session. It
+// holds no secrets, e.g. the identity tokens of the providers.
+type SessionRecord struct {
+	ID              string                 `json:"id"`
+	Claims          *jwtclaims.UserClaims  `json:"claims"`
+	CustomClaims    map[string]interface{} `json:"custom_claims,omitempty"`
+	BackendName     string                 `json:"backend_name"`
+	BackendRealm    string                 `json:"backend_realm"`
+	BackendMethod   string                 `json:"backend_method"`
+	AuthenticatedAt time.Time              `json:"authenticated_at"`
+	SourceAddress   string                 `json:"src_ip,omitempty"`
+	UserAgent       string                 `json:"user_agent,omitempty"`
+	LastActivity    *time.Time             `json:"last_activity,omitempty"`
+}
+
+// Export returns the authenticated sessions. The pending sessions, e.g.
+// the ones awaiting the second factor, and the invalidated or expired
+// sessions are not exported.
+func (c *SessionCache) Export() []*SessionRecord {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var records []*SessionRecord
+	for entryID, data := range c.Entries {
+		session, ok := data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		authenticatedAt, ok := session["authenticated_at"].(time.Time)
+		if !ok || session["invalidated"] == true {
+			continue
+		}
+		claims, ok := session["claims"].(*jwtclaims.UserClaims)
+		if !ok || claims.Valid() != nil {
+			continue
+		}
+		record := &SessionRecord{
+			ID:              entryID,
+			Claims:          claims,
+			AuthenticatedAt: authenticatedAt,
+		}
+		record.BackendName, _ = session["backend_name"].(string)
+		record.BackendRealm, _ = session["backend_realm"].(string)
+		record.BackendMethod, _ = session["backend_method"].(string)
+		record.SourceAddress, _ = session["src_ip"].(string)
+		record.UserAgent, _ = session["user_agent"].(string)
+		record.CustomClaims, _ = session["custom_claims"].(map[string]interface{})
+		if ts, exists := c.activity[entryID]; exists {
+			record.LastActivity = &ts
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Import adds the exported sessions to the cache. It skips the expired
+// sessions and the sessions already present in the cache. It returns
+// the number of the imported sessions, or an error when a record is
+// malformed, in which case nothing is imported.
+func (c *SessionCache) Import(records []*SessionRecord) (int, error) {
+	for i, record := range records {
+		if err := record.validate(); err != nil {
+			return 0, fmt.Errorf("session record %d is malformed: %s", i, err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var count int
+	for _, record := range records {
+		if record.Claims.Valid() != nil {
+			continue
+		}
+		if _, exists := c.Entries[record.ID]; exists {
+			continue
+		}
+		session := map[string]interface{}{
+			"claims":           record.Claims,
+			"backend_name":     record.BackendName,
+			"backend_realm":    record.BackendRealm,
+			"backend_method":   record.BackendMethod,
+			"authenticated_at": record.AuthenticatedAt,
+			"src_ip":           record.SourceAddress,
+			"user_agent":       record.UserAgent,
+		}
+		if len(record.CustomClaims) > 0 {
+			session["custom_claims"] = record.CustomClaims
+		}
+		c.Entries[record.ID] = session
+		if c.updated == nil {
+			c.updated = map[string]time.Time{}
+		}
+		c.updated[record.ID] = time.Now()
+		if record.LastActivity != nil {
+			c.activity[record.ID] = *record.LastActivity
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (record *SessionRecord) validate() error {
+	if record == nil {
+		return fmt.Errorf("record is empty")
+	}
+	if record.ID == "" {
+		return fmt.Errorf("id is empty")
+	}
+	if record.Claims == nil || record.Claims.Subject == "" {
+		return fmt.Errorf("claims are missing")
+	}
+	if record.Claims.ID != record.ID {
+		return fmt.Errorf("claims id does not match session id")
+	}
+	if record.BackendName == "" || record.BackendRealm == "" || record.BackendMethod == "" {
+		return fmt.Errorf("backend is missing")
+	}
+	if record.AuthenticatedAt.IsZero() || record.AuthenticatedAt.After(time.Now()) {
+		return fmt.Errorf("authentication time is invalid")
+	}
+	return nil
+}
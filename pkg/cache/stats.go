@@ -0,0 +1,101 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// SessionStats holds the statistics of the cached sessions.
+type SessionStats struct {
+	// The number of the authenticated sessions.
+	Sessions int `json:"sessions"`
+	// The number of the other cache entries, e.g. the sessions awaiting
+	// the second factor.
+	OtherEntries int `json:"other_entries"`
+	// The number of the authenticated sessions, keyed by realm.
+	Realms map[string]int `json:"realms"`
+	// The number of the authenticated sessions, keyed by backend name.
+	Backends map[string]int `json:"backends"`
+	// The age, in seconds, of the oldest and the newest sessions.
+	OldestSessionAge int64 `json:"oldest_session_age,omitempty"`
+	NewestSessionAge int64 `json:"newest_session_age,omitempty"`
+	// The number of the expired entries removed from the cache.
+	Evictions int `json:"evictions"`
+	// The time the statistics were collected at.
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+type sessionStatsEntry struct {
+	realm           string
+	backend         string
+	authenticatedAt time.Time
+}
+
+// Stats returns the statistics of the cached sessions. The lock is held
+// only while the entries are copied. The statistics are computed after
+// the lock is released.
+func (c *SessionCache) Stats() *SessionStats {
+	c.mu.RLock()
+	entries := make([]*sessionStatsEntry, 0, len(c.Entries))
+	total := len(c.Entries)
+	evictions := c.evictions
+	for _, data := range c.Entries {
+		session, ok := data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		authenticatedAt, ok := session["authenticated_at"].(time.Time)
+		if !ok {
+			continue
+		}
+		if _, ok := session["claims"].(*jwtclaims.UserClaims); !ok {
+			continue
+		}
+		entry := &sessionStatsEntry{authenticatedAt: authenticatedAt}
+		entry.realm, _ = session["backend_realm"].(string)
+		entry.backend, _ = session["backend_name"].(string)
+		entries = append(entries, entry)
+	}
+	c.mu.RUnlock()
+
+	now := time.Now()
+	stats := &SessionStats{
+		Sessions:     len(entries),
+		OtherEntries: total - len(entries),
+		Realms:       make(map[string]int),
+		Backends:     make(map[string]int),
+		Evictions:    evictions,
+		CollectedAt:  now.UTC(),
+	}
+	var oldest, newest time.Time
+	for _, entry := range entries {
+		stats.Realms[entry.realm]++
+		stats.Backends[entry.backend]++
+		if oldest.IsZero() || entry.authenticatedAt.Before(oldest) {
+			oldest = entry.authenticatedAt
+		}
+		if newest.IsZero() || entry.authenticatedAt.After(newest) {
+			newest = entry.authenticatedAt
+		}
+	}
+	if len(entries) > 0 {
+		stats.OldestSessionAge = int64(now.Sub(oldest).Seconds())
+		stats.NewestSessionAge = int64(now.Sub(newest).Seconds())
+	}
+	return stats
+}
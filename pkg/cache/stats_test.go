@@ -0,0 +1,77 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestSessionStats(t *testing.T) {
+	c := &SessionCache{
+		Entries:   map[string]interface{}{},
+		activity:  map[string]time.Time{},
+		evictions: 5,
+	}
+	now := time.Now()
+	c.Add("s1", map[string]interface{}{
+		"claims":           &jwtclaims.UserClaims{Subject: "jsmith"},
+		"backend_name":     "azure",
+		"backend_realm":    "contoso.com",
+		"authenticated_at": now.Add(-time.Hour),
+	})
+	c.Add("s2", map[string]interface{}{
+		"claims":           &jwtclaims.UserClaims{Subject: "jdoe"},
+		"backend_name":     "azure",
+		"backend_realm":    "contoso.com",
+		"authenticated_at": now.Add(-time.Minute),
+	})
+	c.Add("s3", map[string]interface{}{
+		"claims":           &jwtclaims.UserClaims{Subject: "webadmin"},
+		"backend_name":     "local_db",
+		"backend_realm":    "local",
+		"authenticated_at": now.Add(-10 * time.Minute),
+	})
+	c.Add("pending", map[string]interface{}{
+		"claims":       &jwtclaims.UserClaims{Subject: "jsmith"},
+		"backend_name": "local_db",
+	})
+	c.Add("other", "value")
+
+	stats := c.Stats()
+	if stats.Sessions != 3 || stats.OtherEntries != 2 || stats.Evictions != 5 {
+		t.Fatalf("unexpected counts: %+v", stats)
+	}
+	if !reflect.DeepEqual(stats.Realms, map[string]int{"contoso.com": 2, "local": 1}) {
+		t.Fatalf("unexpected realms: %v", stats.Realms)
+	}
+	if !reflect.DeepEqual(stats.Backends, map[string]int{"azure": 2, "local_db": 1}) {
+		t.Fatalf("unexpected backends: %v", stats.Backends)
+	}
+	if stats.OldestSessionAge < 3599 || stats.OldestSessionAge > 3601 {
+		t.Fatalf("unexpected oldest session age: %d", stats.OldestSessionAge)
+	}
+	if stats.NewestSessionAge < 59 || stats.NewestSessionAge > 61 {
+		t.Fatalf("unexpected newest session age: %d", stats.NewestSessionAge)
+	}
+
+	empty := (&SessionCache{Entries: map[string]interface{}{}}).Stats()
+	if empty.Sessions != 0 || empty.OldestSessionAge != 0 || empty.Realms == nil {
+		t.Fatalf("unexpected empty stats: %+v", empty)
+	}
+}
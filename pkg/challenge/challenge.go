@@ -0,0 +1,100 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package challenge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+}
+
+// Data is the data available to the template of the body.
+type Data struct {
+	// The status message, e.g. Authentication Failed.
+	Message string
+	// The details of the failure, if any.
+	Details string
+	// The URL of the login page.
+	LoginURL string
+	// The realms of the authentication backends.
+	Realms []string
+	// The ID of the request.
+	RequestID string
+	// The status code of the response, i.e. 401.
+	StatusCode int
+}
+
+// Body is the JSON body of the 401 Unauthorized responses to the API
+// clients, rendered from a Go template.
+type Body struct {
+	// The Go template of the body, e.g. {"error": {{ json .Message }}}.
+	Template string `json:"template,omitempty"`
+	tmpl     *template.Template
+}
+
+// Configure parses the template. It renders the template with sample
+// data to make sure the output is valid JSON.
+func (b *Body) Configure() error {
+	if b.Template == "" {
+		return nil
+	}
+	tmpl, err := template.New("unauthorized_body").Funcs(templateFuncs).Parse(b.Template)
+	if err != nil {
+		return fmt.Errorf("unauthorized body template is invalid: %s", err)
+	}
+	b.tmpl = tmpl
+	sample := &Data{
+		Message:    "Authentication Failed",
+		Details:    "Authentication failed",
+		LoginURL:   "https://localhost/auth/login",
+		Realms:     []string{"local"},
+		RequestID:  "00000000-0000-0000-0000-000000000000",
+		StatusCode: 401,
+	}
+	if _, err := b.Render(sample); err != nil {
+		b.tmpl = nil
+		return err
+	}
+	return nil
+}
+
+// Enabled returns true when the body template is configured.
+func (b *Body) Enabled() bool {
+	return b != nil && b.tmpl != nil
+}
+
+// Render returns the body rendered with the data. It returns an error
+// when the output is not valid JSON.
+func (b *Body) Render(data *Data) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := b.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("unauthorized body rendering failed: %s", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("unauthorized body is not valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
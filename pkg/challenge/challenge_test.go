@@ -0,0 +1,91 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package challenge
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRenderBody(t *testing.T) {
+	testFailed := 0
+	data := &Data{
+		Message:    "Authentication Failed",
+		Details:    `user "jsmith" not found`,
+		LoginURL:   "https://auth.contoso.com/auth/login",
+		Realms:     []string{"local", "contoso.com"},
+		RequestID:  "b3a7c0c2",
+		StatusCode: 401,
+	}
+	tests := []struct {
+		template   string
+		expected   string
+		shouldFail bool
+	}{
+		{
+			template: `{"error": {{ json .Message }}, "error_description": {{ json .Details }}}`,
+			expected: `{"error": "Authentication Failed", "error_description": "user \"jsmith\" not found"}`,
+		},
+		{
+			template: `{"code": {{ .StatusCode }}, "login_url": {{ json .LoginURL }}, "realms": {{ json .Realms }}}`,
+			expected: `{"code": 401, "login_url": "https://auth.contoso.com/auth/login", "realms": ["local","contoso.com"]}`,
+		},
+		{
+			template:   `{"error": {{ .Message }}}`,
+			shouldFail: true,
+		},
+		{
+			template:   `{"error": {{ json .Reason }}}`,
+			shouldFail: true,
+		},
+		{
+			template:   `{"error": {{ json .Message }`,
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, template: %s", i, test.template)
+		body := &Body{Template: test.template}
+		if err := body.Configure(); err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		payload, err := body.Render(data)
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if string(payload) != test.expected {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, test.expected, payload)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
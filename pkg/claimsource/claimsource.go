@@ -0,0 +1,96 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package claimsource
+
+import (
+	"fmt"
+)
+
+// Priority maps the name of a claim, e.g. email, to the ordered list of
+// the sources the claim is taken from, e.g. the id_token and userinfo
+// sources of an OpenID Connect provider. When the claim is available
+// from multiple sources, the value from the first listed source having
+// the value wins. The sources absent in the list are ignored.
+type Priority map[string][]string
+
+// Validate returns an error when the priority references the claims or
+// the sources absent in the supported map. The map holds the supported
+// sources of each claim. A nil list of sources permits any source, e.g.
+// an LDAP attribute.
+func (p Priority) Validate(supported map[string][]string) error {
+	for claimName, sources := range p {
+		allowed, exists := supported[claimName]
+		if !exists {
+			return fmt.Errorf("claim source priority has unsupported claim: %s", claimName)
+		}
+		if len(sources) == 0 {
+			return fmt.Errorf("claim source priority for %s claim has no sources", claimName)
+		}
+		seen := make(map[string]bool)
+		for _, source := range sources {
+			if source == "" {
+				return fmt.Errorf("claim source priority for %s claim has empty source", claimName)
+			}
+			if seen[source] {
+				return fmt.Errorf("claim source priority for %s claim has duplicate source: %s", claimName, source)
+			}
+			seen[source] = true
+			if allowed != nil && !contains(allowed, source) {
+				return fmt.Errorf("claim source priority for %s claim has unsupported source: %s", claimName, source)
+			}
+		}
+	}
+	return nil
+}
+
+// Order returns the ordered sources of the claim. When the priority
+// has no entry for the claim, it returns the default order.
+func (p Priority) Order(claimName string, defaultOrder []string) []string {
+	if sources, exists := p[claimName]; exists {
+		return sources
+	}
+	return defaultOrder
+}
+
+// Has returns true when any claim lists the source.
+func (p Priority) Has(source string) bool {
+	for _, sources := range p {
+		if contains(sources, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the value of the claim from the highest priority
+// source having a non-empty value, along with the name of the source.
+// It returns empty strings when none of the sources has the value.
+func (p Priority) Resolve(claimName string, defaultOrder []string, values map[string]string) (string, string) {
+	for _, source := range p.Order(claimName, defaultOrder) {
+		if v := values[source]; v != "" {
+			return v, source
+		}
+	}
+	return "", ""
+}
+
+func contains(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package claimsource
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	testFailed := 0
+	defaultOrder := []string{"id_token", "userinfo"}
+	tests := []struct {
+		priority Priority
+		values   map[string]string
+		value    string
+		source   string
+	}{
+		{
+			values: map[string]string{"id_token": "jsmith@contoso.com", "userinfo": "john.smith@contoso.com"},
+			value:  "jsmith@contoso.com",
+			source: "id_token",
+		},
+		{
+			priority: Priority{"email": {"userinfo", "id_token"}},
+			values:   map[string]string{"id_token": "jsmith@contoso.com", "userinfo": "john.smith@contoso.com"},
+			value:    "john.smith@contoso.com",
+			source:   "userinfo",
+		},
+		{
+			priority: Priority{"email": {"userinfo", "id_token"}},
+			values:   map[string]string{"id_token": "jsmith@contoso.com", "userinfo": ""},
+			value:    "jsmith@contoso.com",
+			source:   "id_token",
+		},
+		{
+			priority: Priority{"email": {"userinfo"}},
+			values:   map[string]string{"id_token": "jsmith@contoso.com"},
+		},
+		{
+			priority: Priority{"name": {"userinfo"}},
+			values:   map[string]string{"id_token": "jsmith@contoso.com", "userinfo": "john.smith@contoso.com"},
+			value:    "jsmith@contoso.com",
+			source:   "id_token",
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, priority: %v, values: %v", i, test.priority, test.values)
+		value, source := test.priority.Resolve("email", defaultOrder, test.values)
+		if value != test.value || source != test.source {
+			t.Logf("FAIL: %s, expected: %s from %s, received: %s from %s", testDescr, test.value, test.source, value, source)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testFailed := 0
+	supported := map[string][]string{
+		"email": {"id_token", "userinfo"},
+		"mail":  nil,
+	}
+	tests := []struct {
+		priority   Priority
+		shouldFail bool
+	}{
+		{priority: Priority{"email": {"userinfo", "id_token"}}},
+		{priority: Priority{"mail": {"mail", "userPrincipalName"}}},
+		{priority: Priority{"email": {"san"}}, shouldFail: true},
+		{priority: Priority{"email": {"userinfo", "userinfo"}}, shouldFail: true},
+		{priority: Priority{"email": {}}, shouldFail: true},
+		{priority: Priority{"phone": {"userinfo"}}, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, priority: %v", i, test.priority)
+		err := test.priority.Validate(supported)
+		if (err != nil) != test.shouldFail {
+			t.Logf("FAIL: %s, expected failure: %t, received error: %v", testDescr, test.shouldFail, err)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
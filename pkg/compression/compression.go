@@ -0,0 +1,200 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMinSize is the default minimum number of bytes in a response
+// body eligible for compression.
+const DefaultMinSize = 1024
+
+// compressibleTypes are the media types worth compressing. The images,
+// other than SVG, and fonts are already compressed.
+var compressibleTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// Compression represent a common set of configuration settings for
+// the compression of the responses of the portal.
+type Compression struct {
+	// The switch determining whether the compression is enabled.
+	Enabled bool `json:"enabled,omitempty"`
+	// The minimum number of bytes in a response body eligible for
+	// compression. The smaller responses are sent as is.
+	MinSize int `json:"min_size,omitempty"`
+}
+
+// Configure sets default values.
+func (c *Compression) Configure() error {
+	if c.MinSize < 1 {
+		c.MinSize = DefaultMinSize
+	}
+	return nil
+}
+
+// NewResponseWriter returns the writer compressing the response to the
+// request, if the compression is enabled, and the unchanged writer
+// otherwise. The Close method of the returned writer must be called
+// after the response is written.
+func (c *Compression) NewResponseWriter(w http.ResponseWriter, r *http.Request) *ResponseWriter {
+	cw := &ResponseWriter{ResponseWriter: w}
+	if c == nil || !c.Enabled || r.Method == "HEAD" {
+		cw.passthrough = true
+		return cw
+	}
+	cw.encoding = getEncoding(r.Header.Get("Accept-Encoding"))
+	cw.minSize = c.MinSize
+	return cw
+}
+
+// ResponseWriter buffers the response body, and compresses it when the
+// response is eligible for compression.
+type ResponseWriter struct {
+	http.ResponseWriter
+	passthrough bool
+	encoding    string
+	minSize     int
+	statusCode  int
+	buf         bytes.Buffer
+}
+
+// WriteHeader records the status code of the response.
+func (cw *ResponseWriter) WriteHeader(statusCode int) {
+	if cw.passthrough {
+		cw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if cw.statusCode == 0 {
+		cw.statusCode = statusCode
+	}
+}
+
+// Write buffers the response body.
+func (cw *ResponseWriter) Write(b []byte) (int, error) {
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(b)
+	}
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	return cw.buf.Write(b)
+}
+
+// Close writes the buffered response, compressed if eligible.
+func (cw *ResponseWriter) Close() error {
+	if cw.passthrough {
+		return nil
+	}
+	cw.passthrough = true
+	if cw.statusCode == 0 {
+		return nil
+	}
+	h := cw.Header()
+	if isCompressible(h) {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if cw.encoding == "" || cw.buf.Len() < cw.minSize || cw.statusCode != http.StatusOK ||
+		h.Get("Content-Encoding") != "" || !isCompressible(h) {
+		cw.ResponseWriter.WriteHeader(cw.statusCode)
+		_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+		return err
+	}
+
+	var compressed bytes.Buffer
+	var encoder io.WriteCloser
+	switch cw.encoding {
+	case "gzip":
+		encoder = gzip.NewWriter(&compressed)
+	default:
+		encoder, _ = flate.NewWriter(&compressed, flate.DefaultCompression)
+	}
+	if _, err := encoder.Write(cw.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	// The compressed representation is not byte-for-byte identical.
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	_, err := cw.ResponseWriter.Write(compressed.Bytes())
+	return err
+}
+
+// Flush writes the buffered response uncompressed and stops buffering, so
+// that the streaming responses, e.g. server-sent events, reach the client
+// as they are written.
+func (cw *ResponseWriter) Flush() {
+	if !cw.passthrough {
+		cw.passthrough = true
+		if cw.statusCode != 0 {
+			cw.ResponseWriter.WriteHeader(cw.statusCode)
+			cw.ResponseWriter.Write(cw.buf.Bytes())
+			cw.buf.Reset()
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func isCompressible(h http.Header) bool {
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// getEncoding returns the preferred supported encoding from the value
+// of the Accept-Encoding header, i.e. gzip or deflate.
+func getEncoding(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(entry, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := ""
+		if len(parts) > 1 {
+			q = strings.ReplaceAll(strings.TrimSpace(parts[1]), " ", "")
+		}
+		if q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+			continue
+		}
+		accepted[name] = true
+	}
+	for _, name := range []string{"gzip", "deflate"} {
+		if accepted[name] {
+			return name
+		}
+	}
+	return ""
+}
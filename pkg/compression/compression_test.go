@@ -0,0 +1,102 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	testFailed := 0
+	c := &Compression{Enabled: true}
+	if err := c.Configure(); err != nil {
+		t.Fatalf("failed configuring compression: %s", err)
+	}
+	largeBody := strings.Repeat("<p>Sign In</p>", 200)
+	tests := []struct {
+		method         string
+		acceptEncoding string
+		contentType    string
+		body           string
+		encoding       string
+		vary           bool
+	}{
+		{method: "GET", acceptEncoding: "gzip, deflate, br", contentType: "text/html", body: largeBody, encoding: "gzip", vary: true},
+		{method: "GET", acceptEncoding: "deflate", contentType: "text/css", body: largeBody, encoding: "deflate", vary: true},
+		{method: "GET", acceptEncoding: "gzip;q=0, deflate", contentType: "text/html", body: largeBody, encoding: "deflate", vary: true},
+		{method: "GET", acceptEncoding: "br", contentType: "text/html", body: largeBody, vary: true},
+		{method: "GET", contentType: "text/html", body: largeBody, vary: true},
+		{method: "GET", acceptEncoding: "gzip", contentType: "text/html", body: "<p>Sign In</p>", vary: true},
+		{method: "GET", acceptEncoding: "gzip", contentType: "image/png", body: largeBody},
+		{method: "HEAD", acceptEncoding: "gzip", contentType: "text/html", body: largeBody},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, method: %s, accept encoding: %s, content type: %s, size: %d",
+			i, test.method, test.acceptEncoding, test.contentType, len(test.body))
+		r := httptest.NewRequest(test.method, "/auth/login", nil)
+		if test.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		w := c.NewResponseWriter(rr, r)
+		w.Header().Set("Content-Type", test.contentType)
+		w.WriteHeader(200)
+		w.Write([]byte(test.body))
+		if err := w.Close(); err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if encoding := rr.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Logf("FAIL: %s, encoding mismatch: %q (expected) vs. %q (received)", testDescr, test.encoding, encoding)
+			testFailed++
+			continue
+		}
+		if vary := rr.Header().Get("Vary") == "Accept-Encoding"; vary != test.vary {
+			t.Logf("FAIL: %s, vary header mismatch: %s", testDescr, rr.Header().Get("Vary"))
+			testFailed++
+			continue
+		}
+		if test.encoding == "gzip" {
+			reader, err := gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Logf("FAIL: %s, failed decompressing body: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			body, _ := ioutil.ReadAll(reader)
+			if string(body) != test.body {
+				t.Logf("FAIL: %s, decompressed body mismatch", testDescr)
+				testFailed++
+				continue
+			}
+		}
+		if test.encoding == "" && rr.Body.String() != test.body {
+			t.Logf("FAIL: %s, body mismatch", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
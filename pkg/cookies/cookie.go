@@ -15,7 +15,13 @@
 package cookies
 
 import (
+	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
 )
 
 // Cookies represent a common set of configuration settings
@@ -23,6 +29,150 @@ import (
 type Cookies struct {
 	Domain string `json:"domain,omitempty"`
 	Path   string `json:"path,omitempty"`
+	// The rules selecting the lifetime of the JWT token cookie based
+	// on user claims. The first matching rule wins.
+	LifetimeRules []*LifetimeRule `json:"lifetime_rules,omitempty"`
+	// The maximum size of the JWT token in bytes. Zero disables the limit.
+	MaxTokenSize int `json:"max_token_size,omitempty"`
+	// The response to the token exceeding the maximum size, i.e. trim
+	// or fail.
+	TokenSizeAction string `json:"token_size_action,omitempty"`
+	// The low-priority claims removed from the token exceeding the
+	// maximum size, in the order of removal.
+	TrimClaims []string `json:"trim_claims,omitempty"`
+	// The attributes conveying the cookie lifetime, i.e. max-age,
+	// expires, both, or session. With session, the JWT token cookie
+	// is a session cookie. When empty, the cookies are set with Max-Age
+	// and cleared with Expires.
+	Expiry string `json:"expiry,omitempty"`
+	// When enabled, the name of the JWT token cookie is derived from the
+	// realm the user authenticated with, e.g. access_token_contoso.com.
+	PerRealm bool `json:"per_realm,omitempty"`
+	// The shared secret signing the value of the redirect cookie. When
+	// set, the portal ignores the redirect cookies failing the signature
+	// verification, e.g. the ones modified by clients.
+	RedirectSecret string `json:"redirect_secret,omitempty"`
+}
+
+// LifetimeRule sets the lifetime of the JWT token cookie for the users
+// having either the role or the claim with the value.
+type LifetimeRule struct {
+	Role  string `json:"role,omitempty"`
+	Claim string `json:"claim,omitempty"`
+	Value string `json:"value,omitempty"`
+	// The lifetime in seconds.
+	Lifetime int `json:"lifetime,omitempty"`
+}
+
+// Validate checks the lifetime rules.
+func (c *Cookies) Validate() error {
+	for i, rule := range c.LifetimeRules {
+		if rule.Lifetime < 1 {
+			return fmt.Errorf("cookie lifetime rule %d has invalid lifetime: %d", i, rule.Lifetime)
+		}
+		if rule.Role == "" && rule.Claim == "" {
+			return fmt.Errorf("cookie lifetime rule %d has neither role nor claim", i)
+		}
+		if rule.Role != "" && rule.Claim != "" {
+			return fmt.Errorf("cookie lifetime rule %d has both role and claim", i)
+		}
+	}
+	if c.MaxTokenSize < 0 {
+		return fmt.Errorf("max token size must not be negative: %d", c.MaxTokenSize)
+	}
+	switch c.TokenSizeAction {
+	case "":
+		c.TokenSizeAction = "fail"
+	case "fail":
+	case "trim":
+		if len(c.TrimClaims) == 0 {
+			return fmt.Errorf("token size action trim requires trim claims")
+		}
+	default:
+		return fmt.Errorf("unsupported token size action: %s", c.TokenSizeAction)
+	}
+	for _, claim := range c.TrimClaims {
+		switch claim {
+		case "sub", "exp", "iat", "iss", "jti", "aud", "nbf", "email", "cnf":
+			return fmt.Errorf("claim %s cannot be trimmed", claim)
+		}
+	}
+	switch c.Expiry {
+	case "", "max-age", "expires", "both":
+	case "session":
+		if len(c.LifetimeRules) > 0 {
+			return fmt.Errorf("cookie expiry session conflicts with cookie lifetime rules")
+		}
+	default:
+		return fmt.Errorf("unsupported cookie expiry: %s", c.Expiry)
+	}
+	if c.RedirectSecret != "" && len(c.RedirectSecret) < minRedirectSecretLength {
+		return fmt.Errorf("redirect cookie secret must be at least %d characters long", minRedirectSecretLength)
+	}
+	return nil
+}
+
+// IsSessionOnly returns true when the JWT token cookie is a session
+// cookie.
+func (c *Cookies) IsSessionOnly() bool {
+	return c.Expiry == "session"
+}
+
+// GetTokenName returns the name of the JWT token cookie of the realm. The
+// characters not allowed in cookie names are replaced with underscores.
+func (c *Cookies) GetTokenName(tokenName, realm string) string {
+	if !c.PerRealm || realm == "" {
+		return tokenName
+	}
+	name := []byte(realm)
+	for i, ch := range name {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-', ch == '.', ch == '_':
+		default:
+			name[i] = '_'
+		}
+	}
+	return tokenName + "_" + string(name)
+}
+
+// GetLifetime returns the lifetime of the first lifetime rule matching
+// the claims. It returns zero when no rules match.
+func (c *Cookies) GetLifetime(claims *jwtclaims.UserClaims, customClaims map[string]interface{}) int {
+	if claims == nil {
+		return 0
+	}
+	for _, rule := range c.LifetimeRules {
+		if rule.match(claims, customClaims) {
+			return rule.Lifetime
+		}
+	}
+	return 0
+}
+
+func (rule *LifetimeRule) match(claims *jwtclaims.UserClaims, customClaims map[string]interface{}) bool {
+	if rule.Role != "" {
+		for _, role := range claims.Roles {
+			if role == rule.Role {
+				return true
+			}
+		}
+		return false
+	}
+	switch rule.Claim {
+	case "sub":
+		return claims.Subject == rule.Value
+	case "email":
+		return claims.Email == rule.Value
+	case "name":
+		return claims.Name == rule.Value
+	case "origin":
+		return claims.Origin == rule.Value
+	}
+	if v, exists := customClaims[rule.Claim]; exists {
+		return fmt.Sprint(v) == rule.Value
+	}
+	return false
 }
 
 // GetAttributes returns cookie attributes.
@@ -40,6 +190,21 @@ func (c *Cookies) GetAttributes() string {
 	return sb.String()
 }
 
+// GetAttributesWithLifetime returns cookie attributes with the Max-Age
+// or Expires attributes, or both, set to the lifetime in seconds.
+func (c *Cookies) GetAttributesWithLifetime(lifetime int) string {
+	var sb strings.Builder
+	sb.WriteString(c.GetAttributes())
+	if c.Expiry == "expires" || c.Expiry == "both" {
+		expiresAt := time.Now().Add(time.Duration(lifetime) * time.Second)
+		sb.WriteString(" Expires=" + expiresAt.UTC().Format(http.TimeFormat) + ";")
+	}
+	if c.Expiry != "expires" {
+		sb.WriteString(" Max-Age=" + strconv.Itoa(lifetime) + ";")
+	}
+	return sb.String()
+}
+
 // GetDeleteAttributes returns cookie attributes for delete action.
 func (c *Cookies) GetDeleteAttributes() string {
 	var sb strings.Builder
@@ -51,5 +216,11 @@ func (c *Cookies) GetDeleteAttributes() string {
 	} else {
 		sb.WriteString(" Path=/;")
 	}
+	if c.Expiry != "max-age" {
+		sb.WriteString(" Expires=Thu, 01 Jan 1970 00:00:00 GMT;")
+	}
+	if c.Expiry == "max-age" || c.Expiry == "both" {
+		sb.WriteString(" Max-Age=0;")
+	}
 	return sb.String()
 }
@@ -0,0 +1,231 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cookies
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestGetLifetime(t *testing.T) {
+	testFailed := 0
+	c := &Cookies{
+		LifetimeRules: []*LifetimeRule{
+			{Role: "service", Lifetime: 86400},
+			{Claim: "email", Value: "admin@contoso.com", Lifetime: 900},
+			{Claim: "department", Value: "IT", Lifetime: 3600},
+		},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("failed validating lifetime rules: %s", err)
+	}
+	tests := []struct {
+		claims       *jwtclaims.UserClaims
+		customClaims map[string]interface{}
+		lifetime     int
+	}{
+		{
+			claims:   &jwtclaims.UserClaims{Subject: "jsmith", Roles: []string{"viewer"}},
+			lifetime: 0,
+		},
+		{
+			claims:   &jwtclaims.UserClaims{Subject: "svc", Roles: []string{"viewer", "service"}},
+			lifetime: 86400,
+		},
+		{
+			claims:   &jwtclaims.UserClaims{Subject: "admin", Email: "admin@contoso.com", Roles: []string{"service"}},
+			lifetime: 86400,
+		},
+		{
+			claims:   &jwtclaims.UserClaims{Subject: "admin", Email: "admin@contoso.com"},
+			lifetime: 900,
+		},
+		{
+			claims:       &jwtclaims.UserClaims{Subject: "jsmith"},
+			customClaims: map[string]interface{}{"department": "IT"},
+			lifetime:     3600,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, claims: %v, custom claims: %v", i, test.claims, test.customClaims)
+		lifetime := c.GetLifetime(test.claims, test.customClaims)
+		if lifetime != test.lifetime {
+			t.Logf("FAIL: %s, expected: %d, received: %d", testDescr, test.lifetime, lifetime)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestGetAttributesWithLifetime(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		expiry     string
+		set        []string
+		clear      []string
+		shouldFail bool
+	}{
+		{expiry: "", set: []string{"Max-Age=60;"}, clear: []string{"Expires=Thu, 01 Jan 1970"}},
+		{expiry: "max-age", set: []string{"Max-Age=60;"}, clear: []string{"Max-Age=0;"}},
+		{expiry: "expires", set: []string{"Expires="}, clear: []string{"Expires=Thu, 01 Jan 1970"}},
+		{expiry: "both", set: []string{"Expires=", "Max-Age=60;"}, clear: []string{"Expires=Thu, 01 Jan 1970", "Max-Age=0;"}},
+		{expiry: "session", set: []string{"Max-Age=60;"}, clear: []string{"Expires=Thu, 01 Jan 1970"}},
+		{expiry: "never", shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, expiry: %s", i, test.expiry)
+		c := &Cookies{Expiry: test.expiry}
+		if err := c.Validate(); err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+			}
+			continue
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		setAttrs := c.GetAttributesWithLifetime(60)
+		clearAttrs := c.GetDeleteAttributes()
+		mismatch := false
+		for _, attr := range test.set {
+			if !strings.Contains(setAttrs, attr) {
+				t.Logf("FAIL: %s, set attributes %q lack %q", testDescr, setAttrs, attr)
+				mismatch = true
+			}
+		}
+		for _, attr := range test.clear {
+			if !strings.Contains(clearAttrs, attr) {
+				t.Logf("FAIL: %s, clear attributes %q lack %q", testDescr, clearAttrs, attr)
+				mismatch = true
+			}
+		}
+		if test.expiry == "expires" && strings.Contains(setAttrs, "Max-Age") {
+			t.Logf("FAIL: %s, set attributes %q have Max-Age", testDescr, setAttrs)
+			mismatch = true
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	c := &Cookies{Expiry: "session", LifetimeRules: []*LifetimeRule{{Role: "service", Lifetime: 60}}}
+	if err := c.Validate(); err == nil {
+		t.Logf("FAIL: session expiry with lifetime rules, expected error")
+		testFailed++
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestGetTokenName(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		perRealm bool
+		realm    string
+		expected string
+	}{
+		{realm: "contoso.com", expected: "access_token"},
+		{perRealm: true, realm: "", expected: "access_token"},
+		{perRealm: true, realm: "local", expected: "access_token_local"},
+		{perRealm: true, realm: "contoso.com", expected: "access_token_contoso.com"},
+		{perRealm: true, realm: "r&d;team", expected: "access_token_r_d_team"},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, per realm: %t, realm: %s", i, test.perRealm, test.realm)
+		c := &Cookies{PerRealm: test.perRealm}
+		if name := c.GetTokenName("access_token", test.realm); name != test.expected {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, test.expected, name)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestVerifyRedirectURL(t *testing.T) {
+	testFailed := 0
+	redirectURL := "https://app.contoso.com/dashboard?tab=1"
+	signer := &Cookies{RedirectSecret: "0123456789abcdef"}
+	signed := signer.SignRedirectURL(redirectURL)
+	otherSigned := (&Cookies{RedirectSecret: "fedcba9876543210"}).SignRedirectURL(redirectURL)
+	i := strings.LastIndex(signed, ".")
+	tampered := (&Cookies{}).SignRedirectURL("https://evil.com/") + signed[i:]
+	tests := []struct {
+		name       string
+		cookies    *Cookies
+		value      string
+		shouldFail bool
+	}{
+		{name: "unsigned value without secret", cookies: &Cookies{}, value: redirectURL},
+		{name: "signed value", cookies: signer, value: signed},
+		{name: "unsigned value with secret", cookies: signer, value: redirectURL, shouldFail: true},
+		{name: "value signed with another secret", cookies: signer, value: otherSigned, shouldFail: true},
+		{name: "tampered value", cookies: signer, value: tampered, shouldFail: true},
+		{name: "malformed signature", cookies: signer, value: signed[:i] + ".!!!", shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.name)
+		if err := test.cookies.Validate(); err != nil {
+			t.Fatalf("FAIL: %s, unexpected validation error: %s", testDescr, err)
+		}
+		s, err := test.cookies.VerifyRedirectURL(test.value)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+			} else {
+				t.Logf("PASS: %s, error: %s", testDescr, err)
+			}
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if s != redirectURL {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, redirectURL, s)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if err := (&Cookies{RedirectSecret: "short"}).Validate(); err == nil {
+		t.Logf("FAIL: short redirect secret must be rejected")
+		testFailed++
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
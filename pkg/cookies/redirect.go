@@ -0,0 +1,68 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cookies
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const minRedirectSecretLength = 16
+
+// SignRedirectURL returns the value of the redirect cookie holding the
+// URL. When the redirect secret is set, the value is the URL and its
+// HMAC-SHA256 signature, both base64url-encoded and separated by a dot.
+// Otherwise, the value is the URL.
+func (c *Cookies) SignRedirectURL(s string) string {
+	if c.RedirectSecret == "" {
+		return s
+	}
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(s))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.signRedirect(encoded))
+}
+
+// VerifyRedirectURL returns the URL held by the value of the redirect
+// cookie. When the redirect secret is set, it returns an error for the
+// unsigned values and the values failing the signature verification.
+func (c *Cookies) VerifyRedirectURL(v string) (string, error) {
+	if c.RedirectSecret == "" {
+		return v, nil
+	}
+	i := strings.LastIndex(v, ".")
+	if i < 0 {
+		return "", fmt.Errorf("redirect cookie is not signed")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(v[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("redirect cookie signature is malformed")
+	}
+	if !hmac.Equal(sig, c.signRedirect(v[:i])) {
+		return "", fmt.Errorf("redirect cookie signature is invalid")
+	}
+	s, err := base64.RawURLEncoding.DecodeString(v[:i])
+	if err != nil {
+		return "", fmt.Errorf("redirect cookie value is malformed")
+	}
+	return string(s), nil
+}
+
+func (c *Cookies) signRedirect(s string) []byte {
+	h := hmac.New(sha256.New, []byte(c.RedirectSecret))
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// The responses to the change of the source address of a session.
+const (
+	sessionIPChangeIgnore     = "ignore"
+	sessionIPChangeReverify   = "reverify"
+	sessionIPChangeInvalidate = "invalidate"
+)
+
+// reverifyExemptPaths are the paths available to the sessions pending
+// re-verification.
+var reverifyExemptPaths = []string{"reverify", "logout", "logoff", "assets", "robots.txt"}
+
+func validateSessionIPChange(s string) error {
+	switch s {
+	case sessionIPChangeIgnore, sessionIPChangeReverify, sessionIPChangeInvalidate:
+		return nil
+	}
+	return fmt.Errorf("unsupported session ip change response: %s", s)
+}
+
+// checkSessionAddress applies the configured response when the source
+// address of the request differs from the address the session was
+// established from. The invalidated sessions are no longer accepted.
+// The sessions of the users authenticated with credentials may instead
+// require re-verification. It returns true when the session is pending
+// re-verification.
+func (p *AuthPortal) checkSessionAddress(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) bool {
+	if p.SessionIPChange == sessionIPChangeIgnore || !opts["authenticated"].(bool) {
+		return false
+	}
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	session := sessionCache.Get(claims.ID)
+	if session == nil {
+		return false
+	}
+	if session["invalidated"] == true {
+		p.invalidateSession(w, opts)
+		return false
+	}
+	if session["reverify_required"] == true {
+		return true
+	}
+	srcAddress, _ := session["src_ip"].(string)
+	addr, _ := opts["src_ip"].(string)
+	if srcAddress == "" || srcAddress == addr {
+		return false
+	}
+	p.logger.Warn("Session source address changed",
+		zap.String("request_id", opts["request_id"].(string)),
+		zap.String("session_id", claims.ID),
+		zap.String("user", claims.Subject),
+		zap.String("session_src_ip_address", srcAddress),
+		zap.String("src_ip_address", addr),
+		zap.String("response", p.SessionIPChange),
+	)
+	if p.SessionIPChange == sessionIPChangeReverify && canReverify(session) {
+		sessionCache.Set(claims.ID, "reverify_required", true)
+		return true
+	}
+	sessionCache.Set(claims.ID, "invalidated", true)
+	p.invalidateSession(w, opts)
+	return false
+}
+
+// getSourceAddress returns the source address of the request. The
+// forwarding headers count only for the requests of the trusted proxies,
+// because the clients are able to set them.
+func (p *AuthPortal) getSourceAddress(r *http.Request) string {
+	ip := utils.GetTrustedSourceAddress(r, p.trustedProxies)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// invalidateSession treats the request as unauthenticated and removes
+// the token cookie.
+func (p *AuthPortal) invalidateSession(w http.ResponseWriter, opts map[string]interface{}) {
+	opts["authenticated"] = false
+	delete(opts, "user_claims")
+	for _, name := range opts["token_cookie_names"].([]string) {
+		w.Header().Add("Set-Cookie", name+"=delete;"+p.Cookies.GetDeleteAttributes())
+	}
+}
+
+// canReverify returns true when the user authenticated with credentials
+// the portal is able to verify again, i.e. via local or LDAP backend.
+func canReverify(session map[string]interface{}) bool {
+	switch session["backend_method"] {
+	case "local", "ldap":
+		return true
+	}
+	return false
+}
+
+func isReverifyExempt(urlPath string) bool {
+	for _, s := range reverifyExemptPaths {
+		if strings.HasPrefix(urlPath, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+// getAuthMethodReferences returns the authentication method references,
+// as defined in RFC 8176, of the first factor verified by the backend.
+// The federated backends, e.g. oauth2 and saml, delegate the
+// authentication to the identity provider, so that the portal does not
+// know the methods.
+func getAuthMethodReferences(backendMethod string) []string {
+	switch backendMethod {
+	case "local", "ldap":
+		return []string{"pwd"}
+	case "x509":
+		return []string{"swk"}
+	}
+	return nil
+}
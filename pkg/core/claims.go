@@ -0,0 +1,126 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/denial"
+	"github.com/greenpau/caddy-auth-portal/pkg/webhook"
+)
+
+// requiredClaimsError is returned when the claims of an authenticated
+// user lack the claims required by the realm.
+type requiredClaimsError struct {
+	realm  string
+	claims []string
+}
+
+func (e *requiredClaimsError) Error() string {
+	return fmt.Sprintf("realm %s requires claims: %s", e.realm, strings.Join(e.claims, ", "))
+}
+
+// checkClaims returns an error when the claims lack any of the claims
+// required by the realm, or match any of the deny rules of the realm.
+func (p *AuthPortal) checkClaims(realm string, claims *jwtclaims.UserClaims, opts map[string]interface{}) error {
+	if err := p.checkRequiredClaims(realm, claims, opts); err != nil {
+		return err
+	}
+	var customClaims map[string]interface{}
+	if v, exists := opts["custom_claims"]; exists {
+		customClaims = v.(map[string]interface{})
+	}
+	return denial.Evaluate(p.DenyClaims, realm, claims, customClaims)
+}
+
+// getRequiredClaims returns the claims required by the realm, including
+// the ones required by all realms.
+func (p *AuthPortal) getRequiredClaims(realm string) []string {
+	var names []string
+	names = append(names, p.RequiredClaims["*"]...)
+	if realm != "*" {
+		names = append(names, p.RequiredClaims[realm]...)
+	}
+	return names
+}
+
+// checkRequiredClaims returns an error when any of the claims required
+// by the realm is absent or empty.
+func (p *AuthPortal) checkRequiredClaims(realm string, claims *jwtclaims.UserClaims, opts map[string]interface{}) error {
+	var customClaims map[string]interface{}
+	if v, exists := opts["custom_claims"]; exists {
+		customClaims = v.(map[string]interface{})
+	}
+	var missing []string
+	for _, name := range p.getRequiredClaims(realm) {
+		if !hasClaim(name, claims, customClaims) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return &requiredClaimsError{realm: realm, claims: missing}
+	}
+	return nil
+}
+
+// hasClaim returns true when the claim is present and non-empty.
+func hasClaim(name string, claims *jwtclaims.UserClaims, customClaims map[string]interface{}) bool {
+	switch name {
+	case "sub":
+		return claims.Subject != ""
+	case "email":
+		return claims.Email != ""
+	case "name":
+		return claims.Name != ""
+	case "origin":
+		return claims.Origin != ""
+	case "roles":
+		return len(claims.Roles) > 0
+	case "scopes":
+		return len(claims.Scopes) > 0
+	case "org":
+		return len(claims.Organizations) > 0
+	}
+	v, exists := customClaims[name]
+	if !exists || v == nil {
+		return false
+	}
+	switch value := v.(type) {
+	case string:
+		return value != ""
+	case []interface{}:
+		return len(value) > 0
+	case []string:
+		return len(value) > 0
+	}
+	return true
+}
+
+// getClaimsErrorMessage returns the message displayed to the user whose
+// claims failed the validation.
+func getClaimsErrorMessage(err error) string {
+	switch e := err.(type) {
+	case *webhook.DenyError:
+		return "Access denied: " + e.Reason
+	case *denial.DenyError:
+		return e.Rule.Message
+	case *requiredClaimsError:
+		return "Authentication failed: the identity provider did not supply the required claims: " + strings.Join(e.claims, ", ")
+	}
+	return "Authentication failed"
+}
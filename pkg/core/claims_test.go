@@ -0,0 +1,87 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestCheckRequiredClaims(t *testing.T) {
+	testFailed := 0
+	p := &AuthPortal{
+		RequiredClaims: map[string][]string{
+			"*":       {"email"},
+			"contoso": {"roles", "department"},
+		},
+	}
+	tests := []struct {
+		realm        string
+		claims       *jwtclaims.UserClaims
+		customClaims map[string]interface{}
+		missing      []string
+	}{
+		{
+			realm:  "local",
+			claims: &jwtclaims.UserClaims{Email: "jsmith@contoso.com"},
+		},
+		{
+			realm:   "local",
+			claims:  &jwtclaims.UserClaims{},
+			missing: []string{"email"},
+		},
+		{
+			realm:        "contoso",
+			claims:       &jwtclaims.UserClaims{Email: "jsmith@contoso.com", Roles: []string{"viewer"}},
+			customClaims: map[string]interface{}{"department": "IT"},
+		},
+		{
+			realm:        "contoso",
+			claims:       &jwtclaims.UserClaims{Email: "jsmith@contoso.com"},
+			customClaims: map[string]interface{}{"department": ""},
+			missing:      []string{"roles", "department"},
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, realm: %s", i, test.realm)
+		opts := make(map[string]interface{})
+		if test.customClaims != nil {
+			opts["custom_claims"] = test.customClaims
+		}
+		var missing []string
+		if err := p.checkRequiredClaims(test.realm, test.claims, opts); err != nil {
+			claimsErr, ok := err.(*requiredClaimsError)
+			if !ok {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			missing = claimsErr.claims
+		}
+		if !reflect.DeepEqual(missing, test.missing) {
+			t.Logf("FAIL: %s, expected missing: %v, received: %v", testDescr, test.missing, missing)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
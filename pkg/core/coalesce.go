@@ -0,0 +1,123 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+)
+
+// loginCall is an in-flight authentication shared by identical
+// concurrent login requests.
+type loginCall struct {
+	wg   sync.WaitGroup
+	resp map[string]interface{}
+	err  error
+	dups int
+}
+
+// loginGroup coalesces identical concurrent login requests, so that
+// they share one backend call. The result is not kept once the call
+// completes.
+type loginGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loginCall
+}
+
+// do calls the function, unless an identical call is in flight. Then, it
+// waits for the call and returns its result. Every caller, including the
+// one making the call, receives a copy of the result, so that a caller
+// modifying its result does not race with the others copying it.
+func (g *loginGroup) do(key string, fn func() (map[string]interface{}, error)) (map[string]interface{}, error, bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*loginCall)
+	}
+	if c, exists := g.calls[key]; exists {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return copyAuthResponse(c.resp), c.err, true
+	}
+	c := &loginCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.resp, c.err = fn()
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	c.wg.Done()
+	return copyAuthResponse(c.resp), c.err, false
+}
+
+// getLoginKey returns the key identifying the login request with the
+// credentials against the backend.
+func getLoginKey(backend *backends.Backend, credentials map[string]string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.Join([]string{
+		backend.GetRealm(),
+		backend.GetName(),
+		backend.GetMethod(),
+		credentials["username"],
+		credentials["password"],
+	}, "\x00")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// copyAuthResponse returns a copy of the authentication response. The
+// login path modifies the claims, so that each request gets its own.
+func copyAuthResponse(resp map[string]interface{}) map[string]interface{} {
+	if resp == nil {
+		return nil
+	}
+	m := make(map[string]interface{})
+	for k, v := range resp {
+		switch v.(type) {
+		case *jwtclaims.UserClaims:
+			claims := *v.(*jwtclaims.UserClaims)
+			claims.Audience = append([]string(nil), claims.Audience...)
+			claims.Roles = append([]string(nil), claims.Roles...)
+			claims.Scopes = append([]string(nil), claims.Scopes...)
+			claims.Organizations = append([]string(nil), claims.Organizations...)
+			if claims.AccessList != nil {
+				acl := &jwtclaims.AccessListClaim{}
+				if claims.AccessList.Paths != nil {
+					acl.Paths = make(map[string]interface{})
+					for path, v := range claims.AccessList.Paths {
+						acl.Paths[path] = v
+					}
+				}
+				claims.AccessList = acl
+			}
+			m[k] = &claims
+		case map[string]interface{}:
+			nm := make(map[string]interface{})
+			for nk, nv := range v.(map[string]interface{}) {
+				nm[nk] = nv
+			}
+			m[k] = nm
+		default:
+			m[k] = v
+		}
+	}
+	return m
+}
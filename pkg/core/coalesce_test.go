@@ -0,0 +1,148 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestLoginGroup(t *testing.T) {
+	var g loginGroup
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func() (map[string]interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return map[string]interface{}{
+			"code":   200,
+			"claims": &jwtclaims.UserClaims{Subject: "jsmith", Roles: []string{"viewer"}},
+		}, fmt.Errorf("authentication failed")
+	}
+
+	results := make([]map[string]interface{}, 5)
+	errs := make([]error, 5)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], errs[0], _ = g.do("key", fn)
+	}()
+	<-started
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i], _ = g.do("key", fn)
+		}(i)
+	}
+	// Wait for the duplicate calls to join the in-flight one.
+	for {
+		g.mu.Lock()
+		dups := g.calls["key"].dups
+		g.mu.Unlock()
+		if dups == len(results)-1 {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Logf("FAIL: backend calls: 1 (expected) vs. %d (received)", calls)
+		t.Fail()
+	}
+	for i := range results {
+		if errs[i] == nil || results[i]["code"] != 200 {
+			t.Fatalf("FAIL: result %d mismatch: %v, %v", i, results[i], errs[i])
+		}
+	}
+	results[1]["claims"].(*jwtclaims.UserClaims).Roles[0] = "admin"
+	if results[0]["claims"].(*jwtclaims.UserClaims).Roles[0] != "viewer" {
+		t.Fatalf("FAIL: shared claims are not copied")
+	}
+
+	// The failed result is not kept once the call completes.
+	if _, _, shared := g.do("key", fn); shared || calls != 2 {
+		t.Fatalf("FAIL: completed call result was reused, backend calls: %d", calls)
+	}
+}
+
+func TestLoginGroupLeaderMutation(t *testing.T) {
+	var g loginGroup
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func() (map[string]interface{}, error) {
+		close(started)
+		<-release
+		return map[string]interface{}{
+			"code":   200,
+			"claims": &jwtclaims.UserClaims{Subject: "jsmith", Roles: []string{"viewer"}},
+			"custom_claims": map[string]interface{}{
+				"team": "security",
+			},
+		}, nil
+	}
+
+	waiters := 8
+	results := make([]map[string]interface{}, waiters)
+	leaderDone := make(chan map[string]interface{})
+	go func() {
+		resp, _, _ := g.do("key", fn)
+		leaderDone <- resp
+	}()
+	<-started
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = g.do("key", fn)
+		}(i)
+	}
+	for {
+		g.mu.Lock()
+		dups := g.calls["key"].dups
+		g.mu.Unlock()
+		if dups == waiters {
+			break
+		}
+	}
+	close(release)
+
+	// The leader modifies its result, as the login path does, while the
+	// waiters copy theirs.
+	resp := <-leaderDone
+	claims := resp["claims"].(*jwtclaims.UserClaims)
+	claims.ID = "request-1"
+	claims.Issuer = "https://auth.contoso.com/auth"
+	claims.Roles[0] = "admin"
+	resp["custom_claims"].(map[string]interface{})["team"] = "admins"
+	wg.Wait()
+
+	for i, result := range results {
+		c := result["claims"].(*jwtclaims.UserClaims)
+		if c.ID != "" || c.Roles[0] != "viewer" || result["custom_claims"].(map[string]interface{})["team"] != "security" {
+			t.Fatalf("FAIL: result %d observed the leader modification: %+v", i, c)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// checkCredentialsTransport returns an error when the portal accepts
+// credentials only in the body of POST requests, and the request
+// carries them elsewhere, i.e. in the Authorization header of a
+// non-POST request or in the query string.
+func (p *AuthPortal) checkCredentialsTransport(r *http.Request) error {
+	if !p.PostOnlyCredentials {
+		return nil
+	}
+	if r.Method != "POST" && strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+		return fmt.Errorf("credentials must be submitted via POST, got %s", r.Method)
+	}
+	query := r.URL.Query()
+	for _, k := range []string{"username", "password"} {
+		if _, exists := query[k]; exists {
+			return fmt.Errorf("credentials must not be submitted in query string")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckCredentialsTransport(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		postOnly   bool
+		method     string
+		url        string
+		authz      string
+		shouldFail bool
+	}{
+		{method: "GET", url: "/auth/login", authz: "Basic anNtaXRoOnBhc3N3b3Jk"},
+		{method: "POST", url: "/auth/login?username=jsmith&password=secret"},
+		{postOnly: true, method: "GET", url: "/auth/login"},
+		{postOnly: true, method: "POST", url: "/auth/login"},
+		{postOnly: true, method: "POST", url: "/auth/login?redirect_url=/app"},
+		{postOnly: true, method: "GET", url: "/auth/login", authz: "Bearer abc"},
+		{postOnly: true, method: "GET", url: "/auth/login", authz: "Basic anNtaXRoOnBhc3N3b3Jk", shouldFail: true},
+		{postOnly: true, method: "PUT", url: "/auth/login", authz: "Basic anNtaXRoOnBhc3N3b3Jk", shouldFail: true},
+		{postOnly: true, method: "POST", url: "/auth/login?password=secret", shouldFail: true},
+		{postOnly: true, method: "GET", url: "/auth/login?username=jsmith", shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, post only: %t, method: %s, url: %s", i, test.postOnly, test.method, test.url)
+		p := &AuthPortal{PostOnlyCredentials: test.postOnly}
+		r := httptest.NewRequest(test.method, test.url, strings.NewReader(""))
+		if test.authz != "" {
+			r.Header.Set("Authorization", test.authz)
+		}
+		err := p.checkCredentialsTransport(r)
+		if test.shouldFail {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but received none", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/handlers"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"go.uber.org/zap"
+)
+
+// errInvalidDPoPProof is returned when the token of a request is bound to
+// a DPoP key and the request has no matching proof.
+var errInvalidDPoPProof = errors.New("invalid dpop proof")
+
+// authorize validates the token of the request, if any, and rejects the
+// tokens older than the maximum token age and the tokens of the sessions
+// logged out or invalidated by the portal.
+func (p *AuthPortal) authorize(r *http.Request) (*jwtclaims.UserClaims, bool, error) {
+	claims, authOK, err := p.authorizeToken(r)
+	if authOK {
+		if err := p.checkTokenAge(claims, time.Now()); err != nil {
+			return nil, false, err
+		}
+		if err := sessions.CheckRevoked(sessionCache, claims); err != nil {
+			return nil, false, err
+		}
+	}
+	return claims, authOK, err
+}
+
+// authorizeToken validates the token of the request, if any. When DPoP
+// is enabled, the tokens bound to the keys of the clients are valid only
+// with a matching proof. Such tokens may arrive via the DPoP scheme of
+// the Authorization header.
+func (p *AuthPortal) authorizeToken(r *http.Request) (*jwtclaims.UserClaims, bool, error) {
+	if handle := p.SessionHandles.GetHandle(r); handle != "" {
+		return p.authorizeSessionHandle(r, handle)
+	}
+	if !p.DPoP.Enabled {
+		claims, authOK, err := p.TokenValidator.Authorize(r, nil)
+		if authOK {
+			if err := p.checkTokenRealm(p.findToken(r), claims); err != nil {
+				return nil, false, err
+			}
+		}
+		return claims, authOK, err
+	}
+	var claims *jwtclaims.UserClaims
+	var authOK bool
+	var err error
+	token := getDPoPSchemeToken(r)
+	if token != "" {
+		claims, authOK, err = p.TokenValidator.ValidateToken(token, nil)
+	} else {
+		claims, authOK, err = p.TokenValidator.Authorize(r, nil)
+		if authOK {
+			token = p.findToken(r)
+		}
+	}
+	if !authOK {
+		return claims, authOK, err
+	}
+	if err := p.verifyTokenBinding(r, token); err != nil {
+		p.logger.Warn("DPoP proof validation failed",
+			zap.String("session_id", claims.ID),
+			zap.String("error", err.Error()),
+		)
+		return nil, false, errInvalidDPoPProof
+	}
+	if err := p.checkTokenRealm(token, claims); err != nil {
+		return nil, false, err
+	}
+	return claims, true, nil
+}
+
+// verifyTokenBinding checks that the request carries a valid proof for
+// the key the token is bound to. The tokens without the binding pass.
+func (p *AuthPortal) verifyTokenBinding(r *http.Request, token string) error {
+	if token == "" {
+		return fmt.Errorf("token not found")
+	}
+	tokenClaims := make(jwtlib.MapClaims)
+	if _, _, err := new(jwtlib.Parser).ParseUnverified(token, tokenClaims); err != nil {
+		return err
+	}
+	var jkt string
+	if cnf, ok := tokenClaims["cnf"].(map[string]interface{}); ok {
+		jkt, _ = cnf["jkt"].(string)
+	}
+	if jkt == "" {
+		return nil
+	}
+	proof, err := p.DPoP.Verify(r, token)
+	if err != nil {
+		return err
+	}
+	if proof.Thumbprint != jkt {
+		return fmt.Errorf("dpop proof key mismatch")
+	}
+	return nil
+}
+
+// findToken returns the token the validator found in the request.
+func (p *AuthPortal) findToken(r *http.Request) string {
+	v := p.TokenValidator
+	for _, sourceName := range v.TokenSources {
+		switch sourceName {
+		case "header":
+			if token, found := v.SearchAuthorizationHeader(r.Header.Get("Authorization"), nil); found {
+				return token
+			}
+		case "cookie":
+			if token, found := v.SearchCookies(r.Cookies()); found {
+				return token
+			}
+		case "query":
+			if token, found := v.SearchQueryValues(r.URL.Query()); found {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// getUserCustomClaims returns the custom claims of the token of the
+// authorized request, if any.
+func (p *AuthPortal) getUserCustomClaims(r *http.Request) map[string]interface{} {
+	var token string
+	if handle := p.SessionHandles.GetHandle(r); handle != "" {
+		token = p.SessionHandles.Resolve(sessionCache, handle)
+	} else if token = getDPoPSchemeToken(r); token == "" || !p.DPoP.Enabled {
+		token = p.findToken(r)
+	}
+	if token == "" {
+		return nil
+	}
+	customClaims, err := handlers.GetCustomClaims(token)
+	if err != nil {
+		return nil
+	}
+	return customClaims
+}
+
+// getDPoPSchemeToken returns the token passed via the DPoP scheme of
+// the Authorization header, e.g. "Authorization: DPoP <token>".
+func getDPoPSchemeToken(r *http.Request) string {
+	kv := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(kv) != 2 || !strings.EqualFold(kv[0], "DPoP") {
+		return ""
+	}
+	return strings.TrimSpace(kv[1])
+}
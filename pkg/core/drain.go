@@ -0,0 +1,81 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// loginTracker tracks the in-flight authentication requests, so that the
+// shutdown of the instance waits for them to complete.
+type loginTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+}
+
+// track registers an in-flight authentication request. The returned
+// function marks it completed. The requests arriving after the start of
+// the drain are not tracked.
+func (t *loginTracker) track() func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return func() {}
+	}
+	t.wg.Add(1)
+	return t.wg.Done
+}
+
+// drain waits for the in-flight authentication requests to complete. It
+// returns false when the timeout expires first.
+func (t *loginTracker) drain(timeout time.Duration) bool {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Cleanup waits up to the drain timeout for the in-flight authentication
+// requests to complete, ends the event stream subscriptions, and flushes
+// the trace spans. It is called when the server stops or reloads the
+// configuration.
+func (p *AuthPortal) Cleanup() error {
+	p.EventStream.Close()
+	defer p.Tracing.Close()
+	if p.DrainTimeout < 1 {
+		return nil
+	}
+	if !p.inflight.drain(time.Duration(p.DrainTimeout) * time.Second) {
+		p.logger.Warn("Drain of in-flight authentication requests timed out",
+			zap.String("instance_name", p.Name),
+			zap.Int("drain_timeout", p.DrainTimeout),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginTrackerDrain(t *testing.T) {
+	var tracker loginTracker
+	done := tracker.track()
+	if tracker.drain(50 * time.Millisecond) {
+		t.Fatalf("expected drain to time out with an in-flight request")
+	}
+	// The requests arriving during the drain are not waited for.
+	tracker.track()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done()
+	}()
+	if !tracker.drain(time.Second) {
+		t.Fatalf("expected drain to complete once the in-flight request is done")
+	}
+}
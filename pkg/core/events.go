@@ -0,0 +1,38 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/events"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+// publishEvent publishes the authentication event to the event stream.
+func (p *AuthPortal) publishEvent(r *http.Request, reqID, eventType, realm, user string) {
+	if p.EventStream == nil || !p.EventStream.Enabled() {
+		return
+	}
+	p.EventStream.Publish(&events.Event{
+		Type:          eventType,
+		Time:          time.Now().UTC(),
+		Realm:         realm,
+		User:          user,
+		SourceAddress: utils.GetSourceAddress(r),
+		RequestID:     reqID,
+	})
+}
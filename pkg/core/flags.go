@@ -0,0 +1,57 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"go.uber.org/zap"
+)
+
+// addFeatureFlags evaluates the feature flag rules against the claims
+// of an authenticated user. The enabled flags are added to the custom
+// claims of the issued token, or to the response header, depending on
+// the configured output.
+func (p *AuthPortal) addFeatureFlags(w http.ResponseWriter, reqID string, claims *jwtclaims.UserClaims, opts map[string]interface{}) {
+	if !p.FeatureFlags.Enabled() {
+		return
+	}
+	var customClaims map[string]interface{}
+	if v, exists := opts["custom_claims"]; exists {
+		customClaims = v.(map[string]interface{})
+	}
+	flags, err := p.FeatureFlags.Evaluate(claims, customClaims)
+	if err != nil {
+		p.logger.Warn("Feature flags evaluation failed",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	if p.FeatureFlags.Output == "header" {
+		p.FeatureFlags.SetHeader(w.Header(), flags)
+		return
+	}
+	if len(flags) == 0 {
+		return
+	}
+	if customClaims == nil {
+		customClaims = make(map[string]interface{})
+	}
+	customClaims[p.FeatureFlags.Name] = flags
+	opts["custom_claims"] = customClaims
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"net/http"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"go.uber.org/zap"
+)
+
+// errInvalidSessionHandle is returned when the session handle of a
+// request is unknown or expired.
+var errInvalidSessionHandle = errors.New("invalid session handle")
+
+// authorizeSessionHandle validates the token of the session the handle
+// of the request maps to. The token passes the same checks as the tokens
+// the requests carry.
+func (p *AuthPortal) authorizeSessionHandle(r *http.Request, handle string) (*jwtclaims.UserClaims, bool, error) {
+	token := p.SessionHandles.Resolve(sessionCache, handle)
+	if token == "" {
+		return nil, false, errInvalidSessionHandle
+	}
+	claims, authOK, err := p.TokenValidator.ValidateToken(token, nil)
+	if !authOK {
+		return claims, authOK, err
+	}
+	if p.DPoP.Enabled {
+		if err := p.verifyTokenBinding(r, token); err != nil {
+			p.logger.Warn("DPoP proof validation failed",
+				zap.String("session_id", claims.ID),
+				zap.String("error", err.Error()),
+			)
+			return nil, false, errInvalidDPoPProof
+		}
+	}
+	if err := p.checkTokenRealm(token, claims); err != nil {
+		return nil, false, err
+	}
+	return claims, true, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+	"strings"
+)
+
+// headRequestPaths are the paths supporting HEAD requests. The requests
+// to the other paths, e.g. logout, mutate sessions.
+var headRequestPaths = []string{"login", "portal", "whoami", "settings", "assets", "robots.txt"}
+
+// headResponseWriter discards response body and cookies. It allows
+// serving HEAD requests with the handlers of GET requests without
+// mutating the sessions of the users.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+// WriteHeader removes cookies and writes response headers.
+func (w *headResponseWriter) WriteHeader(statusCode int) {
+	w.Header().Del("Set-Cookie")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write discards response body.
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// isHeadRequestAllowed returns true when the path supports HEAD requests.
+func isHeadRequestAllowed(urlPath string) bool {
+	if urlPath == "" {
+		return true
+	}
+	for _, s := range headRequestPaths {
+		if strings.HasPrefix(urlPath, s) {
+			return true
+		}
+	}
+	return false
+}
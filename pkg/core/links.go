@@ -0,0 +1,42 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// validateLinkBaseURL validates the public base URL of the links the
+// portal sends to the users, e.g. https://auth.contoso.com, and returns
+// it without the trailing slash. The links must not be built from the
+// request headers, because the clients control them.
+func validateLinkBaseURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("link base url %s is invalid: %s", s, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("link base url %s must use http or https scheme", s)
+	}
+	if u.Host == "" || u.User != nil {
+		return "", fmt.Errorf("link base url %s must have a host and no credentials", s)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("link base url %s must not have a path, query, or fragment", s)
+	}
+	return strings.TrimSuffix(s, "/"), nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// notifyLockout sends the lockout notification to the email address of
+// the locked account. The rate limit calls it once per lockout.
+func (p *AuthPortal) notifyLockout(username, realm string, until time.Time) {
+	var recipient string
+	for _, backend := range p.Backends {
+		if !backend.MatchRealm(realm) {
+			continue
+		}
+		addr, err := backend.GetEmailAddress(map[string]interface{}{"username": username})
+		if err != nil {
+			continue
+		}
+		recipient = addr
+		break
+	}
+	if recipient == "" {
+		p.logger.Debug("Skipped lockout notification, email address not found",
+			zap.String("auth_realm", realm),
+			zap.String("user", username),
+		)
+		return
+	}
+	body, err := p.LockoutNotice.Render(username, realm, until)
+	if err != nil {
+		p.logger.Error("Failed rendering lockout notification",
+			zap.String("auth_realm", realm),
+			zap.String("user", username),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	if err := p.SMTP.Send(recipient, p.LockoutNotice.Subject, body); err != nil {
+		p.logger.Error("Failed sending lockout notification",
+			zap.String("auth_realm", realm),
+			zap.String("user", username),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	p.logger.Info("Sent lockout notification",
+		zap.String("auth_realm", realm),
+		zap.String("user", username),
+	)
+}
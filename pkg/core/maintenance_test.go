@@ -0,0 +1,92 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/maintenance"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeMaintenance(t *testing.T) {
+	testFailed := 0
+	uiFactory := ui.NewUserInterfaceFactory()
+	if err := uiFactory.AddBuiltinTemplate("basic/generic"); err != nil {
+		t.Fatalf("failed loading generic template: %s", err)
+	}
+	uiFactory.Templates["generic"] = uiFactory.Templates["basic/generic"]
+	tests := []struct {
+		message     string
+		contentType string
+		expected    string
+	}{
+		{message: maintenance.DefaultMessage, contentType: "application/json", expected: maintenance.DefaultMessage},
+		{message: "Back at 18:00 UTC", contentType: "application/json", expected: "Back at 18:00 UTC"},
+		{message: "Back at 18:00 UTC", contentType: "text/html", expected: "Back at 18:00 UTC"},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, message: %s, content type: %s", i, test.message, test.contentType)
+		p := &AuthPortal{
+			Maintenance: &maintenance.Maintenance{Enabled: true, Message: test.message},
+		}
+		r := httptest.NewRequest("GET", "/auth/login", nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":    "abc",
+			"logger":        utils.NewLogger(),
+			"ui":            uiFactory,
+			"auth_url_path": "/auth",
+			"authenticated": false,
+			"content_type":  test.contentType,
+		}
+		if err := p.serveMaintenance(w, r, opts); err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if w.Code != 503 {
+			t.Logf("FAIL: %s, status code: 503 (expected) vs. %d (received)", testDescr, w.Code)
+			testFailed++
+			continue
+		}
+		if test.contentType == "application/json" {
+			resp := make(map[string]interface{})
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Logf("FAIL: %s, failed parsing response: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			if resp["message"] != "Under Maintenance" || resp["details"] != test.expected {
+				t.Logf("FAIL: %s, unexpected response: %v", testDescr, resp)
+				testFailed++
+				continue
+			}
+		} else if !strings.Contains(w.Body.String(), test.expected) {
+			t.Logf("FAIL: %s, message not found in body: %s", testDescr, w.Body.String())
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -20,15 +20,43 @@ import (
 	jwtacl "github.com/greenpau/caddy-auth-jwt/pkg/acl"
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
 	jwtvalidator "github.com/greenpau/caddy-auth-jwt/pkg/validator"
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/challenge"
+	"github.com/greenpau/caddy-auth-portal/pkg/compression"
 	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/dpop"
+	"github.com/greenpau/caddy-auth-portal/pkg/email"
+	"github.com/greenpau/caddy-auth-portal/pkg/enumeration"
+	"github.com/greenpau/caddy-auth-portal/pkg/events"
+	"github.com/greenpau/caddy-auth-portal/pkg/exchange"
+	"github.com/greenpau/caddy-auth-portal/pkg/flags"
+	"github.com/greenpau/caddy-auth-portal/pkg/introspection"
+	"github.com/greenpau/caddy-auth-portal/pkg/logging"
+	"github.com/greenpau/caddy-auth-portal/pkg/maintenance"
+	"github.com/greenpau/caddy-auth-portal/pkg/mfa"
+	"github.com/greenpau/caddy-auth-portal/pkg/passthrough"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
+	"github.com/greenpau/caddy-auth-portal/pkg/ratelimit"
+	"github.com/greenpau/caddy-auth-portal/pkg/recovery"
 	"github.com/greenpau/caddy-auth-portal/pkg/registration"
+	"github.com/greenpau/caddy-auth-portal/pkg/robots"
+	"github.com/greenpau/caddy-auth-portal/pkg/routing"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"github.com/greenpau/caddy-auth-portal/pkg/tracing"
+	"github.com/greenpau/caddy-auth-portal/pkg/transformer"
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/unsupported"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
 	"github.com/greenpau/go-identity"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
 	"sync"
+	"time"
 )
 
 var defaultTheme string = "basic"
@@ -83,6 +111,15 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		return nil
 	}
 
+	// Setup Log Format and Fields
+	if p.Logging == nil {
+		p.Logging = &logging.Config{}
+	}
+	if err := p.Logging.Configure(); err != nil {
+		return fmt.Errorf("%s: logging setup failed: %s", p.Name, err)
+	}
+	p.logger = p.Logging.Apply(p.logger, p.Name)
+
 	if p.AuthURLPath == "" {
 		return fmt.Errorf("%s: auth_url_path must be set", p.Name)
 	}
@@ -201,6 +238,10 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		return fmt.Errorf("%s: no valid backend found", p.Name)
 	}
 
+	if err := validateRealmAliases(p.Backends); err != nil {
+		return fmt.Errorf("%s: %s", p.Name, err)
+	}
+
 	backendNameRef := make(map[string]interface{})
 
 	p.loginOptions = make(map[string]interface{})
@@ -299,6 +340,27 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		)
 	}
 
+	if p.UserInterface != nil {
+		for _, entry := range p.UserInterface.LoginInstructions {
+			text, helpURL, err := entry.Sanitize()
+			if err != nil {
+				return fmt.Errorf("%s: %s", p.Name, err)
+			}
+			var realmFound bool
+			for _, loginRealm := range loginRealms {
+				if loginRealm["realm"] != entry.Realm {
+					continue
+				}
+				loginRealm["instructions"] = text
+				loginRealm["help_url"] = helpURL
+				realmFound = true
+			}
+			if !realmFound {
+				return fmt.Errorf("%s: login instructions refer to unknown realm %s", p.Name, entry.Realm)
+			}
+		}
+	}
+
 	if len(loginRealms) > 0 {
 		p.loginOptions["form_required"] = "yes"
 		p.loginOptions["username_required"] = "yes"
@@ -317,6 +379,9 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 	if p.Cookies == nil {
 		p.Cookies = &cookies.Cookies{}
 	}
+	if err := p.Cookies.Validate(); err != nil {
+		return fmt.Errorf("%s: cookie configuration error: %s", p.Name, err)
+	}
 
 	// Setup User Registration
 	if p.UserRegistration == nil {
@@ -332,24 +397,55 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 	if !p.UserRegistration.Disabled {
 		p.loginOptions["registration_required"] = "yes"
 		if p.UserRegistrationDatabase == nil {
-			p.UserRegistrationDatabase = identity.NewDatabase()
-			fileInfo, err := os.Stat(p.UserRegistration.Dropbox)
+			db, err := loadRegistrationDatabase(p.UserRegistration.Dropbox)
 			if err != nil {
-				if os.IsNotExist(err) {
-					if err := p.UserRegistrationDatabase.SaveToFile(p.UserRegistration.Dropbox); err != nil {
-						return fmt.Errorf("%s: registration dropbox setup failed: %s", p.Name, err)
-					}
-				} else {
-					return fmt.Errorf("%s: registration dropbox metadata read failed: %s", p.Name, err)
-				}
-			} else {
-				if fileInfo.IsDir() {
-					return fmt.Errorf("%s: registration dropbox is a directory", p.Name)
+				return fmt.Errorf("%s: %s", p.Name, err)
+			}
+			p.UserRegistrationDatabase = db
+		}
+	}
+
+	if len(p.UserRegistration.Realms) > 0 {
+		var registrationRealms []string
+		if p.registrationDatabases == nil {
+			p.registrationDatabases = make(map[string]*identity.Database)
+		}
+		for _, entry := range p.UserRegistration.Realms {
+			if entry.Realm == "" || entry.Dropbox == "" {
+				return fmt.Errorf("%s: realm registration requires realm and dropbox", p.Name)
+			}
+			realmFound := false
+			for _, backend := range p.Backends {
+				if backend.GetRealm() == entry.Realm {
+					realmFound = true
+					break
 				}
 			}
-			if err := p.UserRegistrationDatabase.LoadFromFile(p.UserRegistration.Dropbox); err != nil {
-				return fmt.Errorf("%s: registration dropbox load failed: %s", p.Name, err)
+			if !realmFound {
+				return fmt.Errorf("%s: realm registration refers to unknown realm %s", p.Name, entry.Realm)
+			}
+			if _, exists := p.registrationDatabases[entry.Realm]; !exists {
+				db, err := loadRegistrationDatabase(entry.Dropbox)
+				if err != nil {
+					return fmt.Errorf("%s: realm %s: %s", p.Name, entry.Realm, err)
+				}
+				p.registrationDatabases[entry.Realm] = db
 			}
+			registrationRealms = append(registrationRealms, entry.Realm)
+		}
+		p.loginOptions["registration_required"] = "yes"
+		p.loginOptions["registration_realms"] = registrationRealms
+	}
+
+	if p.UserRegistration.RequireInvitation {
+		if p.UserRegistration.InvitationLifetime < 1 {
+			p.UserRegistration.InvitationLifetime = registration.DefaultInvitationLifetime
+		}
+		if len(p.UserRegistration.InvitationAdminRoles) == 0 {
+			p.UserRegistration.InvitationAdminRoles = []string{registration.DefaultInvitationAdminRole}
+		}
+		if p.UserRegistration.Invitations == nil {
+			p.UserRegistration.Invitations = registration.NewInvitationStore()
 		}
 	}
 
@@ -359,6 +455,159 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		zap.String("dropbox", p.UserRegistration.Dropbox),
 	)
 
+	// Setup Maintenance Mode
+	if p.Maintenance == nil {
+		p.Maintenance = &maintenance.Maintenance{}
+	}
+	if p.Maintenance.Message == "" {
+		p.Maintenance.Message = maintenance.DefaultMessage
+	}
+	if p.Maintenance.Enabled {
+		p.logger.Warn(
+			"Maintenance mode is enabled",
+			zap.String("instance_name", p.Name),
+			zap.Bool("allow_sessions", p.Maintenance.AllowSessions),
+			zap.Strings("bypass_roles", p.Maintenance.BypassRoles),
+		)
+	}
+
+	// Setup Redirect Loop Detection
+	if p.RedirectLoopThreshold < 1 {
+		p.RedirectLoopThreshold = defaultRedirectLoopThreshold
+	}
+
+	// Setup Drain Timeout
+	if p.DrainTimeout < 1 {
+		p.DrainTimeout = defaultDrainTimeout
+	}
+
+	// Setup Session Cache TTL
+	if p.SessionCacheTTL < 1 {
+		p.SessionCacheTTL = int(cache.DefaultSessionTTL / time.Second)
+	}
+	sessionCache.SetTTL(time.Duration(p.SessionCacheTTL) * time.Second)
+
+	// Setup Login Result Caching
+	if p.LoginResultWindow > maxLoginResultWindow {
+		return fmt.Errorf("%s: login result window must not exceed %d seconds", p.Name, maxLoginResultWindow)
+	}
+
+	// Setup HEAD Request Handling
+	switch p.HeadRequests {
+	case "":
+		p.HeadRequests = "mirror"
+	case "mirror", "reject":
+	default:
+		return fmt.Errorf("%s: head_requests must be either mirror or reject, got %s", p.Name, p.HeadRequests)
+	}
+
+	// Setup Unauthenticated Request Handling
+	switch p.UnauthenticatedRequests {
+	case "":
+		p.UnauthenticatedRequests = "method"
+	case "method", "redirect":
+	default:
+		return fmt.Errorf("%s: unauthenticated_requests must be either method or redirect, got %s", p.Name, p.UnauthenticatedRequests)
+	}
+
+	// Setup Redirect Preservation
+	switch p.RedirectPreservation {
+	case "":
+		p.RedirectPreservation = "state"
+	case "state", "cookie":
+	default:
+		return fmt.Errorf("%s: redirect_preservation must be either state or cookie, got %s", p.Name, p.RedirectPreservation)
+	}
+
+	// Setup Token Precedence
+	switch p.TokenPrecedence {
+	case "":
+		p.TokenPrecedence = "cookie"
+	case "cookie", "header", "reject":
+	default:
+		return fmt.Errorf("%s: token_precedence must be either cookie, header, or reject, got %s", p.Name, p.TokenPrecedence)
+	}
+
+	// Setup Session Source Address Change Handling
+	if p.SessionIPChange == "" {
+		p.SessionIPChange = sessionIPChangeIgnore
+	}
+	if err := validateSessionIPChange(p.SessionIPChange); err != nil {
+		return fmt.Errorf("%s: %s", p.Name, err)
+	}
+
+	// Setup Trusted Proxies
+	trustedProxies, err := utils.ParseNetworks(p.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("%s: invalid trusted proxy: %s", p.Name, err)
+	}
+	p.trustedProxies = trustedProxies
+
+	// Setup Claims Transformation
+	if p.ClaimsTransformer == nil {
+		p.ClaimsTransformer = &transformer.Transformer{}
+	}
+	if err := p.ClaimsTransformer.Validate(); err != nil {
+		return fmt.Errorf("%s: %s", p.Name, err)
+	}
+
+	// Setup Token Introspection
+	if p.Introspection == nil {
+		p.Introspection = &introspection.Introspection{}
+	}
+	for _, client := range p.Introspection.Clients {
+		if client.ID == "" || client.Secret == "" {
+			return fmt.Errorf("%s: introspection client must have id and secret", p.Name)
+		}
+	}
+
+	// Setup Token Exchange
+	if p.TokenExchange == nil {
+		p.TokenExchange = &exchange.Exchange{}
+	}
+	if err := p.TokenExchange.Configure(); err != nil {
+		return fmt.Errorf("%s: token exchange setup failed: %s", p.Name, err)
+	}
+
+	// Setup Session Transfer
+	if p.SessionTransfer == nil {
+		p.SessionTransfer = &sessions.Transfer{}
+	}
+	if err := p.SessionTransfer.Configure(); err != nil {
+		return fmt.Errorf("%s: session transfer setup failed: %s", p.Name, err)
+	}
+
+	// Setup Session Stats
+	if p.SessionStats == nil {
+		p.SessionStats = &sessions.Stats{}
+	}
+	if err := p.SessionStats.Configure(); err != nil {
+		return fmt.Errorf("%s: session stats setup failed: %s", p.Name, err)
+	}
+
+	// Setup Session Handles
+	if p.SessionHandles != nil {
+		if err := p.SessionHandles.Configure(); err != nil {
+			return fmt.Errorf("%s: session handles setup failed: %s", p.Name, err)
+		}
+	}
+
+	// Setup Event Stream
+	if p.EventStream == nil {
+		p.EventStream = &events.Stream{}
+	}
+	if err := p.EventStream.Configure(); err != nil {
+		return fmt.Errorf("%s: event stream setup failed: %s", p.Name, err)
+	}
+
+	// Setup Tracing
+	if p.Tracing == nil {
+		p.Tracing = &tracing.Tracing{}
+	}
+	if err := p.Tracing.Configure(p.logger); err != nil {
+		return fmt.Errorf("%s: tracing setup failed: %s", p.Name, err)
+	}
+
 	// Setup User Interface
 	if p.UserInterface == nil {
 		p.UserInterface = &ui.UserInterfaceParameters{}
@@ -389,6 +638,62 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		}
 	}
 
+	if p.UserInterface.CustomPageHeaderPath != "" {
+		b, err := ioutil.ReadFile(p.UserInterface.CustomPageHeaderPath)
+		if err != nil {
+			return fmt.Errorf("%s: custom page header: %s", p.Name, err)
+		}
+		p.uiFactory.CustomPageHeader = string(b)
+	}
+
+	if p.UserInterface.CustomPageFooterPath != "" {
+		b, err := ioutil.ReadFile(p.UserInterface.CustomPageFooterPath)
+		if err != nil {
+			return fmt.Errorf("%s: custom page footer: %s", p.Name, err)
+		}
+		p.uiFactory.CustomPageFooter = string(b)
+	}
+
+	if p.UserInterface.LoginHintParameter == "" {
+		p.UserInterface.LoginHintParameter = ui.DefaultLoginHintParameter
+	}
+	p.uiFactory.LoginHintParameter = p.UserInterface.LoginHintParameter
+
+	if p.UserInterface.FallbackMessage == "" {
+		p.UserInterface.FallbackMessage = ui.DefaultFallbackMessage
+	}
+	p.uiFactory.FallbackMessage = p.UserInterface.FallbackMessage
+
+	switch p.UserInterface.LoginSuccess {
+	case "":
+		p.UserInterface.LoginSuccess = "redirect"
+	case "redirect":
+	case "page":
+		p.uiFactory.LoginSuccessPage = true
+	default:
+		return fmt.Errorf("%s: login_success must be either redirect or page, got %s", p.Name, p.UserInterface.LoginSuccess)
+	}
+
+	switch p.UserInterface.SingleProviderRedirect {
+	case "":
+		p.UserInterface.SingleProviderRedirect = "no"
+	case "no":
+	case "yes":
+		p.uiFactory.SingleProviderRedirect = true
+	default:
+		return fmt.Errorf("%s: single_provider_redirect must be either yes or no, got %s", p.Name, p.UserInterface.SingleProviderRedirect)
+	}
+
+	switch p.UserInterface.SessionExpiryMeta {
+	case "":
+		p.UserInterface.SessionExpiryMeta = "no"
+	case "no":
+	case "yes":
+		p.uiFactory.SessionExpiryMeta = true
+	default:
+		return fmt.Errorf("%s: session_expiry_meta must be either yes or no, got %s", p.Name, p.UserInterface.SessionExpiryMeta)
+	}
+
 	if p.UserInterface.LogoURL != "" {
 		p.uiFactory.LogoURL = p.UserInterface.LogoURL
 		p.uiFactory.LogoDescription = p.UserInterface.LogoDescription
@@ -416,10 +721,233 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		)
 	}
 
+	if p.UserInterface.StaticAssetMaxAge < 1 {
+		p.UserInterface.StaticAssetMaxAge = defaultStaticAssetMaxAge
+	}
+
 	if p.UserInterface.PasswordRecoveryEnabled {
 		p.loginOptions["password_recovery_required"] = "yes"
 	}
 
+	// Setup Account Recovery
+	if p.Recovery == nil {
+		p.Recovery = &recovery.Recovery{}
+	}
+	if err := p.Recovery.Configure(); err != nil {
+		return fmt.Errorf("%s: account recovery setup failed: %s", p.Name, err)
+	}
+	if p.Recovery.Enabled() {
+		p.loginOptions["password_recovery_required"] = "yes"
+	}
+
+	// Setup Anti-Enumeration
+	if p.AntiEnumeration == nil {
+		p.AntiEnumeration = &enumeration.AntiEnumeration{}
+	}
+	if err := p.AntiEnumeration.Configure(); err != nil {
+		return fmt.Errorf("%s: anti-enumeration setup failed: %s", p.Name, err)
+	}
+
+	// Setup Response Compression
+	if p.Compression == nil {
+		p.Compression = &compression.Compression{}
+	}
+	if err := p.Compression.Configure(); err != nil {
+		return fmt.Errorf("%s: compression setup failed: %s", p.Name, err)
+	}
+
+	// Setup Login Rate Limiting
+	if p.RateLimit == nil {
+		p.RateLimit = &ratelimit.RateLimit{}
+	}
+	if err := p.RateLimit.Configure(); err != nil {
+		return fmt.Errorf("%s: rate limit setup failed: %s", p.Name, err)
+	}
+
+	// Setup Realm Routing
+	if p.RealmRouting == nil {
+		p.RealmRouting = &routing.Router{}
+	}
+	if err := p.RealmRouting.Configure(); err != nil {
+		return fmt.Errorf("%s: realm routing setup failed: %s", p.Name, err)
+	}
+
+	// Setup Realm Host Restriction
+	if p.RealmHostRestriction == nil {
+		p.RealmHostRestriction = &routing.HostRestriction{}
+	}
+	if err := p.RealmHostRestriction.Configure(); err != nil {
+		return fmt.Errorf("%s: realm host restriction setup failed: %s", p.Name, err)
+	}
+
+	// Setup Responses to Crawlers
+	if p.Robots == nil {
+		p.Robots = &robots.Robots{}
+	}
+	if err := p.Robots.Configure(); err != nil {
+		return fmt.Errorf("%s: robots setup failed: %s", p.Name, err)
+	}
+
+	// Setup DPoP Token Binding
+	if p.DPoP == nil {
+		p.DPoP = &dpop.Config{}
+	}
+	if err := p.DPoP.Configure(); err != nil {
+		return fmt.Errorf("%s: dpop setup failed: %s", p.Name, err)
+	}
+
+	// Setup Email Delivery
+	if p.SMTP == nil {
+		p.SMTP = &email.Config{}
+	}
+	if err := p.SMTP.Configure(); err != nil {
+		return fmt.Errorf("%s: smtp setup failed: %s", p.Name, err)
+	}
+
+	// Setup Link Base URL
+	if p.LinkBaseURL != "" {
+		baseURL, err := validateLinkBaseURL(p.LinkBaseURL)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p.Name, err)
+		}
+		p.LinkBaseURL = baseURL
+	}
+
+	// Setup Email Address Change
+	if p.EmailChange == nil {
+		p.EmailChange = &email.Change{}
+	}
+	if err := p.EmailChange.Configure(); err != nil {
+		return fmt.Errorf("%s: email change setup failed: %s", p.Name, err)
+	}
+	if p.EmailChange.Enabled && !p.SMTP.Enabled() {
+		return fmt.Errorf("%s: email change requires smtp server", p.Name)
+	}
+	if p.EmailChange.Enabled && p.LinkBaseURL == "" {
+		return fmt.Errorf("%s: email change requires link base url", p.Name)
+	}
+	if p.Recovery.EmailLink && !p.SMTP.Enabled() {
+		return fmt.Errorf("%s: account recovery via email link requires smtp server", p.Name)
+	}
+	if p.Recovery.EmailLink && p.LinkBaseURL == "" {
+		return fmt.Errorf("%s: account recovery via email link requires link base url", p.Name)
+	}
+
+	// Setup Lockout Notification
+	if p.LockoutNotice == nil {
+		p.LockoutNotice = &email.LockoutNotice{}
+	}
+	if err := p.LockoutNotice.Configure(); err != nil {
+		return fmt.Errorf("%s: lockout notice setup failed: %s", p.Name, err)
+	}
+	if p.LockoutNotice.Enabled {
+		if !p.SMTP.Enabled() {
+			return fmt.Errorf("%s: lockout notice requires smtp server", p.Name)
+		}
+		if p.RateLimit.Username == nil {
+			return fmt.Errorf("%s: lockout notice requires username rate limit", p.Name)
+		}
+		p.RateLimit.OnLockout = p.notifyLockout
+	}
+
+	// Setup Welcome Notification
+	if p.WelcomeNotice == nil {
+		p.WelcomeNotice = &email.WelcomeNotice{}
+	}
+	if err := p.WelcomeNotice.Configure(); err != nil {
+		return fmt.Errorf("%s: welcome notice setup failed: %s", p.Name, err)
+	}
+	if p.WelcomeNotice.Enabled && !p.SMTP.Enabled() {
+		return fmt.Errorf("%s: welcome notice requires smtp server", p.Name)
+	}
+
+	// Setup Validation Webhook
+	if p.ValidationWebhook != nil {
+		if err := p.ValidationWebhook.Configure(); err != nil {
+			return fmt.Errorf("%s: validation webhook setup failed: %s", p.Name, err)
+		}
+	}
+
+	// Setup Unauthorized Response Body
+	if p.UnauthorizedBody == nil {
+		p.UnauthorizedBody = &challenge.Body{}
+	}
+	if err := p.UnauthorizedBody.Configure(); err != nil {
+		return fmt.Errorf("%s: unauthorized body setup failed: %s", p.Name, err)
+	}
+
+	// Setup Unsupported Flow Responses
+	if p.UnsupportedFlows == nil {
+		p.UnsupportedFlows = &unsupported.Responses{}
+	}
+	if err := p.UnsupportedFlows.Configure(); err != nil {
+		return fmt.Errorf("%s: unsupported flow responses setup failed: %s", p.Name, err)
+	}
+
+	// Setup Claim Deny Rules
+	for _, rule := range p.DenyClaims {
+		if err := rule.Configure(); err != nil {
+			return fmt.Errorf("%s: claim deny rule setup failed: %s", p.Name, err)
+		}
+	}
+
+	// Setup Feature Flags
+	if p.FeatureFlags == nil {
+		p.FeatureFlags = &flags.Config{}
+	}
+	if err := p.FeatureFlags.Configure(); err != nil {
+		return fmt.Errorf("%s: feature flags setup failed: %s", p.Name, err)
+	}
+
+	// Setup Profile Schema
+	if p.ProfileSchema == nil {
+		p.ProfileSchema = &profile.Schema{}
+	}
+	if err := p.ProfileSchema.Configure(); err != nil {
+		return fmt.Errorf("%s: profile schema setup failed: %s", p.Name, err)
+	}
+
+	// Setup Registration Wizard
+	if err := p.UserRegistration.Wizard.Configure(p.ProfileSchema.FieldNames()); err != nil {
+		return fmt.Errorf("%s: registration wizard setup failed: %s", p.Name, err)
+	}
+	if p.UserRegistration.Wizard.Enabled() && !p.UserRegistration.Wizard.HasStep("verification") {
+		if p.UserRegistration.Code != "" || p.UserRegistration.RequireAcceptTerms || p.UserRegistration.RequireInvitation {
+			return fmt.Errorf("%s: registration wizard setup failed: verification step is required", p.Name)
+		}
+	}
+
+	// Setup Username Policy
+	if p.UsernamePolicy == nil {
+		p.UsernamePolicy = &validators.UsernamePolicy{}
+	}
+	if err := p.UsernamePolicy.Configure(); err != nil {
+		return fmt.Errorf("%s: username policy setup failed: %s", p.Name, err)
+	}
+
+	// Setup Password Breach Check
+	if p.PasswordBreachCheck != nil {
+		if err := p.PasswordBreachCheck.Configure(); err != nil {
+			return fmt.Errorf("%s: password breach check setup failed: %s", p.Name, err)
+		}
+	}
+
+	// Setup Redirect Claims Passthrough
+	if p.RedirectPassthrough == nil {
+		p.RedirectPassthrough = &passthrough.Config{}
+	}
+	if err := p.RedirectPassthrough.Configure(); err != nil {
+		return fmt.Errorf("%s: redirect passthrough setup failed: %s", p.Name, err)
+	}
+
+	// Setup Multi-Factor Authentication
+	if p.MFA == nil {
+		p.MFA = &mfa.Config{}
+	}
+	if err := p.MFA.Configure(); err != nil {
+		return fmt.Errorf("%s: multi-factor authentication setup failed: %s", p.Name, err)
+	}
+
 	p.logger.Debug(
 		"Provisioned authentication user interface parameters",
 		zap.String("instance_name", p.Name),
@@ -472,6 +1000,16 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		}
 	}
 
+	// Setup UI Template Rollout
+	if p.UserInterface.Rollout != nil {
+		if err := p.UserInterface.Rollout.Configure(); err != nil {
+			return fmt.Errorf("%s: UI settings validation error: %s", p.Name, err)
+		}
+		if err := p.uiFactory.AddRollout(p.UserInterface.Rollout); err != nil {
+			return fmt.Errorf("%s: UI settings validation error: %s", p.Name, err)
+		}
+	}
+
 	p.TokenValidator = jwtvalidator.NewTokenValidator()
 	tokenConfig := jwtconfig.NewCommonTokenConfig()
 	tokenConfig.TokenName = p.TokenProvider.TokenName
@@ -499,6 +1037,9 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		}
 	}
 	p.TokenValidator.TokenConfigs = []*jwtconfig.CommonTokenConfig{tokenConfig}
+	if err := p.configureSigningKeyring(signingKeyID, signingKey); err != nil {
+		return err
+	}
 	if err := p.TokenValidator.ConfigureTokenBackends(); err != nil {
 		return fmt.Errorf(
 			"%s: token validator backend configuration failed: %s",
@@ -528,9 +1069,11 @@ func (m *AuthPortalManager) Register(p *AuthPortal) error {
 		zap.Any("access_list", p.TokenValidator.AccessList),
 	)
 
-	p.TokenValidator.TokenSources = []string{"cookie", "header", "query"}
+	p.TokenValidator.TokenSources = getTokenSources(p.TokenPrecedence)
 
-	p.TokenValidator.SetTokenName(p.TokenProvider.TokenName)
+	for _, tokenName := range p.getTokenCookieNames(nil) {
+		p.TokenValidator.SetTokenName(tokenName)
+	}
 	p.Provisioned = true
 	return nil
 }
@@ -565,6 +1108,14 @@ func (m *AuthPortalManager) Provision(name string) error {
 		return fmt.Errorf("no primary authentication provider found in %s context when configuring %s", p.Context, name)
 	}
 
+	// Setup Log Format and Fields
+	if p.Logging == nil {
+		p.Logging = primaryInstance.Logging
+	} else if err := p.Logging.Configure(); err != nil {
+		return fmt.Errorf("%s: logging setup failed: %s", p.Name, err)
+	}
+	p.logger = p.Logging.Apply(p.logger, p.Name)
+
 	if p.AuthURLPath == "" {
 		p.AuthURLPath = primaryInstance.AuthURLPath
 	}
@@ -664,6 +1215,9 @@ func (m *AuthPortalManager) Provision(name string) error {
 	if len(p.Backends) == 0 {
 		p.Backends = primaryInstance.Backends
 	} else {
+		if err := validateRealmAliases(p.Backends); err != nil {
+			return fmt.Errorf("%s: %s", p.Name, err)
+		}
 		backendNameRef := make(map[string]interface{})
 		for _, backend := range p.Backends {
 			backendName := backend.GetName()
@@ -697,10 +1251,373 @@ func (m *AuthPortalManager) Provision(name string) error {
 	if p.Cookies == nil {
 		p.Cookies = &cookies.Cookies{}
 	}
+	if err := p.Cookies.Validate(); err != nil {
+		return fmt.Errorf("%s: cookie configuration error: %s", p.Name, err)
+	}
 
 	// Setup User Registration
 	p.UserRegistration = primaryInstance.UserRegistration
 	p.UserRegistrationDatabase = primaryInstance.UserRegistrationDatabase
+	p.registrationDatabases = primaryInstance.registrationDatabases
+
+	// Setup Maintenance Mode
+	if p.Maintenance == nil {
+		p.Maintenance = primaryInstance.Maintenance
+	}
+	if p.Maintenance.Message == "" {
+		p.Maintenance.Message = maintenance.DefaultMessage
+	}
+
+	// Setup Redirect Loop Detection
+	if p.RedirectLoopThreshold < 1 {
+		p.RedirectLoopThreshold = primaryInstance.RedirectLoopThreshold
+	}
+
+	// Setup Session Idle Timeout
+	if p.SessionIdleTimeout < 1 {
+		p.SessionIdleTimeout = primaryInstance.SessionIdleTimeout
+	}
+
+	// Setup Maximum Session Age
+	if p.SessionMaxAge < 1 {
+		p.SessionMaxAge = primaryInstance.SessionMaxAge
+	}
+
+	// Setup Maximum Token Age
+	if p.MaxTokenAge < 1 {
+		p.MaxTokenAge = primaryInstance.MaxTokenAge
+	}
+
+	// Setup Parallel Authentication
+	if len(p.ParallelRealms) == 0 {
+		p.ParallelRealms = primaryInstance.ParallelRealms
+	}
+
+	// Setup Required Claims
+	if len(p.RequiredClaims) == 0 {
+		p.RequiredClaims = primaryInstance.RequiredClaims
+	}
+
+	// Setup Unauthorized Response Body
+	if p.UnauthorizedBody == nil {
+		p.UnauthorizedBody = primaryInstance.UnauthorizedBody
+	} else if err := p.UnauthorizedBody.Configure(); err != nil {
+		return fmt.Errorf("%s: unauthorized body setup failed: %s", p.Name, err)
+	}
+
+	// Setup Unsupported Flow Responses
+	if p.UnsupportedFlows == nil {
+		p.UnsupportedFlows = primaryInstance.UnsupportedFlows
+	} else if err := p.UnsupportedFlows.Configure(); err != nil {
+		return fmt.Errorf("%s: unsupported flow responses setup failed: %s", p.Name, err)
+	}
+
+	// Setup Claim Deny Rules
+	if len(p.DenyClaims) == 0 {
+		p.DenyClaims = primaryInstance.DenyClaims
+	} else {
+		for _, rule := range p.DenyClaims {
+			if err := rule.Configure(); err != nil {
+				return fmt.Errorf("%s: claim deny rule setup failed: %s", p.Name, err)
+			}
+		}
+	}
+
+	// Setup Realm Signing Keys
+	if p.RealmSigningKeys == nil {
+		p.RealmSigningKeys = primaryInstance.RealmSigningKeys
+	}
+
+	// Setup Feature Flags
+	if p.FeatureFlags == nil {
+		p.FeatureFlags = primaryInstance.FeatureFlags
+	} else if err := p.FeatureFlags.Configure(); err != nil {
+		return fmt.Errorf("%s: feature flags setup failed: %s", p.Name, err)
+	}
+
+	// Setup Profile Schema
+	if p.ProfileSchema == nil {
+		p.ProfileSchema = primaryInstance.ProfileSchema
+	} else if err := p.ProfileSchema.Configure(); err != nil {
+		return fmt.Errorf("%s: profile schema setup failed: %s", p.Name, err)
+	}
+
+	// Setup Username Policy
+	if p.UsernamePolicy == nil {
+		p.UsernamePolicy = primaryInstance.UsernamePolicy
+	} else if err := p.UsernamePolicy.Configure(); err != nil {
+		return fmt.Errorf("%s: username policy setup failed: %s", p.Name, err)
+	}
+
+	// Setup Password Breach Check
+	if p.PasswordBreachCheck == nil {
+		p.PasswordBreachCheck = primaryInstance.PasswordBreachCheck
+	} else if err := p.PasswordBreachCheck.Configure(); err != nil {
+		return fmt.Errorf("%s: password breach check setup failed: %s", p.Name, err)
+	}
+
+	// Setup Redirect Claims Passthrough
+	if p.RedirectPassthrough == nil {
+		p.RedirectPassthrough = primaryInstance.RedirectPassthrough
+	} else if err := p.RedirectPassthrough.Configure(); err != nil {
+		return fmt.Errorf("%s: redirect passthrough setup failed: %s", p.Name, err)
+	}
+
+	// Setup Header Stripping
+	if len(p.StripHeaders) == 0 {
+		p.StripHeaders = primaryInstance.StripHeaders
+	}
+
+	// Setup HEAD Request Handling
+	if p.HeadRequests == "" {
+		p.HeadRequests = primaryInstance.HeadRequests
+	}
+
+	// Setup Unauthenticated Request Handling
+	if p.UnauthenticatedRequests == "" {
+		p.UnauthenticatedRequests = primaryInstance.UnauthenticatedRequests
+	}
+
+	// Setup Redirect Preservation
+	if p.RedirectPreservation == "" {
+		p.RedirectPreservation = primaryInstance.RedirectPreservation
+	}
+
+	// Setup Token Precedence
+	if p.TokenPrecedence == "" {
+		p.TokenPrecedence = primaryInstance.TokenPrecedence
+	}
+
+	// Setup Slow Authentication Warnings
+	if p.SlowAuthThreshold < 1 {
+		p.SlowAuthThreshold = primaryInstance.SlowAuthThreshold
+	}
+
+	// Setup Login Result Caching
+	if p.LoginResultWindow < 1 {
+		p.LoginResultWindow = primaryInstance.LoginResultWindow
+	} else if p.LoginResultWindow > maxLoginResultWindow {
+		return fmt.Errorf("%s: login result window must not exceed %d seconds", p.Name, maxLoginResultWindow)
+	}
+
+	// Setup Drain Timeout
+	if p.DrainTimeout < 1 {
+		p.DrainTimeout = primaryInstance.DrainTimeout
+	}
+
+	// Setup Session Cache TTL
+	if p.SessionCacheTTL < 1 {
+		p.SessionCacheTTL = primaryInstance.SessionCacheTTL
+	} else if p.SessionCacheTTL != primaryInstance.SessionCacheTTL {
+		return fmt.Errorf(
+			"%s: session_cache_ttl %d differs from %d of primary instance, the cache is shared and only the primary instance sets it",
+			p.Name, p.SessionCacheTTL, primaryInstance.SessionCacheTTL,
+		)
+	}
+
+	// Setup Session Source Address Change Handling
+	if p.SessionIPChange == "" {
+		p.SessionIPChange = primaryInstance.SessionIPChange
+	} else if err := validateSessionIPChange(p.SessionIPChange); err != nil {
+		return fmt.Errorf("%s: %s", p.Name, err)
+	}
+
+	// Setup Trusted Proxies
+	if len(p.TrustedProxies) == 0 {
+		p.TrustedProxies = primaryInstance.TrustedProxies
+	}
+	trustedProxies, err := utils.ParseNetworks(p.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("%s: invalid trusted proxy: %s", p.Name, err)
+	}
+	p.trustedProxies = trustedProxies
+
+	// Setup Account Recovery
+	if p.Recovery == nil {
+		p.Recovery = primaryInstance.Recovery
+	} else if err := p.Recovery.Configure(); err != nil {
+		return fmt.Errorf("%s: account recovery setup failed: %s", p.Name, err)
+	}
+
+	// Setup Anti-Enumeration
+	if p.AntiEnumeration == nil {
+		p.AntiEnumeration = primaryInstance.AntiEnumeration
+	} else if err := p.AntiEnumeration.Configure(); err != nil {
+		return fmt.Errorf("%s: anti-enumeration setup failed: %s", p.Name, err)
+	}
+
+	// Setup Response Compression
+	if p.Compression == nil {
+		p.Compression = primaryInstance.Compression
+	} else if err := p.Compression.Configure(); err != nil {
+		return fmt.Errorf("%s: compression setup failed: %s", p.Name, err)
+	}
+
+	// Setup Login Rate Limiting
+	if p.RateLimit == nil {
+		p.RateLimit = primaryInstance.RateLimit
+	} else if err := p.RateLimit.Configure(); err != nil {
+		return fmt.Errorf("%s: rate limit setup failed: %s", p.Name, err)
+	}
+
+	// Setup Realm Routing
+	if p.RealmRouting == nil {
+		p.RealmRouting = primaryInstance.RealmRouting
+	} else if err := p.RealmRouting.Configure(); err != nil {
+		return fmt.Errorf("%s: realm routing setup failed: %s", p.Name, err)
+	}
+
+	// Setup Realm Host Restriction
+	if p.RealmHostRestriction == nil {
+		p.RealmHostRestriction = primaryInstance.RealmHostRestriction
+	} else if err := p.RealmHostRestriction.Configure(); err != nil {
+		return fmt.Errorf("%s: realm host restriction setup failed: %s", p.Name, err)
+	}
+
+	// Setup Responses to Crawlers
+	if p.Robots == nil {
+		p.Robots = primaryInstance.Robots
+	} else if err := p.Robots.Configure(); err != nil {
+		return fmt.Errorf("%s: robots setup failed: %s", p.Name, err)
+	}
+
+	// Setup DPoP Token Binding
+	if p.DPoP == nil {
+		p.DPoP = primaryInstance.DPoP
+	} else if err := p.DPoP.Configure(); err != nil {
+		return fmt.Errorf("%s: dpop setup failed: %s", p.Name, err)
+	}
+
+	// Setup Email Delivery
+	if p.SMTP == nil {
+		p.SMTP = primaryInstance.SMTP
+	} else if err := p.SMTP.Configure(); err != nil {
+		return fmt.Errorf("%s: smtp setup failed: %s", p.Name, err)
+	}
+
+	// Setup Link Base URL
+	if p.LinkBaseURL == "" {
+		p.LinkBaseURL = primaryInstance.LinkBaseURL
+	} else {
+		baseURL, err := validateLinkBaseURL(p.LinkBaseURL)
+		if err != nil {
+			return fmt.Errorf("%s: %s", p.Name, err)
+		}
+		p.LinkBaseURL = baseURL
+	}
+
+	// Setup Email Address Change
+	if p.EmailChange == nil {
+		p.EmailChange = primaryInstance.EmailChange
+	} else if err := p.EmailChange.Configure(); err != nil {
+		return fmt.Errorf("%s: email change setup failed: %s", p.Name, err)
+	}
+	if p.EmailChange.Enabled && !p.SMTP.Enabled() {
+		return fmt.Errorf("%s: email change requires smtp server", p.Name)
+	}
+	if p.EmailChange.Enabled && p.LinkBaseURL == "" {
+		return fmt.Errorf("%s: email change requires link base url", p.Name)
+	}
+	if p.Recovery.EmailLink && !p.SMTP.Enabled() {
+		return fmt.Errorf("%s: account recovery via email link requires smtp server", p.Name)
+	}
+	if p.Recovery.EmailLink && p.LinkBaseURL == "" {
+		return fmt.Errorf("%s: account recovery via email link requires link base url", p.Name)
+	}
+
+	// Setup Lockout Notification
+	if p.LockoutNotice == nil {
+		p.LockoutNotice = primaryInstance.LockoutNotice
+	} else if err := p.LockoutNotice.Configure(); err != nil {
+		return fmt.Errorf("%s: lockout notice setup failed: %s", p.Name, err)
+	}
+	if p.LockoutNotice.Enabled && p.RateLimit != primaryInstance.RateLimit {
+		if !p.SMTP.Enabled() {
+			return fmt.Errorf("%s: lockout notice requires smtp server", p.Name)
+		}
+		if p.RateLimit.Username == nil {
+			return fmt.Errorf("%s: lockout notice requires username rate limit", p.Name)
+		}
+		p.RateLimit.OnLockout = p.notifyLockout
+	}
+
+	// Setup Welcome Notification
+	if p.WelcomeNotice == nil {
+		p.WelcomeNotice = primaryInstance.WelcomeNotice
+	} else if err := p.WelcomeNotice.Configure(); err != nil {
+		return fmt.Errorf("%s: welcome notice setup failed: %s", p.Name, err)
+	}
+	if p.WelcomeNotice.Enabled && !p.SMTP.Enabled() {
+		return fmt.Errorf("%s: welcome notice requires smtp server", p.Name)
+	}
+
+	// Setup Validation Webhook
+	if p.ValidationWebhook == nil {
+		p.ValidationWebhook = primaryInstance.ValidationWebhook
+	} else if err := p.ValidationWebhook.Configure(); err != nil {
+		return fmt.Errorf("%s: validation webhook setup failed: %s", p.Name, err)
+	}
+
+	// Setup Multi-Factor Authentication
+	if p.MFA == nil {
+		p.MFA = primaryInstance.MFA
+	} else if err := p.MFA.Configure(); err != nil {
+		return fmt.Errorf("%s: multi-factor authentication setup failed: %s", p.Name, err)
+	}
+
+	// Setup Claims Transformation
+	if p.ClaimsTransformer == nil {
+		p.ClaimsTransformer = primaryInstance.ClaimsTransformer
+	} else if err := p.ClaimsTransformer.Validate(); err != nil {
+		return fmt.Errorf("%s: %s", p.Name, err)
+	}
+
+	// Setup Token Introspection
+	if p.Introspection == nil {
+		p.Introspection = primaryInstance.Introspection
+	}
+
+	// Setup Token Exchange
+	if p.TokenExchange == nil {
+		p.TokenExchange = primaryInstance.TokenExchange
+	} else if err := p.TokenExchange.Configure(); err != nil {
+		return fmt.Errorf("%s: token exchange setup failed: %s", p.Name, err)
+	}
+
+	// Setup Session Transfer
+	if p.SessionTransfer == nil {
+		p.SessionTransfer = primaryInstance.SessionTransfer
+	} else if err := p.SessionTransfer.Configure(); err != nil {
+		return fmt.Errorf("%s: session transfer setup failed: %s", p.Name, err)
+	}
+
+	// Setup Session Stats
+	if p.SessionStats == nil {
+		p.SessionStats = primaryInstance.SessionStats
+	} else if err := p.SessionStats.Configure(); err != nil {
+		return fmt.Errorf("%s: session stats setup failed: %s", p.Name, err)
+	}
+
+	// Setup Session Handles
+	if p.SessionHandles == nil {
+		p.SessionHandles = primaryInstance.SessionHandles
+	} else if err := p.SessionHandles.Configure(); err != nil {
+		return fmt.Errorf("%s: session handles setup failed: %s", p.Name, err)
+	}
+
+	// Setup Event Stream
+	if p.EventStream == nil {
+		p.EventStream = primaryInstance.EventStream
+	} else if err := p.EventStream.Configure(); err != nil {
+		return fmt.Errorf("%s: event stream setup failed: %s", p.Name, err)
+	}
+
+	// Setup Tracing
+	if p.Tracing == nil {
+		p.Tracing = primaryInstance.Tracing
+	} else if err := p.Tracing.Configure(p.logger); err != nil {
+		return fmt.Errorf("%s: tracing setup failed: %s", p.Name, err)
+	}
 
 	// User Interface Settings
 	if p.UserInterface == nil {
@@ -730,6 +1647,72 @@ func (m *AuthPortalManager) Provision(name string) error {
 		p.uiFactory.CustomJsPath = primaryInstance.uiFactory.CustomJsPath
 	}
 
+	if p.UserInterface.CustomPageHeaderPath == "" {
+		p.uiFactory.CustomPageHeader = primaryInstance.uiFactory.CustomPageHeader
+	} else {
+		b, err := ioutil.ReadFile(p.UserInterface.CustomPageHeaderPath)
+		if err != nil {
+			return fmt.Errorf("%s: custom page header: %s", p.Name, err)
+		}
+		p.uiFactory.CustomPageHeader = string(b)
+	}
+
+	if p.UserInterface.CustomPageFooterPath == "" {
+		p.uiFactory.CustomPageFooter = primaryInstance.uiFactory.CustomPageFooter
+	} else {
+		b, err := ioutil.ReadFile(p.UserInterface.CustomPageFooterPath)
+		if err != nil {
+			return fmt.Errorf("%s: custom page footer: %s", p.Name, err)
+		}
+		p.uiFactory.CustomPageFooter = string(b)
+	}
+
+	if p.UserInterface.LoginHintParameter == "" {
+		p.uiFactory.LoginHintParameter = primaryInstance.uiFactory.LoginHintParameter
+	} else {
+		p.uiFactory.LoginHintParameter = p.UserInterface.LoginHintParameter
+	}
+
+	if p.UserInterface.FallbackMessage == "" {
+		p.uiFactory.FallbackMessage = primaryInstance.uiFactory.FallbackMessage
+	} else {
+		p.uiFactory.FallbackMessage = p.UserInterface.FallbackMessage
+	}
+
+	switch p.UserInterface.LoginSuccess {
+	case "":
+		p.uiFactory.LoginSuccessPage = primaryInstance.uiFactory.LoginSuccessPage
+	case "redirect":
+	case "page":
+		p.uiFactory.LoginSuccessPage = true
+	default:
+		return fmt.Errorf("%s: login_success must be either redirect or page, got %s", p.Name, p.UserInterface.LoginSuccess)
+	}
+
+	switch p.UserInterface.SingleProviderRedirect {
+	case "":
+		p.uiFactory.SingleProviderRedirect = primaryInstance.uiFactory.SingleProviderRedirect
+	case "no":
+	case "yes":
+		p.uiFactory.SingleProviderRedirect = true
+	default:
+		return fmt.Errorf("%s: single_provider_redirect must be either yes or no, got %s", p.Name, p.UserInterface.SingleProviderRedirect)
+	}
+
+	switch p.UserInterface.SessionExpiryMeta {
+	case "":
+		p.uiFactory.SessionExpiryMeta = primaryInstance.uiFactory.SessionExpiryMeta
+	case "no":
+	case "yes":
+		p.uiFactory.SessionExpiryMeta = true
+	default:
+		return fmt.Errorf("%s: session_expiry_meta must be either yes or no, got %s", p.Name, p.UserInterface.SessionExpiryMeta)
+	}
+
+	if p.UserInterface.StaticAssetMaxAge < 1 {
+		p.UserInterface.StaticAssetMaxAge = primaryInstance.UserInterface.StaticAssetMaxAge
+	}
+
 	if p.UserInterface.LogoURL == "" {
 		p.uiFactory.LogoURL = primaryInstance.uiFactory.LogoURL
 		p.uiFactory.LogoDescription = primaryInstance.uiFactory.LogoDescription
@@ -817,6 +1800,18 @@ func (m *AuthPortalManager) Provision(name string) error {
 		}
 	}
 
+	// Setup UI Template Rollout
+	if p.UserInterface.Rollout == nil {
+		p.UserInterface.Rollout = primaryInstance.UserInterface.Rollout
+	} else if err := p.UserInterface.Rollout.Configure(); err != nil {
+		return fmt.Errorf("%s: UI settings validation error: %s", p.Name, err)
+	}
+	if p.UserInterface.Rollout != nil {
+		if err := p.uiFactory.AddRollout(p.UserInterface.Rollout); err != nil {
+			return fmt.Errorf("%s: UI settings validation error: %s", p.Name, err)
+		}
+	}
+
 	// JWT Token Validator
 	p.TokenValidator = jwtvalidator.NewTokenValidator()
 	tokenConfig := jwtconfig.NewCommonTokenConfig()
@@ -846,6 +1841,9 @@ func (m *AuthPortalManager) Provision(name string) error {
 	}
 
 	p.TokenValidator.TokenConfigs = []*jwtconfig.CommonTokenConfig{tokenConfig}
+	if err := p.configureSigningKeyring(signingKeyID, signingKey); err != nil {
+		return err
+	}
 	if err := p.TokenValidator.ConfigureTokenBackends(); err != nil {
 		return fmt.Errorf(
 			"%s: token validator backend configuration failed: %s",
@@ -878,9 +1876,11 @@ func (m *AuthPortalManager) Provision(name string) error {
 		zap.Any("access_list", p.TokenValidator.AccessList),
 	)
 
-	p.TokenValidator.TokenSources = []string{"cookie", "header", "query"}
+	p.TokenValidator.TokenSources = getTokenSources(p.TokenPrecedence)
 
-	p.TokenValidator.SetTokenName(p.TokenProvider.TokenName)
+	for _, tokenName := range p.getTokenCookieNames(nil) {
+		p.TokenValidator.SetTokenName(tokenName)
+	}
 
 	// Wrap up
 	p.Provisioned = true
@@ -888,3 +1888,46 @@ func (m *AuthPortalManager) Provision(name string) error {
 
 	return nil
 }
+
+// validateRealmAliases checks that every realm alias refers to a single
+// realm, and does not shadow the realm of another backend.
+func validateRealmAliases(entries []backends.Backend) error {
+	realms := make(map[string]bool)
+	for _, backend := range entries {
+		realms[backend.GetRealm()] = true
+	}
+	aliasRef := make(map[string]string)
+	for _, backend := range entries {
+		for _, alias := range backend.GetAliases() {
+			if realms[alias] {
+				return fmt.Errorf("backend %s realm alias %s collides with realm %s", backend.GetName(), alias, alias)
+			}
+			if realm, exists := aliasRef[alias]; exists && realm != backend.GetRealm() {
+				return fmt.Errorf("backend %s realm alias %s collides with alias of realm %s", backend.GetName(), alias, realm)
+			}
+			aliasRef[alias] = backend.GetRealm()
+		}
+	}
+	return nil
+}
+
+// loadRegistrationDatabase loads the registration database from the file.
+// It creates the file when it does not exist.
+func loadRegistrationDatabase(filePath string) (*identity.Database, error) {
+	db := identity.NewDatabase()
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("registration dropbox metadata read failed: %s", err)
+		}
+		if err := db.SaveToFile(filePath); err != nil {
+			return nil, fmt.Errorf("registration dropbox setup failed: %s", err)
+		}
+	} else if fileInfo.IsDir() {
+		return nil, fmt.Errorf("registration dropbox is a directory")
+	}
+	if err := db.LoadFromFile(filePath); err != nil {
+		return nil, fmt.Errorf("registration dropbox load failed: %s", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// authDuration is the histogram of the authentication latency of the
+// backends. It is registered with the default registry and is served by
+// the metrics endpoint of the server.
+var authDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "caddy",
+	Subsystem: "auth_portal",
+	Name:      "backend_authentication_duration_seconds",
+	Help:      "Histogram of the time spent authenticating users with a backend.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"realm", "name", "method"})
+
+// authenticate authenticates the request with the backend and records
+// the latency of the authentication. When the latency exceeds the slow
+// authentication threshold, it logs a warning. The request is tracked as
+// in-flight until the backend responds.
+func (p *AuthPortal) authenticate(reqID string, backend *backends.Backend, opts map[string]interface{}) (map[string]interface{}, error) {
+	defer p.inflight.track()()
+	startedAt := time.Now()
+	span := p.startBackendSpan(backend, opts)
+	resp, err := backend.Authenticate(opts)
+	endBackendSpan(span, err)
+	elapsed := time.Since(startedAt)
+	authDuration.WithLabelValues(backend.GetRealm(), backend.GetName(), backend.GetMethod()).Observe(elapsed.Seconds())
+	if p.SlowAuthThreshold > 0 && elapsed > time.Duration(p.SlowAuthThreshold)*time.Millisecond {
+		p.logger.Warn("Slow authentication",
+			zap.String("request_id", reqID),
+			zap.String("auth_realm", backend.GetRealm()),
+			zap.String("auth_backend", backend.GetName()),
+			zap.String("auth_method", backend.GetMethod()),
+			zap.Duration("duration", elapsed),
+			zap.Int("threshold_ms", p.SlowAuthThreshold),
+		)
+	}
+	return resp, err
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+// getMfaStep returns the multi-factor authentication step the user
+// authenticated by the backend must pass. It is "challenge" when the
+// user enrolled in a supported method, "enroll" when the user must
+// enroll in a method, and empty when the user may proceed. With
+// adaptive MFA, the users logging in from the trusted networks
+// proceed, and the other users of the local backend must pass it.
+func (p *AuthPortal) getMfaStep(r *http.Request, backend backends.Backend, claims *jwtclaims.UserClaims) (string, error) {
+	required := p.MFA.Required(backend.GetRealm(), claims.Roles)
+	if p.MFA.Adaptive {
+		if p.MFA.IsTrustedNetwork(r) {
+			return "", nil
+		}
+		if backend.GetMethod() == "local" {
+			required = true
+		}
+	}
+	if backend.GetMethod() != "local" {
+		if required {
+			return "", fmt.Errorf("multi-factor authentication is required, but not supported by %s backend", backend.GetName())
+		}
+		return "", nil
+	}
+	args := make(map[string]interface{})
+	args["username"] = claims.Subject
+	args["email"] = claims.Email
+	tokens, err := backend.GetMfaTokens(args)
+	if err != nil {
+		if required {
+			return "", err
+		}
+		return "", nil
+	}
+	if len(p.MFA.ForRealm(backend.GetRealm()).GetMethods(tokens)) > 0 {
+		return "challenge", nil
+	}
+	if required {
+		return "enroll", nil
+	}
+	return "", nil
+}
+
+// isTrustedDevice returns true when the request carries the cookie of
+// a device the user authenticated by the realm marked as trusted.
+func (p *AuthPortal) isTrustedDevice(r *http.Request, realm string, claims *jwtclaims.UserClaims) bool {
+	cookie, err := r.Cookie(trustedDeviceToken)
+	if err != nil {
+		return false
+	}
+	return p.MFA.IsTrustedDevice(cookie.Value, claims.Subject, realm)
+}
+
+// serveMfaChallenge stores the pending session of the user who passed
+// the first authentication factor and redirects the user to the
+// multi-factor authentication page. When the user must enroll in a
+// method, the session holds the secret of the new MFA token.
+func (p *AuthPortal) serveMfaChallenge(w http.ResponseWriter, r *http.Request, opts map[string]interface{}, backend backends.Backend, claims *jwtclaims.UserClaims, step string) error {
+	sessionID := utils.GetRandomStringFromRange(32, 48)
+	session := map[string]interface{}{
+		"claims":         claims,
+		"backend_name":   backend.GetName(),
+		"backend_realm":  backend.GetRealm(),
+		"backend_method": backend.GetMethod(),
+		"mfa_required":   true,
+		"expires_at":     time.Now().Add(mfaSessionLifetime),
+	}
+	if v, exists := opts["custom_claims"]; exists {
+		session["custom_claims"] = v
+	}
+	if v, exists := opts["password_expires_at"]; exists {
+		session["password_expires_at"] = v
+	}
+	if amr := getAuthMethodReferences(backend.GetMethod()); amr != nil {
+		session["amr"] = amr
+	}
+	if step == "enroll" {
+		session["mfa_enrollment"] = true
+		session["mfa_secret"] = utils.GetRandomStringFromRange(64, 92)
+	}
+	sessionCache.Add(sessionID, session)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Add("Set-Cookie", mfaSessionToken+"="+sessionID+";"+p.Cookies.GetAttributes())
+	w.Header().Set("Location", path.Join(p.AuthURLPath, "mfa"))
+	w.WriteHeader(302)
+	return nil
+}
+
+// getSessionBackend returns the backend that authenticated the user
+// of a cached session.
+func (p *AuthPortal) getSessionBackend(session map[string]interface{}) *backends.Backend {
+	for i, backend := range p.Backends {
+		if backend.GetRealm() != session["backend_realm"] {
+			continue
+		}
+		if backend.GetName() != session["backend_name"] {
+			continue
+		}
+		if backend.GetMethod() != session["backend_method"] {
+			continue
+		}
+		return &p.Backends[i]
+	}
+	return nil
+}
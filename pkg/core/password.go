@@ -0,0 +1,48 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+// servePasswordChange stores the pending session of the user whose
+// password expired and redirects the user to the password change page.
+// The user does not receive a token until the password is changed and
+// the user logs in with the new password.
+func (p *AuthPortal) servePasswordChange(w http.ResponseWriter, opts map[string]interface{}, backend backends.Backend, claims *jwtclaims.UserClaims) error {
+	sessionID := utils.GetRandomStringFromRange(32, 48)
+	sessionCache.Add(sessionID, map[string]interface{}{
+		"claims":                   claims,
+		"backend_name":             backend.GetName(),
+		"backend_realm":            backend.GetRealm(),
+		"backend_method":           backend.GetMethod(),
+		"password_change_required": true,
+		"expires_at":               time.Now().Add(passwordSessionLifetime),
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Add("Set-Cookie", passwordSessionToken+"="+sessionID+";"+p.Cookies.GetAttributes())
+	w.Header().Set("Location", path.Join(p.AuthURLPath, "password"))
+	w.WriteHeader(302)
+	return nil
+}
@@ -16,6 +16,7 @@ package core
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"path"
 	"strings"
@@ -27,18 +28,54 @@ import (
 
 	"github.com/greenpau/caddy-auth-portal/pkg/backends"
 	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/challenge"
+	"github.com/greenpau/caddy-auth-portal/pkg/compression"
 	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/denial"
+	"github.com/greenpau/caddy-auth-portal/pkg/dpop"
+	"github.com/greenpau/caddy-auth-portal/pkg/email"
+	"github.com/greenpau/caddy-auth-portal/pkg/enumeration"
+	"github.com/greenpau/caddy-auth-portal/pkg/events"
+	"github.com/greenpau/caddy-auth-portal/pkg/exchange"
+	"github.com/greenpau/caddy-auth-portal/pkg/flags"
 	"github.com/greenpau/caddy-auth-portal/pkg/handlers"
+	"github.com/greenpau/caddy-auth-portal/pkg/introspection"
+	"github.com/greenpau/caddy-auth-portal/pkg/logging"
+	"github.com/greenpau/caddy-auth-portal/pkg/maintenance"
+	"github.com/greenpau/caddy-auth-portal/pkg/mfa"
+	"github.com/greenpau/caddy-auth-portal/pkg/passthrough"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
+	"github.com/greenpau/caddy-auth-portal/pkg/ratelimit"
+	"github.com/greenpau/caddy-auth-portal/pkg/recovery"
 	"github.com/greenpau/caddy-auth-portal/pkg/registration"
+	"github.com/greenpau/caddy-auth-portal/pkg/robots"
+	"github.com/greenpau/caddy-auth-portal/pkg/routing"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"github.com/greenpau/caddy-auth-portal/pkg/signing"
+	"github.com/greenpau/caddy-auth-portal/pkg/tracing"
+	"github.com/greenpau/caddy-auth-portal/pkg/transformer"
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/unsupported"
 	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"github.com/greenpau/caddy-auth-portal/pkg/webhook"
 	"github.com/greenpau/go-identity"
 	"github.com/satori/go.uuid"
 	"go.uber.org/zap"
 )
 
 const (
-	redirectToToken = "AUTH_PORTAL_REDIRECT_URL"
+	redirectToToken      = "AUTH_PORTAL_REDIRECT_URL"
+	redirectCountToken   = "AUTH_PORTAL_REDIRECT_COUNT"
+	mfaSessionToken      = "AUTH_PORTAL_MFA_SESSION"
+	passwordSessionToken = "AUTH_PORTAL_PASSWORD_SESSION"
+	trustedDeviceToken   = "AUTH_PORTAL_TRUSTED_DEVICE"
+
+	defaultRedirectLoopThreshold = 5
+	defaultDrainTimeout          = 10
+	defaultStaticAssetMaxAge     = 7200
+	mfaSessionLifetime           = 5 * time.Minute
+	passwordSessionLifetime      = 5 * time.Minute
 )
 
 // PortalManager is the global authentication provider pool.
@@ -68,11 +105,71 @@ type AuthPortal struct {
 	Backends                 []backends.Backend           `json:"backends,omitempty"`
 	TokenProvider            *jwtconfig.CommonTokenConfig `json:"jwt,omitempty"`
 	EnableSourceIPTracking   bool                         `json:"source_ip_tracking,omitempty"`
+	CoalesceLogins           bool                         `json:"coalesce_logins,omitempty"`
+	AmrClaim                 string                       `json:"amr_claim,omitempty"`
+	PostOnlyCredentials      bool                         `json:"post_only_credentials,omitempty"`
+	Maintenance              *maintenance.Maintenance     `json:"maintenance,omitempty"`
+	Introspection            *introspection.Introspection `json:"introspection,omitempty"`
+	TokenExchange            *exchange.Exchange           `json:"token_exchange,omitempty"`
+	SessionTransfer          *sessions.Transfer           `json:"session_transfer,omitempty"`
+	SessionStats             *sessions.Stats              `json:"session_stats,omitempty"`
+	SessionHandles           *sessions.Handles            `json:"session_handles,omitempty"`
+	EventStream              *events.Stream               `json:"event_stream,omitempty"`
+	Tracing                  *tracing.Tracing             `json:"tracing,omitempty"`
+	RedirectLoopThreshold    int                          `json:"redirect_loop_threshold,omitempty"`
+	ClaimsTransformer        *transformer.Transformer     `json:"claims_transformer,omitempty"`
+	HeadRequests             string                       `json:"head_requests,omitempty"`
+	UnauthenticatedRequests  string                       `json:"unauthenticated_requests,omitempty"`
+	RedirectPreservation     string                       `json:"redirect_preservation,omitempty"`
+	TokenPrecedence          string                       `json:"token_precedence,omitempty"`
+	Recovery                 *recovery.Recovery           `json:"recovery,omitempty"`
+	MFA                      *mfa.Config                  `json:"mfa,omitempty"`
+	SessionIdleTimeout       int                          `json:"session_idle_timeout,omitempty"`
+	SessionMaxAge            int                          `json:"session_max_age,omitempty"`
+	MaxTokenAge              int                          `json:"max_token_age,omitempty"`
+	SessionCacheTTL          int                          `json:"session_cache_ttl,omitempty"`
+	AntiEnumeration          *enumeration.AntiEnumeration `json:"anti_enumeration,omitempty"`
+	ParallelRealms           []string                     `json:"parallel_realms,omitempty"`
+	RealmRouting             *routing.Router              `json:"realm_routing,omitempty"`
+	RealmHostRestriction     *routing.HostRestriction     `json:"realm_host_restriction,omitempty"`
+	RateLimit                *ratelimit.RateLimit         `json:"rate_limit,omitempty"`
+	RequiredClaims           map[string][]string          `json:"required_claims,omitempty"`
+	DenyClaims               []*denial.Rule               `json:"deny_claims,omitempty"`
+	FeatureFlags             *flags.Config                `json:"feature_flags,omitempty"`
+	RealmSigningKeys         []*signing.RealmKey          `json:"realm_signing_keys,omitempty"`
+	ProfileSchema            *profile.Schema              `json:"profile_schema,omitempty"`
+	UsernamePolicy           *validators.UsernamePolicy   `json:"username_policy,omitempty"`
+	PasswordBreachCheck      *validators.BreachCheck      `json:"password_breach_check,omitempty"`
+	RedirectPassthrough      *passthrough.Config          `json:"redirect_passthrough,omitempty"`
+	UnauthorizedBody         *challenge.Body              `json:"unauthorized_body,omitempty"`
+	UnsupportedFlows         *unsupported.Responses       `json:"unsupported_flows,omitempty"`
+	ValidationWebhook        *webhook.Webhook             `json:"validation_webhook,omitempty"`
+	Compression              *compression.Compression     `json:"compression,omitempty"`
+	StripHeaders             []string                     `json:"strip_headers,omitempty"`
+	DPoP                     *dpop.Config                 `json:"dpop,omitempty"`
+	SessionIPChange          string                       `json:"session_ip_change,omitempty"`
+	TrustedProxies           []string                     `json:"trusted_proxies,omitempty"`
+	Robots                   *robots.Robots               `json:"robots,omitempty"`
+	SlowAuthThreshold        int                          `json:"slow_auth_threshold,omitempty"`
+	LoginResultWindow        int                          `json:"login_result_window,omitempty"`
+	DrainTimeout             int                          `json:"drain_timeout,omitempty"`
+	Logging                  *logging.Config              `json:"logging,omitempty"`
+	SMTP                     *email.Config                `json:"smtp,omitempty"`
+	LinkBaseURL              string                       `json:"link_base_url,omitempty"`
+	EmailChange              *email.Change                `json:"email_change,omitempty"`
+	LockoutNotice            *email.LockoutNotice         `json:"lockout_notice,omitempty"`
+	WelcomeNotice            *email.WelcomeNotice         `json:"welcome_notice,omitempty"`
 	TokenValidator           *jwtvalidator.TokenValidator `json:"-"`
 	logger                   *zap.Logger
 	uiFactory                *ui.UserInterfaceFactory
 	startedAt                time.Time
 	loginOptions             map[string]interface{}
+	registrationDatabases    map[string]*identity.Database
+	logins                   loginGroup
+	loginResults             loginResultCache
+	inflight                 loginTracker
+	signingKeyring           *signing.Keyring
+	trustedProxies           []*net.IPNet
 }
 
 // Configure configures the instance of authentication portal.
@@ -113,9 +210,25 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 	} else {
 		reqID = GetRequestID(r)
 	}
-	log := p.logger
+	// Remove the client-supplied headers the portal must not trust.
+	for _, header := range p.StripHeaders {
+		r.Header.Del(header)
+	}
+	cw := p.Compression.NewResponseWriter(w, r)
+	defer cw.Close()
+	w = cw
 	opts := make(map[string]interface{})
+	// Sample the log entries of the request by its flow and outcome.
+	log := p.Logging.Sample(p.logger, reqID, func() string {
+		flow, _ := opts["flow"].(string)
+		return flow
+	})
+	if span := p.startRequestSpan(r); span != nil {
+		opts["trace_span"] = span
+		defer endRequestSpan(span, opts)
+	}
 	opts["request_id"] = reqID
+	opts["src_ip"] = p.getSourceAddress(r)
 	opts["content_type"] = utils.GetContentType(r)
 	opts["authenticated"] = false
 	opts["auth_backend_found"] = false
@@ -124,26 +237,115 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 	opts["auth_url_path"] = p.AuthURLPath
 	opts["ui"] = p.uiFactory
 	opts["cookies"] = p.Cookies
-	opts["cookie_names"] = []string{redirectToToken, p.TokenProvider.TokenName}
+	setTokenCookieNames(opts, p.getTokenCookieNames(nil))
 	opts["token_provider"] = p.TokenProvider
+	opts["signing_keyring"] = p.signingKeyring
 	if p.UserInterface.Title != "" {
 		opts["ui_title"] = p.UserInterface.Title
 	}
 	opts["redirect_token_name"] = redirectToToken
+	opts["redirect_count_token_name"] = redirectCountToken
+	opts["redirect_loop_threshold"] = p.RedirectLoopThreshold
+	opts["unauthenticated_requests"] = p.UnauthenticatedRequests
+	if p.RedirectPassthrough.Enabled() {
+		opts["redirect_passthrough"] = p.RedirectPassthrough
+	}
+	if p.DPoP.Enabled {
+		opts["dpop"] = p.DPoP
+	}
+	if p.PasswordBreachCheck.Enabled() {
+		opts["password_breach_check"] = p.PasswordBreachCheck
+	}
+	if p.SessionHandles.Enabled() {
+		opts["session_handles"] = p.SessionHandles
+		opts["session_cache"] = sessionCache
+	}
+	if p.AmrClaim != "" {
+		opts["amr_claim"] = p.AmrClaim
+	}
+	if p.UnauthorizedBody.Enabled() {
+		opts["unauthorized_body"] = p.UnauthorizedBody
+		opts["unauthorized_realms"] = p.getRealms()
+	}
+	if p.UnsupportedFlows.Enabled() {
+		opts["unsupported_responses"] = p.UnsupportedFlows
+	}
 
 	urlPath := strings.TrimPrefix(r.URL.Path, p.AuthURLPath)
 	urlPath = strings.TrimPrefix(urlPath, "/")
 
+	// Ask search engines not to index the pages of the portal.
+	if urlPath != "robots.txt" {
+		p.Robots.SetHeader(w)
+	}
+
+	// Respond to HEAD requests with the headers of GET requests.
+	if r.Method == "HEAD" {
+		if p.HeadRequests == "reject" || !isHeadRequestAllowed(urlPath) {
+			w.Header().Set("Allow", "GET, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return nil
+		}
+		w = &headResponseWriter{ResponseWriter: w}
+	}
+
+	// Reject the requests carrying different tokens in the cookie and
+	// the Authorization header, when configured.
+	if err := p.checkTokenConflict(r); err != nil {
+		log.Warn("Rejected conflicting tokens",
+			zap.String("request_id", reqID),
+			zap.String("error", err.Error()),
+			zap.String("src_ip_address", utils.GetSourceAddress(r)),
+		)
+		opts["flow"] = "policy_violation"
+		opts["message"] = "Conflicting tokens"
+		return handlers.ServeGeneric(w, r, opts)
+	}
+
 	// Find JWT tokens, if any, and validate them.
-	if claims, authOK, err := p.TokenValidator.Authorize(r, nil); authOK {
+	if claims, authOK, err := p.authorize(r); authOK {
 		opts["authenticated"] = true
 		opts["user_claims"] = claims
+		if customClaims := p.getUserCustomClaims(r); customClaims != nil {
+			opts["user_custom_claims"] = customClaims
+		}
+		if p.FeatureFlags.Enabled() && p.FeatureFlags.Output == "header" {
+			p.addFeatureFlags(w, reqID, claims, opts)
+		}
+		if p.Cookies.PerRealm {
+			setTokenCookieNames(opts, p.getTokenCookieNames(sessionCache.Get(claims.ID)))
+		}
 	} else {
 		if err != nil {
 			switch err.Error() {
 			case "[Token is expired]":
+				if urlPath == "session/ping" {
+					break
+				}
 				return handlers.ServeSessionLoginRedirect(w, r, opts)
 			case "no token found":
+			case errTokenTooOld.Error():
+				log.Debug("Rejected token exceeding maximum age",
+					zap.String("request_id", reqID),
+					zap.Int("max_token_age", p.MaxTokenAge),
+				)
+				for _, cookieName := range opts["cookie_names"].([]string) {
+					w.Header().Add("Set-Cookie", cookieName+"=delete;"+p.Cookies.GetDeleteAttributes())
+				}
+				opts["flow"] = "unauthenticated"
+				opts["message"] = "The session is too old, please sign in again"
+				return handlers.ServeGeneric(w, r, opts)
+			case sessions.ErrSessionRevoked.Error():
+				log.Debug("Rejected token of revoked session",
+					zap.String("request_id", reqID),
+				)
+				for _, name := range opts["token_cookie_names"].([]string) {
+					w.Header().Add("Set-Cookie", name+"=delete;"+p.Cookies.GetDeleteAttributes())
+				}
+			case errInvalidDPoPProof.Error():
+				w.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+				opts["flow"] = "auth_failed"
+				return handlers.ServeGeneric(w, r, opts)
 			default:
 				log.Warn("Authorization failed",
 					zap.String("request_id", opts["request_id"].(string)),
@@ -154,17 +356,75 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 		}
 	}
 
+	// Expire the sessions idle for longer than the idle timeout. The
+	// activity of the other sessions is recorded.
+	if opts["authenticated"].(bool) && p.SessionIdleTimeout > 0 {
+		claims := opts["user_claims"].(*jwtclaims.UserClaims)
+		idleTimeout := time.Duration(p.SessionIdleTimeout) * time.Minute
+		if lastActivity, exists := sessionCache.GetLastActivity(claims.ID); exists && time.Since(lastActivity) > idleTimeout {
+			log.Debug("Session expired due to inactivity",
+				zap.String("request_id", reqID),
+				zap.String("session_id", claims.ID),
+				zap.Time("last_activity", lastActivity),
+			)
+			opts["authenticated"] = false
+			delete(opts, "user_claims")
+		} else if r.Method != "HEAD" && sessionCache.Get(claims.ID) != nil {
+			sessionCache.Touch(claims.ID)
+		}
+	}
+
+	// Expire the sessions older than the maximum session age, even
+	// when their tokens and cookies are still valid.
+	if opts["authenticated"].(bool) {
+		claims := opts["user_claims"].(*jwtclaims.UserClaims)
+		if maxExpiresAt, exists := p.getSessionMaxExpiry(claims); exists && time.Now().After(maxExpiresAt) {
+			log.Debug("Session expired due to maximum session age",
+				zap.String("request_id", reqID),
+				zap.String("session_id", claims.ID),
+				zap.Time("max_expires_at", maxExpiresAt),
+			)
+			sessionCache.Delete(claims.ID)
+			opts["authenticated"] = false
+			delete(opts, "user_claims")
+		}
+	}
+
+	// Select the templates of the user during the gradual rollout.
+	switch p.uiFactory.GetRolloutKey() {
+	case "session":
+		if opts["authenticated"].(bool) {
+			opts["ui"] = p.uiFactory.ForKey(opts["user_claims"].(*jwtclaims.UserClaims).ID)
+		} else {
+			opts["ui"] = p.uiFactory.ForKey(utils.GetSourceAddress(r))
+		}
+	case "ip":
+		opts["ui"] = p.uiFactory.ForKey(utils.GetSourceAddress(r))
+	}
+
+	// Respond to the change of the source address of the session.
+	if p.checkSessionAddress(w, r, opts) && !isReverifyExempt(urlPath) {
+		if opts["content_type"].(string) == "application/json" {
+			opts["flow"] = "auth_failed"
+			opts["message"] = "Session re-verification required"
+			return handlers.ServeGeneric(w, r, opts)
+		}
+		w.Header().Set("Location", path.Join(p.AuthURLPath, "reverify"))
+		w.WriteHeader(302)
+		return nil
+	}
+
 	// Handle requests based on query parameters.
 	if r.Method == "GET" {
 		q := r.URL.Query()
 		foundQueryOptions := false
 		if redirectURL, exists := q["redirect_url"]; exists {
 			if !strings.HasSuffix(redirectURL[0], ".css") && !strings.HasSuffix(redirectURL[0], ".js") {
-				w.Header().Set("Set-Cookie", redirectToToken+"="+redirectURL[0]+";"+p.Cookies.GetAttributes())
+				w.Header().Set("Set-Cookie", redirectToToken+"="+p.Cookies.SignRedirectURL(redirectURL[0])+";"+p.Cookies.GetAttributes())
 				foundQueryOptions = true
 			}
 		}
-		if !strings.HasPrefix(urlPath, "saml") && !strings.HasPrefix(urlPath, "x509") && !strings.HasPrefix(urlPath, "oauth2") {
+		if !strings.HasPrefix(urlPath, "saml") && !strings.HasPrefix(urlPath, "x509") && !strings.HasPrefix(urlPath, "oauth2") && !strings.HasPrefix(urlPath, "gateway") {
 			if foundQueryOptions {
 				w.Header().Set("Location", p.AuthURLPath)
 				w.WriteHeader(302)
@@ -173,36 +433,205 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 		}
 	}
 
+	// Reject the requests of the users with existing sessions, unless
+	// the sessions are allowed or the users may bypass maintenance.
+	if p.Maintenance.Enabled && opts["authenticated"].(bool) {
+		if !strings.HasPrefix(urlPath, "assets") && !strings.HasPrefix(urlPath, "logout") && !strings.HasPrefix(urlPath, "logoff") {
+			claims := opts["user_claims"].(*jwtclaims.UserClaims)
+			if !p.Maintenance.AllowSession(claims.Roles) {
+				return p.serveMaintenance(w, r, opts)
+			}
+		}
+	}
+
 	// Perform request routing
 	switch {
 	case strings.HasPrefix(urlPath, "register"):
-		if p.UserRegistration.Disabled {
-			opts["flow"] = "unsupported_feature"
-			return handlers.ServeGeneric(w, r, opts)
+		if p.Maintenance.Enabled {
+			return p.serveMaintenance(w, r, opts)
 		}
-		if p.UserRegistration.Dropbox == "" {
-			opts["flow"] = "unsupported_feature"
-			return handlers.ServeGeneric(w, r, opts)
+		registrationRealm := strings.Trim(strings.TrimPrefix(urlPath, "register"), "/")
+		if registrationRealm != "" {
+			realmRegistration := p.UserRegistration.ForRealm(registrationRealm)
+			if realmRegistration == nil {
+				return handlers.ServeUnsupported(w, r, opts, "register")
+			}
+			opts["registration"] = realmRegistration
+			opts["registration_db"] = p.registrationDatabases[registrationRealm]
+			opts["registration_realm"] = registrationRealm
+		} else {
+			if p.UserRegistration.Disabled {
+				return handlers.ServeUnsupported(w, r, opts, "register")
+			}
+			if p.UserRegistration.Dropbox == "" {
+				return handlers.ServeUnsupported(w, r, opts, "register")
+			}
+			opts["registration"] = p.UserRegistration
+			opts["registration_db"] = p.UserRegistrationDatabase
 		}
 		opts["flow"] = "register"
-		opts["registration"] = p.UserRegistration
-		opts["registration_db"] = p.UserRegistrationDatabase
+		opts["anti_enumeration"] = p.AntiEnumeration
+		opts["profile_schema"] = p.ProfileSchema
+		opts["username_policy"] = p.UsernamePolicy
+		opts["session_cache"] = sessionCache
 		return handlers.ServeRegister(w, r, opts)
+	case strings.HasPrefix(urlPath, "invitation"):
+		if p.Maintenance.Enabled {
+			return p.serveMaintenance(w, r, opts)
+		}
+		opts["flow"] = "invitation"
+		opts["registration"] = p.UserRegistration
+		opts["link_base_url"] = p.LinkBaseURL
+		return handlers.ServeInvitation(w, r, opts)
 	case strings.HasPrefix(urlPath, "recover"),
 		strings.HasPrefix(urlPath, "forgot"):
-		// opts["flow"] = "recover"
-		opts["flow"] = "unsupported_feature"
-		return handlers.ServeGeneric(w, r, opts)
+		if !p.Recovery.Enabled() {
+			return handlers.ServeUnsupported(w, r, opts, "recover")
+		}
+		opts["flow"] = "recover"
+		opts["recovery"] = p.Recovery
+		opts["backends"] = p.Backends
+		opts["anti_enumeration"] = p.AntiEnumeration
+		opts["smtp"] = p.SMTP
+		opts["link_base_url"] = p.LinkBaseURL
+		opts["session_cache"] = sessionCache
+		return handlers.ServeRecover(w, r, opts)
+	case strings.HasPrefix(urlPath, "mfa"):
+		opts["flow"] = "mfa"
+		opts["mfa"] = p.MFA
+		opts["mfa_token_name"] = mfaSessionToken
+		opts["trusted_device_token_name"] = trustedDeviceToken
+		opts["session_cache"] = sessionCache
+		opts["event_stream"] = p.EventStream
+		if cookie, err := r.Cookie(mfaSessionToken); err == nil {
+			if session := sessionCache.Get(cookie.Value); session != nil && session["mfa_required"] == true {
+				if backend := p.getSessionBackend(session); backend != nil {
+					opts["mfa_session_id"] = cookie.Value
+					opts["mfa_session"] = session
+					opts["backend"] = backend
+					opts["mfa"] = p.MFA.ForRealm(backend.GetRealm())
+				}
+			}
+		}
+		err := handlers.ServeMFA(w, r, opts)
+		if opts["flow"] == "login" && opts["authenticated"] == true {
+			if backend, ok := opts["backend"].(*backends.Backend); ok {
+				p.welcomeUser(reqID, backend.GetRealm(), opts["user_claims"].(*jwtclaims.UserClaims))
+			}
+		}
+		return err
+	case strings.HasPrefix(urlPath, "password"):
+		opts["flow"] = "password_change"
+		opts["password_token_name"] = passwordSessionToken
+		opts["session_cache"] = sessionCache
+		if cookie, err := r.Cookie(passwordSessionToken); err == nil {
+			if session := sessionCache.Get(cookie.Value); session != nil && session["password_change_required"] == true {
+				if backend := p.getSessionBackend(session); backend != nil {
+					opts["password_session_id"] = cookie.Value
+					opts["password_session"] = session
+					opts["backend"] = backend
+				}
+			}
+		}
+		return handlers.ServePasswordChange(w, r, opts)
 	case strings.HasPrefix(urlPath, "logout"),
 		strings.HasPrefix(urlPath, "logoff"):
 		opts["flow"] = "logout"
+		if opts["authenticated"].(bool) {
+			claims := opts["user_claims"].(*jwtclaims.UserClaims)
+			session := sessionCache.Get(claims.ID)
+			realm, _ := session["backend_realm"].(string)
+			p.publishEvent(r, reqID, "logout", realm, claims.Subject)
+			if handle := p.SessionHandles.GetHandle(r); handle != "" {
+				p.SessionHandles.Revoke(sessionCache, handle)
+			}
+			opts["session_cache"] = sessionCache
+			opts["session_id"] = claims.ID
+			if session != nil {
+				if backend := p.getSessionBackend(session); backend != nil && backend.GetMethod() == "oauth2" {
+					logoutOpts := map[string]interface{}{
+						"post_logout_redirect_uri": utils.GetCurrentBaseURL(r) + p.AuthURLPath,
+					}
+					if v, exists := session["id_token"]; exists {
+						logoutOpts["id_token"] = v
+					}
+					logoutURL, err := backend.GetLogoutURL(logoutOpts)
+					if err != nil {
+						log.Warn("Failed building provider logout URL",
+							zap.String("request_id", reqID),
+							zap.String("auth_realm", backend.GetRealm()),
+							zap.String("error", err.Error()),
+						)
+					} else if logoutURL != "" {
+						opts["logout_url"] = logoutURL
+					}
+				}
+			}
+		}
 		return handlers.ServeSessionLogoff(w, r, opts)
+	case strings.HasPrefix(urlPath, "reverify"):
+		opts["flow"] = "reverify"
+		if opts["authenticated"].(bool) {
+			claims := opts["user_claims"].(*jwtclaims.UserClaims)
+			if session := sessionCache.Get(claims.ID); session != nil && session["reverify_required"] == true {
+				if backend := p.getSessionBackend(session); backend != nil {
+					opts["backend"] = backend
+					opts["mfa"] = p.MFA.ForRealm(backend.GetRealm())
+				}
+			}
+		}
+		opts["session_cache"] = sessionCache
+		if _, exists := opts["mfa"]; !exists {
+			opts["mfa"] = p.MFA
+		}
+		return handlers.ServeReverify(w, r, opts)
+	case urlPath == ".well-known/jwks.json":
+		opts["flow"] = "jwks"
+		return handlers.ServeJWKS(w, r, opts)
+	case urlPath == "robots.txt":
+		opts["flow"] = "robots"
+		opts["robots"] = p.Robots
+		return handlers.ServeRobots(w, r, opts)
 	case strings.HasPrefix(urlPath, "assets"):
 		opts["url_path"] = urlPath
+		opts["static_asset_max_age"] = p.UserInterface.StaticAssetMaxAge
 		opts["flow"] = "assets"
 		return handlers.ServeStaticAssets(w, r, opts)
+	case strings.HasPrefix(urlPath, "introspect"):
+		opts["flow"] = "introspect"
+		opts["introspection"] = p.Introspection
+		opts["max_token_age"] = p.MaxTokenAge
+		opts["session_cache"] = sessionCache
+		opts["token_validator"] = p.TokenValidator
+		return handlers.ServeIntrospect(w, r, opts)
+	case urlPath == "token/exchange":
+		opts["flow"] = "token_exchange"
+		opts["token_exchange"] = p.TokenExchange
+		opts["max_token_age"] = p.MaxTokenAge
+		opts["session_cache"] = sessionCache
+		opts["token_validator"] = p.TokenValidator
+		return handlers.ServeTokenExchange(w, r, opts)
+	case urlPath == "admin/sessions":
+		opts["flow"] = "session_transfer"
+		opts["session_transfer"] = p.SessionTransfer
+		opts["session_cache"] = sessionCache
+		return handlers.ServeSessionTransfer(w, r, opts)
+	case urlPath == "admin/sessions/stats":
+		opts["flow"] = "session_stats"
+		opts["session_stats"] = p.SessionStats
+		opts["session_cache"] = sessionCache
+		return handlers.ServeSessionStats(w, r, opts)
+	case urlPath == "admin/events":
+		opts["flow"] = "admin_events"
+		opts["event_stream"] = p.EventStream
+		return handlers.ServeEventStream(w, r, opts)
+	case urlPath == "session/ping":
+		opts["flow"] = "session_ping"
+		p.setSessionExpiryOptions(opts)
+		return handlers.ServeSessionPing(w, r, opts)
 	case strings.HasPrefix(urlPath, "whoami"):
 		opts["flow"] = "whoami"
+		p.setSessionExpiryOptions(opts)
 		return handlers.ServeWhoami(w, r, opts)
 	case strings.HasPrefix(urlPath, "settings"):
 		opts["flow"] = "settings"
@@ -233,17 +662,38 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 					}
 				}
 			}
+			if session := sessionCache.Get(claims.ID); session != nil {
+				opts["session"] = session
+			}
 			if _, exists := opts["backend"]; !exists {
 				opts["flow"] = "logout"
 				opts["redirect_url"] = r.RequestURI
 				return handlers.ServeSessionLogoff(w, r, opts)
 			}
 		}
+		opts["recovery"] = p.Recovery
+		opts["mfa"] = p.MFA
+		opts["smtp"] = p.SMTP
+		opts["link_base_url"] = p.LinkBaseURL
+		opts["email_change"] = p.EmailChange
+		opts["profile_schema"] = p.ProfileSchema
+		opts["session_cache"] = sessionCache
+		p.setSessionExpiryOptions(opts)
 		return handlers.ServeSettings(w, r, opts)
 	case strings.HasPrefix(urlPath, "portal"):
 		opts["flow"] = "portal"
+		if opts["authenticated"].(bool) {
+			claims := opts["user_claims"].(*jwtclaims.UserClaims)
+			if session := sessionCache.Get(claims.ID); session != nil {
+				if v, exists := session["password_expires_at"]; exists {
+					opts["password_expires_at"] = v
+				}
+			}
+		}
+		p.setSessionExpiryOptions(opts)
 		return handlers.ServePortal(w, r, opts)
-	case strings.HasPrefix(urlPath, "saml"), strings.HasPrefix(urlPath, "x509"), strings.HasPrefix(urlPath, "oauth2"):
+	case strings.HasPrefix(urlPath, "saml"), strings.HasPrefix(urlPath, "x509"), strings.HasPrefix(urlPath, "oauth2"),
+		strings.HasPrefix(urlPath, "gateway"):
 		urlPathParts := strings.Split(urlPath, "/")
 		if len(urlPathParts) < 2 {
 			opts["status_code"] = 400
@@ -254,8 +704,11 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 		reqBackendMethod := urlPathParts[0]
 		reqBackendRealm := urlPathParts[1]
 		opts["flow"] = reqBackendMethod
+		if !p.RealmHostRestriction.AllowProvider(r, reqBackendRealm) {
+			return p.serveRealmNotAllowed(w, r, reqBackendRealm, opts)
+		}
 		for _, backend := range p.Backends {
-			if backend.GetRealm() != reqBackendRealm {
+			if !backend.MatchRealm(reqBackendRealm) {
 				continue
 			}
 			if backend.GetMethod() != reqBackendMethod {
@@ -263,11 +716,19 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 			}
 			opts["request"] = r
 			opts["request_path"] = path.Join(p.AuthURLPath, reqBackendMethod, reqBackendRealm)
-			resp, err := backend.Authenticate(opts)
+			if p.RedirectPreservation == "state" {
+				if v := p.getLoginRedirectURL(r); v != "" {
+					opts["login_redirect_url"] = v
+				}
+			}
+			resp, err := p.authenticate(reqID, &backend, opts)
 			if err != nil {
 				opts["flow"] = "auth_failed"
 				opts["authenticated"] = false
 				opts["message"] = "Authentication failed"
+				if msg, ok := resp["message"].(string); ok {
+					opts["message"] = msg
+				}
 				opts["status_code"] = resp["code"].(int)
 				log.Warn("Authentication failed",
 					zap.String("request_id", reqID),
@@ -275,6 +736,7 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 					zap.String("auth_realm", reqBackendRealm),
 					zap.String("error", err.Error()),
 				)
+				p.publishEvent(r, reqID, "login_failed", reqBackendRealm, "")
 				return handlers.ServeGeneric(w, r, opts)
 			}
 			if v, exists := resp["redirect_url"]; exists {
@@ -295,30 +757,93 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 					zap.String("auth_realm", reqBackendRealm),
 					zap.String("error", err.Error()),
 				)
+				p.publishEvent(r, reqID, "login_failed", reqBackendRealm, "")
 				return handlers.ServeGeneric(w, r, opts)
 			}
 
 			claims := resp["claims"].(*jwtclaims.UserClaims)
+			if v, exists := resp["login_redirect_url"]; exists {
+				opts["login_redirect_url"] = v
+			}
+			if p.Maintenance.Enabled && !p.Maintenance.Bypass(claims.Roles) {
+				log.Warn("Authentication rejected due to maintenance",
+					zap.String("request_id", reqID),
+					zap.String("auth_method", reqBackendMethod),
+					zap.String("auth_realm", reqBackendRealm),
+					zap.String("user", claims.Subject),
+				)
+				return p.serveMaintenance(w, r, opts)
+			}
 			claims.ID = reqID
 			claims.Issuer = utils.GetCurrentURL(r)
 			if p.EnableSourceIPTracking {
 				claims.Address = utils.GetSourceAddress(r)
 			}
-			sessionCache.Add(claims.ID, map[string]interface{}{
-				"claims":         claims,
-				"backend_name":   backend.GetName(),
-				"backend_realm":  backend.GetRealm(),
-				"backend_method": backend.GetMethod(),
-			})
+			if _, err := p.getMfaStep(r, backend, claims); err != nil {
+				opts["flow"] = "auth_failed"
+				opts["authenticated"] = false
+				opts["message"] = "Authentication failed"
+				log.Warn("Authentication failed",
+					zap.String("request_id", reqID),
+					zap.String("auth_method", reqBackendMethod),
+					zap.String("auth_realm", reqBackendRealm),
+					zap.String("user", claims.Subject),
+					zap.String("error", err.Error()),
+				)
+				p.publishEvent(r, reqID, "login_failed", reqBackendRealm, claims.Subject)
+				return handlers.ServeGeneric(w, r, opts)
+			}
+			session := map[string]interface{}{
+				"claims":           claims,
+				"backend_name":     backend.GetName(),
+				"backend_realm":    backend.GetRealm(),
+				"backend_method":   backend.GetMethod(),
+				"authenticated_at": time.Now(),
+				"src_ip":           opts["src_ip"],
+				"user_agent":       r.UserAgent(),
+			}
+			if v, exists := resp["id_token"]; exists {
+				session["id_token"] = v
+			}
+			sessionCache.Add(claims.ID, session)
 			opts["authenticated"] = true
 			opts["user_claims"] = claims
+			opts["auth_realm"] = backend.GetRealm()
+			if amr := getAuthMethodReferences(backend.GetMethod()); amr != nil {
+				opts["amr"] = amr
+			}
+			if v, exists := resp["custom_claims"]; exists {
+				opts["custom_claims"] = v
+			}
+			p.transformClaims(reqID, backend.GetRealm(), claims, opts)
+			if err := p.validateClaims(reqID, backend.GetRealm(), claims, opts); err != nil {
+				sessionCache.Delete(claims.ID)
+				opts["flow"] = "auth_failed"
+				if _, denied := err.(*denial.DenyError); denied {
+					opts["flow"] = "access_denied"
+				}
+				opts["authenticated"] = false
+				opts["message"] = getClaimsErrorMessage(err)
+				log.Warn("Authentication failed",
+					zap.String("request_id", reqID),
+					zap.String("auth_method", reqBackendMethod),
+					zap.String("auth_realm", reqBackendRealm),
+					zap.String("user", claims.Subject),
+					zap.String("error", err.Error()),
+				)
+				p.publishEvent(r, reqID, "login_failed", reqBackendRealm, claims.Subject)
+				return handlers.ServeGeneric(w, r, opts)
+			}
+			p.addFeatureFlags(w, reqID, claims, opts)
 			opts["status_code"] = 200
 			log.Debug("Authentication succeeded",
 				zap.String("request_id", reqID),
 				zap.String("auth_method", reqBackendMethod),
 				zap.String("auth_realm", reqBackendRealm),
-				zap.Any("user", claims),
+				p.Logging.Claims("user", claims),
 			)
+			p.publishEvent(r, reqID, "login", backend.GetRealm(), claims.Subject)
+			p.welcomeUser(reqID, backend.GetRealm(), claims)
 			return handlers.ServeLogin(w, r, opts)
 		}
 		opts["status_code"] = 400
@@ -328,20 +853,100 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 	case strings.HasPrefix(urlPath, "login"), urlPath == "":
 		opts["flow"] = "login"
 		opts["login_options"] = p.loginOptions
+		startedAt := time.Now()
+		if p.Maintenance.Enabled {
+			opts["message"] = p.Maintenance.Message
+		}
 		if opts["authenticated"].(bool) {
 			opts["authorized"] = true
-		} else {
+		} else if r.Method != "HEAD" {
+			if err := p.checkCredentialsTransport(r); err != nil {
+				log.Warn("Rejected credentials",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+				opts["flow"] = "policy_violation"
+				opts["message"] = "Credentials must be submitted via the login form"
+				return handlers.ServeGeneric(w, r, opts)
+			}
 			// Authenticating the request
 			if credentials, err := utils.ParseCredentials(r); err == nil {
 				if credentials != nil {
 					opts["auth_credentials_found"] = true
-					for _, backend := range p.Backends {
-						if backend.GetRealm() != credentials["realm"] {
+					if p.UsernamePolicy.EnforceAtLogin {
+						if err := p.UsernamePolicy.ValidateLogin(credentials["username"]); err != nil {
+							log.Warn("Rejected out-of-policy username",
+								zap.String("request_id", reqID),
+								zap.String("error", err.Error()),
+							)
+							opts["flow"] = "policy_violation"
+							opts["message"] = "The username is invalid"
+							return handlers.ServeGeneric(w, r, opts)
+						}
+					}
+					if realm := p.RealmRouting.Route(credentials["username"], credentials["realm"]); realm != credentials["realm"] {
+						log.Debug("Routed credentials to realm",
+							zap.String("request_id", reqID),
+							zap.String("submitted_realm", credentials["realm"]),
+							zap.String("auth_realm", realm),
+						)
+						credentials["realm"] = realm
+					}
+					if !p.RealmHostRestriction.Allow(r, credentials["realm"]) {
+						return p.serveRealmNotAllowed(w, r, credentials["realm"], opts)
+					}
+					if allowed, retryAfter := p.RateLimit.AllowUsername(credentials["username"], credentials["realm"]); !allowed {
+						log.Warn("Login rate limit exceeded",
+							zap.String("request_id", reqID),
+							zap.String("auth_realm", credentials["realm"]),
+							zap.String("user", credentials["username"]),
+						)
+						p.RateLimit.SetHeaders(w.Header(), retryAfter)
+						opts["flow"] = "rate_limited"
+						opts["message"] = "Too many login attempts, please try again later"
+						return handlers.ServeGeneric(w, r, opts)
+					}
+					if p.reuseLoginResult(r, credentials, opts) {
+						log.Debug("Reused session of identical login",
+							zap.String("request_id", reqID),
+							zap.String("session_id", opts["user_claims"].(*jwtclaims.UserClaims).ID),
+						)
+						return handlers.ServeLogin(w, r, opts)
+					}
+					var parallelResults map[int]*authResult
+					if p.isParallelRealm(credentials["realm"]) {
+						opts["auth_credentials"] = credentials
+						parallelResults = p.authenticateParallel(credentials["realm"], opts)
+					}
+					for i, backend := range p.Backends {
+						if !backend.MatchRealm(credentials["realm"]) {
 							continue
 						}
 						opts["auth_backend_found"] = true
 						opts["auth_credentials"] = credentials
-						if resp, err := backend.Authenticate(opts); err != nil {
+						var resp map[string]interface{}
+						var err error
+						if parallelResults != nil {
+							result, exists := parallelResults[i]
+							if !exists {
+								continue
+							}
+							resp, err = result.resp, result.err
+						} else if p.CoalesceLogins {
+							var shared bool
+							resp, err, shared = p.logins.do(getLoginKey(&backend, credentials), func() (map[string]interface{}, error) {
+								return p.authenticate(reqID, &backend, opts)
+							})
+							if shared {
+								log.Debug("Shared in-flight authentication",
+									zap.String("request_id", reqID),
+									zap.String("auth_realm", backend.GetRealm()),
+								)
+							}
+						} else {
+							resp, err = p.authenticate(reqID, &backend, opts)
+						}
+						if err != nil {
 							opts["message"] = "Authentication failed"
 							opts["status_code"] = resp["code"].(int)
 							log.Warn("Authentication failed",
@@ -350,26 +955,96 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 							)
 						} else {
 							claims := resp["claims"].(*jwtclaims.UserClaims)
+							if p.Maintenance.Enabled && !p.Maintenance.Bypass(claims.Roles) {
+								log.Warn("Authentication rejected due to maintenance",
+									zap.String("request_id", reqID),
+									zap.String("user", claims.Subject),
+								)
+								return p.serveMaintenance(w, r, opts)
+							}
 							claims.ID = reqID
 							claims.Issuer = utils.GetCurrentURL(r)
 							if p.EnableSourceIPTracking {
 								claims.Address = utils.GetSourceAddress(r)
 							}
-							sessionCache.Add(claims.ID, map[string]interface{}{
-								"claims":         claims,
-								"backend_name":   backend.GetName(),
-								"backend_realm":  backend.GetRealm(),
-								"backend_method": backend.GetMethod(),
-							})
+							p.addProfileClaims(reqID, &backend, claims, opts)
+							p.transformClaims(reqID, backend.GetRealm(), claims, opts)
+							if err := p.validateClaims(reqID, backend.GetRealm(), claims, opts); err != nil {
+								opts["message"] = getClaimsErrorMessage(err)
+								opts["status_code"] = 403
+								log.Warn("Authentication failed",
+									zap.String("request_id", reqID),
+									zap.String("user", claims.Subject),
+									zap.String("error", err.Error()),
+								)
+								continue
+							}
+							p.addFeatureFlags(w, reqID, claims, opts)
+							if resp["password_expired"] == true {
+								log.Info("Authentication requires password change",
+									zap.String("request_id", reqID),
+									zap.String("user", claims.Subject),
+								)
+								return p.servePasswordChange(w, opts, backend, claims)
+							}
+							if v, exists := resp["password_expires_at"]; exists {
+								opts["password_expires_at"] = v
+							}
+							if step, err := p.getMfaStep(r, backend, claims); err != nil {
+								opts["message"] = "Authentication failed"
+								opts["status_code"] = 401
+								log.Warn("Authentication failed",
+									zap.String("request_id", reqID),
+									zap.String("user", claims.Subject),
+									zap.String("error", err.Error()),
+								)
+								continue
+							} else if step == "challenge" && p.isTrustedDevice(r, backend.GetRealm(), claims) {
+								log.Debug("Authentication skipped second factor on trusted device",
+									zap.String("request_id", reqID),
+									zap.String("user", claims.Subject),
+								)
+							} else if step != "" {
+								log.Debug("Authentication requires second factor",
+									zap.String("request_id", reqID),
+									zap.String("user", claims.Subject),
+									zap.String("mfa_step", step),
+								)
+								return p.serveMfaChallenge(w, r, opts, backend, claims, step)
+							}
+							session := map[string]interface{}{
+								"claims":           claims,
+								"backend_name":     backend.GetName(),
+								"backend_realm":    backend.GetRealm(),
+								"backend_method":   backend.GetMethod(),
+								"authenticated_at": time.Now(),
+								"src_ip":           opts["src_ip"],
+								"user_agent":       r.UserAgent(),
+							}
+							if v, exists := opts["password_expires_at"]; exists {
+								session["password_expires_at"] = v
+							}
+							sessionCache.Add(claims.ID, session)
 							opts["user_claims"] = claims
+							if amr := getAuthMethodReferences(backend.GetMethod()); amr != nil {
+								opts["amr"] = amr
+							}
 							opts["authenticated"] = true
+							opts["auth_realm"] = backend.GetRealm()
 							opts["status_code"] = 200
+							p.addLoginResult(r, getLoginKey(&backend, credentials), claims, opts)
+							p.welcomeUser(reqID, backend.GetRealm(), claims)
 							log.Debug("Authentication succeeded",
 								zap.String("request_id", reqID),
-								zap.Any("user", claims),
+								p.Logging.Claims("user", claims),
 							)
 						}
 					}
+					if opts["authenticated"].(bool) {
+						p.publishEvent(r, reqID, "login", credentials["realm"], credentials["username"])
+					} else {
+						p.publishEvent(r, reqID, "login_failed", credentials["realm"], credentials["username"])
+					}
 					if !opts["auth_backend_found"].(bool) {
 						opts["status_code"] = 500
 						log.Warn("Authentication failed",
@@ -387,6 +1062,9 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 				)
 			}
 		}
+		if opts["auth_credentials_found"].(bool) && !opts["authenticated"].(bool) {
+			p.AntiEnumeration.Pad(startedAt)
+		}
 		return handlers.ServeLogin(w, r, opts)
 	default:
 		opts["flow"] = "not_found"
@@ -394,6 +1072,96 @@ func (p *AuthPortal) ServeHTTP(w http.ResponseWriter, r *http.Request, upstreamO
 	}
 }
 
+// serveMaintenance returns the page informing users that the portal
+// is under maintenance.
+func (p *AuthPortal) serveMaintenance(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	opts["flow"] = "maintenance"
+	opts["message"] = p.Maintenance.Message
+	return handlers.ServeGeneric(w, r, opts)
+}
+
+// serveRealmNotAllowed returns the page informing users that the
+// authentication with the realm is not allowed for the request host.
+func (p *AuthPortal) serveRealmNotAllowed(w http.ResponseWriter, r *http.Request, realm string, opts map[string]interface{}) error {
+	p.logger.Warn(
+		"Rejected realm not allowed for host",
+		zap.String("request_id", opts["request_id"].(string)),
+		zap.String("auth_realm", realm),
+		zap.String("host", r.Host),
+	)
+	opts["flow"] = "access_denied"
+	opts["message"] = "Authentication with the realm is not allowed here"
+	return handlers.ServeGeneric(w, r, opts)
+}
+
+// getRealms returns the realms of the authentication backends.
+func (p *AuthPortal) getRealms() []string {
+	var realms []string
+	seen := make(map[string]bool)
+	for _, backend := range p.Backends {
+		realm := backend.GetRealm()
+		if seen[realm] {
+			continue
+		}
+		seen[realm] = true
+		realms = append(realms, realm)
+	}
+	return realms
+}
+
+// transformClaims applies the claims templates and the scope mapping to
+// the claims of an authenticated user. The failed templates do not change
+// the claims.
+func (p *AuthPortal) transformClaims(reqID, realm string, claims *jwtclaims.UserClaims, opts map[string]interface{}) {
+	var customClaims map[string]interface{}
+	if v, exists := opts["custom_claims"]; exists {
+		customClaims = v.(map[string]interface{})
+	}
+	customClaims, errors := p.ClaimsTransformer.Transform(claims, customClaims)
+	for _, err := range errors {
+		p.logger.Warn("Claims transformation failed",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("error", err.Error()),
+		)
+	}
+	customClaims = p.ClaimsTransformer.MapScopes(realm, claims, customClaims)
+	if len(customClaims) > 0 {
+		opts["custom_claims"] = customClaims
+	}
+}
+
+// validateClaims sends the claims of an authenticated user to the
+// validation webhook, if configured, and then checks the presence of
+// the claims required by the realm. It returns an error when the
+// webhook denies the login, when the webhook fails and the fail-open
+// behavior is disabled, or when a required claim is missing.
+func (p *AuthPortal) validateClaims(reqID, realm string, claims *jwtclaims.UserClaims, opts map[string]interface{}) error {
+	if p.ValidationWebhook == nil {
+		return p.checkClaims(realm, claims, opts)
+	}
+	var customClaims map[string]interface{}
+	if v, exists := opts["custom_claims"]; exists {
+		customClaims = v.(map[string]interface{})
+	}
+	customClaims, err := p.ValidationWebhook.Validate(realm, claims, customClaims)
+	if err != nil {
+		if _, denied := err.(*webhook.DenyError); !denied && p.ValidationWebhook.FailOpen {
+			p.logger.Warn("Claims validation webhook failed, proceeding",
+				zap.String("request_id", reqID),
+				zap.String("user", claims.Subject),
+				zap.String("error", err.Error()),
+			)
+			return p.checkClaims(realm, claims, opts)
+		}
+		return err
+	}
+	if len(customClaims) > 0 {
+		opts["custom_claims"] = customClaims
+	}
+	return p.checkClaims(realm, claims, opts)
+}
+
 // GetRequestID returns request ID.
 func GetRequestID(r *http.Request) string {
 	requestID := uuid.NewV4().String()
@@ -0,0 +1,57 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"go.uber.org/zap"
+)
+
+// addProfileClaims adds the profile fields mapped to claims to the custom
+// claims of an authenticated user. The fields do not override the custom
+// claims provided by the backend.
+func (p *AuthPortal) addProfileClaims(reqID string, backend *backends.Backend, claims *jwtclaims.UserClaims, opts map[string]interface{}) {
+	if p.ProfileSchema == nil || !p.ProfileSchema.HasClaims() || backend.GetMethod() != "local" {
+		return
+	}
+	values, err := backend.GetProfile(map[string]interface{}{"username": claims.Subject})
+	if err != nil {
+		p.logger.Warn("Profile retrieval failed",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	profileClaims := p.ProfileSchema.GetClaims(values)
+	if len(profileClaims) == 0 {
+		return
+	}
+	customClaims := make(map[string]interface{})
+	if v, exists := opts["custom_claims"]; exists {
+		for k, cv := range v.(map[string]interface{}) {
+			customClaims[k] = cv
+		}
+	}
+	for k, v := range profileClaims {
+		if _, exists := customClaims[k]; exists {
+			continue
+		}
+		customClaims[k] = v
+	}
+	opts["custom_claims"] = customClaims
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+)
+
+// authResult is the outcome of the authentication with a backend.
+type authResult struct {
+	index int
+	resp  map[string]interface{}
+	err   error
+}
+
+// isParallelRealm returns true when the backends of the realm, or of
+// the realm the alias refers to, authenticate users in parallel.
+func (p *AuthPortal) isParallelRealm(realm string) bool {
+	for _, parallelRealm := range p.ParallelRealms {
+		if parallelRealm == realm {
+			return true
+		}
+		for _, backend := range p.Backends {
+			if backend.GetRealm() == parallelRealm && backend.MatchRealm(realm) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticateParallel authenticates users against the backends of the
+// realm in parallel. It returns the result of the first backend that
+// succeeded and cancels the remaining ones. When all backends fail, it
+// returns the failure with the lowest status code, e.g. a bad password
+// takes precedence over an unavailable backend, and the backend order
+// breaks ties. The results are keyed by the backend index.
+func (p *AuthPortal) authenticateParallel(realm string, opts map[string]interface{}) map[int]*authResult {
+	var indexes []int
+	for i, backend := range p.Backends {
+		if backend.MatchRealm(realm) {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan *authResult, len(indexes))
+	for _, i := range indexes {
+		// The backends may change their options, so each one gets a copy.
+		backendOpts := make(map[string]interface{})
+		for k, v := range opts {
+			backendOpts[k] = v
+		}
+		backendOpts["context"] = ctx
+		go func(i int, backendOpts map[string]interface{}) {
+			resp, err := p.authenticate(backendOpts["request_id"].(string), &p.Backends[i], backendOpts)
+			results <- &authResult{index: i, resp: resp, err: err}
+		}(i, backendOpts)
+	}
+
+	var failure *authResult
+	for range indexes {
+		result := <-results
+		if result.err == nil {
+			return map[int]*authResult{result.index: result}
+		}
+		if failure == nil || betterFailure(result, failure) {
+			failure = result
+		}
+	}
+	return map[int]*authResult{failure.index: failure}
+}
+
+func betterFailure(a, b *authResult) bool {
+	codeA, _ := a.resp["code"].(int)
+	codeB, _ := b.resp["code"].(int)
+	if codeA != codeB {
+		return codeA < codeB
+	}
+	return a.index < b.index
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+	"strings"
+)
+
+// getLoginRedirectURL returns the URL the user is redirected to after
+// the login with an external provider, in the signed form of the
+// redirect cookie. The redirect_url query parameter of the request
+// takes precedence over the redirect cookie.
+func (p *AuthPortal) getLoginRedirectURL(r *http.Request) string {
+	if r.Method == "GET" {
+		if v := r.URL.Query().Get("redirect_url"); v != "" {
+			if strings.HasSuffix(v, ".css") || strings.HasSuffix(v, ".js") {
+				return ""
+			}
+			return p.Cookies.SignRedirectURL(v)
+		}
+	}
+	if cookie, err := r.Cookie(redirectToToken); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+const (
+	// DefaultLoginResultWindow is the default number of seconds a
+	// successful login result is kept.
+	DefaultLoginResultWindow = 5
+	// maxLoginResultWindow is the upper bound of the window.
+	maxLoginResultWindow = 60
+)
+
+// loginResult is the outcome of a successful login. The identical
+// resubmissions of the login within the window, e.g. due to double
+// clicks, reuse the session instead of creating another one.
+type loginResult struct {
+	sessionID    string
+	realm        string
+	customClaims map[string]interface{}
+	amr          []string
+	expiresAt    time.Time
+}
+
+// loginResultCache holds the results of the successful logins. The
+// failed logins are never kept.
+type loginResultCache struct {
+	mu      sync.Mutex
+	entries map[string]*loginResult
+}
+
+func (c *loginResultCache) add(key string, result *loginResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*loginResult)
+	}
+	now := time.Now()
+	for k, v := range c.entries {
+		if now.After(v.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = result
+}
+
+func (c *loginResultCache) get(key string) *loginResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, exists := c.entries[key]
+	if !exists {
+		return nil
+	}
+	if time.Now().After(result.expiresAt) {
+		delete(c.entries, key)
+		return nil
+	}
+	return result
+}
+
+// getLoginResultKey returns the key identifying the login request with
+// the credentials against the backend from the client.
+func getLoginResultKey(loginKey string, r *http.Request) string {
+	return loginKey + ":" + utils.GetSourceAddress(r) + ":" + r.UserAgent()
+}
+
+// addLoginResult keeps the result of the successful login for the
+// window, when configured.
+func (p *AuthPortal) addLoginResult(r *http.Request, loginKey string, claims *jwtclaims.UserClaims, opts map[string]interface{}) {
+	if p.LoginResultWindow < 1 {
+		return
+	}
+	result := &loginResult{
+		sessionID: claims.ID,
+		expiresAt: time.Now().Add(time.Duration(p.LoginResultWindow) * time.Second),
+	}
+	if v, ok := opts["auth_realm"].(string); ok {
+		result.realm = v
+	}
+	if v, ok := opts["custom_claims"].(map[string]interface{}); ok {
+		result.customClaims = v
+	}
+	if v, ok := opts["amr"].([]string); ok {
+		result.amr = v
+	}
+	p.loginResults.add(getLoginResultKey(loginKey, r), result)
+}
+
+// reuseLoginResult sets the handler options to the session created by
+// an identical successful login within the window. It returns false
+// when there is no such login, or the session is no longer valid, e.g.
+// the user logged out.
+func (p *AuthPortal) reuseLoginResult(r *http.Request, credentials map[string]string, opts map[string]interface{}) bool {
+	if p.LoginResultWindow < 1 || p.Maintenance.Enabled {
+		return false
+	}
+	for _, backend := range p.Backends {
+		if !backend.MatchRealm(credentials["realm"]) {
+			continue
+		}
+		result := p.loginResults.get(getLoginResultKey(getLoginKey(&backend, credentials), r))
+		if result == nil {
+			continue
+		}
+		session := sessionCache.Get(result.sessionID)
+		if session == nil || session["invalidated"] == true || session["reverify_required"] == true {
+			return false
+		}
+		claims, ok := session["claims"].(*jwtclaims.UserClaims)
+		if !ok {
+			return false
+		}
+		// The login path modifies the claims, so the request gets a copy.
+		resp := copyAuthResponse(map[string]interface{}{
+			"claims":        claims,
+			"custom_claims": result.customClaims,
+		})
+		opts["user_claims"] = resp["claims"]
+		if result.customClaims != nil {
+			opts["custom_claims"] = resp["custom_claims"]
+		}
+		if result.amr != nil {
+			opts["amr"] = result.amr
+		}
+		if v, exists := session["password_expires_at"]; exists {
+			opts["password_expires_at"] = v
+		}
+		opts["authenticated"] = true
+		opts["auth_realm"] = result.realm
+		opts["status_code"] = 200
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestLoginResultCache(t *testing.T) {
+	testFailed := 0
+	p := &AuthPortal{LoginResultWindow: 5}
+	r := httptest.NewRequest("POST", "/auth/login", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	r.Header.Set("User-Agent", "curl/7.68.0")
+	opts := map[string]interface{}{
+		"auth_realm":    "local",
+		"custom_claims": map[string]interface{}{"department": "IT"},
+		"amr":           []string{"pwd"},
+	}
+	p.addLoginResult(r, "abc", &jwtclaims.UserClaims{ID: "session1"}, opts)
+
+	expired := httptest.NewRequest("POST", "/auth/login", nil)
+	expired.RemoteAddr = "10.0.0.3:51234"
+	p.loginResults.add(getLoginResultKey("abc", expired), &loginResult{
+		sessionID: "session0",
+		expiresAt: time.Now().Add(-time.Second),
+	})
+
+	otherAddr := httptest.NewRequest("POST", "/auth/login", nil)
+	otherAddr.RemoteAddr = "10.0.0.2:51234"
+	otherAddr.Header.Set("User-Agent", "curl/7.68.0")
+	otherAgent := httptest.NewRequest("POST", "/auth/login", nil)
+	otherAgent.RemoteAddr = "10.0.0.1:51234"
+	otherAgent.Header.Set("User-Agent", "Mozilla/5.0")
+
+	tests := []struct {
+		name      string
+		key       string
+		sessionID string
+	}{
+		{name: "identical request", key: getLoginResultKey("abc", r), sessionID: "session1"},
+		{name: "other credentials", key: getLoginResultKey("abd", r)},
+		{name: "other source address", key: getLoginResultKey("abc", otherAddr)},
+		{name: "other user agent", key: getLoginResultKey("abc", otherAgent)},
+		{name: "expired result", key: getLoginResultKey("abc", expired)},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.name)
+		var sessionID string
+		if result := p.loginResults.get(test.key); result != nil {
+			sessionID = result.sessionID
+		}
+		if sessionID != test.sessionID {
+			t.Logf("FAIL: %s, session id: %q (expected) vs. %q (received)", testDescr, test.sessionID, sessionID)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if result := p.loginResults.get(getLoginResultKey("abc", r)); result != nil {
+		if result.realm != "local" || result.customClaims["department"] != "IT" || len(result.amr) != 1 {
+			t.Logf("FAIL: unexpected login result: %+v", result)
+			testFailed++
+		}
+	}
+
+	disabled := &AuthPortal{}
+	disabled.addLoginResult(r, "abc", &jwtclaims.UserClaims{ID: "session1"}, opts)
+	if disabled.loginResults.get(getLoginResultKey("abc", r)) != nil {
+		t.Logf("FAIL: login result kept while the caching is disabled")
+		testFailed++
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// getSessionStart returns the time the user of the session
+// authenticated. It prefers the time recorded in the session cache,
+// and falls back to the issue time of the token, e.g. when the cache
+// lost the session due to a restart.
+func getSessionStart(claims *jwtclaims.UserClaims) (time.Time, bool) {
+	if session := sessionCache.Get(claims.ID); session != nil {
+		if v, ok := session["authenticated_at"].(time.Time); ok {
+			return v, true
+		}
+	}
+	if claims.IssuedAt > 0 {
+		return time.Unix(claims.IssuedAt, 0), true
+	}
+	return time.Time{}, false
+}
+
+// getSessionMaxExpiry returns the time the session reaches its maximum
+// age, regardless of its activity and the expiry of its token.
+func (p *AuthPortal) getSessionMaxExpiry(claims *jwtclaims.UserClaims) (time.Time, bool) {
+	if p.SessionMaxAge < 1 {
+		return time.Time{}, false
+	}
+	startedAt, found := getSessionStart(claims)
+	if !found {
+		return time.Time{}, false
+	}
+	return startedAt.Add(time.Duration(p.SessionMaxAge) * time.Minute), true
+}
+
+// setSessionExpiryOptions adds the idle timeout and the maximum expiry
+// of the session of the authenticated user to the handler options.
+func (p *AuthPortal) setSessionExpiryOptions(opts map[string]interface{}) {
+	if p.SessionIdleTimeout > 0 {
+		opts["session_idle_timeout"] = p.SessionIdleTimeout
+	}
+	if opts["authenticated"].(bool) {
+		if maxExpiresAt, exists := p.getSessionMaxExpiry(opts["user_claims"].(*jwtclaims.UserClaims)); exists {
+			opts["session_max_expires_at"] = maxExpiresAt.Unix()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestGetSessionMaxExpiry(t *testing.T) {
+	testFailed := 0
+	authenticatedAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	issuedAt := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	sessionCache.Add("cached", map[string]interface{}{
+		"authenticated_at": authenticatedAt,
+	})
+	defer sessionCache.Delete("cached")
+	tests := []struct {
+		maxAge   int
+		claims   *jwtclaims.UserClaims
+		expected time.Time
+		found    bool
+	}{
+		{claims: &jwtclaims.UserClaims{ID: "cached"}},
+		{maxAge: 60, claims: &jwtclaims.UserClaims{ID: "cached", IssuedAt: issuedAt.Unix()}, expected: authenticatedAt.Add(time.Hour), found: true},
+		{maxAge: 60, claims: &jwtclaims.UserClaims{ID: "evicted", IssuedAt: issuedAt.Unix()}, expected: issuedAt.Add(time.Hour), found: true},
+		{maxAge: 60, claims: &jwtclaims.UserClaims{ID: "evicted"}},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, max age: %d, session: %s", i, test.maxAge, test.claims.ID)
+		p := &AuthPortal{SessionMaxAge: test.maxAge}
+		expiresAt, found := p.getSessionMaxExpiry(test.claims)
+		if found != test.found || !expiresAt.Equal(test.expected) {
+			t.Logf("FAIL: %s, expected: %v (%t), received: %v (%t)", testDescr, test.expected, test.found, expiresAt, found)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"crypto/rsa"
+	"fmt"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/signing"
+)
+
+// configureSigningKeyring loads the signing keys of the realms and adds
+// their public keys to the token validator.
+func (p *AuthPortal) configureSigningKeyring(signingKeyID string, signingKey *rsa.PrivateKey) error {
+	realms := make(map[string]bool)
+	for _, realm := range p.getRealms() {
+		realms[realm] = true
+	}
+	for _, realmKey := range p.RealmSigningKeys {
+		if !realms[realmKey.Realm] {
+			return fmt.Errorf("%s: realm signing key setup failed: realm %s not found", p.Name, realmKey.Realm)
+		}
+	}
+	keyring, err := signing.NewKeyring(p.TokenProvider, signingKeyID, signingKey, p.RealmSigningKeys)
+	if err != nil {
+		return fmt.Errorf("%s: realm signing key setup failed: %s", p.Name, err)
+	}
+	p.TokenValidator.TokenConfigs = append(p.TokenValidator.TokenConfigs, keyring.GetValidatorConfigs()...)
+	p.signingKeyring = keyring
+	return nil
+}
+
+// checkTokenRealm checks that the token is signed with the key of the
+// realm the user authenticated in. A realm having a signing key of its
+// own does not accept the tokens signed by the keys of other realms.
+func (p *AuthPortal) checkTokenRealm(token string, claims *jwtclaims.UserClaims) error {
+	if !p.signingKeyring.Enabled() || claims == nil {
+		return nil
+	}
+	session := sessionCache.Get(claims.ID)
+	if session == nil {
+		return nil
+	}
+	sessionRealm, _ := session["backend_realm"].(string)
+	if sessionRealm == "" {
+		return nil
+	}
+	tokenRealm, found := p.signingKeyring.GetTokenRealm(token)
+	switch {
+	case found && tokenRealm != sessionRealm:
+		return fmt.Errorf("token signed by key of realm %s, expected realm %s", tokenRealm, sessionRealm)
+	case !found && p.signingKeyring.HasRealm(sessionRealm):
+		return fmt.Errorf("token not signed by key of realm %s", sessionRealm)
+	}
+	return nil
+}
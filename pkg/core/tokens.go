@@ -0,0 +1,94 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+)
+
+// errTokenTooOld is returned when the token of a request was issued
+// longer than the maximum token age ago.
+var errTokenTooOld = sessions.ErrTokenTooOld
+
+// getTokenSources returns the order in which the token validator
+// searches the request for a token. By default, the cookie takes
+// precedence over the Authorization header.
+func getTokenSources(precedence string) []string {
+	if precedence == "header" {
+		return []string{"header", "cookie", "query"}
+	}
+	return []string{"cookie", "header", "query"}
+}
+
+// checkTokenConflict returns an error when the portal rejects the
+// requests with conflicting tokens, and the request carries different
+// tokens in the cookie and the Authorization header. Both the bearer
+// and the key-value forms of the header count.
+func (p *AuthPortal) checkTokenConflict(r *http.Request) error {
+	if p.TokenPrecedence != "reject" {
+		return nil
+	}
+	cookieToken, found := p.TokenValidator.SearchCookies(r.Cookies())
+	if !found {
+		return nil
+	}
+	headerOpts := &jwtconfig.TokenValidatorOptions{ValidateBearerHeader: true}
+	headerToken, found := p.TokenValidator.SearchAuthorizationHeader(r.Header.Get("Authorization"), headerOpts)
+	if !found {
+		return nil
+	}
+	if cookieToken != headerToken {
+		return fmt.Errorf("cookie and authorization header tokens do not match")
+	}
+	return nil
+}
+
+// getTokenCookieNames returns the names of the cookies holding the token
+// of the session. With per-realm cookies, it is the cookie of the realm
+// of the session. When the session is unknown, it is the cookies of all
+// the realms.
+func (p *AuthPortal) getTokenCookieNames(session map[string]interface{}) []string {
+	if !p.Cookies.PerRealm {
+		return []string{p.TokenProvider.TokenName}
+	}
+	if realm, _ := session["backend_realm"].(string); realm != "" {
+		return []string{p.Cookies.GetTokenName(p.TokenProvider.TokenName, realm)}
+	}
+	names := []string{p.TokenProvider.TokenName}
+	for _, realm := range p.getRealms() {
+		names = append(names, p.Cookies.GetTokenName(p.TokenProvider.TokenName, realm))
+	}
+	return names
+}
+
+// setTokenCookieNames sets the names of the cookies the handlers remove
+// when the session ends.
+func setTokenCookieNames(opts map[string]interface{}, names []string) {
+	opts["token_cookie_names"] = names
+	opts["cookie_names"] = append([]string{redirectToToken, mfaSessionToken, passwordSessionToken}, names...)
+}
+
+// checkTokenAge returns an error when the token was issued longer than
+// the maximum token age ago, regardless of its expiry. The tokens
+// without the issue time fail the check, because their age is unknown.
+func (p *AuthPortal) checkTokenAge(claims *jwtclaims.UserClaims, now time.Time) error {
+	return sessions.CheckTokenAge(claims, p.MaxTokenAge, now)
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtvalidator "github.com/greenpau/caddy-auth-jwt/pkg/validator"
+)
+
+func TestCheckTokenConflict(t *testing.T) {
+	testFailed := 0
+	// The validator ignores the cookies having short values.
+	tokenA := strings.Repeat("a", 40)
+	tokenB := strings.Repeat("d", 40)
+	tests := []struct {
+		precedence  string
+		cookieToken string
+		headerToken string
+		shouldFail  bool
+	}{
+		{precedence: "cookie", cookieToken: tokenA, headerToken: tokenB},
+		{precedence: "header", cookieToken: tokenA, headerToken: tokenB},
+		{precedence: "reject", cookieToken: tokenA},
+		{precedence: "reject", headerToken: tokenB},
+		{precedence: "reject", cookieToken: tokenA, headerToken: tokenA},
+		{precedence: "reject", cookieToken: tokenA, headerToken: tokenB, shouldFail: true},
+		{precedence: "reject", cookieToken: tokenA, headerToken: "access_token=" + tokenB, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, precedence: %s, cookie: %t, header: %t", i, test.precedence, test.cookieToken != "", test.headerToken != "")
+		p := &AuthPortal{
+			TokenPrecedence: test.precedence,
+			TokenValidator:  jwtvalidator.NewTokenValidator(),
+		}
+		p.TokenValidator.SetTokenName("access_token")
+		r := httptest.NewRequest("GET", "/auth/whoami", nil)
+		if test.cookieToken != "" {
+			r.AddCookie(&http.Cookie{Name: "access_token", Value: test.cookieToken})
+		}
+		if test.headerToken != "" {
+			if strings.Contains(test.headerToken, "=") {
+				r.Header.Set("Authorization", test.headerToken)
+			} else {
+				r.Header.Set("Authorization", "Bearer "+test.headerToken)
+			}
+		}
+		err := p.checkTokenConflict(r)
+		if test.shouldFail {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but received none", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestCheckTokenAge(t *testing.T) {
+	testFailed := 0
+	now := time.Unix(1602860400, 0)
+	tests := []struct {
+		maxAge     int
+		issuedAt   int64
+		shouldFail bool
+	}{
+		{maxAge: 0, issuedAt: 0},
+		{maxAge: 0, issuedAt: now.Unix() - 86400},
+		{maxAge: 3600, issuedAt: now.Unix() - 60},
+		{maxAge: 3600, issuedAt: now.Unix() - 3600},
+		{maxAge: 3600, issuedAt: now.Unix() - 3601, shouldFail: true},
+		{maxAge: 3600, issuedAt: 0, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, max age: %d, issued at: %d", i, test.maxAge, test.issuedAt)
+		p := &AuthPortal{MaxTokenAge: test.maxAge}
+		err := p.checkTokenAge(&jwtclaims.UserClaims{IssuedAt: test.issuedAt}, now)
+		if test.shouldFail {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but received none", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/tracing"
+)
+
+// startRequestSpan returns the span of the request, if the tracing is
+// enabled. The span does not record the query of the request, because it
+// may carry credentials.
+func (p *AuthPortal) startRequestSpan(r *http.Request) *tracing.Span {
+	span := p.Tracing.StartRequest(r, "auth_portal "+r.Method)
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("url.path", r.URL.Path)
+	span.SetAttribute("portal.name", p.Name)
+	return span
+}
+
+// endRequestSpan annotates the span of the request with the outcome of
+// the request and ends it.
+func endRequestSpan(span *tracing.Span, opts map[string]interface{}) {
+	if span == nil {
+		return
+	}
+	if v, ok := opts["flow"].(string); ok {
+		span.SetAttribute("auth.flow", v)
+	}
+	if v, ok := opts["auth_realm"].(string); ok {
+		span.SetAttribute("auth.realm", v)
+	}
+	span.SetAttribute("auth.authenticated", opts["authenticated"])
+	if v, ok := opts["status_code"].(int); ok {
+		span.SetAttribute("http.status_code", v)
+		if v >= 500 {
+			span.SetFailed()
+		}
+	}
+	span.End()
+}
+
+// startBackendSpan returns the span of the authentication request to the
+// backend, if the backend is traced. The span is the child of the span of
+// the request.
+func (p *AuthPortal) startBackendSpan(backend *backends.Backend, opts map[string]interface{}) *tracing.Span {
+	parent, _ := opts["trace_span"].(*tracing.Span)
+	if parent == nil || !p.Tracing.TracesBackend(backend.GetName()) {
+		return nil
+	}
+	span := parent.StartChild("authenticate "+backend.GetMethod(), tracing.SpanKindClient)
+	span.SetAttribute("auth.realm", backend.GetRealm())
+	span.SetAttribute("auth.method", backend.GetMethod())
+	span.SetAttribute("auth.backend", backend.GetName())
+	return span
+}
+
+// endBackendSpan annotates the span of the authentication request with
+// its outcome and ends it. The span does not record the error, because
+// it may reveal the details of the credentials.
+func endBackendSpan(span *tracing.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.SetAttribute("auth.outcome", "failure")
+		span.SetFailed()
+	} else {
+		span.SetAttribute("auth.outcome", "success")
+	}
+	span.End()
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"go.uber.org/zap"
+)
+
+// welcomeUser sends the welcome email to the user signing in for the
+// first time. The email is sent in the background, and the failures do
+// not affect the sign-in. When the email is not sent, the user is
+// welcomed upon the next sign-in.
+func (p *AuthPortal) welcomeUser(reqID, realm string, claims *jwtclaims.UserClaims) {
+	if p.WelcomeNotice == nil || !p.WelcomeNotice.Enabled {
+		return
+	}
+	recipient := claims.Email
+	if recipient == "" {
+		for _, backend := range p.Backends {
+			if !backend.MatchRealm(realm) {
+				continue
+			}
+			if addr, err := backend.GetEmailAddress(map[string]interface{}{"username": claims.Subject}); err == nil {
+				recipient = addr
+			}
+			break
+		}
+	}
+	if recipient == "" {
+		p.logger.Debug("Skipped welcome email, email address not found",
+			zap.String("request_id", reqID),
+			zap.String("auth_realm", realm),
+			zap.String("user", claims.Subject),
+		)
+		return
+	}
+	first, err := p.WelcomeNotice.MarkFirstLogin(realm, claims.Subject)
+	if err != nil {
+		p.logger.Error("Failed recording first sign-in",
+			zap.String("request_id", reqID),
+			zap.String("auth_realm", realm),
+			zap.String("user", claims.Subject),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	if !first {
+		return
+	}
+	body, err := p.WelcomeNotice.Render(claims.Subject, claims.Name, realm)
+	if err != nil {
+		p.logger.Error("Failed rendering welcome email",
+			zap.String("request_id", reqID),
+			zap.String("auth_realm", realm),
+			zap.String("user", claims.Subject),
+			zap.String("error", err.Error()),
+		)
+		p.WelcomeNotice.ClearFirstLogin(realm, claims.Subject)
+		return
+	}
+	go func() {
+		if err := p.SMTP.Send(recipient, p.WelcomeNotice.Subject, body); err != nil {
+			p.logger.Error("Failed sending welcome email",
+				zap.String("request_id", reqID),
+				zap.String("auth_realm", realm),
+				zap.String("user", claims.Subject),
+				zap.String("error", err.Error()),
+			)
+			p.WelcomeNotice.ClearFirstLogin(realm, claims.Subject)
+			return
+		}
+		p.logger.Info("Sent welcome email",
+			zap.String("request_id", reqID),
+			zap.String("auth_realm", realm),
+			zap.String("user", claims.Subject),
+		)
+	}()
+}
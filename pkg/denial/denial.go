@@ -0,0 +1,184 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package denial
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// DefaultMessage is the message displayed to the denied users when the
+// rule has none.
+const DefaultMessage = "Access denied"
+
+// Rule denies the authenticated users having a claim matching the
+// value, e.g. the account_status claim equal to suspended. The rules
+// are evaluated after the backends authenticated the users.
+type Rule struct {
+	// The realm the rule applies to, or * for all realms.
+	Realm string `json:"realm,omitempty"`
+	// The name of the claim, e.g. email, roles, or a custom claim.
+	Claim string `json:"claim,omitempty"`
+	// The comparison operator, i.e. eq, ne, gt, ge, lt, le, or regex.
+	// The gt, ge, lt, and le operators compare numbers.
+	Operator string `json:"operator,omitempty"`
+	// The value the claim is compared to.
+	Value string `json:"value,omitempty"`
+	// The message displayed to the denied users.
+	Message string `json:"message,omitempty"`
+	regex   *regexp.Regexp
+	number  float64
+}
+
+// DenyError is the error returned when a rule denies the login.
+type DenyError struct {
+	Rule *Rule
+}
+
+func (e *DenyError) Error() string {
+	return fmt.Sprintf("claim %s matched deny rule: %s %s", e.Rule.Claim, e.Rule.Operator, e.Rule.Value)
+}
+
+// Configure validates the rule.
+func (r *Rule) Configure() error {
+	if r.Realm == "" {
+		return fmt.Errorf("deny rule has no realm")
+	}
+	if r.Claim == "" {
+		return fmt.Errorf("deny rule has no claim")
+	}
+	switch r.Operator {
+	case "eq", "ne":
+	case "gt", "ge", "lt", "le":
+		number, err := strconv.ParseFloat(r.Value, 64)
+		if err != nil {
+			return fmt.Errorf("deny rule for %s claim has non-numeric value: %s", r.Claim, r.Value)
+		}
+		r.number = number
+	case "regex":
+		regex, err := regexp.Compile(r.Value)
+		if err != nil {
+			return fmt.Errorf("deny rule for %s claim has invalid regex: %s", r.Claim, err)
+		}
+		r.regex = regex
+	default:
+		return fmt.Errorf("deny rule for %s claim has unsupported operator: %s", r.Claim, r.Operator)
+	}
+	if r.Message == "" {
+		r.Message = DefaultMessage
+	}
+	return nil
+}
+
+// Evaluate returns DenyError when any of the rules of the realm, or of
+// all realms, matches the claims.
+func Evaluate(rules []*Rule, realm string, claims *jwtclaims.UserClaims, customClaims map[string]interface{}) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	var data map[string]interface{}
+	for _, rule := range rules {
+		if rule.Realm != "*" && rule.Realm != realm {
+			continue
+		}
+		if data == nil {
+			m, err := claimsToMap(claims, customClaims)
+			if err != nil {
+				return err
+			}
+			data = m
+		}
+		if rule.Match(data[rule.Claim]) {
+			return &DenyError{Rule: rule}
+		}
+	}
+	return nil
+}
+
+// Match returns true when the claim value matches the rule. The claims
+// having multiple values, e.g. roles, match when any of the values
+// matches, except for ne, which matches when none of the values equals
+// the rule value. The absent claims match only ne.
+func (r *Rule) Match(v interface{}) bool {
+	var values []interface{}
+	switch value := v.(type) {
+	case nil:
+	case []interface{}:
+		values = value
+	case []string:
+		for _, s := range value {
+			values = append(values, s)
+		}
+	default:
+		values = []interface{}{value}
+	}
+	if r.Operator == "ne" {
+		for _, value := range values {
+			if fmt.Sprint(value) == r.Value {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		s := fmt.Sprint(value)
+		switch r.Operator {
+		case "eq":
+			if s == r.Value {
+				return true
+			}
+		case "regex":
+			if r.regex.MatchString(s) {
+				return true
+			}
+		default:
+			number, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case r.Operator == "gt" && number > r.number,
+				r.Operator == "ge" && number >= r.number,
+				r.Operator == "lt" && number < r.number,
+				r.Operator == "le" && number <= r.number:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimsToMap returns the claims keyed by their JWT names, e.g. email,
+// including the custom claims.
+func claimsToMap(claims *jwtclaims.UserClaims, customClaims map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range customClaims {
+		if _, exists := m[k]; !exists {
+			m[k] = v
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package denial
+
+import (
+	"fmt"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestEvaluate(t *testing.T) {
+	testFailed := 0
+	claims := &jwtclaims.UserClaims{
+		Subject: "jsmith",
+		Email:   "jsmith@contoso.com",
+		Roles:   []string{"viewer", "editor"},
+	}
+	customClaims := map[string]interface{}{
+		"account_status": "suspended",
+		"risk_score":     float64(80),
+	}
+	tests := []struct {
+		rule               *Rule
+		realm              string
+		shouldFailValidate bool
+		shouldDeny         bool
+	}{
+		{rule: &Rule{Realm: "*", Claim: "account_status", Operator: "eq", Value: "suspended"}, realm: "local", shouldDeny: true},
+		{rule: &Rule{Realm: "contoso", Claim: "account_status", Operator: "eq", Value: "suspended"}, realm: "local"},
+		{rule: &Rule{Realm: "local", Claim: "account_status", Operator: "eq", Value: "active"}, realm: "local"},
+		{rule: &Rule{Realm: "local", Claim: "account_status", Operator: "ne", Value: "active"}, realm: "local", shouldDeny: true},
+		{rule: &Rule{Realm: "local", Claim: "department", Operator: "ne", Value: "IT"}, realm: "local", shouldDeny: true},
+		{rule: &Rule{Realm: "local", Claim: "department", Operator: "eq", Value: "IT"}, realm: "local"},
+		{rule: &Rule{Realm: "*", Claim: "risk_score", Operator: "gt", Value: "75"}, realm: "local", shouldDeny: true},
+		{rule: &Rule{Realm: "*", Claim: "risk_score", Operator: "gt", Value: "80"}, realm: "local"},
+		{rule: &Rule{Realm: "*", Claim: "risk_score", Operator: "le", Value: "80"}, realm: "local", shouldDeny: true},
+		{rule: &Rule{Realm: "*", Claim: "roles", Operator: "eq", Value: "editor"}, realm: "local", shouldDeny: true},
+		{rule: &Rule{Realm: "*", Claim: "roles", Operator: "ne", Value: "editor"}, realm: "local"},
+		{rule: &Rule{Realm: "*", Claim: "email", Operator: "regex", Value: `@contoso\.com$`}, realm: "local", shouldDeny: true},
+		{rule: &Rule{Realm: "*", Claim: "email", Operator: "regex", Value: `[`}, shouldFailValidate: true},
+		{rule: &Rule{Realm: "*", Claim: "risk_score", Operator: "gt", Value: "high"}, shouldFailValidate: true},
+		{rule: &Rule{Realm: "*", Claim: "risk_score", Operator: "contains", Value: "8"}, shouldFailValidate: true},
+		{rule: &Rule{Claim: "risk_score", Operator: "eq", Value: "8"}, shouldFailValidate: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, realm: %s, rule: %s %s %s %s", i, test.realm, test.rule.Realm, test.rule.Claim, test.rule.Operator, test.rule.Value)
+		if err := test.rule.Configure(); err != nil {
+			if !test.shouldFailValidate {
+				t.Logf("FAIL: %s, unexpected validation error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected validation error: %s", testDescr, err)
+			continue
+		} else if test.shouldFailValidate {
+			t.Logf("FAIL: %s, expected validation error, but received none", testDescr)
+			testFailed++
+			continue
+		}
+		err := Evaluate([]*Rule{test.rule}, test.realm, claims, customClaims)
+		if test.shouldDeny {
+			e, denied := err.(*DenyError)
+			if !denied {
+				t.Logf("FAIL: %s, expected deny, but received: %v", testDescr, err)
+				testFailed++
+				continue
+			}
+			if e.Rule.Message != DefaultMessage {
+				t.Logf("FAIL: %s, message mismatch: %s", testDescr, e.Rule.Message)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected deny: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
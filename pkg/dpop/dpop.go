@@ -0,0 +1,257 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+// HeaderName is the name of the HTTP header carrying DPoP proofs.
+const HeaderName = "DPoP"
+
+// DefaultMaxAge is the default number of seconds a proof remains valid
+// after it was issued.
+const DefaultMaxAge = 300
+
+// Config represent a common set of configuration settings for binding
+// the issued tokens to the keys held by clients, see RFC 9449.
+type Config struct {
+	// The switch determining whether the portal binds the tokens to the
+	// keys of the clients presenting DPoP proofs.
+	Enabled bool `json:"enabled,omitempty"`
+	// The number of seconds a proof remains valid after it was issued.
+	MaxAge int `json:"max_age,omitempty"`
+	seen   *replayCache
+}
+
+// Proof is a validated DPoP proof.
+type Proof struct {
+	// The JWK SHA-256 thumbprint of the public key of the client.
+	Thumbprint string
+	// The unique identifier of the proof.
+	ID string
+}
+
+// Configure validates the configuration and sets default values.
+func (c *Config) Configure() error {
+	if c.MaxAge < 0 {
+		return fmt.Errorf("dpop max_age must be a positive number of seconds")
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = DefaultMaxAge
+	}
+	c.seen = newReplayCache()
+	return nil
+}
+
+// HasProof returns true when the request carries a DPoP proof.
+func HasProof(r *http.Request) bool {
+	return len(r.Header.Values(HeaderName)) > 0
+}
+
+// Verify validates the DPoP proof of the request. When the access token
+// is not empty, the proof must contain its hash.
+func (c *Config) Verify(r *http.Request, accessToken string) (*Proof, error) {
+	values := r.Header.Values(HeaderName)
+	switch len(values) {
+	case 0:
+		return nil, fmt.Errorf("dpop proof not found")
+	case 1:
+	default:
+		return nil, fmt.Errorf("multiple dpop proofs found")
+	}
+
+	var thumbprint string
+	parser := &jwtlib.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(values[0], func(token *jwtlib.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("invalid dpop proof type: %v", token.Header["typ"])
+		}
+		jwk, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("dpop proof has no jwk")
+		}
+		key, tp, err := parseKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+		switch token.Method.(type) {
+		case *jwtlib.SigningMethodECDSA:
+			if _, ok := key.(*ecdsa.PublicKey); !ok {
+				return nil, fmt.Errorf("dpop proof signing method does not match jwk")
+			}
+		case *jwtlib.SigningMethodRSA, *jwtlib.SigningMethodRSAPSS:
+			if _, ok := key.(*rsa.PublicKey); !ok {
+				return nil, fmt.Errorf("dpop proof signing method does not match jwk")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported dpop proof signing method: %s", token.Method.Alg())
+		}
+		thumbprint = tp
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid dpop proof: %s", err)
+	}
+
+	claims := token.Claims.(jwtlib.MapClaims)
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, fmt.Errorf("dpop proof has no jti")
+	}
+	if htm, _ := claims["htm"].(string); htm != r.Method {
+		return nil, fmt.Errorf("dpop proof htm mismatch: %s", htm)
+	}
+	if htu, _ := claims["htu"].(string); htu != utils.GetCurrentURL(r) {
+		return nil, fmt.Errorf("dpop proof htu mismatch: %s", htu)
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("dpop proof has no iat")
+	}
+	maxAge := time.Duration(c.MaxAge) * time.Second
+	issuedAt := time.Unix(int64(iat), 0)
+	if time.Since(issuedAt) > maxAge || time.Until(issuedAt) > maxAge {
+		return nil, fmt.Errorf("dpop proof expired")
+	}
+	if accessToken != "" {
+		h := sha256.Sum256([]byte(accessToken))
+		if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(h[:]) {
+			return nil, fmt.Errorf("dpop proof ath mismatch")
+		}
+	}
+	if c.seen != nil && !c.seen.add(thumbprint+":"+jti, issuedAt.Add(maxAge)) {
+		return nil, fmt.Errorf("dpop proof replayed")
+	}
+	return &Proof{Thumbprint: thumbprint, ID: jti}, nil
+}
+
+// parseKey returns the public key described by the JWK and the
+// thumbprint of the key, see RFC 7638.
+func parseKey(jwk map[string]interface{}) (interface{}, string, error) {
+	if _, exists := jwk["d"]; exists {
+		return nil, "", fmt.Errorf("dpop proof jwk contains private key")
+	}
+	kty, _ := jwk["kty"].(string)
+	switch kty {
+	case "EC":
+		crv, _ := jwk["crv"].(string)
+		var curve elliptic.Curve
+		switch crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, "", fmt.Errorf("unsupported dpop proof jwk curve: %s", crv)
+		}
+		x, err := decodeKeyParam(jwk, "x")
+		if err != nil {
+			return nil, "", err
+		}
+		y, err := decodeKeyParam(jwk, "y")
+		if err != nil {
+			return nil, "", err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if !curve.IsOnCurve(x, y) {
+			return nil, "", fmt.Errorf("dpop proof jwk point is not on curve")
+		}
+		tp, err := thumbprint(map[string]string{"crv": crv, "kty": kty, "x": jwk["x"].(string), "y": jwk["y"].(string)})
+		return key, tp, err
+	case "RSA":
+		n, err := decodeKeyParam(jwk, "n")
+		if err != nil {
+			return nil, "", err
+		}
+		e, err := decodeKeyParam(jwk, "e")
+		if err != nil {
+			return nil, "", err
+		}
+		if !e.IsInt64() || e.Int64() < 3 {
+			return nil, "", fmt.Errorf("dpop proof jwk has invalid exponent")
+		}
+		key := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		tp, err := thumbprint(map[string]string{"e": jwk["e"].(string), "kty": kty, "n": jwk["n"].(string)})
+		return key, tp, err
+	}
+	return nil, "", fmt.Errorf("unsupported dpop proof jwk type: %s", kty)
+}
+
+func decodeKeyParam(jwk map[string]interface{}, name string) (*big.Int, error) {
+	s, ok := jwk[name].(string)
+	if !ok || s == "" {
+		return nil, fmt.Errorf("dpop proof jwk has no %s", name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("dpop proof jwk has malformed %s", name)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// thumbprint returns the base64url-encoded SHA-256 hash of the required
+// members of a JWK. The JSON encoder sorts the keys lexicographically.
+func thumbprint(members map[string]string) (string, error) {
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(h[:]), nil
+}
+
+// replayCache holds the identifiers of the recently seen proofs.
+type replayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{entries: make(map[string]time.Time)}
+}
+
+// add records the identifier. It returns false when the identifier was
+// already seen.
+func (c *replayCache) add(id string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, v := range c.entries {
+		if now.After(v) {
+			delete(c.entries, k)
+		}
+	}
+	if _, exists := c.entries[id]; exists {
+		return false
+	}
+	c.entries[id] = expiresAt
+	return true
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"fmt"
+)
+
+// DefaultChangeLifetime is the default number of seconds the link
+// confirming the change of an email address remains valid.
+const DefaultChangeLifetime = 3600
+
+// Change represent a common set of configuration settings for the
+// changes of the email addresses of users.
+type Change struct {
+	// The switch determining whether users may change their email
+	// addresses in settings.
+	Enabled bool `json:"enabled,omitempty"`
+	// The number of seconds the confirmation link remains valid.
+	Lifetime int `json:"lifetime,omitempty"`
+}
+
+// Configure validates the configuration and sets default values.
+func (c *Change) Configure() error {
+	if c.Lifetime < 0 {
+		return fmt.Errorf("email change lifetime must be a positive number of seconds")
+	}
+	if c.Lifetime == 0 {
+		c.Lifetime = DefaultChangeLifetime
+	}
+	return nil
+}
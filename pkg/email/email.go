@@ -0,0 +1,101 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Config represent a common set of configuration settings for the SMTP
+// server sending the emails of the portal, e.g. the links confirming
+// the changes of email addresses.
+type Config struct {
+	// The address of the SMTP server, e.g. smtp.contoso.com:587.
+	Server string `json:"server,omitempty"`
+	// The address of the sender of the emails.
+	Sender string `json:"sender,omitempty"`
+	// The credentials for the SMTP server, if it requires authentication.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	send     func(string, smtp.Auth, string, []string, []byte) error
+}
+
+// Configure validates the configuration. The configuration without
+// a server is valid, but disabled.
+func (c *Config) Configure() error {
+	c.send = smtp.SendMail
+	if c.Server == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Server); err != nil {
+		return fmt.Errorf("smtp server %s is invalid: %s", c.Server, err)
+	}
+	if c.Sender == "" {
+		return fmt.Errorf("smtp sender not found")
+	}
+	if _, err := mail.ParseAddress(c.Sender); err != nil {
+		return fmt.Errorf("smtp sender %s is invalid: %s", c.Sender, err)
+	}
+	if c.Username == "" && c.Password != "" {
+		return fmt.Errorf("smtp password without username")
+	}
+	return nil
+}
+
+// Enabled returns true when the portal sends emails.
+func (c *Config) Enabled() bool {
+	if c == nil || c.Server == "" {
+		return false
+	}
+	return true
+}
+
+// Send sends the plain text email to the recipient.
+func (c *Config) Send(recipient, subject, body string) error {
+	if !c.Enabled() {
+		return fmt.Errorf("smtp server is not configured")
+	}
+	if strings.ContainsAny(recipient+subject, "\r\n") {
+		return fmt.Errorf("email headers contain line breaks")
+	}
+	to, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return fmt.Errorf("email recipient %s is invalid: %s", recipient, err)
+	}
+	from, _ := mail.ParseAddress(c.Sender)
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		host, _, _ := net.SplitHostPort(c.Server)
+		auth = smtp.PlainAuth("", c.Username, c.Password, host)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("From: " + from.String() + "\r\n")
+	sb.WriteString("To: " + to.String() + "\r\n")
+	sb.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", subject) + "\r\n")
+	sb.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return c.send(c.Server, auth, from.Address, []string{to.Address}, []byte(sb.String()))
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		cfg          *Config
+		recipient    string
+		subject      string
+		configFailed bool
+		sendFailed   bool
+	}{
+		{
+			cfg:       &Config{Server: "localhost:25", Sender: "auth@contoso.com"},
+			recipient: "jsmith@contoso.com",
+			subject:   "Confirm your new email address",
+		},
+		{
+			cfg:          &Config{Server: "localhost", Sender: "auth@contoso.com"},
+			configFailed: true,
+		},
+		{
+			cfg:          &Config{Server: "localhost:25"},
+			configFailed: true,
+		},
+		{
+			cfg:        &Config{},
+			recipient:  "jsmith@contoso.com",
+			sendFailed: true,
+		},
+		{
+			cfg:        &Config{Server: "localhost:25", Sender: "auth@contoso.com"},
+			recipient:  "jsmith@contoso.com\r\nBcc: attacker@contoso.com",
+			sendFailed: true,
+		},
+		{
+			cfg:        &Config{Server: "localhost:25", Sender: "auth@contoso.com"},
+			recipient:  "jsmith@contoso.com",
+			subject:    "Confirm\nBcc: attacker@contoso.com",
+			sendFailed: true,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, server: %s, recipient: %q", i, test.cfg.Server, test.recipient)
+		err := test.cfg.Configure()
+		if (err != nil) != test.configFailed {
+			t.Logf("FAIL: %s, configuration error: %v", testDescr, err)
+			testFailed++
+			continue
+		}
+		if test.configFailed {
+			t.Logf("PASS: %s", testDescr)
+			continue
+		}
+		var msg string
+		test.cfg.send = func(addr string, a smtp.Auth, from string, to []string, b []byte) error {
+			msg = string(b)
+			return nil
+		}
+		err = test.cfg.Send(test.recipient, test.subject, "line 1\nline 2\n")
+		if (err != nil) != test.sendFailed {
+			t.Logf("FAIL: %s, send error: %v", testDescr, err)
+			testFailed++
+			continue
+		}
+		if !test.sendFailed {
+			for _, s := range []string{"To: <jsmith@contoso.com>\r\n", "Subject: " + test.subject + "\r\n", "\r\n\r\nline 1\r\nline 2\r\n"} {
+				if !strings.Contains(msg, s) {
+					t.Logf("FAIL: %s, message does not contain %q: %s", testDescr, s, msg)
+					testFailed++
+				}
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestLockoutNotice(t *testing.T) {
+	testFailed := 0
+	until := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	tests := []struct {
+		notice       *LockoutNotice
+		expected     []string
+		configFailed bool
+	}{
+		{
+			notice:   &LockoutNotice{Enabled: true},
+			expected: []string{"Your account jsmith was locked", "Wed, 03 Feb 2021 04:05:06 UTC", "contact your administrator"},
+		},
+		{
+			notice:   &LockoutNotice{Enabled: true, SupportContact: "security@contoso.com"},
+			expected: []string{"please contact security@contoso.com"},
+		},
+		{
+			notice:   &LockoutNotice{Enabled: true, Template: "{{ .Username }}@{{ .Realm }}"},
+			expected: []string{"jsmith@local"},
+		},
+		{
+			notice:       &LockoutNotice{Enabled: true, Template: "{{ .Username "},
+			configFailed: true,
+		},
+		{
+			notice:       &LockoutNotice{Enabled: true, Subject: "Locked\nBcc: attacker@contoso.com"},
+			configFailed: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, template: %q", i, test.notice.Template)
+		err := test.notice.Configure()
+		if (err != nil) != test.configFailed {
+			t.Logf("FAIL: %s, configuration error: %v", testDescr, err)
+			testFailed++
+			continue
+		}
+		if test.configFailed {
+			t.Logf("PASS: %s", testDescr)
+			continue
+		}
+		body, err := test.notice.Render("jsmith", "local", until)
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		mismatch := false
+		for _, s := range test.expected {
+			if !strings.Contains(body, s) {
+				t.Logf("FAIL: %s, body does not contain %q: %s", testDescr, s, body)
+				mismatch = true
+			}
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultLockoutSubject  = "Your account was locked"
+	defaultLockoutTemplate = `Your account {{ .Username }} was locked due to multiple failed sign-in attempts.
+
+The account remains locked until {{ .Until }}.
+{{ if .SupportContact }}
+If you did not attempt to sign in, please contact {{ .SupportContact }}.
+{{ else }}
+If you did not attempt to sign in, please contact your administrator.
+{{ end }}`
+)
+
+// LockoutNotice represent a common set of configuration settings for
+// the notifications of the users whose accounts were locked due to
+// multiple failed sign-in attempts.
+type LockoutNotice struct {
+	// The switch determining whether the users are notified.
+	Enabled bool `json:"enabled,omitempty"`
+	// The subject of the email.
+	Subject string `json:"subject,omitempty"`
+	// The Go template of the body of the email. The template context
+	// has the Username, Realm, Until, and SupportContact fields.
+	Template string `json:"template,omitempty"`
+	// The support contact, e.g. an email address or a URL, the users
+	// reach out to when they did not attempt to sign in.
+	SupportContact string `json:"support_contact,omitempty"`
+	tmpl           *template.Template
+}
+
+// LockoutData is the template context of the lockout notification.
+type LockoutData struct {
+	Username       string
+	Realm          string
+	Until          string
+	SupportContact string
+}
+
+// Configure validates the configuration and sets default values.
+func (n *LockoutNotice) Configure() error {
+	if !n.Enabled {
+		return nil
+	}
+	if n.Subject == "" {
+		n.Subject = defaultLockoutSubject
+	}
+	if strings.ContainsAny(n.Subject, "\r\n") {
+		return fmt.Errorf("lockout notice subject contains line breaks")
+	}
+	if n.Template == "" {
+		n.Template = defaultLockoutTemplate
+	}
+	tmpl, err := template.New("lockout").Parse(n.Template)
+	if err != nil {
+		return fmt.Errorf("lockout notice template is invalid: %s", err)
+	}
+	n.tmpl = tmpl
+	return nil
+}
+
+// Render returns the body of the notification.
+func (n *LockoutNotice) Render(username, realm string, until time.Time) (string, error) {
+	data := &LockoutData{
+		Username:       username,
+		Realm:          realm,
+		Until:          until.UTC().Format(time.RFC1123),
+		SupportContact: n.SupportContact,
+	}
+	var b bytes.Buffer
+	if err := n.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultWelcomeSubject  = "Welcome"
+	defaultWelcomeTemplate = `Hello {{ if .Name }}{{ .Name }}{{ else }}{{ .Username }}{{ end }},
+
+Welcome! You signed in for the first time as {{ .Username }}.
+{{ if .SupportContact }}
+If you have any questions, please contact {{ .SupportContact }}.
+{{ end }}`
+)
+
+// welcomeStores holds the opened stores of the welcomed users, keyed by
+// their file paths, so that a file has a single writer.
+var welcomeStores = struct {
+	mux     sync.Mutex
+	entries map[string]*welcomeStore
+}{
+	entries: make(map[string]*welcomeStore),
+}
+
+// welcomeStore holds the first sign-in time of the users, keyed by realm
+// and username.
+type welcomeStore struct {
+	mux     sync.Mutex
+	path    string
+	entries map[string]time.Time
+}
+
+// WelcomeNotice represent a common set of configuration settings for
+// the welcome emails the users receive when they sign in for the first
+// time.
+type WelcomeNotice struct {
+	// The switch determining whether the users are welcomed.
+	Enabled bool `json:"enabled,omitempty"`
+	// The subject of the email.
+	Subject string `json:"subject,omitempty"`
+	// The Go template of the body of the email. The template context
+	// has the Username, Name, Realm, and SupportContact fields.
+	Template string `json:"template,omitempty"`
+	// The support contact, e.g. an email address or a URL, the users
+	// reach out to with their questions.
+	SupportContact string `json:"support_contact,omitempty"`
+	// The path to the file recording the users who signed in.
+	Store string `json:"store,omitempty"`
+	tmpl  *template.Template
+	store *welcomeStore
+}
+
+// WelcomeData is the template context of the welcome email.
+type WelcomeData struct {
+	Username       string
+	Name           string
+	Realm          string
+	SupportContact string
+}
+
+// Configure validates the configuration, sets default values, and
+// loads the users who signed in before.
+func (n *WelcomeNotice) Configure() error {
+	if !n.Enabled {
+		return nil
+	}
+	if n.Subject == "" {
+		n.Subject = defaultWelcomeSubject
+	}
+	if strings.ContainsAny(n.Subject, "\r\n") {
+		return fmt.Errorf("welcome notice subject contains line breaks")
+	}
+	if n.Template == "" {
+		n.Template = defaultWelcomeTemplate
+	}
+	tmpl, err := template.New("welcome").Parse(n.Template)
+	if err != nil {
+		return fmt.Errorf("welcome notice template is invalid: %s", err)
+	}
+	n.tmpl = tmpl
+	if n.Store == "" {
+		return fmt.Errorf("welcome notice store not found")
+	}
+	store, err := openWelcomeStore(n.Store)
+	if err != nil {
+		return err
+	}
+	n.store = store
+	return nil
+}
+
+// Render returns the body of the welcome email.
+func (n *WelcomeNotice) Render(username, name, realm string) (string, error) {
+	data := &WelcomeData{
+		Username:       username,
+		Name:           name,
+		Realm:          realm,
+		SupportContact: n.SupportContact,
+	}
+	var b bytes.Buffer
+	if err := n.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// MarkFirstLogin records the sign-in of the user. It returns true when
+// the user signed in for the first time. Only one of the concurrent
+// callers receives true for a user.
+func (n *WelcomeNotice) MarkFirstLogin(realm, username string) (bool, error) {
+	s := n.store
+	key := realm + "/" + username
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, exists := s.entries[key]; exists {
+		return false, nil
+	}
+	s.entries[key] = time.Now().UTC()
+	if err := s.save(); err != nil {
+		delete(s.entries, key)
+		return false, err
+	}
+	return true, nil
+}
+
+// ClearFirstLogin removes the record of the sign-in of the user, so
+// that the user is welcomed upon the next sign-in, e.g. when the welcome
+// email was not sent.
+func (n *WelcomeNotice) ClearFirstLogin(realm, username string) error {
+	s := n.store
+	key := realm + "/" + username
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	ts, exists := s.entries[key]
+	if !exists {
+		return nil
+	}
+	delete(s.entries, key)
+	if err := s.save(); err != nil {
+		s.entries[key] = ts
+		return err
+	}
+	return nil
+}
+
+func openWelcomeStore(path string) (*welcomeStore, error) {
+	welcomeStores.mux.Lock()
+	defer welcomeStores.mux.Unlock()
+	if s, exists := welcomeStores.entries[path]; exists {
+		return s, nil
+	}
+	s := &welcomeStore{
+		path:    path,
+		entries: make(map[string]time.Time),
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed reading welcome store %s: %s", path, err)
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.entries); err != nil {
+			return nil, fmt.Errorf("failed parsing welcome store %s: %s", path, err)
+		}
+	}
+	welcomeStores.entries[path] = s
+	return s, nil
+}
+
+func (s *welcomeStore) save() error {
+	b, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.path, b, 0600); err != nil {
+		return fmt.Errorf("failed saving welcome store %s: %s", s.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWelcomeNotice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "welcome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "welcomed.json")
+
+	n := &WelcomeNotice{Enabled: true}
+	if err := n.Configure(); err == nil {
+		t.Fatalf("expected error for missing store, but received none")
+	}
+	n.Store = path
+	if err := n.Configure(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	var firstCount int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first, err := n.MarkFirstLogin("google", "jsmith")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if first {
+				mux.Lock()
+				firstCount++
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstCount != 1 {
+		t.Fatalf("expected a single first sign-in, got %d", firstCount)
+	}
+	if first, _ := n.MarkFirstLogin("local", "jsmith"); !first {
+		t.Fatalf("expected first sign-in in another realm")
+	}
+
+	// The records survive the restart.
+	delete(welcomeStores.entries, path)
+	n = &WelcomeNotice{Enabled: true, Store: path}
+	if err := n.Configure(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if first, _ := n.MarkFirstLogin("google", "jsmith"); first {
+		t.Fatalf("expected recorded sign-in after restart")
+	}
+
+	if err := n.ClearFirstLogin("google", "jsmith"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if first, _ := n.MarkFirstLogin("google", "jsmith"); !first {
+		t.Fatalf("expected first sign-in after clearing the record")
+	}
+
+	body, err := n.Render("jsmith", "John Smith", "google")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(body, "Hello John Smith") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
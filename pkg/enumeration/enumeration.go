@@ -0,0 +1,54 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enumeration
+
+import (
+	"time"
+)
+
+// DefaultMinResponseTime is the default minimum number of milliseconds
+// the responses of the protected flows take.
+const DefaultMinResponseTime = 1000
+
+// AntiEnumeration represent a common set of configuration settings
+// protecting the existence of accounts from being discovered via the
+// login, registration, and recovery flows.
+type AntiEnumeration struct {
+	// The switch determining whether the protection is enabled.
+	Enabled bool `json:"enabled,omitempty"`
+	// The minimum number of milliseconds the responses of the protected
+	// flows take, regardless of whether an account exists.
+	MinResponseTime int `json:"min_response_time,omitempty"`
+}
+
+// Configure sets default values.
+func (a *AntiEnumeration) Configure() error {
+	if a.MinResponseTime < 1 {
+		a.MinResponseTime = DefaultMinResponseTime
+	}
+	return nil
+}
+
+// Pad delays the response of the flow started at the provided time
+// until the minimum response time elapses.
+func (a *AntiEnumeration) Pad(startedAt time.Time) {
+	if a == nil || !a.Enabled {
+		return
+	}
+	delay := time.Duration(a.MinResponseTime)*time.Millisecond - time.Since(startedAt)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
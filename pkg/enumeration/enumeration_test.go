@@ -0,0 +1,52 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enumeration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPad(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		config   *AntiEnumeration
+		elapsed  time.Duration
+		minDelay time.Duration
+		maxDelay time.Duration
+	}{
+		{config: nil, maxDelay: 20 * time.Millisecond},
+		{config: &AntiEnumeration{MinResponseTime: 100}, maxDelay: 20 * time.Millisecond},
+		{config: &AntiEnumeration{Enabled: true, MinResponseTime: 100}, minDelay: 100 * time.Millisecond, maxDelay: 150 * time.Millisecond},
+		{config: &AntiEnumeration{Enabled: true, MinResponseTime: 100}, elapsed: 60 * time.Millisecond, minDelay: 40 * time.Millisecond, maxDelay: 90 * time.Millisecond},
+		{config: &AntiEnumeration{Enabled: true, MinResponseTime: 100}, elapsed: 200 * time.Millisecond, maxDelay: 20 * time.Millisecond},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, config: %v, elapsed: %s", i, test.config, test.elapsed)
+		now := time.Now()
+		test.config.Pad(now.Add(-test.elapsed))
+		delay := time.Since(now)
+		if delay < test.minDelay || delay > test.maxDelay {
+			t.Logf("FAIL: %s, delay %s is outside of %s-%s range", testDescr, delay, test.minDelay, test.maxDelay)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -30,6 +30,7 @@ const (
 	ErrBackendUnsupportedProvider           StandardError = "unsupported OAuth 2.0 provider %s"
 	ErrBackendOauthProviderNotFound         StandardError = "no OAuth 2.0 provider found for provider %s"
 	ErrBackendOauthAuthorizationURLNotFound StandardError = "authorization URL not found for provider %s"
+	ErrBackendOauthLogoutURLNotFound        StandardError = "logout URL not found for provider %s"
 
 	ErrBackendOauthMetadataFetchFailed         StandardError = "failed to fetch metadata for OAuth 2.0 authorization server: %s"
 	ErrBackendOauthKeyFetchFailed              StandardError = "failed to fetch jwt keys for OAuth 2.0 authorization server: %s"
@@ -0,0 +1,174 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBufferSize is the default number of events buffered for each
+// subscriber.
+const DefaultBufferSize = 100
+
+// Event is an authentication event.
+type Event struct {
+	// The type of the event, i.e. login, login_failed, or logout.
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	Realm         string    `json:"realm,omitempty"`
+	User          string    `json:"user,omitempty"`
+	SourceAddress string    `json:"src_ip,omitempty"`
+	RequestID     string    `json:"request_id,omitempty"`
+}
+
+// Stream represents a common set of configuration settings for the
+// streaming of the authentication events to the admins. It delivers the
+// published events to the subscribers.
+type Stream struct {
+	// The roles allowed to subscribe to the events, e.g. admin. The
+	// streaming is disabled when there are no roles.
+	AdminRoles []string `json:"admin_roles,omitempty"`
+	// The number of events buffered for each subscriber. When the buffer
+	// is full, the oldest event is dropped.
+	BufferSize int `json:"buffer_size,omitempty"`
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives the events of the stream.
+type Subscription struct {
+	// The channel delivering the events. It is closed when the
+	// subscription ends.
+	C      chan *Event
+	realms map[string]bool
+	// The number of events dropped because of the full buffer.
+	dropped int
+	closed  bool
+}
+
+// Configure validates the configuration.
+func (s *Stream) Configure() error {
+	for _, role := range s.AdminRoles {
+		if role == "" {
+			return fmt.Errorf("event stream admin role is empty")
+		}
+	}
+	if s.BufferSize < 0 {
+		return fmt.Errorf("event stream buffer size must not be negative")
+	}
+	if s.BufferSize == 0 {
+		s.BufferSize = DefaultBufferSize
+	}
+	return nil
+}
+
+// Enabled returns true when the stream has admin roles.
+func (s *Stream) Enabled() bool {
+	return len(s.AdminRoles) > 0
+}
+
+// IsAdmin returns true when one of the roles is allowed to subscribe to
+// the events.
+func (s *Stream) IsAdmin(roles []string) bool {
+	for _, role := range roles {
+		for _, adminRole := range s.AdminRoles {
+			if role == adminRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Subscribe returns a subscription to the events of the realms. With no
+// realms, the subscription receives the events of all the realms.
+func (s *Stream) Subscribe(realms []string) *Subscription {
+	sub := &Subscription{C: make(chan *Event, s.BufferSize)}
+	if len(realms) > 0 {
+		sub.realms = make(map[string]bool)
+		for _, realm := range realms {
+			sub.realms[realm] = true
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[*Subscription]bool)
+	}
+	s.subscribers[sub] = true
+	return sub
+}
+
+// Unsubscribe ends the subscription. It returns the number of events
+// dropped because of the full buffer.
+func (s *Stream) Unsubscribe(sub *Subscription) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+	if !sub.closed {
+		sub.closed = true
+		close(sub.C)
+	}
+	return sub.dropped
+}
+
+// Publish delivers the event to the subscribers. It does not block. When
+// the buffer of a subscriber is full, the oldest event is dropped.
+func (s *Stream) Publish(e *Event) {
+	if s == nil || !s.Enabled() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers {
+		if sub.realms != nil && !sub.realms[e.Realm] {
+			continue
+		}
+		select {
+		case sub.C <- e:
+			continue
+		default:
+		}
+		select {
+		case <-sub.C:
+			sub.dropped++
+		default:
+		}
+		select {
+		case sub.C <- e:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Close ends all the subscriptions.
+func (s *Stream) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		if !sub.closed {
+			sub.closed = true
+			close(sub.C)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	testFailed := 0
+	stream := &Stream{AdminRoles: []string{"admin"}, BufferSize: 2}
+	if err := stream.Configure(); err != nil {
+		t.Fatalf("failed configuring stream: %s", err)
+	}
+	all := stream.Subscribe(nil)
+	local := stream.Subscribe([]string{"local"})
+	for i := 0; i < 3; i++ {
+		stream.Publish(&Event{Type: "login", Realm: "local", User: fmt.Sprintf("user%d", i)})
+	}
+	stream.Publish(&Event{Type: "login_failed", Realm: "contoso.com", User: "jsmith"})
+
+	tests := []struct {
+		sub     *Subscription
+		users   []string
+		dropped int
+		descr   string
+	}{
+		{sub: all, users: []string{"user2", "jsmith"}, dropped: 2, descr: "all realms"},
+		{sub: local, users: []string{"user1", "user2"}, dropped: 1, descr: "local realm"},
+	}
+	for _, test := range tests {
+		dropped := stream.Unsubscribe(test.sub)
+		var users []string
+		for e := range test.sub.C {
+			users = append(users, e.User)
+		}
+		if fmt.Sprint(users) != fmt.Sprint(test.users) || dropped != test.dropped {
+			t.Logf("FAIL: %s, expected: %v (dropped %d), received: %v (dropped %d)", test.descr, test.users, test.dropped, users, dropped)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", test.descr)
+	}
+
+	// The events published after the subscriptions end are discarded.
+	stream.Publish(&Event{Type: "logout", Realm: "local"})
+	stream.Close()
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exchange
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+const (
+	// GrantType is the grant type of the token exchange requests.
+	GrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// TokenTypeJWT is the type of the subject and the issued tokens.
+	TokenTypeJWT = "urn:ietf:params:oauth:token-type:jwt"
+	// TokenTypeAccessToken is the access token type. The portal accepts
+	// it as an alias of the JWT token type.
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// DefaultLifetime is the default number of seconds the issued tokens
+	// remain valid.
+	DefaultLifetime = 300
+)
+
+// Client represents the credentials and the exchange policy of a
+// service allowed to exchange tokens.
+type Client struct {
+	// The identifier of the client.
+	ID string `json:"id,omitempty"`
+	// The secret of the client.
+	Secret string `json:"secret,omitempty"`
+	// The audiences the client may request the tokens for.
+	Audiences []string `json:"audiences,omitempty"`
+	// The scopes the client may request. When empty, the client may
+	// request any scope of the subject token.
+	Scopes []string `json:"scopes,omitempty"`
+	// The number of seconds the issued tokens remain valid. The tokens
+	// never outlive the subject tokens.
+	Lifetime int `json:"lifetime,omitempty"`
+}
+
+// Exchange represent a common set of configuration settings for the
+// token exchange endpoint, see RFC 8693.
+type Exchange struct {
+	// The clients allowed to exchange tokens. The token exchange
+	// endpoint is disabled when there are no clients.
+	Clients []*Client `json:"clients,omitempty"`
+}
+
+// Configure validates the clients and sets default values.
+func (e *Exchange) Configure() error {
+	for _, client := range e.Clients {
+		if client.ID == "" || client.Secret == "" {
+			return fmt.Errorf("token exchange client must have id and secret")
+		}
+		if len(client.Audiences) == 0 {
+			return fmt.Errorf("token exchange client %s has no audiences", client.ID)
+		}
+		if client.Lifetime < 0 {
+			return fmt.Errorf("token exchange client %s lifetime must be a positive number of seconds", client.ID)
+		}
+		if client.Lifetime == 0 {
+			client.Lifetime = DefaultLifetime
+		}
+	}
+	return nil
+}
+
+// Enabled returns true when the token exchange endpoint has clients.
+func (e *Exchange) Enabled() bool {
+	return e != nil && len(e.Clients) > 0
+}
+
+// Authenticate returns the client matching the provided credentials. It
+// returns nil when there is no match.
+func (e *Exchange) Authenticate(clientID, clientSecret string) *Client {
+	for _, client := range e.Clients {
+		if client.ID != clientID {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(client.Secret), []byte(clientSecret)) == 1 {
+			return client
+		}
+	}
+	return nil
+}
+
+// GetAudiences returns the requested audiences. It returns an error when
+// the client may not request one of them. When no audience is requested,
+// the audiences of the client are returned.
+func (c *Client) GetAudiences(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return c.Audiences, nil
+	}
+	for _, audience := range requested {
+		if !contains(c.Audiences, audience) {
+			return nil, fmt.Errorf("audience %s is not allowed", audience)
+		}
+	}
+	return requested, nil
+}
+
+// GetScopes returns the scopes of the issued token. The requested scopes
+// must be granted to the subject token and allowed for the client. When
+// no scope is requested, the scopes of the subject token allowed for the
+// client are returned.
+func (c *Client) GetScopes(subjectScopes []string, requested string) ([]string, error) {
+	var scopes []string
+	if requested == "" {
+		for _, scope := range subjectScopes {
+			if len(c.Scopes) > 0 && !contains(c.Scopes, scope) {
+				continue
+			}
+			scopes = append(scopes, scope)
+		}
+		return scopes, nil
+	}
+	for _, scope := range strings.Fields(requested) {
+		if !contains(subjectScopes, scope) {
+			return nil, fmt.Errorf("scope %s is not granted to subject token", scope)
+		}
+		if len(c.Scopes) > 0 && !contains(c.Scopes, scope) {
+			return nil, fmt.Errorf("scope %s is not allowed", scope)
+		}
+		if !contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func contains(entries []string, s string) bool {
+	for _, entry := range entries {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/denial"
+)
+
+const (
+	// DefaultClaim is the default name of the claim holding the flags.
+	DefaultClaim = "flags"
+	// DefaultHeader is the default name of the header holding the flags.
+	DefaultHeader = "X-Feature-Flags"
+)
+
+// reservedClaims are the claims the flags must not be added to.
+var reservedClaims = map[string]bool{
+	"aud":    true,
+	"exp":    true,
+	"jti":    true,
+	"iat":    true,
+	"iss":    true,
+	"nbf":    true,
+	"sub":    true,
+	"email":  true,
+	"name":   true,
+	"origin": true,
+	"roles":  true,
+	"scopes": true,
+	"org":    true,
+	"acl":    true,
+	"addr":   true,
+}
+
+// Rule enables the feature flag for the authenticated users having a
+// claim matching the value, e.g. the roles claim equal to beta_tester.
+type Rule struct {
+	// The name of the flag, e.g. new_dashboard.
+	Flag string `json:"flag,omitempty"`
+	// The name of the claim, e.g. email, roles, or a custom claim.
+	Claim string `json:"claim,omitempty"`
+	// The comparison operator, i.e. eq, ne, gt, ge, lt, le, or regex.
+	Operator string `json:"operator,omitempty"`
+	// The value the claim is compared to.
+	Value string `json:"value,omitempty"`
+	cond  *denial.Rule
+}
+
+// Config represents a common set of configuration settings for the
+// feature flags computed from the claims of the authenticated users.
+type Config struct {
+	Rules []*Rule `json:"rules,omitempty"`
+	// The channel the flags are emitted through, i.e. claim (a claim of
+	// the issued tokens) or header (a response header of the requests
+	// of the authenticated users). The default is claim.
+	Output string `json:"output,omitempty"`
+	// The name of the claim or the header holding the flags.
+	Name string `json:"name,omitempty"`
+}
+
+// Configure validates the configuration and sets default values.
+func (c *Config) Configure() error {
+	if !c.Enabled() {
+		return nil
+	}
+	for _, rule := range c.Rules {
+		if rule.Flag == "" {
+			return fmt.Errorf("feature flag rule has no flag")
+		}
+		if strings.ContainsAny(rule.Flag, ", ") {
+			return fmt.Errorf("feature flag %q must not contain commas or spaces", rule.Flag)
+		}
+		// The flag rules share the comparison semantics of the claim
+		// deny rules.
+		rule.cond = &denial.Rule{
+			Realm:    "*",
+			Claim:    rule.Claim,
+			Operator: rule.Operator,
+			Value:    rule.Value,
+		}
+		if err := rule.cond.Configure(); err != nil {
+			return fmt.Errorf("feature flag %s rule is invalid: %s", rule.Flag, err)
+		}
+	}
+	switch c.Output {
+	case "", "claim":
+		c.Output = "claim"
+		if c.Name == "" {
+			c.Name = DefaultClaim
+		}
+		if reservedClaims[c.Name] {
+			return fmt.Errorf("feature flags claim %s is reserved", c.Name)
+		}
+	case "header":
+		if c.Name == "" {
+			c.Name = DefaultHeader
+		}
+		c.Name = http.CanonicalHeaderKey(c.Name)
+	default:
+		return fmt.Errorf("feature flags output %q is unsupported", c.Output)
+	}
+	return nil
+}
+
+// Enabled returns true when the configuration has rules.
+func (c *Config) Enabled() bool {
+	if c == nil {
+		return false
+	}
+	return len(c.Rules) > 0
+}
+
+// Evaluate returns the sorted names of the flags whose rules match the
+// claims. A flag having multiple rules is enabled when any of them
+// matches.
+func (c *Config) Evaluate(claims *jwtclaims.UserClaims, customClaims map[string]interface{}) ([]string, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	data, err := claimsToMap(claims, customClaims)
+	if err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool)
+	var flags []string
+	for _, rule := range c.Rules {
+		if enabled[rule.Flag] || rule.cond == nil {
+			continue
+		}
+		if rule.cond.Match(data[rule.Claim]) {
+			enabled[rule.Flag] = true
+			flags = append(flags, rule.Flag)
+		}
+	}
+	sort.Strings(flags)
+	return flags, nil
+}
+
+// SetHeader sets the header holding the comma-separated flags. It
+// removes the header when no flags are enabled.
+func (c *Config) SetHeader(h http.Header, flags []string) {
+	if len(flags) == 0 {
+		h.Del(c.Name)
+		return
+	}
+	h.Set(c.Name, strings.Join(flags, ","))
+}
+
+// claimsToMap returns the claims keyed by their JWT names, e.g. email,
+// including the custom claims.
+func claimsToMap(claims *jwtclaims.UserClaims, customClaims map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range customClaims {
+		if _, exists := m[k]; !exists {
+			m[k] = v
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestEvaluate(t *testing.T) {
+	testFailed := 0
+	cfg := &Config{
+		Rules: []*Rule{
+			{Flag: "new_dashboard", Claim: "roles", Operator: "eq", Value: "beta_tester"},
+			{Flag: "new_dashboard", Claim: "email", Operator: "regex", Value: `@contoso\.com$`},
+			{Flag: "bulk_export", Claim: "risk_score", Operator: "lt", Value: "20"},
+		},
+	}
+	if err := cfg.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	if cfg.Output != "claim" || cfg.Name != DefaultClaim {
+		t.Fatalf("unexpected defaults: %s %s", cfg.Output, cfg.Name)
+	}
+
+	tests := []struct {
+		claims       *jwtclaims.UserClaims
+		customClaims map[string]interface{}
+		expected     []string
+	}{
+		{
+			claims: &jwtclaims.UserClaims{Email: "jsmith@example.com", Roles: []string{"viewer"}},
+		},
+		{
+			claims:   &jwtclaims.UserClaims{Email: "jsmith@example.com", Roles: []string{"viewer", "beta_tester"}},
+			expected: []string{"new_dashboard"},
+		},
+		{
+			claims:       &jwtclaims.UserClaims{Email: "jsmith@contoso.com", Roles: []string{"beta_tester"}},
+			customClaims: map[string]interface{}{"risk_score": 5},
+			expected:     []string{"bulk_export", "new_dashboard"},
+		},
+		{
+			claims:       &jwtclaims.UserClaims{Email: "jsmith@example.com"},
+			customClaims: map[string]interface{}{"risk_score": "75"},
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, email: %s, roles: %v", i, test.claims.Email, test.claims.Roles)
+		flags, err := cfg.Evaluate(test.claims, test.customClaims)
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(flags, test.expected) {
+			t.Logf("FAIL: %s, flags mismatch: %v (expected) vs. %v (received)", testDescr, test.expected, flags)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	testFailed := 0
+	rule := &Rule{Flag: "beta", Claim: "roles", Operator: "eq", Value: "beta_tester"}
+	tests := []struct {
+		cfg        *Config
+		name       string
+		shouldFail bool
+	}{
+		{cfg: &Config{Rules: []*Rule{rule}, Output: "header"}, name: DefaultHeader},
+		{cfg: &Config{Rules: []*Rule{rule}, Output: "header", Name: "x-flags"}, name: "X-Flags"},
+		{cfg: &Config{Rules: []*Rule{rule}, Name: "features"}, name: "features"},
+		{cfg: &Config{Rules: []*Rule{rule}, Name: "roles"}, shouldFail: true},
+		{cfg: &Config{Rules: []*Rule{rule}, Output: "cookie"}, shouldFail: true},
+		{cfg: &Config{Rules: []*Rule{{Flag: "beta,alpha", Claim: "roles", Operator: "eq", Value: "admin"}}}, shouldFail: true},
+		{cfg: &Config{Rules: []*Rule{{Flag: "beta", Claim: "roles", Operator: "in", Value: "admin"}}}, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, output: %s, name: %s", i, test.cfg.Output, test.cfg.Name)
+		err := test.cfg.Configure()
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if test.cfg.Name != test.name {
+			t.Logf("FAIL: %s, name mismatch: %s (expected) vs. %s (received)", testDescr, test.name, test.cfg.Name)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	h := make(http.Header)
+	cfg := tests[0].cfg
+	cfg.SetHeader(h, []string{"alpha", "beta"})
+	if h.Get(DefaultHeader) != "alpha,beta" {
+		t.Fatalf("unexpected header value: %s", h.Get(DefaultHeader))
+	}
+	cfg.SetHeader(h, nil)
+	if _, exists := h[DefaultHeader]; exists {
+		t.Fatalf("header not removed")
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
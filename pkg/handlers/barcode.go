@@ -25,9 +25,7 @@ import (
 func ServeBarcodeImage(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
 	authURLPath := opts["auth_url_path"].(string)
 	if !opts["authenticated"].(bool) {
-		w.Header().Set("Location", authURLPath+"?redirect_url="+r.RequestURI)
-		w.WriteHeader(302)
-		return nil
+		return serveLoginRedirect(w, r, opts, authURLPath+"?redirect_url="+r.RequestURI)
 	}
 	reqID := opts["request_id"].(string)
 	log := opts["logger"].(*zap.Logger)
@@ -0,0 +1,172 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/email"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"go.uber.org/zap"
+)
+
+// emailChangeCachePrefix is the prefix of the session cache entries
+// holding the pending changes of email addresses.
+const emailChangeCachePrefix = "email_change:"
+
+// serveEmailSettings handles the change of the email address of the
+// user. The new address takes effect once the user follows the link sent
+// to it. It returns the settings view to render.
+func serveEmailSettings(r *http.Request, opts map[string]interface{}, resp *ui.UserInterfaceArgs, viewParts []string) string {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	authURLPath := opts["auth_url_path"].(string)
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+
+	if resp.Data["email_change_enabled"] != true {
+		return "email-disabled"
+	}
+	backend := opts["backend"].(*backends.Backend)
+	changeCfg := opts["email_change"].(*email.Change)
+	smtpCfg := opts["smtp"].(*email.Config)
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+	resp.Data["current_email"] = claims.Email
+
+	if len(viewParts) < 2 {
+		return "email"
+	}
+
+	resp.Data["status"] = "failure"
+	switch viewParts[1] {
+	case "edit":
+		if r.Method != "POST" {
+			return "email"
+		}
+		newEmail, err := validateEmailChangeForm(r)
+		if err != nil {
+			resp.Data["status_reason"] = err.Error()
+			return "email-edit"
+		}
+		operation := map[string]interface{}{
+			"name":      "check_email_address",
+			"username":  claims.Subject,
+			"email":     claims.Email,
+			"new_email": newEmail,
+		}
+		if err := backend.Do(operation); err != nil {
+			resp.Data["status_reason"] = fmt.Sprintf("%s", err)
+			return "email-edit"
+		}
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			log.Error("Failed generating email change token", zap.String("request_id", reqID), zap.String("error", err.Error()))
+			resp.Data["status_reason"] = "Internal Server Error"
+			return "email-edit"
+		}
+		token := base64.RawURLEncoding.EncodeToString(b)
+		sessionCache.Add(emailChangeCachePrefix+token, map[string]interface{}{
+			"username":   claims.Subject,
+			"email":      claims.Email,
+			"new_email":  newEmail,
+			"realm":      backend.GetRealm(),
+			"expires_at": time.Now().Add(time.Duration(changeCfg.Lifetime) * time.Second),
+		})
+		link := opts["link_base_url"].(string) + path.Join(authURLPath, "settings", "email", "confirm", token)
+		body := fmt.Sprintf(
+			"Please confirm the change of the email address of your account %s by following the link below.\n\n"+
+				"%s\n\nThe link expires in %d minutes. If you did not request the change, please ignore this email.\n",
+			claims.Subject, link, changeCfg.Lifetime/60,
+		)
+		if err := smtpCfg.Send(newEmail, "Confirm your new email address", body); err != nil {
+			sessionCache.Delete(emailChangeCachePrefix + token)
+			log.Error("Failed sending email change confirmation",
+				zap.String("request_id", reqID),
+				zap.String("user", claims.Subject),
+				zap.String("error", err.Error()),
+			)
+			resp.Data["status_reason"] = "Failed sending the confirmation email"
+			return "email-edit"
+		}
+		log.Info("Email address change requested",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("new_email", newEmail),
+		)
+		resp.Data["status"] = "success"
+		resp.Data["new_email"] = newEmail
+		return "email-edit"
+	case "confirm":
+		if len(viewParts) != 3 || viewParts[2] == "" {
+			resp.Data["status_reason"] = "malformed request"
+			return "email-confirm"
+		}
+		entry := sessionCache.Pop(emailChangeCachePrefix + viewParts[2])
+		if entry == nil || time.Now().After(entry["expires_at"].(time.Time)) {
+			resp.Data["status_reason"] = "The confirmation link is invalid or expired"
+			return "email-confirm"
+		}
+		if entry["username"] != claims.Subject || entry["realm"] != backend.GetRealm() {
+			resp.Data["status_reason"] = "The confirmation link belongs to another account"
+			return "email-confirm"
+		}
+		operation := map[string]interface{}{
+			"name":      "change_email_address",
+			"username":  entry["username"],
+			"email":     entry["email"],
+			"new_email": entry["new_email"],
+		}
+		if err := backend.Do(operation); err != nil {
+			resp.Data["status_reason"] = fmt.Sprintf("%s", err)
+			return "email-confirm"
+		}
+		log.Info("Email address changed",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.Any("email", entry["email"]),
+			zap.Any("new_email", entry["new_email"]),
+		)
+		resp.Data["status"] = "success"
+		resp.Data["new_email"] = entry["new_email"]
+		return "email-confirm"
+	}
+	return "email"
+}
+
+func validateEmailChangeForm(r *http.Request) (string, error) {
+	if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return "", fmt.Errorf("Unsupported content type")
+	}
+	if err := r.ParseForm(); err != nil {
+		return "", fmt.Errorf("Failed parsing submitted form")
+	}
+	newEmail := strings.TrimSpace(r.PostFormValue("email"))
+	if newEmail == "" {
+		return "", fmt.Errorf("Required form email field is empty")
+	}
+	if err := validators.ValidateUserInputEmail(newEmail, nil); err != nil {
+		return "", fmt.Errorf("Invalid email address: %s", err)
+	}
+	return newEmail, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/events"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// eventStreamKeepAlive is the interval of the comments keeping the idle
+// event stream open.
+const eventStreamKeepAlive = 30 * time.Second
+
+// ServeEventStream streams the authentication events to the admins as
+// server-sent events. The realm query parameters limit the events to the
+// realms. Only the authenticated users having one of the admin roles may
+// use it.
+func ServeEventStream(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	stream := opts["event_stream"].(*events.Stream)
+
+	if !stream.Enabled() {
+		return writeTransferResponse(w, http.StatusNotFound, map[string]interface{}{"error": "not_found"})
+	}
+	if !opts["authenticated"].(bool) {
+		return writeTransferResponse(w, http.StatusUnauthorized, map[string]interface{}{"error": "unauthorized"})
+	}
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	if !stream.IsAdmin(claims.Roles) {
+		log.Warn("Event stream denied",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("src_ip_address", utils.GetSourceAddress(r)),
+		)
+		return writeTransferResponse(w, http.StatusForbidden, map[string]interface{}{"error": "forbidden"})
+	}
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		return writeTransferResponse(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": "method_not_allowed"})
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return writeTransferResponse(w, http.StatusInternalServerError, map[string]interface{}{"error": "streaming_unsupported"})
+	}
+
+	realms := r.URL.Query()["realm"]
+	sub := stream.Subscribe(realms)
+	log.Info("Event stream opened",
+		zap.String("request_id", reqID),
+		zap.String("user", claims.Subject),
+		zap.Strings("realms", realms),
+	)
+	defer func() {
+		dropped := stream.Unsubscribe(sub)
+		log.Info("Event stream closed",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.Int("dropped", dropped),
+		)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			payload, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := w.Write([]byte("event: " + e.Type + "\ndata: " + string(payload) + "\n\n")); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+	}
+}
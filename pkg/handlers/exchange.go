@@ -0,0 +1,222 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	jwtvalidator "github.com/greenpau/caddy-auth-jwt/pkg/validator"
+	"github.com/greenpau/caddy-auth-portal/pkg/exchange"
+	"github.com/greenpau/caddy-auth-portal/pkg/signing"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// ServeTokenExchange exchanges the token of a user, submitted by a
+// service, for a token with a different audience and narrower scopes,
+// see RFC 8693. The service authenticates with its client credentials
+// via HTTP Basic authentication.
+func ServeTokenExchange(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	cfg := opts["token_exchange"].(*exchange.Exchange)
+	validator := opts["token_validator"].(*jwtvalidator.TokenValidator)
+	tokenProvider := opts["token_provider"].(*jwtconfig.CommonTokenConfig)
+
+	if !cfg.Enabled() {
+		return writeExchangeError(w, http.StatusNotFound, "not_found", "")
+	}
+
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return writeExchangeError(w, http.StatusMethodNotAllowed, "invalid_request", "")
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	var client *exchange.Client
+	if ok {
+		client = cfg.Authenticate(clientID, clientSecret)
+	}
+	if client == nil {
+		log.Warn("Token exchange client authentication failed",
+			zap.String("request_id", reqID),
+			zap.String("client_id", clientID),
+			zap.String("src_ip_address", utils.GetSourceAddress(r)),
+		)
+		w.Header().Set("WWW-Authenticate", `Basic realm="token_exchange"`)
+		return writeExchangeError(w, http.StatusUnauthorized, "invalid_client", "")
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+	}
+	if r.PostForm.Get("grant_type") != exchange.GrantType {
+		return writeExchangeError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+	subjectToken := r.PostForm.Get("subject_token")
+	if subjectToken == "" {
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_request", "subject_token is required")
+	}
+	switch r.PostForm.Get("subject_token_type") {
+	case exchange.TokenTypeJWT, exchange.TokenTypeAccessToken:
+	default:
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_request", "unsupported subject_token_type")
+	}
+	switch r.PostForm.Get("requested_token_type") {
+	case "", exchange.TokenTypeJWT, exchange.TokenTypeAccessToken:
+	default:
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_request", "unsupported requested_token_type")
+	}
+	if r.PostForm.Get("actor_token") != "" {
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_request", "actor_token is unsupported")
+	}
+
+	subjectClaims, valid, err := validator.ValidateToken(subjectToken, jwtconfig.NewTokenValidatorOptions())
+	if valid && subjectClaims != nil {
+		if err = checkIssuedToken(opts, subjectClaims); err != nil {
+			valid = false
+		}
+	}
+	if !valid || subjectClaims == nil {
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		log.Warn("Token exchange rejected invalid subject token",
+			zap.String("request_id", reqID),
+			zap.String("client_id", clientID),
+			zap.String("error", errMsg),
+		)
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_grant", "subject_token is invalid")
+	}
+
+	audiences, err := client.GetAudiences(r.PostForm["audience"])
+	if err != nil {
+		log.Warn("Token exchange rejected disallowed audience",
+			zap.String("request_id", reqID),
+			zap.String("client_id", clientID),
+			zap.String("user", subjectClaims.Subject),
+			zap.String("error", err.Error()),
+		)
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_target", err.Error())
+	}
+	scopes, err := client.GetScopes(subjectClaims.Scopes, r.PostForm.Get("scope"))
+	if err != nil {
+		log.Warn("Token exchange rejected disallowed scope",
+			zap.String("request_id", reqID),
+			zap.String("client_id", clientID),
+			zap.String("user", subjectClaims.Subject),
+			zap.String("error", err.Error()),
+		)
+		return writeExchangeError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+	}
+
+	if keyring, ok := opts["signing_keyring"].(*signing.Keyring); ok {
+		if realm, found := keyring.GetTokenRealm(subjectToken); found {
+			tokenProvider = getRealmTokenProvider(opts, realm)
+		}
+	}
+
+	claims := newExchangedClaims(subjectClaims, audiences, scopes, client.Lifetime)
+	claims.Issuer = utils.GetCurrentURL(r)
+	customClaims, err := GetCustomClaims(subjectToken)
+	if err != nil || customClaims == nil {
+		customClaims = make(map[string]interface{})
+	}
+	for _, k := range exchangedClaims {
+		delete(customClaims, k)
+	}
+	customClaims["act"] = map[string]interface{}{"sub": client.ID}
+	token, err := NewUserToken(tokenProvider, claims, customClaims)
+	if err != nil {
+		log.Error("Token exchange signing failed",
+			zap.String("request_id", reqID),
+			zap.String("client_id", clientID),
+			zap.String("error", err.Error()),
+		)
+		return writeExchangeError(w, http.StatusInternalServerError, "server_error", "")
+	}
+	log.Info("Exchanged token",
+		zap.String("request_id", reqID),
+		zap.String("client_id", clientID),
+		zap.String("user", claims.Subject),
+		zap.Strings("audience", audiences),
+		zap.Strings("scopes", scopes),
+	)
+
+	resp := map[string]interface{}{
+		"access_token":      token,
+		"issued_token_type": exchange.TokenTypeJWT,
+		"token_type":        "Bearer",
+		"expires_in":        claims.ExpiresAt - claims.IssuedAt,
+	}
+	if len(scopes) > 0 {
+		resp["scope"] = strings.Join(scopes, " ")
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.Error("Failed JSON response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
+		return writeExchangeError(w, http.StatusInternalServerError, "server_error", "")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+	return nil
+}
+
+// exchangedClaims are the custom claims of the subject token not carried
+// into the exchanged token, because the exchange sets them anew.
+var exchangedClaims = []string{"act", "cnf", "scope"}
+
+// newExchangedClaims returns the claims of the token issued in exchange
+// for the subject token. The token does not outlive the subject token.
+func newExchangedClaims(subjectClaims *jwtclaims.UserClaims, audiences, scopes []string, lifetime int) *jwtclaims.UserClaims {
+	claims := &jwtclaims.UserClaims{
+		Audience:      audiences,
+		Subject:       subjectClaims.Subject,
+		Name:          subjectClaims.Name,
+		Email:         subjectClaims.Email,
+		Roles:         subjectClaims.Roles,
+		Origin:        subjectClaims.Origin,
+		Scopes:        scopes,
+		Organizations: subjectClaims.Organizations,
+	}
+	claims.IssuedAt = time.Now().Unix()
+	claims.ExpiresAt = claims.IssuedAt + int64(lifetime)
+	if subjectClaims.ExpiresAt > 0 && subjectClaims.ExpiresAt < claims.ExpiresAt {
+		claims.ExpiresAt = subjectClaims.ExpiresAt
+	}
+	return claims
+}
+
+func writeExchangeError(w http.ResponseWriter, statusCode int, code, description string) error {
+	resp := map[string]string{"error": code}
+	if description != "" {
+		resp["error_description"] = description
+	}
+	payload, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	w.Write(payload)
+	return nil
+}
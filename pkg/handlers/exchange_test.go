@@ -0,0 +1,219 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	jwtacl "github.com/greenpau/caddy-auth-jwt/pkg/acl"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	jwtvalidator "github.com/greenpau/caddy-auth-jwt/pkg/validator"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/exchange"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeTokenExchange(t *testing.T) {
+	testFailed := 0
+	secret := "75f03764-147c-4d87-b2f0-4fda89e331c8"
+	tokenConfig := jwtconfig.NewCommonTokenConfig()
+	tokenConfig.TokenSecret = secret
+	tokenConfig.TokenSignMethod = "HS512"
+	validator := jwtvalidator.NewTokenValidator()
+	validator.TokenConfigs = []*jwtconfig.CommonTokenConfig{tokenConfig}
+	if err := validator.ConfigureTokenBackends(); err != nil {
+		t.Fatalf("failed configuring token validator: %s", err)
+	}
+	entry := jwtacl.NewAccessListEntry()
+	entry.Allow()
+	entry.SetClaim("roles")
+	entry.AddValue("*")
+	validator.AccessList = append(validator.AccessList, entry)
+
+	claims := &jwtclaims.UserClaims{
+		Subject:   "jsmith",
+		Email:     "jsmith@contoso.com",
+		Roles:     []string{"viewer"},
+		Scopes:    []string{"read", "write", "admin"},
+		ID:        "a1b2c3",
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+	subjectToken, err := claims.GetToken("HS512", []byte(secret))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	foreignToken, err := claims.GetToken("HS512", []byte("foreign"))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	oldClaims := *claims
+	oldClaims.IssuedAt = time.Now().Add(-2 * time.Hour).Unix()
+	oldToken, err := oldClaims.GetToken("HS512", []byte(secret))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	revokedClaims := *claims
+	revokedClaims.ID = "d4e5f6"
+	revokedToken, err := revokedClaims.GetToken("HS512", []byte(secret))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	sessionCache := cache.NewSessionCache()
+	sessionCache.Revoke(revokedClaims.ID, time.Now().Add(time.Hour))
+
+	cfg := &exchange.Exchange{
+		Clients: []*exchange.Client{
+			{ID: "svc", Secret: "svc-secret", Audiences: []string{"billing", "reports"}, Scopes: []string{"read", "write"}},
+		},
+	}
+	if err := cfg.Configure(); err != nil {
+		t.Fatalf("failed configuring token exchange: %s", err)
+	}
+
+	tests := []struct {
+		method       string
+		clientSecret string
+		form         map[string][]string
+		statusCode   int
+		errorCode    string
+		audience     []interface{}
+		scope        string
+	}{
+		{method: "GET", clientSecret: "svc-secret", statusCode: 405},
+		{method: "POST", clientSecret: "wrong", statusCode: 401, errorCode: "invalid_client"},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 400, errorCode: "unsupported_grant_type",
+			form: map[string][]string{"grant_type": {"client_credentials"}},
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 400, errorCode: "invalid_grant",
+			form: map[string][]string{"subject_token": {foreignToken}},
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 400, errorCode: "invalid_grant",
+			form: map[string][]string{"subject_token": {oldToken}},
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 400, errorCode: "invalid_grant",
+			form: map[string][]string{"subject_token": {revokedToken}},
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 400, errorCode: "invalid_target",
+			form: map[string][]string{"audience": {"payroll"}},
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 400, errorCode: "invalid_scope",
+			form: map[string][]string{"scope": {"admin"}},
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 400, errorCode: "invalid_scope",
+			form: map[string][]string{"scope": {"delete"}},
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 200,
+			audience: []interface{}{"billing", "reports"}, scope: "read write",
+		},
+		{
+			method: "POST", clientSecret: "svc-secret", statusCode: 200,
+			form:     map[string][]string{"audience": {"billing"}, "scope": {"read"}},
+			audience: []interface{}{"billing"}, scope: "read",
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, method: %s, form: %v", i, test.method, test.form)
+		form := url.Values{}
+		form.Set("grant_type", exchange.GrantType)
+		form.Set("subject_token", subjectToken)
+		form.Set("subject_token_type", exchange.TokenTypeJWT)
+		for k, v := range test.form {
+			form[k] = v
+		}
+		r := httptest.NewRequest(test.method, "/auth/token/exchange", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("svc", test.clientSecret)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":      "abc",
+			"logger":          utils.NewLogger(),
+			"token_exchange":  cfg,
+			"token_validator": validator,
+			"max_token_age":   3600,
+			"session_cache":   sessionCache,
+			"token_provider":  tokenConfig,
+		}
+		ServeTokenExchange(w, r, opts)
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received), %s", testDescr, test.statusCode, w.Code, w.Body.String())
+			testFailed++
+			continue
+		}
+		resp := make(map[string]interface{})
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if test.errorCode != "" && resp["error"] != test.errorCode {
+			t.Logf("FAIL: %s, error code: %s (expected) vs. %v (received)", testDescr, test.errorCode, resp["error"])
+			testFailed++
+			continue
+		}
+		if w.Code != 200 {
+			t.Logf("PASS: %s", testDescr)
+			continue
+		}
+		token, err := jwtlib.Parse(resp["access_token"].(string), func(token *jwtlib.Token) (interface{}, error) {
+			return []byte(secret), nil
+		})
+		if err != nil {
+			t.Logf("FAIL: %s, failed parsing issued token: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		tokenClaims := token.Claims.(jwtlib.MapClaims)
+		if tokenClaims["sub"] != "jsmith" || !reflect.DeepEqual(tokenClaims["aud"], test.audience) {
+			t.Logf("FAIL: %s, claims mismatch: %v", testDescr, tokenClaims)
+			testFailed++
+			continue
+		}
+		if resp["scope"] != test.scope {
+			t.Logf("FAIL: %s, scope: %s (expected) vs. %v (received)", testDescr, test.scope, resp["scope"])
+			testFailed++
+			continue
+		}
+		if act, ok := tokenClaims["act"].(map[string]interface{}); !ok || act["sub"] != "svc" {
+			t.Logf("FAIL: %s, act claim mismatch: %v", testDescr, tokenClaims["act"])
+			testFailed++
+			continue
+		}
+		if int64(tokenClaims["exp"].(float64)) > claims.ExpiresAt {
+			t.Logf("FAIL: %s, issued token outlives subject token", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"go.uber.org/zap"
+)
+
+// serveFallback logs the failure to render the template and responds
+// with the minimal page not depending on the templates, so that users
+// do not end up with a blank or a broken page.
+func serveFallback(w http.ResponseWriter, opts map[string]interface{}, name string, err error) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	log.Error("Failed HTML response rendering",
+		zap.String("request_id", reqID),
+		zap.String("template", name),
+		zap.String("error", err.Error()),
+	)
+	if opts["content_type"].(string) == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+		w.Write([]byte(`{"message":"Internal Server Error"}`))
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(500)
+	w.Write(uiFactory.RenderFallback().Bytes())
+	return err
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeFallback(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		contentType string
+		message     string
+		expected    []string
+	}{
+		{
+			contentType: "text/html",
+			expected:    []string{ui.DefaultFallbackMessage, "&lt;Contoso&gt; Portal", `href="/auth"`},
+		},
+		{
+			contentType: "text/html",
+			message:     "Please contact IT Help Desk.",
+			expected:    []string{"Please contact IT Help Desk."},
+		},
+		{
+			contentType: "application/json",
+			expected:    []string{`{"message":"Internal Server Error"}`},
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, content type: %s", i, test.contentType)
+		uiFactory := ui.NewUserInterfaceFactory()
+		uiFactory.Title = "<Contoso> Portal"
+		uiFactory.ActionEndpoint = "/auth"
+		uiFactory.FallbackMessage = test.message
+		uiFactory.Templates["generic"] = &ui.UserInterfaceTemplate{
+			Template: template.Must(template.New("generic").Parse(`{{ template "missing" }}`)),
+		}
+		r := httptest.NewRequest("GET", "/auth/unknown", nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":    "abc",
+			"logger":        utils.NewLogger(),
+			"ui":            uiFactory,
+			"auth_url_path": "/auth",
+			"flow":          "not_found",
+			"authenticated": false,
+			"content_type":  test.contentType,
+		}
+		var err error
+		if test.contentType == "application/json" {
+			err = serveFallback(w, opts, "generic", fmt.Errorf("template generic rendering failed"))
+		} else {
+			err = ServeGeneric(w, r, opts)
+		}
+		if err == nil {
+			t.Logf("FAIL: %s, expected rendering error", testDescr)
+			testFailed++
+			continue
+		}
+		if w.Code != 500 {
+			t.Logf("FAIL: %s, status code: 500 (expected) vs. %d (received)", testDescr, w.Code)
+			testFailed++
+			continue
+		}
+		body := w.Body.String()
+		mismatch := false
+		for _, s := range test.expected {
+			if !strings.Contains(body, s) {
+				t.Logf("FAIL: %s, response body %q lacks %q", testDescr, body, s)
+				mismatch = true
+			}
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
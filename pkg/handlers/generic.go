@@ -17,6 +17,7 @@ package handlers
 import (
 	"encoding/json"
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/unsupported"
 	"go.uber.org/zap"
 	"net/http"
 )
@@ -38,6 +39,12 @@ func ServeGeneric(w http.ResponseWriter, r *http.Request, opts map[string]interf
 	case "auth_failed":
 		statusCode = 401
 		title = "Authentication Failed"
+	case "unauthenticated":
+		statusCode = 401
+		title = "Unauthorized"
+	case "access_denied":
+		statusCode = 403
+		title = "Access Denied"
 	case "backend_not_found":
 		title = "Authentication Backend Not Found"
 		statusCode = 404
@@ -52,6 +59,15 @@ func ServeGeneric(w http.ResponseWriter, r *http.Request, opts map[string]interf
 	case "internal_server_error":
 		title = "Internal Server Error"
 		statusCode = 500
+	case "rate_limited":
+		title = "Too Many Requests"
+		statusCode = 429
+	case "maintenance":
+		title = "Under Maintenance"
+		statusCode = 503
+	case "redirect_loop":
+		title = "Redirect Loop Detected"
+		statusCode = 500
 	default:
 		title = "Unsupported Flow"
 		statusCode = 400
@@ -63,13 +79,38 @@ func ServeGeneric(w http.ResponseWriter, r *http.Request, opts map[string]interf
 		zap.Int("status_code", statusCode),
 	)
 
+	var redirectURL string
+	if flow == "unsupported_feature" {
+		if v, exists := opts["unsupported_responses"]; exists {
+			unsupportedFlow, _ := opts["unsupported_flow"].(string)
+			if unsupportedResponse := v.(*unsupported.Responses).Get(unsupportedFlow); unsupportedResponse != nil {
+				redirectURL = unsupportedResponse.RedirectURL
+				if unsupportedResponse.Message != "" {
+					opts["message"] = unsupportedResponse.Message
+				}
+			}
+		}
+	}
+
 	// If the requested content type is JSON, then output authenticated message
 	if opts["content_type"].(string) == "application/json" {
 		resp := make(map[string]interface{})
 		resp["message"] = title
+		if msg, exists := opts["message"]; exists {
+			resp["details"] = msg
+		}
+		if statusCode == 401 {
+			details, _ := resp["details"].(string)
+			if writeUnauthorizedBody(w, r, opts, title, details) {
+				return nil
+			}
+		}
 		if opts["authenticated"].(bool) {
 			resp["authenticated"] = true
 		}
+		if redirectURL != "" {
+			resp["redirect_url"] = redirectURL
+		}
 		payload, err := json.Marshal(resp)
 		if err != nil {
 			log.Error("Failed JSON response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
@@ -84,9 +125,18 @@ func ServeGeneric(w http.ResponseWriter, r *http.Request, opts map[string]interf
 		return nil
 	}
 
+	if redirectURL != "" {
+		w.Header().Set("Location", redirectURL)
+		w.WriteHeader(302)
+		return nil
+	}
+
 	// Display main authentication portal page
 	resp := ui.GetArgs()
 	resp.Title = title
+	if msg, exists := opts["message"]; exists {
+		resp.Message = msg.(string)
+	}
 	resp.Data["go_back_url"] = authURLPath
 	if opts["authenticated"].(bool) {
 		resp.Data["authenticated"] = true
@@ -99,14 +149,20 @@ func ServeGeneric(w http.ResponseWriter, r *http.Request, opts map[string]interf
 	}
 	content, err := ui.Render("generic", resp)
 	if err != nil {
-		log.Error("Failed HTML response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(500)
-		w.Write([]byte(`Internal Server Error`))
-		return err
+		return serveFallback(w, opts, "generic", err)
 	}
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(statusCode)
 	w.Write(content.Bytes())
 	return nil
 }
+
+// ServeUnsupported returns the response to the requests for the flow
+// the portal does not support, e.g. the account recovery when it is not
+// configured. The operators may configure a custom redirect or message
+// for the flow.
+func ServeUnsupported(w http.ResponseWriter, r *http.Request, opts map[string]interface{}, unsupportedFlow string) error {
+	opts["flow"] = "unsupported_feature"
+	opts["unsupported_flow"] = unsupportedFlow
+	return ServeGeneric(w, r, opts)
+}
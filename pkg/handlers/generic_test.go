@@ -0,0 +1,91 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/unsupported"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeUnsupported(t *testing.T) {
+	testFailed := 0
+	responses := &unsupported.Responses{
+		Entries: []*unsupported.Response{
+			{Flow: "recover", RedirectURL: "https://helpdesk.contoso.com/password-reset"},
+			{Flow: "register", Message: "Please contact IT to request an account"},
+		},
+	}
+	if err := responses.Configure(); err != nil {
+		t.Fatalf("failed configuring responses: %s", err)
+	}
+	tests := []struct {
+		flow        string
+		contentType string
+		code        int
+		location    string
+		expected    string
+	}{
+		{flow: "recover", contentType: "text/html", code: 302, location: "https://helpdesk.contoso.com/password-reset"},
+		{flow: "recover", contentType: "application/json", code: 404, expected: `"redirect_url":"https://helpdesk.contoso.com/password-reset"`},
+		{flow: "register", contentType: "text/html", code: 404, expected: "Please contact IT to request an account"},
+		{flow: "register", contentType: "application/json", code: 404, expected: `"details":"Please contact IT to request an account"`},
+		{flow: "mfa", contentType: "text/html", code: 404, expected: "Unsupported Feature"},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, flow: %s, content type: %s", i, test.flow, test.contentType)
+		uiFactory := ui.NewUserInterfaceFactory()
+		if err := uiFactory.AddBuiltinTemplate("basic/generic"); err != nil {
+			t.Fatalf("failed loading generic template: %s", err)
+		}
+		uiFactory.Templates["generic"] = uiFactory.Templates["basic/generic"]
+		r := httptest.NewRequest("GET", "/auth/"+test.flow, nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":            "abc",
+			"logger":                utils.NewLogger(),
+			"ui":                    uiFactory,
+			"auth_url_path":         "/auth",
+			"authenticated":         false,
+			"content_type":          test.contentType,
+			"unsupported_responses": responses,
+		}
+		if err := ServeUnsupported(w, r, opts, test.flow); err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Logf("FAIL: %s, code: %d, location: %q", testDescr, w.Code, w.Header().Get("Location"))
+			testFailed++
+			continue
+		}
+		if !strings.Contains(w.Body.String(), test.expected) {
+			t.Logf("FAIL: %s, body has no %q: %s", testDescr, test.expected, w.Body.String())
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	jwtvalidator "github.com/greenpau/caddy-auth-jwt/pkg/validator"
+	"github.com/greenpau/caddy-auth-portal/pkg/introspection"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// ServeIntrospect returns the active status and the claims of the token
+// submitted by a downstream service, see RFC 7662. The service
+// authenticates with its client credentials via HTTP Basic authentication.
+func ServeIntrospect(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	cfg := opts["introspection"].(*introspection.Introspection)
+	validator := opts["token_validator"].(*jwtvalidator.TokenValidator)
+
+	if !cfg.Enabled() {
+		return writeIntrospectError(w, http.StatusNotFound, "not_found")
+	}
+
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return writeIntrospectError(w, http.StatusMethodNotAllowed, "invalid_request")
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || !cfg.Authenticate(clientID, clientSecret) {
+		log.Warn("Token introspection client authentication failed",
+			zap.String("request_id", reqID),
+			zap.String("client_id", clientID),
+			zap.String("src_ip_address", utils.GetSourceAddress(r)),
+		)
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+		return writeIntrospectError(w, http.StatusUnauthorized, "invalid_client")
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return writeIntrospectError(w, http.StatusBadRequest, "invalid_request")
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		return writeIntrospectError(w, http.StatusBadRequest, "invalid_request")
+	}
+
+	resp := map[string]interface{}{
+		"active": false,
+	}
+	claims, valid, err := validator.ValidateToken(token, jwtconfig.NewTokenValidatorOptions())
+	if valid {
+		if err = checkIssuedToken(opts, claims); err != nil {
+			valid = false
+		}
+	}
+	if valid {
+		b, err := json.Marshal(claims)
+		if err != nil {
+			log.Error("Failed JSON claims rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
+			return writeIntrospectError(w, http.StatusInternalServerError, "server_error")
+		}
+		if err := json.Unmarshal(b, &resp); err != nil {
+			log.Error("Failed JSON claims rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
+			return writeIntrospectError(w, http.StatusInternalServerError, "server_error")
+		}
+		if customClaims, err := GetCustomClaims(token); err == nil {
+			addCustomClaims(resp, customClaims)
+		}
+		if len(claims.Scopes) > 0 {
+			resp["scope"] = strings.Join(claims.Scopes, " ")
+		}
+		resp["active"] = true
+		resp["token_type"] = "Bearer"
+	} else if err != nil {
+		log.Debug("Token introspection found inactive token",
+			zap.String("request_id", reqID),
+			zap.String("client_id", clientID),
+			zap.String("error", err.Error()),
+		)
+	}
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.Error("Failed JSON response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
+		return writeIntrospectError(w, http.StatusInternalServerError, "server_error")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+	return nil
+}
+
+func writeIntrospectError(w http.ResponseWriter, statusCode int, code string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(`{"error":"` + code + `"}`))
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jwtacl "github.com/greenpau/caddy-auth-jwt/pkg/acl"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	jwtvalidator "github.com/greenpau/caddy-auth-jwt/pkg/validator"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/introspection"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeIntrospect(t *testing.T) {
+	testFailed := 0
+	secret := "75f03764-147c-4d87-b2f0-4fda89e331c8"
+	tokenConfig := jwtconfig.NewCommonTokenConfig()
+	tokenConfig.TokenSecret = secret
+	validator := jwtvalidator.NewTokenValidator()
+	validator.TokenConfigs = []*jwtconfig.CommonTokenConfig{tokenConfig}
+	if err := validator.ConfigureTokenBackends(); err != nil {
+		t.Fatalf("failed configuring token validator: %s", err)
+	}
+	entry := jwtacl.NewAccessListEntry()
+	entry.Allow()
+	entry.SetClaim("roles")
+	entry.AddValue("*")
+	validator.AccessList = append(validator.AccessList, entry)
+
+	claims := &jwtclaims.UserClaims{
+		Subject:   "jsmith",
+		Email:     "jsmith@contoso.com",
+		Roles:     []string{"viewer"},
+		ID:        "a1b2c3",
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+	validToken, err := claims.GetToken("HS512", []byte(secret))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	foreignToken, err := claims.GetToken("HS512", []byte("foreign"))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	oldClaims := *claims
+	oldClaims.IssuedAt = time.Now().Add(-2 * time.Hour).Unix()
+	oldToken, err := oldClaims.GetToken("HS512", []byte(secret))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	revokedClaims := *claims
+	revokedClaims.ID = "d4e5f6"
+	revokedToken, err := revokedClaims.GetToken("HS512", []byte(secret))
+	if err != nil {
+		t.Fatalf("failed generating token: %s", err)
+	}
+	sessionCache := cache.NewSessionCache()
+	sessionCache.Revoke(revokedClaims.ID, time.Now().Add(time.Hour))
+
+	cfg := &introspection.Introspection{
+		Clients: []*introspection.Client{
+			{ID: "svc", Secret: "svc-secret"},
+		},
+	}
+
+	tests := []struct {
+		method       string
+		clientID     string
+		clientSecret string
+		token        string
+		statusCode   int
+		active       bool
+	}{
+		{method: "GET", clientID: "svc", clientSecret: "svc-secret", token: validToken, statusCode: 405},
+		{method: "POST", clientID: "svc", clientSecret: "wrong", token: validToken, statusCode: 401},
+		{method: "POST", clientID: "svc", clientSecret: "svc-secret", token: "", statusCode: 400},
+		{method: "POST", clientID: "svc", clientSecret: "svc-secret", token: foreignToken, statusCode: 200},
+		{method: "POST", clientID: "svc", clientSecret: "svc-secret", token: oldToken, statusCode: 200},
+		{method: "POST", clientID: "svc", clientSecret: "svc-secret", token: revokedToken, statusCode: 200},
+		{method: "POST", clientID: "svc", clientSecret: "svc-secret", token: validToken, statusCode: 200, active: true},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, method: %s, client: %s", i, test.method, test.clientID)
+		form := url.Values{}
+		if test.token != "" {
+			form.Set("token", test.token)
+		}
+		r := httptest.NewRequest(test.method, "/auth/introspect", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth(test.clientID, test.clientSecret)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":      "abc",
+			"logger":          utils.NewLogger(),
+			"introspection":   cfg,
+			"token_validator": validator,
+			"max_token_age":   3600,
+			"session_cache":   sessionCache,
+		}
+		ServeIntrospect(w, r, opts)
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received)", testDescr, test.statusCode, w.Code)
+			testFailed++
+			continue
+		}
+		if w.Code != 200 {
+			t.Logf("PASS: %s", testDescr)
+			continue
+		}
+		resp := make(map[string]interface{})
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Logf("FAIL: %s, failed parsing response: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if resp["active"] != test.active {
+			t.Logf("FAIL: %s, active: %t (expected) vs. %v (received)", testDescr, test.active, resp["active"])
+			testFailed++
+			continue
+		}
+		if test.active && (resp["sub"] != "jsmith" || resp["email"] != "jsmith@contoso.com") {
+			t.Logf("FAIL: %s, claims mismatch: %v", testDescr, resp)
+			testFailed++
+			continue
+		}
+		if !test.active && len(resp) != 1 {
+			t.Logf("FAIL: %s, inactive response has claims: %v", testDescr, resp)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
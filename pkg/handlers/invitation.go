@@ -0,0 +1,120 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/registration"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"go.uber.org/zap"
+)
+
+// ServeInvitation creates a registration invitation. The users having
+// one of the invitation admin roles submit a JSON object with optional
+// email, roles, and realm fields. The response has the invitation token
+// and the URL of the registration page.
+func ServeInvitation(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	authURLPath := opts["auth_url_path"].(string)
+	cfg := opts["registration"].(*registration.Registration)
+
+	if cfg.Invitations == nil {
+		return writeInvitationError(w, http.StatusNotFound, "not_found")
+	}
+
+	if !opts["authenticated"].(bool) {
+		return writeInvitationError(w, http.StatusUnauthorized, "unauthorized")
+	}
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	if !cfg.IsInvitationAdmin(claims.Roles) {
+		log.Warn("Invitation creation denied",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("src_ip_address", utils.GetSourceAddress(r)),
+		)
+		return writeInvitationError(w, http.StatusForbidden, "forbidden")
+	}
+
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return writeInvitationError(w, http.StatusMethodNotAllowed, "invalid_request")
+	}
+	// The JSON content type protects the endpoint from cross-site form
+	// submissions.
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return writeInvitationError(w, http.StatusUnsupportedMediaType, "invalid_request")
+	}
+
+	invitation := &registration.Invitation{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(invitation); err != nil {
+		return writeInvitationError(w, http.StatusBadRequest, "invalid_request")
+	}
+	if invitation.Email != "" {
+		if err := validators.ValidateUserInput("email", invitation.Email, make(map[string]interface{})); err != nil {
+			return writeInvitationError(w, http.StatusBadRequest, "invalid_email")
+		}
+	}
+	if invitation.Realm != "" && cfg.ForRealm(invitation.Realm) == nil {
+		return writeInvitationError(w, http.StatusBadRequest, "invalid_realm")
+	}
+	invitation.CreatedBy = claims.Subject
+	if err := cfg.Invitations.Add(invitation, cfg.InvitationLifetime); err != nil {
+		log.Error("Failed creating invitation", zap.String("request_id", reqID), zap.String("error", err.Error()))
+		return writeInvitationError(w, http.StatusInternalServerError, "server_error")
+	}
+	log.Info("Created registration invitation",
+		zap.String("request_id", reqID),
+		zap.String("user", claims.Subject),
+		zap.String("email", invitation.Email),
+		zap.Strings("roles", invitation.Roles),
+		zap.String("realm", invitation.Realm),
+		zap.Time("expires_at", invitation.ExpiresAt),
+	)
+
+	resp := map[string]interface{}{
+		"invitation": invitation,
+	}
+	// The URL is built from the configured base URL only, because the
+	// clients control the host headers of the requests.
+	if baseURL, _ := opts["link_base_url"].(string); baseURL != "" {
+		resp["url"] = baseURL + path.Join(authURLPath, "register", invitation.Realm) + "?invitation=" + invitation.Token
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.Error("Failed JSON response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
+		return writeInvitationError(w, http.StatusInternalServerError, "server_error")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(payload)
+	return nil
+}
+
+func writeInvitationError(w http.ResponseWriter, statusCode int, code string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(`{"error":"` + code + `"}`))
+	return nil
+}
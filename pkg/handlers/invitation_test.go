@@ -0,0 +1,101 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/registration"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeInvitation(t *testing.T) {
+	testFailed := 0
+	cfg := &registration.Registration{
+		Dropbox:              "registrations.json",
+		RequireInvitation:    true,
+		InvitationLifetime:   60,
+		InvitationAdminRoles: []string{"admin"},
+		Invitations:          registration.NewInvitationStore(),
+	}
+	tests := []struct {
+		roles       []string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{statusCode: 401},
+		{roles: []string{"viewer"}, contentType: "application/json", body: `{}`, statusCode: 403},
+		{roles: []string{"admin"}, contentType: "application/x-www-form-urlencoded", body: `email=jsmith%40contoso.com`, statusCode: 415},
+		{roles: []string{"admin"}, contentType: "application/json", body: `{"email": "jsmith"}`, statusCode: 400},
+		{roles: []string{"admin"}, contentType: "application/json", body: `{"realm": "partners"}`, statusCode: 400},
+		{roles: []string{"admin"}, contentType: "application/json", body: `{"email": "jsmith@contoso.com", "roles": ["editor"]}`, statusCode: 201},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, roles: %v, body: %s", i, test.roles, test.body)
+		r := httptest.NewRequest("POST", "/auth/invitation", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		r.Header.Set("X-Forwarded-Host", "evil.example")
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":    "abc",
+			"logger":        utils.NewLogger(),
+			"auth_url_path": "/auth",
+			"link_base_url": "https://auth.contoso.com",
+			"authenticated": test.roles != nil,
+			"registration":  cfg,
+		}
+		if test.roles != nil {
+			opts["user_claims"] = &jwtclaims.UserClaims{Subject: "webadmin", Roles: test.roles}
+		}
+		ServeInvitation(w, r, opts)
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received)", testDescr, test.statusCode, w.Code)
+			testFailed++
+			continue
+		}
+		if w.Code == 201 {
+			resp := struct {
+				Invitation *registration.Invitation `json:"invitation"`
+				URL        string                   `json:"url"`
+			}{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Logf("FAIL: %s, failed parsing response: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			if _, err := cfg.Invitations.Get(resp.Invitation.Token); err != nil {
+				t.Logf("FAIL: %s, invitation not stored: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			if resp.URL != "https://auth.contoso.com/auth/register?invitation="+resp.Invitation.Token {
+				t.Logf("FAIL: %s, unexpected url: %s", testDescr, resp.URL)
+				testFailed++
+				continue
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/signing"
+)
+
+// ServeJWKS returns the public keys verifying the tokens issued by the
+// portal. The realm query parameter limits the keys to the ones of the
+// realm.
+func ServeJWKS(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	keyring := opts["signing_keyring"].(*signing.Keyring)
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+	b, err := json.Marshal(keyring.GetKeySet(r.URL.Query().Get("realm")))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+	return nil
+}
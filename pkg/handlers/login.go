@@ -15,7 +15,6 @@
 package handlers
 
 import (
-	"crypto/rsa"
 	"encoding/json"
 	"net/http"
 	"net/url"
@@ -24,7 +23,11 @@ import (
 	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
 	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
 
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
 	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/dpop"
+	"github.com/greenpau/caddy-auth-portal/pkg/passthrough"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
 	"github.com/greenpau/caddy-auth-portal/pkg/utils"
 	"go.uber.org/zap"
@@ -39,6 +42,9 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 	authURLPath := opts["auth_url_path"].(string)
 
 	tokenProvider := opts["token_provider"].(*jwtconfig.CommonTokenConfig)
+	if v, exists := opts["auth_realm"]; exists {
+		tokenProvider = getRealmTokenProvider(opts, v.(string))
+	}
 
 	cookies := opts["cookies"].(*cookies.Cookies)
 	redirectToToken := opts["redirect_token_name"].(string)
@@ -54,8 +60,8 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 
 	// Remove tokens when authentication failed
 	if opts["auth_credentials_found"].(bool) && !opts["authenticated"].(bool) {
-		for _, k := range []string{tokenProvider.TokenName} {
-			w.Header().Add("Set-Cookie", k+"=delete;"+cookies.GetDeleteAttributes()+" expires=Thu, 01 Jan 1970 00:00:00 GMT")
+		for _, k := range opts["token_cookie_names"].([]string) {
+			w.Header().Add("Set-Cookie", k+"=delete;"+cookies.GetDeleteAttributes())
 		}
 	}
 
@@ -63,28 +69,79 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Pragma", "no-cache")
 
+	// Bind the token to the key of the client presenting a DPoP proof.
+	var dpopThumbprint string
+	if opts["authenticated"].(bool) && !authorized {
+		if v, exists := opts["dpop"]; exists && dpop.HasProof(r) {
+			proof, err := v.(*dpop.Config).Verify(r, "")
+			if err != nil {
+				opts["status_code"] = 400
+				opts["authenticated"] = false
+				opts["message"] = "Invalid DPoP proof"
+				log.Warn(
+					"dpop proof validation failed",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+			} else {
+				dpopThumbprint = proof.Thumbprint
+			}
+		}
+	}
+
 	// Create JWT token
 	if opts["authenticated"].(bool) && !authorized {
 		claims := opts["user_claims"].(*jwtclaims.UserClaims)
 		claims.Issuer = utils.GetCurrentURL(r)
 		claims.IssuedAt = time.Now().Unix()
+		var customClaims map[string]interface{}
+		if v, exists := opts["custom_claims"]; exists {
+			customClaims = v.(map[string]interface{})
+		}
+		// The claim-based cookie lifetime overrides the token expiry
+		// to keep them consistent.
+		cookieLifetime := cookies.GetLifetime(claims, customClaims)
+		if cookieLifetime > 0 {
+			claims.ExpiresAt = claims.IssuedAt + int64(cookieLifetime)
+		}
+		if dpopThumbprint != "" {
+			boundClaims := map[string]interface{}{
+				"cnf": map[string]interface{}{"jkt": dpopThumbprint},
+			}
+			for k, v := range customClaims {
+				if k == "cnf" {
+					continue
+				}
+				boundClaims[k] = v
+			}
+			customClaims = boundClaims
+		}
+		if v, exists := opts["amr"]; exists && opts["amr_claim"] != nil {
+			claimName := opts["amr_claim"].(string)
+			amrClaims := map[string]interface{}{
+				claimName: v,
+			}
+			for k, v := range customClaims {
+				if k == claimName {
+					continue
+				}
+				amrClaims[k] = v
+			}
+			customClaims = amrClaims
+		}
 		var userToken string
 		var tokenError error
 		switch tokenProvider.TokenSignMethod {
-		case "HS512", "HS384", "HS256":
-			userToken, tokenError = claims.GetToken(tokenProvider.TokenSignMethod, []byte(tokenProvider.TokenSecret))
-		case "RS512", "RS384", "RS256":
-			var privKey *rsa.PrivateKey
-			var keyID string
-			privKey, keyID, tokenError = tokenProvider.GetPrivateKey()
-			if tokenError == nil {
-				tokenOpts := make(map[string]interface{})
-				tokenOpts["method"] = tokenProvider.TokenSignMethod
-				if keyID != "" {
-					tokenOpts["kid"] = keyID
-				}
-				tokenOpts["private_key"] = privKey
-				userToken, tokenError = claims.GetSignedToken(tokenOpts)
+		case "HS512", "HS384", "HS256", "RS512", "RS384", "RS256":
+			var trimmedClaims []string
+			userToken, trimmedClaims, tokenError = newSizedUserToken(cookies, tokenProvider, claims, customClaims)
+			if len(trimmedClaims) > 0 {
+				log.Warn(
+					"trimmed claims of oversized token",
+					zap.String("request_id", reqID),
+					zap.String("user", claims.Subject),
+					zap.Strings("claims", trimmedClaims),
+				)
 			}
 		default:
 			opts["status_code"] = 500
@@ -96,7 +153,17 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 				zap.String("token_sign_method", tokenProvider.TokenSignMethod),
 			)
 		}
-		if tokenError != nil {
+		if _, oversized := tokenError.(*tokenSizeError); oversized {
+			opts["status_code"] = 500
+			opts["authenticated"] = false
+			opts["message"] = "The session token is too large, please contact the administrator"
+			log.Error(
+				"token size limit exceeded",
+				zap.String("request_id", reqID),
+				zap.String("user", claims.Subject),
+				zap.String("error", tokenError.Error()),
+			)
+		} else if tokenError != nil {
 			opts["status_code"] = 500
 			opts["authenticated"] = false
 			opts["message"] = "Internal Server Error"
@@ -108,34 +175,88 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 		} else {
 			if opts["authenticated"].(bool) {
 				opts["user_token"] = userToken
-				w.Header().Set("Authorization", "Bearer "+userToken)
-				w.Header().Set("Set-Cookie", tokenProvider.TokenName+"="+userToken+";"+cookies.GetAttributes())
+				if dpopThumbprint != "" {
+					opts["token_type"] = "DPoP"
+					w.Header().Set("Authorization", "DPoP "+userToken)
+				} else {
+					w.Header().Set("Authorization", "Bearer "+userToken)
+				}
+				if cookieLifetime == 0 && cookies.Expiry != "" && !cookies.IsSessionOnly() {
+					cookieLifetime = int(claims.ExpiresAt - claims.IssuedAt)
+				}
+				var authRealm string
+				if v, exists := opts["auth_realm"]; exists {
+					authRealm = v.(string)
+				}
+				tokenName := cookies.GetTokenName(tokenProvider.TokenName, authRealm)
+				if cookieLifetime > 0 {
+					w.Header().Add("Set-Cookie", tokenName+"="+userToken+";"+cookies.GetAttributesWithLifetime(cookieLifetime))
+				} else {
+					w.Header().Add("Set-Cookie", tokenName+"="+userToken+";"+cookies.GetAttributes())
+				}
 			}
 		}
 	}
 
+	if opts["authenticated"].(bool) {
+		resetRedirectCount(w, r, opts)
+	}
+
 	// If the requested content type is JSON, then handle it separately.
 	if opts["content_type"].(string) == "application/json" {
 		return ServeAPILogin(w, r, opts)
 	}
 
-	// Follow redirect URL when authenticated.
+	// Follow redirect URL when authenticated. The external providers
+	// return the redirect URL preserved across the round trip, in case
+	// the browser did not send the redirect cookie.
 	if opts["authenticated"].(bool) {
+		var redirectValue string
 		if cookie, err := r.Cookie(redirectToToken); err == nil {
-			if redirectURL, err := url.Parse(cookie.Value); err == nil {
+			redirectValue = cookie.Value
+		} else if v, exists := opts["login_redirect_url"]; exists {
+			redirectValue = v.(string)
+		}
+		if redirectValue != "" {
+			if redirectURL, err := getRedirectURL(cookies, redirectValue); err != nil {
+				log.Warn(
+					"rejected cookie-based redirect",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+				w.Header().Add("Set-Cookie", redirectToToken+"=delete;"+cookies.GetDeleteAttributes())
+			} else {
 				log.Debug(
 					"detected cookie-based redirect",
 					zap.String("request_id", reqID),
 					zap.String("redirect_url", redirectURL.String()),
 				)
-				w.Header().Set("Location", redirectURL.String())
-				w.Header().Add("Set-Cookie", redirectToToken+"=delete;"+cookies.GetDeleteAttributes()+" expires=Thu, 01 Jan 1970 00:00:00 GMT")
+				location := redirectURL.String()
+				if v, exists := opts["redirect_passthrough"]; exists {
+					if passthroughURL, err := applyRedirectPassthrough(v.(*passthrough.Config), redirectURL, opts); err != nil {
+						log.Warn(
+							"skipped redirect claims passthrough",
+							zap.String("request_id", reqID),
+							zap.String("error", err.Error()),
+						)
+					} else {
+						location = passthroughURL
+					}
+				}
+				w.Header().Set("Location", location)
+				w.Header().Add("Set-Cookie", redirectToToken+"=delete;"+cookies.GetDeleteAttributes())
 				w.WriteHeader(302)
 				return nil
 			}
 		}
 	}
 
+	// Render the success page, instead of redirecting to portal,
+	// upon login.
+	if opts["authenticated"].(bool) && !authorized && uiFactory.LoginSuccessPage {
+		return serveLoginSuccess(w, r, opts)
+	}
+
 	// If authenticated, redirect to portal.
 	if opts["authenticated"].(bool) {
 		w.Header().Set("Location", path.Join(authURLPath, "portal"))
@@ -143,6 +264,21 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 		return nil
 	}
 
+	// Redirect to the external provider when it is the only way to
+	// log in, unless the user opted out, e.g. for troubleshooting.
+	if uiFactory.SingleProviderRedirect {
+		if endpoint := getSingleProviderEndpoint(r, opts); endpoint != "" {
+			log.Debug(
+				"redirecting to single external provider",
+				zap.String("request_id", reqID),
+				zap.String("endpoint", endpoint),
+			)
+			w.Header().Set("Location", endpoint)
+			w.WriteHeader(302)
+			return nil
+		}
+	}
+
 	// Display login page
 	resp := uiFactory.GetArgs()
 	if title, exists := opts["ui_title"]; exists {
@@ -156,13 +292,12 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 	}
 
 	resp.Data["login_options"] = opts["login_options"]
+	if hint := uiFactory.GetLoginHint(r); hint != "" {
+		resp.Data["login_hint"] = hint
+	}
 	content, err := uiFactory.Render("login", resp)
 	if err != nil {
-		log.Error("Failed HTML response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(500)
-		w.Write([]byte(`Internal Server Error`))
-		return err
+		return serveFallback(w, opts, "login", err)
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -171,6 +306,44 @@ func ServeLogin(w http.ResponseWriter, r *http.Request, opts map[string]interfac
 	return nil
 }
 
+// applyRedirectPassthrough returns the redirect URL with the claims of
+// the authenticated user appended.
+func applyRedirectPassthrough(cfg *passthrough.Config, redirectURL *url.URL, opts map[string]interface{}) (string, error) {
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	var token, realm string
+	if v, exists := opts["user_token"]; exists {
+		token = v.(string)
+	}
+	if v, exists := opts["auth_realm"]; exists {
+		realm = v.(string)
+	} else {
+		realm = claims.Origin
+	}
+	return cfg.Apply(redirectURL, claims, token, realm)
+}
+
+// getSingleProviderEndpoint returns the endpoint of the external
+// provider when it is the only way to log in. It returns an empty
+// string when the login page has other options, reports a failure, or
+// the request carries the auto_redirect=no query parameter.
+func getSingleProviderEndpoint(r *http.Request, opts map[string]interface{}) string {
+	if r.Method != "GET" || r.URL.Query().Get("auto_redirect") == "no" {
+		return ""
+	}
+	if _, exists := opts["message"]; exists || opts["status_code"].(int) != 200 {
+		return ""
+	}
+	loginOptions, ok := opts["login_options"].(map[string]interface{})
+	if !ok || loginOptions["form_required"] == "yes" {
+		return ""
+	}
+	providers, ok := loginOptions["external_providers"].([]map[string]string)
+	if !ok || len(providers) != 1 {
+		return ""
+	}
+	return providers[0]["endpoint"]
+}
+
 // ServeAPILogin returns authentication response in JSON format.
 func ServeAPILogin(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
 	reqID := opts["request_id"].(string)
@@ -180,6 +353,22 @@ func ServeAPILogin(w http.ResponseWriter, r *http.Request, opts map[string]inter
 		resp["authenticated"] = true
 		tokenProvider := opts["token_provider"].(*jwtconfig.CommonTokenConfig)
 		resp[tokenProvider.TokenName] = opts["user_token"].(string)
+		if v, exists := opts["token_type"]; exists {
+			resp["token_type"] = v
+		}
+		if v, exists := opts["session_handles"]; exists {
+			claims := opts["user_claims"].(*jwtclaims.UserClaims)
+			sessionCache := opts["session_cache"].(*cache.SessionCache)
+			handle, err := v.(*sessions.Handles).Create(sessionCache, claims.ID, opts["user_token"].(string), time.Unix(claims.ExpiresAt, 0))
+			if err != nil {
+				log.Error("Failed creating session handle", zap.String("request_id", reqID), zap.String("error", err.Error()))
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(500)
+				w.Write([]byte(`Internal Server Error`))
+				return err
+			}
+			resp["session_handle"] = handle
+		}
 	} else {
 		resp["authenticated"] = false
 		if opts["auth_credentials_found"].(bool) {
@@ -192,6 +381,12 @@ func ServeAPILogin(w http.ResponseWriter, r *http.Request, opts map[string]inter
 		} else {
 			resp["message"] = "authentication credentials required"
 		}
+		if opts["status_code"].(int) == 401 {
+			message, _ := resp["message"].(string)
+			if writeUnauthorizedBody(w, r, opts, "Authentication Failed", message) {
+				return nil
+			}
+		}
 	}
 	payload, err := json.Marshal(resp)
 	if err != nil {
@@ -0,0 +1,283 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeLoginSuccessPage(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		successPage    bool
+		redirectURL    string
+		redirectSecret string
+		signed         bool
+		code           int
+		location       string
+	}{
+		{successPage: false, code: 302, location: "/auth/portal"},
+		{successPage: true, code: 200},
+		{successPage: true, redirectURL: "https://app.contoso.com/", code: 302, location: "https://app.contoso.com/"},
+		{redirectURL: "https://app.contoso.com/", redirectSecret: "0123456789abcdef", signed: true, code: 302, location: "https://app.contoso.com/"},
+		{redirectURL: "https://evil.com/", redirectSecret: "0123456789abcdef", code: 302, location: "/auth/portal"},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, success page: %t, redirect url: %q", i, test.successPage, test.redirectURL)
+		uiFactory := ui.NewUserInterfaceFactory()
+		if err := uiFactory.AddBuiltinTemplate("basic/login_success"); err != nil {
+			t.Fatalf("failed loading login success template: %s", err)
+		}
+		uiFactory.Templates["login_success"] = uiFactory.Templates["basic/login_success"]
+		uiFactory.LoginSuccessPage = test.successPage
+		tokenProvider := jwtconfig.NewCommonTokenConfig()
+		tokenProvider.TokenSignMethod = "HS512"
+		tokenProvider.TokenSecret = "75f03764-147c-4d87-b2f0-4fda89e331c8"
+
+		cookieConfig := &cookies.Cookies{RedirectSecret: test.redirectSecret}
+		r := httptest.NewRequest("POST", "/auth/login", nil)
+		if test.redirectURL != "" {
+			cookieValue := test.redirectURL
+			if test.signed {
+				cookieValue = cookieConfig.SignRedirectURL(test.redirectURL)
+			}
+			r.AddCookie(&http.Cookie{Name: "AUTH_PORTAL_REDIRECT_URL", Value: cookieValue})
+		}
+		r.AddCookie(&http.Cookie{Name: "AUTH_PORTAL_REDIRECT_COUNT", Value: "3"})
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":                "abc",
+			"logger":                    utils.NewLogger(),
+			"ui":                        uiFactory,
+			"auth_url_path":             "/auth",
+			"token_provider":            tokenProvider,
+			"cookies":                   cookieConfig,
+			"redirect_token_name":       "AUTH_PORTAL_REDIRECT_URL",
+			"redirect_count_token_name": "AUTH_PORTAL_REDIRECT_COUNT",
+			"auth_credentials_found":    true,
+			"authenticated":             true,
+			"content_type":              "text/html",
+			"user_claims": &jwtclaims.UserClaims{
+				Subject: "jsmith",
+				Name:    "<b>John Smith</b>",
+				Email:   "jsmith@contoso.com",
+			},
+		}
+		if err := ServeLogin(w, r, opts); err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if w.Code != test.code {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received)", testDescr, test.code, w.Code)
+			testFailed++
+			continue
+		}
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Logf("FAIL: %s, location: %q (expected) vs. %q (received)", testDescr, test.location, location)
+			testFailed++
+			continue
+		}
+		if !strings.Contains(strings.Join(w.Header()["Set-Cookie"], "\n"), "AUTH_PORTAL_REDIRECT_COUNT=delete;") {
+			t.Logf("FAIL: %s, redirect count cookie was not deleted: %v", testDescr, w.Header()["Set-Cookie"])
+			testFailed++
+			continue
+		}
+		if test.code == 200 {
+			body := w.Body.String()
+			if !strings.Contains(body, "&lt;b&gt;John Smith&lt;/b&gt;") || !strings.Contains(body, `href="/auth/portal"`) {
+				t.Logf("FAIL: %s, unexpected body: %s", testDescr, body)
+				testFailed++
+				continue
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestServeLoginAmrClaim(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		claimName string
+		amr       []string
+		expected  interface{}
+	}{
+		{amr: []string{"pwd"}},
+		{claimName: "amr", expected: nil},
+		{claimName: "amr", amr: []string{"pwd"}, expected: []interface{}{"pwd"}},
+		{claimName: "auth_methods", amr: []string{"pwd", "otp", "mfa"}, expected: []interface{}{"pwd", "otp", "mfa"}},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, claim: %q, amr: %v", i, test.claimName, test.amr)
+		tokenProvider := jwtconfig.NewCommonTokenConfig()
+		tokenProvider.TokenSignMethod = "HS512"
+		tokenProvider.TokenSecret = "75f03764-147c-4d87-b2f0-4fda89e331c8"
+		r := httptest.NewRequest("POST", "/auth/login", nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":             "abc",
+			"logger":                 utils.NewLogger(),
+			"ui":                     ui.NewUserInterfaceFactory(),
+			"auth_url_path":          "/auth",
+			"token_provider":         tokenProvider,
+			"cookies":                &cookies.Cookies{},
+			"redirect_token_name":    "AUTH_PORTAL_REDIRECT_URL",
+			"auth_credentials_found": true,
+			"authenticated":          true,
+			"content_type":           "text/html",
+			"user_claims": &jwtclaims.UserClaims{
+				Subject: "jsmith",
+				Email:   "jsmith@contoso.com",
+			},
+		}
+		if test.claimName != "" {
+			opts["amr_claim"] = test.claimName
+		}
+		if test.amr != nil {
+			opts["amr"] = test.amr
+		}
+		if err := ServeLogin(w, r, opts); err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		var userToken string
+		for _, c := range w.Result().Cookies() {
+			if c.Name == tokenProvider.TokenName {
+				userToken = c.Value
+			}
+		}
+		token, err := jwtlib.Parse(userToken, func(token *jwtlib.Token) (interface{}, error) {
+			return []byte(tokenProvider.TokenSecret), nil
+		})
+		if err != nil {
+			t.Logf("FAIL: %s, failed parsing token: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		tokenClaims := token.Claims.(jwtlib.MapClaims)
+		if test.claimName == "" {
+			if _, exists := tokenClaims["amr"]; exists {
+				t.Logf("FAIL: %s, unexpected amr claim: %v", testDescr, tokenClaims["amr"])
+				testFailed++
+				continue
+			}
+		} else if !reflect.DeepEqual(tokenClaims[test.claimName], test.expected) {
+			t.Logf("FAIL: %s, %s claim mismatch: %v (expected) vs. %v (received)", testDescr, test.claimName, test.expected, tokenClaims[test.claimName])
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestServeLoginSingleProviderRedirect(t *testing.T) {
+	testFailed := 0
+	provider := map[string]string{"endpoint": "/auth/oauth2/contoso", "realm": "contoso"}
+	tests := []struct {
+		enabled   bool
+		url       string
+		formFound bool
+		providers []map[string]string
+		message   string
+		location  string
+	}{
+		{url: "/auth/login", providers: []map[string]string{provider}},
+		{enabled: true, url: "/auth/login", providers: []map[string]string{provider}, location: "/auth/oauth2/contoso"},
+		{enabled: true, url: "/auth/login?auto_redirect=no", providers: []map[string]string{provider}},
+		{enabled: true, url: "/auth/login", formFound: true, providers: []map[string]string{provider}},
+		{enabled: true, url: "/auth/login", providers: []map[string]string{provider, provider}},
+		{enabled: true, url: "/auth/login", providers: []map[string]string{provider}, message: "Authentication failed"},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, enabled: %t, url: %s, form: %t, providers: %d", i, test.enabled, test.url, test.formFound, len(test.providers))
+		uiFactory := ui.NewUserInterfaceFactory()
+		if err := uiFactory.AddBuiltinTemplate("basic/login"); err != nil {
+			t.Fatalf("failed loading login template: %s", err)
+		}
+		uiFactory.Templates["login"] = uiFactory.Templates["basic/login"]
+		uiFactory.SingleProviderRedirect = test.enabled
+		tokenProvider := jwtconfig.NewCommonTokenConfig()
+		loginOptions := map[string]interface{}{
+			"form_required":               "no",
+			"realm_dropdown_required":     "no",
+			"username_required":           "no",
+			"password_required":           "no",
+			"external_providers_required": "yes",
+			"external_providers":          test.providers,
+			"registration_required":       "no",
+			"password_recovery_required":  "no",
+		}
+		if test.formFound {
+			loginOptions["form_required"] = "yes"
+		}
+		r := httptest.NewRequest("GET", test.url, nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":             "abc",
+			"logger":                 utils.NewLogger(),
+			"ui":                     uiFactory,
+			"auth_url_path":          "/auth",
+			"token_provider":         tokenProvider,
+			"cookies":                &cookies.Cookies{},
+			"redirect_token_name":    "AUTH_PORTAL_REDIRECT_URL",
+			"auth_credentials_found": false,
+			"authenticated":          false,
+			"content_type":           "text/html",
+			"login_options":          loginOptions,
+		}
+		if test.message != "" {
+			opts["message"] = test.message
+		}
+		if err := ServeLogin(w, r, opts); err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Logf("FAIL: %s, location: %q (expected) vs. %q (received)", testDescr, test.location, location)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
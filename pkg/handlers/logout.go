@@ -15,9 +15,12 @@
 package handlers
 
 import (
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
 	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
 	"go.uber.org/zap"
 	"net/http"
+	"time"
 )
 
 // ServeSessionLogoff performs session logout sequence.
@@ -32,10 +35,21 @@ func ServeSessionLogoff(w http.ResponseWriter, r *http.Request, opts map[string]
 		zap.String("request_id", reqID),
 	)
 
+	if v, exists := opts["session_id"]; exists {
+		sessionCache := opts["session_cache"].(*cache.SessionCache)
+		claims := opts["user_claims"].(*jwtclaims.UserClaims)
+		sessionCache.Revoke(v.(string), time.Unix(claims.ExpiresAt, 0))
+	}
+
 	for _, cookieName := range cookieNames {
-		w.Header().Add("Set-Cookie", cookieName+"=delete;"+cookies.GetDeleteAttributes()+" expires=Thu, 01 Jan 1970 00:00:00 GMT")
+		w.Header().Add("Set-Cookie", cookieName+"=delete;"+cookies.GetDeleteAttributes())
 	}
-	if v, exists := opts["redirect_url"]; exists {
+	if v, exists := opts["logout_url"]; exists {
+		log.Debug("redirecting to provider logout",
+			zap.String("request_id", reqID),
+		)
+		w.Header().Set("Location", v.(string))
+	} else if v, exists := opts["redirect_url"]; exists {
 		w.Header().Set("Location", authURLPath+"?redirect_url="+v.(string))
 	} else {
 		w.Header().Set("Location", authURLPath)
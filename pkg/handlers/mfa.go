@@ -0,0 +1,321 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/events"
+	"github.com/greenpau/caddy-auth-portal/pkg/mfa"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+)
+
+// ServeMFA returns the multi-factor authentication page of the login
+// flow. A user enrolled in more than one method chooses the method,
+// and then provides the code of the method. When the code is valid,
+// the pending session of the user is promoted and the user receives
+// a token.
+func ServeMFA(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	authURLPath := opts["auth_url_path"].(string)
+	cfg := opts["mfa"].(*mfa.Config)
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+	sessionTokenName := opts["mfa_token_name"].(string)
+	cookies := opts["cookies"].(*cookies.Cookies)
+
+	// Add non-caching headers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if opts["authenticated"].(bool) {
+		w.Header().Set("Location", authURLPath)
+		w.WriteHeader(302)
+		return nil
+	}
+
+	if opts["content_type"].(string) == "application/json" {
+		return ServeUnsupported(w, r, opts, "mfa")
+	}
+
+	var session map[string]interface{}
+	var sessionID string
+	if v, exists := opts["mfa_session"]; exists {
+		session = v.(map[string]interface{})
+		sessionID = opts["mfa_session_id"].(string)
+		if session["expires_at"].(time.Time).Before(time.Now()) {
+			sessionCache.Delete(sessionID)
+			session = nil
+		}
+	}
+	if session == nil {
+		w.Header().Add("Set-Cookie", sessionTokenName+"=delete;"+cookies.GetDeleteAttributes())
+		w.Header().Set("Location", authURLPath)
+		w.WriteHeader(302)
+		return nil
+	}
+
+	backend := opts["backend"].(*backends.Backend)
+	claims := session["claims"].(*jwtclaims.UserClaims)
+	args := make(map[string]interface{})
+	args["username"] = claims.Subject
+	args["email"] = claims.Email
+	tokens, err := backend.GetMfaTokens(args)
+	if err != nil {
+		log.Error("Failed retrieving MFA tokens",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("error", err.Error()),
+		)
+		opts["flow"] = "internal_server_error"
+		return ServeGeneric(w, r, opts)
+	}
+	methods := cfg.GetMethods(tokens)
+
+	resp := uiFactory.GetArgs()
+	resp.Title = "Multi-Factor Authentication"
+	resp.Data["action"] = path.Join(authURLPath, "mfa")
+	resp.Data["methods"] = methods
+	if cfg.DeviceTrustEnabled() {
+		resp.Data["trusted_device_lifetime"] = cfg.TrustedDeviceLifetime
+	}
+	statusCode := 200
+
+	if len(methods) == 0 {
+		if session["mfa_enrollment"] != true {
+			sessionCache.Delete(sessionID)
+			w.Header().Add("Set-Cookie", sessionTokenName+"=delete;"+cookies.GetDeleteAttributes())
+			w.Header().Set("Location", authURLPath)
+			w.WriteHeader(302)
+			return nil
+		}
+		resp.Title = "Multi-Factor Authentication Enrollment"
+		resp.Data["step"] = "enroll"
+		secret := session["mfa_secret"].(string)
+		if r.Method == "POST" {
+			if err := r.ParseForm(); err != nil {
+				opts["flow"] = "policy_violation"
+				return ServeGeneric(w, r, opts)
+			}
+			operation := make(map[string]interface{})
+			operation["name"] = "add_mfa_token"
+			operation["username"] = claims.Subject
+			operation["email"] = claims.Email
+			operation["secret"] = secret
+			operation["type"] = "totp"
+			operation["period"] = "30"
+			operation["digits"] = "6"
+			operation["code1"] = r.PostFormValue("code1")
+			operation["code2"] = r.PostFormValue("code2")
+			if comment := r.PostFormValue("comment"); comment != "" {
+				operation["comment"] = comment
+			}
+			if err := backend.Do(operation); err != nil {
+				log.Warn("MFA enrollment failed",
+					zap.String("request_id", reqID),
+					zap.String("user", claims.Subject),
+					zap.String("error", err.Error()),
+				)
+				resp.Message = "Failed adding MFA token"
+				statusCode = 400
+			} else {
+				log.Info("MFA enrollment succeeded",
+					zap.String("request_id", reqID),
+					zap.String("user", claims.Subject),
+				)
+				return promoteMfaSession(w, r, opts, sessionID, session, mfa.GetMethod("totp"))
+			}
+		}
+		codeOpts := make(map[string]interface{})
+		codeOpts["secret"] = secret
+		codeOpts["type"] = "totp"
+		codeOpts["label"] = "AUTHP:" + claims.Email
+		codeOpts["period"] = 30
+		codeOpts["issuer"] = "AUTHP"
+		codeOpts["digits"] = 6
+		codeURI, err := utils.GetCodeURI(codeOpts)
+		if err != nil {
+			log.Error("Failed creating key code URI", zap.String("request_id", reqID), zap.String("error", err.Error()))
+			opts["flow"] = "internal_server_error"
+			return ServeGeneric(w, r, opts)
+		}
+		png, err := qrcode.Encode(codeURI, qrcode.Medium, 256)
+		if err != nil {
+			log.Error("Failed encoding QR code", zap.String("request_id", reqID), zap.String("error", err.Error()))
+			opts["flow"] = "internal_server_error"
+			return ServeGeneric(w, r, opts)
+		}
+		resp.Data["code_uri"] = codeURI
+		resp.Data["code_image"] = base64.StdEncoding.EncodeToString(png)
+		return renderMfaPage(w, opts, resp, statusCode)
+	}
+
+	resp.Data["step"] = "select"
+
+	methodName := strings.TrimPrefix(r.URL.Path, authURLPath)
+	methodName = strings.TrimPrefix(methodName, "/")
+	methodName = strings.TrimPrefix(methodName, "mfa")
+	methodName = strings.Trim(methodName, "/")
+	if methodName == "" && len(methods) == 1 {
+		methodName = methods[0].Name
+	}
+
+	if methodName != "" {
+		var method *mfa.Method
+		for _, m := range methods {
+			if m.Name == methodName {
+				method = m
+				break
+			}
+		}
+		if method == nil {
+			resp.Message = "The requested authentication method is not available"
+			statusCode = 400
+		} else {
+			resp.Data["step"] = "challenge"
+			resp.Data["method"] = method
+			if r.Method == "POST" {
+				if err := r.ParseForm(); err != nil {
+					opts["flow"] = "policy_violation"
+					return ServeGeneric(w, r, opts)
+				}
+				if _, err := method.Verify(tokens, r.PostFormValue("code")); err != nil {
+					log.Warn("MFA verification failed",
+						zap.String("request_id", reqID),
+						zap.String("user", claims.Subject),
+						zap.String("mfa_method", method.Name),
+						zap.String("error", err.Error()),
+					)
+					attempts := sessionCache.Increment(sessionID, "mfa_attempts_"+method.Name)
+					if attempts >= cfg.GetMaxAttempts(method.Name) {
+						log.Warn("MFA verification attempts exceeded",
+							zap.String("request_id", reqID),
+							zap.String("user", claims.Subject),
+							zap.String("mfa_method", method.Name),
+							zap.Int("attempts", attempts),
+						)
+						sessionCache.Delete(sessionID)
+						w.Header().Add("Set-Cookie", sessionTokenName+"=delete;"+cookies.GetDeleteAttributes())
+						opts["flow"] = "auth_failed"
+						opts["message"] = "Too many failed attempts, please log in again"
+						return ServeGeneric(w, r, opts)
+					}
+					resp.Message = "Authentication failed"
+					statusCode = 401
+				} else {
+					log.Debug("MFA verification succeeded",
+						zap.String("request_id", reqID),
+						zap.String("user", claims.Subject),
+						zap.String("mfa_method", method.Name),
+					)
+					if cfg.DeviceTrustEnabled() && r.PostFormValue("trust_device") == "yes" {
+						realm, _ := session["backend_realm"].(string)
+						deviceToken, lifetime, err := cfg.TrustDevice(claims.Subject, realm, r.UserAgent())
+						if err != nil {
+							log.Warn("Failed trusting device",
+								zap.String("request_id", reqID),
+								zap.String("user", claims.Subject),
+								zap.String("error", err.Error()),
+							)
+						} else {
+							deviceTokenName := opts["trusted_device_token_name"].(string)
+							w.Header().Add("Set-Cookie", deviceTokenName+"="+deviceToken+";"+cookies.GetAttributesWithLifetime(lifetime))
+						}
+					}
+					return promoteMfaSession(w, r, opts, sessionID, session, method)
+				}
+			}
+		}
+	}
+
+	return renderMfaPage(w, opts, resp, statusCode)
+}
+
+// promoteMfaSession replaces the pending session of a user who passed
+// multi-factor authentication with the regular session, and issues
+// a token to the user. The method the user passed is added to the
+// authentication method references of the session.
+func promoteMfaSession(w http.ResponseWriter, r *http.Request, opts map[string]interface{}, sessionID string, session map[string]interface{}, method *mfa.Method) error {
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+	sessionTokenName := opts["mfa_token_name"].(string)
+	cookies := opts["cookies"].(*cookies.Cookies)
+	claims := session["claims"].(*jwtclaims.UserClaims)
+	sessionCache.Delete(sessionID)
+	promotedSession := map[string]interface{}{
+		"claims":           claims,
+		"backend_name":     session["backend_name"],
+		"backend_realm":    session["backend_realm"],
+		"backend_method":   session["backend_method"],
+		"authenticated_at": time.Now(),
+		"src_ip":           opts["src_ip"],
+		"user_agent":       r.UserAgent(),
+	}
+	if v, exists := session["password_expires_at"]; exists {
+		promotedSession["password_expires_at"] = v
+	}
+	sessionCache.Add(claims.ID, promotedSession)
+	w.Header().Add("Set-Cookie", sessionTokenName+"=delete;"+cookies.GetDeleteAttributes())
+	opts["flow"] = "login"
+	opts["authenticated"] = true
+	opts["user_claims"] = claims
+	if v, exists := session["backend_realm"]; exists {
+		opts["auth_realm"] = v
+	}
+	if v, exists := opts["event_stream"]; exists {
+		realm, _ := session["backend_realm"].(string)
+		v.(*events.Stream).Publish(&events.Event{
+			Type:          "login",
+			Time:          time.Now().UTC(),
+			Realm:         realm,
+			User:          claims.Subject,
+			SourceAddress: utils.GetSourceAddress(r),
+			RequestID:     opts["request_id"].(string),
+		})
+	}
+	if v, exists := session["custom_claims"]; exists {
+		opts["custom_claims"] = v
+	}
+	var amr []string
+	if v, exists := session["amr"]; exists {
+		amr = append(amr, v.([]string)...)
+	}
+	opts["amr"] = append(amr, method.GetReference(), "mfa")
+	return ServeLogin(w, r, opts)
+}
+
+func renderMfaPage(w http.ResponseWriter, opts map[string]interface{}, resp *ui.UserInterfaceArgs, statusCode int) error {
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	content, err := uiFactory.Render("mfa", resp)
+	if err != nil {
+		return serveFallback(w, opts, "mfa", err)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(statusCode)
+	w.Write(content.Bytes())
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"go.uber.org/zap"
+)
+
+const maxPasswordChangeAttempts = 5
+
+// ServePasswordChange returns the page where a user whose password
+// expired changes the password. When the password is changed, the
+// pending session of the user is removed and the user logs in with
+// the new password.
+func ServePasswordChange(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	authURLPath := opts["auth_url_path"].(string)
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+	sessionTokenName := opts["password_token_name"].(string)
+	cookies := opts["cookies"].(*cookies.Cookies)
+
+	// Add non-caching headers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if opts["authenticated"].(bool) {
+		w.Header().Set("Location", authURLPath)
+		w.WriteHeader(302)
+		return nil
+	}
+
+	if opts["content_type"].(string) == "application/json" {
+		return ServeUnsupported(w, r, opts, "password_change")
+	}
+
+	var session map[string]interface{}
+	var sessionID string
+	if v, exists := opts["password_session"]; exists {
+		session = v.(map[string]interface{})
+		sessionID = opts["password_session_id"].(string)
+		if session["expires_at"].(time.Time).Before(time.Now()) {
+			sessionCache.Delete(sessionID)
+			session = nil
+		}
+	}
+	if session == nil {
+		w.Header().Add("Set-Cookie", sessionTokenName+"=delete;"+cookies.GetDeleteAttributes())
+		w.Header().Set("Location", authURLPath)
+		w.WriteHeader(302)
+		return nil
+	}
+
+	backend := opts["backend"].(*backends.Backend)
+	claims := session["claims"].(*jwtclaims.UserClaims)
+
+	resp := uiFactory.GetArgs()
+	resp.Title = "Password Expired"
+	resp.Data["action"] = path.Join(authURLPath, "password")
+	resp.Data["step"] = "change"
+	statusCode := 200
+
+	if r.Method == "POST" {
+		secrets, err := validatePasswordChangeForm(r)
+		var breachErr error
+		if err == nil {
+			breachErr = checkPasswordBreach(opts, secrets["new_password"])
+		}
+		operation := make(map[string]interface{})
+		if err == nil && breachErr == nil {
+			operation["name"] = "password_change"
+			operation["username"] = claims.Subject
+			operation["email"] = claims.Email
+			for k, v := range secrets {
+				operation[k] = v
+			}
+			err = backend.Do(operation)
+		}
+		if breachErr != nil {
+			// The rejection of the new password does not count as a
+			// failed attempt, because the current password is unverified.
+			resp.Message = breachErr.Error()
+			statusCode = 400
+		} else if err != nil {
+			log.Warn("Expired password change failed",
+				zap.String("request_id", reqID),
+				zap.String("user", claims.Subject),
+				zap.String("error", err.Error()),
+			)
+			attempts := sessionCache.Increment(sessionID, "password_change_attempts")
+			if attempts >= maxPasswordChangeAttempts {
+				sessionCache.Delete(sessionID)
+				w.Header().Add("Set-Cookie", sessionTokenName+"=delete;"+cookies.GetDeleteAttributes())
+				opts["flow"] = "auth_failed"
+				opts["message"] = "Too many failed attempts, please log in again"
+				return ServeGeneric(w, r, opts)
+			}
+			resp.Message = getPasswordChangeMessage(operation, err)
+			statusCode = 400
+		} else {
+			log.Info("Expired password changed",
+				zap.String("request_id", reqID),
+				zap.String("user", claims.Subject),
+			)
+			sessionCache.Delete(sessionID)
+			w.Header().Add("Set-Cookie", sessionTokenName+"=delete;"+cookies.GetDeleteAttributes())
+			resp.Title = "Password Changed"
+			resp.Data["step"] = "done"
+		}
+	}
+
+	content, err := uiFactory.Render("password", resp)
+	if err != nil {
+		return serveFallback(w, opts, "password", err)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(statusCode)
+	w.Write(content.Bytes())
+	return nil
+}
+
+// getPasswordChangeMessage returns the message displayed to the user
+// when the password change operation failed.
+func getPasswordChangeMessage(operation map[string]interface{}, err error) string {
+	if nextChangeAt, ok := operation["next_password_change_at"].(time.Time); ok {
+		return fmt.Sprintf(
+			"Password was changed recently, the next change is allowed after %s",
+			nextChangeAt.UTC().Format(time.RFC1123),
+		)
+	}
+	return err.Error()
+}
+
+// checkPasswordBreach returns an error when the password appears in known
+// data breaches. When the breach check is unavailable, the password is
+// rejected, unless the check fails open.
+func checkPasswordBreach(opts map[string]interface{}, password string) error {
+	c, ok := opts["password_breach_check"].(*validators.BreachCheck)
+	if !ok || !c.Enabled() {
+		return nil
+	}
+	breached, err := c.IsBreached(password)
+	if err != nil {
+		opts["logger"].(*zap.Logger).Warn("Password breach check failed",
+			zap.String("request_id", opts["request_id"].(string)),
+			zap.String("error", err.Error()),
+			zap.Bool("fail_open", c.FailOpen),
+		)
+		if c.FailOpen {
+			return nil
+		}
+		return fmt.Errorf("Password breach check is unavailable, please try again later")
+	}
+	if breached {
+		return fmt.Errorf("Password has appeared in a data breach, please choose a different password")
+	}
+	return nil
+}
@@ -20,7 +20,7 @@ import (
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
 	"go.uber.org/zap"
 	"net/http"
-	"net/url"
+	"time"
 )
 
 // ServePortal returns user identity information.
@@ -33,20 +33,26 @@ func ServePortal(w http.ResponseWriter, r *http.Request, opts map[string]interfa
 	redirectToToken := opts["redirect_token_name"].(string)
 
 	if !opts["authenticated"].(bool) {
-		w.Header().Set("Location", authURLPath)
-		w.WriteHeader(302)
-		return nil
+		return serveLoginRedirect(w, r, opts, authURLPath)
 	}
+	resetRedirectCount(w, r, opts)
 
 	if cookie, err := r.Cookie(redirectToToken); err == nil {
-		if redirectURL, err := url.Parse(cookie.Value); err == nil {
+		if redirectURL, err := getRedirectURL(cookies, cookie.Value); err != nil {
+			log.Warn(
+				"rejected cookie-based redirect",
+				zap.String("request_id", reqID),
+				zap.String("error", err.Error()),
+			)
+			w.Header().Add("Set-Cookie", redirectToToken+"=delete;"+cookies.GetDeleteAttributes())
+		} else {
 			log.Debug(
 				"Cookie-based redirect",
 				zap.String("request_id", reqID),
 				zap.String("redirect_url", redirectURL.String()),
 			)
 			w.Header().Set("Location", redirectURL.String())
-			w.Header().Add("Set-Cookie", redirectToToken+"=delete;"+cookies.GetDeleteAttributes()+" expires=Thu, 01 Jan 1970 00:00:00 GMT")
+			w.Header().Add("Set-Cookie", redirectToToken+"=delete;"+cookies.GetDeleteAttributes())
 			w.WriteHeader(303)
 			return nil
 		}
@@ -73,14 +79,14 @@ func ServePortal(w http.ResponseWriter, r *http.Request, opts map[string]interfa
 	// Display main authentication portal page
 	resp := ui.GetArgs()
 	resp.Title = "Welcome"
+	if v, exists := opts["password_expires_at"]; exists {
+		resp.Data["password_expires_at"] = v.(time.Time).UTC().Format(time.RFC1123)
+	}
+	addSessionExpiry(resp, opts)
 
 	content, err := ui.Render("portal", resp)
 	if err != nil {
-		log.Error("Failed HTML response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(500)
-		w.Write([]byte(`Internal Server Error`))
-		return err
+		return serveFallback(w, opts, "portal", err)
 	}
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(200)
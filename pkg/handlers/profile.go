@@ -0,0 +1,93 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"go.uber.org/zap"
+)
+
+// serveProfileSettings handles the change of the additional profile
+// fields of the user. It returns the settings view to render.
+func serveProfileSettings(r *http.Request, opts map[string]interface{}, resp *ui.UserInterfaceArgs, viewParts []string) string {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+
+	if resp.Data["profile_enabled"] != true {
+		return "profile-disabled"
+	}
+	backend := opts["backend"].(*backends.Backend)
+	schema := opts["profile_schema"].(*profile.Schema)
+	resp.Data["profile_fields"] = schema.Fields
+
+	if len(viewParts) < 2 || viewParts[1] != "edit" || r.Method != "POST" {
+		values, err := backend.GetProfile(map[string]interface{}{
+			"username": claims.Subject,
+			"email":    claims.Email,
+		})
+		if err != nil {
+			log.Error("Failed retrieving profile",
+				zap.String("request_id", reqID),
+				zap.String("user", claims.Subject),
+				zap.String("error", err.Error()),
+			)
+			resp.Data["status"] = "failure"
+			resp.Data["status_reason"] = "Internal Server Error"
+			return "profile-edit"
+		}
+		resp.Data["profile_values"] = values
+		return "profile"
+	}
+
+	resp.Data["status"] = "failure"
+	values, err := validateProfileForm(r, schema)
+	if err != nil {
+		resp.Data["status_reason"] = err.Error()
+		return "profile-edit"
+	}
+	operation := map[string]interface{}{
+		"name":     "update_profile",
+		"username": claims.Subject,
+		"email":    claims.Email,
+		"profile":  values,
+	}
+	if err := backend.Do(operation); err != nil {
+		resp.Data["status_reason"] = fmt.Sprintf("%s", err)
+		return "profile-edit"
+	}
+	log.Info("Profile updated",
+		zap.String("request_id", reqID),
+		zap.String("user", claims.Subject),
+	)
+	resp.Data["status"] = "success"
+	return "profile-edit"
+}
+
+func validateProfileForm(r *http.Request, schema *profile.Schema) (map[string]string, error) {
+	if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return nil, fmt.Errorf("Unsupported content type")
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("Failed parsing submitted form")
+	}
+	return schema.Parse(r.PostForm)
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/enumeration"
+	"github.com/greenpau/caddy-auth-portal/pkg/recovery"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"go.uber.org/zap"
+)
+
+// ServeRecover returns account recovery page. A user identifies the
+// account, answers the security questions of the account, and sets
+// new password.
+func ServeRecover(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	authURLPath := opts["auth_url_path"].(string)
+	cfg := opts["recovery"].(*recovery.Recovery)
+	bknds := opts["backends"].([]backends.Backend)
+	var antiEnumeration *enumeration.AntiEnumeration
+	if v, exists := opts["anti_enumeration"]; exists {
+		antiEnumeration = v.(*enumeration.AntiEnumeration)
+	}
+	startedAt := time.Now()
+
+	if opts["authenticated"].(bool) {
+		w.Header().Set("Location", authURLPath)
+		w.WriteHeader(302)
+		return nil
+	}
+
+	// Add non-caching headers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if opts["content_type"].(string) == "application/json" {
+		return ServeUnsupported(w, r, opts, "recover")
+	}
+
+	if cfg.EmailLink {
+		return serveRecoverLink(w, r, opts, startedAt)
+	}
+
+	resp := uiFactory.GetArgs()
+	resp.Title = "Account Recovery"
+	resp.Data["step"] = "identify"
+	resp.Data["require_email"] = cfg.RequireEmail
+
+	if r.Method == "POST" {
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			opts["flow"] = "policy_violation"
+			return ServeGeneric(w, r, opts)
+		}
+		if err := r.ParseForm(); err != nil {
+			opts["flow"] = "policy_violation"
+			return ServeGeneric(w, r, opts)
+		}
+		username := strings.TrimSpace(r.PostFormValue("username"))
+		email := strings.TrimSpace(r.PostFormValue("email"))
+		realm := r.PostFormValue("realm")
+		if realm == "" {
+			realm = "local"
+		}
+		key := realm + "/" + username
+		resp.Data["username"] = username
+		resp.Data["email"] = email
+		resp.Data["realm"] = realm
+
+		switch {
+		case username == "", cfg.RequireEmail && email == "":
+			resp.Message = "Please provide the required account details"
+		case r.PostFormValue("step") == "verify":
+			resp.Data["step"] = "verify"
+			resp.Data["questions"] = cfg.GetUserQuestions(key)
+			answers := make(map[string]string)
+			for _, q := range cfg.Questions {
+				if v := r.PostFormValue("answer_" + q.ID); v != "" {
+					answers[q.ID] = v
+				}
+			}
+			password := r.PostFormValue("password")
+			if password != r.PostFormValue("password_confirm") {
+				resp.Message = "Passwords do not match"
+				break
+			}
+			if err := validators.ValidateUserInput("secret", password, make(map[string]interface{})); err != nil {
+				resp.Message = "Failed processing the recovery form due " + err.Error()
+				break
+			}
+			backend := getRecoveryBackend(bknds, realm)
+			if backend == nil {
+				resp.Message = "Account recovery failed"
+				break
+			}
+			db := cfg.GetDatabase()
+			lockout := time.Duration(cfg.LockoutTime) * time.Minute
+			autoReset := time.Duration(cfg.AutoResetAfter) * time.Minute
+			if err := db.Verify(key, email, answers, cfg.RequireEmail, cfg.MaxAttempts, lockout, autoReset); err != nil {
+				log.Warn("Account recovery failed",
+					zap.String("request_id", reqID),
+					zap.String("username", username),
+					zap.String("realm", realm),
+					zap.String("error", err.Error()),
+				)
+				resp.Message = "Account recovery failed"
+				break
+			}
+			operation := make(map[string]interface{})
+			operation["name"] = "password_reset"
+			operation["username"] = username
+			operation["new_password"] = password
+			if err := backend.Do(operation); err != nil {
+				log.Error("Account recovery password reset failed",
+					zap.String("request_id", reqID),
+					zap.String("username", username),
+					zap.String("realm", realm),
+					zap.String("error", err.Error()),
+				)
+				resp.Message = "Account recovery failed"
+				break
+			}
+			log.Info("Account recovered",
+				zap.String("request_id", reqID),
+				zap.String("username", username),
+				zap.String("realm", realm),
+			)
+			resp.Data["step"] = "done"
+		default:
+			resp.Data["step"] = "verify"
+			resp.Data["questions"] = cfg.GetUserQuestions(key)
+		}
+	}
+
+	if r.Method == "POST" {
+		antiEnumeration.Pad(startedAt)
+	}
+
+	content, err := uiFactory.Render("recover", resp)
+	if err != nil {
+		return serveFallback(w, opts, "recover", err)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	w.Write(content.Bytes())
+	return nil
+}
+
+// getRecoveryBackend returns the local backend of the realm. The password
+// of the accounts in the other backends cannot be reset.
+func getRecoveryBackend(bknds []backends.Backend, realm string) *backends.Backend {
+	for i := range bknds {
+		if bknds[i].GetMethod() != "local" {
+			continue
+		}
+		if bknds[i].GetRealm() != realm {
+			continue
+		}
+		return &bknds[i]
+	}
+	return nil
+}
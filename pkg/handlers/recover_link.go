@@ -0,0 +1,250 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/email"
+	"github.com/greenpau/caddy-auth-portal/pkg/enumeration"
+	"github.com/greenpau/caddy-auth-portal/pkg/recovery"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"go.uber.org/zap"
+)
+
+const (
+	// recoveryLinkCachePrefix is the prefix of the session cache entries
+	// holding the pending recovery links, keyed by the token.
+	recoveryLinkCachePrefix = "recovery_link:"
+	// recoveryUserCachePrefix is the prefix of the session cache entries
+	// holding the token of the pending recovery link of a user.
+	recoveryUserCachePrefix = "recovery_user:"
+)
+
+// serveRecoverLink handles the account recovery via the links sent to
+// the email addresses of the accounts. A link is valid once, and only
+// until it expires.
+func serveRecoverLink(w http.ResponseWriter, r *http.Request, opts map[string]interface{}, startedAt time.Time) error {
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	authURLPath := opts["auth_url_path"].(string)
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+
+	resp := uiFactory.GetArgs()
+	resp.Title = "Account Recovery"
+	resp.Data["step"] = "request"
+	statusCode := 200
+
+	viewParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, authURLPath), "/"), "/")
+	if len(viewParts) > 1 && viewParts[1] == "reset" {
+		if len(viewParts) != 3 || viewParts[2] == "" {
+			statusCode = 404
+			resp.Data["step"] = "invalid"
+		} else {
+			statusCode = resetRecoveryPassword(r, opts, sessionCache, viewParts[2], resp)
+		}
+	} else if r.Method == "POST" {
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			opts["flow"] = "policy_violation"
+			return ServeGeneric(w, r, opts)
+		}
+		if err := r.ParseForm(); err != nil {
+			opts["flow"] = "policy_violation"
+			return ServeGeneric(w, r, opts)
+		}
+		realm := r.PostFormValue("realm")
+		if realm == "" {
+			realm = "local"
+		}
+		backend := getRecoveryBackend(opts["backends"].([]backends.Backend), realm)
+		if backend == nil {
+			return ServeUnsupported(w, r, opts, "recover")
+		}
+		userInput := strings.TrimSpace(r.PostFormValue("email"))
+		if userInput == "" {
+			resp.Message = "Please provide the required account details"
+		} else {
+			sendRecoveryLink(r, opts, sessionCache, backend, userInput)
+			resp.Data["step"] = "sent"
+		}
+		if v, exists := opts["anti_enumeration"]; exists {
+			v.(*enumeration.AntiEnumeration).Pad(startedAt)
+		}
+	}
+
+	content, err := uiFactory.Render("recover", resp)
+	if err != nil {
+		return serveFallback(w, opts, "recover", err)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(statusCode)
+	w.Write(content.Bytes())
+	return nil
+}
+
+// sendRecoveryLink sends the recovery link to the email address of the
+// account. The response does not reveal whether the account exists, so
+// the failures are only logged. The new link replaces the pending one.
+func sendRecoveryLink(r *http.Request, opts map[string]interface{}, sessionCache *cache.SessionCache, backend *backends.Backend, userInput string) {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	authURLPath := opts["auth_url_path"].(string)
+	cfg := opts["recovery"].(*recovery.Recovery)
+	smtpCfg := opts["smtp"].(*email.Config)
+	realm := backend.GetRealm()
+
+	recipient, err := backend.GetEmailAddress(map[string]interface{}{"username": userInput})
+	if err != nil {
+		log.Debug("Skipped recovery link, account not found",
+			zap.String("request_id", reqID),
+			zap.String("realm", realm),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Error("Failed generating recovery token", zap.String("request_id", reqID), zap.String("error", err.Error()))
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	userKey := recoveryUserCachePrefix + realm + "/" + strings.ToLower(recipient)
+	if pending := sessionCache.Pop(userKey); pending != nil {
+		sessionCache.Delete(recoveryLinkCachePrefix + pending["token"].(string))
+	}
+	expiresAt := time.Now().Add(time.Duration(cfg.LinkLifetime) * time.Second)
+	sessionCache.Add(recoveryLinkCachePrefix+token, map[string]interface{}{
+		"username":   recipient,
+		"realm":      realm,
+		"user_key":   userKey,
+		"expires_at": expiresAt,
+	})
+	sessionCache.Add(userKey, map[string]interface{}{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+	link := opts["link_base_url"].(string) + path.Join(authURLPath, "recover", "reset", token)
+	body := fmt.Sprintf(
+		"Please follow the link below to choose a new password for your account.\n\n"+
+			"%s\n\nThe link expires in %d minutes and works once. If you did not request the recovery, please ignore this email.\n",
+		link, cfg.LinkLifetime/60,
+	)
+	if err := smtpCfg.Send(recipient, "Recover your account", body); err != nil {
+		sessionCache.Delete(recoveryLinkCachePrefix + token)
+		sessionCache.Delete(userKey)
+		log.Error("Failed sending recovery link",
+			zap.String("request_id", reqID),
+			zap.String("realm", realm),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	log.Info("Sent recovery link",
+		zap.String("request_id", reqID),
+		zap.String("realm", realm),
+		zap.String("email", recipient),
+	)
+}
+
+// resetRecoveryPassword sets the new password of the account of the
+// recovery link and returns the status code of the response. The link
+// is purged once used or expired, so that the replayed links are not
+// found.
+func resetRecoveryPassword(r *http.Request, opts map[string]interface{}, sessionCache *cache.SessionCache, token string, resp *ui.UserInterfaceArgs) int {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	cacheKey := recoveryLinkCachePrefix + token
+
+	entry := sessionCache.Get(cacheKey)
+	if entry == nil || time.Now().After(entry["expires_at"].(time.Time)) {
+		if entry != nil {
+			sessionCache.Delete(cacheKey)
+			sessionCache.Delete(entry["user_key"].(string))
+		}
+		resp.Data["step"] = "invalid"
+		return 404
+	}
+	resp.Data["step"] = "reset"
+	resp.Data["token"] = token
+	if r.Method != "POST" {
+		return 200
+	}
+	if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		resp.Message = "Unsupported content type"
+		return 400
+	}
+	if err := r.ParseForm(); err != nil {
+		resp.Message = "Failed parsing submitted form"
+		return 400
+	}
+	password := r.PostFormValue("password")
+	if password != r.PostFormValue("password_confirm") {
+		resp.Message = "Passwords do not match"
+		return 400
+	}
+	if err := validators.ValidateUserInput("secret", password, make(map[string]interface{})); err != nil {
+		resp.Message = "Failed processing the recovery form due " + err.Error()
+		return 400
+	}
+	if err := checkPasswordBreach(opts, password); err != nil {
+		resp.Message = err.Error()
+		return 400
+	}
+
+	// Only one of the concurrent requests consumes the link.
+	entry = sessionCache.Pop(cacheKey)
+	if entry == nil {
+		resp.Data["step"] = "invalid"
+		return 404
+	}
+	sessionCache.Delete(entry["user_key"].(string))
+	username := entry["username"].(string)
+	realm := entry["realm"].(string)
+	backend := getRecoveryBackend(opts["backends"].([]backends.Backend), realm)
+	if backend == nil {
+		resp.Data["step"] = "invalid"
+		return 404
+	}
+	operation := map[string]interface{}{
+		"name":         "password_reset",
+		"username":     username,
+		"new_password": password,
+	}
+	if err := backend.Do(operation); err != nil {
+		log.Error("Account recovery password reset failed",
+			zap.String("request_id", reqID),
+			zap.String("realm", realm),
+			zap.String("error", err.Error()),
+		)
+		resp.Data["step"] = "request"
+		resp.Message = "Account recovery failed, please request a new link"
+		return 500
+	}
+	log.Info("Account recovered",
+		zap.String("request_id", reqID),
+		zap.String("email", username),
+		zap.String("realm", realm),
+	)
+	resp.Data["step"] = "done"
+	return 200
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/recovery"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeRecoverLink(t *testing.T) {
+	testFailed := 0
+	uiFactory := ui.NewUserInterfaceFactory()
+	if err := uiFactory.AddBuiltinTemplate("basic/recover"); err != nil {
+		t.Fatalf("failed loading template: %s", err)
+	}
+	uiFactory.Templates["recover"] = uiFactory.Templates["basic/recover"]
+	cfg := &recovery.Recovery{EmailLink: true}
+	if err := cfg.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	sessionCache := cache.NewSessionCache()
+	addLink := func(token string, expiresAt time.Time) {
+		userKey := recoveryUserCachePrefix + "local/" + token + "@contoso.com"
+		sessionCache.Add(recoveryLinkCachePrefix+token, map[string]interface{}{
+			"username":   token + "@contoso.com",
+			"realm":      "local",
+			"user_key":   userKey,
+			"expires_at": expiresAt,
+		})
+		sessionCache.Add(userKey, map[string]interface{}{"token": token, "expires_at": expiresAt})
+	}
+	addLink("active", time.Now().Add(time.Hour))
+	addLink("expired", time.Now().Add(-time.Minute))
+	secret := "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83"
+
+	tests := []struct {
+		descr    string
+		method   string
+		path     string
+		form     map[string]string
+		status   int
+		contains string
+		purged   string
+	}{
+		{descr: "request form", method: "GET", path: "/auth/forgot", status: 200, contains: `name="email"`},
+		{descr: "reset form", method: "GET", path: "/auth/recover/reset/active", status: 200, contains: `/recover/reset/active" method="POST"`},
+		{
+			descr:    "mismatched passwords keep link",
+			method:   "POST",
+			path:     "/auth/recover/reset/active",
+			form:     map[string]string{"password": secret, "password_confirm": "foo"},
+			status:   400,
+			contains: "Passwords do not match",
+		},
+		{
+			descr:  "consumed link",
+			method: "POST",
+			path:   "/auth/recover/reset/active",
+			form:   map[string]string{"password": secret, "password_confirm": secret},
+			status: 404,
+			purged: "active",
+		},
+		{descr: "replayed link", method: "GET", path: "/auth/recover/reset/active", status: 404, contains: "already used"},
+		{descr: "expired link", method: "GET", path: "/auth/recover/reset/expired", status: 404, purged: "expired"},
+		{descr: "unknown link", method: "GET", path: "/auth/recover/reset/foo", status: 404},
+		{descr: "malformed link", method: "GET", path: "/auth/recover/reset", status: 404},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.descr)
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.method == "POST" {
+			form := url.Values{}
+			for k, v := range test.form {
+				form.Set(k, v)
+			}
+			r = httptest.NewRequest("POST", test.path, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":    "abc",
+			"logger":        utils.NewLogger(),
+			"ui":            uiFactory,
+			"auth_url_path": "/auth",
+			"authenticated": false,
+			"content_type":  "text/html",
+			"recovery":      cfg,
+			"backends":      []backends.Backend{},
+			"session_cache": sessionCache,
+		}
+		ServeRecover(w, r, opts)
+		if w.Code != test.status {
+			t.Logf("FAIL: %s, expected status: %d, received: %d", testDescr, test.status, w.Code)
+			testFailed++
+			continue
+		}
+		if test.contains != "" && !strings.Contains(w.Body.String(), test.contains) {
+			t.Logf("FAIL: %s, expected body to contain: %s", testDescr, test.contains)
+			testFailed++
+			continue
+		}
+		if test.purged != "" {
+			if sessionCache.Get(recoveryLinkCachePrefix+test.purged) != nil || sessionCache.Get(recoveryUserCachePrefix+"local/"+test.purged+"@contoso.com") != nil {
+				t.Logf("FAIL: %s, expected link to be purged", testDescr)
+				testFailed++
+				continue
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
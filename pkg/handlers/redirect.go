@@ -18,23 +18,65 @@ import (
 	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
 	"go.uber.org/zap"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
-// ServeSessionLoginRedirect redirects request to login page.
+// redirectLoopWindow is the lifetime, in seconds, of the cookie counting
+// the redirects to login page.
+const redirectLoopWindow = 30
+
+// ServeSessionLoginRedirect redirects request to login page. The number
+// of consecutive redirects is tracked in a cookie. When the number reaches
+// the configured threshold, the redirect loop is broken by an error page.
 func ServeSessionLoginRedirect(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
 	reqID := opts["request_id"].(string)
 	log := opts["logger"].(*zap.Logger)
 	authURLPath := opts["auth_url_path"].(string)
 	cookieNames := opts["cookie_names"].([]string)
 	cookies := opts["cookies"].(*cookies.Cookies)
+	redirectCountToken := opts["redirect_count_token_name"].(string)
+	redirectLoopThreshold := opts["redirect_loop_threshold"].(int)
+
+	if !isLoginRedirectAllowed(r, opts) {
+		for _, k := range cookieNames {
+			w.Header().Add("Set-Cookie", k+"=delete;"+cookies.GetDeleteAttributes())
+		}
+		return serveUnauthenticated(w, r, opts)
+	}
+
+	redirectCount := 0
+	if cookie, err := r.Cookie(redirectCountToken); err == nil {
+		if i, err := strconv.Atoi(cookie.Value); err == nil {
+			redirectCount = i
+		}
+	}
+	redirectCount++
+
+	if redirectLoopThreshold > 0 && redirectCount > redirectLoopThreshold {
+		log.Error("detected redirect loop to login page",
+			zap.String("request_id", reqID),
+			zap.Int("redirect_count", redirectCount),
+			zap.Int("redirect_loop_threshold", redirectLoopThreshold),
+			zap.String("request_uri", r.RequestURI),
+		)
+		w.Header().Add("Set-Cookie", redirectCountToken+"=delete;"+cookies.GetDeleteAttributes())
+		opts["flow"] = "redirect_loop"
+		opts["authenticated"] = false
+		opts["message"] = "The login page redirected too many times. Please clear the cookies for this site and try again."
+		return ServeGeneric(w, r, opts)
+	}
 
 	log.Debug("redirecting to login page",
 		zap.String("request_id", reqID),
+		zap.Int("redirect_count", redirectCount),
 	)
 
+	w.Header().Add("Set-Cookie", redirectCountToken+"="+strconv.Itoa(redirectCount)+";"+cookies.GetAttributesWithLifetime(redirectLoopWindow))
+
 	for _, k := range cookieNames {
-		w.Header().Add("Set-Cookie", k+"=delete;"+cookies.GetDeleteAttributes()+"expires=Thu, 01 Jan 1970 00:00:00 GMT")
+		w.Header().Add("Set-Cookie", k+"=delete;"+cookies.GetDeleteAttributes())
 	}
 	if strings.Contains(r.RequestURI, "?redirect_url=") {
 		w.Header().Set("Location", authURLPath)
@@ -44,3 +86,66 @@ func ServeSessionLoginRedirect(w http.ResponseWriter, r *http.Request, opts map[
 	w.WriteHeader(302)
 	return nil
 }
+
+// resetRedirectCount deletes the cookie counting the consecutive
+// redirects to the login page, so that the redirect loop detection
+// starts over after the login.
+func resetRedirectCount(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) {
+	redirectCountToken, _ := opts["redirect_count_token_name"].(string)
+	if redirectCountToken == "" {
+		return
+	}
+	if _, err := r.Cookie(redirectCountToken); err != nil {
+		return
+	}
+	cookies := opts["cookies"].(*cookies.Cookies)
+	w.Header().Add("Set-Cookie", redirectCountToken+"=delete;"+cookies.GetDeleteAttributes())
+}
+
+// isLoginRedirectAllowed returns false when the unauthenticated request
+// must not be redirected to the login page. The requests with unsafe
+// methods, e.g. POST or DELETE, lose their bodies on the redirect and
+// are not replayed after the login, so they get 401 Unauthorized,
+// unless the portal is configured to redirect all the requests.
+func isLoginRedirectAllowed(r *http.Request, opts map[string]interface{}) bool {
+	if v, _ := opts["unauthenticated_requests"].(string); v != "method" {
+		return true
+	}
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// serveLoginRedirect redirects the unauthenticated request to the
+// location, or responds with 401 Unauthorized when the method of the
+// request is unsafe.
+func serveLoginRedirect(w http.ResponseWriter, r *http.Request, opts map[string]interface{}, location string) error {
+	if !isLoginRedirectAllowed(r, opts) {
+		return serveUnauthenticated(w, r, opts)
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(302)
+	return nil
+}
+
+// serveUnauthenticated responds with 401 Unauthorized, in JSON or HTML
+// depending on the requested content type.
+func serveUnauthenticated(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	opts["flow"] = "unauthenticated"
+	opts["authenticated"] = false
+	opts["message"] = "Please sign in and submit the request again."
+	return ServeGeneric(w, r, opts)
+}
+
+// getRedirectURL returns the URL held by the redirect cookie. When the
+// redirect cookie is signed, the values failing the signature
+// verification are rejected.
+func getRedirectURL(c *cookies.Cookies, value string) (*url.URL, error) {
+	s, err := c.VerifyRedirectURL(value)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(s)
+}
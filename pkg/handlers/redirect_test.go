@@ -0,0 +1,144 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeSessionLoginRedirect(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		redirectCount string
+		statusCode    int
+		setCookie     string
+	}{
+		{redirectCount: "", statusCode: 302, setCookie: "AUTH_PORTAL_REDIRECT_COUNT=1;"},
+		{redirectCount: "malformed", statusCode: 302, setCookie: "AUTH_PORTAL_REDIRECT_COUNT=1;"},
+		{redirectCount: "2", statusCode: 302, setCookie: "AUTH_PORTAL_REDIRECT_COUNT=3;"},
+		{redirectCount: "3", statusCode: 500, setCookie: "AUTH_PORTAL_REDIRECT_COUNT=delete;"},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, redirect count: %q", i, test.redirectCount)
+		r := httptest.NewRequest("GET", "/app", nil)
+		if test.redirectCount != "" {
+			r.AddCookie(&http.Cookie{Name: "AUTH_PORTAL_REDIRECT_COUNT", Value: test.redirectCount})
+		}
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":                "abc",
+			"logger":                    utils.NewLogger(),
+			"auth_url_path":             "/auth",
+			"cookie_names":              []string{"AUTH_PORTAL_REDIRECT_URL", "access_token"},
+			"cookies":                   &cookies.Cookies{},
+			"redirect_count_token_name": "AUTH_PORTAL_REDIRECT_COUNT",
+			"redirect_loop_threshold":   3,
+			"content_type":              "application/json",
+			"ui":                        ui.NewUserInterfaceFactory(),
+		}
+		ServeSessionLoginRedirect(w, r, opts)
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received)", testDescr, test.statusCode, w.Code)
+			testFailed++
+			continue
+		}
+		found := false
+		for _, v := range w.Header()["Set-Cookie"] {
+			if strings.HasPrefix(v, test.setCookie) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Logf("FAIL: %s, cookie %s not found in %v", testDescr, test.setCookie, w.Header()["Set-Cookie"])
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestServeLoginRedirect(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		method      string
+		mode        string
+		contentType string
+		statusCode  int
+	}{
+		{method: "GET", mode: "method", contentType: "text/html", statusCode: 302},
+		{method: "HEAD", mode: "method", contentType: "text/html", statusCode: 302},
+		{method: "POST", mode: "method", contentType: "text/html", statusCode: 401},
+		{method: "DELETE", mode: "method", contentType: "application/json", statusCode: 401},
+		{method: "POST", mode: "redirect", contentType: "text/html", statusCode: 302},
+		{method: "PUT", mode: "", contentType: "application/json", statusCode: 302},
+	}
+
+	uiFactory := ui.NewUserInterfaceFactory()
+	if err := uiFactory.AddBuiltinTemplate("basic/generic"); err != nil {
+		t.Fatalf("failed loading generic template: %s", err)
+	}
+	uiFactory.Templates["generic"] = uiFactory.Templates["basic/generic"]
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, method: %s, mode: %q", i, test.method, test.mode)
+		r := httptest.NewRequest(test.method, "/auth/settings", nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":               "abc",
+			"flow":                     "settings",
+			"logger":                   utils.NewLogger(),
+			"auth_url_path":            "/auth",
+			"authenticated":            false,
+			"content_type":             test.contentType,
+			"unauthenticated_requests": test.mode,
+			"ui":                       uiFactory,
+		}
+		serveLoginRedirect(w, r, opts, "/auth?redirect_url=/auth/settings")
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received)", testDescr, test.statusCode, w.Code)
+			testFailed++
+			continue
+		}
+		if test.statusCode == 302 && w.Header().Get("Location") != "/auth?redirect_url=/auth/settings" {
+			t.Logf("FAIL: %s, unexpected location: %s", testDescr, w.Header().Get("Location"))
+			testFailed++
+			continue
+		}
+		if test.statusCode == 401 && test.contentType == "application/json" && !strings.Contains(w.Body.String(), `"message":"Unauthorized"`) {
+			t.Logf("FAIL: %s, unexpected body: %s", testDescr, w.Body.String())
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
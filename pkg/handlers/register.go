@@ -15,12 +15,19 @@
 package handlers
 
 import (
+	"fmt"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/enumeration"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
 	"github.com/greenpau/caddy-auth-portal/pkg/registration"
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
 	"github.com/greenpau/caddy-auth-portal/pkg/validators"
 	"github.com/greenpau/go-identity"
 	"go.uber.org/zap"
+	"html"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // ServeRegister returns registration page.
@@ -29,13 +36,28 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 	log := opts["logger"].(*zap.Logger)
 	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
 	authURLPath := opts["auth_url_path"].(string)
+	var invitation *registration.Invitation
 	registration := opts["registration"].(*registration.Registration)
 	registrationDatabase := opts["registration_db"].(*identity.Database)
+	var antiEnumeration *enumeration.AntiEnumeration
+	if v, exists := opts["anti_enumeration"]; exists {
+		antiEnumeration = v.(*enumeration.AntiEnumeration)
+	}
+	var profileSchema *profile.Schema
+	if v, exists := opts["profile_schema"]; exists && v.(*profile.Schema).Enabled() {
+		profileSchema = v.(*profile.Schema)
+	}
+	var usernamePolicy *validators.UsernamePolicy
+	if v, exists := opts["username_policy"]; exists {
+		usernamePolicy = v.(*validators.UsernamePolicy)
+	}
+	var profileValues map[string]string
+	startedAt := time.Now()
 
 	var message string
 	var maxBytesLimit int64 = 1000
 	var minBytesLimit int64 = 15
-	var userHandle, userMail, userSecret, userSecretConfirm, userCode string
+	var userHandle, userMail, userSecret, userSecretConfirm, userCode, userInvitation string
 	var userAccept, validUserRegistration bool
 
 	if opts["authenticated"].(bool) {
@@ -45,8 +67,7 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 	}
 
 	if registration.Dropbox == "" {
-		opts["flow"] = "unsupported_feature"
-		return ServeGeneric(w, r, opts)
+		return ServeUnsupported(w, r, opts, "register")
 	}
 
 	if registrationDatabase == nil {
@@ -64,35 +85,64 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 
 	// If the requested content type is JSON, then handle it separately.
 	if opts["content_type"].(string) == "application/json" {
-		opts["flow"] = "unsupported_feature"
+		return ServeUnsupported(w, r, opts, "register")
+	}
+
+	if profileSchema != nil {
+		maxBytesLimit += profileSchema.GetMaxFormSize()
+	}
+	if usernamePolicy != nil && usernamePolicy.MaxLength > 25 {
+		// The encoding of a character takes up to 12 bytes, e.g. %E2%82%AC.
+		maxBytesLimit += int64((usernamePolicy.MaxLength - 25) * 12)
+	}
+
+	if r.Method == "POST" && (r.ContentLength > maxBytesLimit || r.ContentLength < minBytesLimit) {
+		log.Warn(
+			"request payload violated limits",
+			zap.String("request_id", reqID),
+			zap.Int64("min_size_limit", minBytesLimit),
+			zap.Int64("max_size_limit", maxBytesLimit),
+			zap.Int64("request_size", r.ContentLength),
+		)
+		opts["flow"] = "policy_violation"
+		return ServeGeneric(w, r, opts)
+	}
+	if r.Method == "POST" && r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		log.Warn(
+			"request payload violated content type",
+			zap.String("request_id", reqID),
+			zap.String("request_content_type", r.Header.Get("Content-Type")),
+			zap.String("expected_content_type", "application/x-www-form-urlencoded"),
+		)
+		opts["flow"] = "policy_violation"
 		return ServeGeneric(w, r, opts)
 	}
 
-	// Handle registration submission
-	if r.Method == "POST" {
-		validUserRegistration = true
-		if r.ContentLength > maxBytesLimit || r.ContentLength < minBytesLimit {
-			log.Warn(
-				"request payload violated limits",
-				zap.String("request_id", reqID),
-				zap.Int64("min_size_limit", minBytesLimit),
-				zap.Int64("max_size_limit", maxBytesLimit),
-				zap.Int64("request_size", r.ContentLength),
-			)
-			opts["flow"] = "policy_violation"
-			return ServeGeneric(w, r, opts)
-		}
-		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
-			log.Warn(
-				"request payload violated content type",
-				zap.String("request_id", reqID),
-				zap.String("request_content_type", r.Header.Get("Content-Type")),
-				zap.String("expected_content_type", "application/x-www-form-urlencoded"),
-			)
-			opts["flow"] = "policy_violation"
-			return ServeGeneric(w, r, opts)
+	// Handle the steps of the registration wizard. The registration
+	// proceeds once the last step is submitted.
+	submitted := r.Method == "POST"
+	var wizard *registrationWizard
+	if registration.Wizard.Enabled() {
+		wizard = &registrationWizard{}
+		if submitted {
+			var err error
+			wizard, message, err = advanceRegistrationWizard(r, opts, registration, profileSchema, usernamePolicy)
+			if err != nil {
+				log.Warn(
+					"failed saving registration wizard",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+				opts["flow"] = "internal_server_error"
+				return ServeGeneric(w, r, opts)
+			}
+			submitted = wizard.complete
 		}
+	}
 
+	// Handle registration submission
+	if submitted {
+		validUserRegistration = true
 		if err := r.ParseForm(); err != nil {
 			log.Warn(
 				"failed parsing submitted form",
@@ -114,12 +164,17 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 					userMail = v[0]
 				case "code":
 					userCode = v[0]
+				case "invitation":
+					userInvitation = v[0]
 				case "accept_terms":
 					if v[0] == "on" {
 						userAccept = true
 					}
 				case "submit":
 				default:
+					if profileSchema != nil && profileSchema.IsFormField(k) {
+						continue
+					}
 					log.Warn(
 						"request payload contains unsupported field",
 						zap.String("request_id", reqID),
@@ -152,32 +207,32 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 			}
 		}
 
-		for _, k := range []string{"username", "password", "email"} {
-			if !validUserRegistration {
-				break
+		if validUserRegistration {
+			if msg := validateRegistrationAccount(registration, usernamePolicy, userHandle, userSecret, userMail); msg != "" {
+				validUserRegistration = false
+				message = msg
 			}
-			switch k {
-			case "username":
-				handleOpts := make(map[string]interface{})
-				if err := validators.ValidateUserInput("handle", userHandle, handleOpts); err != nil {
-					validUserRegistration = false
-					message = "Failed processing the registration form due " + err.Error()
-				}
-			case "password":
-				secretOpts := make(map[string]interface{})
-				if err := validators.ValidateUserInput("secret", userSecret, secretOpts); err != nil {
-					validUserRegistration = false
-					message = "Failed processing the registration form due " + err.Error()
-				}
-			case "email":
-				emailOpts := make(map[string]interface{})
-				if registration.RequireDomainMailRecord {
-					emailOpts["check_domain_mx"] = true
-				}
-				if err := validators.ValidateUserInput(k, userMail, emailOpts); err != nil {
-					validUserRegistration = false
-					message = "Failed processing the registration form due " + err.Error()
-				}
+		}
+		if validUserRegistration {
+			if err := checkPasswordBreach(opts, userSecret); err != nil {
+				validUserRegistration = false
+				message = err.Error()
+			}
+		}
+		if profileSchema != nil && validUserRegistration {
+			var err error
+			profileValues, err = profileSchema.Parse(r.Form)
+			if err != nil {
+				validUserRegistration = false
+				message = "Failed processing the registration form due to invalid profile: " + err.Error()
+			}
+		}
+		if registration.RequireInvitation && validUserRegistration {
+			var err error
+			invitation, err = consumeInvitation(registration, userInvitation, userMail, opts)
+			if err != nil {
+				validUserRegistration = false
+				message = "Failed processing the registration form due to invalid invitation: " + err.Error()
 			}
 		}
 		if !validUserRegistration {
@@ -196,6 +251,9 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 	} else {
 		resp.Title = registration.Title
 	}
+	if v, exists := opts["registration_realm"]; exists {
+		resp.Data["registration_realm"] = v
+	}
 
 	if registration.RequireAcceptTerms {
 		resp.Data["require_accept_terms"] = true
@@ -205,11 +263,33 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 		resp.Data["require_registration_code"] = true
 	}
 
+	if usernamePolicy != nil {
+		resp.Data["username_pattern"] = usernamePolicy.Pattern
+		resp.Data["username_min_length"] = usernamePolicy.MinLength
+		resp.Data["username_max_length"] = usernamePolicy.MaxLength
+	}
+
+	if profileSchema != nil {
+		resp.Data["profile_fields"] = profileSchema.Fields
+	}
+
+	if registration.RequireInvitation {
+		resp.Data["require_invitation"] = true
+		if r.Method == "GET" {
+			userInvitation = r.URL.Query().Get("invitation")
+		}
+		resp.Data["invitation"] = html.EscapeString(userInvitation)
+	}
+
+	if wizard != nil {
+		addRegistrationWizardData(resp, wizard, registration.Wizard, profileSchema)
+	}
+
 	if message != "" {
 		resp.Message = message
 	}
 
-	if r.Method == "POST" && validUserRegistration {
+	if submitted && validUserRegistration {
 		// Perform registration tasks
 		user := identity.NewUser(userHandle)
 		if err := user.AddPassword(userSecret); err != nil {
@@ -236,13 +316,38 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 				zap.String("error", err.Error()),
 			)
 		}
+		if invitation != nil {
+			for _, role := range invitation.Roles {
+				if err := user.AddRole(role); err != nil {
+					validUserRegistration = false
+					message = "Internal Server Error"
+					log.Warn("failed associating invitation role during registration",
+						zap.String("request_id", reqID),
+						zap.String("error", err.Error()),
+					)
+				}
+			}
+		}
+		// The concurrent registrations of the same username are serialized,
+		// so that one of them succeeds and the others find the username
+		// taken.
+		unlock := registration.LockUsername(userHandle)
 		if err := registrationDatabase.AddUser(user); err != nil {
-			validUserRegistration = false
-			message = "Failed Registration"
-			log.Warn("failed adding user to registration database",
-				zap.String("request_id", reqID),
-				zap.String("error", err.Error()),
-			)
+			if antiEnumeration != nil && antiEnumeration.Enabled && isDuplicateUserError(err) {
+				// Respond as if the registration succeeded, so that the
+				// response does not reveal the existing account.
+				log.Warn("ignored registration of existing user",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+			} else {
+				validUserRegistration = false
+				message = getDuplicateUserMessage(err)
+				log.Warn("failed adding user to registration database",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+			}
 		}
 		if err := registrationDatabase.SaveToFile(registration.Dropbox); err != nil {
 			validUserRegistration = false
@@ -252,6 +357,20 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 				zap.String("error", err.Error()),
 			)
 		}
+		if validUserRegistration && len(profileValues) > 0 {
+			if err := saveRegistrationProfile(registration.Dropbox, user.ID, profileValues); err != nil {
+				validUserRegistration = false
+				message = "Internal Server Error"
+				log.Warn("failed saving registration profile",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+			}
+		}
+		unlock()
+		if invitation != nil && !validUserRegistration {
+			registration.Invitations.Release(invitation.Token)
+		}
 		if validUserRegistration {
 			log.Info("Processed registration",
 				zap.String("request_id", reqID),
@@ -261,7 +380,7 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 		}
 	}
 
-	if r.Method == "POST" {
+	if submitted {
 		if !validUserRegistration {
 			if message == "" {
 				resp.Message = "Failed registration"
@@ -271,16 +390,19 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 		} else {
 			resp.Title = "Thank you!"
 			resp.Data["registered"] = true
+			if wizard != nil {
+				opts["session_cache"].(*cache.SessionCache).Delete(registrationWizardCachePrefix + wizard.id)
+			}
 		}
 	}
 
+	if r.Method == "POST" {
+		antiEnumeration.Pad(startedAt)
+	}
+
 	content, err := uiFactory.Render("register", resp)
 	if err != nil {
-		log.Error("Failed HTML response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(500)
-		w.Write([]byte(`Internal Server Error`))
-		return err
+		return serveFallback(w, opts, "register", err)
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -288,3 +410,87 @@ func ServeRegister(w http.ResponseWriter, r *http.Request, opts map[string]inter
 	w.Write(content.Bytes())
 	return nil
 }
+
+// consumeInvitation marks the invitation as used. It returns an error when
+// the invitation is invalid, or was issued for another email address or
+// realm.
+func consumeInvitation(registration *registration.Registration, token, email string, opts map[string]interface{}) (*registration.Invitation, error) {
+	if registration.Invitations == nil {
+		return nil, fmt.Errorf("invitations are not available")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	invitation, err := registration.Invitations.Get(token)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Email != "" && !strings.EqualFold(invitation.Email, email) {
+		return nil, fmt.Errorf("invitation was issued for another email address")
+	}
+	var realm string
+	if v, exists := opts["registration_realm"]; exists {
+		realm = v.(string)
+	}
+	if invitation.Realm != realm {
+		return nil, fmt.Errorf("invitation was issued for another realm")
+	}
+	return registration.Invitations.Consume(token)
+}
+
+// saveRegistrationProfile saves the profile fields of the registered user
+// alongside the registration database.
+func saveRegistrationProfile(dropbox, userID string, values map[string]string) error {
+	store, err := profile.OpenStore(dropbox + profile.StoreSuffix)
+	if err != nil {
+		return err
+	}
+	return store.Set(userID, values)
+}
+
+// isDuplicateUserError returns true when the error indicates that the
+// username or the email address is already registered.
+func isDuplicateUserError(err error) bool {
+	switch err.Error() {
+	case "username already exists", "email address already associated with another user":
+		return true
+	}
+	return false
+}
+
+// getDuplicateUserMessage returns the message explaining why adding the
+// user to the registration database failed.
+func getDuplicateUserMessage(err error) string {
+	switch err.Error() {
+	case "username already exists":
+		return "Failed processing the registration form due to the username being taken"
+	case "email address already associated with another user":
+		return "Failed processing the registration form due to the email address being registered"
+	}
+	return "Failed Registration"
+}
+
+// validateRegistrationAccount returns the message explaining why the
+// username, password, or email address is invalid. It returns an empty
+// string when the values are valid.
+func validateRegistrationAccount(cfg *registration.Registration, usernamePolicy *validators.UsernamePolicy, userHandle, userSecret, userMail string) string {
+	handleOpts := make(map[string]interface{})
+	if usernamePolicy != nil {
+		handleOpts["username_policy"] = usernamePolicy
+	}
+	if err := validators.ValidateUserInput("handle", userHandle, handleOpts); err != nil {
+		return "Failed processing the registration form due " + err.Error()
+	}
+	secretOpts := make(map[string]interface{})
+	if err := validators.ValidateUserInput("secret", userSecret, secretOpts); err != nil {
+		return "Failed processing the registration form due " + err.Error()
+	}
+	emailOpts := make(map[string]interface{})
+	if cfg.RequireDomainMailRecord {
+		emailOpts["check_domain_mx"] = true
+	}
+	if err := validators.ValidateUserInput("email", userMail, emailOpts); err != nil {
+		return "Failed processing the registration form due " + err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,504 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/enumeration"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
+	"github.com/greenpau/caddy-auth-portal/pkg/registration"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+	"github.com/greenpau/go-identity"
+)
+
+func TestServeRegisterAntiEnumeration(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		enabled   bool
+		identical bool
+	}{
+		{enabled: false, identical: false},
+		{enabled: true, identical: true},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, anti-enumeration enabled: %t", i, test.enabled)
+		uiFactory := ui.NewUserInterfaceFactory()
+		if err := uiFactory.AddBuiltinTemplate("basic/register"); err != nil {
+			t.Fatalf("failed loading register template: %s", err)
+		}
+		uiFactory.Templates["register"] = uiFactory.Templates["basic/register"]
+		cfg := &registration.Registration{
+			Dropbox: filepath.Join(t.TempDir(), "registrations.json"),
+		}
+		db := identity.NewDatabase()
+
+		var bodies []string
+		var codes []int
+		// The second registration uses the username of the first one.
+		for _, email := range []string{"jsmith@contoso.com", "john.smith@contoso.com"} {
+			form := url.Values{}
+			form.Set("username", "jsmith")
+			form.Set("password", "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83")
+			form.Set("password_confirm", "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83")
+			form.Set("email", email)
+			r := httptest.NewRequest("POST", "/auth/register", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			opts := map[string]interface{}{
+				"request_id":      "abc",
+				"logger":          utils.NewLogger(),
+				"ui":              uiFactory,
+				"auth_url_path":   "/auth",
+				"authenticated":   false,
+				"content_type":    "text/html",
+				"registration":    cfg,
+				"registration_db": db,
+				"anti_enumeration": &enumeration.AntiEnumeration{
+					Enabled:         test.enabled,
+					MinResponseTime: 1,
+				},
+			}
+			ServeRegister(w, r, opts)
+			bodies = append(bodies, w.Body.String())
+			codes = append(codes, w.Code)
+		}
+
+		identical := codes[0] == codes[1] && bodies[0] == bodies[1]
+		if identical != test.identical {
+			t.Logf("FAIL: %s, responses identical: %t (expected) vs. %t (received)", testDescr, test.identical, identical)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestServeRegisterInvitation(t *testing.T) {
+	testFailed := 0
+	uiFactory := ui.NewUserInterfaceFactory()
+	if err := uiFactory.AddBuiltinTemplate("basic/register"); err != nil {
+		t.Fatalf("failed loading register template: %s", err)
+	}
+	uiFactory.Templates["register"] = uiFactory.Templates["basic/register"]
+	cfg := &registration.Registration{
+		Dropbox:           filepath.Join(t.TempDir(), "registrations.json"),
+		RequireInvitation: true,
+		Invitations:       registration.NewInvitationStore(),
+	}
+	db := identity.NewDatabase()
+
+	valid := &registration.Invitation{Roles: []string{"editor"}}
+	expired := &registration.Invitation{}
+	bound := &registration.Invitation{Email: "jane.smith@contoso.com"}
+	for _, invitation := range []*registration.Invitation{valid, bound} {
+		if err := cfg.Invitations.Add(invitation, 60); err != nil {
+			t.Fatalf("failed creating invitation: %s", err)
+		}
+	}
+	if err := cfg.Invitations.Add(expired, -1); err != nil {
+		t.Fatalf("failed creating invitation: %s", err)
+	}
+
+	tests := []struct {
+		descr      string
+		username   string
+		email      string
+		invitation string
+		registered bool
+		message    string
+	}{
+		{descr: "no invitation", username: "jsmith", email: "jsmith@contoso.com", message: "invitation not found"},
+		{descr: "unknown invitation", username: "jsmith", email: "jsmith@contoso.com", invitation: "foo", message: "invitation not found"},
+		{descr: "expired invitation", username: "jsmith", email: "jsmith@contoso.com", invitation: expired.Token, message: "invitation expired"},
+		{descr: "email mismatch", username: "jsmith", email: "jsmith@contoso.com", invitation: bound.Token, message: "invitation was issued for another email address"},
+		{descr: "valid invitation", username: "jsmith", email: "jsmith@contoso.com", invitation: valid.Token, registered: true},
+		{descr: "used invitation", username: "jdoe", email: "jdoe@contoso.com", invitation: valid.Token, message: "invitation already used"},
+		{descr: "bound invitation", username: "janesmith", email: "Jane.Smith@contoso.com", invitation: bound.Token, registered: true},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.descr)
+		form := url.Values{}
+		form.Set("username", test.username)
+		form.Set("password", "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83")
+		form.Set("password_confirm", "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83")
+		form.Set("email", test.email)
+		form.Set("invitation", test.invitation)
+		r := httptest.NewRequest("POST", "/auth/register", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":      "abc",
+			"logger":          utils.NewLogger(),
+			"ui":              uiFactory,
+			"auth_url_path":   "/auth",
+			"authenticated":   false,
+			"content_type":    "text/html",
+			"registration":    cfg,
+			"registration_db": db,
+		}
+		ServeRegister(w, r, opts)
+		body := w.Body.String()
+		registered := strings.Contains(body, "Thank you!")
+		if registered != test.registered {
+			t.Logf("FAIL: %s, registered: %t (expected) vs. %t (received)", testDescr, test.registered, registered)
+			testFailed++
+			continue
+		}
+		if test.message != "" && !strings.Contains(body, test.message) {
+			t.Logf("FAIL: %s, response has no %q message", testDescr, test.message)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	user, err := db.GetUserByUsername("jsmith")
+	if err != nil {
+		t.Fatalf("failed finding registered user: %s", err)
+	}
+	if !user.HasRole("editor") {
+		t.Fatalf("registered user has no invitation role")
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestServeRegisterWizard(t *testing.T) {
+	testFailed := 0
+	uiFactory := ui.NewUserInterfaceFactory()
+	if err := uiFactory.AddBuiltinTemplate("basic/register"); err != nil {
+		t.Fatalf("failed loading register template: %s", err)
+	}
+	uiFactory.Templates["register"] = uiFactory.Templates["basic/register"]
+	profileSchema := &profile.Schema{
+		Fields: []*profile.Field{
+			{Name: "department", Required: true},
+		},
+	}
+	if err := profileSchema.Configure(); err != nil {
+		t.Fatalf("failed configuring profile schema: %s", err)
+	}
+	cfg := &registration.Registration{
+		Dropbox:            filepath.Join(t.TempDir(), "registrations.json"),
+		Code:               "NY2020",
+		RequireAcceptTerms: true,
+		Wizard: &registration.Wizard{
+			Steps: []*registration.WizardStep{
+				{Type: "account"},
+				{Type: "profile"},
+				{Type: "verification"},
+			},
+		},
+	}
+	if err := cfg.Wizard.Configure(profileSchema.FieldNames()); err != nil {
+		t.Fatalf("failed configuring registration wizard: %s", err)
+	}
+	db := identity.NewDatabase()
+	sessionCache := cache.NewSessionCache()
+	wizardIDRegex := regexp.MustCompile(`name="wizard_id" value="([^"]*)"`)
+	secret := "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83"
+
+	tests := []struct {
+		descr      string
+		method     string
+		form       map[string]string
+		contains   []string
+		excludes   []string
+		registered bool
+	}{
+		{descr: "first step", method: "GET", contains: []string{"Step 1 of 3: Account"}},
+		{
+			descr:    "mismatched passwords",
+			method:   "POST",
+			form:     map[string]string{"username": "jsmith", "email": "jsmith@contoso.com", "password": secret, "password_confirm": "foo", "action": "next"},
+			contains: []string{"Step 1 of 3", "mismatched passwords"},
+			excludes: []string{secret},
+		},
+		{
+			descr:    "account step",
+			method:   "POST",
+			form:     map[string]string{"password_confirm": secret, "action": "next"},
+			contains: []string{"Step 2 of 3: Profile", `name="profile_department"`},
+			excludes: []string{`name="username"`},
+		},
+		{
+			descr:    "back to account step",
+			method:   "POST",
+			form:     map[string]string{"profile_department": "IT", "action": "back"},
+			contains: []string{"Step 1 of 3", `value="jsmith"`, "Leave blank to keep the password"},
+			excludes: []string{secret},
+		},
+		{
+			descr:    "account step with kept passwords",
+			method:   "POST",
+			form:     map[string]string{"username": "jsmith", "email": "jsmith@contoso.com", "password": "", "password_confirm": "", "action": "next"},
+			contains: []string{"Step 2 of 3", `value="IT"`},
+		},
+		{
+			descr:    "profile step",
+			method:   "POST",
+			form:     map[string]string{"profile_department": "IT", "action": "next"},
+			contains: []string{"Step 3 of 3: Verification", `name="code"`},
+		},
+		{
+			descr:    "invalid code",
+			method:   "POST",
+			form:     map[string]string{"code": "foo", "accept_terms": "on", "action": "next"},
+			contains: []string{"Step 3 of 3", "invalid verification code"},
+		},
+		{
+			descr:      "verification step",
+			method:     "POST",
+			form:       map[string]string{"code": "NY2020", "accept_terms": "on", "action": "next"},
+			registered: true,
+		},
+		{
+			descr:    "completed wizard",
+			method:   "POST",
+			form:     map[string]string{"code": "NY2020", "accept_terms": "on", "action": "next"},
+			contains: []string{"Step 1 of 3", "The registration expired"},
+		},
+	}
+
+	var wizardID string
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.descr)
+		r := httptest.NewRequest("GET", "/auth/register", nil)
+		if test.method == "POST" {
+			form := url.Values{}
+			form.Set("wizard_id", wizardID)
+			for k, v := range test.form {
+				form.Set(k, v)
+			}
+			r = httptest.NewRequest("POST", "/auth/register", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":      "abc",
+			"logger":          utils.NewLogger(),
+			"ui":              uiFactory,
+			"auth_url_path":   "/auth",
+			"authenticated":   false,
+			"content_type":    "text/html",
+			"registration":    cfg,
+			"registration_db": db,
+			"profile_schema":  profileSchema,
+			"session_cache":   sessionCache,
+		}
+		ServeRegister(w, r, opts)
+		body := w.Body.String()
+		if m := wizardIDRegex.FindStringSubmatch(body); m != nil && m[1] != "" {
+			wizardID = m[1]
+		}
+		registered := strings.Contains(body, "Thank you!")
+		if registered != test.registered {
+			t.Logf("FAIL: %s, registered: %t (expected) vs. %t (received)", testDescr, test.registered, registered)
+			testFailed++
+			continue
+		}
+		mismatch := false
+		for _, s := range test.contains {
+			if !strings.Contains(body, s) {
+				t.Logf("FAIL: %s, response has no %q", testDescr, s)
+				mismatch = true
+			}
+		}
+		for _, s := range test.excludes {
+			if strings.Contains(body, s) {
+				t.Logf("FAIL: %s, response has %q", testDescr, s)
+				mismatch = true
+			}
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if _, err := db.GetUserByUsername("jsmith"); err != nil {
+		t.Fatalf("failed finding registered user: %s", err)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestServeRegisterConcurrent(t *testing.T) {
+	uiFactory := ui.NewUserInterfaceFactory()
+	if err := uiFactory.AddBuiltinTemplate("basic/register"); err != nil {
+		t.Fatalf("failed loading register template: %s", err)
+	}
+	uiFactory.Templates["register"] = uiFactory.Templates["basic/register"]
+	cfg := &registration.Registration{
+		Dropbox: filepath.Join(t.TempDir(), "registrations.json"),
+	}
+	db := identity.NewDatabase()
+
+	const count = 10
+	var wg sync.WaitGroup
+	bodies := make([]string, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			form := url.Values{}
+			form.Set("username", "jsmith")
+			form.Set("password", "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83")
+			form.Set("password_confirm", "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83")
+			form.Set("email", fmt.Sprintf("jsmith%d@contoso.com", i))
+			r := httptest.NewRequest("POST", "/auth/register", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			opts := map[string]interface{}{
+				"request_id":       "abc",
+				"logger":           utils.NewLogger(),
+				"ui":               uiFactory,
+				"auth_url_path":    "/auth",
+				"authenticated":    false,
+				"content_type":     "text/html",
+				"registration":     cfg,
+				"registration_db":  db,
+				"anti_enumeration": &enumeration.AntiEnumeration{},
+			}
+			ServeRegister(w, r, opts)
+			bodies[i] = w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	var taken int
+	for _, body := range bodies {
+		if strings.Contains(body, "username being taken") {
+			taken++
+		}
+	}
+	if taken != count-1 {
+		t.Fatalf("expected %d registrations rejected due to the taken username, got %d", count-1, taken)
+	}
+	if len(db.Users) != 1 {
+		t.Fatalf("expected 1 registered user, got %d", len(db.Users))
+	}
+}
+
+func TestServeRegisterBreachedPassword(t *testing.T) {
+	testFailed := 0
+	// The suffix of the SHA-1 hash of "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83"
+	// is returned for any prefix.
+	password := "4cfe0b26-7e80-4a89-9d0c-0e0d3a1fbe83"
+	sum := sha1.Sum([]byte(password))
+	suffix := strings.ToUpper(hex.EncodeToString(sum[:]))[5:]
+	breachedSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s:12\r\n", suffix)
+	}))
+	defer breachedSrv.Close()
+	unavailableSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailableSrv.Close()
+
+	tests := []struct {
+		check      *validators.BreachCheck
+		registered bool
+		message    string
+	}{
+		{
+			check:   &validators.BreachCheck{URL: breachedSrv.URL + "/range/"},
+			message: "Password has appeared in a data breach",
+		},
+		{
+			check:   &validators.BreachCheck{URL: unavailableSrv.URL + "/range/"},
+			message: "Password breach check is unavailable",
+		},
+		{
+			check:      &validators.BreachCheck{URL: unavailableSrv.URL + "/range/", FailOpen: true},
+			registered: true,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, url: %s, fail open: %t", i, test.check.URL, test.check.FailOpen)
+		if err := test.check.Configure(); err != nil {
+			t.Fatalf("failed configuring password breach check: %s", err)
+		}
+		uiFactory := ui.NewUserInterfaceFactory()
+		if err := uiFactory.AddBuiltinTemplate("basic/register"); err != nil {
+			t.Fatalf("failed loading register template: %s", err)
+		}
+		uiFactory.Templates["register"] = uiFactory.Templates["basic/register"]
+		db := identity.NewDatabase()
+		form := url.Values{}
+		form.Set("username", "jsmith")
+		form.Set("password", password)
+		form.Set("password_confirm", password)
+		form.Set("email", "jsmith@contoso.com")
+		r := httptest.NewRequest("POST", "/auth/register", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":            "abc",
+			"logger":                utils.NewLogger(),
+			"ui":                    uiFactory,
+			"auth_url_path":         "/auth",
+			"authenticated":         false,
+			"content_type":          "text/html",
+			"registration":          &registration.Registration{Dropbox: filepath.Join(t.TempDir(), "registrations.json")},
+			"registration_db":       db,
+			"anti_enumeration":      &enumeration.AntiEnumeration{},
+			"password_breach_check": test.check,
+		}
+		ServeRegister(w, r, opts)
+		registered := len(db.Users) == 1
+		if registered != test.registered {
+			t.Logf("FAIL: %s, registered: %t (expected) vs. %t (received)", testDescr, test.registered, registered)
+			testFailed++
+			continue
+		}
+		if test.message != "" && !strings.Contains(w.Body.String(), test.message) {
+			t.Logf("FAIL: %s, response has no message: %s", testDescr, test.message)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
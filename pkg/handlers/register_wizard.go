@@ -0,0 +1,233 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"html"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
+	"github.com/greenpau/caddy-auth-portal/pkg/registration"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+)
+
+// registrationWizardCachePrefix is the prefix of the session cache
+// entries holding the partial state of the registration wizards.
+const registrationWizardCachePrefix = "registration_wizard:"
+
+// registrationWizard is the partial state of a multi-step registration.
+type registrationWizard struct {
+	id     string
+	step   int
+	values url.Values
+	// The switch indicating that the last step was submitted.
+	complete bool
+}
+
+// getRegistrationWizardFields returns the names of the form inputs of
+// the step.
+func getRegistrationWizardFields(step *registration.WizardStep) []string {
+	switch step.Type {
+	case "account":
+		return []string{"username", "email", "password", "password_confirm", "invitation"}
+	case "profile":
+		var names []string
+		for _, name := range step.Fields {
+			names = append(names, profile.FormFieldPrefix+name)
+		}
+		return names
+	case "verification":
+		return []string{"code", "invitation", "accept_terms"}
+	}
+	return nil
+}
+
+// loadRegistrationWizard returns the partial state of the wizard. It
+// returns nil when the state does not exist or expired.
+func loadRegistrationWizard(sessionCache *cache.SessionCache, id string) *registrationWizard {
+	if id == "" {
+		return nil
+	}
+	data := sessionCache.Get(registrationWizardCachePrefix + id)
+	if data == nil {
+		return nil
+	}
+	if expiresAt, ok := data["expires_at"].(time.Time); !ok || time.Now().After(expiresAt) {
+		sessionCache.Delete(registrationWizardCachePrefix + id)
+		return nil
+	}
+	wz := &registrationWizard{id: id, values: make(url.Values)}
+	wz.step, _ = data["step"].(int)
+	if values, ok := data["values"].(url.Values); ok {
+		for k, v := range values {
+			wz.values[k] = v
+		}
+	}
+	return wz
+}
+
+// save stores the partial state of the wizard. The state expires after
+// the lifetime unless the next step is submitted.
+func (wz *registrationWizard) save(sessionCache *cache.SessionCache, lifetime int) error {
+	if wz.id == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		wz.id = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return sessionCache.Add(registrationWizardCachePrefix+wz.id, map[string]interface{}{
+		"step":       wz.step,
+		"values":     wz.values,
+		"expires_at": time.Now().Add(time.Duration(lifetime) * time.Second),
+	})
+}
+
+// advanceRegistrationWizard handles the submission of a step of the
+// wizard. The values of the step are validated and merged into the
+// partial state. When the last step is valid, the submitted form is
+// replaced with the values collected at all steps, so that the
+// registration proceeds as with a single form. It returns the wizard
+// and the message explaining the failed validation, if any.
+func advanceRegistrationWizard(r *http.Request, opts map[string]interface{}, cfg *registration.Registration, profileSchema *profile.Schema, usernamePolicy *validators.UsernamePolicy) (*registrationWizard, string, error) {
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+	if err := r.ParseForm(); err != nil {
+		return &registrationWizard{}, "Failed processing the registration form", nil
+	}
+	var message string
+	wz := &registrationWizard{values: make(url.Values)}
+	if wizardID := r.PostForm.Get("wizard_id"); wizardID != "" {
+		if wz = loadRegistrationWizard(sessionCache, wizardID); wz == nil {
+			return &registrationWizard{}, "The registration expired. Please start over.", nil
+		}
+	}
+	step := cfg.Wizard.Steps[wz.step]
+	stepFields := make(map[string]bool)
+	for _, k := range getRegistrationWizardFields(step) {
+		stepFields[k] = true
+	}
+	for k := range r.PostForm {
+		switch {
+		case k == "wizard_id", k == "action", stepFields[k]:
+		default:
+			return wz, "Failed processing the registration form due to unsupported field", nil
+		}
+	}
+
+	// Merge the values of the step. The empty passwords keep the ones
+	// submitted earlier, because the passwords are not rendered back.
+	for k := range stepFields {
+		v, exists := r.PostForm[k]
+		switch {
+		case !exists && k == "accept_terms":
+			wz.values.Del(k)
+		case !exists:
+		case (k == "password" || k == "password_confirm") && v[0] == "" && wz.values.Get(k) != "":
+		default:
+			wz.values[k] = v[:1]
+		}
+	}
+
+	switch {
+	case r.PostForm.Get("action") == "back":
+		if wz.step > 0 {
+			wz.step--
+		}
+	default:
+		message = validateRegistrationWizardStep(step, wz.values, cfg, profileSchema, usernamePolicy)
+		if message != "" {
+			break
+		}
+		if wz.step == len(cfg.Wizard.Steps)-1 {
+			wz.complete = true
+			r.Form = make(url.Values)
+			for k, v := range wz.values {
+				r.Form[k] = v
+			}
+			r.PostForm = r.Form
+		} else {
+			wz.step++
+		}
+	}
+	if err := wz.save(sessionCache, cfg.Wizard.Lifetime); err != nil {
+		return nil, "", err
+	}
+	return wz, message, nil
+}
+
+// validateRegistrationWizardStep returns the message explaining why the
+// values of the step are invalid. It returns an empty string when the
+// values are valid. The last step of the wizard revalidates all values.
+func validateRegistrationWizardStep(step *registration.WizardStep, values url.Values, cfg *registration.Registration, profileSchema *profile.Schema, usernamePolicy *validators.UsernamePolicy) string {
+	switch step.Type {
+	case "account":
+		if values.Get("password") != values.Get("password_confirm") {
+			return "Failed processing the registration form due to mismatched passwords"
+		}
+		return validateRegistrationAccount(cfg, usernamePolicy, values.Get("username"), values.Get("password"), values.Get("email"))
+	case "profile":
+		if profileSchema == nil {
+			return ""
+		}
+		if _, err := profileSchema.Select(step.Fields).Parse(values); err != nil {
+			return "Failed processing the registration form due to invalid profile: " + err.Error()
+		}
+	case "verification":
+		if cfg.Code != "" && values.Get("code") != cfg.Code {
+			return "Failed processing the registration form due to invalid verification code"
+		}
+		if cfg.RequireAcceptTerms && values.Get("accept_terms") != "on" {
+			return "Failed processing the registration form due to the failure to accept terms and conditions"
+		}
+	}
+	return ""
+}
+
+// addRegistrationWizardData adds the current step of the wizard to the
+// registration page. The submitted values, except the passwords, are
+// rendered back to the form.
+func addRegistrationWizardData(resp *ui.UserInterfaceArgs, wz *registrationWizard, cfg *registration.Wizard, profileSchema *profile.Schema) {
+	step := cfg.Steps[wz.step]
+	resp.Data["wizard_id"] = wz.id
+	resp.Data["wizard_step"] = step.Type
+	resp.Data["wizard_step_title"] = html.EscapeString(step.Title)
+	resp.Data["wizard_step_number"] = wz.step + 1
+	resp.Data["wizard_step_count"] = len(cfg.Steps)
+	resp.Data["wizard_last_step"] = wz.step == len(cfg.Steps)-1
+	if step.Type == "profile" && profileSchema != nil {
+		resp.Data["profile_fields"] = profileSchema.Select(step.Fields).Fields
+	}
+	values := make(map[string]string)
+	for k := range wz.values {
+		switch k {
+		case "password", "password_confirm":
+			continue
+		}
+		values[k] = html.EscapeString(wz.values.Get(k))
+	}
+	resp.Data["wizard_values"] = values
+	if v := values["invitation"]; v != "" {
+		resp.Data["invitation"] = v
+	}
+	if wz.values.Get("password") != "" {
+		resp.Data["wizard_password_set"] = true
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/mfa"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// maxReverifyAttempts is the number of failed re-verification attempts
+// after which the session is invalidated.
+const maxReverifyAttempts = 5
+
+// ServeReverify returns the page asking the user of a session used from
+// another source address to confirm the user's identity with the user's
+// password or MFA code. Upon success, the session is bound to the new
+// address.
+func ServeReverify(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	authURLPath := opts["auth_url_path"].(string)
+
+	// Add non-caching headers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if !opts["authenticated"].(bool) {
+		return serveLoginRedirect(w, r, opts, authURLPath)
+	}
+	if opts["backend"] == nil {
+		w.Header().Set("Location", authURLPath)
+		w.WriteHeader(302)
+		return nil
+	}
+
+	if opts["content_type"].(string) == "application/json" {
+		opts["flow"] = "auth_failed"
+		opts["message"] = "Session re-verification required"
+		return ServeGeneric(w, r, opts)
+	}
+
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	backend := opts["backend"].(*backends.Backend)
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+	cfg := opts["mfa"].(*mfa.Config)
+
+	var mfaMethod *mfa.Method
+	tokens, err := backend.GetMfaTokens(map[string]interface{}{
+		"username": claims.Subject,
+		"email":    claims.Email,
+	})
+	if err == nil {
+		if methods := cfg.GetMethods(tokens); len(methods) > 0 {
+			mfaMethod = methods[0]
+		}
+	}
+
+	resp := uiFactory.GetArgs()
+	resp.Title = "Confirm Your Identity"
+	resp.Data["action"] = path.Join(authURLPath, "reverify")
+	resp.Data["username"] = claims.Subject
+	if mfaMethod != nil {
+		resp.Data["mfa_method"] = mfaMethod
+	}
+	statusCode := 200
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			opts["flow"] = "policy_violation"
+			return ServeGeneric(w, r, opts)
+		}
+		var verifyErr error
+		if code := r.PostFormValue("code"); code != "" && mfaMethod != nil {
+			_, verifyErr = mfaMethod.Verify(tokens, code)
+		} else {
+			verifyErr = verifyPassword(backend, claims, r.PostFormValue("password"))
+		}
+		if verifyErr == nil {
+			sessionCache.Set(claims.ID, "src_ip", opts["src_ip"])
+			sessionCache.Set(claims.ID, "user_agent", r.UserAgent())
+			sessionCache.Set(claims.ID, "reverify_attempts", 0)
+			sessionCache.Set(claims.ID, "reverify_required", false)
+			log.Info("Session re-verified",
+				zap.String("request_id", reqID),
+				zap.String("session_id", claims.ID),
+				zap.String("user", claims.Subject),
+				zap.String("src_ip_address", utils.GetSourceAddress(r)),
+			)
+			w.Header().Set("Location", authURLPath)
+			w.WriteHeader(302)
+			return nil
+		}
+		log.Warn("Session re-verification failed",
+			zap.String("request_id", reqID),
+			zap.String("session_id", claims.ID),
+			zap.String("user", claims.Subject),
+			zap.String("error", verifyErr.Error()),
+		)
+		if sessionCache.Increment(claims.ID, "reverify_attempts") >= maxReverifyAttempts {
+			sessionCache.Set(claims.ID, "invalidated", true)
+			cookies := opts["cookies"].(*cookies.Cookies)
+			for _, name := range opts["token_cookie_names"].([]string) {
+				w.Header().Add("Set-Cookie", name+"=delete;"+cookies.GetDeleteAttributes())
+			}
+			opts["flow"] = "auth_failed"
+			opts["message"] = "Too many failed attempts, please log in again"
+			return ServeGeneric(w, r, opts)
+		}
+		resp.Message = "Verification failed"
+		statusCode = 401
+	}
+
+	content, err := uiFactory.Render("reverify", resp)
+	if err != nil {
+		return serveFallback(w, opts, "reverify", err)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(statusCode)
+	w.Write(content.Bytes())
+	return nil
+}
+
+// verifyPassword authenticates the user of the session with the backend
+// the user authenticated with.
+func verifyPassword(backend *backends.Backend, claims *jwtclaims.UserClaims, password string) error {
+	if password == "" {
+		return fmt.Errorf("no password found")
+	}
+	resp, err := backend.Authenticate(map[string]interface{}{
+		"auth_credentials": map[string]string{
+			"username": claims.Subject,
+			"password": password,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if resp["code"] != 200 {
+		return fmt.Errorf("authentication failed")
+	}
+	if v, exists := resp["claims"]; !exists || v.(*jwtclaims.UserClaims).Subject != claims.Subject {
+		return fmt.Errorf("authenticated user mismatch")
+	}
+	return nil
+}
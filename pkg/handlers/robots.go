@@ -0,0 +1,31 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/robots"
+)
+
+// ServeRobots returns robots.txt.
+func ServeRobots(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	cfg := opts["robots"].(*robots.Robots)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.WriteHeader(200)
+	w.Write([]byte(cfg.Content))
+	return nil
+}
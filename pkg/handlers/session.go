@@ -0,0 +1,153 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"go.uber.org/zap"
+)
+
+// ServeSessionPing records the activity of the session of an
+// authenticated user, and returns the expiry of the session in JSON
+// format. The session expires when the token expires or, when the
+// idle timeout is set, when the session is idle for too long, or, when
+// the maximum session age is set, when the session gets too old,
+// whichever comes first.
+func ServeSessionPing(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	resp := make(map[string]interface{})
+	statusCode := 200
+	if opts["authenticated"].(bool) {
+		resp["authenticated"] = true
+		if v, exists := opts["session_idle_timeout"]; exists {
+			resp["idle_timeout"] = v.(int) * 60
+		}
+		if expiresAt := getSessionExpiry(opts); expiresAt > 0 {
+			resp["expires_at"] = expiresAt
+			resp["expires_in"] = expiresAt - time.Now().Unix()
+		}
+	} else {
+		resp["authenticated"] = false
+		resp["message"] = "session is invalid"
+		statusCode = 401
+		if writeUnauthorizedBody(w, r, opts, "Unauthorized", "session is invalid") {
+			return nil
+		}
+	}
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.Error("Failed JSON response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(500)
+		w.Write([]byte(`Internal Server Error`))
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(payload)
+	return nil
+}
+
+// SessionDetails is the information about the current session of a user
+// displayed on the settings page.
+type SessionDetails struct {
+	ID              string
+	Method          string
+	Realm           string
+	SourceAddress   string
+	UserAgent       string
+	AuthenticatedAt time.Time
+	ExpiresAt       time.Time
+}
+
+// NewSessionDetails returns the details of the session derived from the
+// claims of the user and the cached session entry, if any.
+func NewSessionDetails(claims *jwtclaims.UserClaims, session map[string]interface{}) *SessionDetails {
+	details := &SessionDetails{
+		ID:            claims.ID,
+		SourceAddress: claims.Address,
+	}
+	if claims.IssuedAt > 0 {
+		details.AuthenticatedAt = time.Unix(claims.IssuedAt, 0)
+	}
+	if claims.ExpiresAt > 0 {
+		details.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+	if session == nil {
+		return details
+	}
+	if v, ok := session["backend_method"].(string); ok {
+		details.Method = v
+	}
+	if v, ok := session["backend_realm"].(string); ok {
+		details.Realm = v
+	}
+	if v, ok := session["src_ip"].(string); ok && v != "" {
+		details.SourceAddress = v
+	}
+	if v, ok := session["user_agent"].(string); ok {
+		details.UserAgent = v
+	}
+	if v, ok := session["authenticated_at"].(time.Time); ok {
+		details.AuthenticatedAt = v
+	}
+	return details
+}
+
+// getSessionExpiry returns the time, in seconds since epoch, the session
+// of the authenticated user expires, assuming no further activity. It
+// returns zero when the session does not expire.
+func getSessionExpiry(opts map[string]interface{}) int64 {
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	expiresAt := claims.ExpiresAt
+	if v, exists := opts["session_idle_timeout"]; exists {
+		idleExpiresAt := time.Now().Add(time.Duration(v.(int)) * time.Minute).Unix()
+		if expiresAt == 0 || idleExpiresAt < expiresAt {
+			expiresAt = idleExpiresAt
+		}
+	}
+	if v, exists := opts["session_max_expires_at"]; exists {
+		if maxExpiresAt := v.(int64); expiresAt == 0 || maxExpiresAt < expiresAt {
+			expiresAt = maxExpiresAt
+		}
+	}
+	return expiresAt
+}
+
+// addSessionExpiry adds the expiry of the session and the URL of the
+// session ping endpoint to the template context of an authenticated page,
+// when the user interface emits them.
+func addSessionExpiry(resp *ui.UserInterfaceArgs, opts map[string]interface{}) {
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	if !uiFactory.SessionExpiryMeta || !opts["authenticated"].(bool) {
+		return
+	}
+	if expiresAt := getSessionExpiry(opts); expiresAt > 0 {
+		resp.Data["session_expires_at"] = expiresAt
+	}
+	resp.Data["session_ping_url"] = path.Join(opts["auth_url_path"].(string), "session", "ping")
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeSessionPing(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		authenticated bool
+		expiresIn     int64
+		idleTimeout   int
+		maxAgeLeft    int64
+		statusCode    int
+		maxExpiresIn  int64
+	}{
+		{authenticated: false, statusCode: 401},
+		{authenticated: true, expiresIn: 3600, statusCode: 200, maxExpiresIn: 3600},
+		{authenticated: true, expiresIn: 3600, idleTimeout: 15, statusCode: 200, maxExpiresIn: 900},
+		{authenticated: true, expiresIn: 300, idleTimeout: 15, statusCode: 200, maxExpiresIn: 300},
+		{authenticated: true, expiresIn: 3600, idleTimeout: 15, maxAgeLeft: 120, statusCode: 200, maxExpiresIn: 120},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, authenticated: %t, expires in: %d, idle timeout: %d", i, test.authenticated, test.expiresIn, test.idleTimeout)
+		r := httptest.NewRequest("GET", "/auth/session/ping", nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":    "abc",
+			"logger":        utils.NewLogger(),
+			"authenticated": test.authenticated,
+		}
+		if test.authenticated {
+			opts["user_claims"] = &jwtclaims.UserClaims{
+				Subject:   "jsmith",
+				ExpiresAt: time.Now().Unix() + test.expiresIn,
+			}
+		}
+		if test.idleTimeout > 0 {
+			opts["session_idle_timeout"] = test.idleTimeout
+		}
+		if test.maxAgeLeft > 0 {
+			opts["session_max_expires_at"] = time.Now().Unix() + test.maxAgeLeft
+		}
+		ServeSessionPing(w, r, opts)
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code mismatch: %d (expected) vs. %d (received)", testDescr, test.statusCode, w.Code)
+			testFailed++
+			continue
+		}
+		resp := make(map[string]interface{})
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Logf("FAIL: %s, malformed response: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if resp["authenticated"] != test.authenticated {
+			t.Logf("FAIL: %s, authenticated mismatch: %v", testDescr, resp["authenticated"])
+			testFailed++
+			continue
+		}
+		if test.authenticated {
+			expiresIn := int64(resp["expires_in"].(float64))
+			if expiresIn > test.maxExpiresIn || expiresIn < test.maxExpiresIn-5 {
+				t.Logf("FAIL: %s, expires_in mismatch: %d (expected) vs. %d (received)", testDescr, test.maxExpiresIn, expiresIn)
+				testFailed++
+				continue
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestNewSessionDetails(t *testing.T) {
+	testFailed := 0
+	authenticatedAt := time.Now().Add(-time.Hour)
+	claims := &jwtclaims.UserClaims{
+		ID:        "abc",
+		Subject:   "jsmith",
+		Address:   "10.0.0.1",
+		IssuedAt:  authenticatedAt.Add(-time.Minute).Unix(),
+		ExpiresAt: authenticatedAt.Add(time.Hour).Unix(),
+	}
+	tests := []struct {
+		session  map[string]interface{}
+		expected *SessionDetails
+	}{
+		{
+			session: nil,
+			expected: &SessionDetails{
+				ID:              "abc",
+				SourceAddress:   "10.0.0.1",
+				AuthenticatedAt: time.Unix(claims.IssuedAt, 0),
+				ExpiresAt:       time.Unix(claims.ExpiresAt, 0),
+			},
+		},
+		{
+			session: map[string]interface{}{
+				"backend_method":   "local",
+				"backend_realm":    "local",
+				"authenticated_at": authenticatedAt,
+				"src_ip":           "10.0.0.2",
+				"user_agent":       "curl/7.64.1",
+			},
+			expected: &SessionDetails{
+				ID:              "abc",
+				Method:          "local",
+				Realm:           "local",
+				SourceAddress:   "10.0.0.2",
+				UserAgent:       "curl/7.64.1",
+				AuthenticatedAt: authenticatedAt,
+				ExpiresAt:       time.Unix(claims.ExpiresAt, 0),
+			},
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, session: %v", i, test.session)
+		details := NewSessionDetails(claims, test.session)
+		if *details != *test.expected {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, details)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestSessionExpiryMeta(t *testing.T) {
+	testFailed := 0
+	expiresAt := time.Now().Unix() + 3600
+	tests := []struct {
+		enabled     bool
+		idleTimeout int
+		expected    []string
+		unexpected  []string
+	}{
+		{
+			enabled:    false,
+			unexpected: []string{`name="session-expires-at"`, `name="session-ping-url"`},
+		},
+		{
+			enabled: true,
+			expected: []string{
+				fmt.Sprintf(`<meta name="session-expires-at" content="%d">`, expiresAt),
+				`<meta name="session-ping-url" content="/auth/session/ping">`,
+			},
+		},
+		{
+			enabled:     true,
+			idleTimeout: 15,
+			unexpected:  []string{fmt.Sprintf(`content="%d"`, expiresAt)},
+			expected:    []string{`name="session-expires-at"`},
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, enabled: %t, idle timeout: %d", i, test.enabled, test.idleTimeout)
+		uiFactory := ui.NewUserInterfaceFactory()
+		if err := uiFactory.AddBuiltinTemplate("basic/portal"); err != nil {
+			t.Fatalf("failed loading portal template: %s", err)
+		}
+		uiFactory.Templates["portal"] = uiFactory.Templates["basic/portal"]
+		uiFactory.SessionExpiryMeta = test.enabled
+		r := httptest.NewRequest("GET", "/auth/portal", nil)
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":          "abc",
+			"logger":              utils.NewLogger(),
+			"ui":                  uiFactory,
+			"auth_url_path":       "/auth",
+			"cookies":             &cookies.Cookies{},
+			"redirect_token_name": "AUTH_PORTAL_REDIRECT_URL",
+			"authenticated":       true,
+			"content_type":        "text/html",
+			"user_claims":         &jwtclaims.UserClaims{Subject: "jsmith", ExpiresAt: expiresAt},
+		}
+		if test.idleTimeout > 0 {
+			opts["session_idle_timeout"] = test.idleTimeout
+		}
+		ServePortal(w, r, opts)
+		body := w.Body.String()
+		mismatch := false
+		for _, s := range test.expected {
+			if !strings.Contains(body, s) {
+				t.Logf("FAIL: %s, page does not contain %s", testDescr, s)
+				mismatch = true
+			}
+		}
+		for _, s := range test.unexpected {
+			if strings.Contains(body, s) {
+				t.Logf("FAIL: %s, page contains %s", testDescr, s)
+				mismatch = true
+			}
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -23,6 +23,10 @@ import (
 
 	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
 	"github.com/greenpau/caddy-auth-portal/pkg/backends"
+	"github.com/greenpau/caddy-auth-portal/pkg/email"
+	"github.com/greenpau/caddy-auth-portal/pkg/mfa"
+	"github.com/greenpau/caddy-auth-portal/pkg/profile"
+	"github.com/greenpau/caddy-auth-portal/pkg/recovery"
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
 	"github.com/greenpau/caddy-auth-portal/pkg/utils"
 	"go.uber.org/zap"
@@ -35,9 +39,7 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 	var backend *backends.Backend
 	authURLPath := opts["auth_url_path"].(string)
 	if !opts["authenticated"].(bool) {
-		w.Header().Set("Location", authURLPath+"?redirect_url="+r.RequestURI)
-		w.WriteHeader(302)
-		return nil
+		return serveLoginRedirect(w, r, opts, authURLPath+"?redirect_url="+r.RequestURI)
 	}
 	reqID := opts["request_id"].(string)
 	log := opts["logger"].(*zap.Logger)
@@ -59,6 +61,35 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 	// Display main authentication portal page
 	resp := uiFactory.GetArgs()
 	resp.Title = "Settings"
+	addSessionExpiry(resp, opts)
+
+	var recoveryCfg *recovery.Recovery
+	if v, exists := opts["recovery"]; exists {
+		recoveryCfg = v.(*recovery.Recovery)
+		if !recoveryCfg.QuestionsEnabled() || backend == nil || backend.GetMethod() != "local" {
+			recoveryCfg = nil
+		}
+	}
+	if recoveryCfg != nil {
+		resp.Data["recovery_enabled"] = true
+	}
+
+	if v, exists := opts["email_change"]; exists && v.(*email.Change).Enabled {
+		if backend != nil && backend.GetMethod() == "local" {
+			resp.Data["email_change_enabled"] = true
+		}
+	}
+
+	if v, exists := opts["profile_schema"]; exists && v.(*profile.Schema).Enabled() {
+		if backend != nil && backend.GetMethod() == "local" {
+			resp.Data["profile_enabled"] = true
+		}
+	}
+
+	var mfaCfg *mfa.Config
+	if v, exists := opts["mfa"]; exists {
+		mfaCfg = v.(*mfa.Config)
+	}
 
 	switch view {
 	case "mfa":
@@ -175,6 +206,16 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 						}
 					}
 				}
+			case "revoke":
+				view = viewParts[0] + "-" + viewParts[1] + "-status"
+				count := mfaCfg.RevokeTrustedDevices(claims.Subject, backend.GetRealm())
+				log.Debug("revoked trusted devices",
+					zap.String("request_id", reqID),
+					zap.String("user", claims.Subject),
+					zap.Int("count", count),
+				)
+				resp.Data["status"] = "SUCCESS"
+				resp.Data["status_reason"] = fmt.Sprintf("revoked trust in %d device(s)", count)
 			case "delete":
 				view = viewParts[0] + "-" + viewParts[1] + "-status"
 				resp.Data["status"] = "FAIL"
@@ -266,6 +307,10 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 					resp.Data["mfa_tokens"] = mfaTokens
 				}
 			}
+			if mfaCfg.DeviceTrustEnabled() {
+				resp.Data["device_trust_enabled"] = true
+				resp.Data["trusted_devices"] = mfaCfg.GetTrustedDevices(claims.Subject, backend.GetRealm())
+			}
 		}
 	case "password":
 		if len(viewParts) > 1 {
@@ -277,6 +322,8 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 						if secrets, err := validatePasswordChangeForm(r); err != nil {
 							resp.Data["status"] = "failure"
 							resp.Data["status_reason"] = "Bad Request"
+						} else if err := checkPasswordBreach(opts, secrets["new_password"]); err != nil {
+							resp.Data["status_reason"] = err.Error()
 						} else {
 							operation := make(map[string]interface{})
 							operation["name"] = "password_change"
@@ -286,7 +333,7 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 								operation[k] = v
 							}
 							if err := backend.Do(operation); err != nil {
-								resp.Data["status_reason"] = fmt.Sprintf("%s", err)
+								resp.Data["status_reason"] = getPasswordChangeMessage(operation, err)
 							} else {
 								resp.Data["status"] = "success"
 								resp.Data["status_reason"] = "Password has been changed"
@@ -428,17 +475,56 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 				view = strings.Join(viewParts, "-")
 			}
 		}
+	case "recovery":
+		if recoveryCfg == nil {
+			view = "recovery-disabled"
+			break
+		}
+		recoveryKey := backend.GetRealm() + "/" + claims.Subject
+		if len(viewParts) > 1 && viewParts[1] == "edit" && r.Method == "POST" {
+			view = "recovery-edit"
+			resp.Data["status"] = "failure"
+			if answers, err := validateSecurityAnswersForm(r, recoveryCfg); err != nil {
+				resp.Data["status_reason"] = err.Error()
+			} else if err := recoveryCfg.GetDatabase().SetAnswers(recoveryKey, claims.Email, answers); err != nil {
+				log.Error("Failed saving security answers",
+					zap.String("request_id", reqID),
+					zap.String("error", err.Error()),
+				)
+				resp.Data["status_reason"] = "Internal Server Error"
+			} else {
+				resp.Data["status"] = "success"
+				resp.Data["status_reason"] = "Security answers have been saved"
+			}
+			break
+		}
+		view = "recovery"
+		resp.Data["recovery_questions"] = recoveryCfg.Questions
+		resp.Data["recovery_required_answers"] = recoveryCfg.RequiredAnswers
+		answered := make(map[string]bool)
+		for _, id := range recoveryCfg.GetDatabase().GetQuestionIDs(recoveryKey) {
+			answered[id] = true
+		}
+		resp.Data["recovery_answered"] = answered
+	case "email":
+		view = serveEmailSettings(r, opts, resp, viewParts)
+	case "profile":
+		view = serveProfileSettings(r, opts, resp, viewParts)
+	case "session":
+		var session map[string]interface{}
+		if v, exists := opts["session"]; exists {
+			session = v.(map[string]interface{})
+		}
+		resp.Data["session"] = NewSessionDetails(claims, session)
+		resp.Data["current_src_ip"] = utils.GetSourceAddress(r)
+		resp.Data["current_user_agent"] = r.UserAgent()
 	}
 
 	resp.Data["view"] = view
 
 	content, err := uiFactory.Render("settings", resp)
 	if err != nil {
-		log.Error("Failed HTML response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(500)
-		w.Write([]byte(`Internal Server Error`))
-		return err
+		return serveFallback(w, opts, "settings", err)
 	}
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(200)
@@ -446,6 +532,30 @@ func ServeSettings(w http.ResponseWriter, r *http.Request, opts map[string]inter
 	return nil
 }
 
+func validateSecurityAnswersForm(r *http.Request, cfg *recovery.Recovery) (map[string]string, error) {
+	if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return nil, fmt.Errorf("Unsupported content type")
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("Failed parsing submitted form")
+	}
+	answers := make(map[string]string)
+	for _, q := range cfg.Questions {
+		v := strings.TrimSpace(r.PostFormValue("answer_" + q.ID))
+		if v == "" {
+			continue
+		}
+		if len(v) > 255 {
+			return nil, fmt.Errorf("Answer exceeds 255 characters")
+		}
+		answers[q.ID] = v
+	}
+	if len(answers) < cfg.RequiredAnswers {
+		return nil, fmt.Errorf("At least %d questions must be answered", cfg.RequiredAnswers)
+	}
+	return answers, nil
+}
+
 func validatePasswordChangeForm(r *http.Request) (map[string]string, error) {
 	if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
 		return nil, fmt.Errorf("Unsupported content type")
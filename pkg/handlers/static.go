@@ -17,16 +17,19 @@ package handlers
 import (
 	"github.com/greenpau/caddy-auth-portal/pkg/ui"
 	"go.uber.org/zap"
-	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-// ServeStaticAssets serves static pages.
+// ServeStaticAssets serves static pages. The responses have cache
+// validators, i.e. ETag and Last-Modified headers, and the conditional
+// requests with matching validators receive 304 Not Modified.
 func ServeStaticAssets(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
 	reqID := opts["request_id"].(string)
 	log := opts["logger"].(*zap.Logger)
 	urlPath := opts["url_path"].(string)
+	maxAge := opts["static_asset_max_age"].(int)
 
 	if strings.HasPrefix(urlPath, "favicon") {
 		urlPath = "assets/images/" + urlPath
@@ -44,17 +47,11 @@ func ServeStaticAssets(w http.ResponseWriter, r *http.Request, opts map[string]i
 	}
 
 	w.Header().Set("Content-Type", asset.ContentType)
-	w.Header().Set("Etag", asset.Checksum)
-	w.Header().Set("Cache-Control", "max-age=7200")
+	w.Header().Set("ETag", `"`+asset.Checksum+`"`)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
 
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if strings.Contains(match, asset.Checksum) {
-			w.WriteHeader(http.StatusNotModified)
-			return nil
-		}
-	}
-
-	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, asset.Content)
+	// The ServeContent handles If-None-Match, If-Modified-Since,
+	// and range requests.
+	http.ServeContent(w, r, urlPath, asset.ModTime, strings.NewReader(asset.Content))
 	return nil
 }
@@ -0,0 +1,102 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeStaticAssets(t *testing.T) {
+	testFailed := 0
+	urlPath := "assets/css/styles.css"
+	asset, err := ui.StaticAssets.GetAsset(urlPath)
+	if err != nil {
+		t.Fatalf("failed getting asset: %s", err)
+	}
+	etag := `"` + asset.Checksum + `"`
+
+	tests := []struct {
+		headers    map[string]string
+		statusCode int
+	}{
+		{statusCode: 200},
+		{headers: map[string]string{"If-None-Match": etag}, statusCode: 304},
+		{headers: map[string]string{"If-None-Match": `"foo", ` + etag}, statusCode: 304},
+		{headers: map[string]string{"If-None-Match": `"foo"`}, statusCode: 200},
+		{headers: map[string]string{"If-Modified-Since": asset.ModTime.Format(http.TimeFormat)}, statusCode: 304},
+		{headers: map[string]string{"If-Modified-Since": asset.ModTime.Add(-time.Hour).Format(http.TimeFormat)}, statusCode: 200},
+		{
+			// If-None-Match takes precedence over If-Modified-Since.
+			headers: map[string]string{
+				"If-None-Match":     `"foo"`,
+				"If-Modified-Since": asset.ModTime.Format(http.TimeFormat),
+			},
+			statusCode: 200,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, headers: %v", i, test.headers)
+		r := httptest.NewRequest("GET", "/auth/"+urlPath, nil)
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":           "abc",
+			"logger":               utils.NewLogger(),
+			"url_path":             urlPath,
+			"static_asset_max_age": 3600,
+		}
+		ServeStaticAssets(w, r, opts)
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received)", testDescr, test.statusCode, w.Code)
+			testFailed++
+			continue
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Logf("FAIL: %s, etag: %s (expected) vs. %s (received)", testDescr, etag, w.Header().Get("ETag"))
+			testFailed++
+			continue
+		}
+		if w.Header().Get("Cache-Control") != "max-age=3600" {
+			t.Logf("FAIL: %s, cache control: %s", testDescr, w.Header().Get("Cache-Control"))
+			testFailed++
+			continue
+		}
+		if test.statusCode == 200 && w.Body.String() != asset.Content {
+			t.Logf("FAIL: %s, body mismatch", testDescr)
+			testFailed++
+			continue
+		}
+		if test.statusCode == 304 && w.Body.Len() > 0 {
+			t.Logf("FAIL: %s, not modified response has body", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
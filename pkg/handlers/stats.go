@@ -0,0 +1,56 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// ServeSessionStats returns the statistics of the session cache in JSON
+// format. Only the authenticated users having one of the admin roles may
+// use it.
+func ServeSessionStats(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	cfg := opts["session_stats"].(*sessions.Stats)
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+
+	if !cfg.Enabled() {
+		return writeTransferResponse(w, http.StatusNotFound, map[string]interface{}{"error": "not_found"})
+	}
+	if !opts["authenticated"].(bool) {
+		return writeTransferResponse(w, http.StatusUnauthorized, map[string]interface{}{"error": "unauthorized"})
+	}
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	if !cfg.IsAdmin(claims.Roles) {
+		log.Warn("Session stats denied",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("src_ip_address", utils.GetSourceAddress(r)),
+		)
+		return writeTransferResponse(w, http.StatusForbidden, map[string]interface{}{"error": "forbidden"})
+	}
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		return writeTransferResponse(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": "method_not_allowed"})
+	}
+	return writeTransferResponse(w, http.StatusOK, sessionCache.Stats())
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"path"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/ui"
+)
+
+// serveLoginSuccess returns the page confirming the login. It shows the
+// authenticated identity and the link to the portal.
+func serveLoginSuccess(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	uiFactory := opts["ui"].(*ui.UserInterfaceFactory)
+	authURLPath := opts["auth_url_path"].(string)
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+
+	resp := uiFactory.GetArgs()
+	resp.Title = "Signed In"
+	switch {
+	case claims.Name != "":
+		resp.Data["user_name"] = html.EscapeString(claims.Name)
+	case claims.Subject != "":
+		resp.Data["user_name"] = html.EscapeString(claims.Subject)
+	default:
+		resp.Data["user_name"] = html.EscapeString(claims.Email)
+	}
+	if claims.Email != "" {
+		resp.Data["user_email"] = html.EscapeString(claims.Email)
+	}
+	if claims.ExpiresAt > 0 {
+		resp.Data["expires_at_utc"] = time.Unix(claims.ExpiresAt, 0).UTC().Format(time.UnixDate)
+	}
+	resp.Data["destination"] = path.Join(authURLPath, "portal")
+
+	content, err := uiFactory.Render("login_success", resp)
+	if err != nil {
+		return serveFallback(w, opts, "login_success", err)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	w.Write(content.Bytes())
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"github.com/greenpau/caddy-auth-portal/pkg/signing"
+)
+
+// NewUserToken returns a JWT token signed by the token provider. The custom
+// claims, if any, are added to the token alongside the user claims. They
+// do not override the standard claims.
+func NewUserToken(tokenProvider *jwtconfig.CommonTokenConfig, claims *jwtclaims.UserClaims, customClaims map[string]interface{}) (string, error) {
+	var signingKey interface{}
+	var keyID string
+	switch tokenProvider.TokenSignMethod {
+	case "HS512", "HS384", "HS256":
+		if len(customClaims) == 0 {
+			return claims.GetToken(tokenProvider.TokenSignMethod, []byte(tokenProvider.TokenSecret))
+		}
+		signingKey = []byte(tokenProvider.TokenSecret)
+	case "RS512", "RS384", "RS256":
+		privKey, kid, err := tokenProvider.GetPrivateKey()
+		if err != nil {
+			return "", err
+		}
+		if len(customClaims) == 0 {
+			tokenOpts := make(map[string]interface{})
+			tokenOpts["method"] = tokenProvider.TokenSignMethod
+			if kid != "" {
+				tokenOpts["kid"] = kid
+			}
+			tokenOpts["private_key"] = privKey
+			return claims.GetSignedToken(tokenOpts)
+		}
+		signingKey = privKey
+		keyID = kid
+	default:
+		return "", fmt.Errorf("invalid signing method: %s", tokenProvider.TokenSignMethod)
+	}
+
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	m := make(jwtlib.MapClaims)
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+	for k, v := range customClaims {
+		if _, exists := m[k]; exists {
+			continue
+		}
+		m[k] = v
+	}
+	token := jwtlib.NewWithClaims(jwtlib.GetSigningMethod(tokenProvider.TokenSignMethod), m)
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+	return token.SignedString(signingKey)
+}
+
+// standardClaims are the claims carried by the fields of the user claims.
+var standardClaims = map[string]bool{
+	"aud": true, "exp": true, "jti": true, "iat": true, "iss": true,
+	"nbf": true, "sub": true, "name": true, "email": true, "roles": true,
+	"origin": true, "scopes": true, "org": true, "acl": true, "addr": true,
+}
+
+// GetCustomClaims returns the claims of the token not carried by the
+// fields of the user claims, e.g. the custom claims added by the
+// backends. The token must have passed the validation beforehand,
+// because the function does not verify its signature.
+func GetCustomClaims(token string) (map[string]interface{}, error) {
+	tokenClaims := make(jwtlib.MapClaims)
+	if _, _, err := new(jwtlib.Parser).ParseUnverified(token, tokenClaims); err != nil {
+		return nil, err
+	}
+	var customClaims map[string]interface{}
+	for k, v := range tokenClaims {
+		if standardClaims[k] {
+			continue
+		}
+		if customClaims == nil {
+			customClaims = make(map[string]interface{})
+		}
+		customClaims[k] = v
+	}
+	return customClaims, nil
+}
+
+// addCustomClaims adds the custom claims to the map of claims. They do not
+// override the claims already present in the map.
+func addCustomClaims(m map[string]interface{}, customClaims map[string]interface{}) {
+	for k, v := range customClaims {
+		if _, exists := m[k]; exists {
+			continue
+		}
+		m[k] = v
+	}
+}
+
+// getRealmTokenProvider returns the token provider signing the tokens of
+// the realm. The realms without a signing key of their own use the
+// default token provider.
+func getRealmTokenProvider(opts map[string]interface{}, realm string) *jwtconfig.CommonTokenConfig {
+	if keyring, ok := opts["signing_keyring"].(*signing.Keyring); ok {
+		if tokenProvider := keyring.GetTokenProvider(realm); tokenProvider != nil {
+			return tokenProvider
+		}
+	}
+	return opts["token_provider"].(*jwtconfig.CommonTokenConfig)
+}
+
+// newSizedUserToken returns a JWT token not exceeding the maximum token
+// size of the cookies configuration. When the token exceeds the size and
+// trimming is configured, the low-priority claims are removed one by one
+// until the token fits. It returns the names of the removed claims.
+func newSizedUserToken(cfg *cookies.Cookies, tokenProvider *jwtconfig.CommonTokenConfig, claims *jwtclaims.UserClaims, customClaims map[string]interface{}) (string, []string, error) {
+	token, err := NewUserToken(tokenProvider, claims, customClaims)
+	if err != nil || cfg.MaxTokenSize == 0 || len(token) <= cfg.MaxTokenSize {
+		return token, nil, err
+	}
+	if cfg.TokenSizeAction != "trim" {
+		return "", nil, &tokenSizeError{size: len(token), limit: cfg.MaxTokenSize}
+	}
+	trimmedClaims := *claims
+	trimmedCustomClaims := make(map[string]interface{})
+	for k, v := range customClaims {
+		trimmedCustomClaims[k] = v
+	}
+	var trimmed []string
+	for _, name := range cfg.TrimClaims {
+		if !trimClaim(name, &trimmedClaims, trimmedCustomClaims) {
+			continue
+		}
+		trimmed = append(trimmed, name)
+		token, err = NewUserToken(tokenProvider, &trimmedClaims, trimmedCustomClaims)
+		if err != nil {
+			return "", trimmed, err
+		}
+		if len(token) <= cfg.MaxTokenSize {
+			return token, trimmed, nil
+		}
+	}
+	return "", trimmed, &tokenSizeError{size: len(token), limit: cfg.MaxTokenSize}
+}
+
+// trimClaim removes the claim. It returns false when the claim is absent.
+func trimClaim(name string, claims *jwtclaims.UserClaims, customClaims map[string]interface{}) bool {
+	switch name {
+	case "name":
+		if claims.Name == "" {
+			return false
+		}
+		claims.Name = ""
+	case "origin":
+		if claims.Origin == "" {
+			return false
+		}
+		claims.Origin = ""
+	case "roles":
+		if len(claims.Roles) == 0 {
+			return false
+		}
+		claims.Roles = nil
+	case "scopes":
+		if len(claims.Scopes) == 0 {
+			return false
+		}
+		claims.Scopes = nil
+	case "org":
+		if len(claims.Organizations) == 0 {
+			return false
+		}
+		claims.Organizations = nil
+	default:
+		if _, exists := customClaims[name]; !exists {
+			return false
+		}
+		delete(customClaims, name)
+	}
+	return true
+}
+
+// tokenSizeError is returned when the token exceeds the maximum size.
+type tokenSizeError struct {
+	size  int
+	limit int
+}
+
+func (e *tokenSizeError) Error() string {
+	return fmt.Sprintf("token size %d exceeds the limit of %d bytes", e.size, e.limit)
+}
+
+// checkIssuedToken returns an error when the validated token is older
+// than the maximum token age, or when the portal logged out or
+// invalidated its session. The services must not accept or exchange
+// the tokens the portal itself rejects.
+func checkIssuedToken(opts map[string]interface{}, claims *jwtclaims.UserClaims) error {
+	if maxAge, ok := opts["max_token_age"].(int); ok {
+		if err := sessions.CheckTokenAge(claims, maxAge, time.Now()); err != nil {
+			return err
+		}
+	}
+	if sessionCache, ok := opts["session_cache"].(*cache.SessionCache); ok {
+		return sessions.CheckRevoked(sessionCache, claims)
+	}
+	return nil
+}
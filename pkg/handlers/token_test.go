@@ -0,0 +1,272 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"reflect"
+	"testing"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+	"github.com/greenpau/caddy-auth-portal/pkg/cookies"
+)
+
+func TestNewUserToken(t *testing.T) {
+	testFailed := 0
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed generating RSA key: %s", err)
+	}
+
+	tests := []struct {
+		method       string
+		customClaims map[string]interface{}
+		expected     map[string]interface{}
+	}{
+		{
+			method: "HS512",
+		},
+		{
+			method: "HS512",
+			customClaims: map[string]interface{}{
+				"address.locality": "New York",
+				"email":            "attacker@contoso.com",
+				"roles":            []interface{}{"admin"},
+			},
+			expected: map[string]interface{}{
+				"address.locality": "New York",
+			},
+		},
+		{
+			method: "RS512",
+		},
+		{
+			method: "RS512",
+			customClaims: map[string]interface{}{
+				"address.locality": "New York",
+				"email":            "attacker@contoso.com",
+				"roles":            []interface{}{"admin"},
+			},
+			expected: map[string]interface{}{
+				"address.locality": "New York",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, method: %s, custom claims: %v", i, test.method, test.customClaims)
+		tokenProvider := jwtconfig.NewCommonTokenConfig()
+		tokenProvider.TokenSignMethod = test.method
+		tokenProvider.TokenSecret = "75f03764-147c-4d87-b2f0-4fda89e331c8"
+		tokenProvider.AddTokenKey("1", privKey)
+		claims := &jwtclaims.UserClaims{
+			Subject: "jsmith",
+			Email:   "jsmith@contoso.com",
+			Roles:   []string{"viewer"},
+		}
+
+		userToken, err := NewUserToken(tokenProvider, claims, test.customClaims)
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+
+		token, err := jwtlib.Parse(userToken, func(token *jwtlib.Token) (interface{}, error) {
+			if token.Method.Alg() != test.method {
+				return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+			}
+			if test.method == "RS512" {
+				if token.Header["kid"] != "1" {
+					return nil, fmt.Errorf("unexpected kid: %v", token.Header["kid"])
+				}
+				return &privKey.PublicKey, nil
+			}
+			return []byte(tokenProvider.TokenSecret), nil
+		})
+		if err != nil {
+			t.Logf("FAIL: %s, failed parsing token: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+
+		tokenClaims := token.Claims.(jwtlib.MapClaims)
+		if tokenClaims["email"] != "jsmith@contoso.com" {
+			t.Logf("FAIL: %s, email claim mismatch: %v", testDescr, tokenClaims["email"])
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(tokenClaims["roles"], []interface{}{"viewer"}) {
+			t.Logf("FAIL: %s, roles claim mismatch: %v", testDescr, tokenClaims["roles"])
+			testFailed++
+			continue
+		}
+		mismatch := false
+		for k, v := range test.expected {
+			if tokenClaims[k] != v {
+				t.Logf("FAIL: %s, %s claim mismatch: %v (expected) vs. %v (received)", testDescr, k, v, tokenClaims[k])
+				mismatch = true
+			}
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestNewSizedUserToken(t *testing.T) {
+	testFailed := 0
+	tokenProvider := jwtconfig.NewCommonTokenConfig()
+	tokenProvider.TokenSignMethod = "HS512"
+	tokenProvider.TokenSecret = "75f03764-147c-4d87-b2f0-4fda89e331c8"
+	claims := &jwtclaims.UserClaims{
+		Subject: "jsmith",
+		Email:   "jsmith@contoso.com",
+		Roles:   []string{"viewer", "editor", "admin"},
+	}
+	customClaims := map[string]interface{}{
+		"department": "Information Technology and Infrastructure Services",
+	}
+	fullToken, err := NewUserToken(tokenProvider, claims, customClaims)
+	if err != nil {
+		t.Fatalf("failed creating token: %s", err)
+	}
+
+	tests := []struct {
+		cfg        *cookies.Cookies
+		trimmed    []string
+		shouldFail bool
+	}{
+		{cfg: &cookies.Cookies{}},
+		{cfg: &cookies.Cookies{MaxTokenSize: len(fullToken)}},
+		{cfg: &cookies.Cookies{MaxTokenSize: len(fullToken) - 1, TokenSizeAction: "fail"}, shouldFail: true},
+		{
+			cfg:     &cookies.Cookies{MaxTokenSize: len(fullToken) - 1, TokenSizeAction: "trim", TrimClaims: []string{"name", "department", "roles"}},
+			trimmed: []string{"department"},
+		},
+		{
+			cfg:        &cookies.Cookies{MaxTokenSize: 100, TokenSizeAction: "trim", TrimClaims: []string{"department", "roles"}},
+			trimmed:    []string{"department", "roles"},
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, max size: %d, action: %s", i, test.cfg.MaxTokenSize, test.cfg.TokenSizeAction)
+		token, trimmed, err := newSizedUserToken(test.cfg, tokenProvider, claims, customClaims)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(trimmed, test.trimmed) {
+			t.Logf("FAIL: %s, trimmed claims mismatch: %v (expected) vs. %v (received)", testDescr, test.trimmed, trimmed)
+			testFailed++
+			continue
+		}
+		if test.cfg.MaxTokenSize > 0 && len(token) > test.cfg.MaxTokenSize {
+			t.Logf("FAIL: %s, token size %d exceeds the limit", testDescr, len(token))
+			testFailed++
+			continue
+		}
+		if len(claims.Roles) != 3 || customClaims["department"] == nil {
+			t.Fatalf("FAIL: %s, the original claims were modified", testDescr)
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestGetCustomClaims(t *testing.T) {
+	testFailed := 0
+	tokenProvider := jwtconfig.NewCommonTokenConfig()
+	tokenProvider.TokenSignMethod = "HS512"
+	tokenProvider.TokenSecret = "75f03764-147c-4d87-b2f0-4fda89e331c8"
+	claims := &jwtclaims.UserClaims{
+		Subject: "jsmith",
+		Email:   "jsmith@contoso.com",
+		Roles:   []string{"viewer"},
+		Scopes:  []string{"read"},
+	}
+
+	tests := []struct {
+		customClaims map[string]interface{}
+		expected     map[string]interface{}
+	}{
+		{},
+		{
+			customClaims: map[string]interface{}{
+				"department":       "IT",
+				"address.locality": "New York",
+				"groups":           []interface{}{"engineering"},
+			},
+			expected: map[string]interface{}{
+				"department":       "IT",
+				"address.locality": "New York",
+				"groups":           []interface{}{"engineering"},
+			},
+		},
+		{
+			customClaims: map[string]interface{}{
+				"email":      "attacker@contoso.com",
+				"department": "IT",
+			},
+			expected: map[string]interface{}{
+				"department": "IT",
+			},
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, custom claims: %v", i, test.customClaims)
+		token, err := NewUserToken(tokenProvider, claims, test.customClaims)
+		if err != nil {
+			t.Fatalf("failed creating token: %s", err)
+		}
+		customClaims, err := GetCustomClaims(token)
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(customClaims, test.expected) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, customClaims)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// ServeSessionTransfer exports the cached sessions in JSON format upon
+// GET requests, and imports the previously exported sessions upon POST
+// requests. Only the authenticated users having one of the admin roles
+// may use it.
+func ServeSessionTransfer(w http.ResponseWriter, r *http.Request, opts map[string]interface{}) error {
+	reqID := opts["request_id"].(string)
+	log := opts["logger"].(*zap.Logger)
+	cfg := opts["session_transfer"].(*sessions.Transfer)
+	sessionCache := opts["session_cache"].(*cache.SessionCache)
+
+	if !cfg.Enabled() {
+		return writeTransferResponse(w, http.StatusNotFound, map[string]interface{}{"error": "not_found"})
+	}
+	if !opts["authenticated"].(bool) {
+		return writeTransferResponse(w, http.StatusUnauthorized, map[string]interface{}{"error": "unauthorized"})
+	}
+	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	if !cfg.IsAdmin(claims.Roles) {
+		log.Warn("Session transfer denied",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.String("src_ip_address", utils.GetSourceAddress(r)),
+		)
+		return writeTransferResponse(w, http.StatusForbidden, map[string]interface{}{"error": "forbidden"})
+	}
+
+	switch r.Method {
+	case "GET":
+		records := sessionCache.Export()
+		log.Info("Exported sessions",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.Int("count", len(records)),
+		)
+		if records == nil {
+			records = []*cache.SessionRecord{}
+		}
+		return writeTransferResponse(w, http.StatusOK, map[string]interface{}{
+			"exported_at": time.Now().UTC(),
+			"sessions":    records,
+		})
+	case "POST":
+		if !cfg.Import {
+			w.Header().Set("Allow", "GET")
+			return writeTransferResponse(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": "import_disabled"})
+		}
+		var req struct {
+			Sessions []*cache.SessionRecord `json:"sessions"`
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, cfg.MaxImportSize+1))
+		if err != nil || int64(len(body)) > cfg.MaxImportSize {
+			return writeTransferResponse(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"error": "payload_too_large"})
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return writeTransferResponse(w, http.StatusBadRequest, map[string]interface{}{"error": "malformed_payload"})
+		}
+		count, err := sessionCache.Import(req.Sessions)
+		if err != nil {
+			log.Warn("Session import failed",
+				zap.String("request_id", reqID),
+				zap.String("user", claims.Subject),
+				zap.String("error", err.Error()),
+			)
+			return writeTransferResponse(w, http.StatusBadRequest, map[string]interface{}{"error": "malformed_payload", "message": err.Error()})
+		}
+		log.Info("Imported sessions",
+			zap.String("request_id", reqID),
+			zap.String("user", claims.Subject),
+			zap.Int("count", count),
+			zap.Int("skipped", len(req.Sessions)-count),
+		)
+		return writeTransferResponse(w, http.StatusOK, map[string]interface{}{
+			"imported": count,
+			"skipped":  len(req.Sessions) - count,
+		})
+	}
+	if cfg.Import {
+		w.Header().Set("Allow", "GET, POST")
+	} else {
+		w.Header().Set("Allow", "GET")
+	}
+	return writeTransferResponse(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": "method_not_allowed"})
+}
+
+func writeTransferResponse(w http.ResponseWriter, statusCode int, resp interface{}) error {
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(500)
+		w.Write([]byte(`Internal Server Error`))
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(statusCode)
+	w.Write(payload)
+	return nil
+}
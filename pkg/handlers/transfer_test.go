@@ -0,0 +1,139 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+	"github.com/greenpau/caddy-auth-portal/pkg/sessions"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestServeSessionTransfer(t *testing.T) {
+	testFailed := 0
+	cfg := &sessions.Transfer{AdminRoles: []string{"admin"}, Import: true}
+	if err := cfg.Configure(); err != nil {
+		t.Fatalf("failed configuring session transfer: %s", err)
+	}
+	admin := &jwtclaims.UserClaims{Subject: "admin", Roles: []string{"admin"}}
+	viewer := &jwtclaims.UserClaims{Subject: "jsmith", Roles: []string{"viewer"}}
+
+	sourceCache := cache.NewSessionCache()
+	sourceCache.Add("abc", map[string]interface{}{
+		"claims": &jwtclaims.UserClaims{
+			ID:        "abc",
+			Subject:   "jsmith",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		"backend_name":     "local_backend",
+		"backend_realm":    "local",
+		"backend_method":   "local",
+		"authenticated_at": time.Now().Add(-time.Minute),
+		"id_token":         "secret",
+	})
+	sourceCache.Add("def", map[string]interface{}{
+		"claims": &jwtclaims.UserClaims{ID: "def", Subject: "jsmith"},
+	})
+
+	tests := []struct {
+		method     string
+		claims     *jwtclaims.UserClaims
+		cache      *cache.SessionCache
+		body       string
+		statusCode int
+		count      float64
+	}{
+		{method: "GET", statusCode: 401, cache: sourceCache},
+		{method: "GET", claims: viewer, statusCode: 403, cache: sourceCache},
+		{method: "GET", claims: admin, statusCode: 200, cache: sourceCache, count: 1},
+		{method: "POST", claims: admin, statusCode: 400, cache: cache.NewSessionCache(), body: `{"sessions":[{"id":"abc"}]}`},
+		{method: "POST", claims: admin, statusCode: 200, cache: cache.NewSessionCache(), count: 1},
+		{method: "DELETE", claims: admin, statusCode: 405, cache: sourceCache},
+	}
+
+	var exported string
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, method: %s", i, test.method)
+		body := test.body
+		if test.method == "POST" && body == "" {
+			body = exported
+		}
+		r := httptest.NewRequest(test.method, "/auth/admin/sessions", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		opts := map[string]interface{}{
+			"request_id":       "abc",
+			"logger":           utils.NewLogger(),
+			"session_transfer": cfg,
+			"session_cache":    test.cache,
+			"authenticated":    test.claims != nil,
+		}
+		if test.claims != nil {
+			opts["user_claims"] = test.claims
+		}
+		ServeSessionTransfer(w, r, opts)
+		if w.Code != test.statusCode {
+			t.Logf("FAIL: %s, status code: %d (expected) vs. %d (received)", testDescr, test.statusCode, w.Code)
+			testFailed++
+			continue
+		}
+		if w.Code != 200 {
+			t.Logf("PASS: %s", testDescr)
+			continue
+		}
+		resp := make(map[string]interface{})
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Logf("FAIL: %s, failed parsing response: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		switch test.method {
+		case "GET":
+			exported = w.Body.String()
+			if records, _ := resp["sessions"].([]interface{}); float64(len(records)) != test.count {
+				t.Logf("FAIL: %s, exported sessions: %v", testDescr, resp["sessions"])
+				testFailed++
+				continue
+			}
+			if strings.Contains(exported, "secret") {
+				t.Logf("FAIL: %s, exported sessions have secrets: %s", testDescr, exported)
+				testFailed++
+				continue
+			}
+		case "POST":
+			if resp["imported"] != test.count {
+				t.Logf("FAIL: %s, imported sessions: %v", testDescr, resp)
+				testFailed++
+				continue
+			}
+			if session := test.cache.Get("abc"); session == nil || session["backend_realm"] != "local" {
+				t.Logf("FAIL: %s, imported session mismatch: %v", testDescr, session)
+				testFailed++
+				continue
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/challenge"
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// writeUnauthorizedBody writes the 401 Unauthorized JSON response rendered
+// from the body template configured by the operator. It returns false when
+// the template is not configured or the rendering fails, so that the
+// caller writes the default response.
+func writeUnauthorizedBody(w http.ResponseWriter, r *http.Request, opts map[string]interface{}, message, details string) bool {
+	v, exists := opts["unauthorized_body"]
+	if !exists {
+		return false
+	}
+	body := v.(*challenge.Body)
+	if !body.Enabled() {
+		return false
+	}
+	reqID := opts["request_id"].(string)
+	data := &challenge.Data{
+		Message:    message,
+		Details:    details,
+		LoginURL:   utils.GetCurrentBaseURL(r) + path.Join(opts["auth_url_path"].(string), "login"),
+		RequestID:  reqID,
+		StatusCode: http.StatusUnauthorized,
+	}
+	if v, exists := opts["unauthorized_realms"]; exists {
+		data.Realms = v.([]string)
+	}
+	payload, err := body.Render(data)
+	if err != nil {
+		log := opts["logger"].(*zap.Logger)
+		log.Error("Failed JSON response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(payload)
+	return true
+}
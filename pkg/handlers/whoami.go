@@ -32,15 +32,17 @@ func ServeWhoami(w http.ResponseWriter, r *http.Request, opts map[string]interfa
 	authURLPath := opts["auth_url_path"].(string)
 
 	if !opts["authenticated"].(bool) {
-		w.Header().Set("Location", authURLPath+"?redirect_url="+r.RequestURI)
-		w.WriteHeader(302)
-		return nil
+		return serveLoginRedirect(w, r, opts, authURLPath+"?redirect_url="+r.RequestURI)
 	}
 
 	claims := opts["user_claims"].(*jwtclaims.UserClaims)
+	var customClaims map[string]interface{}
+	if v, exists := opts["user_custom_claims"]; exists {
+		customClaims = v.(map[string]interface{})
+	}
 	// If the requested content type is JSON, then output authenticated message
 	if opts["content_type"].(string) == "application/json" {
-		payload, err := json.Marshal(claims)
+		payload, err := marshalUserClaims(claims, customClaims)
 		if err != nil {
 			log.Error("Failed JSON response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
 			w.Header().Set("Content-Type", "text/plain")
@@ -57,7 +59,9 @@ func ServeWhoami(w http.ResponseWriter, r *http.Request, opts map[string]interfa
 	// Display main authentication portal page
 	resp := uiFactory.GetArgs()
 	resp.Title = "User Identity"
+	addSessionExpiry(resp, opts)
 	tokenMap := claims.AsMap()
+	addCustomClaims(tokenMap, customClaims)
 	tokenMap["authenticated"] = true
 	if claims.ExpiresAt > 0 {
 		tokenMap["expires_at_utc"] = time.Unix(claims.ExpiresAt, 0).Format(time.UnixDate)
@@ -78,14 +82,25 @@ func ServeWhoami(w http.ResponseWriter, r *http.Request, opts map[string]interfa
 
 	content, err := uiFactory.Render("whoami", resp)
 	if err != nil {
-		log.Error("Failed HTML response rendering", zap.String("request_id", reqID), zap.String("error", err.Error()))
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(500)
-		w.Write([]byte(`Internal Server Error`))
-		return err
+		return serveFallback(w, opts, "whoami", err)
 	}
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(200)
 	w.Write(content.Bytes())
 	return nil
 }
+
+// marshalUserClaims returns the JSON representation of the user claims
+// and the custom claims of the user.
+func marshalUserClaims(claims *jwtclaims.UserClaims, customClaims map[string]interface{}) ([]byte, error) {
+	b, err := json.Marshal(claims)
+	if err != nil || len(customClaims) == 0 {
+		return b, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	addCustomClaims(m, customClaims)
+	return json.Marshal(m)
+}
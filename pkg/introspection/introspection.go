@@ -0,0 +1,55 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package introspection
+
+import (
+	"crypto/subtle"
+)
+
+// Client represents the credentials of a service allowed
+// to introspect tokens.
+type Client struct {
+	// The identifier of the client.
+	ID string `json:"id,omitempty"`
+	// The secret of the client.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Introspection represent a common set of configuration settings for
+// the token introspection endpoint.
+type Introspection struct {
+	// The clients allowed to introspect tokens. The introspection
+	// endpoint is disabled when there are no clients.
+	Clients []*Client `json:"clients,omitempty"`
+}
+
+// Enabled returns true when the introspection endpoint has clients.
+func (i *Introspection) Enabled() bool {
+	return len(i.Clients) > 0
+}
+
+// Authenticate returns true when the provided client credentials match
+// one of the configured clients.
+func (i *Introspection) Authenticate(clientID, clientSecret string) bool {
+	for _, client := range i.Clients {
+		if client.ID != clientID {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(client.Secret), []byte(clientSecret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
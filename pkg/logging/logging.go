@@ -0,0 +1,124 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var reservedFields = map[string]bool{
+	"level":      true,
+	"ts":         true,
+	"time":       true,
+	"logger":     true,
+	"msg":        true,
+	"caller":     true,
+	"stacktrace": true,
+	"request_id": true,
+}
+
+// Config represents a common set of configuration settings for the log
+// entries of the portal.
+type Config struct {
+	// The encoding of the log entries. When it is "json", the portal
+	// writes its log entries to the standard error in JSON format,
+	// regardless of the format of the server logs.
+	Format string `json:"format,omitempty"`
+	// The name of the environment, e.g. production.
+	Environment string `json:"environment,omitempty"`
+	// The name of the region, e.g. us-east-1.
+	Region string `json:"region,omitempty"`
+	// The switch determining whether the log entries include the name
+	// of the portal instance.
+	InstanceName bool `json:"instance_name,omitempty"`
+	// The custom static fields added to every log entry.
+	Fields map[string]string `json:"fields,omitempty"`
+	// The names of the claims masked in the log entries, e.g. email.
+	// When empty, it defaults to DefaultRedactedClaims. The "none"
+	// value disables the redaction.
+	Redact []string `json:"redact,omitempty"`
+	// The sampling of the log entries of the requests, by flow. When
+	// empty, the portal writes all entries.
+	Sampling []*SamplingRule `json:"sampling,omitempty"`
+	redacted map[string]bool
+}
+
+// Configure validates the configuration.
+func (c *Config) Configure() error {
+	switch c.Format {
+	case "", "json":
+	default:
+		return fmt.Errorf("unsupported log format: %s", c.Format)
+	}
+	for k := range c.Fields {
+		if k == "" {
+			return fmt.Errorf("log field name is empty")
+		}
+		if reservedFields[k] || k == "environment" || k == "region" || k == "instance" {
+			return fmt.Errorf("log field name %s is reserved", k)
+		}
+	}
+	if err := c.configureSampling(); err != nil {
+		return err
+	}
+	return c.configureRedaction()
+}
+
+// GetFields returns the fields added to every log entry.
+func (c *Config) GetFields(instanceName string) []zap.Field {
+	var fields []zap.Field
+	if c.Environment != "" {
+		fields = append(fields, zap.String("environment", c.Environment))
+	}
+	if c.Region != "" {
+		fields = append(fields, zap.String("region", c.Region))
+	}
+	if c.InstanceName {
+		fields = append(fields, zap.String("instance", instanceName))
+	}
+	var keys []string
+	for k := range c.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, zap.String(k, c.Fields[k]))
+	}
+	return fields
+}
+
+// Apply returns the logger writing the log entries in the configured
+// format and with the configured fields.
+func (c *Config) Apply(logger *zap.Logger, instanceName string) *zap.Logger {
+	if c.Format == "json" {
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		core := zapcore.NewCore(
+			zapcore.NewJSONEncoder(encoderConfig),
+			zapcore.Lock(os.Stderr),
+			logger.Core(),
+		)
+		logger = zap.New(core).Named("http.handlers.auth_portal")
+	}
+	if fields := c.GetFields(instanceName); len(fields) > 0 {
+		logger = logger.With(fields...)
+	}
+	return logger
+}
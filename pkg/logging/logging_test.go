@@ -0,0 +1,168 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestApply(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		config     *Config
+		expected   map[string]interface{}
+		shouldFail bool
+	}{
+		{
+			config:   &Config{},
+			expected: map[string]interface{}{},
+		},
+		{
+			config: &Config{
+				Environment:  "production",
+				Region:       "us-east-1",
+				InstanceName: true,
+				Fields: map[string]string{
+					"team": "security",
+				},
+			},
+			expected: map[string]interface{}{
+				"environment": "production",
+				"region":      "us-east-1",
+				"instance":    "portal-1",
+				"team":        "security",
+			},
+		},
+		{
+			config:     &Config{Format: "xml"},
+			shouldFail: true,
+		},
+		{
+			config:     &Config{Fields: map[string]string{"msg": "foo"}},
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, config: %v", i, test.config)
+		if err := test.config.Configure(); err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		core, logs := observer.New(zap.InfoLevel)
+		logger := test.config.Apply(zap.New(core), "portal-1")
+		logger.Info("test")
+		if logs.Len() != 1 {
+			t.Logf("FAIL: %s, expected one log entry, received: %d", testDescr, logs.Len())
+			testFailed++
+			continue
+		}
+		fields := logs.All()[0].ContextMap()
+		if !reflect.DeepEqual(fields, test.expected) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, fields)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestClaims(t *testing.T) {
+	testFailed := 0
+	claims := map[string]interface{}{
+		"sub":   "jsmith",
+		"email": "jsmith@contoso.com",
+		"name":  "John Smith",
+		"roles": []interface{}{"admin"},
+	}
+	tests := []struct {
+		redact     []string
+		expected   map[string]interface{}
+		shouldFail bool
+	}{
+		{
+			expected: map[string]interface{}{
+				"sub":   "jsmith",
+				"email": "[REDACTED]",
+				"name":  "[REDACTED]",
+				"roles": []interface{}{"admin"},
+			},
+		},
+		{
+			redact: []string{"roles"},
+			expected: map[string]interface{}{
+				"sub":   "jsmith",
+				"email": "jsmith@contoso.com",
+				"name":  "John Smith",
+				"roles": "[REDACTED]",
+			},
+		},
+		{
+			redact:   []string{"none"},
+			expected: claims,
+		},
+		{
+			redact:     []string{"none", "email"},
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, redact: %v", i, test.redact)
+		config := &Config{Redact: test.redact}
+		if err := config.Configure(); err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		core, logs := observer.New(zap.InfoLevel)
+		zap.New(core).Info("test", config.Claims("user", claims))
+		fields := logs.All()[0].ContextMap()
+		if !reflect.DeepEqual(fields["user"], test.expected) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, fields["user"])
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
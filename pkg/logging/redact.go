@@ -0,0 +1,81 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// DefaultRedactedClaims are the claims holding personally identifiable
+// information masked in the log entries by default.
+var DefaultRedactedClaims = []string{"email", "name", "addr"}
+
+const redactedValue = "[REDACTED]"
+
+func (c *Config) configureRedaction() error {
+	c.redacted = make(map[string]bool)
+	names := c.Redact
+	if len(names) == 0 {
+		names = DefaultRedactedClaims
+	}
+	for _, name := range names {
+		switch name {
+		case "":
+			return fmt.Errorf("redacted claim name is empty")
+		case "none":
+			if len(names) > 1 {
+				return fmt.Errorf("redacted claim name none must not be combined with other names")
+			}
+			return nil
+		}
+		c.redacted[name] = true
+	}
+	return nil
+}
+
+// Claims returns the log field holding the claims with the values of
+// the redacted claims masked. The masked claims remain in the field,
+// so that the log entries show which claims were present.
+func (c *Config) Claims(key string, claims interface{}) zap.Field {
+	redacted := c.redacted
+	if redacted == nil {
+		// The configuration was not validated.
+		cfg := &Config{Redact: c.Redact}
+		if err := cfg.configureRedaction(); err != nil {
+			return zap.String(key, redactedValue)
+		}
+		redacted = cfg.redacted
+	}
+	if len(redacted) == 0 {
+		return zap.Any(key, claims)
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return zap.String(key, redactedValue)
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return zap.String(key, redactedValue)
+	}
+	for k := range m {
+		if redacted[k] {
+			m[k] = redactedValue
+		}
+	}
+	return zap.Any(key, m)
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SamplingRule is the share of the log entries of the requests of a flow
+// the portal writes. The entries at the warning level and above are the
+// failures, and the other entries are the successes.
+type SamplingRule struct {
+	// The flow of the requests, e.g. login, or "*" for any flow.
+	Flow string `json:"flow,omitempty"`
+	// The percentage of the requests whose successful entries are written.
+	Success float64 `json:"success"`
+	// The percentage of the requests whose failure entries are written.
+	Failure float64 `json:"failure"`
+}
+
+// samplingDecisions holds the sampling decisions of a request, keyed
+// by flow and outcome, so that the entries of a request of the same flow
+// and outcome are either all written or all dropped.
+type samplingDecisions struct {
+	mux     sync.Mutex
+	entries map[string]bool
+}
+
+// samplingCore writes the sampled log entries of a request.
+type samplingCore struct {
+	zapcore.Core
+	rules     []*SamplingRule
+	requestID string
+	flow      func() string
+	decisions *samplingDecisions
+	fields    []zapcore.Field
+	random    func() float64
+}
+
+func (c *Config) configureSampling() error {
+	flows := make(map[string]bool)
+	for _, rule := range c.Sampling {
+		if rule.Flow == "" {
+			return fmt.Errorf("log sampling flow is empty")
+		}
+		if flows[rule.Flow] {
+			return fmt.Errorf("log sampling flow %s is duplicate", rule.Flow)
+		}
+		flows[rule.Flow] = true
+		if rule.Success < 0 || rule.Success > 100 || rule.Failure < 0 || rule.Failure > 100 {
+			return fmt.Errorf("log sampling rate of flow %s must be between 0 and 100", rule.Flow)
+		}
+	}
+	return nil
+}
+
+// Sample returns the logger writing the share of the log entries of the
+// request configured for its flow and outcome. The flow function returns
+// the flow of the request at the time of an entry. The written entries
+// always include the request id.
+func (c *Config) Sample(logger *zap.Logger, requestID string, flow func() string) *zap.Logger {
+	if len(c.Sampling) == 0 {
+		return logger
+	}
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &samplingCore{
+			Core:      core,
+			rules:     c.Sampling,
+			requestID: requestID,
+			flow:      flow,
+			decisions: &samplingDecisions{entries: make(map[string]bool)},
+			random:    rand.Float64,
+		}
+	}))
+}
+
+// getRate returns the percentage of the requests of the flow whose
+// entries of the outcome are written.
+func (s *samplingCore) getRate(flow string, failure bool) float64 {
+	var match *SamplingRule
+	for _, rule := range s.rules {
+		if rule.Flow == flow {
+			match = rule
+			break
+		}
+		if rule.Flow == "*" {
+			match = rule
+		}
+	}
+	if match == nil {
+		return 100
+	}
+	if failure {
+		return match.Failure
+	}
+	return match.Success
+}
+
+func (s *samplingCore) sampled(level zapcore.Level) bool {
+	flow := s.flow()
+	failure := level >= zapcore.WarnLevel
+	key := fmt.Sprintf("%s/%t", flow, failure)
+	s.decisions.mux.Lock()
+	defer s.decisions.mux.Unlock()
+	if decision, exists := s.decisions.entries[key]; exists {
+		return decision
+	}
+	rate := s.getRate(flow, failure)
+	decision := rate >= 100 || (rate > 0 && s.random()*100 < rate)
+	s.decisions.entries[key] = decision
+	return decision
+}
+
+func (s *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *s
+	clone.Core = s.Core.With(fields)
+	clone.fields = append(append([]zapcore.Field{}, s.fields...), fields...)
+	return &clone
+}
+
+func (s *samplingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !s.Enabled(entry.Level) || !s.sampled(entry.Level) {
+		return checked
+	}
+	return checked.AddCore(entry, s)
+}
+
+func (s *samplingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if !hasField(s.fields, "request_id") && !hasField(fields, "request_id") {
+		fields = append(fields, zap.String("request_id", s.requestID))
+	}
+	return s.Core.Write(entry, fields)
+}
+
+func hasField(fields []zapcore.Field, key string) bool {
+	for _, field := range fields {
+		if field.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSample(t *testing.T) {
+	testFailed := 0
+	rules := []*SamplingRule{
+		{Flow: "login", Success: 0, Failure: 100},
+		{Flow: "*", Success: 100, Failure: 0},
+	}
+	tests := []struct {
+		rules    []*SamplingRule
+		flow     string
+		warn     bool
+		expected int
+	}{
+		{flow: "login", expected: 2},
+		{rules: rules, flow: "login", expected: 0},
+		{rules: rules, flow: "login", warn: true, expected: 2},
+		{rules: rules, flow: "whoami", expected: 2},
+		{rules: rules, flow: "whoami", warn: true, expected: 0},
+		{rules: rules, flow: "", expected: 2},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, flow: %s, warn: %t", i, test.flow, test.warn)
+		cfg := &Config{Sampling: test.rules}
+		if err := cfg.Configure(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		core, logs := observer.New(zap.DebugLevel)
+		logger := cfg.Sample(zap.New(core), "req-1", func() string { return test.flow })
+		for _, l := range []*zap.Logger{logger, logger.With(zap.String("user", "jsmith"))} {
+			if test.warn {
+				l.Warn("test")
+			} else {
+				l.Info("test")
+			}
+		}
+		if logs.Len() != test.expected {
+			t.Logf("FAIL: %s, expected %d log entries, received: %d", testDescr, test.expected, logs.Len())
+			testFailed++
+			continue
+		}
+		if test.rules != nil && test.expected > 0 {
+			if v := logs.All()[0].ContextMap()["request_id"]; v != "req-1" {
+				t.Logf("FAIL: %s, expected request id, received: %v", testDescr, v)
+				testFailed++
+				continue
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestSampleDecision(t *testing.T) {
+	s := &samplingCore{
+		rules:     []*SamplingRule{{Flow: "*", Success: 50, Failure: 100}},
+		flow:      func() string { return "login" },
+		decisions: &samplingDecisions{entries: make(map[string]bool)},
+	}
+	draws := []float64{0.9, 0.1}
+	s.random = func() float64 {
+		v := draws[0]
+		draws = draws[1:]
+		return v
+	}
+	// The first draw drops the successful entries of the request, and the
+	// subsequent entries follow the decision. The failures logged in full
+	// take no draw.
+	if s.sampled(zap.InfoLevel) || s.sampled(zap.DebugLevel) {
+		t.Fatalf("expected the successful entries to be dropped")
+	}
+	if !s.sampled(zap.ErrorLevel) {
+		t.Fatalf("expected the failure entries to be written")
+	}
+	if len(draws) != 1 {
+		t.Fatalf("unexpected number of draws: %d", 2-len(draws))
+	}
+}
+
+func TestConfigureSampling(t *testing.T) {
+	for _, rules := range [][]*SamplingRule{
+		{{Flow: ""}},
+		{{Flow: "login", Success: 101}},
+		{{Flow: "login", Failure: -1}},
+		{{Flow: "login"}, {Flow: "login"}},
+	} {
+		cfg := &Config{Sampling: rules}
+		if err := cfg.Configure(); err == nil {
+			t.Fatalf("expected error for rules %v, but received none", rules)
+		}
+	}
+}
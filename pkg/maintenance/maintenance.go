@@ -0,0 +1,52 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+// DefaultMessage is the message displayed to users when the portal
+// is under maintenance and no custom message was configured.
+const DefaultMessage = "The portal is undergoing maintenance. Please try again later."
+
+// Maintenance represent a common set of configuration settings for
+// the maintenance mode of the portal.
+type Maintenance struct {
+	// The switch determining whether the maintenance mode is enabled.
+	Enabled bool `json:"enabled,omitempty"`
+	// The message displayed to users while the portal is under maintenance.
+	Message string `json:"message,omitempty"`
+	// The switch determining whether the users with valid sessions
+	// continue accessing the portal.
+	AllowSessions bool `json:"allow_sessions,omitempty"`
+	// The roles allowed to bypass the maintenance mode, e.g. admin.
+	BypassRoles []string `json:"bypass_roles,omitempty"`
+}
+
+// Bypass returns true when one of the roles is allowed to bypass
+// the maintenance mode.
+func (m *Maintenance) Bypass(roles []string) bool {
+	for _, role := range roles {
+		for _, bypassRole := range m.BypassRoles {
+			if role == bypassRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AllowSession returns true when the user with an existing session and
+// the roles continues accessing the portal during the maintenance.
+func (m *Maintenance) AllowSession(roles []string) bool {
+	return m.AllowSessions || m.Bypass(roles)
+}
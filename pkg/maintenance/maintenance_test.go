@@ -0,0 +1,76 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		maintenance  *Maintenance
+		roles        []string
+		bypass       bool
+		allowSession bool
+	}{
+		{
+			maintenance: &Maintenance{Enabled: true},
+			roles:       []string{"admin"},
+		},
+		{
+			maintenance:  &Maintenance{Enabled: true, BypassRoles: []string{"admin"}},
+			roles:        []string{"viewer", "admin"},
+			bypass:       true,
+			allowSession: true,
+		},
+		{
+			maintenance: &Maintenance{Enabled: true, BypassRoles: []string{"admin"}},
+			roles:       []string{"viewer"},
+		},
+		{
+			maintenance: &Maintenance{Enabled: true, BypassRoles: []string{"admin"}},
+		},
+		{
+			maintenance:  &Maintenance{Enabled: true, AllowSessions: true},
+			roles:        []string{"viewer"},
+			allowSession: true,
+		},
+		{
+			maintenance:  &Maintenance{Enabled: true, AllowSessions: true, BypassRoles: []string{"admin"}},
+			roles:        []string{"admin"},
+			bypass:       true,
+			allowSession: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, config: %+v, roles: %v", i, test.maintenance, test.roles)
+		if bypass := test.maintenance.Bypass(test.roles); bypass != test.bypass {
+			t.Logf("FAIL: %s, bypass: %t (expected) vs. %t (received)", testDescr, test.bypass, bypass)
+			testFailed++
+			continue
+		}
+		if allowSession := test.maintenance.AllowSession(test.roles); allowSession != test.allowSession {
+			t.Logf("FAIL: %s, allow session: %t (expected) vs. %t (received)", testDescr, test.allowSession, allowSession)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
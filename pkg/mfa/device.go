@@ -0,0 +1,165 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrustedDevice is a device on which a user skips multi-factor
+// authentication until the trust expires or is revoked.
+type TrustedDevice struct {
+	ID        string    `json:"id,omitempty"`
+	Subject   string    `json:"sub,omitempty"`
+	Realm     string    `json:"realm,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// deviceStore holds the trusted devices. The device cookies are signed
+// with a key generated at startup, so that the cookies issued before
+// a restart are no longer valid.
+type deviceStore struct {
+	mu      sync.RWMutex
+	key     []byte
+	devices map[string]*TrustedDevice
+}
+
+func newDeviceStore() (*deviceStore, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed generating trusted device key: %s", err)
+	}
+	return &deviceStore{
+		key:     key,
+		devices: make(map[string]*TrustedDevice),
+	}, nil
+}
+
+func (s *deviceStore) sign(device *TrustedDevice) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(device.ID + "|" + device.Subject + "|" + device.Realm))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DeviceTrustEnabled returns true when users may mark their devices
+// as trusted.
+func (c *Config) DeviceTrustEnabled() bool {
+	return c != nil && c.TrustedDeviceLifetime > 0 && c.devices != nil
+}
+
+// TrustDevice records the device of a user as trusted. It returns the
+// value of the device cookie and the lifetime of the trust in seconds.
+func (c *Config) TrustDevice(subject, realm, userAgent string) (string, int, error) {
+	if !c.DeviceTrustEnabled() {
+		return "", 0, fmt.Errorf("device trust is disabled")
+	}
+	id := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return "", 0, fmt.Errorf("failed generating trusted device id: %s", err)
+	}
+	lifetime := c.TrustedDeviceLifetime * 24 * 3600
+	now := time.Now()
+	device := &TrustedDevice{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Subject:   subject,
+		Realm:     realm,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(lifetime) * time.Second),
+	}
+	c.devices.mu.Lock()
+	defer c.devices.mu.Unlock()
+	for id, d := range c.devices.devices {
+		if d.ExpiresAt.Before(now) {
+			delete(c.devices.devices, id)
+		}
+	}
+	c.devices.devices[device.ID] = device
+	return device.ID + "." + c.devices.sign(device), lifetime, nil
+}
+
+// IsTrustedDevice returns true when the device cookie is valid for the
+// user authenticated by the realm.
+func (c *Config) IsTrustedDevice(cookieValue, subject, realm string) bool {
+	if !c.DeviceTrustEnabled() {
+		return false
+	}
+	i := strings.LastIndex(cookieValue, ".")
+	if i < 1 {
+		return false
+	}
+	c.devices.mu.RLock()
+	defer c.devices.mu.RUnlock()
+	device, exists := c.devices.devices[cookieValue[:i]]
+	if !exists {
+		return false
+	}
+	if !hmac.Equal([]byte(cookieValue[i+1:]), []byte(c.devices.sign(device))) {
+		return false
+	}
+	if device.Subject != subject || device.Realm != realm {
+		return false
+	}
+	return device.ExpiresAt.After(time.Now())
+}
+
+// GetTrustedDevices returns the unexpired trusted devices of the user
+// authenticated by the realm, the most recent first.
+func (c *Config) GetTrustedDevices(subject, realm string) []*TrustedDevice {
+	if !c.DeviceTrustEnabled() {
+		return nil
+	}
+	var devices []*TrustedDevice
+	now := time.Now()
+	c.devices.mu.RLock()
+	for _, device := range c.devices.devices {
+		if device.Subject == subject && device.Realm == realm && device.ExpiresAt.After(now) {
+			devices = append(devices, device)
+		}
+	}
+	c.devices.mu.RUnlock()
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].CreatedAt.After(devices[j].CreatedAt)
+	})
+	return devices
+}
+
+// RevokeTrustedDevices revokes the trust in all devices of the user
+// authenticated by the realm. It returns the number of revoked devices.
+func (c *Config) RevokeTrustedDevices(subject, realm string) int {
+	if !c.DeviceTrustEnabled() {
+		return 0
+	}
+	var count int
+	c.devices.mu.Lock()
+	defer c.devices.mu.Unlock()
+	for id, device := range c.devices.devices {
+		if device.Subject == subject && device.Realm == realm {
+			delete(c.devices.devices, id)
+			count++
+		}
+	}
+	return count
+}
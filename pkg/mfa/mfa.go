@@ -0,0 +1,232 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfa
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/greenpau/go-identity"
+)
+
+// DefaultMaxAttempts is the default number of failed verification
+// attempts per method before the pending session is discarded.
+const DefaultMaxAttempts = 5
+
+// Method is a second authentication factor, e.g. an authenticator app.
+type Method struct {
+	// The name of the method. It matches the type of the MFA tokens
+	// enrolled with the method.
+	Name string `json:"name,omitempty"`
+	// The description of the method displayed to users.
+	Title string `json:"title,omitempty"`
+	// The authentication method reference of the method, as defined
+	// in RFC 8176, e.g. otp.
+	reference string
+	verify    func(*identity.MfaToken, string) error
+}
+
+var methods = map[string]*Method{
+	"totp": {
+		Name:      "totp",
+		Title:     "Authenticator App",
+		reference: "otp",
+		verify: func(token *identity.MfaToken, code string) error {
+			return token.ValidateCode(code)
+		},
+	},
+}
+
+// Config represents a common set of configuration settings for the
+// multi-factor authentication step of the login flow.
+type Config struct {
+	// The method offered first to the users enrolled in more than one
+	// method, e.g. totp.
+	DefaultMethod string `json:"default_method,omitempty"`
+	// The method offered first when a user is not enrolled in the
+	// default method.
+	FallbackMethod string `json:"fallback_method,omitempty"`
+	// The rules requiring multi-factor authentication. When a user
+	// matches the rules, but did not enroll in any method, the user
+	// must enroll before proceeding.
+	Requirement *Requirement `json:"requirement,omitempty"`
+	// The number of days users skip multi-factor authentication on
+	// the devices they marked as trusted. Zero disables device trust.
+	TrustedDeviceLifetime int `json:"trusted_device_lifetime,omitempty"`
+	// The maximum number of failed verification attempts per method,
+	// e.g. totp. When a user exceeds the limit, the user must restart
+	// the login.
+	MaxAttempts map[string]int `json:"max_attempts,omitempty"`
+	// The per-realm method selection, keyed by realm. It allows the
+	// realms to offer different methods to their users.
+	Realms map[string]*RealmConfig `json:"realms,omitempty"`
+	// When enabled, the users logging in from the trusted networks skip
+	// multi-factor authentication, while the users logging in from
+	// other networks must pass it.
+	Adaptive bool `json:"adaptive,omitempty"`
+	// The trusted networks in CIDR notation, e.g. 10.0.0.0/8.
+	TrustedNetworks []string `json:"trusted_networks,omitempty"`
+	// The proxies, in CIDR notation, whose X-Real-IP and X-Forwarded-For
+	// headers determine the source address of the requests.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+	devices        *deviceStore
+	allowed        map[string]bool
+	realms         map[string]*Config
+	networks       []*net.IPNet
+	proxies        []*net.IPNet
+}
+
+// Requirement is a set of rules requiring multi-factor authentication
+// for the users having particular roles or authenticated by particular
+// realms.
+type Requirement struct {
+	// The roles requiring multi-factor authentication, e.g. admin.
+	Roles []string `json:"roles,omitempty"`
+	// The realms requiring multi-factor authentication, e.g. local.
+	Realms []string `json:"realms,omitempty"`
+}
+
+// Required returns true when the user authenticated by the realm and
+// having the roles must pass multi-factor authentication.
+func (c *Config) Required(realm string, roles []string) bool {
+	if c.Requirement == nil {
+		return false
+	}
+	for _, r := range c.Requirement.Realms {
+		if r == realm {
+			return true
+		}
+	}
+	for _, requiredRole := range c.Requirement.Roles {
+		for _, role := range roles {
+			if role == requiredRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Configure validates the configuration and sets default values.
+func (c *Config) Configure() error {
+	if c.DefaultMethod == "" {
+		c.DefaultMethod = "totp"
+	}
+	for _, name := range []string{c.DefaultMethod, c.FallbackMethod} {
+		if name == "" {
+			continue
+		}
+		if _, exists := methods[name]; !exists {
+			return fmt.Errorf("unsupported mfa method: %s", name)
+		}
+	}
+	for name, limit := range c.MaxAttempts {
+		if _, exists := methods[name]; !exists {
+			return fmt.Errorf("unsupported mfa method: %s", name)
+		}
+		if limit < 1 {
+			return fmt.Errorf("mfa max attempts for %s method must be greater than zero", name)
+		}
+	}
+	if c.TrustedDeviceLifetime > 0 && c.devices == nil {
+		devices, err := newDeviceStore()
+		if err != nil {
+			return err
+		}
+		c.devices = devices
+	}
+	if err := c.configureNetworks(); err != nil {
+		return err
+	}
+	return c.configureRealms()
+}
+
+// GetMethod returns the method with the provided name.
+func GetMethod(name string) *Method {
+	return methods[name]
+}
+
+// GetMaxAttempts returns the maximum number of failed verification
+// attempts for the method.
+func (c *Config) GetMaxAttempts(name string) int {
+	if limit, exists := c.MaxAttempts[name]; exists {
+		return limit
+	}
+	return DefaultMaxAttempts
+}
+
+// GetMethods returns the supported methods a user enrolled in via
+// the provided MFA tokens. The methods are ordered by preference, i.e.
+// the default method, the fallback method, and the remaining methods
+// in alphabetical order.
+func (c *Config) GetMethods(tokens []*identity.MfaToken) []*Method {
+	enrolled := make(map[string]bool)
+	for _, token := range tokens {
+		if token.Disabled {
+			continue
+		}
+		if _, exists := methods[token.Type]; !exists {
+			continue
+		}
+		if c.allowed != nil && !c.allowed[token.Type] {
+			continue
+		}
+		enrolled[token.Type] = true
+	}
+	var names []string
+	for _, name := range []string{c.DefaultMethod, c.FallbackMethod} {
+		if enrolled[name] {
+			names = append(names, name)
+			delete(enrolled, name)
+		}
+	}
+	var others []string
+	for name := range enrolled {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+	var m []*Method
+	for _, name := range names {
+		m = append(m, methods[name])
+	}
+	return m
+}
+
+// GetReference returns the authentication method reference of the
+// method. It defaults to the name of the method.
+func (m *Method) GetReference() string {
+	if m.reference == "" {
+		return m.Name
+	}
+	return m.reference
+}
+
+// Verify validates the code provided by a user against the user's MFA
+// tokens enrolled with the method. It returns the token matching the
+// code. The time-based codes are accepted within one step of clock skew
+// in either direction.
+func (m *Method) Verify(tokens []*identity.MfaToken, code string) (*identity.MfaToken, error) {
+	for _, token := range tokens {
+		if token.Disabled || token.Type != m.Name {
+			continue
+		}
+		if err := m.verify(token, code); err == nil {
+			return token, nil
+		}
+	}
+	return nil, fmt.Errorf("%s code is invalid", m.Name)
+}
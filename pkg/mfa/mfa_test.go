@@ -0,0 +1,409 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-identity"
+)
+
+func generateCode(secret string, ts time.Time) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(ts.Unix()/30))
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0xf
+	val := (int(sum[off])&0x7f)<<24 | int(sum[off+1])<<16 | int(sum[off+2])<<8 | int(sum[off+3])
+	return fmt.Sprintf("%06d", val%1000000)
+}
+
+func TestGetMethods(t *testing.T) {
+	testFailed := 0
+	methods["sms"] = &Method{Name: "sms", Title: "Text Message"}
+	methods["push"] = &Method{Name: "push", Title: "Push Notification"}
+	defer func() {
+		delete(methods, "sms")
+		delete(methods, "push")
+	}()
+	tokens := []*identity.MfaToken{
+		{ID: "1", Type: "totp"},
+		{ID: "2", Type: "sms"},
+		{ID: "3", Type: "push"},
+		{ID: "4", Type: "u2f"},
+	}
+	tests := []struct {
+		config   *Config
+		tokens   []*identity.MfaToken
+		expected []string
+	}{
+		{
+			config:   &Config{DefaultMethod: "totp"},
+			tokens:   tokens,
+			expected: []string{"totp", "push", "sms"},
+		},
+		{
+			config:   &Config{DefaultMethod: "sms", FallbackMethod: "totp"},
+			tokens:   tokens,
+			expected: []string{"sms", "totp", "push"},
+		},
+		{
+			config:   &Config{DefaultMethod: "sms", FallbackMethod: "push"},
+			tokens:   tokens[:1],
+			expected: []string{"totp"},
+		},
+		{
+			config:   &Config{DefaultMethod: "totp"},
+			tokens:   []*identity.MfaToken{{ID: "1", Type: "totp", Disabled: true}},
+			expected: nil,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, default: %s, fallback: %s", i, test.config.DefaultMethod, test.config.FallbackMethod)
+		var names []string
+		for _, m := range test.config.GetMethods(test.tokens) {
+			names = append(names, m.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, names)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	testFailed := 0
+	config := &Config{
+		Requirement: &Requirement{
+			Roles:  []string{"admin"},
+			Realms: []string{"corp"},
+		},
+	}
+	tests := []struct {
+		config   *Config
+		realm    string
+		roles    []string
+		expected bool
+	}{
+		{config: &Config{}, realm: "corp", roles: []string{"admin"}, expected: false},
+		{config: config, realm: "local", roles: []string{"admin", "user"}, expected: true},
+		{config: config, realm: "local", roles: []string{"user"}, expected: false},
+		{config: config, realm: "corp", roles: []string{"user"}, expected: true},
+		{config: config, realm: "local", roles: nil, expected: false},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, realm: %s, roles: %v", i, test.realm, test.roles)
+		if required := test.config.Required(test.realm, test.roles); required != test.expected {
+			t.Logf("FAIL: %s, expected: %t, received: %t", testDescr, test.expected, required)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestGetMaxAttempts(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		config     *Config
+		method     string
+		expected   int
+		shouldFail bool
+	}{
+		{config: &Config{}, method: "totp", expected: DefaultMaxAttempts},
+		{config: &Config{MaxAttempts: map[string]int{"totp": 3}}, method: "totp", expected: 3},
+		{config: &Config{MaxAttempts: map[string]int{"sms": 3}}, method: "totp", shouldFail: true},
+		{config: &Config{MaxAttempts: map[string]int{"totp": 0}}, method: "totp", shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, max attempts: %v", i, test.config.MaxAttempts)
+		err := test.config.Configure()
+		if test.shouldFail {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but received none", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if limit := test.config.GetMaxAttempts(test.method); limit != test.expected {
+			t.Logf("FAIL: %s, expected: %d, received: %d", testDescr, test.expected, limit)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	testFailed := 0
+	secret := "c71ca4c68bc14ec5b4ab8d3c3b63802c"
+	tokens := []*identity.MfaToken{
+		{ID: "1", Type: "totp", Algorithm: "sha1", Secret: "2f6d3c0c5f5c4a6e9d1a", Period: 30, Digits: 6},
+		{ID: "2", Type: "totp", Algorithm: "sha1", Secret: secret, Period: 30, Digits: 6},
+	}
+	tests := []struct {
+		code      string
+		disabled  bool
+		shouldErr bool
+	}{
+		{code: generateCode(secret, time.Now())},
+		{code: generateCode(secret, time.Now().Add(-30*time.Second))},
+		{code: generateCode(secret, time.Now().Add(30*time.Second))},
+		{code: generateCode(secret, time.Now().Add(-60*time.Second)), shouldErr: true},
+		{code: generateCode(secret, time.Now().Add(60*time.Second)), shouldErr: true},
+		{code: generateCode(secret, time.Now().Add(-5*time.Minute)), shouldErr: true},
+		{code: generateCode(secret, time.Now()), disabled: true, shouldErr: true},
+		{code: "", shouldErr: true},
+	}
+	method := GetMethod("totp")
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, code: %s, disabled: %t", i, test.code, test.disabled)
+		tokens[1].Disabled = test.disabled
+		token, err := method.Verify(tokens, test.code)
+		if test.shouldErr {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but got success", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		if token.ID != "2" {
+			t.Logf("FAIL: %s, matched unexpected token: %s", testDescr, token.ID)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestTrustedDevice(t *testing.T) {
+	cfg := &Config{TrustedDeviceLifetime: 30}
+	if err := cfg.Configure(); err != nil {
+		t.Fatalf("failed configuring mfa: %s", err)
+	}
+	deviceToken, lifetime, err := cfg.TrustDevice("jsmith", "local", "Mozilla/5.0")
+	if err != nil {
+		t.Fatalf("failed trusting device: %s", err)
+	}
+	if lifetime != 30*24*3600 {
+		t.Fatalf("unexpected lifetime: %d", lifetime)
+	}
+	if _, _, err := cfg.TrustDevice("jdoe", "local", "Mozilla/5.0"); err != nil {
+		t.Fatalf("failed trusting device: %s", err)
+	}
+
+	tests := []struct {
+		token   string
+		subject string
+		realm   string
+		trusted bool
+	}{
+		{token: deviceToken, subject: "jsmith", realm: "local", trusted: true},
+		{token: deviceToken, subject: "jdoe", realm: "local"},
+		{token: deviceToken, subject: "jsmith", realm: "corp"},
+		{token: deviceToken + "x", subject: "jsmith", realm: "local"},
+		{token: "foo.bar", subject: "jsmith", realm: "local"},
+		{token: "", subject: "jsmith", realm: "local"},
+	}
+	testFailed := 0
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, subject: %s, realm: %s", i, test.subject, test.realm)
+		if trusted := cfg.IsTrustedDevice(test.token, test.subject, test.realm); trusted != test.trusted {
+			t.Logf("FAIL: %s, expected: %t, received: %t", testDescr, test.trusted, trusted)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+
+	if devices := cfg.GetTrustedDevices("jsmith", "local"); len(devices) != 1 {
+		t.Fatalf("unexpected trusted devices: %v", devices)
+	}
+	if count := cfg.RevokeTrustedDevices("jsmith", "local"); count != 1 {
+		t.Fatalf("unexpected number of revoked devices: %d", count)
+	}
+	if cfg.IsTrustedDevice(deviceToken, "jsmith", "local") {
+		t.Fatalf("revoked device is still trusted")
+	}
+	if devices := cfg.GetTrustedDevices("jdoe", "local"); len(devices) != 1 {
+		t.Fatalf("unexpected trusted devices after revocation: %v", devices)
+	}
+}
+
+func TestForRealm(t *testing.T) {
+	testFailed := 0
+	methods["sms"] = &Method{Name: "sms", Title: "Text Message"}
+	defer delete(methods, "sms")
+	tokens := []*identity.MfaToken{
+		{ID: "1", Type: "totp"},
+		{ID: "2", Type: "sms"},
+	}
+	tests := []struct {
+		realms     map[string]*RealmConfig
+		realm      string
+		expected   []string
+		shouldFail bool
+	}{
+		{realm: "local", expected: []string{"totp", "sms"}},
+		{
+			realms:   map[string]*RealmConfig{"contoso": {Methods: []string{"sms"}}},
+			realm:    "contoso",
+			expected: []string{"sms"},
+		},
+		{
+			realms:   map[string]*RealmConfig{"contoso": {Methods: []string{"sms"}}},
+			realm:    "local",
+			expected: []string{"totp", "sms"},
+		},
+		{
+			realms:   map[string]*RealmConfig{"contoso": {DefaultMethod: "sms"}},
+			realm:    "contoso",
+			expected: []string{"sms", "totp"},
+		},
+		{
+			realms:     map[string]*RealmConfig{"contoso": {Methods: []string{"u2f"}}},
+			shouldFail: true,
+		},
+		{
+			realms:     map[string]*RealmConfig{"contoso": {Methods: []string{"totp"}, DefaultMethod: "sms"}},
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, realm: %s", i, test.realm)
+		config := &Config{Realms: test.realms}
+		err := config.Configure()
+		if test.shouldFail {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but received none", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, received expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		var names []string
+		for _, m := range config.ForRealm(test.realm).GetMethods(tokens) {
+			names = append(names, m.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, names)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestIsTrustedNetwork(t *testing.T) {
+	testFailed := 0
+	config := &Config{
+		Adaptive:        true,
+		TrustedNetworks: []string{"10.0.0.0/8", "192.168.1.10"},
+		TrustedProxies:  []string{"172.16.0.1"},
+	}
+	if err := config.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	tests := []struct {
+		remoteAddr   string
+		realIP       string
+		forwardedFor string
+		expected     bool
+	}{
+		{remoteAddr: "10.1.2.3:5000", expected: true},
+		{remoteAddr: "192.168.1.10:5000", expected: true},
+		{remoteAddr: "192.168.1.11:5000", expected: false},
+		{remoteAddr: "8.8.8.8:5000", realIP: "10.1.2.3", expected: false},
+		{remoteAddr: "8.8.8.8:5000", forwardedFor: "10.1.2.3", expected: false},
+		{remoteAddr: "172.16.0.1:5000", realIP: "10.1.2.3", expected: true},
+		{remoteAddr: "172.16.0.1:5000", forwardedFor: "10.1.2.3", expected: true},
+		{remoteAddr: "172.16.0.1:5000", forwardedFor: "10.1.2.3, 8.8.8.8", expected: false},
+		{remoteAddr: "172.16.0.1:5000", forwardedFor: "8.8.8.8, 10.1.2.3, 172.16.0.1", expected: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, remote: %s, real ip: %s, forwarded for: %s", i, test.remoteAddr, test.realIP, test.forwardedFor)
+		r := httptest.NewRequest("POST", "/auth/login", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.realIP != "" {
+			r.Header.Set("X-Real-Ip", test.realIP)
+		}
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if trusted := config.IsTrustedNetwork(r); trusted != test.expected {
+			t.Logf("FAIL: %s, expected: %t, received: %t", testDescr, test.expected, trusted)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	for _, cfg := range []*Config{{Adaptive: true}, {TrustedNetworks: []string{"10.0.0.0/33"}}} {
+		if err := cfg.Configure(); err == nil {
+			t.Logf("FAIL: expected configuration error for %v", cfg)
+			testFailed++
+		}
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfa
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func (c *Config) configureNetworks() error {
+	var err error
+	if c.Adaptive && len(c.TrustedNetworks) == 0 {
+		return fmt.Errorf("adaptive mfa requires trusted networks")
+	}
+	if c.networks, err = utils.ParseNetworks(c.TrustedNetworks); err != nil {
+		return fmt.Errorf("invalid mfa trusted network: %s", err)
+	}
+	if c.proxies, err = utils.ParseNetworks(c.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid mfa trusted proxy: %s", err)
+	}
+	return nil
+}
+
+// GetSourceAddress returns the source address of the request, taking
+// the forwarding headers of the trusted proxies into account.
+func (c *Config) GetSourceAddress(r *http.Request) net.IP {
+	return utils.GetTrustedSourceAddress(r, c.proxies)
+}
+
+// IsTrustedNetwork returns true when the request came from one of the
+// trusted networks.
+func (c *Config) IsTrustedNetwork(r *http.Request) bool {
+	if len(c.networks) == 0 {
+		return false
+	}
+	ip := c.GetSourceAddress(r)
+	if ip == nil {
+		return false
+	}
+	return utils.ContainsIP(c.networks, ip)
+}
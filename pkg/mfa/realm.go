@@ -0,0 +1,98 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mfa
+
+import (
+	"fmt"
+)
+
+// RealmConfig is the multi-factor authentication method selection of
+// a realm.
+type RealmConfig struct {
+	// The methods offered to the users of the realm. When empty, all
+	// the supported methods are offered.
+	Methods []string `json:"methods,omitempty"`
+	// The method offered first to the users of the realm. It defaults
+	// to the first of the realm's methods.
+	DefaultMethod string `json:"default_method,omitempty"`
+	// The method offered first when a user is not enrolled in the
+	// default method of the realm.
+	FallbackMethod string `json:"fallback_method,omitempty"`
+}
+
+// configureRealms validates the per-realm method selection and derives
+// the configuration of each realm from the global one.
+func (c *Config) configureRealms() error {
+	c.realms = nil
+	if len(c.Realms) == 0 {
+		return nil
+	}
+	c.realms = make(map[string]*Config)
+	for realm, rc := range c.Realms {
+		if realm == "" {
+			return fmt.Errorf("mfa realm name is empty")
+		}
+		if rc == nil {
+			return fmt.Errorf("mfa realm %s has no configuration", realm)
+		}
+		cfg := *c
+		cfg.Realms = nil
+		cfg.realms = nil
+		if len(rc.Methods) > 0 {
+			cfg.allowed = make(map[string]bool)
+			for _, name := range rc.Methods {
+				if _, exists := methods[name]; !exists {
+					return fmt.Errorf("unsupported mfa method in %s realm: %s", realm, name)
+				}
+				cfg.allowed[name] = true
+			}
+			if !cfg.allowed[cfg.DefaultMethod] {
+				cfg.DefaultMethod = rc.Methods[0]
+			}
+			if !cfg.allowed[cfg.FallbackMethod] {
+				cfg.FallbackMethod = ""
+			}
+		}
+		for _, name := range []string{rc.DefaultMethod, rc.FallbackMethod} {
+			if name == "" {
+				continue
+			}
+			if _, exists := methods[name]; !exists {
+				return fmt.Errorf("unsupported mfa method in %s realm: %s", realm, name)
+			}
+			if cfg.allowed != nil && !cfg.allowed[name] {
+				return fmt.Errorf("mfa method %s is not offered in %s realm", name, realm)
+			}
+		}
+		if rc.DefaultMethod != "" {
+			cfg.DefaultMethod = rc.DefaultMethod
+		}
+		if rc.FallbackMethod != "" {
+			cfg.FallbackMethod = rc.FallbackMethod
+		}
+		c.realms[realm] = &cfg
+	}
+	return nil
+}
+
+// ForRealm returns the multi-factor authentication configuration of
+// the realm. When the realm has no method selection of its own, it
+// returns the global configuration.
+func (c *Config) ForRealm(realm string) *Config {
+	if cfg, exists := c.realms[realm]; exists {
+		return cfg
+	}
+	return c
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passthrough
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+const (
+	// TimestampParam is the name of the parameter holding the time the
+	// claims were appended, in seconds since epoch.
+	TimestampParam = "ts"
+	// SignatureParam is the name of the parameter holding the signature.
+	SignatureParam = "sig"
+)
+
+var supportedClaims = map[string]bool{
+	"sub":    true,
+	"email":  true,
+	"name":   true,
+	"roles":  true,
+	"origin": true,
+	"realm":  true,
+	"token":  true,
+}
+
+// Config represent a common set of configuration settings for passing
+// the claims of the authenticated users to the post-login redirect URL.
+type Config struct {
+	// The claims appended to the redirect URL, i.e. sub, email, name,
+	// roles, origin, realm, or token.
+	Claims []string `json:"claims,omitempty"`
+	// The part of the redirect URL the claims are appended to, i.e.
+	// query or fragment. The default is fragment, because browsers do
+	// not send it to servers.
+	Mode string `json:"mode,omitempty"`
+	// The shared secret signing the appended claims.
+	Secret string `json:"secret,omitempty"`
+	// The hosts of the redirect URLs the claims may be appended to, e.g.
+	// app.contoso.com or *.contoso.com. The relative redirect URLs are
+	// always allowed.
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+}
+
+// Configure validates the configuration and sets default values.
+func (c *Config) Configure() error {
+	if !c.Enabled() {
+		return nil
+	}
+	for _, claim := range c.Claims {
+		if !supportedClaims[claim] {
+			return fmt.Errorf("redirect passthrough claim %s is unsupported", claim)
+		}
+	}
+	switch c.Mode {
+	case "":
+		c.Mode = "fragment"
+	case "query", "fragment":
+	default:
+		return fmt.Errorf("redirect passthrough mode %s is unsupported", c.Mode)
+	}
+	if len(c.Secret) < 16 {
+		return fmt.Errorf("redirect passthrough secret must be at least 16 characters long")
+	}
+	for i, host := range c.AllowedHosts {
+		c.AllowedHosts[i] = strings.ToLower(host)
+	}
+	return nil
+}
+
+// Enabled returns true when the claims are appended to the redirect URL.
+func (c *Config) Enabled() bool {
+	return c != nil && len(c.Claims) > 0
+}
+
+// IsAllowed returns true when the claims may be appended to the redirect
+// URL.
+func (c *Config) IsAllowed(u *url.URL) bool {
+	if u.Scheme == "" && u.Host == "" {
+		return !strings.HasPrefix(u.Path, "//")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowedHost := range c.AllowedHosts {
+		if strings.HasPrefix(allowedHost, "*.") {
+			if strings.HasSuffix(host, allowedHost[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == allowedHost {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the redirect URL with the claims and their signature
+// appended. The token and the realm are the values of the token and
+// realm claims.
+func (c *Config) Apply(u *url.URL, claims *jwtclaims.UserClaims, token, realm string) (string, error) {
+	if !c.IsAllowed(u) {
+		return "", fmt.Errorf("redirect host %s is not allowed", u.Host)
+	}
+	values := url.Values{}
+	for _, claim := range c.Claims {
+		var v string
+		switch claim {
+		case "sub":
+			v = claims.Subject
+		case "email":
+			v = claims.Email
+		case "name":
+			v = claims.Name
+		case "roles":
+			v = strings.Join(claims.Roles, " ")
+		case "origin":
+			v = claims.Origin
+		case "realm":
+			v = realm
+		case "token":
+			v = token
+		}
+		if v != "" {
+			values.Set(claim, v)
+		}
+	}
+	values.Set(TimestampParam, strconv.FormatInt(time.Now().Unix(), 10))
+	values.Set(SignatureParam, c.Sign(values))
+
+	redirectURL := *u
+	if c.Mode == "query" {
+		q := redirectURL.Query()
+		for k := range values {
+			q.Set(k, values.Get(k))
+		}
+		redirectURL.RawQuery = q.Encode()
+		return redirectURL.String(), nil
+	}
+	fragment, err := url.ParseQuery(redirectURL.Fragment)
+	if err != nil {
+		return "", fmt.Errorf("redirect fragment is malformed: %s", err)
+	}
+	for k := range values {
+		fragment.Set(k, values.Get(k))
+	}
+	redirectURL.Fragment = ""
+	return redirectURL.String() + "#" + fragment.Encode(), nil
+}
+
+// Sign returns the base64url-encoded HMAC-SHA256 signature of the
+// configured claims and the timestamp found in the values. The other
+// values, e.g. the query parameters of the application, are not signed.
+// The signed values are URL-encoded in the order of their names.
+func (c *Config) Sign(values url.Values) string {
+	signed := url.Values{}
+	for _, k := range append([]string{TimestampParam}, c.Claims...) {
+		if v, exists := values[k]; exists {
+			signed[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write([]byte(signed.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true when the signature of the values is valid.
+func (c *Config) Verify(values url.Values) bool {
+	return hmac.Equal([]byte(values.Get(SignatureParam)), []byte(c.Sign(values)))
+}
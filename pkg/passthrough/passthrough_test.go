@@ -0,0 +1,133 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passthrough
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestApply(t *testing.T) {
+	testFailed := 0
+	claims := &jwtclaims.UserClaims{
+		Subject: "jsmith",
+		Email:   "jsmith@contoso.com",
+		Roles:   []string{"viewer", "editor"},
+	}
+	tests := []struct {
+		mode        string
+		redirectURL string
+		expected    map[string]string
+		shouldFail  bool
+	}{
+		{
+			redirectURL: "/app/",
+			expected:    map[string]string{"sub": "jsmith", "roles": "viewer editor", "realm": "local"},
+		},
+		{
+			mode:        "query",
+			redirectURL: "https://app.contoso.com/?page=1",
+			expected:    map[string]string{"page": "1", "sub": "jsmith", "roles": "viewer editor", "realm": "local"},
+		},
+		{
+			mode:        "query",
+			redirectURL: "https://app.contoso.com/?sub=admin",
+			expected:    map[string]string{"sub": "jsmith", "roles": "viewer editor", "realm": "local"},
+		},
+		{
+			redirectURL: "https://www.app.contoso.com/#view=home",
+			expected:    map[string]string{"view": "home", "sub": "jsmith", "roles": "viewer editor", "realm": "local"},
+		},
+		{redirectURL: "https://contoso.com.evil.com/", shouldFail: true},
+		{redirectURL: "//evil.com/", shouldFail: true},
+		{redirectURL: "javascript:alert(1)", shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, mode: %s, redirect url: %s", i, test.mode, test.redirectURL)
+		cfg := &Config{
+			Claims:       []string{"sub", "roles", "realm"},
+			Mode:         test.mode,
+			Secret:       "0123456789abcdef",
+			AllowedHosts: []string{"app.contoso.com", "*.app.contoso.com"},
+		}
+		if err := cfg.Configure(); err != nil {
+			t.Fatalf("FAIL: %s, unexpected configuration error: %s", testDescr, err)
+		}
+		redirectURL, err := url.Parse(test.redirectURL)
+		if err != nil {
+			t.Fatalf("FAIL: %s, failed parsing redirect url: %s", testDescr, err)
+		}
+		location, err := cfg.Apply(redirectURL, claims, "", "local")
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s", testDescr)
+			continue
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error, received: %s", testDescr, location)
+			testFailed++
+			continue
+		}
+		u, _ := url.Parse(location)
+		values := u.Query()
+		if cfg.Mode == "fragment" {
+			values, _ = url.ParseQuery(u.Fragment)
+		}
+		if !cfg.Verify(values) {
+			t.Logf("FAIL: %s, signature verification failed: %s", testDescr, location)
+			testFailed++
+			continue
+		}
+		mismatch := false
+		for k, v := range test.expected {
+			if values.Get(k) != v {
+				t.Logf("FAIL: %s, %s value mismatch: %s (expected) vs. %s (received)", testDescr, k, v, values.Get(k))
+				mismatch = true
+			}
+		}
+		values.Set("roles", "admin")
+		if cfg.Verify(values) {
+			t.Logf("FAIL: %s, tampered values passed verification", testDescr)
+			mismatch = true
+		}
+		if mismatch {
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	for i, cfg := range []*Config{
+		{Claims: []string{"password"}, Secret: strings.Repeat("x", 16)},
+		{Claims: []string{"sub"}, Mode: "path", Secret: strings.Repeat("x", 16)},
+		{Claims: []string{"sub"}, Secret: "short"},
+	} {
+		if err := cfg.Configure(); err == nil {
+			t.Logf("FAIL: Test %d, config: %+v, expected configuration error", i, cfg)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/validators"
+)
+
+const (
+	// FormFieldPrefix is the prefix of the names of the form inputs
+	// holding the profile fields, e.g. profile_department.
+	FormFieldPrefix = "profile_"
+	// defaultMaxLength is the default maximum number of characters of
+	// a profile field value.
+	defaultMaxLength = 100
+)
+
+var (
+	fieldNameRegex  = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	phoneValueRegex = regexp.MustCompile(`^\+?[0-9][0-9 ().-]{3,24}$`)
+)
+
+// Field is an additional profile field, e.g. department, the users
+// provide at registration and edit in their settings.
+type Field struct {
+	// The name of the field, e.g. department.
+	Name string `json:"name,omitempty"`
+	// The label of the form input. It defaults to the name.
+	Label string `json:"label,omitempty"`
+	// The type of the field, i.e. text, email, phone, or number.
+	Type string `json:"type,omitempty"`
+	// When enabled, the users must provide a value.
+	Required bool `json:"required,omitempty"`
+	// The maximum number of characters of the value, 100 by default.
+	MaxLength int `json:"max_length,omitempty"`
+	// The name of the claim the value is added to, if any.
+	Claim string `json:"claim,omitempty"`
+}
+
+// Schema represents a common set of configuration settings for the
+// additional profile fields.
+type Schema struct {
+	Fields []*Field `json:"fields,omitempty"`
+}
+
+// Configure validates the fields.
+func (s *Schema) Configure() error {
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		if !fieldNameRegex.MatchString(f.Name) {
+			return fmt.Errorf("profile field name %q is invalid", f.Name)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("profile field %s is duplicate", f.Name)
+		}
+		names[f.Name] = true
+		switch f.Type {
+		case "":
+			f.Type = "text"
+		case "text", "email", "phone", "number":
+		default:
+			return fmt.Errorf("profile field %s has unsupported type: %s", f.Name, f.Type)
+		}
+		if f.MaxLength < 0 {
+			return fmt.Errorf("profile field %s max length must not be negative", f.Name)
+		}
+		if f.MaxLength == 0 {
+			f.MaxLength = defaultMaxLength
+		}
+		if f.Label == "" {
+			f.Label = strings.Title(strings.ReplaceAll(f.Name, "_", " "))
+		}
+	}
+	return nil
+}
+
+// Enabled returns true when the schema has fields.
+func (s *Schema) Enabled() bool {
+	return len(s.Fields) > 0
+}
+
+// FieldNames returns the names of the fields.
+func (s *Schema) FieldNames() []string {
+	var names []string
+	for _, f := range s.Fields {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// Select returns the schema having the fields with the names only, in
+// the order of the schema.
+func (s *Schema) Select(names []string) *Schema {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+	}
+	subset := &Schema{}
+	for _, f := range s.Fields {
+		if selected[f.Name] {
+			subset.Fields = append(subset.Fields, f)
+		}
+	}
+	return subset
+}
+
+// IsFormField returns true when the form input holds a profile field.
+func (s *Schema) IsFormField(k string) bool {
+	if !strings.HasPrefix(k, FormFieldPrefix) {
+		return false
+	}
+	for _, f := range s.Fields {
+		if f.Name == strings.TrimPrefix(k, FormFieldPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMaxFormSize returns the maximum number of bytes the profile fields
+// add to a URL-encoded form.
+func (s *Schema) GetMaxFormSize() int64 {
+	var size int64
+	for _, f := range s.Fields {
+		// The encoding of a character takes up to 12 bytes, e.g. %E2%82%AC.
+		size += int64(len(FormFieldPrefix) + len(f.Name) + 2 + f.MaxLength*12)
+	}
+	return size
+}
+
+// Parse returns the values of the profile fields submitted via the form.
+// The empty values are omitted. It returns an error when a required
+// field is empty, or a value does not match the type of its field.
+func (s *Schema) Parse(form url.Values) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, f := range s.Fields {
+		v := strings.TrimSpace(form.Get(FormFieldPrefix + f.Name))
+		if v == "" {
+			if f.Required {
+				return nil, fmt.Errorf("%s is required", f.Label)
+			}
+			continue
+		}
+		if utf8.RuneCountInString(v) > f.MaxLength {
+			return nil, fmt.Errorf("%s exceeds %d characters", f.Label, f.MaxLength)
+		}
+		switch f.Type {
+		case "email":
+			if err := validators.ValidateUserInputEmail(v, make(map[string]interface{})); err != nil {
+				return nil, fmt.Errorf("%s is not a valid email address", f.Label)
+			}
+		case "phone":
+			if !phoneValueRegex.MatchString(v) {
+				return nil, fmt.Errorf("%s is not a valid phone number", f.Label)
+			}
+		case "number":
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("%s is not a valid number", f.Label)
+			}
+		}
+		values[f.Name] = v
+	}
+	return values, nil
+}
+
+// HasClaims returns true when any of the fields is mapped to a claim.
+func (s *Schema) HasClaims() bool {
+	for _, f := range s.Fields {
+		if f.Claim != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetClaims returns the claims the values of the fields are mapped to.
+func (s *Schema) GetClaims(values map[string]string) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, f := range s.Fields {
+		if f.Claim == "" {
+			continue
+		}
+		if v, exists := values[f.Name]; exists {
+			m[f.Claim] = v
+		}
+	}
+	return m
+}
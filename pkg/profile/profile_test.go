@@ -0,0 +1,148 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseProfile(t *testing.T) {
+	testFailed := 0
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "department", Required: true, Claim: "dept"},
+			{Name: "phone", Type: "phone", MaxLength: 20},
+			{Name: "employee_id", Type: "number"},
+			{Name: "manager_email", Type: "email"},
+		},
+	}
+	if err := schema.Configure(); err != nil {
+		t.Fatalf("failed configuring schema: %s", err)
+	}
+	if schema.Fields[0].Type != "text" || schema.Fields[0].MaxLength != defaultMaxLength || schema.Fields[2].Label != "Employee Id" {
+		t.Fatalf("unexpected field defaults: %+v, %+v", schema.Fields[0], schema.Fields[2])
+	}
+
+	tests := []struct {
+		form       url.Values
+		expected   map[string]string
+		shouldFail bool
+	}{
+		{
+			form:     url.Values{"profile_department": {" IT "}},
+			expected: map[string]string{"department": "IT"},
+		},
+		{
+			form: url.Values{
+				"profile_department":    {"IT"},
+				"profile_phone":         {"+1 (212) 555-0100"},
+				"profile_employee_id":   {"1234"},
+				"profile_manager_email": {"jsmith@contoso.com"},
+			},
+			expected: map[string]string{
+				"department":    "IT",
+				"phone":         "+1 (212) 555-0100",
+				"employee_id":   "1234",
+				"manager_email": "jsmith@contoso.com",
+			},
+		},
+		{
+			form:       url.Values{"profile_phone": {"+1 212 555 0100"}},
+			shouldFail: true,
+		},
+		{
+			form:       url.Values{"profile_department": {"IT"}, "profile_phone": {"call me"}},
+			shouldFail: true,
+		},
+		{
+			form:       url.Values{"profile_department": {"IT"}, "profile_phone": {"+1 212 555 0100 555 0100 555"}},
+			shouldFail: true,
+		},
+		{
+			form:       url.Values{"profile_department": {"IT"}, "profile_employee_id": {"12a"}},
+			shouldFail: true,
+		},
+		{
+			form:       url.Values{"profile_department": {"IT"}, "profile_manager_email": {"jsmith"}},
+			shouldFail: true,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, form: %v", i, test.form)
+		values, err := schema.Parse(test.form)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, values)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	claims := schema.GetClaims(map[string]string{"department": "IT", "phone": "5550100"})
+	if !reflect.DeepEqual(claims, map[string]interface{}{"dept": "IT"}) {
+		t.Logf("FAIL: unexpected claims: %v", claims)
+		testFailed++
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestConfigureProfile(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		fields     []*Field
+		shouldFail bool
+	}{
+		{fields: []*Field{{Name: "department"}}},
+		{fields: []*Field{{Name: "Department"}}, shouldFail: true},
+		{fields: []*Field{{Name: "department"}, {Name: "department"}}, shouldFail: true},
+		{fields: []*Field{{Name: "department", Type: "date"}}, shouldFail: true},
+		{fields: []*Field{{Name: "department", MaxLength: -1}}, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d", i)
+		schema := &Schema{Fields: test.fields}
+		err := schema.Configure()
+		if (err != nil) != test.shouldFail {
+			t.Logf("FAIL: %s, error: %v, expected failure: %t", testDescr, err, test.shouldFail)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
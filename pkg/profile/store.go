@@ -0,0 +1,112 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// StoreSuffix is the suffix of the file holding the profile fields of
+// the users of an identity database, e.g. users.json.profiles.json.
+const StoreSuffix = ".profiles.json"
+
+// stores holds the opened stores, keyed by their file paths, so that
+// a file has a single writer.
+var stores = struct {
+	mux     sync.Mutex
+	entries map[string]*Store
+}{
+	entries: make(map[string]*Store),
+}
+
+// Store holds the profile fields of the users, keyed by user id. The
+// users of the identity database have no extensible attributes, so the
+// fields are stored alongside the database.
+type Store struct {
+	mux     sync.Mutex
+	path    string
+	entries map[string]map[string]string
+}
+
+// OpenStore returns the store of the file. It loads the file, if any.
+func OpenStore(path string) (*Store, error) {
+	stores.mux.Lock()
+	defer stores.mux.Unlock()
+	if s, exists := stores.entries[path]; exists {
+		return s, nil
+	}
+	s := &Store{
+		path:    path,
+		entries: make(map[string]map[string]string),
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed reading profile store %s: %s", path, err)
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.entries); err != nil {
+			return nil, fmt.Errorf("failed parsing profile store %s: %s", path, err)
+		}
+	}
+	stores.entries[path] = s
+	return s, nil
+}
+
+// Get returns the profile fields of the user.
+func (s *Store) Get(userID string) map[string]string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	values := make(map[string]string)
+	for k, v := range s.entries[userID] {
+		values[k] = v
+	}
+	return values
+}
+
+// Set replaces the profile fields of the user and saves the store.
+func (s *Store) Set(userID string, values map[string]string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	prev, existed := s.entries[userID]
+	if len(values) == 0 {
+		delete(s.entries, userID)
+	} else {
+		s.entries[userID] = values
+	}
+	if err := s.save(); err != nil {
+		if existed {
+			s.entries[userID] = prev
+		} else {
+			delete(s.entries, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.path, b, 0600); err != nil {
+		return fmt.Errorf("failed saving profile store %s: %s", s.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is the maximum number of login attempts within an interval.
+type Limit struct {
+	// The maximum number of attempts.
+	Attempts int `json:"attempts,omitempty"`
+	// The interval, in seconds.
+	Interval int `json:"interval,omitempty"`
+}
+
+// RateLimit represent a common set of configuration settings for the
+// rate limiting of login attempts.
+type RateLimit struct {
+	// The limit of login attempts against a single account, regardless
+	// of the source address of the attempts.
+	Username *Limit `json:"username,omitempty"`
+	// The function called in a separate goroutine when the attempts
+	// against an account first exceed the limit, i.e. once per lockout.
+	OnLockout func(username, realm string, until time.Time) `json:"-"`
+	// The headers of the throttled responses, i.e. retry-after and
+	// ratelimit, or none. By default, the responses have the
+	// Retry-After header only.
+	Headers []string `json:"headers,omitempty"`
+
+	retryAfterHeader bool
+	rateLimitHeaders bool
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+type window struct {
+	attempts int
+	resetAt  time.Time
+}
+
+// Configure validates the limits.
+func (l *RateLimit) Configure() error {
+	if l.Username != nil {
+		if l.Username.Attempts < 1 {
+			return fmt.Errorf("username rate limit attempts must be greater than zero")
+		}
+		if l.Username.Interval < 1 {
+			return fmt.Errorf("username rate limit interval must be greater than zero")
+		}
+	}
+	if len(l.Headers) == 0 {
+		l.Headers = []string{"retry-after"}
+	}
+	l.retryAfterHeader = false
+	l.rateLimitHeaders = false
+	for _, header := range l.Headers {
+		switch header {
+		case "retry-after":
+			l.retryAfterHeader = true
+		case "ratelimit":
+			l.rateLimitHeaders = true
+		case "none":
+			if len(l.Headers) > 1 {
+				return fmt.Errorf("rate limit headers must not combine none with other headers")
+			}
+		default:
+			return fmt.Errorf("rate limit header is unsupported: %s", header)
+		}
+	}
+	l.windows = make(map[string]*window)
+	return nil
+}
+
+// SetHeaders adds the configured headers to the response throttled for
+// the retryAfter duration. The ratelimit headers follow the IETF draft
+// of the RateLimit header fields.
+func (l *RateLimit) SetHeaders(h http.Header, retryAfter time.Duration) {
+	seconds := strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second))
+	if l.retryAfterHeader {
+		h.Set("Retry-After", seconds)
+	}
+	if l.rateLimitHeaders && l.Username != nil {
+		h.Set("RateLimit-Limit", strconv.Itoa(l.Username.Attempts))
+		h.Set("RateLimit-Remaining", "0")
+		h.Set("RateLimit-Reset", seconds)
+	}
+}
+
+// AllowUsername records a login attempt against the username in the
+// realm. It returns false and the time until the next allowed attempt
+// when the attempt exceeds the limit.
+func (l *RateLimit) AllowUsername(username, realm string) (bool, time.Duration) {
+	if l.Username == nil {
+		return true, 0
+	}
+	key := strings.ToLower(strings.TrimSpace(username)) + "|" + realm
+	now := time.Now()
+	interval := time.Duration(l.Username.Interval) * time.Second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > interval {
+		for k, w := range l.windows {
+			if now.After(w.resetAt) {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	w, exists := l.windows[key]
+	if !exists || now.After(w.resetAt) {
+		w = &window{resetAt: now.Add(interval)}
+		l.windows[key] = w
+	}
+	w.attempts++
+	if w.attempts == l.Username.Attempts+1 && l.OnLockout != nil {
+		go l.OnLockout(username, realm, w.resetAt)
+	}
+	if w.attempts > l.Username.Attempts {
+		return false, w.resetAt.Sub(now)
+	}
+	return true, 0
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAllowUsername(t *testing.T) {
+	testFailed := 0
+	l := &RateLimit{Username: &Limit{Attempts: 3, Interval: 60}}
+	if err := l.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	tests := []struct {
+		username string
+		realm    string
+		allowed  bool
+	}{
+		{username: "jsmith", realm: "local", allowed: true},
+		{username: "JSmith", realm: "local", allowed: true},
+		{username: " jsmith ", realm: "local", allowed: true},
+		{username: "jsmith", realm: "local", allowed: false},
+		{username: "jsmith", realm: "ldap", allowed: true},
+		{username: "bjones", realm: "local", allowed: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, username: %q, realm: %s", i, test.username, test.realm)
+		allowed, retryAfter := l.AllowUsername(test.username, test.realm)
+		if allowed != test.allowed {
+			t.Logf("FAIL: %s, expected allowed: %t, received: %t", testDescr, test.allowed, allowed)
+			testFailed++
+			continue
+		}
+		if !allowed && retryAfter <= 0 {
+			t.Logf("FAIL: %s, expected positive retry interval, received: %s", testDescr, retryAfter)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	for _, limit := range []*Limit{{Attempts: 0, Interval: 60}, {Attempts: 5, Interval: 0}} {
+		l := &RateLimit{Username: limit}
+		if err := l.Configure(); err == nil {
+			t.Logf("FAIL: limit %v, expected error", limit)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestOnLockout(t *testing.T) {
+	lockouts := make(chan string, 10)
+	l := &RateLimit{
+		Username: &Limit{Attempts: 2, Interval: 60},
+		OnLockout: func(username, realm string, until time.Time) {
+			lockouts <- username + "|" + realm
+		},
+	}
+	if err := l.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	for i := 0; i < 5; i++ {
+		l.AllowUsername("jsmith", "local")
+	}
+	select {
+	case v := <-lockouts:
+		if v != "jsmith|local" {
+			t.Fatalf("unexpected lockout: %s", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("lockout callback was not called")
+	}
+	select {
+	case v := <-lockouts:
+		t.Fatalf("lockout callback was called more than once: %s", v)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		headers  []string
+		expected map[string]string
+	}{
+		{
+			expected: map[string]string{"Retry-After": "30"},
+		},
+		{
+			headers: []string{"retry-after", "ratelimit"},
+			expected: map[string]string{
+				"Retry-After":         "30",
+				"RateLimit-Limit":     "3",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "30",
+			},
+		},
+		{
+			headers: []string{"ratelimit"},
+			expected: map[string]string{
+				"RateLimit-Limit":     "3",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "30",
+			},
+		},
+		{
+			headers:  []string{"none"},
+			expected: map[string]string{},
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, headers: %v", i, test.headers)
+		l := &RateLimit{Username: &Limit{Attempts: 3, Interval: 60}, Headers: test.headers}
+		if err := l.Configure(); err != nil {
+			t.Fatalf("unexpected configuration error: %s", err)
+		}
+		h := make(http.Header)
+		l.SetHeaders(h, 29500*time.Millisecond)
+		if len(h) != len(test.expected) {
+			t.Logf("FAIL: %s, expected headers: %v, received: %v", testDescr, test.expected, h)
+			testFailed++
+			continue
+		}
+		for k, v := range test.expected {
+			if h.Get(k) != v {
+				t.Logf("FAIL: %s, expected %s: %s, received: %s", testDescr, k, v, h.Get(k))
+				testFailed++
+			}
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	for _, headers := range [][]string{{"x-ratelimit"}, {"none", "ratelimit"}} {
+		l := &RateLimit{Headers: headers}
+		if err := l.Configure(); err == nil {
+			t.Logf("FAIL: headers %v, expected error", headers)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Answer is a salted hash of the answer to a security question.
+type Answer struct {
+	QuestionID string `json:"question_id,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+}
+
+// Record holds the security answers of a user.
+type Record struct {
+	Email        string    `json:"email,omitempty"`
+	Answers      []*Answer `json:"answers,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+type attempt struct {
+	count       int
+	lockedUntil time.Time
+	lastAttempt time.Time
+}
+
+// Database is a file-based store of security answers.
+type Database struct {
+	Records  map[string]*Record `json:"records,omitempty"`
+	mux      sync.Mutex
+	path     string
+	attempts map[string]*attempt
+}
+
+// NewDatabase returns an instance of Database. It loads the records from
+// the file at the path, if the file exists.
+func NewDatabase(fp string) (*Database, error) {
+	db := &Database{
+		Records:  make(map[string]*Record),
+		path:     fp,
+		attempts: make(map[string]*attempt),
+	}
+	fileInfo, err := os.Stat(fp)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return db, db.save()
+		}
+		return nil, fmt.Errorf("security answers database read failed: %s", err)
+	}
+	if fileInfo.IsDir() {
+		return nil, fmt.Errorf("security answers database path %s is a directory", fp)
+	}
+	content, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, fmt.Errorf("security answers database read failed: %s", err)
+	}
+	if err := json.Unmarshal(content, db); err != nil {
+		return nil, fmt.Errorf("security answers database load failed: %s", err)
+	}
+	if db.Records == nil {
+		db.Records = make(map[string]*Record)
+	}
+	return db, nil
+}
+
+func (db *Database) save() error {
+	content, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(db.path, content, 0600); err != nil {
+		return fmt.Errorf("security answers database write failed: %s", err)
+	}
+	return nil
+}
+
+// SetAnswers replaces the security answers of a user. The answers are
+// keyed by question ID.
+func (db *Database) SetAnswers(key, email string, answers map[string]string) error {
+	record := &Record{
+		Email:        email,
+		LastModified: time.Now().UTC(),
+	}
+	for questionID, s := range answers {
+		h, err := bcrypt.GenerateFromPassword([]byte(normalizeAnswer(s)), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed hashing security answer")
+		}
+		record.Answers = append(record.Answers, &Answer{
+			QuestionID: questionID,
+			Hash:       string(h),
+		})
+	}
+	sort.Slice(record.Answers, func(i, j int) bool {
+		return record.Answers[i].QuestionID < record.Answers[j].QuestionID
+	})
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	db.Records[key] = record
+	return db.save()
+}
+
+// GetQuestionIDs returns the IDs of the questions a user answered.
+func (db *Database) GetQuestionIDs(key string) []string {
+	var ids []string
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	record, exists := db.Records[key]
+	if !exists {
+		return ids
+	}
+	for _, answer := range record.Answers {
+		ids = append(ids, answer.QuestionID)
+	}
+	return ids
+}
+
+// Verify checks the email address and the answers of a user. After
+// maxAttempts failed attempts, the verification is locked for the
+// lockout duration. When autoReset is greater than zero, the failed
+// attempts are forgotten after no attempts were made for that long.
+// The attempts rejected during the lockout count as activity, so the
+// counter does not reset while the account is under attack.
+func (db *Database) Verify(key, email string, answers map[string]string, requireEmail bool, maxAttempts int, lockout, autoReset time.Duration) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	now := time.Now()
+	if a, exists := db.attempts[key]; exists {
+		if now.Before(a.lockedUntil) {
+			a.lastAttempt = now
+			return fmt.Errorf("too many failed attempts, try again later")
+		}
+		if autoReset > 0 && now.Sub(a.lastAttempt) >= autoReset {
+			delete(db.attempts, key)
+		}
+	}
+	if err := db.verify(key, email, answers, requireEmail); err != nil {
+		a, exists := db.attempts[key]
+		if !exists || (a.count >= maxAttempts && now.After(a.lockedUntil)) {
+			a = &attempt{}
+			db.attempts[key] = a
+		}
+		a.count++
+		a.lastAttempt = now
+		if a.count >= maxAttempts {
+			a.lockedUntil = now.Add(lockout)
+		}
+		return err
+	}
+	delete(db.attempts, key)
+	return nil
+}
+
+func (db *Database) verify(key, email string, answers map[string]string, requireEmail bool) error {
+	record, exists := db.Records[key]
+	if !exists || len(record.Answers) == 0 {
+		return fmt.Errorf("security answers mismatch")
+	}
+	if requireEmail && !strings.EqualFold(record.Email, strings.TrimSpace(email)) {
+		return fmt.Errorf("security answers mismatch")
+	}
+	for _, answer := range record.Answers {
+		s, exists := answers[answer.QuestionID]
+		if !exists {
+			return fmt.Errorf("security answers mismatch")
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(answer.Hash), []byte(normalizeAnswer(s))); err != nil {
+			return fmt.Errorf("security answers mismatch")
+		}
+	}
+	return nil
+}
+
+// normalizeAnswer makes answers case and whitespace insensitive.
+func normalizeAnswer(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// Question is a security question.
+type Question struct {
+	// The identifier of the question, e.g. pet.
+	ID string `json:"id,omitempty"`
+	// The text of the question, e.g. What was the name of your first pet?
+	Text string `json:"text,omitempty"`
+}
+
+// DefaultLinkLifetime is the default number of seconds the recovery
+// links remain valid.
+const DefaultLinkLifetime = 900
+
+// Recovery represent a common set of configuration settings for
+// account recovery via security questions or via the links sent to the
+// email addresses of the accounts.
+type Recovery struct {
+	// The security questions the users choose from.
+	Questions []*Question `json:"questions,omitempty"`
+	// The number of questions a user must answer.
+	RequiredAnswers int `json:"required_answers,omitempty"`
+	// The number of failed recovery attempts before the recovery
+	// of an account is locked.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// The number of minutes the recovery of an account remains locked.
+	LockoutTime int `json:"lockout_time,omitempty"`
+	// The number of minutes without recovery attempts after which the
+	// failed attempts of an account are forgotten. When zero, they are
+	// forgotten only after a successful recovery or an elapsed lockout.
+	AutoResetAfter int `json:"auto_reset_after,omitempty"`
+	// The switch determining whether a user must provide the email address
+	// of the account in addition to the answers.
+	RequireEmail bool `json:"require_email,omitempty"`
+	// The file path to security answers database.
+	Dropbox string `json:"dropbox,omitempty"`
+	// The switch determining whether the users recover the accounts via
+	// the single-use links sent to their email addresses.
+	EmailLink bool `json:"email_link,omitempty"`
+	// The number of seconds the recovery links remain valid.
+	LinkLifetime int `json:"link_lifetime,omitempty"`
+	db           *Database
+}
+
+// Enabled returns true when the account recovery is configured.
+func (r *Recovery) Enabled() bool {
+	return r.QuestionsEnabled() || r.EmailLink
+}
+
+// QuestionsEnabled returns true when the recovery via security questions
+// is configured.
+func (r *Recovery) QuestionsEnabled() bool {
+	return len(r.Questions) > 0 && r.Dropbox != ""
+}
+
+// Configure validates the configuration and loads security
+// answers database.
+func (r *Recovery) Configure() error {
+	if r.EmailLink {
+		if r.QuestionsEnabled() {
+			return fmt.Errorf("recovery via security questions and via email link are mutually exclusive")
+		}
+		if r.LinkLifetime < 0 {
+			return fmt.Errorf("recovery link lifetime must not be negative")
+		}
+		if r.LinkLifetime == 0 {
+			r.LinkLifetime = DefaultLinkLifetime
+		}
+		return nil
+	}
+	if !r.QuestionsEnabled() {
+		return nil
+	}
+	questionIDs := make(map[string]bool)
+	for _, q := range r.Questions {
+		if q.ID == "" || q.Text == "" {
+			return fmt.Errorf("security question must have id and text")
+		}
+		if questionIDs[q.ID] {
+			return fmt.Errorf("security question id %s is duplicate", q.ID)
+		}
+		questionIDs[q.ID] = true
+	}
+	if r.RequiredAnswers == 0 {
+		r.RequiredAnswers = 2
+	}
+	if r.RequiredAnswers > len(r.Questions) {
+		r.RequiredAnswers = len(r.Questions)
+	}
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = 3
+	}
+	if r.LockoutTime == 0 {
+		r.LockoutTime = 60
+	}
+	if r.AutoResetAfter < 0 {
+		return fmt.Errorf("recovery auto reset must not be negative")
+	}
+	db, err := NewDatabase(r.Dropbox)
+	if err != nil {
+		return err
+	}
+	r.db = db
+	return nil
+}
+
+// GetDatabase returns security answers database.
+func (r *Recovery) GetDatabase() *Database {
+	return r.db
+}
+
+// GetQuestion returns the question with the provided id.
+func (r *Recovery) GetQuestion(id string) *Question {
+	for _, q := range r.Questions {
+		if q.ID == id {
+			return q
+		}
+	}
+	return nil
+}
+
+// GetUserQuestions returns the questions a user answered. When the user
+// has no answers, the questions are picked based on the key. It does not
+// reveal whether the user exists.
+func (r *Recovery) GetUserQuestions(key string) []*Question {
+	var questions []*Question
+	for _, id := range r.db.GetQuestionIDs(key) {
+		if q := r.GetQuestion(id); q != nil {
+			questions = append(questions, q)
+		}
+	}
+	if len(questions) > 0 {
+		return questions
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	offset := int(h.Sum32() % uint32(len(r.Questions)))
+	for i := 0; i < r.RequiredAnswers; i++ {
+		questions = append(questions, r.Questions[(offset+i)%len(r.Questions)])
+	}
+	sort.Slice(questions, func(i, j int) bool {
+		return questions[i].ID < questions[j].ID
+	})
+	return questions
+}
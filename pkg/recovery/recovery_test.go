@@ -0,0 +1,194 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecovery(t *testing.T) {
+	testFailed := 0
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Recovery{
+		Questions: []*Question{
+			{ID: "pet", Text: "What was the name of your first pet?"},
+			{ID: "city", Text: "In what city were you born?"},
+			{ID: "school", Text: "What was the name of your first school?"},
+		},
+		MaxAttempts:  2,
+		RequireEmail: true,
+		Dropbox:      filepath.Join(dir, "answers.json"),
+	}
+	if err := cfg.Configure(); err != nil {
+		t.Fatalf("failed configuring recovery: %s", err)
+	}
+	db := cfg.GetDatabase()
+	if err := db.SetAnswers("local/jsmith", "jsmith@contoso.com", map[string]string{
+		"pet":  "Rex",
+		"city": "New  York",
+	}); err != nil {
+		t.Fatalf("failed setting answers: %s", err)
+	}
+
+	if questions := cfg.GetUserQuestions("local/jsmith"); len(questions) != 2 || questions[0].ID != "city" {
+		t.Fatalf("unexpected questions for existing user: %v", questions)
+	}
+	if questions := cfg.GetUserQuestions("local/nobody"); len(questions) != cfg.RequiredAnswers {
+		t.Fatalf("unexpected questions for unknown user: %v", questions)
+	}
+
+	tests := []struct {
+		key        string
+		email      string
+		answers    map[string]string
+		shouldFail bool
+	}{
+		{
+			key:     "local/jsmith",
+			email:   "JSmith@contoso.com",
+			answers: map[string]string{"pet": "rex", "city": "new york "},
+		},
+		{
+			key:        "local/jsmith",
+			email:      "jsmith@contoso.com",
+			answers:    map[string]string{"pet": "rex"},
+			shouldFail: true,
+		},
+		{
+			key:        "local/jsmith",
+			email:      "other@contoso.com",
+			answers:    map[string]string{"pet": "rex", "city": "new york"},
+			shouldFail: true,
+		},
+		{
+			// The recovery is locked after two failed attempts.
+			key:        "local/jsmith",
+			email:      "jsmith@contoso.com",
+			answers:    map[string]string{"pet": "rex", "city": "new york"},
+			shouldFail: true,
+		},
+		{
+			key:        "local/nobody",
+			email:      "nobody@contoso.com",
+			answers:    map[string]string{"pet": "rex", "city": "new york"},
+			shouldFail: true,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, key: %s, answers: %v", i, test.key, test.answers)
+		err := db.Verify(test.key, test.email, test.answers, cfg.RequireEmail, cfg.MaxAttempts, time.Hour, 0)
+		if test.shouldFail {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but succeeded", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	reloaded, err := NewDatabase(cfg.Dropbox)
+	if err != nil {
+		t.Fatalf("failed reloading database: %s", err)
+	}
+	if ids := reloaded.GetQuestionIDs("local/jsmith"); len(ids) != 2 {
+		t.Fatalf("unexpected question ids after reload: %v", ids)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestVerifyAutoReset(t *testing.T) {
+	testFailed := 0
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewDatabase(filepath.Join(dir, "answers.json"))
+	if err != nil {
+		t.Fatalf("failed creating database: %s", err)
+	}
+	if err := db.SetAnswers("local/jsmith", "jsmith@contoso.com", map[string]string{"pet": "Rex"}); err != nil {
+		t.Fatalf("failed setting answers: %s", err)
+	}
+	valid := map[string]string{"pet": "rex"}
+	invalid := map[string]string{"pet": "max"}
+
+	tests := []struct {
+		descr      string
+		answers    map[string]string
+		quiet      time.Duration
+		shouldFail bool
+	}{
+		{descr: "first failed attempt", answers: invalid, shouldFail: true},
+		// The counter resets after the quiet period, so the second
+		// failed attempt does not lock the recovery.
+		{descr: "failed attempt after quiet period", answers: invalid, quiet: 2 * time.Hour, shouldFail: true},
+		{descr: "valid attempt", answers: valid},
+		{descr: "failed attempt", answers: invalid, shouldFail: true},
+		{descr: "locking attempt", answers: invalid, quiet: time.Minute, shouldFail: true},
+		// The lockout is not lifted by the quiet period.
+		{descr: "locked attempt after quiet period", answers: valid, quiet: 2 * time.Hour, shouldFail: true},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.descr)
+		if a, exists := db.attempts["local/jsmith"]; exists && test.quiet > 0 {
+			a.lastAttempt = a.lastAttempt.Add(-test.quiet)
+		}
+		err := db.Verify("local/jsmith", "", test.answers, false, 2, 24*time.Hour, time.Hour)
+		if test.shouldFail {
+			if err == nil {
+				t.Logf("FAIL: %s, expected error, but succeeded", testDescr)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, expected error: %s", testDescr, err)
+			continue
+		}
+		if err != nil {
+			t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registration
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultInvitationLifetime is the default number of seconds an
+// invitation is valid for, i.e. 7 days.
+const DefaultInvitationLifetime = 604800
+
+// DefaultInvitationAdminRole is the default role allowed to create
+// invitations.
+const DefaultInvitationAdminRole = "admin"
+
+// Invitation is a single-use, time-limited token allowing registration.
+type Invitation struct {
+	Token string `json:"token,omitempty"`
+	// The email address the registrant must use, if any.
+	Email string `json:"email,omitempty"`
+	// The roles added to the registrant, if any.
+	Roles []string `json:"roles,omitempty"`
+	// The realm the registrant must register with, if any.
+	Realm     string    `json:"realm,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	used      bool
+}
+
+// InvitationStore holds the invitations issued by administrators. The
+// invitations are kept in memory.
+type InvitationStore struct {
+	mu          sync.Mutex
+	invitations map[string]*Invitation
+}
+
+// NewInvitationStore returns an instance of InvitationStore.
+func NewInvitationStore() *InvitationStore {
+	return &InvitationStore{
+		invitations: make(map[string]*Invitation),
+	}
+}
+
+// Add creates an invitation valid for the lifetime in seconds.
+func (s *InvitationStore) Add(invitation *Invitation, lifetime int) error {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("failed generating invitation token: %s", err)
+	}
+	now := time.Now()
+	invitation.Token = base64.RawURLEncoding.EncodeToString(b)
+	invitation.CreatedAt = now
+	invitation.ExpiresAt = now.Add(time.Duration(lifetime) * time.Second)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, entry := range s.invitations {
+		if now.After(entry.ExpiresAt) {
+			delete(s.invitations, token)
+		}
+	}
+	s.invitations[invitation.Token] = invitation
+	return nil
+}
+
+// Get returns the invitation associated with the token. It returns an
+// error when the invitation does not exist, expired, or was used.
+func (s *InvitationStore) Get(token string) (*Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(token)
+}
+
+func (s *InvitationStore) get(token string) (*Invitation, error) {
+	invitation, exists := s.invitations[token]
+	if !exists {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	if invitation.used {
+		return nil, fmt.Errorf("invitation already used")
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, fmt.Errorf("invitation expired")
+	}
+	return invitation, nil
+}
+
+// Consume marks the invitation associated with the token as used, so that
+// the invitation cannot be used again.
+func (s *InvitationStore) Consume(token string) (*Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invitation, err := s.get(token)
+	if err != nil {
+		return nil, err
+	}
+	invitation.used = true
+	return invitation, nil
+}
+
+// Release makes the consumed invitation available again, e.g. when the
+// registration failed after the invitation was consumed.
+func (s *InvitationStore) Release(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if invitation, exists := s.invitations[token]; exists {
+		invitation.used = false
+	}
+}
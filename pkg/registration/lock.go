@@ -0,0 +1,59 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registration
+
+import (
+	"strings"
+	"sync"
+)
+
+var usernameLocks = &lockTable{entries: make(map[string]*lockEntry)}
+
+type lockTable struct {
+	mu      sync.Mutex
+	entries map[string]*lockEntry
+}
+
+type lockEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// LockUsername serializes the registrations of the same username with the
+// registration database. The usernames are case-insensitive. It returns
+// the function releasing the lock.
+func (r *Registration) LockUsername(username string) func() {
+	key := r.Dropbox + ":" + strings.ToLower(username)
+	t := usernameLocks
+	t.mu.Lock()
+	entry, exists := t.entries[key]
+	if !exists {
+		entry = &lockEntry{}
+		t.entries[key] = entry
+	}
+	entry.refs++
+	t.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+		t.mu.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(t.entries, key)
+		}
+		t.mu.Unlock()
+	}
+}
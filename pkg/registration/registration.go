@@ -30,4 +30,72 @@ type Registration struct {
 	// The switch determining whether the domain associated with an email has
 	// a valid MX DNS record.
 	RequireDomainMailRecord bool `json:"require_domain_mx,omitempty"`
+	// The switch determining whether a user must have an invitation
+	// issued by an administrator.
+	RequireInvitation bool `json:"require_invitation,omitempty"`
+	// The number of seconds an invitation is valid for.
+	InvitationLifetime int `json:"invitation_lifetime,omitempty"`
+	// The roles allowed to create invitations.
+	InvitationAdminRoles []string `json:"invitation_admin_roles,omitempty"`
+	// The invitations issued by administrators.
+	Invitations *InvitationStore `json:"-"`
+	// The realms users may register with, each writing to its own
+	// registration database. The code and the requirements apply to
+	// all realms.
+	Realms []*RealmRegistration `json:"realms,omitempty"`
+	// The multi-step registration wizard. When disabled, the users
+	// register with a single form.
+	Wizard *Wizard `json:"wizard,omitempty"`
+}
+
+// RealmRegistration represents the registration settings of a realm.
+type RealmRegistration struct {
+	// The name of the realm, e.g. local.
+	Realm string `json:"realm,omitempty"`
+	// The title of the registration page. If empty, the title of the
+	// registration page of the portal is used.
+	Title string `json:"title,omitempty"`
+	// The file path to the registration database of the realm.
+	Dropbox string `json:"dropbox,omitempty"`
+}
+
+// ForRealm returns the registration settings of the realm. It returns
+// nil when the registration with the realm is disabled.
+func (r *Registration) ForRealm(realm string) *Registration {
+	if r.Disabled {
+		return nil
+	}
+	for _, entry := range r.Realms {
+		if entry.Realm != realm {
+			continue
+		}
+		realmRegistration := &Registration{
+			Title:                   r.Title,
+			Code:                    r.Code,
+			Dropbox:                 entry.Dropbox,
+			RequireAcceptTerms:      r.RequireAcceptTerms,
+			RequireDomainMailRecord: r.RequireDomainMailRecord,
+			RequireInvitation:       r.RequireInvitation,
+			Invitations:             r.Invitations,
+			Wizard:                  r.Wizard,
+		}
+		if entry.Title != "" {
+			realmRegistration.Title = entry.Title
+		}
+		return realmRegistration
+	}
+	return nil
+}
+
+// IsInvitationAdmin returns true when one of the roles is allowed to
+// create invitations.
+func (r *Registration) IsInvitationAdmin(roles []string) bool {
+	for _, role := range roles {
+		for _, adminRole := range r.InvitationAdminRoles {
+			if role == adminRole {
+				return true
+			}
+		}
+	}
+	return false
 }
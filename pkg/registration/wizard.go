@@ -0,0 +1,133 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultWizardLifetime is the default number of seconds the partial
+// state of a registration wizard remains valid.
+const DefaultWizardLifetime = 1800
+
+// WizardStep is a step of the multi-step registration wizard.
+type WizardStep struct {
+	// The type of the step, i.e. account (username, email, and
+	// password), profile (profile fields), or verification
+	// (registration code, invitation, and terms acceptance).
+	Type string `json:"type,omitempty"`
+	// The title of the step. It defaults to the capitalized type.
+	Title string `json:"title,omitempty"`
+	// The names of the profile fields collected at the profile step.
+	// When empty, the step collects all the profile fields.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Wizard represents a common set of configuration settings for the
+// multi-step registration. The values submitted at each step are kept
+// server-side until the last step completes the registration.
+type Wizard struct {
+	Steps []*WizardStep `json:"steps,omitempty"`
+	// The number of seconds the partial state of an abandoned wizard
+	// remains valid, 1800 by default. Each step renews it.
+	Lifetime int `json:"lifetime,omitempty"`
+}
+
+// Configure validates the steps against the names of the profile
+// fields and sets default values.
+func (wz *Wizard) Configure(profileFields []string) error {
+	if !wz.Enabled() {
+		return nil
+	}
+	if wz.Steps[0].Type != "account" {
+		return fmt.Errorf("registration wizard must start with account step")
+	}
+	knownFields := make(map[string]bool)
+	for _, name := range profileFields {
+		knownFields[name] = true
+	}
+	collectedFields := make(map[string]bool)
+	stepTypes := make(map[string]bool)
+	for i, step := range wz.Steps {
+		switch step.Type {
+		case "account", "verification":
+			if stepTypes[step.Type] {
+				return fmt.Errorf("registration wizard has multiple %s steps", step.Type)
+			}
+			if len(step.Fields) > 0 {
+				return fmt.Errorf("registration wizard %s step does not support fields", step.Type)
+			}
+			if step.Type == "verification" && i != len(wz.Steps)-1 {
+				return fmt.Errorf("registration wizard verification step must be the last one")
+			}
+		case "profile":
+			if len(profileFields) == 0 {
+				return fmt.Errorf("registration wizard profile step requires profile fields")
+			}
+			if len(step.Fields) == 0 {
+				step.Fields = profileFields
+			}
+			for _, name := range step.Fields {
+				if !knownFields[name] {
+					return fmt.Errorf("registration wizard profile step refers to unknown field %s", name)
+				}
+				if collectedFields[name] {
+					return fmt.Errorf("registration wizard collects field %s at multiple steps", name)
+				}
+				collectedFields[name] = true
+			}
+		default:
+			return fmt.Errorf("registration wizard step type %q is unsupported", step.Type)
+		}
+		stepTypes[step.Type] = true
+		if step.Title == "" {
+			step.Title = strings.Title(step.Type)
+		}
+	}
+	for _, name := range profileFields {
+		if !collectedFields[name] {
+			return fmt.Errorf("registration wizard does not collect profile field %s", name)
+		}
+	}
+	if wz.Lifetime < 0 {
+		return fmt.Errorf("registration wizard lifetime must not be negative")
+	}
+	if wz.Lifetime == 0 {
+		wz.Lifetime = DefaultWizardLifetime
+	}
+	return nil
+}
+
+// Enabled returns true when the wizard has steps.
+func (wz *Wizard) Enabled() bool {
+	if wz == nil {
+		return false
+	}
+	return len(wz.Steps) > 0
+}
+
+// HasStep returns true when the wizard has a step of the type.
+func (wz *Wizard) HasStep(stepType string) bool {
+	if !wz.Enabled() {
+		return false
+	}
+	for _, step := range wz.Steps {
+		if step.Type == stepType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registration
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConfigureWizard(t *testing.T) {
+	testFailed := 0
+	profileFields := []string{"department", "phone"}
+	tests := []struct {
+		steps      []*WizardStep
+		shouldFail bool
+	}{
+		{steps: []*WizardStep{{Type: "account"}, {Type: "profile"}, {Type: "verification"}}},
+		{steps: []*WizardStep{{Type: "account"}, {Type: "profile", Fields: []string{"phone"}}, {Type: "profile", Fields: []string{"department"}}}},
+		{steps: []*WizardStep{{Type: "profile"}, {Type: "account"}}, shouldFail: true},
+		{steps: []*WizardStep{{Type: "account"}, {Type: "verification"}, {Type: "profile"}}, shouldFail: true},
+		{steps: []*WizardStep{{Type: "account"}, {Type: "account"}, {Type: "profile"}}, shouldFail: true},
+		{steps: []*WizardStep{{Type: "account"}, {Type: "profile", Fields: []string{"phone"}}}, shouldFail: true},
+		{steps: []*WizardStep{{Type: "account"}, {Type: "profile", Fields: []string{"title"}}, {Type: "profile"}}, shouldFail: true},
+		{steps: []*WizardStep{{Type: "account"}, {Type: "profile"}, {Type: "profile", Fields: []string{"phone"}}}, shouldFail: true},
+		{steps: []*WizardStep{{Type: "account"}, {Type: "profile"}, {Type: "payment"}}, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d", i)
+		wz := &Wizard{Steps: test.steps}
+		err := wz.Configure(profileFields)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if wz.Lifetime != DefaultWizardLifetime || wz.Steps[0].Title != "Account" {
+			t.Logf("FAIL: %s, defaults not set: lifetime %d, title %q", testDescr, wz.Lifetime, wz.Steps[0].Title)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
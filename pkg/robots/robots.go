@@ -0,0 +1,67 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package robots
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// DefaultContent is the default content of robots.txt. It asks the
+// crawlers not to crawl the portal.
+const DefaultContent = "User-agent: *\nDisallow: /\n"
+
+// DefaultTag is the default value of X-Robots-Tag header.
+const DefaultTag = "noindex, nofollow"
+
+// Robots represent a common set of configuration settings for the
+// responses of the portal to search engine crawlers.
+type Robots struct {
+	// The content of robots.txt.
+	Content string `json:"content,omitempty"`
+	// The file path to robots.txt. It overrides the content.
+	ContentPath string `json:"content_path,omitempty"`
+	// The value of X-Robots-Tag header, e.g. noindex.
+	Tag string `json:"tag,omitempty"`
+	// The switch determining whether the portal sets X-Robots-Tag header.
+	DisableTag bool `json:"disable_tag,omitempty"`
+}
+
+// Configure sets default values and loads robots.txt file, if any.
+func (r *Robots) Configure() error {
+	if r.ContentPath != "" {
+		b, err := ioutil.ReadFile(r.ContentPath)
+		if err != nil {
+			return fmt.Errorf("robots.txt read failed: %s", err)
+		}
+		r.Content = string(b)
+	}
+	if r.Content == "" {
+		r.Content = DefaultContent
+	}
+	if r.Tag == "" {
+		r.Tag = DefaultTag
+	}
+	return nil
+}
+
+// SetHeader adds X-Robots-Tag header to the response, unless disabled.
+func (r *Robots) SetHeader(w http.ResponseWriter) {
+	if r.DisableTag {
+		return
+	}
+	w.Header().Set("X-Robots-Tag", r.Tag)
+}
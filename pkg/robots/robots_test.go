@@ -0,0 +1,85 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package robots
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestRobots(t *testing.T) {
+	testFailed := 0
+	fp := filepath.Join(t.TempDir(), "robots.txt")
+	if err := ioutil.WriteFile(fp, []byte("User-agent: *\nDisallow: /auth\n"), 0600); err != nil {
+		t.Fatalf("failed writing robots.txt: %s", err)
+	}
+	tests := []struct {
+		robots     *Robots
+		content    string
+		tag        string
+		shouldFail bool
+	}{
+		{
+			robots:  &Robots{},
+			content: DefaultContent,
+			tag:     DefaultTag,
+		},
+		{
+			robots:  &Robots{ContentPath: fp, Tag: "noindex"},
+			content: "User-agent: *\nDisallow: /auth\n",
+			tag:     "noindex",
+		},
+		{
+			robots:  &Robots{DisableTag: true},
+			content: DefaultContent,
+		},
+		{
+			robots:     &Robots{ContentPath: filepath.Join(t.TempDir(), "missing.txt")},
+			shouldFail: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, robots: %v", i, test.robots)
+		if err := test.robots.Configure(); err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, failed as expected: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		w := httptest.NewRecorder()
+		test.robots.SetHeader(w)
+		if test.robots.Content != test.content || w.Header().Get("X-Robots-Tag") != test.tag {
+			t.Logf("FAIL: %s, content: %q, tag: %q", testDescr, test.robots.Content, w.Header().Get("X-Robots-Tag"))
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
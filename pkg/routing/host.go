@@ -0,0 +1,139 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HostRule allows the requests for the host to authenticate with the
+// realms only.
+type HostRule struct {
+	// The host of the request, e.g. app1.contoso.com, or the wildcard
+	// matching its subdomains, e.g. *.contoso.com.
+	Host string `json:"host,omitempty"`
+	// The realms allowed for the host.
+	Realms []string `json:"realms,omitempty"`
+}
+
+// HostRestriction restricts the realms the users may authenticate with,
+// based on the host of the request or of its referrer. It prevents the
+// logins with the realm of another application, e.g. when a user tampers
+// with the realm field of the login form.
+type HostRestriction struct {
+	Rules []*HostRule `json:"rules,omitempty"`
+	// The source of the host, i.e. host or referer. The referer applies
+	// when the applications share the portal on its own domain.
+	Source string `json:"source,omitempty"`
+	// The switch determining whether the requests for the hosts without
+	// rules are denied. By default, they may use any realm.
+	DenyUnmapped bool `json:"deny_unmapped,omitempty"`
+}
+
+// Configure validates the rules and sets default values.
+func (h *HostRestriction) Configure() error {
+	switch h.Source {
+	case "":
+		h.Source = "host"
+	case "host", "referer":
+	default:
+		return fmt.Errorf("realm host restriction source is unsupported: %s", h.Source)
+	}
+	for _, rule := range h.Rules {
+		rule.Host = strings.ToLower(rule.Host)
+		if rule.Host == "" || rule.Host == "*." || strings.Contains(rule.Host[1:], "*") {
+			return fmt.Errorf("realm host restriction rule has invalid host: %q", rule.Host)
+		}
+		if strings.HasPrefix(rule.Host, "*") && !strings.HasPrefix(rule.Host, "*.") {
+			return fmt.Errorf("realm host restriction rule has invalid host: %q", rule.Host)
+		}
+		if len(rule.Realms) == 0 {
+			return fmt.Errorf("realm host restriction rule %s has no realms", rule.Host)
+		}
+	}
+	return nil
+}
+
+// Enabled returns true when the restriction has rules.
+func (h *HostRestriction) Enabled() bool {
+	return h != nil && len(h.Rules) > 0
+}
+
+// Allow returns true when the request may authenticate with the realm.
+// The exact host rules take precedence over the wildcard ones.
+func (h *HostRestriction) Allow(r *http.Request, realm string) bool {
+	if !h.Enabled() {
+		return true
+	}
+	host := h.getHost(r)
+	rule := h.match(host)
+	if rule == nil {
+		return !h.DenyUnmapped
+	}
+	for _, v := range rule.Realms {
+		if v == realm {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowProvider returns true when the request to an external identity
+// provider backend may authenticate with the realm. The responses of the
+// providers arrive with the referrer of the provider, so the restriction
+// based on the referrer does not apply to them.
+func (h *HostRestriction) AllowProvider(r *http.Request, realm string) bool {
+	if !h.Enabled() || h.Source == "referer" {
+		return true
+	}
+	return h.Allow(r, realm)
+}
+
+func (h *HostRestriction) match(host string) *HostRule {
+	if host == "" {
+		return nil
+	}
+	var wildcard *HostRule
+	for _, rule := range h.Rules {
+		if rule.Host == host {
+			return rule
+		}
+		if wildcard == nil && strings.HasPrefix(rule.Host, "*.") && strings.HasSuffix(host, rule.Host[1:]) {
+			wildcard = rule
+		}
+	}
+	return wildcard
+}
+
+// getHost returns the lowercase host of the request or of its referrer,
+// without the port.
+func (h *HostRestriction) getHost(r *http.Request) string {
+	host := r.Host
+	if h.Source == "referer" {
+		u, err := url.Parse(r.Referer())
+		if err != nil {
+			return ""
+		}
+		host = u.Host
+	}
+	if v, _, err := net.SplitHostPort(host); err == nil {
+		host = v
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostRestriction(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		descr    string
+		config   *HostRestriction
+		host     string
+		referer  string
+		realm    string
+		provider bool
+		expected bool
+	}{
+		{descr: "no rules", config: &HostRestriction{}, host: "app1.contoso.com", realm: "local", expected: true},
+		{descr: "exact host with allowed realm", host: "app1.contoso.com", realm: "local", expected: true},
+		{descr: "exact host with another realm", host: "app1.contoso.com", realm: "ldap", expected: false},
+		{descr: "exact host with port", host: "APP1.contoso.com:8443", realm: "ldap", expected: false},
+		{descr: "exact host over wildcard", host: "app1.contoso.com", realm: "contoso", expected: false},
+		{descr: "wildcard host", host: "app2.contoso.com", realm: "contoso", expected: true},
+		{descr: "wildcard host with another realm", host: "app2.contoso.com", realm: "local", expected: false},
+		{descr: "unmapped host", host: "app.example.com", realm: "local", expected: true},
+		{
+			descr:    "unmapped host denied",
+			config:   &HostRestriction{Rules: []*HostRule{{Host: "app1.contoso.com", Realms: []string{"local"}}}, DenyUnmapped: true},
+			host:     "app.example.com",
+			realm:    "local",
+			expected: false,
+		},
+		{
+			descr:    "referer host",
+			config:   &HostRestriction{Rules: []*HostRule{{Host: "app1.contoso.com", Realms: []string{"local"}}}, Source: "referer"},
+			host:     "auth.contoso.com",
+			referer:  "https://app1.contoso.com/dashboard",
+			realm:    "ldap",
+			expected: false,
+		},
+		{
+			descr:    "referer host for provider",
+			config:   &HostRestriction{Rules: []*HostRule{{Host: "app1.contoso.com", Realms: []string{"local"}}}, Source: "referer"},
+			host:     "auth.contoso.com",
+			referer:  "https://app1.contoso.com/dashboard",
+			realm:    "google",
+			provider: true,
+			expected: true,
+		},
+		{descr: "host for provider", host: "app1.contoso.com", realm: "google", provider: true, expected: false},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.descr)
+		h := test.config
+		if h == nil {
+			h = &HostRestriction{
+				Rules: []*HostRule{
+					{Host: "*.contoso.com", Realms: []string{"contoso"}},
+					{Host: "app1.contoso.com", Realms: []string{"local"}},
+				},
+			}
+		}
+		if err := h.Configure(); err != nil {
+			t.Fatalf("unexpected configuration error: %s", err)
+		}
+		r := httptest.NewRequest("POST", "/auth", nil)
+		r.Host = test.host
+		if test.referer != "" {
+			r.Header.Set("Referer", test.referer)
+		}
+		var allowed bool
+		if test.provider {
+			allowed = h.AllowProvider(r, test.realm)
+		} else {
+			allowed = h.Allow(r, test.realm)
+		}
+		if allowed != test.expected {
+			t.Logf("FAIL: %s, expected: %t, received: %t", testDescr, test.expected, allowed)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	for _, h := range []*HostRestriction{
+		{Source: "origin"},
+		{Rules: []*HostRule{{Host: "", Realms: []string{"local"}}}},
+		{Rules: []*HostRule{{Host: "app.*.com", Realms: []string{"local"}}}},
+		{Rules: []*HostRule{{Host: "*contoso.com", Realms: []string{"local"}}}},
+		{Rules: []*HostRule{{Host: "app1.contoso.com"}}},
+	} {
+		if err := h.Configure(); err == nil {
+			t.Logf("FAIL: restriction %v, expected error", h)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
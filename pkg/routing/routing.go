@@ -0,0 +1,72 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rule routes the credentials having the username matching the pattern
+// to the authentication realm.
+type Rule struct {
+	// The regular expression matching the username, e.g. `^[^@]+@contoso\.com$`.
+	Pattern string `json:"pattern,omitempty"`
+	// The realm of the backends authenticating the matching credentials.
+	Realm string `json:"realm,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// Router selects the authentication realm based on the format of the
+// submitted username. The rules are evaluated in the order of their
+// definition, and the first matching rule wins.
+type Router struct {
+	Rules []*Rule `json:"rules,omitempty"`
+}
+
+// Configure compiles the patterns of the rules.
+func (r *Router) Configure() error {
+	for _, rule := range r.Rules {
+		if rule.Pattern == "" {
+			return fmt.Errorf("realm routing rule has empty pattern")
+		}
+		if rule.Realm == "" {
+			return fmt.Errorf("realm routing rule %s has empty realm", rule.Pattern)
+		}
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("realm routing rule %s has invalid pattern: %s", rule.Pattern, err)
+		}
+		rule.regex = regex
+	}
+	return nil
+}
+
+// Enabled returns true when the router has rules.
+func (r *Router) Enabled() bool {
+	return len(r.Rules) > 0
+}
+
+// Route returns the realm of the first rule matching the username.
+// When no rule matches, it returns the submitted realm.
+func (r *Router) Route(username, realm string) string {
+	for _, rule := range r.Rules {
+		if rule.regex != nil && rule.regex.MatchString(username) {
+			return rule.Realm
+		}
+	}
+	return realm
+}
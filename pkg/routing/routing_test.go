@@ -0,0 +1,67 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	testFailed := 0
+	router := &Router{
+		Rules: []*Rule{
+			{Pattern: `^[^@\s]+@contoso\.com$`, Realm: "contoso"},
+			{Pattern: `^[^@\s]+@[^@\s]+$`, Realm: "google"},
+			{Pattern: `^CONTOSO\\[^\\]+$`, Realm: "ldap"},
+		},
+	}
+	if err := router.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	tests := []struct {
+		username string
+		realm    string
+		expected string
+	}{
+		{username: "jsmith@contoso.com", realm: "local", expected: "contoso"},
+		{username: "jsmith@gmail.com", realm: "local", expected: "google"},
+		{username: `CONTOSO\jsmith`, realm: "local", expected: "ldap"},
+		{username: "jsmith", realm: "local", expected: "local"},
+		{username: "jsmith", realm: "ldap", expected: "ldap"},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, username: %s, realm: %s", i, test.username, test.realm)
+		realm := router.Route(test.username, test.realm)
+		if realm != test.expected {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, test.expected, realm)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	for _, rule := range []*Rule{{Pattern: "(", Realm: "local"}, {Pattern: "^a", Realm: ""}, {Pattern: "", Realm: "local"}} {
+		router := &Router{Rules: []*Rule{rule}}
+		if err := router.Configure(); err == nil {
+			t.Logf("FAIL: rule %v, expected error", rule)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
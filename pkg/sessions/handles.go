@@ -0,0 +1,106 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+)
+
+// DefaultHandleHeader is the default name of the request header carrying
+// the session handle.
+const DefaultHandleHeader = "X-Session-Handle"
+
+// handleCachePrefix is the prefix of the session cache entries mapping
+// the session handles to the tokens of the sessions.
+const handleCachePrefix = "session_handle:"
+
+// Handles represents a common set of configuration settings for the
+// opaque session handles. The native applications, which do not handle
+// cookies well, receive the handle with the JSON login response and
+// present it in the header of the subsequent requests. The token of the
+// session stays on the server.
+type Handles struct {
+	// The name of the request header carrying the session handle.
+	Header string `json:"header,omitempty"`
+}
+
+// Configure validates the header name and sets default values.
+func (h *Handles) Configure() error {
+	if h.Header == "" {
+		h.Header = DefaultHandleHeader
+	}
+	if strings.ContainsAny(h.Header, " \t\r\n:") {
+		return fmt.Errorf("session handle header name is invalid: %q", h.Header)
+	}
+	h.Header = http.CanonicalHeaderKey(h.Header)
+	return nil
+}
+
+// Enabled returns true when the session handles are configured.
+func (h *Handles) Enabled() bool {
+	return h != nil && h.Header != ""
+}
+
+// GetHandle returns the session handle the request carries, if any.
+func (h *Handles) GetHandle(r *http.Request) string {
+	if !h.Enabled() {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(h.Header))
+}
+
+// Create returns a new session handle mapped to the token of the
+// session. The mapping expires together with the token.
+func (h *Handles) Create(c *cache.SessionCache, sessionID, token string, expiresAt time.Time) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	handle := base64.RawURLEncoding.EncodeToString(b)
+	if err := c.Add(handleCachePrefix+handle, map[string]interface{}{
+		"session_id": sessionID,
+		"token":      token,
+		"expires_at": expiresAt,
+	}); err != nil {
+		return "", err
+	}
+	return handle, nil
+}
+
+// Resolve returns the token of the session the handle maps to. It
+// returns an empty string when the handle is unknown or expired.
+func (h *Handles) Resolve(c *cache.SessionCache, handle string) string {
+	entry := c.Get(handleCachePrefix + handle)
+	if entry == nil {
+		return ""
+	}
+	if expiresAt, ok := entry["expires_at"].(time.Time); ok && time.Now().After(expiresAt) {
+		return ""
+	}
+	token, _ := entry["token"].(string)
+	return token
+}
+
+// Revoke removes the mapping of the handle, e.g. upon logout.
+func (h *Handles) Revoke(c *cache.SessionCache, handle string) {
+	c.Delete(handleCachePrefix + handle)
+}
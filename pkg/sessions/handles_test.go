@@ -0,0 +1,82 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+)
+
+func TestHandles(t *testing.T) {
+	testFailed := 0
+	h := &Handles{Header: "x-app-session"}
+	if err := h.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	c := cache.NewSessionCache()
+	active, err := h.Create(c, "abc", "active.token", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected handle creation error: %s", err)
+	}
+	expired, err := h.Create(c, "def", "expired.token", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected handle creation error: %s", err)
+	}
+	revoked, err := h.Create(c, "ghi", "revoked.token", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected handle creation error: %s", err)
+	}
+	h.Revoke(c, revoked)
+
+	tests := []struct {
+		descr    string
+		handle   string
+		expected string
+	}{
+		{descr: "active handle", handle: active, expected: "active.token"},
+		{descr: "expired handle", handle: expired, expected: ""},
+		{descr: "revoked handle", handle: revoked, expected: ""},
+		{descr: "unknown handle", handle: "foo", expected: ""},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, %s", i, test.descr)
+		r := httptest.NewRequest("GET", "/auth/whoami", nil)
+		r.Header.Set("X-App-Session", test.handle)
+		token := h.Resolve(c, h.GetHandle(r))
+		if token != test.expected {
+			t.Logf("FAIL: %s, expected: %q, received: %q", testDescr, test.expected, token)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if active == revoked || len(active) != 43 {
+		t.Logf("FAIL: handles are not unique random values: %s, %s", active, revoked)
+		testFailed++
+	}
+	if err := (&Handles{Header: "X-Session: Handle"}).Configure(); err == nil {
+		t.Logf("FAIL: invalid header name, expected error")
+		testFailed++
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessions
+
+import (
+	"fmt"
+)
+
+// DefaultMaxImportSize is the default maximum size, in bytes, of the
+// imported sessions payload.
+const DefaultMaxImportSize = 10 << 20
+
+// Transfer represents a common set of configuration settings for the
+// export and import of the cached sessions. The operators export the
+// sessions before a planned restart and import them afterwards, so that
+// the users are not logged out.
+type Transfer struct {
+	// The roles allowed to export and import the sessions, e.g. admin.
+	// The endpoint is disabled when there are no roles.
+	AdminRoles []string `json:"admin_roles,omitempty"`
+	// When enabled, the admins may import the sessions. Otherwise, the
+	// sessions are only exported, e.g. for debugging.
+	Import bool `json:"import,omitempty"`
+	// The maximum size, in bytes, of the imported sessions payload.
+	MaxImportSize int64 `json:"max_import_size,omitempty"`
+}
+
+// Configure validates the configuration.
+func (t *Transfer) Configure() error {
+	for _, role := range t.AdminRoles {
+		if role == "" {
+			return fmt.Errorf("session transfer admin role is empty")
+		}
+	}
+	if t.Import && len(t.AdminRoles) == 0 {
+		return fmt.Errorf("session import requires admin roles")
+	}
+	if t.MaxImportSize < 0 {
+		return fmt.Errorf("session import max size must not be negative")
+	}
+	if t.MaxImportSize == 0 {
+		t.MaxImportSize = DefaultMaxImportSize
+	}
+	return nil
+}
+
+// Enabled returns true when the endpoint has admin roles.
+func (t *Transfer) Enabled() bool {
+	return len(t.AdminRoles) > 0
+}
+
+// IsAdmin returns true when one of the roles is allowed to export and
+// import the sessions.
+func (t *Transfer) IsAdmin(roles []string) bool {
+	for _, role := range roles {
+		for _, adminRole := range t.AdminRoles {
+			if role == adminRole {
+				return true
+			}
+		}
+	}
+	return false
+}
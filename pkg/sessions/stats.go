@@ -0,0 +1,55 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessions
+
+import (
+	"fmt"
+)
+
+// Stats represents a common set of configuration settings for the
+// session cache statistics endpoint.
+type Stats struct {
+	// The roles allowed to view the statistics, e.g. admin. The endpoint
+	// is disabled when there are no roles.
+	AdminRoles []string `json:"admin_roles,omitempty"`
+}
+
+// Configure validates the configuration.
+func (s *Stats) Configure() error {
+	for _, role := range s.AdminRoles {
+		if role == "" {
+			return fmt.Errorf("session stats admin role is empty")
+		}
+	}
+	return nil
+}
+
+// Enabled returns true when the endpoint has admin roles.
+func (s *Stats) Enabled() bool {
+	return len(s.AdminRoles) > 0
+}
+
+// IsAdmin returns true when one of the roles is allowed to view the
+// statistics.
+func (s *Stats) IsAdmin(roles []string) bool {
+	for _, role := range roles {
+		for _, adminRole := range s.AdminRoles {
+			if role == adminRole {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessions
+
+import (
+	"errors"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+	"github.com/greenpau/caddy-auth-portal/pkg/cache"
+)
+
+// ErrTokenTooOld is returned when a token was issued longer than the
+// maximum token age ago.
+var ErrTokenTooOld = errors.New("token exceeded maximum age")
+
+// ErrSessionRevoked is returned when the session of a token was logged
+// out or invalidated by the portal.
+var ErrSessionRevoked = errors.New("session was revoked")
+
+// CheckTokenAge returns ErrTokenTooOld when the token was issued longer
+// than the maximum age, in seconds, ago, regardless of its expiry. The
+// tokens without the issue time fail the check, because their age is
+// unknown. The check is disabled when the maximum age is not positive.
+func CheckTokenAge(claims *jwtclaims.UserClaims, maxAge int, now time.Time) error {
+	if maxAge < 1 {
+		return nil
+	}
+	if claims.IssuedAt < 1 {
+		return ErrTokenTooOld
+	}
+	if now.Unix()-claims.IssuedAt > int64(maxAge) {
+		return ErrTokenTooOld
+	}
+	return nil
+}
+
+// CheckRevoked returns ErrSessionRevoked when the session of the token
+// was logged out or invalidated.
+func CheckRevoked(c *cache.SessionCache, claims *jwtclaims.UserClaims) error {
+	if claims.ID != "" && c.IsRevoked(claims.ID) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+)
+
+// RealmKey is the RSA private key signing the tokens of the users
+// authenticated in a realm, so that the tokens of one realm do not
+// validate with the public key of another one.
+type RealmKey struct {
+	// The realm of the backends, e.g. contoso.
+	Realm string `json:"realm,omitempty"`
+	// The ID of the key, published as the kid of the key and of the
+	// tokens it signs.
+	KeyID string `json:"key_id,omitempty"`
+	// The path to the PEM-encoded RSA private key.
+	KeyFile string `json:"key_file,omitempty"`
+}
+
+// JSONWebKey is the public part of a signing key, see RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// Keyring holds the keys signing the tokens. The realms without a key
+// of their own use the key of the token provider.
+type Keyring struct {
+	method      string
+	defaultKeys []*JSONWebKey
+	providers   map[string]*jwtconfig.CommonTokenConfig
+	validators  []*jwtconfig.CommonTokenConfig
+	realms      map[string]string
+	keys        map[string]*JSONWebKey
+}
+
+// NewKeyring loads the realm keys and returns the keyring. The token
+// providers of the realms copy the settings of the token provider,
+// except for the key. The RSA key of the token provider, if any, is
+// published alongside the realm keys.
+func NewKeyring(tokenProvider *jwtconfig.CommonTokenConfig, defaultKeyID string, defaultKey *rsa.PrivateKey, realmKeys []*RealmKey) (*Keyring, error) {
+	k := &Keyring{
+		method:    "RS512",
+		providers: make(map[string]*jwtconfig.CommonTokenConfig),
+		realms:    make(map[string]string),
+		keys:      make(map[string]*JSONWebKey),
+	}
+	if strings.HasPrefix(tokenProvider.TokenSignMethod, "RS") {
+		k.method = tokenProvider.TokenSignMethod
+	}
+	if defaultKey != nil {
+		k.defaultKeys = append(k.defaultKeys, newJSONWebKey(defaultKeyID, k.method, &defaultKey.PublicKey))
+	}
+	for _, realmKey := range realmKeys {
+		if realmKey.Realm == "" || realmKey.KeyID == "" || realmKey.KeyFile == "" {
+			return nil, fmt.Errorf("realm signing key must have realm, key id, and key file")
+		}
+		if _, exists := k.providers[realmKey.Realm]; exists {
+			return nil, fmt.Errorf("realm %s has multiple signing keys", realmKey.Realm)
+		}
+		if _, exists := k.realms[realmKey.KeyID]; exists || realmKey.KeyID == defaultKeyID {
+			return nil, fmt.Errorf("realm signing key id %s is duplicate", realmKey.KeyID)
+		}
+		content, err := ioutil.ReadFile(realmKey.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("realm %s signing key read failed: %s", realmKey.Realm, err)
+		}
+		privKey, err := jwtlib.ParseRSAPrivateKeyFromPEM(content)
+		if err != nil {
+			return nil, fmt.Errorf("realm %s signing key parse failed: %s", realmKey.Realm, err)
+		}
+
+		provider := jwtconfig.NewCommonTokenConfig()
+		provider.TokenName = tokenProvider.TokenName
+		provider.TokenOrigin = tokenProvider.TokenOrigin
+		provider.TokenLifetime = tokenProvider.TokenLifetime
+		provider.TokenSignMethod = k.method
+		provider.AddTokenKey(realmKey.KeyID, privKey)
+		k.providers[realmKey.Realm] = provider
+
+		validator := jwtconfig.NewCommonTokenConfig()
+		validator.TokenName = tokenProvider.TokenName
+		if err := validator.AddRSAPublicKey(realmKey.KeyID, &privKey.PublicKey); err != nil {
+			return nil, fmt.Errorf("realm %s signing key setup failed: %s", realmKey.Realm, err)
+		}
+		k.validators = append(k.validators, validator)
+
+		k.realms[realmKey.KeyID] = realmKey.Realm
+		k.keys[realmKey.Realm] = newJSONWebKey(realmKey.KeyID, k.method, &privKey.PublicKey)
+	}
+	return k, nil
+}
+
+// Enabled returns true when any of the realms has a key of its own.
+func (k *Keyring) Enabled() bool {
+	if k == nil {
+		return false
+	}
+	return len(k.providers) > 0
+}
+
+// GetTokenProvider returns the token provider signing the tokens of the
+// realm. It returns nil when the realm has no key of its own.
+func (k *Keyring) GetTokenProvider(realm string) *jwtconfig.CommonTokenConfig {
+	if !k.Enabled() {
+		return nil
+	}
+	return k.providers[realm]
+}
+
+// GetValidatorConfigs returns the configurations of the token validator
+// holding the public keys of the realms.
+func (k *Keyring) GetValidatorConfigs() []*jwtconfig.CommonTokenConfig {
+	if !k.Enabled() {
+		return nil
+	}
+	return k.validators
+}
+
+// HasRealm returns true when the realm has a key of its own.
+func (k *Keyring) HasRealm(realm string) bool {
+	return k.GetTokenProvider(realm) != nil
+}
+
+// GetTokenRealm returns the realm whose key signed the token, based on
+// the kid of the token. The signature of the token must be verified
+// beforehand.
+func (k *Keyring) GetTokenRealm(token string) (string, bool) {
+	if !k.Enabled() {
+		return "", false
+	}
+	parsed, _, err := new(jwtlib.Parser).ParseUnverified(token, jwtlib.MapClaims{})
+	if err != nil {
+		return "", false
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	realm, exists := k.realms[kid]
+	return realm, exists
+}
+
+// GetKeySet returns the public keys of the realm. When the realm is
+// empty, it returns the public keys of all the realms.
+func (k *Keyring) GetKeySet(realm string) map[string]interface{} {
+	keys := []*JSONWebKey{}
+	switch {
+	case realm != "":
+		if key, exists := k.keys[realm]; exists {
+			keys = append(keys, key)
+		}
+	default:
+		keys = append(keys, k.defaultKeys...)
+		for _, key := range k.keys {
+			keys = append(keys, key)
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func newJSONWebKey(keyID, method string, key *rsa.PublicKey) *JSONWebKey {
+	return &JSONWebKey{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: method,
+		KeyID:     keyID,
+		Modulus:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jwtlib "github.com/dgrijalva/jwt-go"
+	jwtconfig "github.com/greenpau/caddy-auth-jwt/pkg/config"
+)
+
+func writeTestKey(t *testing.T, dir, name string) (string, *rsa.PrivateKey) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed generating RSA key: %s", err)
+	}
+	fp := filepath.Join(dir, name)
+	b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privKey)})
+	if err := ioutil.WriteFile(fp, b, 0600); err != nil {
+		t.Fatalf("failed writing RSA key: %s", err)
+	}
+	return fp, privKey
+}
+
+func TestKeyring(t *testing.T) {
+	testFailed := 0
+	dir, err := ioutil.TempDir("", "signing")
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	contosoFile, contosoKey := writeTestKey(t, dir, "contoso.pem")
+	localFile, _ := writeTestKey(t, dir, "local.pem")
+	_, defaultKey := writeTestKey(t, dir, "default.pem")
+
+	tokenProvider := jwtconfig.NewCommonTokenConfig()
+	tokenProvider.TokenName = "access_token"
+	tokenProvider.TokenSignMethod = "RS256"
+
+	tests := []struct {
+		keys       []*RealmKey
+		shouldFail bool
+	}{
+		{keys: []*RealmKey{{Realm: "contoso.com", KeyID: "c1", KeyFile: contosoFile}, {Realm: "local", KeyID: "l1", KeyFile: localFile}}},
+		{keys: []*RealmKey{{Realm: "contoso.com", KeyID: "c1"}}, shouldFail: true},
+		{keys: []*RealmKey{{Realm: "contoso.com", KeyID: "c1", KeyFile: contosoFile}, {Realm: "contoso.com", KeyID: "c2", KeyFile: localFile}}, shouldFail: true},
+		{keys: []*RealmKey{{Realm: "contoso.com", KeyID: "c1", KeyFile: contosoFile}, {Realm: "local", KeyID: "c1", KeyFile: localFile}}, shouldFail: true},
+		{keys: []*RealmKey{{Realm: "contoso.com", KeyID: "0", KeyFile: contosoFile}}, shouldFail: true},
+		{keys: []*RealmKey{{Realm: "contoso.com", KeyID: "c1", KeyFile: filepath.Join(dir, "missing.pem")}}, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, keys: %d", i, len(test.keys))
+		_, err := NewKeyring(tokenProvider, "0", defaultKey, test.keys)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	keyring, err := NewKeyring(tokenProvider, "0", defaultKey, tests[0].keys)
+	if err != nil {
+		t.Fatalf("failed creating keyring: %s", err)
+	}
+	if !keyring.Enabled() || !keyring.HasRealm("local") || keyring.HasRealm("example.com") {
+		t.Fatalf("unexpected realms of the keyring")
+	}
+	if n := len(keyring.GetValidatorConfigs()); n != 2 {
+		t.Fatalf("unexpected number of validator configs: %d", n)
+	}
+
+	provider := keyring.GetTokenProvider("contoso.com")
+	privKey, kid, err := provider.GetPrivateKey()
+	if err != nil || kid != "c1" || provider.TokenSignMethod != "RS256" || provider.TokenName != "access_token" {
+		t.Fatalf("unexpected token provider of contoso.com: kid %s, method %s, error %v", kid, provider.TokenSignMethod, err)
+	}
+	token := jwtlib.NewWithClaims(jwtlib.SigningMethodRS256, jwtlib.MapClaims{"sub": "jsmith"})
+	token.Header["kid"] = kid
+	signedToken, err := token.SignedString(privKey)
+	if err != nil {
+		t.Fatalf("failed signing token: %s", err)
+	}
+	if realm, found := keyring.GetTokenRealm(signedToken); !found || realm != "contoso.com" {
+		t.Fatalf("unexpected realm of the token: %s", realm)
+	}
+	if _, found := keyring.GetTokenRealm("foobar"); found {
+		t.Fatalf("unexpected realm of malformed token")
+	}
+
+	for realm, expected := range map[string]int{"": 3, "contoso.com": 1, "example.com": 0} {
+		keys := keyring.GetKeySet(realm)["keys"].([]*JSONWebKey)
+		if len(keys) != expected {
+			t.Logf("FAIL: key set of realm %q has %d keys, expected %d", realm, len(keys), expected)
+			testFailed++
+		}
+	}
+	key := keyring.GetKeySet("contoso.com")["keys"].([]*JSONWebKey)[0]
+	if key.KeyID != "c1" || key.Algorithm != "RS256" || key.Exponent != "AQAB" ||
+		key.Modulus != base64.RawURLEncoding.EncodeToString(contosoKey.N.Bytes()) {
+		t.Fatalf("unexpected key of contoso.com: %+v", key)
+	}
+
+	var noKeyring *Keyring
+	if noKeyring.Enabled() || noKeyring.GetTokenProvider("local") != nil {
+		t.Fatalf("nil keyring must be disabled")
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	otlpBufferSize    = 1024
+	otlpBatchSize     = 100
+	otlpFlushInterval = 5 * time.Second
+)
+
+type exporter interface {
+	export(*Span)
+	close()
+}
+
+// logExporter writes the spans to the log.
+type logExporter struct {
+	logger *zap.Logger
+}
+
+func (e *logExporter) export(s *Span) {
+	fields := []zap.Field{
+		zap.String("trace_id", s.TraceID),
+		zap.String("span_id", s.SpanID),
+		zap.String("parent_span_id", s.ParentID),
+		zap.String("span_name", s.Name),
+		zap.Duration("duration", s.EndTime.Sub(s.StartTime)),
+		zap.Bool("failed", s.Failed),
+	}
+	if len(s.Attributes) > 0 {
+		fields = append(fields, zap.Any("attributes", s.Attributes))
+	}
+	e.logger.Info("Trace span", fields...)
+}
+
+func (e *logExporter) close() {}
+
+// otlpExporter sends the spans in batches to the OTLP/HTTP endpoint of a
+// collector, using the JSON encoding. The spans arriving while the buffer
+// is full are dropped.
+type otlpExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	logger      *zap.Logger
+	spans       chan *Span
+	done        chan struct{}
+	once        sync.Once
+	mu          sync.Mutex
+	dropped     int
+}
+
+func newOTLPExporter(endpoint, serviceName string, timeout time.Duration, logger *zap.Logger) *otlpExporter {
+	e := &otlpExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: timeout},
+		logger:      logger,
+		spans:       make(chan *Span, otlpBufferSize),
+		done:        make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *otlpExporter) export(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+func (e *otlpExporter) close() {
+	e.once.Do(func() {
+		close(e.spans)
+		<-e.done
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.dropped > 0 {
+			e.logger.Warn("Dropped trace spans due to the full buffer",
+				zap.Int("dropped", e.dropped),
+			)
+		}
+	})
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case s, ok := <-e.spans:
+			if !ok {
+				e.send(batch)
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= otlpBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		}
+	}
+}
+
+func (e *otlpExporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	payload, err := json.Marshal(newOTLPRequest(e.serviceName, batch))
+	if err != nil {
+		e.logger.Warn("Failed encoding trace spans", zap.String("error", err.Error()))
+		return
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		e.logger.Warn("Failed exporting trace spans",
+			zap.String("endpoint", e.endpoint),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e.logger.Warn("Failed exporting trace spans",
+			zap.String("endpoint", e.endpoint),
+			zap.String("error", fmt.Sprintf("unexpected status code %d", resp.StatusCode)),
+		)
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   *otlpResource     `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []*otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope *otlpScope  `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string           `json:"traceId"`
+	SpanID            string           `json:"spanId"`
+	ParentSpanID      string           `json:"parentSpanId,omitempty"`
+	Name              string           `json:"name"`
+	Kind              int              `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []*otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus      `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func newOTLPRequest(serviceName string, batch []*Span) *otlpRequest {
+	scopeSpans := &otlpScopeSpans{Scope: &otlpScope{Name: DefaultServiceName}}
+	for _, s := range batch {
+		span := &otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        newOTLPAttributes(s.Attributes),
+		}
+		if s.Failed {
+			// The status code of errors.
+			span.Status = &otlpStatus{Code: 2}
+		}
+		scopeSpans.Spans = append(scopeSpans.Spans, span)
+	}
+	return &otlpRequest{
+		ResourceSpans: []*otlpResourceSpans{
+			{
+				Resource: &otlpResource{
+					Attributes: newOTLPAttributes(map[string]interface{}{"service.name": serviceName}),
+				},
+				ScopeSpans: []*otlpScopeSpans{scopeSpans},
+			},
+		},
+	}
+}
+
+func newOTLPAttributes(m map[string]interface{}) []*otlpAttribute {
+	var attrs []*otlpAttribute
+	for k, v := range m {
+		attr := &otlpAttribute{Key: k}
+		switch v := v.(type) {
+		case bool:
+			attr.Value = map[string]interface{}{"boolValue": v}
+		case int:
+			attr.Value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		default:
+			attr.Value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
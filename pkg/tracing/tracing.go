@@ -0,0 +1,281 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultServiceName is the default name of the service the spans are
+	// attributed to.
+	DefaultServiceName = "caddy-auth-portal"
+	// DefaultTimeout is the default number of milliseconds the portal
+	// waits for the collector to accept the spans.
+	DefaultTimeout = 3000
+)
+
+// Span kinds, as defined by OpenTelemetry.
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+	SpanKindClient   = 3
+)
+
+// Tracing represents a common set of configuration settings for the
+// tracing of the requests to the portal and of the authentication
+// requests to the backends. The trace context of the incoming requests
+// propagates via the W3C traceparent header.
+type Tracing struct {
+	// The destination of the spans, i.e. log or otlp. The tracing is
+	// disabled when there is no exporter.
+	Exporter string `json:"exporter,omitempty"`
+	// The URL of the OTLP/HTTP traces endpoint of the collector, e.g.
+	// http://localhost:4318/v1/traces. It applies to the otlp exporter.
+	Endpoint string `json:"endpoint,omitempty"`
+	// The name of the service the spans are attributed to.
+	ServiceName string `json:"service_name,omitempty"`
+	// The names of the backends whose authentication requests are traced.
+	// With no backends, the requests to all the backends are traced.
+	Backends []string `json:"backends,omitempty"`
+	// The number of milliseconds the portal waits for the collector.
+	Timeout int `json:"timeout,omitempty"`
+
+	exporter exporter
+	backends map[string]bool
+}
+
+// Configure validates the configuration and starts the exporter.
+func (t *Tracing) Configure(logger *zap.Logger) error {
+	if !t.Enabled() {
+		return nil
+	}
+	if t.ServiceName == "" {
+		t.ServiceName = DefaultServiceName
+	}
+	if t.Timeout < 1 {
+		t.Timeout = DefaultTimeout
+	}
+	if len(t.Backends) > 0 {
+		t.backends = make(map[string]bool)
+		for _, name := range t.Backends {
+			if name == "" {
+				return fmt.Errorf("tracing backend name is empty")
+			}
+			t.backends[name] = true
+		}
+	}
+	switch t.Exporter {
+	case "log":
+		if t.Endpoint != "" {
+			return fmt.Errorf("tracing log exporter does not support endpoints")
+		}
+		t.exporter = &logExporter{logger: logger}
+	case "otlp":
+		if t.Endpoint == "" {
+			return fmt.Errorf("tracing otlp exporter has no endpoint")
+		}
+		u, err := url.Parse(t.Endpoint)
+		if err != nil {
+			return fmt.Errorf("tracing endpoint is invalid: %s", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("tracing endpoint scheme is unsupported: %s", u.Scheme)
+		}
+		t.exporter = newOTLPExporter(t.Endpoint, t.ServiceName, time.Duration(t.Timeout)*time.Millisecond, logger)
+	default:
+		return fmt.Errorf("tracing exporter is unsupported: %s", t.Exporter)
+	}
+	return nil
+}
+
+// Enabled returns true when the tracing has an exporter.
+func (t *Tracing) Enabled() bool {
+	return t != nil && t.Exporter != ""
+}
+
+// TracesBackend returns true when the authentication requests to the
+// backend are traced.
+func (t *Tracing) TracesBackend(name string) bool {
+	if !t.Enabled() {
+		return false
+	}
+	return t.backends == nil || t.backends[name]
+}
+
+// StartRequest returns the span of the request. The span continues the
+// trace of the traceparent header of the request, if any. It returns nil
+// when the tracing is disabled.
+func (t *Tracing) StartRequest(r *http.Request, name string) *Span {
+	if !t.Enabled() || t.exporter == nil {
+		return nil
+	}
+	span := &Span{
+		tracing:    t,
+		Name:       name,
+		Kind:       SpanKindServer,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+		SpanID:     newID(8),
+	}
+	if traceID, parentID, ok := ParseTraceParent(r.Header.Get("traceparent")); ok {
+		span.TraceID = traceID
+		span.ParentID = parentID
+	} else {
+		span.TraceID = newID(16)
+	}
+	return span
+}
+
+// Close flushes the spans pending export and stops the exporter.
+func (t *Tracing) Close() {
+	if !t.Enabled() || t.exporter == nil {
+		return
+	}
+	t.exporter.close()
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Kind       int
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]interface{}
+	// The switch determining whether the operation failed.
+	Failed bool
+
+	tracing *Tracing
+	mu      sync.Mutex
+	ended   bool
+}
+
+// StartChild returns the span of an operation within the span. It returns
+// nil when the span is nil.
+func (s *Span) StartChild(name string, kind int) *Span {
+	if s == nil {
+		return nil
+	}
+	return &Span{
+		tracing:    s.tracing,
+		TraceID:    s.TraceID,
+		SpanID:     newID(8),
+		ParentID:   s.SpanID,
+		Name:       name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+}
+
+// SetAttribute annotates the span. The values must be strings, booleans,
+// or integers.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// SetFailed marks the operation failed.
+func (s *Span) SetFailed() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Failed = true
+}
+
+// End records the end time of the span and exports it. The subsequent
+// calls have no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+	s.tracing.exporter.export(s)
+}
+
+// TraceParent returns the W3C traceparent header value of the span.
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+// ParseTraceParent returns the trace ID and the parent span ID of the W3C
+// traceparent header value, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func ParseTraceParent(s string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return "", "", false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", false
+	}
+	if !isHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return "", "", false
+	}
+	if !isHex(parentID, 16) || parentID == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	if !isHex(flags, 2) {
+		return "", "", false
+	}
+	return traceID, parentID, true
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
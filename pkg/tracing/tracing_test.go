@@ -0,0 +1,144 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/greenpau/caddy-auth-portal/pkg/utils"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		header   string
+		traceID  string
+		parentID string
+		valid    bool
+	}{
+		{
+			header:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			traceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			parentID: "00f067aa0ba902b7",
+			valid:    true,
+		},
+		{
+			header:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			traceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			parentID: "00f067aa0ba902b7",
+			valid:    true,
+		},
+		{header: ""},
+		{header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01"},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, header: %s", i, test.header)
+		traceID, parentID, valid := ParseTraceParent(test.header)
+		if valid != test.valid || traceID != test.traceID || parentID != test.parentID {
+			t.Logf("FAIL: %s, expected: %s %s %t, received: %s %s %t", testDescr,
+				test.traceID, test.parentID, test.valid, traceID, parentID, valid)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	var cfg *Tracing
+	r := httptest.NewRequest("GET", "/auth", nil)
+	span := cfg.StartRequest(r, "auth_portal GET")
+	if span != nil {
+		t.Fatalf("expected no span when tracing is disabled")
+	}
+	child := span.StartChild("authenticate local", SpanKindClient)
+	child.SetAttribute("auth.realm", "local")
+	child.End()
+	span.End()
+	cfg.Close()
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*otlpRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &otlpRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := &Tracing{
+		Exporter: "otlp",
+		Endpoint: srv.URL + "/v1/traces",
+		Backends: []string{"local_backend"},
+	}
+	if err := cfg.Configure(utils.NewLogger()); err != nil {
+		t.Fatalf("failed configuring tracing: %s", err)
+	}
+	if !cfg.TracesBackend("local_backend") || cfg.TracesBackend("ldap_backend") {
+		t.Fatalf("unexpected traced backends")
+	}
+
+	r := httptest.NewRequest("POST", "/auth/login", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := cfg.StartRequest(r, "auth_portal POST")
+	child := span.StartChild("authenticate local", SpanKindClient)
+	child.SetAttribute("auth.realm", "local")
+	child.SetFailed()
+	child.End()
+	span.End()
+	cfg.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 export request, got %d", len(requests))
+	}
+	spans := requests[0].ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || spans[1].TraceID != spans[0].TraceID {
+		t.Fatalf("unexpected trace ids: %s, %s", spans[0].TraceID, spans[1].TraceID)
+	}
+	if spans[1].ParentSpanID != "00f067aa0ba902b7" || spans[0].ParentSpanID != spans[1].SpanID {
+		t.Fatalf("unexpected parent span ids: %s, %s", spans[0].ParentSpanID, spans[1].ParentSpanID)
+	}
+	if spans[0].Status == nil || spans[0].Status.Code != 2 || spans[1].Status != nil {
+		t.Fatalf("unexpected span status")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"fmt"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// DefaultPrimaryRoleClaim is the default name of the primary role claim.
+const DefaultPrimaryRoleClaim = "primary_role"
+
+// PrimaryRole designates one of the roles of a user as the primary role
+// and adds it to the token as a dedicated claim.
+type PrimaryRole struct {
+	// The name of the claim, e.g. primary_role.
+	Claim string `json:"claim,omitempty"`
+	// The roles in the order of precedence. The first role the user has
+	// becomes the primary role.
+	Precedence []string `json:"precedence,omitempty"`
+	// The primary role of the users having none of the roles.
+	Default string `json:"default,omitempty"`
+}
+
+// Validate validates primary role configuration.
+func (p *PrimaryRole) Validate() error {
+	if p.Claim == "" {
+		p.Claim = DefaultPrimaryRoleClaim
+	}
+	if protectedClaims[p.Claim] {
+		return fmt.Errorf("primary role claim %s is not allowed", p.Claim)
+	}
+	switch p.Claim {
+	case "name", "email", "origin", "roles", "scopes", "org":
+		return fmt.Errorf("primary role claim %s is not allowed", p.Claim)
+	}
+	if len(p.Precedence) == 0 && p.Default == "" {
+		return fmt.Errorf("primary role has neither precedence nor default")
+	}
+	return nil
+}
+
+// Get returns the primary role of a user. It returns an empty string when
+// the user has none of the roles and there is no default.
+func (p *PrimaryRole) Get(claims *jwtclaims.UserClaims) string {
+	for _, role := range p.Precedence {
+		for _, userRole := range claims.Roles {
+			if userRole == role {
+				return role
+			}
+		}
+	}
+	return p.Default
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"fmt"
+	"strings"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// ScopeClaim is the name of the space-delimited scope claim, see RFC 8693,
+// section 4.2.
+const ScopeClaim = "scope"
+
+// ScopeMapping maps the roles of a user to OAuth 2.0 scopes, so that the
+// resource servers authorizing requests by scopes accept the tokens.
+type ScopeMapping struct {
+	// The scopes granted to the users having a role, keyed by the role.
+	Roles map[string][]string `json:"roles,omitempty"`
+	// The scopes granted to all the users of a realm, keyed by the realm.
+	Realms map[string][]string `json:"realms,omitempty"`
+}
+
+// Validate validates scope mapping configuration.
+func (m *ScopeMapping) Validate() error {
+	if len(m.Roles) == 0 && len(m.Realms) == 0 {
+		return fmt.Errorf("scope mapping has neither roles nor realms")
+	}
+	for _, mapping := range []map[string][]string{m.Roles, m.Realms} {
+		for k, scopes := range mapping {
+			if len(scopes) == 0 {
+				return fmt.Errorf("scope mapping for %s has no scopes", k)
+			}
+			for _, scope := range scopes {
+				if !isValidScope(scope) {
+					return fmt.Errorf("scope mapping for %s has invalid scope %q", k, scope)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the scopes of a user authenticated in the realm. They
+// include the scopes the user already has, followed by the scopes of the
+// roles of the user, and then the static scopes of the realm.
+func (m *ScopeMapping) Get(realm string, claims *jwtclaims.UserClaims) []string {
+	var scopes []string
+	scopes = appendValues(scopes, strings.Join(claims.Scopes, " "))
+	for _, role := range claims.Roles {
+		scopes = appendValues(scopes, strings.Join(m.Roles[role], " "))
+	}
+	scopes = appendValues(scopes, strings.Join(m.Realms[realm], " "))
+	return scopes
+}
+
+// isValidScope returns true when the scope is a valid scope token, see
+// RFC 6749, section 3.3.
+func isValidScope(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
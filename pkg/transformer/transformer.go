@@ -0,0 +1,214 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+var templateFuncs = template.FuncMap{
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"title":     strings.Title,
+	"trim":      strings.TrimSpace,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"replace":   strings.ReplaceAll,
+	"split":     strings.Split,
+	"join":      strings.Join,
+}
+
+// protectedClaims are the claims the templates must not change.
+var protectedClaims = map[string]bool{
+	"aud":  true,
+	"exp":  true,
+	"jti":  true,
+	"iat":  true,
+	"iss":  true,
+	"nbf":  true,
+	"sub":  true,
+	"acl":  true,
+	"addr": true,
+}
+
+// ClaimTemplate is a Go template computing the value of a claim.
+type ClaimTemplate struct {
+	// The name of the claim, e.g. name, email, roles, or a custom claim.
+	Claim string `json:"claim,omitempty"`
+	// The Go template, e.g. {{ .given_name }} {{ .family_name }}.
+	Template string `json:"template,omitempty"`
+	tmpl     *template.Template
+}
+
+// Transformer transforms user claims via Go templates before the
+// claims are signed.
+type Transformer struct {
+	Templates   []*ClaimTemplate `json:"templates,omitempty"`
+	PrimaryRole *PrimaryRole     `json:"primary_role,omitempty"`
+	Scopes      *ScopeMapping    `json:"scopes,omitempty"`
+}
+
+// Validate parses the templates.
+func (t *Transformer) Validate() error {
+	for _, ct := range t.Templates {
+		if ct.Claim == "" {
+			return fmt.Errorf("claim template has no claim name")
+		}
+		if protectedClaims[ct.Claim] {
+			return fmt.Errorf("claim template for %s claim is not allowed", ct.Claim)
+		}
+		tmpl, err := template.New(ct.Claim).Funcs(templateFuncs).Parse(ct.Template)
+		if err != nil {
+			return fmt.Errorf("claim template for %s claim is invalid: %s", ct.Claim, err)
+		}
+		ct.tmpl = tmpl
+	}
+	if t.PrimaryRole != nil {
+		if err := t.PrimaryRole.Validate(); err != nil {
+			return err
+		}
+	}
+	if t.Scopes != nil {
+		if err := t.Scopes.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transform evaluates the templates with the user and custom claims as
+// template context. The name, email, and origin claims are replaced, the
+// roles, scopes, and org claims are extended with the space-separated
+// values, and the remaining claims are added to custom claims. A template
+// producing an empty string does not change the claims. The returned
+// custom claims include the transformed ones. The errors of the
+// individual templates are returned after all templates were evaluated.
+// The primary role, if configured, is computed from the transformed roles.
+func (t *Transformer) Transform(claims *jwtclaims.UserClaims, customClaims map[string]interface{}) (map[string]interface{}, []error) {
+	var errors []error
+	if len(t.Templates) == 0 && t.PrimaryRole == nil {
+		return customClaims, nil
+	}
+	for _, ct := range t.Templates {
+		if ct.tmpl == nil {
+			errors = append(errors, fmt.Errorf("claim template for %s claim is not validated", ct.Claim))
+			continue
+		}
+		data, err := claimsToMap(claims)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("claim template for %s claim failed: %s", ct.Claim, err))
+			continue
+		}
+		for k, v := range customClaims {
+			if _, exists := data[k]; !exists {
+				data[k] = v
+			}
+		}
+		var buf bytes.Buffer
+		if err := ct.tmpl.Execute(&buf, data); err != nil {
+			errors = append(errors, fmt.Errorf("claim template for %s claim failed: %s", ct.Claim, err))
+			continue
+		}
+		// The missing claims render as "<no value>".
+		v := strings.TrimSpace(strings.ReplaceAll(buf.String(), "<no value>", ""))
+		if v == "" {
+			continue
+		}
+		switch ct.Claim {
+		case "name":
+			claims.Name = v
+		case "email":
+			claims.Email = v
+		case "origin":
+			claims.Origin = v
+		case "roles":
+			claims.Roles = appendValues(claims.Roles, v)
+		case "scopes":
+			claims.Scopes = appendValues(claims.Scopes, v)
+		case "org":
+			claims.Organizations = appendValues(claims.Organizations, v)
+		default:
+			if customClaims == nil {
+				customClaims = make(map[string]interface{})
+			}
+			customClaims[ct.Claim] = v
+		}
+	}
+	if t.PrimaryRole != nil {
+		if role := t.PrimaryRole.Get(claims); role != "" {
+			if customClaims == nil {
+				customClaims = make(map[string]interface{})
+			}
+			customClaims[t.PrimaryRole.Claim] = role
+		}
+	}
+	return customClaims, errors
+}
+
+// MapScopes adds the scopes of the user, including the ones mapped from
+// the roles of the user and the static scopes of the realm, to the custom
+// claims as the space-delimited scope claim. The scopes move from the
+// scopes claim to the scope claim, so that the token carries them once.
+func (t *Transformer) MapScopes(realm string, claims *jwtclaims.UserClaims, customClaims map[string]interface{}) map[string]interface{} {
+	if t.Scopes == nil {
+		return customClaims
+	}
+	scopes := t.Scopes.Get(realm, claims)
+	if len(scopes) == 0 {
+		return customClaims
+	}
+	if customClaims == nil {
+		customClaims = make(map[string]interface{})
+	}
+	customClaims[ScopeClaim] = strings.Join(scopes, " ")
+	claims.Scopes = nil
+	return customClaims
+}
+
+// claimsToMap returns the claims keyed by their JWT names, e.g. email.
+func claimsToMap(claims *jwtclaims.UserClaims) (map[string]interface{}, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func appendValues(values []string, s string) []string {
+	for _, v := range strings.Fields(s) {
+		found := false
+		for _, existing := range values {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, v)
+		}
+	}
+	return values
+}
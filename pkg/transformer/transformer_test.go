@@ -0,0 +1,283 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestTransform(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		templates          []*ClaimTemplate
+		customClaims       map[string]interface{}
+		shouldFailValidate bool
+		shouldFailExecute  bool
+		name               string
+		roles              []string
+		expectedCustom     map[string]interface{}
+	}{
+		{
+			templates: []*ClaimTemplate{
+				{Claim: "name", Template: `{{ .given_name }} {{ .family_name }}`},
+			},
+			customClaims: map[string]interface{}{
+				"given_name":  "John",
+				"family_name": "Smith",
+			},
+			name:  "John Smith",
+			roles: []string{"viewer"},
+			expectedCustom: map[string]interface{}{
+				"given_name":  "John",
+				"family_name": "Smith",
+			},
+		},
+		{
+			templates: []*ClaimTemplate{
+				{Claim: "name", Template: `{{ .given_name }}`},
+			},
+			name:  "jsmith",
+			roles: []string{"viewer"},
+		},
+		{
+			templates: []*ClaimTemplate{
+				{Claim: "roles", Template: `{{ if hasSuffix .email "@contoso.com" }}employee viewer{{ end }}`},
+				{Claim: "department", Template: `{{ index (split .email "@") 1 | upper }}`},
+			},
+			name:  "jsmith",
+			roles: []string{"viewer", "employee"},
+			expectedCustom: map[string]interface{}{
+				"department": "CONTOSO.COM",
+			},
+		},
+		{
+			templates: []*ClaimTemplate{
+				{Claim: "department", Template: `{{ index .roles 5 }}`},
+			},
+			shouldFailExecute: true,
+			name:              "jsmith",
+			roles:             []string{"viewer"},
+		},
+		{
+			templates: []*ClaimTemplate{
+				{Claim: "sub", Template: `admin`},
+			},
+			shouldFailValidate: true,
+		},
+		{
+			templates: []*ClaimTemplate{
+				{Claim: "name", Template: `{{ .email `},
+			},
+			shouldFailValidate: true,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, templates: %d", i, len(test.templates))
+		tr := &Transformer{Templates: test.templates}
+		if err := tr.Validate(); err != nil {
+			if !test.shouldFailValidate {
+				t.Logf("FAIL: %s, unexpected validation error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, expected validation error: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFailValidate {
+			t.Logf("FAIL: %s, expected validation error, but succeeded", testDescr)
+			testFailed++
+			continue
+		}
+		claims := &jwtclaims.UserClaims{
+			Subject: "jsmith",
+			Name:    "jsmith",
+			Email:   "jsmith@contoso.com",
+			Roles:   []string{"viewer"},
+		}
+		customClaims, errors := tr.Transform(claims, test.customClaims)
+		if (len(errors) > 0) != test.shouldFailExecute {
+			t.Logf("FAIL: %s, execution errors: %v", testDescr, errors)
+			testFailed++
+			continue
+		}
+		if claims.Name != test.name {
+			t.Logf("FAIL: %s, name: %s (expected) vs. %s (received)", testDescr, test.name, claims.Name)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(claims.Roles, test.roles) {
+			t.Logf("FAIL: %s, roles: %v (expected) vs. %v (received)", testDescr, test.roles, claims.Roles)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(customClaims, test.expectedCustom) {
+			t.Logf("FAIL: %s, custom claims: %v (expected) vs. %v (received)", testDescr, test.expectedCustom, customClaims)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestPrimaryRole(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		primaryRole        *PrimaryRole
+		templates          []*ClaimTemplate
+		roles              []string
+		shouldFailValidate bool
+		expectedCustom     map[string]interface{}
+	}{
+		{
+			primaryRole:    &PrimaryRole{Precedence: []string{"admin", "editor", "viewer"}},
+			roles:          []string{"viewer", "editor"},
+			expectedCustom: map[string]interface{}{"primary_role": "editor"},
+		},
+		{
+			primaryRole: &PrimaryRole{Precedence: []string{"admin", "editor"}},
+			roles:       []string{"viewer"},
+		},
+		{
+			primaryRole:    &PrimaryRole{Claim: "primary_group", Precedence: []string{"admin"}, Default: "guest"},
+			roles:          []string{"viewer"},
+			expectedCustom: map[string]interface{}{"primary_group": "guest"},
+		},
+		{
+			primaryRole: &PrimaryRole{Precedence: []string{"employee", "viewer"}},
+			templates: []*ClaimTemplate{
+				{Claim: "roles", Template: `employee`},
+			},
+			roles:          []string{"viewer"},
+			expectedCustom: map[string]interface{}{"primary_role": "employee"},
+		},
+		{
+			primaryRole:        &PrimaryRole{Claim: "roles", Default: "guest"},
+			shouldFailValidate: true,
+		},
+		{
+			primaryRole:        &PrimaryRole{},
+			shouldFailValidate: true,
+		},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, primary role: %v, roles: %v", i, test.primaryRole, test.roles)
+		tr := &Transformer{Templates: test.templates, PrimaryRole: test.primaryRole}
+		if err := tr.Validate(); err != nil {
+			if !test.shouldFailValidate {
+				t.Logf("FAIL: %s, unexpected validation error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, validation failed as expected: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFailValidate {
+			t.Logf("FAIL: %s, expected validation error", testDescr)
+			testFailed++
+			continue
+		}
+		claims := &jwtclaims.UserClaims{Subject: "jsmith", Roles: test.roles}
+		customClaims, errors := tr.Transform(claims, nil)
+		if len(errors) > 0 {
+			t.Logf("FAIL: %s, unexpected errors: %v", testDescr, errors)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(customClaims, test.expectedCustom) {
+			t.Logf("FAIL: %s, custom claims mismatch: %v (expected) vs. %v (received)", testDescr, test.expectedCustom, customClaims)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestMapScopes(t *testing.T) {
+	testFailed := 0
+	mapping := &ScopeMapping{
+		Roles: map[string][]string{
+			"admin":  {"orders:read", "orders:write", "users:admin"},
+			"viewer": {"orders:read"},
+		},
+		Realms: map[string][]string{
+			"contoso.com": {"profile:read"},
+		},
+	}
+	tests := []struct {
+		mapping            *ScopeMapping
+		realm              string
+		roles              []string
+		scopes             []string
+		expectedScope      interface{}
+		shouldFailValidate bool
+	}{
+		{mapping: mapping, realm: "local", roles: []string{"guest"}},
+		{mapping: mapping, realm: "local", roles: []string{"viewer"}, expectedScope: "orders:read"},
+		{mapping: mapping, realm: "contoso.com", roles: []string{"viewer", "admin"}, expectedScope: "orders:read orders:write users:admin profile:read"},
+		{mapping: mapping, realm: "contoso.com", roles: []string{"guest"}, scopes: []string{"email", "orders:read"}, expectedScope: "email orders:read profile:read"},
+		{mapping: &ScopeMapping{}, shouldFailValidate: true},
+		{mapping: &ScopeMapping{Roles: map[string][]string{"admin": {}}}, shouldFailValidate: true},
+		{mapping: &ScopeMapping{Roles: map[string][]string{"admin": {"orders read"}}}, shouldFailValidate: true},
+		{mapping: &ScopeMapping{Realms: map[string][]string{"local": {`orders"read`}}}, shouldFailValidate: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, realm: %s, roles: %v, scopes: %v", i, test.realm, test.roles, test.scopes)
+		tr := &Transformer{Scopes: test.mapping}
+		if err := tr.Validate(); err != nil {
+			if !test.shouldFailValidate {
+				t.Logf("FAIL: %s, unexpected validation error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s, validation failed as expected: %s", testDescr, err)
+			continue
+		}
+		if test.shouldFailValidate {
+			t.Logf("FAIL: %s, expected validation error", testDescr)
+			testFailed++
+			continue
+		}
+		claims := &jwtclaims.UserClaims{Subject: "jsmith", Roles: test.roles, Scopes: test.scopes}
+		customClaims := tr.MapScopes(test.realm, claims, nil)
+		if customClaims[ScopeClaim] != test.expectedScope {
+			t.Logf("FAIL: %s, scope claim mismatch: %v (expected) vs. %v (received)", testDescr, test.expectedScope, customClaims[ScopeClaim])
+			testFailed++
+			continue
+		}
+		if test.expectedScope != nil && len(claims.Scopes) > 0 {
+			t.Logf("FAIL: %s, scopes claim not cleared: %v", testDescr, claims.Scopes)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
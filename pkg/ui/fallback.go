@@ -0,0 +1,51 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"bytes"
+	"html"
+)
+
+// DefaultFallbackMessage is the message of the page displayed when a
+// template fails to render.
+const DefaultFallbackMessage = "The page is temporarily unavailable. Please try again later."
+
+// RenderFallback returns a minimal HTML page that does not depend on the
+// templates. It is displayed when a template fails to render, e.g. due
+// to a broken custom template.
+func (f *UserInterfaceFactory) RenderFallback() *bytes.Buffer {
+	title := f.Title
+	if title == "" {
+		title = "Authentication Portal"
+	}
+	message := f.FallbackMessage
+	if message == "" {
+		message = DefaultFallbackMessage
+	}
+	link := f.ActionEndpoint
+	if link == "" {
+		link = "/"
+	}
+	b := bytes.NewBuffer(nil)
+	b.WriteString("<!doctype html>\n<html lang=\"en\">\n<head>\n")
+	b.WriteString("<meta charset=\"utf-8\">\n<title>" + html.EscapeString(title) + "</title>\n")
+	b.WriteString("</head>\n<body>\n")
+	b.WriteString("<h1>" + html.EscapeString(title) + "</h1>\n")
+	b.WriteString("<p>" + html.EscapeString(message) + "</p>\n")
+	b.WriteString("<p><a href=\"" + html.EscapeString(link) + "\">Return to the portal</a></p>\n")
+	b.WriteString("</body>\n</html>\n")
+	return b
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// DefaultLoginHintParameter is the default name of the query parameter
+// pre-filling the username field of the login form.
+const DefaultLoginHintParameter = "login_hint"
+
+// maxLoginHintLength is the maximum length of the login hint.
+const maxLoginHintLength = 256
+
+// GetLoginHint returns the value of the login hint query parameter, e.g.
+// ?login_hint=jsmith@contoso.com, for the username field of the login form.
+// The value is HTML-escaped. It returns an empty string when the value is
+// absent, too long, or contains control characters.
+func (f *UserInterfaceFactory) GetLoginHint(r *http.Request) string {
+	if f.LoginHintParameter == "" {
+		return ""
+	}
+	hint := strings.TrimSpace(r.URL.Query().Get(f.LoginHintParameter))
+	if hint == "" || len(hint) > maxLoginHintLength {
+		return ""
+	}
+	for _, c := range hint {
+		if unicode.IsControl(c) {
+			return ""
+		}
+	}
+	return html.EscapeString(hint)
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// maxLoginInstructionsLength is the maximum length of the login
+// instructions of a realm.
+const maxLoginInstructionsLength = 1024
+
+// LoginInstructions is the instructional text shown on the login form
+// when the realm is selected, e.g. "Use your corporate email and AD
+// password".
+type LoginInstructions struct {
+	// The name of the realm, e.g. local.
+	Realm string `json:"realm,omitempty"`
+	// The plain text of the instructions.
+	Text string `json:"text,omitempty"`
+	// The URL of the help page, if any.
+	HelpURL string `json:"help_url,omitempty"`
+}
+
+// Sanitize returns the HTML-escaped text and help URL of the
+// instructions. It returns an error when the text is too long or
+// contains control characters, or the help URL is neither an HTTP(S)
+// URL nor an absolute path.
+func (i *LoginInstructions) Sanitize() (string, string, error) {
+	text := strings.TrimSpace(i.Text)
+	if text == "" && i.HelpURL == "" {
+		return "", "", fmt.Errorf("login instructions for realm %s are empty", i.Realm)
+	}
+	if len(text) > maxLoginInstructionsLength {
+		return "", "", fmt.Errorf("login instructions for realm %s exceed %d characters", i.Realm, maxLoginInstructionsLength)
+	}
+	for _, c := range text {
+		if unicode.IsControl(c) {
+			return "", "", fmt.Errorf("login instructions for realm %s contain control characters", i.Realm)
+		}
+	}
+	if i.HelpURL != "" {
+		u, err := url.Parse(i.HelpURL)
+		if err != nil {
+			return "", "", fmt.Errorf("login instructions help url for realm %s is invalid: %s", i.Realm, err)
+		}
+		switch {
+		case u.Scheme == "http" || u.Scheme == "https":
+			if u.Host == "" {
+				return "", "", fmt.Errorf("login instructions help url for realm %s has no host", i.Realm)
+			}
+		case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(i.HelpURL, "//"):
+		default:
+			return "", "", fmt.Errorf("login instructions help url for realm %s must be an http(s) url or an absolute path", i.Realm)
+		}
+	}
+	return html.EscapeString(text), html.EscapeString(i.HelpURL), nil
+}
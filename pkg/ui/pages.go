@@ -38,6 +38,9 @@ var PageTemplates = map[string]string{
     {{ end }}
   </head>
   <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
     <div class="container">
       <div class="row">
         <div class="col s12 m8 offset-m2 l6 offset-l3 xl4 offset-xl4 app-card-container">
@@ -63,7 +66,7 @@ var PageTemplates = map[string]string{
                 </div>
                 <div class="col s8">
                   <div class="input-field app-input-field">
-                    <input id="username" name="username" type="text" class="validate">
+                    <input id="username" name="username" type="text" class="validate"{{ if .Data.login_hint }} value="{{ .Data.login_hint }}"{{ end }}>
                   </div>
                 </div>
               </div>
@@ -104,12 +107,25 @@ var PageTemplates = map[string]string{
                   <input type="hidden" id="realm" name="realm" value="{{ .realm }}" />
                 {{ end }}
               {{ end }}
+              {{ range .Data.login_options.realms }}
+              {{ if or .instructions .help_url }}
+              <div class="app-realm-instructions" data-realm="{{ .realm }}"{{ if eq $.Data.login_options.realm_dropdown_required "yes" }} style="display: none;"{{ end }}>
+                <p class="app-text">{{ .instructions }}{{ if .help_url }} <a href="{{ .help_url }}" target="_blank" rel="noopener noreferrer">Help</a>{{ end }}</p>
+              </div>
+              {{ end }}
+              {{ end }}
             </div>
             <div class="row app-control valign-wrapper">
               <div class="col s6">
                 {{ if eq .Data.login_options.registration_required "yes" }}
+                {{ if .Data.login_options.registration_realms }}
+                {{ range .Data.login_options.registration_realms }}
+                <span class="app-link"><a href="{{ pathjoin $.ActionEndpoint "/register" . }}">Register ({{ . }})</a></span>
+                {{ end }}
+                {{ else }}
                 <span class="app-link"><a href="{{ pathjoin .ActionEndpoint "/register" }}">Register</a></span>
                 {{ end }}
+                {{ end }}
                 {{ if eq .Data.login_options.password_recovery_required "yes" }}
                 <span class="app-link"><a href="{{ pathjoin .ActionEndpoint "/forgot" }}">Forgot Password?</a></span>
                 {{ end }}
@@ -138,11 +154,28 @@ var PageTemplates = map[string]string{
         </div>
       </div>
     </div>
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
     <!-- Optional JavaScript -->
     <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
     {{ if eq .Data.ui_options.custom_js_required "yes" }}
     <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
     {{ end }}
+    {{ if eq .Data.login_options.realm_dropdown_required "yes" }}
+    <script>
+    var realmSelect = document.getElementById('realm');
+    function showRealmInstructions() {
+      document.querySelectorAll('.app-realm-instructions').forEach(function(el) {
+        el.style.display = (el.dataset.realm === realmSelect.value) ? '' : 'none';
+      });
+    }
+    if (realmSelect) {
+      realmSelect.addEventListener('change', showRealmInstructions);
+      showRealmInstructions();
+    }
+    </script>
+    {{ end }}
     {{ if .Message }}
     <script>
     var toastHTML = '<span class="app-error-text">{{ .Message }}</span><button class="btn-flat toast-action" onclick="M.Toast.dismissAll();">Close</button>';
@@ -165,6 +198,12 @@ var PageTemplates = map[string]string{
     <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
     <meta name="description" content="Authentication Portal">
     <meta name="author" content="Paul Greenberg github.com/greenpau">
+    {{ if .Data.session_ping_url }}
+    <meta name="session-ping-url" content="{{ .Data.session_ping_url }}">
+    {{ end }}
+    {{ if .Data.session_expires_at }}
+    <meta name="session-expires-at" content="{{ .Data.session_expires_at }}">
+    {{ end }}
     <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
     <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
     <!-- Matrialize CSS -->
@@ -177,6 +216,9 @@ var PageTemplates = map[string]string{
     {{ end }}
   </head>
   <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
     <div class="container">
       <div class="row">
         <div class="col s12 m6 offset-m3 l4 offset-l4 app-card-container">
@@ -193,6 +235,9 @@ var PageTemplates = map[string]string{
             {{ end }}
           </div>
           <div class="row">
+            {{ if .Data.password_expires_at }}
+            <p class="app-text">Your password expires on {{ .Data.password_expires_at }}. Please change it in the settings.</p>
+            {{ end }}
             <p class="app-text">Access the following services.</p>
             <ul class="collection">
               {{range .PrivateLinks}}
@@ -217,6 +262,9 @@ var PageTemplates = map[string]string{
       </div>
     </div>
 
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
     <!-- Optional JavaScript -->
     <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
     {{ if eq .Data.ui_options.custom_js_required "yes" }}
@@ -244,6 +292,12 @@ var PageTemplates = map[string]string{
     <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
     <meta name="description" content="Authentication Portal">
     <meta name="author" content="Paul Greenberg github.com/greenpau">
+    {{ if .Data.session_ping_url }}
+    <meta name="session-ping-url" content="{{ .Data.session_ping_url }}">
+    {{ end }}
+    {{ if .Data.session_expires_at }}
+    <meta name="session-expires-at" content="{{ .Data.session_expires_at }}">
+    {{ end }}
     <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
     <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
     <!-- Matrialize CSS -->
@@ -257,6 +311,9 @@ var PageTemplates = map[string]string{
     {{ end }}
   </head>
   <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
     <div class="container">
       <div class="row">
         <div class="col s12 m12 l6 offset-l3 app-card-container">
@@ -293,6 +350,9 @@ var PageTemplates = map[string]string{
       </div>
     </div>
 
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
     <!-- Optional JavaScript -->
     <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
     <script src="{{ pathjoin .ActionEndpoint "/assets/highlight.js/js/highlight.js" }}"></script>
@@ -327,11 +387,14 @@ var PageTemplates = map[string]string{
     {{ end }}
   </head>
   <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
     <div class="container">
       <div class="row">
         <div class="col s12 m12 l6 offset-l3">
           {{ if not .Data.registered }}
-          <form action="{{ pathjoin .ActionEndpoint "/register" }}" method="POST">
+          <form action="{{ if .Data.registration_realm }}{{ pathjoin .ActionEndpoint "/register" .Data.registration_realm }}{{ else }}{{ pathjoin .ActionEndpoint "/register" }}{{ end }}" method="POST">
           {{ end }}
           <div class="card card-large app-card">
             <div class="card-content">
@@ -344,36 +407,68 @@ var PageTemplates = map[string]string{
                 </div>
               </span>
               {{ if not .Data.registered }}
+              {{ if .Data.wizard_step }}
+              <input type="hidden" name="wizard_id" value="{{ .Data.wizard_id }}" />
+              <p class="app-text center-align">Step {{ .Data.wizard_step_number }} of {{ .Data.wizard_step_count }}: {{ .Data.wizard_step_title }}</p>
+              {{ end }}
+              {{ if or (not .Data.wizard_step) (eq .Data.wizard_step "account") }}
               <div class="input-field">
-                <input id="username" name="username" type="text" class="validate"
+                <input id="username" name="username" type="text" class="validate"{{ with .Data.wizard_values }} value="{{ .username }}"{{ end }}
+                  {{ if .Data.username_pattern }}
+                  pattern="{{ .Data.username_pattern }}"
+                  minlength="{{ .Data.username_min_length }}" maxlength="{{ .Data.username_max_length }}"
+                  title="Username should contain between {{ .Data.username_min_length }} and {{ .Data.username_max_length }} characters matching {{ .Data.username_pattern }}."
+                  {{ else }}
                   pattern="[a-z0-9]{3,25}"
                   title="Username should contain maximum of 25 characters and consists of a-z and 0-9 characters."
+                  {{ end }}
                   required />
-                <label for="username">Username</label>
+                <label for="username"{{ with .Data.wizard_values }}{{ if .username }} class="active"{{ end }}{{ end }}>Username</label>
               </div>
               <div class="input-field">
-                <input id="email" name="email" type="email" class="validate"
+                <input id="email" name="email" type="email" class="validate"{{ with .Data.wizard_values }} value="{{ .email }}"{{ end }}
                   required />
-                <label for="email">Email Address</label>
+                <label for="email"{{ with .Data.wizard_values }}{{ if .email }} class="active"{{ end }}{{ end }}>Email Address</label>
               </div>
               <div class="input-field">
-                <input id="password" name="password" type="password" class="validate" required />
+                <input id="password" name="password" type="password" class="validate"{{ if .Data.wizard_password_set }} placeholder="Leave blank to keep the password"{{ else }} required{{ end }} />
                 <label for="password">Password</label>
               </div>
               <div class="input-field">
-                <input id="password_confirm" name="password_confirm" type="password" class="validate" required />
+                <input id="password_confirm" name="password_confirm" type="password" class="validate"{{ if .Data.wizard_password_set }} placeholder="Leave blank to keep the password"{{ else }} required{{ end }} />
                 <label for="password_confirm">Confirm Password</label>
               </div>
+              {{ if and .Data.wizard_step .Data.invitation }}
+              <input type="hidden" name="invitation" value="{{ .Data.invitation }}" />
+              {{ end }}
+              {{ end }}
+              {{ if or (not .Data.wizard_step) (eq .Data.wizard_step "profile") }}
+              {{ range .Data.profile_fields }}
+              {{ $name := printf "profile_%s" .Name }}
+              <div class="input-field">
+                <input id="{{ $name }}" name="{{ $name }}" type="{{ if eq .Type "phone" }}tel{{ else }}{{ .Type }}{{ end }}" class="validate"
+                  maxlength="{{ .MaxLength }}"{{ if .Required }} required{{ end }}{{ with $.Data.wizard_values }} value="{{ index . $name }}"{{ end }} />
+                <label for="{{ $name }}">{{ .Label }}</label>
+              </div>
+              {{ end }}
+              {{ end }}
+              {{ if or (not .Data.wizard_step) (eq .Data.wizard_step "verification") }}
               {{ if .Data.require_registration_code }}
               <div class="input-field">
                 <input id="code" name="code" type="text" class="validate" required />
                 <label for="code">Registration Code</label>
               </div>
               {{ end }}
+              {{ if .Data.require_invitation }}
+              <div class="input-field">
+                <input id="invitation" name="invitation" type="text" class="validate" value="{{ .Data.invitation }}" required />
+                <label for="invitation"{{ if .Data.invitation }} class="active"{{ end }}>Invitation</label>
+              </div>
+              {{ end }}
               {{ if .Data.require_accept_terms }}
               <p>
                 <label>
-                  <input type="checkbox" id="accept_terms" name="accept_terms" required />
+                  <input type="checkbox" id="accept_terms" name="accept_terms"{{ with .Data.wizard_values }}{{ if .accept_terms }} checked{{ end }}{{ end }} required />
                   <span>I agree to
                     <a href="{{ pathjoin .ActionEndpoint "/termsandconditions" }}">Terms and Conditions</a> and
                     <a href="{{ pathjoin .ActionEndpoint "/privacypolicy" }}">Privacy Policy</a>.
@@ -381,6 +476,7 @@ var PageTemplates = map[string]string{
                 </label>
               </p>
               {{ end }}
+              {{ end }}
               {{ else }}
               <p class="app-text">Thank you for registering and we hope you enjoy the experience!</p>
               <p class="app-text">Here are a few things to keep in mind:</p>
@@ -392,16 +488,30 @@ var PageTemplates = map[string]string{
             </div>
             <div class="card-action right-align">
               {{ if not .Data.registered }}
+              {{ if and .Data.wizard_step (gt .Data.wizard_step_number 1) }}
+              <button type="submit" name="action" value="back" formnovalidate class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                <i class="las la-undo left app-btn-icon"></i>
+                <span class="app-btn-text">Back</span>
+              </button>
+              {{ else }}
               <a href="{{ .ActionEndpoint }}" class="navbtn-last">
                 <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
                   <i class="las la-undo left app-btn-icon"></i>
                   <span class="app-btn-text">Back</span>
                 </button>
               </a>
+              {{ end }}
+              {{ if .Data.wizard_step }}
+              <button type="submit" name="action" value="next" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                <i class="las la-chevron-circle-right app-btn-icon"></i>
+                <span class="app-btn-text">{{ if .Data.wizard_last_step }}Submit{{ else }}Next{{ end }}</span>
+              </button>
+              {{ else }}
               <button type="submit" name="submit" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
                 <i class="las la-chevron-circle-right app-btn-icon"></i>
                 <span class="app-btn-text">Submit</span>
               </button>
+              {{ end }}
               {{ else }}
               <a href="{{ .ActionEndpoint }}" class="navbtn-last">
                 <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
@@ -417,6 +527,9 @@ var PageTemplates = map[string]string{
       </div>
     </div>
 
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
     <!-- Optional JavaScript -->
     <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
     {{ if eq .Data.ui_options.custom_js_required "yes" }}
@@ -457,6 +570,9 @@ var PageTemplates = map[string]string{
     {{ end }}
   </head>
   <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
     <div class="container">
       <div class="row">
         <div class="col s12 m12 l6 offset-l3">
@@ -470,6 +586,9 @@ var PageTemplates = map[string]string{
                   <h4>{{ .Title }}</h4>
                 </div>
               </span>
+              {{ if .Message }}
+              <p class="center-align">{{ .Message }}</p>
+              {{ end }}
             </div>
             <div class="card-action right-align">
               {{ if .Data.go_back_url }}
@@ -486,6 +605,9 @@ var PageTemplates = map[string]string{
       </div>
     </div>
 
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
     <!-- Optional JavaScript -->
     <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
     {{ if eq .Data.ui_options.custom_js_required "yes" }}
@@ -503,6 +625,12 @@ var PageTemplates = map[string]string{
 
     <meta name="description" content="Authentication Portal">
     <meta name="author" content="Paul Greenberg github.com/greenpau">
+    {{ if .Data.session_ping_url }}
+    <meta name="session-ping-url" content="{{ .Data.session_ping_url }}">
+    {{ end }}
+    {{ if .Data.session_expires_at }}
+    <meta name="session-expires-at" content="{{ .Data.session_expires_at }}">
+    {{ end }}
     <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
     <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
 
@@ -517,6 +645,9 @@ var PageTemplates = map[string]string{
     {{ end }}
   </head>
   <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
     <div class="container app-container">
       <div class="row">
         <nav>
@@ -555,6 +686,16 @@ var PageTemplates = map[string]string{
             <a href="{{ pathjoin .ActionEndpoint "/settings/apikeys" }}" class="collection-item{{ if eq .Data.view "apikeys" }} active{{ end }}">API Keys</a>
             <a href="{{ pathjoin .ActionEndpoint "/settings/mfa" }}" class="collection-item{{ if eq .Data.view "mfa" }} active{{ end }}">MFA</a>
             <a href="{{ pathjoin .ActionEndpoint "/settings/password" }}" class="collection-item{{ if eq .Data.view "password" }} active{{ end }}">Password</a>
+            {{ if .Data.email_change_enabled }}
+            <a href="{{ pathjoin .ActionEndpoint "/settings/email" }}" class="collection-item{{ if eq .Data.view "email" }} active{{ end }}">Email</a>
+            {{ end }}
+            {{ if .Data.profile_enabled }}
+            <a href="{{ pathjoin .ActionEndpoint "/settings/profile" }}" class="collection-item{{ if eq .Data.view "profile" }} active{{ end }}">Profile</a>
+            {{ end }}
+            {{ if .Data.recovery_enabled }}
+            <a href="{{ pathjoin .ActionEndpoint "/settings/recovery" }}" class="collection-item{{ if eq .Data.view "recovery" }} active{{ end }}">Recovery</a>
+            {{ end }}
+            <a href="{{ pathjoin .ActionEndpoint "/settings/session" }}" class="collection-item{{ if eq .Data.view "session" }} active{{ end }}">Session</a>
             <a href="{{ pathjoin .ActionEndpoint "/settings/misc" }}" class="collection-item{{ if eq .Data.view "misc" }} active{{ end }}">Miscellaneous</a>
             <a href="{{ pathjoin .ActionEndpoint "/portal" }}" class="hide-on-med-and-up collection-item">Portal</a>
             <a href="{{ pathjoin .ActionEndpoint "/logout" }}" class="hide-on-med-and-up collection-item">Logout</a>
@@ -806,6 +947,48 @@ var PageTemplates = map[string]string{
             {{ end }}
             </div>
           </div>
+          {{ if .Data.device_trust_enabled }}
+          <div class="row">
+            <div class="col s12">
+            <h5>Trusted Devices</h5>
+            {{ if .Data.trusted_devices }}
+              {{range .Data.trusted_devices}}
+              <div class="card">
+                <div class="card-content">
+                  <p>
+                    <b>Device</b>: {{ .UserAgent }}<br/>
+                    <b>Trusted At</b>: {{ .CreatedAt.Format "2006-01-02 15:04:05 MST" }}<br/>
+                    <b>Expires At</b>: {{ .ExpiresAt.Format "2006-01-02 15:04:05 MST" }}
+                  </p>
+                </div>
+              </div>
+              {{ end }}
+              <a href="{{ pathjoin .ActionEndpoint "/settings/mfa/revoke" }}">
+                <button type="button" class="btn waves-effect waves-light navbtn active">
+                  <i class="las la-ban left app-btn-icon"></i>
+                  <span class="app-btn-text">Revoke All</span>
+                </button>
+              </a>
+            {{ else }}
+              <p>No trusted devices found</p>
+            {{ end }}
+            </div>
+          </div>
+          {{ end }}
+          {{ end }}
+          {{ if eq .Data.view "mfa-revoke-status" }}
+          <div class="row">
+            <div class="col s12">
+            <h1>Trusted Devices</h1>
+            <p>{{.Data.status }}: {{ .Data.status_reason }}</p>
+            <a href="{{ pathjoin .ActionEndpoint "/settings/mfa" }}">
+              <button type="button" class="btn waves-effect waves-light navbtn active">
+                <i class="las la-undo-alt left app-btn-icon"></i>
+                <span class="app-btn-text">Go Back</span>
+              </button>
+            </a>
+            </div>
+          </div>
           {{ end }}
           {{ if eq .Data.view "mfa-add-app" }}
             <form action="{{ pathjoin .ActionEndpoint "/settings/mfa/add/app" }}" method="POST">
@@ -1034,6 +1217,204 @@ var PageTemplates = map[string]string{
             </div>
           </div>
           {{ end }}
+          {{ if eq .Data.view "email" }}
+            <form action="{{ pathjoin .ActionEndpoint "/settings/email/edit" }}" method="POST">
+              <div class="row">
+                <h1>Email Address</h1>
+                <div class="row">
+                  <div class="col s12 m6 l6">
+                    <p>Your current email address is <b>{{ .Data.current_email }}</b>. If you want to change it,
+                    please provide the new email address. The change takes effect once you follow
+                    the confirmation link sent to the new address.
+                    </p>
+                    <div class="input-field">
+                      <input id="email" name="email" type="email" required />
+                      <label for="email">New Email Address</label>
+                    </div>
+                  </div>
+                </div>
+              </div>
+              <div class="row right">
+                <button type="submit" name="submit" class="btn waves-effect waves-light navbtn active navbtn-last app-btn">
+                  <i class="las la-paper-plane left app-btn-icon"></i>
+                  <span class="app-btn-text">Change Email</span>
+                </button>
+              </div>
+            </form>
+          {{ end }}
+          {{ if eq .Data.view "email-edit" }}
+          <div class="row">
+            <div class="col s12">
+            {{ if eq .Data.status "success" }}
+              <h1>Confirmation Link Has Been Sent</h1>
+              <p>Please follow the link sent to {{ .Data.new_email }} to confirm the change.
+              Your current email address remains active until then.</p>
+            {{ else }}
+              <h1>Email Change Failed</h1>
+              <p>Reason: {{ .Data.status_reason }} </p>
+              <a href="{{ pathjoin .ActionEndpoint "/settings/email" }}">
+                <button type="button" class="btn waves-effect waves-light navbtn active">
+                  <i class="las la-undo-alt left app-btn-icon"></i>
+                  <span class="app-btn-text">Try Again</span>
+                </button>
+              </a>
+            {{ end }}
+            </div>
+          </div>
+          {{ end }}
+          {{ if eq .Data.view "email-confirm" }}
+          <div class="row">
+            <div class="col s12">
+            {{ if eq .Data.status "success" }}
+              <h1>Email Address Has Been Changed</h1>
+              <p>Your email address is now {{ .Data.new_email }}. Please log out and log back in.</p>
+            {{ else }}
+              <h1>Email Change Confirmation Failed</h1>
+              <p>Reason: {{ .Data.status_reason }} </p>
+            {{ end }}
+            </div>
+          </div>
+          {{ end }}
+          {{ if eq .Data.view "email-disabled" }}
+          <div class="row">
+            <div class="col s12">
+            <p>The change of email address is not available for your account.</p>
+            </div>
+          </div>
+          {{ end }}
+          {{ if eq .Data.view "profile" }}
+            <form action="{{ pathjoin .ActionEndpoint "/settings/profile/edit" }}" method="POST">
+              <div class="row">
+                <h1>Profile</h1>
+                <div class="row">
+                  <div class="col s12 m6 l6">
+                    {{ range .Data.profile_fields }}
+                    <div class="input-field">
+                      <input id="profile_{{ .Name }}" name="profile_{{ .Name }}" type="{{ if eq .Type "phone" }}tel{{ else }}{{ .Type }}{{ end }}"
+                        maxlength="{{ .MaxLength }}" value="{{ index $.Data.profile_values .Name }}"{{ if .Required }} required{{ end }} />
+                      <label for="profile_{{ .Name }}"{{ if index $.Data.profile_values .Name }} class="active"{{ end }}>{{ .Label }}</label>
+                    </div>
+                    {{ end }}
+                  </div>
+                </div>
+              </div>
+              <div class="row right">
+                <button type="submit" name="submit" class="btn waves-effect waves-light navbtn active navbtn-last app-btn">
+                  <i class="las la-save left app-btn-icon"></i>
+                  <span class="app-btn-text">Save Profile</span>
+                </button>
+              </div>
+            </form>
+          {{ end }}
+          {{ if eq .Data.view "profile-edit" }}
+          <div class="row">
+            <div class="col s12">
+            {{ if eq .Data.status "success" }}
+              <h1>Profile Has Been Updated</h1>
+              <p>The changes to the claims of your profile take effect on your next login.</p>
+            {{ else }}
+              <h1>Profile Update Failed</h1>
+              <p>Reason: {{ .Data.status_reason }} </p>
+              <a href="{{ pathjoin .ActionEndpoint "/settings/profile" }}">
+                <button type="button" class="btn waves-effect waves-light navbtn active">
+                  <i class="las la-undo-alt left app-btn-icon"></i>
+                  <span class="app-btn-text">Try Again</span>
+                </button>
+              </a>
+            {{ end }}
+            </div>
+          </div>
+          {{ end }}
+          {{ if eq .Data.view "profile-disabled" }}
+          <div class="row">
+            <div class="col s12">
+            <p>The profile is not available for your account.</p>
+            </div>
+          </div>
+          {{ end }}
+          {{ if eq .Data.view "recovery" }}
+            <form action="{{ pathjoin .ActionEndpoint "/settings/recovery/edit" }}" method="POST">
+              <div class="row">
+                <h1>Security Questions</h1>
+                <div class="row">
+                  <div class="col s12 m6 l6">
+                    <p>The answers to the security questions allow you to recover your account
+                    when you forget your password. Please answer at least
+                    {{ .Data.recovery_required_answers }} questions. The new answers replace the existing ones.
+                    </p>
+                    {{ range .Data.recovery_questions }}
+                    <div class="input-field">
+                      <input id="answer_{{ .ID }}" name="answer_{{ .ID }}" type="password" autocomplete="off" />
+                      <label for="answer_{{ .ID }}">{{ .Text }}{{ if index $.Data.recovery_answered .ID }} (answered){{ end }}</label>
+                    </div>
+                    {{ end }}
+                  </div>
+                </div>
+              </div>
+              <div class="row right">
+                <button type="submit" name="submit" class="btn waves-effect waves-light navbtn active navbtn-last app-btn">
+                  <i class="las la-paper-plane left app-btn-icon"></i>
+                  <span class="app-btn-text">Save Answers</span>
+                </button>
+              </div>
+            </form>
+          {{ end }}
+          {{ if eq .Data.view "recovery-edit" }}
+          <div class="row">
+            <div class="col s12">
+            {{ if eq .Data.status "success" }}
+              <h1>Security Answers Have Been Saved</h1>
+            {{ else }}
+              <h1>Saving Security Answers Failed</h1>
+              <p>Reason: {{ .Data.status_reason }} </p>
+              <a href="{{ pathjoin .ActionEndpoint "/settings/recovery" }}">
+                <button type="button" class="btn waves-effect waves-light navbtn active">
+                  <i class="las la-undo-alt left app-btn-icon"></i>
+                  <span class="app-btn-text">Try Again</span>
+                </button>
+              </a>
+            {{ end }}
+            </div>
+          </div>
+          {{ end }}
+          {{ if eq .Data.view "recovery-disabled" }}
+          <div class="row">
+            <div class="col s12">
+            <p>The account recovery via security questions is not available for your account.</p>
+            </div>
+          </div>
+          {{ end }}
+          {{ if eq .Data.view "session" }}
+          <div class="row">
+            <div class="col s12">
+              <div class="card">
+                <div class="card-content">
+                  <span class="card-title"><i class="las la-check-circle"></i> This is your current session</span>
+                  <p>
+                    <b>Session ID</b>: {{ .Data.session.ID }}<br/>
+                    {{ if .Data.session.Method }}
+                    <b>Method</b>: {{ .Data.session.Method }}<br/>
+                    <b>Realm</b>: {{ .Data.session.Realm }}<br/>
+                    {{ end }}
+                    {{ if not .Data.session.AuthenticatedAt.IsZero }}
+                    <b>Login Time</b>: {{ .Data.session.AuthenticatedAt.Format "2006-01-02 15:04:05 MST" }}<br/>
+                    {{ end }}
+                    {{ if not .Data.session.ExpiresAt.IsZero }}
+                    <b>Expires At</b>: {{ .Data.session.ExpiresAt.Format "2006-01-02 15:04:05 MST" }}<br/>
+                    {{ end }}
+                    <b>Source IP</b>: {{ if .Data.session.SourceAddress }}{{ .Data.session.SourceAddress }}{{ else }}Unknown{{ end }}<br/>
+                    <b>User Agent</b>: {{ if .Data.session.UserAgent }}{{ .Data.session.UserAgent }}{{ else }}Unknown{{ end }}
+                  </p>
+                  {{ if .Data.session.SourceAddress }}
+                  {{ if ne .Data.session.SourceAddress .Data.current_src_ip }}
+                  <p>You logged in from {{ .Data.session.SourceAddress }}, and the current request comes from {{ .Data.current_src_ip }}.</p>
+                  {{ end }}
+                  {{ end }}
+                </div>
+              </div>
+            </div>
+          </div>
+          {{ end }}
           {{ if eq .Data.view "misc" }}
           <div class="row">
             <div class="col s12">
@@ -1045,6 +1426,9 @@ var PageTemplates = map[string]string{
       </div>
     </div>
 
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
     <!-- Optional JavaScript -->
     <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
     <script src="{{ pathjoin .ActionEndpoint "/assets/highlight.js/js/highlight.js" }}"></script>
@@ -1305,5 +1689,567 @@ var PageTemplates = map[string]string{
     </script>
     {{ end }}
   </body>
+</html>`,
+	"basic/recover": `<!doctype html>
+<html lang="en">
+  <head>
+    <title>{{ .Title }}</title>
+    <!-- Required meta tags -->
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <meta name="description" content="Authentication Portal">
+    <meta name="author" content="Paul Greenberg github.com/greenpau">
+    <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+    <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+
+		<!-- Matrialize CSS -->
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/materialize-css/css/materialize.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/roboto.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/line-awesome/line-awesome.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/styles.css" }}" />
+    {{ if eq .Data.ui_options.custom_css_required "yes" }}
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/custom.css" }}" />
+    {{ end }}
+  </head>
+  <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
+    <div class="container">
+      <div class="row">
+        <div class="col s12 m12 l6 offset-l3">
+          {{ if eq .Data.step "reset" }}
+          <form action="{{ pathjoin .ActionEndpoint "/recover/reset" .Data.token }}" method="POST">
+          {{ else if and (ne .Data.step "done") (ne .Data.step "sent") (ne .Data.step "invalid") }}
+          <form action="{{ pathjoin .ActionEndpoint "/recover" }}" method="POST">
+          {{ end }}
+          <div class="card card-large app-card">
+            <div class="card-content">
+              <span class="card-title center-align">
+                <div class="section app-header">
+                  {{ if .LogoURL }}
+                  <img class="d-block mx-auto mb-2" src="{{ .LogoURL }}" alt="{{ .LogoDescription }}" width="72" height="72">
+                  {{ end }}
+                  <h4>{{ .Title }}</h4>
+                </div>
+              </span>
+              {{ if eq .Data.step "identify" }}
+              <p class="app-text">Please provide the details of your account.</p>
+              <input type="hidden" name="step" value="identify" />
+              <div class="input-field">
+                <input id="username" name="username" type="text" class="validate" value="{{ .Data.username }}" required />
+                <label for="username">Username</label>
+              </div>
+              {{ if .Data.require_email }}
+              <div class="input-field">
+                <input id="email" name="email" type="email" class="validate" value="{{ .Data.email }}" required />
+                <label for="email">Email Address</label>
+              </div>
+              {{ end }}
+              {{ end }}
+              {{ if eq .Data.step "verify" }}
+              <p class="app-text">Please answer the security questions and choose new password.</p>
+              <input type="hidden" name="step" value="verify" />
+              <input type="hidden" name="username" value="{{ .Data.username }}" />
+              <input type="hidden" name="email" value="{{ .Data.email }}" />
+              <input type="hidden" name="realm" value="{{ .Data.realm }}" />
+              {{ range .Data.questions }}
+              <div class="input-field">
+                <input id="answer_{{ .ID }}" name="answer_{{ .ID }}" type="password" autocomplete="off" required />
+                <label for="answer_{{ .ID }}">{{ .Text }}</label>
+              </div>
+              {{ end }}
+              <div class="input-field">
+                <input id="password" name="password" type="password" class="validate" required />
+                <label for="password">New Password</label>
+              </div>
+              <div class="input-field">
+                <input id="password_confirm" name="password_confirm" type="password" class="validate" required />
+                <label for="password_confirm">Confirm New Password</label>
+              </div>
+              {{ end }}
+              {{ if eq .Data.step "request" }}
+              <p class="app-text">Please provide the email address of your account. We will send you a link to choose new password.</p>
+              <input type="hidden" name="step" value="request" />
+              <div class="input-field">
+                <input id="email" name="email" type="email" class="validate" value="{{ .Data.email }}" required />
+                <label for="email">Email Address</label>
+              </div>
+              {{ end }}
+              {{ if eq .Data.step "sent" }}
+              <p class="app-text">If the account exists, we sent a recovery link to its email address. Please check your inbox.</p>
+              {{ end }}
+              {{ if eq .Data.step "reset" }}
+              <p class="app-text">Please choose new password.</p>
+              <div class="input-field">
+                <input id="password" name="password" type="password" class="validate" required />
+                <label for="password">New Password</label>
+              </div>
+              <div class="input-field">
+                <input id="password_confirm" name="password_confirm" type="password" class="validate" required />
+                <label for="password_confirm">Confirm New Password</label>
+              </div>
+              {{ end }}
+              {{ if eq .Data.step "invalid" }}
+              <p class="app-text">The recovery link is invalid, expired, or already used. Please request a new link.</p>
+              {{ end }}
+              {{ if eq .Data.step "done" }}
+              <p class="app-text">Your password has been changed. Please log in with your new password.</p>
+              {{ end }}
+            </div>
+            <div class="card-action right-align">
+              <a href="{{ .ActionEndpoint }}" class="navbtn-last">
+                <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                  <i class="las la-undo left app-btn-icon"></i>
+                  <span class="app-btn-text">Back</span>
+                </button>
+              </a>
+              {{ if and (ne .Data.step "done") (ne .Data.step "sent") (ne .Data.step "invalid") }}
+              <button type="submit" name="submit" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                <i class="las la-chevron-circle-right app-btn-icon"></i>
+                <span class="app-btn-text">Submit</span>
+              </button>
+              {{ end }}
+            </div>
+          </div>
+          {{ if and (ne .Data.step "done") (ne .Data.step "sent") (ne .Data.step "invalid") }}
+          </form>
+          {{ end }}
+        </div>
+      </div>
+    </div>
+
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
+    <!-- Optional JavaScript -->
+    <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
+    {{ if eq .Data.ui_options.custom_js_required "yes" }}
+    <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
+    {{ end }}
+    {{ if .Message }}
+    <script>
+    var toastHTML = '<span>{{ .Message }}</span><button class="btn-flat toast-action" onclick="M.Toast.dismissAll();">Close</button>';
+    toastElement = M.toast({
+      html: toastHTML,
+      classes: 'toast-error'
+    });
+    const appContainer = document.querySelector('.app-card-container')
+    appContainer.prepend(toastElement.el)
+    </script>
+    {{ end }}
+  </body>
+</html>`,
+	"basic/mfa": `<!doctype html>
+<html lang="en">
+  <head>
+    <title>{{ .Title }}</title>
+    <!-- Required meta tags -->
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <meta name="description" content="Authentication Portal">
+    <meta name="author" content="Paul Greenberg github.com/greenpau">
+    <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+    <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+
+		<!-- Matrialize CSS -->
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/materialize-css/css/materialize.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/roboto.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/line-awesome/line-awesome.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/styles.css" }}" />
+    {{ if eq .Data.ui_options.custom_css_required "yes" }}
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/custom.css" }}" />
+    {{ end }}
+  </head>
+  <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
+    <div class="container">
+      <div class="row">
+        <div class="col s12 m12 l6 offset-l3">
+          {{ if eq .Data.step "challenge" }}
+          <form action="{{ pathjoin .Data.action .Data.method.Name }}" method="POST">
+          {{ end }}
+          {{ if eq .Data.step "enroll" }}
+          <form action="{{ .Data.action }}" method="POST">
+          {{ end }}
+          <div class="card card-large app-card">
+            <div class="card-content">
+              <span class="card-title center-align">
+                <div class="section app-header">
+                  {{ if .LogoURL }}
+                  <img class="d-block mx-auto mb-2" src="{{ .LogoURL }}" alt="{{ .LogoDescription }}" width="72" height="72">
+                  {{ end }}
+                  <h4>{{ .Title }}</h4>
+                </div>
+              </span>
+              {{ if eq .Data.step "select" }}
+              <p class="app-text">Please choose how you want to confirm your identity.</p>
+              <div class="collection">
+                {{ range .Data.methods }}
+                <a href="{{ pathjoin $.Data.action .Name }}" class="collection-item">{{ .Title }}</a>
+                {{ end }}
+              </div>
+              {{ end }}
+              {{ if eq .Data.step "challenge" }}
+              <p class="app-text">Please provide the code generated by your {{ .Data.method.Title }}.</p>
+              <div class="input-field">
+                <input id="code" name="code" type="text" inputmode="numeric" autocomplete="one-time-code" class="validate" required autofocus />
+                <label for="code">Code</label>
+              </div>
+              {{ if .Data.trusted_device_lifetime }}
+              <p>
+                <label>
+                  <input type="checkbox" id="trust_device" name="trust_device" value="yes" />
+                  <span>Trust this device for {{ .Data.trusted_device_lifetime }} days</span>
+                </label>
+              </p>
+              {{ end }}
+              {{ end }}
+              {{ if eq .Data.step "enroll" }}
+              <p class="app-text">Your account requires multi-factor authentication. Please add your account to an authenticator application, e.g. Microsoft/Google Authenticator, Authy, etc., by scanning the QR code.</p>
+              <div class="center-align"><img src="data:image/png;base64,{{ .Data.code_image }}" alt="QR Code" /></div>
+              <div class="center-align"><a href="{{ .Data.code_uri }}">Link</a></div>
+              <p class="app-text">Then, enter two consecutive authentication codes.</p>
+              <div class="input-field">
+                <input id="comment" name="comment" type="text" class="validate" pattern="[A-Za-z0-9 -]{4,25}"
+                  title="Comment should contain 4-25 characters and consists of A-Z, a-z, 0-9, space, and dash characters." />
+                <label for="comment">Comment</label>
+              </div>
+              <div class="input-field">
+                <input id="code1" name="code1" type="text" inputmode="numeric" class="validate" pattern="[0-9]{6}" autocomplete="off" required />
+                <label for="code1">Authentication Code 1</label>
+              </div>
+              <div class="input-field">
+                <input id="code2" name="code2" type="text" inputmode="numeric" class="validate" pattern="[0-9]{6}" autocomplete="off" required />
+                <label for="code2">Authentication Code 2</label>
+              </div>
+              {{ end }}
+            </div>
+            <div class="card-action right-align">
+              {{ if and (eq .Data.step "challenge") (gt (len .Data.methods) 1) }}
+              <a href="{{ .Data.action }}" class="navbtn-last">
+                <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                  <i class="las la-exchange-alt left app-btn-icon"></i>
+                  <span class="app-btn-text">Other Method</span>
+                </button>
+              </a>
+              {{ end }}
+              <a href="{{ pathjoin .ActionEndpoint "/logout" }}" class="navbtn-last">
+                <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                  <i class="las la-undo left app-btn-icon"></i>
+                  <span class="app-btn-text">Cancel</span>
+                </button>
+              </a>
+              {{ if or (eq .Data.step "challenge") (eq .Data.step "enroll") }}
+              <button type="submit" name="submit" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                <i class="las la-chevron-circle-right app-btn-icon"></i>
+                <span class="app-btn-text">Submit</span>
+              </button>
+              {{ end }}
+            </div>
+          </div>
+          {{ if or (eq .Data.step "challenge") (eq .Data.step "enroll") }}
+          </form>
+          {{ end }}
+        </div>
+      </div>
+    </div>
+
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
+    <!-- Optional JavaScript -->
+    <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
+    {{ if eq .Data.ui_options.custom_js_required "yes" }}
+    <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
+    {{ end }}
+    {{ if .Message }}
+    <script>
+    var toastHTML = '<span>{{ .Message }}</span><button class="btn-flat toast-action" onclick="M.Toast.dismissAll();">Close</button>';
+    toastElement = M.toast({
+      html: toastHTML,
+      classes: 'toast-error'
+    });
+    const appContainer = document.querySelector('.app-card-container')
+    appContainer.prepend(toastElement.el)
+    </script>
+    {{ end }}
+  </body>
+</html>`,
+	"basic/reverify": `<!doctype html>
+<html lang="en">
+  <head>
+    <title>{{ .Title }}</title>
+    <!-- Required meta tags -->
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <meta name="description" content="Authentication Portal">
+    <meta name="author" content="Paul Greenberg github.com/greenpau">
+    <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+    <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+
+		<!-- Matrialize CSS -->
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/materialize-css/css/materialize.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/roboto.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/line-awesome/line-awesome.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/styles.css" }}" />
+    {{ if eq .Data.ui_options.custom_css_required "yes" }}
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/custom.css" }}" />
+    {{ end }}
+  </head>
+  <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
+    <div class="container">
+      <div class="row">
+        <div class="col s12 m12 l6 offset-l3">
+          <form action="{{ .Data.action }}" method="POST">
+          <div class="card card-large app-card">
+            <div class="card-content">
+              <span class="card-title center-align">
+                <div class="section app-header">
+                  {{ if .LogoURL }}
+                  <img class="d-block mx-auto mb-2" src="{{ .LogoURL }}" alt="{{ .LogoDescription }}" width="72" height="72">
+                  {{ end }}
+                  <h4>{{ .Title }}</h4>
+                </div>
+              </span>
+              <p class="app-text">Your network address has changed. Please confirm your identity to continue your session as {{ .Data.username }}.</p>
+              <div class="input-field">
+                <input id="password" name="password" type="password" class="validate" autocomplete="current-password" {{ if not .Data.mfa_method }}required {{ end }}autofocus />
+                <label for="password">Password</label>
+              </div>
+              {{ if .Data.mfa_method }}
+              <p class="app-text">Alternatively, provide the code generated by your {{ .Data.mfa_method.Title }}.</p>
+              <div class="input-field">
+                <input id="code" name="code" type="text" inputmode="numeric" autocomplete="one-time-code" class="validate" />
+                <label for="code">Code</label>
+              </div>
+              {{ end }}
+            </div>
+            <div class="card-action right-align">
+              <a href="{{ pathjoin .ActionEndpoint "/logout" }}" class="navbtn-last">
+                <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                  <i class="las la-sign-out-alt left app-btn-icon"></i>
+                  <span class="app-btn-text">Sign Out</span>
+                </button>
+              </a>
+              <button type="submit" name="submit" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                <i class="las la-chevron-circle-right app-btn-icon"></i>
+                <span class="app-btn-text">Continue</span>
+              </button>
+            </div>
+          </div>
+          </form>
+        </div>
+      </div>
+    </div>
+
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
+    <!-- Optional JavaScript -->
+    <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
+    {{ if eq .Data.ui_options.custom_js_required "yes" }}
+    <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
+    {{ end }}
+    {{ if .Message }}
+    <script>
+    var toastHTML = '<span>{{ .Message }}</span><button class="btn-flat toast-action" onclick="M.Toast.dismissAll();">Close</button>';
+    toastElement = M.toast({
+      html: toastHTML,
+      classes: 'toast-error'
+    });
+    const appContainer = document.querySelector('.app-card-container')
+    appContainer.prepend(toastElement.el)
+    </script>
+    {{ end }}
+  </body>
+</html>`,
+	"basic/login_success": `<!doctype html>
+<html lang="en">
+  <head>
+    <title>{{ .Title }}</title>
+    <!-- Required meta tags -->
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <meta name="description" content="Authentication Portal">
+    <meta name="author" content="Paul Greenberg github.com/greenpau">
+    <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+    <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+    <!-- Matrialize CSS -->
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/materialize-css/css/materialize.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/roboto.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/line-awesome/line-awesome.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/styles.css" }}" />
+    {{ if eq .Data.ui_options.custom_css_required "yes" }}
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/custom.css" }}" />
+    {{ end }}
+  </head>
+  <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
+    <div class="container">
+      <div class="row">
+        <div class="col s12 m12 l6 offset-l3 app-card-container">
+          <div class="row app-header center">
+            {{ if .LogoURL }}
+            <div class="col">
+              <img class="d-block mx-auto mb-2" src="{{ .LogoURL }}" alt="{{ .LogoDescription }}" width="72" height="72">
+            </div>
+            <div class="col">
+              <h4>{{ .Title }}</h4>
+            </div>
+            {{ else }}
+              <h4>{{ .Title }}</h4>
+            {{ end }}
+          </div>
+          <div class="row">
+            <p>You are signed in as <b>{{ .Data.user_name }}</b>{{ if .Data.user_email }} ({{ .Data.user_email }}){{ end }}.</p>
+            {{ if .Data.expires_at_utc }}
+            <p>Your session expires on {{ .Data.expires_at_utc }}.</p>
+            {{ end }}
+          </div>
+          <div class="row right">
+            <a href="{{ .Data.destination }}">
+              <button type="button" class="btn waves-effect waves-light navbtn active">
+                <i class="las la-arrow-right left app-btn-icon"></i>
+                <span class="app-btn-text">Continue</span>
+              </button>
+            </a>
+            <a href="{{ pathjoin .ActionEndpoint "/logout" }}" class="navbtn-last">
+              <button type="button" class="btn waves-effect waves-light navbtn active navbtn-last">
+                <i class="las la-sign-out-alt left app-btn-icon"></i>
+                <span class="app-btn-text">Logout</span>
+              </button>
+            </a>
+          </div>
+        </div>
+      </div>
+    </div>
+
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
+    <!-- Optional JavaScript -->
+    <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
+    {{ if eq .Data.ui_options.custom_js_required "yes" }}
+    <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
+    {{ end }}
+  </body>
+</html>`,
+	"basic/password": `<!doctype html>
+<html lang="en">
+  <head>
+    <title>{{ .Title }}</title>
+    <!-- Required meta tags -->
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <meta name="description" content="Authentication Portal">
+    <meta name="author" content="Paul Greenberg github.com/greenpau">
+    <link rel="shortcut icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+    <link rel="icon" href="{{ pathjoin .ActionEndpoint "/assets/images/favicon.png" }}" type="image/png">
+
+		<!-- Matrialize CSS -->
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/materialize-css/css/materialize.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/google-webfonts/roboto.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/line-awesome/line-awesome.css" }}" />
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/styles.css" }}" />
+    {{ if eq .Data.ui_options.custom_css_required "yes" }}
+    <link rel="stylesheet" href="{{ pathjoin .ActionEndpoint "/assets/css/custom.css" }}" />
+    {{ end }}
+  </head>
+  <body class="app-body">
+    {{ if .Data.ui_options.custom_page_header }}
+    {{ .Data.ui_options.custom_page_header }}
+    {{ end }}
+    <div class="container">
+      <div class="row">
+        <div class="col s12 m12 l6 offset-l3">
+          {{ if eq .Data.step "change" }}
+          <form action="{{ .Data.action }}" method="POST">
+          {{ end }}
+          <div class="card card-large app-card">
+            <div class="card-content">
+              <span class="card-title center-align">
+                <div class="section app-header">
+                  {{ if .LogoURL }}
+                  <img class="d-block mx-auto mb-2" src="{{ .LogoURL }}" alt="{{ .LogoDescription }}" width="72" height="72">
+                  {{ end }}
+                  <h4>{{ .Title }}</h4>
+                </div>
+              </span>
+              {{ if eq .Data.step "change" }}
+              <p class="app-text">Your password has expired. Please provide your current password and the new password.</p>
+              <div class="input-field">
+                <input id="secret1" name="secret1" type="password" autocomplete="current-password" required autofocus />
+                <label for="secret1">Current Password</label>
+              </div>
+              <div class="input-field">
+                <input id="secret2" name="secret2" type="password" autocomplete="new-password" required />
+                <label for="secret2">New Password</label>
+              </div>
+              <div class="input-field">
+                <input id="secret3" name="secret3" type="password" autocomplete="new-password" required />
+                <label for="secret3">Confirm New Password</label>
+              </div>
+              {{ end }}
+              {{ if eq .Data.step "done" }}
+              <p class="app-text">Your password has been changed. Please sign in with the new password.</p>
+              {{ end }}
+            </div>
+            <div class="card-action right-align">
+              {{ if eq .Data.step "change" }}
+              <a href="{{ pathjoin .ActionEndpoint "/logout" }}" class="navbtn-last">
+                <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                  <i class="las la-undo left app-btn-icon"></i>
+                  <span class="app-btn-text">Cancel</span>
+                </button>
+              </a>
+              <button type="submit" name="submit" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                <i class="las la-paper-plane app-btn-icon"></i>
+                <span class="app-btn-text">Change Password</span>
+              </button>
+              {{ else }}
+              <a href="{{ .ActionEndpoint }}" class="navbtn-last">
+                <button type="button" class="waves-effect waves-light btn navbtn active navbtn-last app-btn">
+                  <i class="las la-sign-in-alt left app-btn-icon"></i>
+                  <span class="app-btn-text">Sign In</span>
+                </button>
+              </a>
+              {{ end }}
+            </div>
+          </div>
+          {{ if eq .Data.step "change" }}
+          </form>
+          {{ end }}
+        </div>
+      </div>
+    </div>
+
+    {{ if .Data.ui_options.custom_page_footer }}
+    {{ .Data.ui_options.custom_page_footer }}
+    {{ end }}
+    <!-- Optional JavaScript -->
+    <script src="{{ pathjoin .ActionEndpoint "/assets/materialize-css/js/materialize.js" }}"></script>
+    {{ if eq .Data.ui_options.custom_js_required "yes" }}
+    <script src="{{ pathjoin .ActionEndpoint "/assets/js/custom.js" }}"></script>
+    {{ end }}
+    {{ if .Message }}
+    <script>
+    var toastHTML = '<span>{{ .Message }}</span><button class="btn-flat toast-action" onclick="M.Toast.dismissAll();">Close</button>';
+    toastElement = M.toast({
+      html: toastHTML,
+      classes: 'toast-error'
+    });
+    const appContainer = document.querySelector('.app-card-container')
+    appContainer.prepend(toastElement.el)
+    </script>
+    {{ end }}
+  </body>
 </html>`,
 }
@@ -17,16 +17,26 @@ package ui
 // UserInterfaceParameters represent a common set of configuration settings
 // for HTML UI.
 type UserInterfaceParameters struct {
-	Theme                   string              `json:"theme,omitempty"`
-	Templates               map[string]string   `json:"templates,omitempty"`
-	AllowRoleSelection      bool                `json:"allow_role_selection,omitempty"`
-	Title                   string              `json:"title,omitempty"`
-	LogoURL                 string              `json:"logo_url,omitempty"`
-	LogoDescription         string              `json:"logo_description,omitempty"`
-	PrivateLinks            []UserInterfaceLink `json:"private_links,omitempty"`
-	AutoRedirectURL         string              `json:"auto_redirect_url"`
-	Realms                  []UserRealm         `json:"realms"`
-	PasswordRecoveryEnabled bool                `json:"password_recovery_enabled"`
-	CustomCSSPath           string              `json:"custom_css_path,omitempty"`
-	CustomJsPath            string              `json:"custom_js_path,omitempty"`
+	Theme                   string               `json:"theme,omitempty"`
+	Templates               map[string]string    `json:"templates,omitempty"`
+	AllowRoleSelection      bool                 `json:"allow_role_selection,omitempty"`
+	Title                   string               `json:"title,omitempty"`
+	LogoURL                 string               `json:"logo_url,omitempty"`
+	LogoDescription         string               `json:"logo_description,omitempty"`
+	PrivateLinks            []UserInterfaceLink  `json:"private_links,omitempty"`
+	AutoRedirectURL         string               `json:"auto_redirect_url"`
+	Realms                  []UserRealm          `json:"realms"`
+	PasswordRecoveryEnabled bool                 `json:"password_recovery_enabled"`
+	CustomCSSPath           string               `json:"custom_css_path,omitempty"`
+	CustomJsPath            string               `json:"custom_js_path,omitempty"`
+	CustomPageHeaderPath    string               `json:"custom_page_header_path,omitempty"`
+	CustomPageFooterPath    string               `json:"custom_page_footer_path,omitempty"`
+	StaticAssetMaxAge       int                  `json:"static_asset_max_age,omitempty"`
+	LoginHintParameter      string               `json:"login_hint_parameter,omitempty"`
+	LoginSuccess            string               `json:"login_success,omitempty"`
+	FallbackMessage         string               `json:"fallback_message,omitempty"`
+	SingleProviderRedirect  string               `json:"single_provider_redirect,omitempty"`
+	LoginInstructions       []*LoginInstructions `json:"login_instructions,omitempty"`
+	SessionExpiryMeta       string               `json:"session_expiry_meta,omitempty"`
+	Rollout                 *TemplateRollout     `json:"rollout,omitempty"`
 }
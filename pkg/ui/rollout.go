@@ -0,0 +1,96 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// TemplateRollout represents a common set of configuration settings for
+// the gradual rollout of new templates. A percentage of the users gets
+// the variant templates, while the others get the current ones.
+type TemplateRollout struct {
+	// The percentage of the users getting the variant templates.
+	Percent int `json:"percent,omitempty"`
+	// The value identifying the users, i.e. session or ip.
+	Key string `json:"key,omitempty"`
+	// The paths of the variant templates, keyed by the template name.
+	Templates map[string]string `json:"templates,omitempty"`
+}
+
+// Configure validates the rollout and sets default values.
+func (r *TemplateRollout) Configure() error {
+	if r.Percent < 0 || r.Percent > 100 {
+		return fmt.Errorf("ui rollout percent must be between 0 and 100, got %d", r.Percent)
+	}
+	switch r.Key {
+	case "":
+		r.Key = "ip"
+	case "ip", "session":
+	default:
+		return fmt.Errorf("ui rollout key is unsupported: %s", r.Key)
+	}
+	if len(r.Templates) == 0 {
+		return fmt.Errorf("ui rollout has no variant templates")
+	}
+	return nil
+}
+
+// AddRollout provisions the variant of the factory having the templates
+// of the rollout. It must be called after the factory is set up.
+func (f *UserInterfaceFactory) AddRollout(rollout *TemplateRollout) error {
+	variant := *f
+	variant.Templates = make(map[string]*UserInterfaceTemplate)
+	for name, tmpl := range f.Templates {
+		variant.Templates[name] = tmpl
+	}
+	for name, tmplPath := range rollout.Templates {
+		if _, exists := f.Templates[name]; !exists {
+			return fmt.Errorf("ui rollout template %s does not replace existing template", name)
+		}
+		tmpl, err := NewUserInterfaceTemplate(name, tmplPath)
+		if err != nil {
+			return err
+		}
+		variant.Templates[name] = tmpl
+	}
+	f.rollout = rollout
+	f.variant = &variant
+	return nil
+}
+
+// ForKey returns the variant of the factory when the key falls within
+// the rollout percentage. The same key always gets the same factory.
+func (f *UserInterfaceFactory) ForKey(key string) *UserInterfaceFactory {
+	if f.variant == nil || key == "" {
+		return f
+	}
+	sum := sha256.Sum256([]byte(key))
+	if int(binary.BigEndian.Uint32(sum[:4])%100) < f.rollout.Percent {
+		return f.variant
+	}
+	return f
+}
+
+// GetRolloutKey returns the type of the value identifying the users
+// of the rollout, if any.
+func (f *UserInterfaceFactory) GetRolloutKey() string {
+	if f.rollout == nil {
+		return ""
+	}
+	return f.rollout.Key
+}
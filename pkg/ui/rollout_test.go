@@ -0,0 +1,94 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplateRollout(t *testing.T) {
+	testFailed := 0
+	dir, err := ioutil.TempDir("", "ui-rollout")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	variantPath := filepath.Join(dir, "login.template")
+	if err := ioutil.WriteFile(variantPath, []byte(`new login`), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := NewUserInterfaceFactory()
+	if err := f.AddBuiltinTemplate("basic/login"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f.Templates["login"] = f.Templates["basic/login"]
+	rollout := &TemplateRollout{Percent: 30, Templates: map[string]string{"login": variantPath}}
+	if err := rollout.Configure(); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	if err := f.AddRollout(rollout); err != nil {
+		t.Fatalf("unexpected rollout error: %s", err)
+	}
+
+	var variants int
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		selected := f.ForKey(key)
+		if selected != f.ForKey(key) {
+			t.Logf("FAIL: key %s, expected consistent variant", key)
+			testFailed++
+		}
+		if selected != f {
+			variants++
+			b, err := selected.Render("login", selected.GetArgs())
+			if err != nil || b.String() != "new login" {
+				t.Logf("FAIL: key %s, expected variant template, received: %v, %v", key, b, err)
+				testFailed++
+			}
+		}
+	}
+	if variants < 250 || variants > 350 {
+		t.Logf("FAIL: expected about 300 variants, received: %d", variants)
+		testFailed++
+	}
+	if f.ForKey("") != f {
+		t.Logf("FAIL: empty key, expected current templates")
+		testFailed++
+	}
+	if err := f.AddRollout(&TemplateRollout{Templates: map[string]string{"portal": variantPath}}); err == nil {
+		t.Logf("FAIL: unknown template, expected error")
+		testFailed++
+	}
+
+	for _, rollout := range []*TemplateRollout{
+		{Percent: 101, Templates: map[string]string{"login": variantPath}},
+		{Percent: 10, Key: "user", Templates: map[string]string{"login": variantPath}},
+		{Percent: 10},
+	} {
+		if err := rollout.Configure(); err == nil {
+			t.Logf("FAIL: rollout %v, expected error", rollout)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"time"
 )
 
 // StaticAssets is an instance of StaticAssetLibrary.
@@ -33,6 +35,7 @@ type StaticAsset struct {
 	Content        string
 	EncodedContent string
 	Checksum       string
+	ModTime        time.Time
 }
 
 // StaticAssetLibrary contains a collection of static assets.
@@ -52,6 +55,8 @@ func init() {
 func NewStaticAssetLibrary() (*StaticAssetLibrary, error) {
 	sal := &StaticAssetLibrary{}
 	sal.items = make(map[string]*StaticAsset)
+	// The built-in assets change only when the plugin changes.
+	modTime := time.Now().UTC().Truncate(time.Second)
 	for path, item := range defaultStaticAssets {
 		s, err := base64.StdEncoding.DecodeString(item.EncodedContent)
 		if err != nil {
@@ -61,6 +66,7 @@ func NewStaticAssetLibrary() (*StaticAssetLibrary, error) {
 		h := sha1.New()
 		io.WriteString(h, item.Content)
 		item.Checksum = base64.URLEncoding.EncodeToString(h.Sum(nil))
+		item.ModTime = modTime
 		sal.items[path] = item
 	}
 	return sal, nil
@@ -80,10 +86,15 @@ func (sal *StaticAssetLibrary) AddAsset(path, contentType, fsPath string) error
 	if err != nil {
 		return fmt.Errorf("failed to load asset file %s: %s", fsPath, err)
 	}
+	fileInfo, err := os.Stat(fsPath)
+	if err != nil {
+		return fmt.Errorf("failed to load asset file %s: %s", fsPath, err)
+	}
 	item := &StaticAsset{
 		Path:           path,
 		ContentType:    contentType,
 		EncodedContent: base64.StdEncoding.EncodeToString(rawContent),
+		ModTime:        fileInfo.ModTime().UTC().Truncate(time.Second),
 	}
 	s, err := base64.StdEncoding.DecodeString(item.EncodedContent)
 	if err != nil {
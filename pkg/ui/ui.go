@@ -50,6 +50,28 @@ type UserInterfaceFactory struct {
 	ActionEndpoint string `json:"-"`
 	CustomCSSPath  string `json:"custom_css_path,omitempty"`
 	CustomJsPath   string `json:"custom_js_path,omitempty"`
+	// The HTML fragments added to the top and the bottom of the body
+	// of every page. They are not escaped.
+	CustomPageHeader string `json:"-"`
+	CustomPageFooter string `json:"-"`
+	// The name of the query parameter pre-filling the username field
+	// of the login form.
+	LoginHintParameter string `json:"login_hint_parameter,omitempty"`
+	// When enabled, the users arriving at the login page without a
+	// redirect URL see the success page after the login, instead of
+	// being redirected to the portal.
+	LoginSuccessPage bool `json:"login_success_page,omitempty"`
+	// The message of the page displayed when a template fails to render.
+	FallbackMessage string `json:"fallback_message,omitempty"`
+	// When enabled, the login page redirects the users to the external
+	// provider when it is the only way to log in.
+	SingleProviderRedirect bool `json:"single_provider_redirect,omitempty"`
+	// When enabled, the authenticated pages carry the expiry of the
+	// session in the session-expires-at meta tag.
+	SessionExpiryMeta bool `json:"session_expiry_meta,omitempty"`
+	// The gradual rollout of the variant templates.
+	rollout *TemplateRollout
+	variant *UserInterfaceFactory
 }
 
 // UserInterfaceTemplate represents a user interface instance, e.g. a single
@@ -172,6 +194,12 @@ func (f *UserInterfaceFactory) GetArgs() *UserInterfaceArgs {
 	} else {
 		uiOptions["custom_js_required"] = "no"
 	}
+	if f.CustomPageHeader != "" {
+		uiOptions["custom_page_header"] = f.CustomPageHeader
+	}
+	if f.CustomPageFooter != "" {
+		uiOptions["custom_page_footer"] = f.CustomPageFooter
+	}
 	args.Data["ui_options"] = uiOptions
 	return args
 }
@@ -241,7 +269,7 @@ func (f *UserInterfaceFactory) Render(name string, args *UserInterfaceArgs) (*by
 	b := bytes.NewBuffer(nil)
 	err := f.Templates[name].Template.Execute(b, args)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("template %s rendering failed: %s", name, err)
 	}
 	return b, nil
 }
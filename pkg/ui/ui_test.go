@@ -16,6 +16,8 @@ package ui
 
 import (
 	"bytes"
+	"fmt"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -140,3 +142,94 @@ func TestAddBuiltinTemplates(t *testing.T) {
 		t.Fatalf("Expected success, but got error: %s", err)
 	}
 }
+
+func TestGetLoginHint(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		parameter string
+		query     string
+		expected  string
+	}{
+		{parameter: DefaultLoginHintParameter, query: "login_hint=jsmith%40contoso.com", expected: "jsmith@contoso.com"},
+		{parameter: DefaultLoginHintParameter, query: "login_hint=%22%3E%3Cscript%3E", expected: "&#34;&gt;&lt;script&gt;"},
+		{parameter: DefaultLoginHintParameter, query: "login_hint=jsmith%0A", expected: "jsmith"},
+		{parameter: DefaultLoginHintParameter, query: "login_hint=j%00smith", expected: ""},
+		{parameter: DefaultLoginHintParameter, query: "login_hint=" + strings.Repeat("a", 257), expected: ""},
+		{parameter: DefaultLoginHintParameter, query: "username=jsmith", expected: ""},
+		{parameter: "username", query: "username=jsmith", expected: "jsmith"},
+		{parameter: "", query: "login_hint=jsmith", expected: ""},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, parameter: %s, query: %s", i, test.parameter, test.query)
+		f := NewUserInterfaceFactory()
+		f.LoginHintParameter = test.parameter
+		r := httptest.NewRequest("GET", "/auth?"+test.query, nil)
+		hint := f.GetLoginHint(r)
+		if hint != test.expected {
+			t.Logf("FAIL: %s, expected: %q, received: %q", testDescr, test.expected, hint)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
+
+func TestLoginInstructions(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		instructions *LoginInstructions
+		text         string
+		helpURL      string
+		shouldFail   bool
+	}{
+		{
+			instructions: &LoginInstructions{Realm: "ldap", Text: "Use your corporate email and AD password"},
+			text:         "Use your corporate email and AD password",
+		},
+		{
+			instructions: &LoginInstructions{Realm: "ldap", Text: "<script>alert(1)</script>", HelpURL: "https://help.contoso.com/?a=1&b=2"},
+			text:         "&lt;script&gt;alert(1)&lt;/script&gt;",
+			helpURL:      "https://help.contoso.com/?a=1&amp;b=2",
+		},
+		{
+			instructions: &LoginInstructions{Realm: "local", HelpURL: "/help"},
+			helpURL:      "/help",
+		},
+		{instructions: &LoginInstructions{Realm: "local"}, shouldFail: true},
+		{instructions: &LoginInstructions{Realm: "local", Text: "line\nbreak"}, shouldFail: true},
+		{instructions: &LoginInstructions{Realm: "local", Text: strings.Repeat("a", 1025)}, shouldFail: true},
+		{instructions: &LoginInstructions{Realm: "local", Text: "Help", HelpURL: "javascript:alert(1)"}, shouldFail: true},
+		{instructions: &LoginInstructions{Realm: "local", Text: "Help", HelpURL: "//evil.com/"}, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, text: %q, help url: %q", i, test.instructions.Text, test.instructions.HelpURL)
+		text, helpURL, err := test.instructions.Sanitize()
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+			t.Logf("PASS: %s", testDescr)
+			continue
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if text != test.text || helpURL != test.helpURL {
+			t.Logf("FAIL: %s, mismatch: %q, %q (expected) vs. %q, %q (received)", testDescr, test.text, test.helpURL, text, helpURL)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unsupported
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var supportedFlows = map[string]bool{
+	"register":        true,
+	"recover":         true,
+	"mfa":             true,
+	"password_change": true,
+}
+
+// Response is the response to the requests for a flow the portal does
+// not support, e.g. the account recovery when it is not configured.
+type Response struct {
+	// The name of the flow, i.e. register, recover, mfa, or
+	// password_change. The recover flow covers the forgot path.
+	Flow string `json:"flow,omitempty"`
+	// The URL the users are redirected to, e.g. an external help desk.
+	RedirectURL string `json:"redirect_url,omitempty"`
+	// The message displayed on the Unsupported Feature page.
+	Message string `json:"message,omitempty"`
+}
+
+// Responses holds the responses to the unsupported flows.
+type Responses struct {
+	Entries []*Response `json:"entries,omitempty"`
+	flows   map[string]*Response
+}
+
+// Configure validates the responses.
+func (rs *Responses) Configure() error {
+	rs.flows = make(map[string]*Response)
+	for _, entry := range rs.Entries {
+		if !supportedFlows[entry.Flow] {
+			return fmt.Errorf("flow %q does not support custom responses", entry.Flow)
+		}
+		if _, exists := rs.flows[entry.Flow]; exists {
+			return fmt.Errorf("unsupported flow %s has multiple responses", entry.Flow)
+		}
+		if entry.RedirectURL == "" && entry.Message == "" {
+			return fmt.Errorf("unsupported flow %s has neither redirect url nor message", entry.Flow)
+		}
+		if entry.RedirectURL != "" {
+			if err := validateRedirectURL(entry.RedirectURL); err != nil {
+				return fmt.Errorf("unsupported flow %s redirect url is invalid: %s", entry.Flow, err)
+			}
+		}
+		rs.flows[entry.Flow] = entry
+	}
+	return nil
+}
+
+// Enabled returns true when any response is configured.
+func (rs *Responses) Enabled() bool {
+	if rs == nil {
+		return false
+	}
+	return len(rs.flows) > 0
+}
+
+// Get returns the response to the flow, or nil when the flow has none.
+func (rs *Responses) Get(flow string) *Response {
+	if rs == nil {
+		return nil
+	}
+	return rs.flows[flow]
+}
+
+func validateRedirectURL(s string) error {
+	if strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("host not found")
+	}
+	return nil
+}
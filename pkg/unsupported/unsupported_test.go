@@ -0,0 +1,85 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unsupported
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConfigure(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		entries    []*Response
+		flow       string
+		expected   *Response
+		shouldFail bool
+	}{
+		{
+			entries: []*Response{
+				{Flow: "recover", RedirectURL: "https://helpdesk.contoso.com/password-reset"},
+				{Flow: "register", Message: "Please contact IT to request an account"},
+			},
+			flow:     "recover",
+			expected: &Response{Flow: "recover", RedirectURL: "https://helpdesk.contoso.com/password-reset"},
+		},
+		{
+			entries:  []*Response{{Flow: "register", RedirectURL: "/signup"}},
+			flow:     "mfa",
+			expected: nil,
+		},
+		{entries: []*Response{{Flow: "logout", Message: "foo"}}, shouldFail: true},
+		{entries: []*Response{{Flow: "recover"}}, shouldFail: true},
+		{entries: []*Response{{Flow: "recover", RedirectURL: "javascript:alert(1)"}}, shouldFail: true},
+		{entries: []*Response{{Flow: "recover", RedirectURL: "//evil.com"}}, shouldFail: true},
+		{entries: []*Response{{Flow: "recover", Message: "foo"}, {Flow: "recover", Message: "bar"}}, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d", i)
+		rs := &Responses{Entries: test.entries}
+		err := rs.Configure()
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+			} else {
+				t.Logf("PASS: %s, error: %s", testDescr, err)
+			}
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		resp := rs.Get(test.flow)
+		if (resp == nil) != (test.expected == nil) || (resp != nil && *resp != *test.expected) {
+			t.Logf("FAIL: %s, expected: %v, received: %v", testDescr, test.expected, resp)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	var rs *Responses
+	if rs.Enabled() || rs.Get("recover") != nil {
+		t.Logf("FAIL: nil responses must be disabled")
+		testFailed++
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
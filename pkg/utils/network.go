@@ -0,0 +1,83 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseNetworks parses the addresses and the networks in CIDR notation.
+// The addresses without the prefix length are single host networks.
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ContainsIP returns true when one of the networks contains the address.
+func ContainsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTrustedSourceAddress returns the source address of the request. The
+// forwarding headers are taken into account only when the request came
+// from a trusted proxy, because the clients control them. The address
+// is the rightmost X-Forwarded-For entry not belonging to a trusted
+// proxy.
+func GetTrustedSourceAddress(r *http.Request, proxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ContainsIP(proxies, ip) {
+		return ip
+	}
+	if v := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); v != nil {
+		return v
+	}
+	entries := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		v := net.ParseIP(strings.TrimSpace(entries[i]))
+		if v == nil {
+			break
+		}
+		ip = v
+		if !ContainsIP(proxies, v) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetTrustedSourceAddress(t *testing.T) {
+	testFailed := 0
+	proxies, err := ParseNetworks([]string{"172.16.0.1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tests := []struct {
+		remoteAddr   string
+		realIP       string
+		forwardedFor string
+		result       string
+	}{
+		{remoteAddr: "8.8.8.8:5000", result: "8.8.8.8"},
+		{remoteAddr: "8.8.8.8:5000", realIP: "1.2.3.4", result: "8.8.8.8"},
+		{remoteAddr: "8.8.8.8:5000", forwardedFor: "1.2.3.4", result: "8.8.8.8"},
+		{remoteAddr: "172.16.0.1:5000", result: "172.16.0.1"},
+		{remoteAddr: "172.16.0.1:5000", realIP: "1.2.3.4", result: "1.2.3.4"},
+		{remoteAddr: "172.16.0.1:5000", forwardedFor: "1.2.3.4", result: "1.2.3.4"},
+		{remoteAddr: "172.16.0.1:5000", forwardedFor: "5.6.7.8, 1.2.3.4", result: "1.2.3.4"},
+		{remoteAddr: "172.16.0.1:5000", forwardedFor: "5.6.7.8, 1.2.3.4, 10.1.1.1", result: "1.2.3.4"},
+		{remoteAddr: "172.16.0.1:5000", forwardedFor: "garbage, 10.1.1.1", result: "10.1.1.1"},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, remote: %s, real ip: %s, forwarded for: %s", i, test.remoteAddr, test.realIP, test.forwardedFor)
+		r := httptest.NewRequest("GET", "/auth", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.realIP != "" {
+			r.Header.Set("X-Real-Ip", test.realIP)
+		}
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if addr := GetTrustedSourceAddress(r, proxies).String(); addr != test.result {
+			t.Logf("FAIL: %s, expected: %s, received: %s", testDescr, test.result, addr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPasswordBreachURL is the default URL of the range API of the
+	// Have I Been Pwned Passwords service.
+	DefaultPasswordBreachURL = "https://api.pwnedpasswords.com/range/"
+	// DefaultPasswordBreachTimeout is the default number of milliseconds
+	// the portal waits for the range API response.
+	DefaultPasswordBreachTimeout = 3000
+)
+
+// BreachCheck represents a common set of configuration settings
+// for the rejection of the passwords found in known data breaches. The
+// check uses the k-anonymity model of the Have I Been Pwned range API:
+// the portal sends the first five characters of the SHA-1 hash of the
+// password and searches the returned hash suffixes locally, so that
+// neither the password nor its full hash leaves the portal.
+type BreachCheck struct {
+	// The URL of the range API. The hash prefix is appended to it.
+	URL string `json:"url,omitempty"`
+	// The number of milliseconds the portal waits for the response.
+	Timeout int `json:"timeout,omitempty"`
+	// The switch determining whether the passwords are accepted when the
+	// range API is unavailable or responds with an error.
+	FailOpen bool `json:"fail_open,omitempty"`
+	client   *http.Client
+}
+
+// Configure validates the URL and sets default values.
+func (c *BreachCheck) Configure() error {
+	if c.URL == "" {
+		c.URL = DefaultPasswordBreachURL
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("password breach check url is invalid: %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("password breach check url scheme is unsupported: %s", u.Scheme)
+	}
+	if c.Timeout < 1 {
+		c.Timeout = DefaultPasswordBreachTimeout
+	}
+	c.client = &http.Client{
+		Timeout: time.Duration(c.Timeout) * time.Millisecond,
+	}
+	return nil
+}
+
+// Enabled returns true when the check is configured.
+func (c *BreachCheck) Enabled() bool {
+	return c != nil && c.client != nil
+}
+
+// IsBreached returns true when the password appears in known data
+// breaches. It returns an error when the range API is unavailable.
+func (c *BreachCheck) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequest("GET", c.URL+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// The padding hides the number of suffixes sharing the prefix from
+	// the observers of the response size.
+	req.Header.Set("Add-Padding", "true")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("password breach check returned unexpected status code %d", resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		kv := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(kv) != 2 || !strings.EqualFold(kv[0], suffix) {
+			continue
+		}
+		// The padding entries have zero occurrences.
+		count, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return false, fmt.Errorf("password breach check returned malformed response")
+		}
+		return count > 0, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, nil
+}
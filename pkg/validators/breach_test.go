@@ -0,0 +1,95 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBreachCheck(t *testing.T) {
+	testFailed := 0
+	var prefixes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Path[len("/range/"):]
+		prefixes = append(prefixes, prefix)
+		switch prefix {
+		case "5BAA6":
+			// The SHA-1 hash of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+			fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n")
+		case "B7A87":
+			// The padding entry matching the hash of "letmein".
+			fmt.Fprint(w, "5FC1EA228B9061041B7CEC4BD3C52AB3CE3:0\r\n")
+		case "D033E":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n")
+		}
+	}))
+	defer srv.Close()
+
+	c := &BreachCheck{URL: srv.URL + "/range/"}
+	if err := c.Configure(); err != nil {
+		t.Fatalf("failed configuring password breach check: %s", err)
+	}
+
+	tests := []struct {
+		password   string
+		breached   bool
+		shouldFail bool
+	}{
+		{password: "password", breached: true},
+		{password: "letmein", breached: false},
+		{password: "admin", shouldFail: true},
+		{password: "b6a7d3a1-0c35-4d69-8e8c-f7fd1a2b3c4d", breached: false},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, password: %s", i, test.password)
+		breached, err := c.IsBreached(test.password)
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+			} else {
+				t.Logf("PASS: %s, expected error: %s", testDescr, err)
+			}
+			continue
+		}
+		if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		if breached != test.breached {
+			t.Logf("FAIL: %s, breached: %t (expected) vs. %t (received)", testDescr, test.breached, breached)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	for _, prefix := range prefixes {
+		if len(prefix) != 5 {
+			t.Logf("FAIL: the request carried more than the hash prefix: %s", prefix)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
@@ -52,6 +52,12 @@ func ValidateUserInput(k, v string, opts map[string]interface{}) error {
 
 // ValidateUserInputHandle validates provided user handle.
 func ValidateUserInputHandle(v string, opts map[string]interface{}) error {
+	if policy, exists := opts["username_policy"]; exists && policy != nil {
+		if err := policy.(*UsernamePolicy).Validate(v); err != nil {
+			return fmt.Errorf("to invalid username: %s", err)
+		}
+		return nil
+	}
 	if len(v) > 25 {
 		return fmt.Errorf("the handle character length should not exceed 25 characters")
 	}
@@ -0,0 +1,113 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultUsernameMinLength = 3
+	defaultUsernameMaxLength = 25
+	defaultUsernamePattern   = "[a-z0-9]+"
+	// maxUsernameLength is the upper bound of the configurable maximum
+	// username length.
+	maxUsernameLength = 255
+)
+
+// UsernamePolicy represents a common set of configuration settings for
+// the validation of usernames.
+type UsernamePolicy struct {
+	// The minimum number of characters, 3 by default.
+	MinLength int `json:"min_length,omitempty"`
+	// The maximum number of characters, 25 by default.
+	MaxLength int `json:"max_length,omitempty"`
+	// The regular expression the whole username must match. By default,
+	// the usernames consist of lowercase letters and digits.
+	Pattern string `json:"pattern,omitempty"`
+	// When enabled, the login attempts with out-of-policy usernames are
+	// rejected before reaching the authentication backends.
+	EnforceAtLogin bool `json:"enforce_at_login,omitempty"`
+	regex          *regexp.Regexp
+}
+
+// Configure validates the policy and applies the defaults.
+func (p *UsernamePolicy) Configure() error {
+	if p.MinLength < 0 || p.MaxLength < 0 {
+		return fmt.Errorf("username length must not be negative")
+	}
+	if p.MinLength == 0 {
+		p.MinLength = defaultUsernameMinLength
+	}
+	if p.MaxLength == 0 {
+		p.MaxLength = defaultUsernameMaxLength
+	}
+	if p.MaxLength > maxUsernameLength {
+		return fmt.Errorf("username max length must not exceed %d characters", maxUsernameLength)
+	}
+	if p.MinLength > p.MaxLength {
+		return fmt.Errorf("username min length %d exceeds max length %d", p.MinLength, p.MaxLength)
+	}
+	if p.Pattern == "" {
+		p.Pattern = defaultUsernamePattern
+	}
+	regex, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+	if err != nil {
+		return fmt.Errorf("username pattern %q is invalid: %s", p.Pattern, err)
+	}
+	p.regex = regex
+	return nil
+}
+
+// Validate returns an error when the username is out of policy.
+func (p *UsernamePolicy) Validate(v string) error {
+	if v == "" {
+		return fmt.Errorf("the username is empty")
+	}
+	if !utf8.ValidString(v) {
+		return fmt.Errorf("the username is not valid UTF-8")
+	}
+	if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+		return fmt.Errorf("the username contains control characters")
+	}
+	n := utf8.RuneCountInString(v)
+	if n < p.MinLength {
+		return fmt.Errorf("the username must be at least %d characters long", p.MinLength)
+	}
+	if n > p.MaxLength {
+		return fmt.Errorf("the username must not exceed %d characters", p.MaxLength)
+	}
+	if p.regex != nil && !p.regex.MatchString(v) {
+		return fmt.Errorf("the username contains characters outside of the allowed pattern")
+	}
+	return nil
+}
+
+// ValidateLogin returns an error when the username submitted at login is
+// out of policy. The email addresses are validated as such, because the
+// users may sign in with them.
+func (p *UsernamePolicy) ValidateLogin(v string) error {
+	if strings.Contains(v, "@") {
+		if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return fmt.Errorf("the username contains control characters")
+		}
+		return ValidateUserInputEmail(v, nil)
+	}
+	return p.Validate(v)
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validators
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUsernamePolicy(t *testing.T) {
+	testFailed := 0
+	tests := []struct {
+		policy     *UsernamePolicy
+		username   string
+		login      bool
+		shouldFail bool
+	}{
+		{policy: &UsernamePolicy{}, username: "jsmith"},
+		{policy: &UsernamePolicy{}, username: "", shouldFail: true},
+		{policy: &UsernamePolicy{}, username: "js", shouldFail: true},
+		{policy: &UsernamePolicy{}, username: "jsm"},
+		{policy: &UsernamePolicy{}, username: strings.Repeat("a", 25)},
+		{policy: &UsernamePolicy{}, username: strings.Repeat("a", 26), shouldFail: true},
+		{policy: &UsernamePolicy{}, username: "JSmith", shouldFail: true},
+		{policy: &UsernamePolicy{}, username: "j\x00smith", shouldFail: true},
+		{policy: &UsernamePolicy{}, username: "jsmith\n", shouldFail: true},
+		{policy: &UsernamePolicy{MinLength: 1, MaxLength: 4}, username: "j"},
+		{policy: &UsernamePolicy{MinLength: 1, MaxLength: 4}, username: "jsmit", shouldFail: true},
+		{policy: &UsernamePolicy{Pattern: `[a-z][a-z0-9._-]*`}, username: "j.smith"},
+		{policy: &UsernamePolicy{Pattern: `[a-z][a-z0-9._-]*`}, username: "1smith", shouldFail: true},
+		{policy: &UsernamePolicy{Pattern: `[a-z]+`}, username: "jsmith1", shouldFail: true},
+		{policy: &UsernamePolicy{MaxLength: 8}, username: "jsmith@contoso.com", login: true},
+		{policy: &UsernamePolicy{}, username: "jsmith@contoso.com\r", login: true, shouldFail: true},
+		{policy: &UsernamePolicy{}, username: "JSmith", login: true, shouldFail: true},
+	}
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, policy: %+v, username: %q, login: %t", i, test.policy, test.username, test.login)
+		if err := test.policy.Configure(); err != nil {
+			t.Fatalf("FAIL: %s, unexpected configuration error: %s", testDescr, err)
+		}
+		var err error
+		if test.login {
+			err = test.policy.ValidateLogin(test.username)
+		} else {
+			err = test.policy.Validate(test.username)
+		}
+		if err != nil {
+			if !test.shouldFail {
+				t.Logf("FAIL: %s, unexpected error: %s", testDescr, err)
+				testFailed++
+				continue
+			}
+		} else if test.shouldFail {
+			t.Logf("FAIL: %s, expected error", testDescr)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	for i, policy := range []*UsernamePolicy{
+		{MinLength: -1},
+		{MinLength: 10, MaxLength: 5},
+		{MaxLength: 256},
+		{Pattern: "[a-z"},
+	} {
+		if err := policy.Configure(); err == nil {
+			t.Logf("FAIL: Test %d, policy: %+v, expected configuration error", i, policy)
+			testFailed++
+		}
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
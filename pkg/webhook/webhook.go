@@ -0,0 +1,194 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+// DefaultTimeout is the default number of milliseconds the portal waits
+// for the webhook response.
+const DefaultTimeout = 3000
+
+// protectedClaims are the claims the webhook must not change.
+var protectedClaims = map[string]bool{
+	"aud":  true,
+	"exp":  true,
+	"jti":  true,
+	"iat":  true,
+	"iss":  true,
+	"nbf":  true,
+	"sub":  true,
+	"addr": true,
+}
+
+// Webhook represent a common set of configuration settings for the
+// webhook validating the claims of authenticated users before the portal
+// issues a token.
+type Webhook struct {
+	// The URL receiving the proposed claims via HTTP POST.
+	URL string `json:"url,omitempty"`
+	// The number of milliseconds the portal waits for the response.
+	Timeout int `json:"timeout,omitempty"`
+	// The switch determining whether the login proceeds when the webhook
+	// is unavailable or responds with an error.
+	FailOpen bool `json:"fail_open,omitempty"`
+	client   *http.Client
+}
+
+// Request is the payload the portal sends to the webhook.
+type Request struct {
+	Realm        string                 `json:"realm,omitempty"`
+	Claims       *jwtclaims.UserClaims  `json:"claims,omitempty"`
+	CustomClaims map[string]interface{} `json:"custom_claims,omitempty"`
+}
+
+// Response is the decision of the webhook. The claims, if any, replace
+// the proposed claims.
+type Response struct {
+	Allow  bool                   `json:"allow"`
+	Reason string                 `json:"reason,omitempty"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// Configure validates the URL and sets default values.
+func (wh *Webhook) Configure() error {
+	if wh.URL == "" {
+		return fmt.Errorf("webhook has no url")
+	}
+	u, err := url.Parse(wh.URL)
+	if err != nil {
+		return fmt.Errorf("webhook url is invalid: %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook url scheme is unsupported: %s", u.Scheme)
+	}
+	if wh.Timeout < 1 {
+		wh.Timeout = DefaultTimeout
+	}
+	wh.client = &http.Client{
+		Timeout: time.Duration(wh.Timeout) * time.Millisecond,
+	}
+	return nil
+}
+
+// Validate sends the proposed claims to the webhook and applies the
+// changes, if any, to the claims. It returns the updated custom claims.
+// It returns DenyError when the webhook denies the login, and other
+// errors when the webhook fails.
+func (wh *Webhook) Validate(realm string, claims *jwtclaims.UserClaims, customClaims map[string]interface{}) (map[string]interface{}, error) {
+	if wh == nil || wh.URL == "" {
+		return customClaims, nil
+	}
+	resp, err := wh.call(&Request{
+		Realm:        realm,
+		Claims:       claims,
+		CustomClaims: customClaims,
+	})
+	if err != nil {
+		return customClaims, err
+	}
+	if !resp.Allow {
+		if resp.Reason != "" {
+			return customClaims, &DenyError{Reason: resp.Reason}
+		}
+		return customClaims, &DenyError{Reason: "denied by policy"}
+	}
+	return applyClaims(claims, customClaims, resp.Claims), nil
+}
+
+func (wh *Webhook) call(req *Request) (*Response, error) {
+	if wh.client == nil {
+		return nil, fmt.Errorf("webhook is not configured")
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("webhook request encoding failed: %s", err)
+	}
+	httpResp, err := wh.client.Post(wh.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("webhook request failed: %s", err)
+	}
+	defer httpResp.Body.Close()
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("webhook response read failed: %s", err)
+	}
+	if httpResp.StatusCode != 200 {
+		return nil, fmt.Errorf("webhook responded with status code %d", httpResp.StatusCode)
+	}
+	resp := &Response{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, fmt.Errorf("webhook response decoding failed: %s", err)
+	}
+	return resp, nil
+}
+
+// DenyError is the error returned when the webhook denies the login.
+type DenyError struct {
+	Reason string
+}
+
+func (e *DenyError) Error() string {
+	return "webhook denied login: " + e.Reason
+}
+
+// applyClaims replaces the name, email, origin, and roles claims and
+// the custom claims with the ones from the webhook response.
+func applyClaims(claims *jwtclaims.UserClaims, customClaims map[string]interface{}, m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		if protectedClaims[k] {
+			continue
+		}
+		switch k {
+		case "name":
+			if s, ok := v.(string); ok {
+				claims.Name = s
+			}
+		case "email":
+			if s, ok := v.(string); ok {
+				claims.Email = s
+			}
+		case "origin":
+			if s, ok := v.(string); ok {
+				claims.Origin = s
+			}
+		case "roles":
+			if entries, ok := v.([]interface{}); ok {
+				var roles []string
+				for _, entry := range entries {
+					if role, ok := entry.(string); ok {
+						roles = append(roles, role)
+					}
+				}
+				claims.Roles = roles
+			}
+		default:
+			if customClaims == nil {
+				customClaims = make(map[string]interface{})
+			}
+			customClaims[k] = v
+		}
+	}
+	return customClaims
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	jwtclaims "github.com/greenpau/caddy-auth-jwt/pkg/claims"
+)
+
+func TestValidate(t *testing.T) {
+	testFailed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &Request{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		resp := &Response{Allow: true}
+		switch req.Claims.Subject {
+		case "jsmith":
+			resp.Claims = map[string]interface{}{
+				"roles":      []string{"viewer", "editor"},
+				"sub":        "admin",
+				"department": "IT",
+			}
+		case "mallory":
+			resp.Allow = false
+			resp.Reason = "user is suspended"
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		case "broken":
+			w.WriteHeader(500)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	wh := &Webhook{URL: server.URL, Timeout: 100}
+	if err := wh.Configure(); err != nil {
+		t.Fatalf("failed configuring webhook: %s", err)
+	}
+
+	tests := []struct {
+		subject      string
+		roles        []string
+		customClaims map[string]interface{}
+		denied       bool
+		failed       bool
+	}{
+		{
+			subject:      "jsmith",
+			roles:        []string{"viewer", "editor"},
+			customClaims: map[string]interface{}{"department": "IT"},
+		},
+		{
+			subject: "jdoe",
+			roles:   []string{"viewer"},
+		},
+		{
+			subject: "mallory",
+			denied:  true,
+		},
+		{
+			subject: "slow",
+			failed:  true,
+		},
+		{
+			subject: "broken",
+			failed:  true,
+		},
+	}
+
+	for i, test := range tests {
+		testDescr := fmt.Sprintf("Test %d, subject: %s", i, test.subject)
+		claims := &jwtclaims.UserClaims{Subject: test.subject, Roles: []string{"viewer"}}
+		customClaims, err := wh.Validate("local", claims, nil)
+		_, denied := err.(*DenyError)
+		if denied != test.denied || (err != nil && !denied) != test.failed {
+			t.Logf("FAIL: %s, unexpected result, error: %v", testDescr, err)
+			testFailed++
+			continue
+		}
+		if err != nil {
+			t.Logf("PASS: %s, error: %s", testDescr, err)
+			continue
+		}
+		if claims.Subject != test.subject {
+			t.Logf("FAIL: %s, protected sub claim changed: %s", testDescr, claims.Subject)
+			testFailed++
+			continue
+		}
+		if !reflect.DeepEqual(claims.Roles, test.roles) || !reflect.DeepEqual(customClaims, test.customClaims) {
+			t.Logf("FAIL: %s, claims mismatch, roles: %v, custom claims: %v", testDescr, claims.Roles, customClaims)
+			testFailed++
+			continue
+		}
+		t.Logf("PASS: %s", testDescr)
+	}
+
+	if testFailed > 0 {
+		t.Fatalf("Failed %d tests", testFailed)
+	}
+}
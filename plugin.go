@@ -48,6 +48,15 @@ func (m *AuthMiddleware) Provision(ctx caddy.Context) error {
 	return m.Portal.Configure(opts)
 }
 
+// Cleanup waits for the in-flight authentication requests to complete
+// when the server stops or reloads the configuration.
+func (m *AuthMiddleware) Cleanup() error {
+	if m.Portal == nil {
+		return nil
+	}
+	return m.Portal.Cleanup()
+}
+
 // Validate implements caddy.Validator.
 func (m *AuthMiddleware) Validate() error {
 	return nil
@@ -76,5 +85,6 @@ func GetRequestID(r *http.Request) string {
 var (
 	_ caddy.Provisioner           = (*AuthMiddleware)(nil)
 	_ caddy.Validator             = (*AuthMiddleware)(nil)
+	_ caddy.CleanerUpper          = (*AuthMiddleware)(nil)
 	_ caddyhttp.MiddlewareHandler = (*AuthMiddleware)(nil)
 )